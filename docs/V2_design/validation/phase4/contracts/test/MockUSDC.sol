@@ -0,0 +1,28 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.24;
+
+import "@openzeppelin/contracts/token/ERC20/ERC20.sol";
+import "@openzeppelin/contracts/token/ERC20/extensions/ERC20Permit.sol";
+
+/**
+ * @title MockUSDC
+ * @notice 测试用 USDC：6 位小数，支持 ERC-2612 permit，任何人都可以 mint
+ * @dev market-blockchain 的模拟链测试（internal/blockchain/simulated_test.go）部署本合约。
+ *      服务端通过 version() 和 DOMAIN_SEPARATOR() 校验 EIP-712 domain，
+ *      OpenZeppelin ERC20Permit 的 domain version 固定为 "1"。
+ */
+contract MockUSDC is ERC20, ERC20Permit {
+    constructor() ERC20("USD Coin", "USDC") ERC20Permit("USD Coin") {}
+
+    function decimals() public pure override returns (uint8) {
+        return 6;
+    }
+
+    function version() external pure returns (string memory) {
+        return "1";
+    }
+
+    function mint(address to, uint256 amount) external {
+        _mint(to, amount);
+    }
+}
@@ -2,11 +2,19 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"market-blockchain/internal/app"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
 	application, err := app.New()
 	if err != nil {
 		log.Fatalf("init app: %v", err)
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"market-blockchain/internal/api/middleware"
+	"market-blockchain/internal/service"
+)
+
+type AccountHistoryHandler struct {
+	historyService    *service.AccountHistoryService
+	walletAuthService *service.WalletAuthService
+}
+
+func NewAccountHistoryHandler(
+	historyService *service.AccountHistoryService,
+	walletAuthService *service.WalletAuthService,
+) *AccountHistoryHandler {
+	return &AccountHistoryHandler{
+		historyService:    historyService,
+		walletAuthService: walletAuthService,
+	}
+}
+
+type SubscriptionHistoryEntry struct {
+	SubscriptionResponse
+	CreatedAt int64 `json:"created_at"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+type ChargeHistoryEntry struct {
+	ChargeResponse
+	SubscriptionID string `json:"subscription_id"`
+	TxURL          string `json:"tx_url,omitempty"`
+	CreatedAt      int64  `json:"created_at"`
+	UpdatedAt      int64  `json:"updated_at"`
+}
+
+type AuthorizationHistoryEntry struct {
+	AuthorizationResponse
+	PermitTxURL string `json:"permit_tx_url,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+}
+
+type EventHistoryEntry struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	PlanID      string          `json:"plan_id,omitempty"`
+	ChargeID    string          `json:"charge_id,omitempty"`
+	Description string          `json:"description"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt   int64           `json:"created_at"`
+}
+
+// GetSubscriptions lists an identity's subscriptions, newest first, so a
+// wallet can find them without knowing their IDs.
+func (h *AccountHistoryHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	identityAddress, query, ok := h.authorizeHistory(w, r, "status")
+	if !ok {
+		return
+	}
+
+	page, err := h.historyService.Subscriptions(r.Context(), identityAddress, query)
+	if err != nil {
+		respondHistoryError(w, err)
+		return
+	}
+
+	entries := make([]SubscriptionHistoryEntry, 0, len(page.Subscriptions))
+	for _, sub := range page.Subscriptions {
+		entries = append(entries, SubscriptionHistoryEntry{
+			SubscriptionResponse: mapSubscriptionToResponse(sub),
+			CreatedAt:            sub.CreatedAt,
+			UpdatedAt:            sub.UpdatedAt,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"identity_address": identityAddress,
+		"subscriptions":    entries,
+		"next_cursor":      page.NextCursor,
+	})
+}
+
+// GetCharges lists an identity's charges with links to their transactions.
+func (h *AccountHistoryHandler) GetCharges(w http.ResponseWriter, r *http.Request) {
+	identityAddress, query, ok := h.authorizeHistory(w, r, "status")
+	if !ok {
+		return
+	}
+
+	page, err := h.historyService.Charges(r.Context(), identityAddress, query)
+	if err != nil {
+		respondHistoryError(w, err)
+		return
+	}
+
+	entries := make([]ChargeHistoryEntry, 0, len(page.Charges))
+	for _, charge := range page.Charges {
+		entries = append(entries, ChargeHistoryEntry{
+			ChargeResponse: mapChargeToResponse(charge),
+			SubscriptionID: charge.SubscriptionID,
+			TxURL:          h.historyService.TxURL(charge.TxHash),
+			CreatedAt:      charge.CreatedAt,
+			UpdatedAt:      charge.UpdatedAt,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"identity_address": identityAddress,
+		"charges":          entries,
+		"next_cursor":      page.NextCursor,
+	})
+}
+
+// GetAuthorizations lists an identity's allowance authorizations and what is
+// left of each.
+func (h *AccountHistoryHandler) GetAuthorizations(w http.ResponseWriter, r *http.Request) {
+	identityAddress, query, ok := h.authorizeHistory(w, r, "status")
+	if !ok {
+		return
+	}
+
+	page, err := h.historyService.Authorizations(r.Context(), identityAddress, query)
+	if err != nil {
+		respondHistoryError(w, err)
+		return
+	}
+
+	entries := make([]AuthorizationHistoryEntry, 0, len(page.Authorizations))
+	for _, auth := range page.Authorizations {
+		entries = append(entries, AuthorizationHistoryEntry{
+			AuthorizationResponse: mapAuthorizationToResponse(auth),
+			PermitTxURL:           h.historyService.TxURL(auth.PermitTxHash),
+			CreatedAt:             auth.CreatedAt,
+			UpdatedAt:             auth.UpdatedAt,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"identity_address": identityAddress,
+		"authorizations":   entries,
+		"next_cursor":      page.NextCursor,
+	})
+}
+
+// GetEvents lists an identity's lifecycle events; the type parameter filters
+// on the event type.
+func (h *AccountHistoryHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	identityAddress, query, ok := h.authorizeHistory(w, r, "type")
+	if !ok {
+		return
+	}
+
+	page, err := h.historyService.Events(r.Context(), identityAddress, query)
+	if err != nil {
+		respondHistoryError(w, err)
+		return
+	}
+
+	entries := make([]EventHistoryEntry, 0, len(page.Events))
+	for _, event := range page.Events {
+		entry := EventHistoryEntry{
+			ID:          event.ID,
+			Type:        string(event.Type),
+			PlanID:      event.PlanID,
+			ChargeID:    event.ChargeID,
+			Description: event.Description,
+			CreatedAt:   event.CreatedAt,
+		}
+		if json.Valid([]byte(event.Metadata)) {
+			entry.Metadata = json.RawMessage(event.Metadata)
+		}
+		entries = append(entries, entry)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"identity_address": identityAddress,
+		"events":           entries,
+		"next_cursor":      page.NextCursor,
+	})
+}
+
+// authorizeHistory checks that the signed-in wallet may read the identity's
+// history and parses the page query: statusParam, from and to (unix millis),
+// cursor and limit. It writes the error response itself.
+func (h *AccountHistoryHandler) authorizeHistory(w http.ResponseWriter, r *http.Request, statusParam string) (string, service.HistoryQuery, bool) {
+	identityAddress := r.PathValue("address")
+	if identityAddress == "" {
+		respondError(w, http.StatusBadRequest, "address is required")
+		return "", service.HistoryQuery{}, false
+	}
+
+	err := h.walletAuthService.AuthorizeIdentity(r.Context(), middleware.WalletAddress(r.Context()), identityAddress)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrIdentityAccessDenied):
+		respondError(w, http.StatusForbidden, err.Error())
+		return "", service.HistoryQuery{}, false
+	default:
+		respondError(w, http.StatusInternalServerError, "internal server error")
+		return "", service.HistoryQuery{}, false
+	}
+
+	values := r.URL.Query()
+	query := service.HistoryQuery{Status: values.Get(statusParam), Cursor: values.Get("cursor")}
+	for _, param := range []struct {
+		name  string
+		value *int64
+	}{{"from", &query.From}, {"to", &query.To}} {
+		if raw := values.Get(param.name); raw != "" {
+			parsed, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, param.name+" must be a unix timestamp in milliseconds")
+				return "", service.HistoryQuery{}, false
+			}
+			*param.value = parsed
+		}
+	}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			respondError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return "", service.HistoryQuery{}, false
+		}
+		query.Limit = limit
+	}
+	return identityAddress, query, true
+}
+
+func respondHistoryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrInvalidHistoryQuery) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondError(w, http.StatusInternalServerError, "internal server error")
+}
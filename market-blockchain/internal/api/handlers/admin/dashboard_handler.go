@@ -4,83 +4,237 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"market-blockchain/internal/domain"
 	"market-blockchain/internal/repository"
+	"market-blockchain/internal/service"
 )
 
 type DashboardHandler struct {
 	subscriptionRepo repository.SubscriptionRepository
-	chargeRepo       repository.ChargeRepository
 	eventRepo        repository.EventRepository
+	analyticsService *service.AnalyticsService
 }
 
 func NewDashboardHandler(
 	subscriptionRepo repository.SubscriptionRepository,
-	chargeRepo repository.ChargeRepository,
 	eventRepo repository.EventRepository,
+	analyticsService *service.AnalyticsService,
 ) *DashboardHandler {
 	return &DashboardHandler{
 		subscriptionRepo: subscriptionRepo,
-		chargeRepo:       chargeRepo,
 		eventRepo:        eventRepo,
+		analyticsService: analyticsService,
+	}
+}
+
+func (h *DashboardHandler) Routes() []Route {
+	return []Route{
+		{Pattern: "GET /admin/api/v1/dashboard/metrics", Role: domain.AdminRoleViewer, Handler: h.GetMetrics},
+		{Pattern: "GET /admin/api/v1/dashboard/revenue-trend", Role: domain.AdminRoleFinance, Handler: h.GetRevenueTrend},
+		{Pattern: "GET /admin/api/v1/dashboard/revenue-by-plan", Role: domain.AdminRoleFinance, Handler: h.GetRevenueByPlan},
+		{Pattern: "GET /admin/api/v1/dashboard/subscription-trend", Role: domain.AdminRoleViewer, Handler: h.GetSubscriptionTrend},
+		{Pattern: "GET /admin/api/v1/dashboard/subscription-distribution", Role: domain.AdminRoleViewer, Handler: h.GetSubscriptionDistribution},
+		{Pattern: "GET /admin/api/v1/dashboard/recent-events", Role: domain.AdminRoleViewer, Handler: h.GetRecentEvents},
 	}
 }
 
 type MetricsResponse struct {
+	From                 int64   `json:"from"`
+	To                   int64   `json:"to"`
 	ActiveSubscriptions  int     `json:"active_subscriptions"`
-	Revenue30d           float64 `json:"revenue_30d"`
+	MRR                  float64 `json:"mrr"`
+	Revenue              float64 `json:"revenue"`
+	NewSubscriptions     int     `json:"new_subscriptions"`
+	ChurnedSubscriptions int     `json:"churned_subscriptions"`
+	RenewalsCompleted    int     `json:"renewals_completed"`
+	RenewalsFailed       int     `json:"renewals_failed"`
+	RenewalSuccessRate   float64 `json:"renewal_success_rate"`
 	PendingChargesCount  int     `json:"pending_charges_count"`
 	PendingChargesAmount float64 `json:"pending_charges_amount"`
 	FailedChargesCount   int     `json:"failed_charges_count"`
 	FailedChargesAmount  float64 `json:"failed_charges_amount"`
 }
 
-func (h *DashboardHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+type RevenueBucketResponse struct {
+	BucketStart int64   `json:"bucket_start"`
+	ChargeCount int     `json:"charge_count"`
+	Revenue     float64 `json:"revenue"`
+}
+
+type PlanRevenueResponse struct {
+	PlanID      string  `json:"plan_id"`
+	ChargeCount int     `json:"charge_count"`
+	Revenue     float64 `json:"revenue"`
+}
 
-	activeCount, _ := h.subscriptionRepo.CountByStatus(ctx, "active")
+type SubscriptionMovementResponse struct {
+	BucketStart int64 `json:"bucket_start"`
+	New         int   `json:"new"`
+	Cancelled   int   `json:"cancelled"`
+	Expired     int   `json:"expired"`
+	Churned     int   `json:"churned"`
+}
 
-	now := time.Now().UnixMilli()
-	thirtyDaysAgo := now - (30 * 24 * 60 * 60 * 1000)
-	revenue30d, _ := h.chargeRepo.SumCompletedCharges(ctx, thirtyDaysAgo, now)
+// GetMetrics summarizes revenue, subscription movement and renewals over a
+// range, 30 days by default. Query parameters: from and to (unix millis).
+func (h *DashboardHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	query, ok := parseAnalyticsQuery(w, r, "")
+	if !ok {
+		return
+	}
 
-	pendingCount, pendingAmount, _ := h.chargeRepo.CountAndSumByStatus(ctx, "pending")
-	failedCount, failedAmount, _ := h.chargeRepo.CountAndSumByStatus(ctx, "failed")
+	metrics, err := h.analyticsService.Metrics(r.Context(), query)
+	if err != nil {
+		http.Error(w, "failed to load metrics", http.StatusInternalServerError)
+		return
+	}
 
 	response := MetricsResponse{
-		ActiveSubscriptions:  activeCount,
-		Revenue30d:           float64(revenue30d) / 1000000,
-		PendingChargesCount:  pendingCount,
-		PendingChargesAmount: float64(pendingAmount) / 1000000,
-		FailedChargesCount:   failedCount,
-		FailedChargesAmount:  float64(failedAmount) / 1000000,
+		From:                 metrics.From,
+		To:                   metrics.To,
+		ActiveSubscriptions:  metrics.ActiveSubscriptions,
+		MRR:                  usdcAmount(metrics.MRR),
+		Revenue:              usdcAmount(metrics.Revenue),
+		NewSubscriptions:     metrics.NewSubscriptions,
+		ChurnedSubscriptions: metrics.ChurnedSubscriptions,
+		RenewalsCompleted:    metrics.Renewals.Completed,
+		RenewalsFailed:       metrics.Renewals.Failed,
+		RenewalSuccessRate:   metrics.Renewals.SuccessRate(),
+		PendingChargesCount:  metrics.PendingChargesCount,
+		PendingChargesAmount: usdcAmount(metrics.PendingChargesAmount),
+		FailedChargesCount:   metrics.FailedChargesCount,
+		FailedChargesAmount:  usdcAmount(metrics.FailedChargesAmount),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// GetRevenueTrend returns completed charge revenue per day, week or month.
+// Query parameters: granularity (day, week or month), from and to (unix
+// millis).
 func (h *DashboardHandler) GetRevenueTrend(w http.ResponseWriter, r *http.Request) {
+	query, ok := parseAnalyticsQuery(w, r, r.URL.Query().Get("granularity"))
+	if !ok {
+		return
+	}
+
+	buckets, err := h.analyticsService.RevenueTrend(r.Context(), query)
+	if err != nil {
+		http.Error(w, "failed to load revenue trend", http.StatusInternalServerError)
+		return
+	}
+
+	data := make([]RevenueBucketResponse, 0, len(buckets))
+	for _, bucket := range buckets {
+		data = append(data, RevenueBucketResponse{
+			BucketStart: bucket.BucketStart,
+			ChargeCount: bucket.ChargeCount,
+			Revenue:     usdcAmount(bucket.Amount),
+		})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"data": []interface{}{}})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"granularity": query.Granularity,
+		"from":        query.From,
+		"to":          query.To,
+		"data":        data,
+	})
 }
 
-func (h *DashboardHandler) GetSubscriptionDistribution(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+// GetRevenueByPlan returns completed charge revenue per plan over a range,
+// 30 days by default. Query parameters: from and to (unix millis).
+func (h *DashboardHandler) GetRevenueByPlan(w http.ResponseWriter, r *http.Request) {
+	query, ok := parseAnalyticsQuery(w, r, "")
+	if !ok {
+		return
+	}
+
+	revenue, err := h.analyticsService.RevenueByPlan(r.Context(), query)
+	if err != nil {
+		http.Error(w, "failed to load revenue by plan", http.StatusInternalServerError)
+		return
+	}
 
-	activeCount, _ := h.subscriptionRepo.CountByStatus(ctx, "active")
-	cancelledCount, _ := h.subscriptionRepo.CountByStatus(ctx, "cancelled")
-	expiredCount, _ := h.subscriptionRepo.CountByStatus(ctx, "expired")
+	data := make([]PlanRevenueResponse, 0, len(revenue))
+	for _, entry := range revenue {
+		data = append(data, PlanRevenueResponse{
+			PlanID:      entry.PlanID,
+			ChargeCount: entry.ChargeCount,
+			Revenue:     usdcAmount(entry.Amount),
+		})
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"active":    activeCount,
-		"cancelled": cancelledCount,
-		"expired":   expiredCount,
+		"from": query.From,
+		"to":   query.To,
+		"data": data,
 	})
 }
 
+// GetSubscriptionTrend returns new and churned subscriptions per day, week or
+// month. Query parameters: granularity (day, week or month), from and to
+// (unix millis).
+func (h *DashboardHandler) GetSubscriptionTrend(w http.ResponseWriter, r *http.Request) {
+	query, ok := parseAnalyticsQuery(w, r, r.URL.Query().Get("granularity"))
+	if !ok {
+		return
+	}
+
+	trend, err := h.analyticsService.SubscriptionTrend(r.Context(), query)
+	if err != nil {
+		http.Error(w, "failed to load subscription trend", http.StatusInternalServerError)
+		return
+	}
+
+	data := make([]SubscriptionMovementResponse, 0, len(trend.Buckets))
+	for _, movement := range trend.Buckets {
+		data = append(data, SubscriptionMovementResponse{
+			BucketStart: movement.BucketStart,
+			New:         movement.New,
+			Cancelled:   movement.Cancelled,
+			Expired:     movement.Expired,
+			Churned:     movement.Churned(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"granularity": query.Granularity,
+		"from":        query.From,
+		"to":          query.To,
+		"new":         trend.New,
+		"cancelled":   trend.Cancelled,
+		"expired":     trend.Expired,
+		"churned":     trend.Cancelled + trend.Expired,
+		"data":        data,
+	})
+}
+
+func (h *DashboardHandler) GetSubscriptionDistribution(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	distribution := make(map[string]interface{})
+	for _, status := range []domain.SubscriptionStatus{
+		domain.SubscriptionActive, domain.SubscriptionPastDue, domain.SubscriptionCancelled, domain.SubscriptionExpired,
+	} {
+		count, err := h.subscriptionRepo.CountByStatus(ctx, string(status))
+		if err != nil {
+			http.Error(w, "failed to count subscriptions", http.StatusInternalServerError)
+			return
+		}
+		distribution[string(status)] = count
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(distribution)
+}
+
 func (h *DashboardHandler) GetRecentEvents(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -89,10 +243,44 @@ func (h *DashboardHandler) GetRecentEvents(w http.ResponseWriter, r *http.Reques
 		fmt.Sscanf(limitParam, "%d", &limit)
 	}
 
-	events, _ := h.eventRepo.ListRecent(ctx, limit)
+	events, err := h.eventRepo.ListRecent(ctx, limit)
+	if err != nil {
+		http.Error(w, "failed to list events", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"events": events,
 	})
 }
+
+// parseAnalyticsQuery reads the from and to parameters and validates the
+// range with the given granularity. It writes the error response itself.
+func parseAnalyticsQuery(w http.ResponseWriter, r *http.Request, granularity string) (service.AnalyticsQuery, bool) {
+	var bounds [2]int64
+	for i, name := range []string{"from", "to"} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, name+" must be a unix timestamp in milliseconds", http.StatusBadRequest)
+			return service.AnalyticsQuery{}, false
+		}
+		bounds[i] = parsed
+	}
+
+	query, err := service.NewAnalyticsQuery(granularity, bounds[0], bounds[1], time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return service.AnalyticsQuery{}, false
+	}
+	return query, true
+}
+
+// usdcAmount converts USDC base units to a display amount.
+func usdcAmount(baseUnits int64) float64 {
+	return float64(baseUnits) / 1000000
+}
@@ -25,6 +25,14 @@ func NewAdminPlanHandler(
 	}
 }
 
+func (h *AdminPlanHandler) Routes() []Route {
+	return []Route{
+		{Pattern: "GET /admin/api/v1/plans", Role: domain.AdminRoleViewer, Handler: h.ListPlans},
+		{Pattern: "POST /admin/api/v1/plans", Role: domain.AdminRoleOperator, Handler: h.CreatePlan},
+		{Pattern: "PUT /admin/api/v1/plans/{id}", Role: domain.AdminRoleOperator, Handler: h.UpdatePlan},
+	}
+}
+
 type PlanWithStats struct {
 	domain.Plan
 	ActiveSubscribers int `json:"active_subscribers"`
@@ -61,6 +69,9 @@ type CreatePlanRequest struct {
 	PeriodSeconds        int64  `json:"period_seconds"`
 	AmountUSDCBaseUnits  int64  `json:"amount_usdc_base_units"`
 	AuthorizationPeriods int32  `json:"authorization_periods"`
+	TrafficQuotaBytes    int64  `json:"traffic_quota_bytes"`
+	OverQuotaPolicy      string `json:"over_quota_policy"`
+	GraceAccess          string `json:"grace_access"`
 	Active               bool   `json:"active"`
 }
 
@@ -71,11 +82,29 @@ func (h *AdminPlanHandler) CreatePlan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.PlanID == "" || req.Name == "" || req.PeriodSeconds <= 0 || req.AmountUSDCBaseUnits <= 0 || req.AuthorizationPeriods < 1 {
+	if req.PlanID == "" || req.Name == "" || req.PeriodSeconds <= 0 || req.AmountUSDCBaseUnits <= 0 || req.AuthorizationPeriods < 1 || req.TrafficQuotaBytes < 0 {
 		http.Error(w, "invalid plan parameters", http.StatusBadRequest)
 		return
 	}
 
+	policy := domain.OverQuotaSuspend
+	if req.OverQuotaPolicy != "" {
+		var ok bool
+		if policy, ok = parseOverQuotaPolicy(req.OverQuotaPolicy); !ok {
+			http.Error(w, "over_quota_policy must be suspend or warn", http.StatusBadRequest)
+			return
+		}
+	}
+
+	graceAccess := domain.GraceAccessKeep
+	if req.GraceAccess != "" {
+		var ok bool
+		if graceAccess, ok = parseGraceAccessPolicy(req.GraceAccess); !ok {
+			http.Error(w, "grace_access must be keep or suspend", http.StatusBadRequest)
+			return
+		}
+	}
+
 	now := time.Now().UnixMilli()
 	plan := &domain.Plan{
 		PlanID:                   req.PlanID,
@@ -86,6 +115,9 @@ func (h *AdminPlanHandler) CreatePlan(w http.ResponseWriter, r *http.Request) {
 		AmountUSDCDisplay:        formatUSDC(req.AmountUSDCBaseUnits),
 		AuthorizationPeriods:     req.AuthorizationPeriods,
 		TotalAuthorizationAmount: req.AmountUSDCBaseUnits * int64(req.AuthorizationPeriods),
+		TrafficQuotaBytes:        req.TrafficQuotaBytes,
+		OverQuotaPolicy:          policy,
+		GraceAccess:              graceAccess,
 		Active:                   req.Active,
 		CreatedAt:                now,
 		UpdatedAt:                now,
@@ -104,8 +136,11 @@ func (h *AdminPlanHandler) CreatePlan(w http.ResponseWriter, r *http.Request) {
 }
 
 type UpdatePlanRequest struct {
-	Name   string `json:"name"`
-	Active *bool  `json:"active"`
+	Name              string `json:"name"`
+	Active            *bool  `json:"active"`
+	TrafficQuotaBytes *int64 `json:"traffic_quota_bytes"`
+	OverQuotaPolicy   string `json:"over_quota_policy"`
+	GraceAccess       string `json:"grace_access"`
 }
 
 func (h *AdminPlanHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
@@ -129,6 +164,29 @@ func (h *AdminPlanHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
 	if req.Active != nil {
 		plan.Active = *req.Active
 	}
+	if req.TrafficQuotaBytes != nil {
+		if *req.TrafficQuotaBytes < 0 {
+			http.Error(w, "traffic_quota_bytes must not be negative", http.StatusBadRequest)
+			return
+		}
+		plan.TrafficQuotaBytes = *req.TrafficQuotaBytes
+	}
+	if req.OverQuotaPolicy != "" {
+		policy, ok := parseOverQuotaPolicy(req.OverQuotaPolicy)
+		if !ok {
+			http.Error(w, "over_quota_policy must be suspend or warn", http.StatusBadRequest)
+			return
+		}
+		plan.OverQuotaPolicy = policy
+	}
+	if req.GraceAccess != "" {
+		graceAccess, ok := parseGraceAccessPolicy(req.GraceAccess)
+		if !ok {
+			http.Error(w, "grace_access must be keep or suspend", http.StatusBadRequest)
+			return
+		}
+		plan.GraceAccess = graceAccess
+	}
 	plan.UpdatedAt = time.Now().UnixMilli()
 
 	if err := h.planRepo.Update(plan); err != nil {
@@ -142,6 +200,24 @@ func (h *AdminPlanHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func parseOverQuotaPolicy(value string) (domain.OverQuotaPolicy, bool) {
+	switch policy := domain.OverQuotaPolicy(value); policy {
+	case domain.OverQuotaSuspend, domain.OverQuotaWarn:
+		return policy, true
+	default:
+		return "", false
+	}
+}
+
+func parseGraceAccessPolicy(value string) (domain.GraceAccessPolicy, bool) {
+	switch policy := domain.GraceAccessPolicy(value); policy {
+	case domain.GraceAccessKeep, domain.GraceAccessSuspend:
+		return policy, true
+	default:
+		return "", false
+	}
+}
+
 func formatUSDC(baseUnits int64) string {
 	dollars := float64(baseUnits) / 1000000
 	return fmt.Sprintf("%.2f USDC", dollars)
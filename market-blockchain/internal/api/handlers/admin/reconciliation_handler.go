@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+	"market-blockchain/internal/service"
+)
+
+type ReconciliationHandler struct {
+	reconciliationService *service.ReconciliationService
+	discrepancyRepo       repository.DiscrepancyRepository
+}
+
+// NewReconciliationHandler accepts a nil service when the blockchain client is
+// not configured; listing still works but runs are rejected.
+func NewReconciliationHandler(
+	reconciliationService *service.ReconciliationService,
+	discrepancyRepo repository.DiscrepancyRepository,
+) *ReconciliationHandler {
+	return &ReconciliationHandler{
+		reconciliationService: reconciliationService,
+		discrepancyRepo:       discrepancyRepo,
+	}
+}
+
+func (h *ReconciliationHandler) Routes() []Route {
+	return []Route{
+		{Pattern: "GET /admin/api/v1/reconciliation/discrepancies", Role: domain.AdminRoleFinance, Handler: h.ListDiscrepancies},
+		{Pattern: "POST /admin/api/v1/reconciliation/run", Role: domain.AdminRoleOperator, Handler: h.RunReconciliation},
+	}
+}
+
+type DiscrepancyResponse struct {
+	ID              string `json:"id"`
+	RunID           string `json:"run_id"`
+	Type            string `json:"type"`
+	SubscriptionID  string `json:"subscription_id"`
+	AuthorizationID string `json:"authorization_id"`
+	ChargeRecordID  string `json:"charge_record_id"`
+	IdentityAddress string `json:"identity_address"`
+	PayerAddress    string `json:"payer_address"`
+	LocalValue      string `json:"local_value"`
+	ChainValue      string `json:"chain_value"`
+	Corrected       bool   `json:"corrected"`
+	CreatedAt       int64  `json:"created_at"`
+}
+
+func (h *ReconciliationHandler) ListDiscrepancies(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	discrepancyType := r.URL.Query().Get("type")
+	if discrepancyType == "all" {
+		discrepancyType = ""
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	discrepancies, err := h.discrepancyRepo.List(ctx, discrepancyType, limit, (page-1)*limit)
+	if err != nil {
+		http.Error(w, "failed to list discrepancies", http.StatusInternalServerError)
+		return
+	}
+	total, err := h.discrepancyRepo.Count(ctx, discrepancyType)
+	if err != nil {
+		http.Error(w, "failed to count discrepancies", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"discrepancies": toDiscrepancyResponses(discrepancies),
+		"total":         total,
+		"page":          page,
+		"limit":         limit,
+	})
+}
+
+type RunReconciliationRequest struct {
+	AutoCorrect bool `json:"auto_correct"`
+}
+
+func (h *ReconciliationHandler) RunReconciliation(w http.ResponseWriter, r *http.Request) {
+	if h.reconciliationService == nil {
+		http.Error(w, "blockchain client not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req RunReconciliationRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := h.reconciliationService.Run(r.Context(), req.AutoCorrect)
+	if err != nil {
+		http.Error(w, "reconciliation failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"run_id":                  result.RunID,
+		"subscriptions_checked":   result.SubscriptionsChecked,
+		"subscriptions_errored":   result.SubscriptionsErrored,
+		"discrepancies_found":     result.DiscrepanciesFound,
+		"discrepancies_corrected": result.DiscrepanciesCorrected,
+		"discrepancies":           toDiscrepancyResponses(result.Discrepancies),
+	})
+}
+
+func toDiscrepancyResponses(discrepancies []*domain.Discrepancy) []DiscrepancyResponse {
+	responses := make([]DiscrepancyResponse, 0, len(discrepancies))
+	for _, d := range discrepancies {
+		responses = append(responses, DiscrepancyResponse{
+			ID:              d.ID,
+			RunID:           d.RunID,
+			Type:            string(d.Type),
+			SubscriptionID:  d.SubscriptionID,
+			AuthorizationID: d.AuthorizationID,
+			ChargeRecordID:  d.ChargeRecordID,
+			IdentityAddress: d.IdentityAddress,
+			PayerAddress:    d.PayerAddress,
+			LocalValue:      d.LocalValue,
+			ChainValue:      d.ChainValue,
+			Corrected:       d.Corrected,
+			CreatedAt:       d.CreatedAt,
+		})
+	}
+	return responses
+}
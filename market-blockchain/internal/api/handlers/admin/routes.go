@@ -0,0 +1,16 @@
+package admin
+
+import (
+	"net/http"
+
+	"market-blockchain/internal/domain"
+)
+
+// Route is an admin endpoint together with the role it requires. Handlers
+// declare their routes so the role sits next to the code it protects; the
+// router wraps each one in the admin auth middleware.
+type Route struct {
+	Pattern string
+	Role    domain.AdminRole
+	Handler http.HandlerFunc
+}
@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"market-blockchain/internal/api/middleware"
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/service"
+)
+
+// AdminSessionHandler lets the browser UI exchange an API key or a wallet
+// session token for an HttpOnly cookie.
+type AdminSessionHandler struct {
+	adminAuthService *service.AdminAuthService
+}
+
+func NewAdminSessionHandler(adminAuthService *service.AdminAuthService) *AdminSessionHandler {
+	return &AdminSessionHandler{
+		adminAuthService: adminAuthService,
+	}
+}
+
+// Routes lists the authenticated session endpoints. POST /admin/api/v1/session
+// is registered separately because it is how a caller gets credentials.
+func (h *AdminSessionHandler) Routes() []Route {
+	return []Route{
+		{Pattern: "GET /admin/api/v1/session", Role: domain.AdminRoleViewer, Handler: h.GetSession},
+	}
+}
+
+type CreateSessionRequest struct {
+	APIKey       string `json:"api_key"`
+	SessionToken string `json:"session_token"`
+}
+
+type SessionResponse struct {
+	Subject string   `json:"subject"`
+	Method  string   `json:"method"`
+	Roles   []string `json:"roles"`
+}
+
+func (h *AdminSessionHandler) CreateSession(w http.ResponseWriter, r *http.Request) {
+	var req CreateSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	principal, err := h.adminAuthService.AuthenticateAdmin(r.Context(), req.APIKey, req.SessionToken)
+	if err != nil {
+		if errors.Is(err, service.ErrAdminUnauthenticated) {
+			http.Error(w, "invalid admin credentials", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "failed to authenticate", http.StatusInternalServerError)
+		return
+	}
+
+	name, value := middleware.AdminSessionCookie, req.SessionToken
+	if principal.Method == domain.AdminAuthAPIKey {
+		name, value = middleware.AdminAPIKeyCookie, req.APIKey
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/admin",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toSessionResponse(principal))
+}
+
+func (h *AdminSessionHandler) GetSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toSessionResponse(middleware.AdminPrincipal(r.Context())))
+}
+
+func (h *AdminSessionHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{middleware.AdminAPIKeyCookie, middleware.AdminSessionCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/admin",
+			MaxAge:   -1,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toSessionResponse(principal *domain.AdminPrincipal) SessionResponse {
+	roles := make([]string, 0, len(principal.Roles))
+	for _, role := range principal.Roles {
+		roles = append(roles, string(role))
+	}
+	return SessionResponse{
+		Subject: principal.Subject,
+		Method:  string(principal.Method),
+		Roles:   roles,
+	}
+}
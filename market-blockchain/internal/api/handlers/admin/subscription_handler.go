@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"market-blockchain/internal/domain"
 	"market-blockchain/internal/repository"
 )
 
@@ -18,6 +19,12 @@ func NewAdminSubscriptionHandler(subscriptionRepo repository.SubscriptionReposit
 	}
 }
 
+func (h *AdminSubscriptionHandler) Routes() []Route {
+	return []Route{
+		{Pattern: "GET /admin/api/v1/subscriptions", Role: domain.AdminRoleViewer, Handler: h.ListSubscriptions},
+	}
+}
+
 func (h *AdminSubscriptionHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/service"
+)
+
+type TrafficHandler struct {
+	trafficUsageService *service.TrafficUsageService
+}
+
+func NewTrafficHandler(trafficUsageService *service.TrafficUsageService) *TrafficHandler {
+	return &TrafficHandler{trafficUsageService: trafficUsageService}
+}
+
+func (h *TrafficHandler) Routes() []Route {
+	return []Route{
+		{Pattern: "GET /admin/api/v1/traffic", Role: domain.AdminRoleViewer, Handler: h.GetTraffic},
+	}
+}
+
+type TrafficUsageResponse struct {
+	BucketStart int64  `json:"bucket_start"`
+	PlanID      string `json:"plan_id"`
+	NodeID      string `json:"node_id"`
+	Uplink      int64  `json:"uplink"`
+	Downlink    int64  `json:"downlink"`
+	Total       int64  `json:"total"`
+}
+
+// GetTraffic returns usage per hour or day, broken down by plan and node.
+// Query parameters: granularity (hour or day), from and to (unix millis).
+func (h *TrafficHandler) GetTraffic(w http.ResponseWriter, r *http.Request) {
+	var bounds [2]int64
+	for i, name := range []string{"from", "to"} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, name+" must be a unix timestamp in milliseconds", http.StatusBadRequest)
+			return
+		}
+		bounds[i] = parsed
+	}
+
+	query, err := service.NewTrafficQuery(r.URL.Query().Get("granularity"), bounds[0], bounds[1], time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	usage, err := h.trafficUsageService.PlanNodeUsage(r.Context(), query)
+	if err != nil {
+		http.Error(w, "failed to load traffic usage", http.StatusInternalServerError)
+		return
+	}
+
+	data := make([]TrafficUsageResponse, 0, len(usage))
+	for _, entry := range usage {
+		data = append(data, TrafficUsageResponse{
+			BucketStart: entry.BucketStart,
+			PlanID:      entry.PlanID,
+			NodeID:      entry.NodeID,
+			Uplink:      entry.Uplink,
+			Downlink:    entry.Downlink,
+			Total:       entry.Uplink + entry.Downlink,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"granularity": query.Granularity,
+		"from":        query.From,
+		"to":          query.To,
+		"data":        data,
+	})
+}
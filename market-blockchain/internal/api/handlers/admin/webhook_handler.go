@@ -0,0 +1,358 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+	"market-blockchain/internal/service"
+)
+
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+	endpointRepo   repository.WebhookEndpointRepository
+	deliveryRepo   repository.WebhookDeliveryRepository
+}
+
+func NewWebhookHandler(
+	webhookService *service.WebhookService,
+	endpointRepo repository.WebhookEndpointRepository,
+	deliveryRepo repository.WebhookDeliveryRepository,
+) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+		endpointRepo:   endpointRepo,
+		deliveryRepo:   deliveryRepo,
+	}
+}
+
+func (h *WebhookHandler) Routes() []Route {
+	return []Route{
+		{Pattern: "GET /admin/api/v1/webhooks", Role: domain.AdminRoleViewer, Handler: h.ListEndpoints},
+		{Pattern: "POST /admin/api/v1/webhooks", Role: domain.AdminRoleOperator, Handler: h.CreateEndpoint},
+		{Pattern: "PUT /admin/api/v1/webhooks/{id}", Role: domain.AdminRoleOperator, Handler: h.UpdateEndpoint},
+		{Pattern: "DELETE /admin/api/v1/webhooks/{id}", Role: domain.AdminRoleOperator, Handler: h.DeleteEndpoint},
+		{Pattern: "GET /admin/api/v1/webhooks/{id}/deliveries", Role: domain.AdminRoleViewer, Handler: h.ListDeliveries},
+		{Pattern: "POST /admin/api/v1/webhooks/deliveries/{id}/replay", Role: domain.AdminRoleOperator, Handler: h.ReplayDelivery},
+	}
+}
+
+type WebhookEndpointResponse struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Description string   `json:"description,omitempty"`
+	EventTypes  []string `json:"event_types"`
+	Active      bool     `json:"active"`
+	// Secret is only returned when the endpoint is created.
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func toWebhookEndpointResponse(endpoint *domain.WebhookEndpoint) WebhookEndpointResponse {
+	eventTypes := make([]string, 0, len(endpoint.EventTypes))
+	for _, eventType := range endpoint.EventTypes {
+		eventTypes = append(eventTypes, string(eventType))
+	}
+	return WebhookEndpointResponse{
+		ID:          endpoint.ID,
+		URL:         endpoint.URL,
+		Description: endpoint.Description,
+		EventTypes:  eventTypes,
+		Active:      endpoint.Active,
+		CreatedAt:   endpoint.CreatedAt,
+		UpdatedAt:   endpoint.UpdatedAt,
+	}
+}
+
+type WebhookDeliveryResponse struct {
+	ID             string `json:"id"`
+	EndpointID     string `json:"endpoint_id"`
+	EventID        string `json:"event_id"`
+	EventType      string `json:"event_type"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	NextAttemptAt  int64  `json:"next_attempt_at,omitempty"`
+	LastStatusCode int    `json:"last_status_code,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+	DeliveredAt    int64  `json:"delivered_at,omitempty"`
+	ReplayOf       string `json:"replay_of,omitempty"`
+	// Payload is the exact body sent, so receivers can be debugged against
+	// it.
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt int64           `json:"created_at"`
+	UpdatedAt int64           `json:"updated_at"`
+}
+
+func toWebhookDeliveryResponse(delivery *domain.WebhookDelivery) WebhookDeliveryResponse {
+	response := WebhookDeliveryResponse{
+		ID:             delivery.ID,
+		EndpointID:     delivery.EndpointID,
+		EventID:        delivery.EventID,
+		EventType:      string(delivery.EventType),
+		Status:         string(delivery.Status),
+		Attempts:       delivery.Attempts,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		DeliveredAt:    delivery.DeliveredAt,
+		ReplayOf:       delivery.ReplayOf,
+		Payload:        json.RawMessage(delivery.Payload),
+		CreatedAt:      delivery.CreatedAt,
+		UpdatedAt:      delivery.UpdatedAt,
+	}
+	if delivery.Status == domain.WebhookDeliveryPending {
+		response.NextAttemptAt = delivery.NextAttemptAt
+	}
+	return response
+}
+
+func (h *WebhookHandler) ListEndpoints(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := h.endpointRepo.ListAll(r.Context())
+	if err != nil {
+		http.Error(w, "failed to list webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	responses := make([]WebhookEndpointResponse, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		responses = append(responses, toWebhookEndpointResponse(endpoint))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": responses,
+	})
+}
+
+type CreateWebhookRequest struct {
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	// EventTypes empty subscribes to every event type.
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+}
+
+func (h *WebhookHandler) CreateEndpoint(w http.ResponseWriter, r *http.Request) {
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateWebhookURL(req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	eventTypes, err := parseWebhookEventTypes(req.EventTypes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	secret, err := service.NewWebhookSecret()
+	if err != nil {
+		http.Error(w, "failed to generate webhook secret", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	endpoint := &domain.WebhookEndpoint{
+		ID:          "wh_" + uuid.New().String(),
+		URL:         req.URL,
+		Secret:      secret,
+		Description: req.Description,
+		EventTypes:  eventTypes,
+		Active:      req.Active == nil || *req.Active,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := h.endpointRepo.Create(endpoint); err != nil {
+		http.Error(w, "failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	response := toWebhookEndpointResponse(endpoint)
+	response.Secret = endpoint.Secret
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhook": response,
+	})
+}
+
+type UpdateWebhookRequest struct {
+	URL         string    `json:"url"`
+	Description *string   `json:"description"`
+	EventTypes  *[]string `json:"event_types"`
+	Active      *bool     `json:"active"`
+}
+
+func (h *WebhookHandler) UpdateEndpoint(w http.ResponseWriter, r *http.Request) {
+	var req UpdateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	endpoint, err := h.endpointRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "failed to get webhook", http.StatusInternalServerError)
+		return
+	}
+	if endpoint == nil {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	if req.URL != "" {
+		if err := validateWebhookURL(req.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		endpoint.URL = req.URL
+	}
+	if req.Description != nil {
+		endpoint.Description = *req.Description
+	}
+	if req.EventTypes != nil {
+		eventTypes, err := parseWebhookEventTypes(*req.EventTypes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		endpoint.EventTypes = eventTypes
+	}
+	if req.Active != nil {
+		endpoint.Active = *req.Active
+	}
+	endpoint.UpdatedAt = time.Now().UnixMilli()
+
+	if err := h.endpointRepo.Update(endpoint); err != nil {
+		http.Error(w, "failed to update webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhook": toWebhookEndpointResponse(endpoint),
+	})
+}
+
+// DeleteEndpoint removes the endpoint and its delivery log. Deactivate it
+// instead to keep the log.
+func (h *WebhookHandler) DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpoint, err := h.endpointRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "failed to get webhook", http.StatusInternalServerError)
+		return
+	}
+	if endpoint == nil {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.endpointRepo.Delete(r.Context(), endpoint.ID); err != nil {
+		http.Error(w, "failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	endpoint, err := h.endpointRepo.GetByID(ctx, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "failed to get webhook", http.StatusInternalServerError)
+		return
+	}
+	if endpoint == nil {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	status := domain.WebhookDeliveryStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", domain.WebhookDeliveryPending, domain.WebhookDeliverySucceeded, domain.WebhookDeliveryFailed:
+	default:
+		http.Error(w, "status must be pending, succeeded or failed", http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	deliveries, err := h.deliveryRepo.ListByEndpoint(ctx, endpoint.ID, status, limit)
+	if err != nil {
+		http.Error(w, "failed to list webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	responses := make([]WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		responses = append(responses, toWebhookDeliveryResponse(delivery))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries": responses,
+	})
+}
+
+// ReplayDelivery queues the delivery's payload to be sent again, whatever
+// became of the original.
+func (h *WebhookHandler) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	replay, err := h.webhookService.Replay(r.Context(), r.PathValue("id"))
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrWebhookDeliveryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrWebhookEndpointInactive):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, "failed to replay webhook delivery", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"delivery": toWebhookDeliveryResponse(replay),
+	})
+}
+
+func validateWebhookURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+func parseWebhookEventTypes(values []string) ([]domain.EventType, error) {
+	seen := make(map[domain.EventType]bool, len(values))
+	eventTypes := make([]domain.EventType, 0, len(values))
+	for _, value := range values {
+		eventType := domain.EventType(value)
+		if !domain.IsWebhookEventType(eventType) {
+			return nil, errors.New("unsupported webhook event type " + value)
+		}
+		if seen[eventType] {
+			continue
+		}
+		seen[eventType] = true
+		eventTypes = append(eventTypes, eventType)
+	}
+	return eventTypes, nil
+}
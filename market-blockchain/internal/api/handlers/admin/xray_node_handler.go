@@ -0,0 +1,403 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+	"market-blockchain/internal/xray"
+)
+
+type XrayNodeHandler struct {
+	nodeRepo       repository.XrayNodeRepository
+	assignmentRepo repository.XrayNodeAssignmentRepository
+	syncRepo       repository.XrayNodeSyncRepository
+	fleet          *xray.Fleet
+}
+
+// NewXrayNodeHandler accepts a nil fleet when Xray is disabled; the registry
+// can still be edited but every node reports unknown health.
+func NewXrayNodeHandler(
+	nodeRepo repository.XrayNodeRepository,
+	assignmentRepo repository.XrayNodeAssignmentRepository,
+	syncRepo repository.XrayNodeSyncRepository,
+	fleet *xray.Fleet,
+) *XrayNodeHandler {
+	return &XrayNodeHandler{
+		nodeRepo:       nodeRepo,
+		assignmentRepo: assignmentRepo,
+		syncRepo:       syncRepo,
+		fleet:          fleet,
+	}
+}
+
+func (h *XrayNodeHandler) Routes() []Route {
+	return []Route{
+		{Pattern: "GET /admin/api/v1/xray/nodes", Role: domain.AdminRoleViewer, Handler: h.ListNodes},
+		{Pattern: "POST /admin/api/v1/xray/nodes", Role: domain.AdminRoleOperator, Handler: h.CreateNode},
+		{Pattern: "PUT /admin/api/v1/xray/nodes/{id}", Role: domain.AdminRoleOperator, Handler: h.UpdateNode},
+		{Pattern: "DELETE /admin/api/v1/xray/nodes/{id}", Role: domain.AdminRoleOperator, Handler: h.DeleteNode},
+		{Pattern: "GET /admin/api/v1/xray/users/{identity}", Role: domain.AdminRoleViewer, Handler: h.GetUserNodes},
+		{Pattern: "PUT /admin/api/v1/xray/users/{identity}/nodes", Role: domain.AdminRoleOperator, Handler: h.AssignUserNodes},
+	}
+}
+
+// XrayNodeEndpoint is the public side of a node that client configs are built
+// from. It is sent and returned as a whole.
+type XrayNodeEndpoint struct {
+	Host             string `json:"host"`
+	Port             int    `json:"port"`
+	Transport        string `json:"transport"`
+	Security         string `json:"security"`
+	Path             string `json:"path,omitempty"`
+	ServerName       string `json:"server_name,omitempty"`
+	Fingerprint      string `json:"fingerprint,omitempty"`
+	Flow             string `json:"flow,omitempty"`
+	RealityPublicKey string `json:"reality_public_key,omitempty"`
+	RealityShortID   string `json:"reality_short_id,omitempty"`
+}
+
+// toDomain fills in port 443, tcp and tls when they are left out.
+func (e *XrayNodeEndpoint) toDomain() (domain.XrayNodeEndpoint, error) {
+	endpoint := domain.XrayNodeEndpoint{
+		Host:             e.Host,
+		Port:             e.Port,
+		Transport:        domain.XrayTransport(e.Transport),
+		Security:         domain.XraySecurity(e.Security),
+		Path:             e.Path,
+		ServerName:       e.ServerName,
+		Fingerprint:      e.Fingerprint,
+		Flow:             e.Flow,
+		RealityPublicKey: e.RealityPublicKey,
+		RealityShortID:   e.RealityShortID,
+	}
+	if endpoint.Port == 0 {
+		endpoint.Port = 443
+	}
+	if endpoint.Transport == "" {
+		endpoint.Transport = domain.XrayTransportTCP
+	}
+	if endpoint.Security == "" {
+		endpoint.Security = domain.XraySecurityTLS
+	}
+	return endpoint, endpoint.Validate()
+}
+
+func toEndpointResponse(endpoint domain.XrayNodeEndpoint) XrayNodeEndpoint {
+	return XrayNodeEndpoint{
+		Host:             endpoint.Host,
+		Port:             endpoint.Port,
+		Transport:        string(endpoint.Transport),
+		Security:         string(endpoint.Security),
+		Path:             endpoint.Path,
+		ServerName:       endpoint.ServerName,
+		Fingerprint:      endpoint.Fingerprint,
+		Flow:             endpoint.Flow,
+		RealityPublicKey: endpoint.RealityPublicKey,
+		RealityShortID:   endpoint.RealityShortID,
+	}
+}
+
+type XrayNodeResponse struct {
+	ID         string           `json:"id"`
+	Name       string           `json:"name"`
+	APIAddress string           `json:"api_address"`
+	InboundTag string           `json:"inbound_tag"`
+	Enabled    bool             `json:"enabled"`
+	Endpoint   XrayNodeEndpoint `json:"endpoint"`
+	Health     string           `json:"health"`
+	LastError  string           `json:"last_error,omitempty"`
+	CheckedAt  int64            `json:"checked_at,omitempty"`
+	CreatedAt  int64            `json:"created_at"`
+	UpdatedAt  int64            `json:"updated_at"`
+}
+
+func (h *XrayNodeHandler) toNodeResponse(node *domain.XrayNode) XrayNodeResponse {
+	response := XrayNodeResponse{
+		ID:         node.ID,
+		Name:       node.Name,
+		APIAddress: node.APIAddress,
+		InboundTag: node.InboundTag,
+		Enabled:    node.Enabled,
+		Endpoint:   toEndpointResponse(node.Endpoint),
+		Health:     string(domain.XrayNodeHealthUnknown),
+		CreatedAt:  node.CreatedAt,
+		UpdatedAt:  node.UpdatedAt,
+	}
+	if !node.Enabled {
+		response.Health = string(domain.XrayNodeHealthDisabled)
+	} else if h.fleet != nil {
+		status := h.fleet.Status(node.ID)
+		response.Health = string(status.Health)
+		response.LastError = status.LastError
+		response.CheckedAt = status.CheckedAt
+	}
+	return response
+}
+
+func (h *XrayNodeHandler) ListNodes(w http.ResponseWriter, r *http.Request) {
+	nodes, err := h.nodeRepo.ListAll(r.Context())
+	if err != nil {
+		http.Error(w, "failed to list xray nodes", http.StatusInternalServerError)
+		return
+	}
+
+	responses := make([]XrayNodeResponse, 0, len(nodes))
+	for _, node := range nodes {
+		responses = append(responses, h.toNodeResponse(node))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"nodes": responses,
+	})
+}
+
+type CreateXrayNodeRequest struct {
+	Name       string            `json:"name"`
+	APIAddress string            `json:"api_address"`
+	InboundTag string            `json:"inbound_tag"`
+	Enabled    *bool             `json:"enabled"`
+	Endpoint   *XrayNodeEndpoint `json:"endpoint"`
+}
+
+func (h *XrayNodeHandler) CreateNode(w http.ResponseWriter, r *http.Request) {
+	var req CreateXrayNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" || req.APIAddress == "" || req.InboundTag == "" {
+		http.Error(w, "name, api_address and inbound_tag are required", http.StatusBadRequest)
+		return
+	}
+
+	endpoint := domain.DefaultXrayNodeEndpoint()
+	if req.Endpoint != nil {
+		var err error
+		if endpoint, err = req.Endpoint.toDomain(); err != nil {
+			http.Error(w, "invalid endpoint: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	node := &domain.XrayNode{
+		ID:         uuid.New().String(),
+		Name:       req.Name,
+		APIAddress: req.APIAddress,
+		InboundTag: req.InboundTag,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		Endpoint:   endpoint,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if err := h.nodeRepo.Create(node); err != nil {
+		http.Error(w, "failed to create xray node", http.StatusInternalServerError)
+		return
+	}
+	h.refreshFleet(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node": h.toNodeResponse(node),
+	})
+}
+
+type UpdateXrayNodeRequest struct {
+	Name       string            `json:"name"`
+	APIAddress string            `json:"api_address"`
+	InboundTag string            `json:"inbound_tag"`
+	Enabled    *bool             `json:"enabled"`
+	Endpoint   *XrayNodeEndpoint `json:"endpoint"`
+}
+
+func (h *XrayNodeHandler) UpdateNode(w http.ResponseWriter, r *http.Request) {
+	var req UpdateXrayNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	node, err := h.nodeRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "failed to get xray node", http.StatusInternalServerError)
+		return
+	}
+	if node == nil {
+		http.Error(w, "xray node not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Name != "" {
+		node.Name = req.Name
+	}
+	if req.APIAddress != "" {
+		node.APIAddress = req.APIAddress
+	}
+	if req.InboundTag != "" {
+		node.InboundTag = req.InboundTag
+	}
+	if req.Enabled != nil {
+		node.Enabled = *req.Enabled
+	}
+	if req.Endpoint != nil {
+		endpoint, err := req.Endpoint.toDomain()
+		if err != nil {
+			http.Error(w, "invalid endpoint: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		node.Endpoint = endpoint
+	}
+	node.UpdatedAt = time.Now().UnixMilli()
+
+	if err := h.nodeRepo.Update(node); err != nil {
+		http.Error(w, "failed to update xray node", http.StatusInternalServerError)
+		return
+	}
+	h.refreshFleet(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node": h.toNodeResponse(node),
+	})
+}
+
+// DeleteNode removes a node from the registry along with its assignments and
+// sync records. Users already on the node are left there.
+func (h *XrayNodeHandler) DeleteNode(w http.ResponseWriter, r *http.Request) {
+	node, err := h.nodeRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "failed to get xray node", http.StatusInternalServerError)
+		return
+	}
+	if node == nil {
+		http.Error(w, "xray node not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.nodeRepo.Delete(r.Context(), node.ID); err != nil {
+		http.Error(w, "failed to delete xray node", http.StatusInternalServerError)
+		return
+	}
+	h.refreshFleet(r)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type XrayNodeSyncResponse struct {
+	NodeID    string `json:"node_id"`
+	Action    string `json:"action"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func (h *XrayNodeHandler) GetUserNodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	identity := r.PathValue("identity")
+
+	nodeIDs, err := h.assignmentRepo.ListNodeIDs(ctx, identity)
+	if err != nil {
+		http.Error(w, "failed to list node assignments", http.StatusInternalServerError)
+		return
+	}
+	syncs, err := h.syncRepo.ListByIdentity(ctx, identity)
+	if err != nil {
+		http.Error(w, "failed to list node syncs", http.StatusInternalServerError)
+		return
+	}
+
+	syncResponses := make([]XrayNodeSyncResponse, 0, len(syncs))
+	for _, sync := range syncs {
+		syncResponses = append(syncResponses, XrayNodeSyncResponse{
+			NodeID:    sync.NodeID,
+			Action:    string(sync.Action),
+			Status:    string(sync.Status),
+			Error:     sync.Error,
+			UpdatedAt: sync.UpdatedAt,
+		})
+	}
+	if nodeIDs == nil {
+		nodeIDs = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"identity_address": identity,
+		"all_nodes":        len(nodeIDs) == 0,
+		"node_ids":         nodeIDs,
+		"syncs":            syncResponses,
+	})
+}
+
+type AssignXrayNodesRequest struct {
+	// NodeIDs empty puts the user back on every enabled node.
+	NodeIDs []string `json:"node_ids"`
+}
+
+// AssignUserNodes changes where the user is provisioned from their next sync
+// on; it does not move an active user by itself.
+func (h *XrayNodeHandler) AssignUserNodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	identity := r.PathValue("identity")
+
+	var req AssignXrayNodesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	seen := make(map[string]bool, len(req.NodeIDs))
+	nodeIDs := make([]string, 0, len(req.NodeIDs))
+	for _, nodeID := range req.NodeIDs {
+		if seen[nodeID] {
+			continue
+		}
+		seen[nodeID] = true
+
+		node, err := h.nodeRepo.GetByID(ctx, nodeID)
+		if err != nil {
+			http.Error(w, "failed to get xray node", http.StatusInternalServerError)
+			return
+		}
+		if node == nil {
+			http.Error(w, "unknown xray node "+nodeID, http.StatusBadRequest)
+			return
+		}
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+
+	if err := h.assignmentRepo.Replace(ctx, identity, nodeIDs, time.Now().UnixMilli()); err != nil {
+		http.Error(w, "failed to assign xray nodes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"identity_address": identity,
+		"all_nodes":        len(nodeIDs) == 0,
+		"node_ids":         nodeIDs,
+	})
+}
+
+// refreshFleet applies a registry change to the running fleet right away
+// instead of waiting for the next health check.
+func (h *XrayNodeHandler) refreshFleet(r *http.Request) {
+	if h.fleet == nil {
+		return
+	}
+	if err := h.fleet.Refresh(r.Context()); err != nil {
+		log.Printf("Failed to refresh Xray nodes: %v", err)
+		return
+	}
+	h.fleet.CheckHealth(r.Context())
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"market-blockchain/internal/api/middleware"
+	"market-blockchain/internal/service"
+)
+
+type AuthHandler struct {
+	walletAuthService *service.WalletAuthService
+}
+
+func NewAuthHandler(walletAuthService *service.WalletAuthService) *AuthHandler {
+	return &AuthHandler{
+		walletAuthService: walletAuthService,
+	}
+}
+
+type NonceResponse struct {
+	Nonce     string `json:"nonce"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func (h *AuthHandler) IssueNonce(w http.ResponseWriter, r *http.Request) {
+	nonce, err := h.walletAuthService.IssueNonce(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, NonceResponse{
+		Nonce:     nonce.Nonce,
+		ExpiresAt: nonce.ExpiresAt,
+	})
+}
+
+type SignInRequest struct {
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+type SignInResponse struct {
+	Token     string `json:"token"`
+	Address   string `json:"address"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func (h *AuthHandler) SignIn(w http.ResponseWriter, r *http.Request) {
+	var req SignInRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Message == "" || req.Signature == "" {
+		respondError(w, http.StatusBadRequest, "message and signature are required")
+		return
+	}
+
+	signature, err := hexutil.Decode(req.Signature)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "signature must be 0x-prefixed hex")
+		return
+	}
+
+	result, err := h.walletAuthService.SignIn(r.Context(), req.Message, signature)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidSignInMessage):
+			respondError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrWalletSignatureMismatch),
+			errors.Is(err, service.ErrInvalidWalletNonce):
+			respondError(w, http.StatusUnauthorized, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, SignInResponse{
+		Token:     result.Token,
+		Address:   result.Session.Address,
+		ExpiresAt: result.Session.ExpiresAt,
+	})
+}
+
+func (h *AuthHandler) SignOut(w http.ResponseWriter, r *http.Request) {
+	if err := h.walletAuthService.SignOut(r.Context(), middleware.BearerToken(r)); err != nil {
+		respondError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "signed out"})
+}
+
+// requireSubscriptionAccess writes the error response and returns false
+// unless the signed-in wallet is the subscription's identity or payer.
+func requireSubscriptionAccess(w http.ResponseWriter, r *http.Request, walletAuthService *service.WalletAuthService, subscriptionID string) bool {
+	err := walletAuthService.AuthorizeSubscription(r.Context(), middleware.WalletAddress(r.Context()), subscriptionID)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, service.ErrSubscriptionNotFound):
+		respondError(w, http.StatusNotFound, "subscription not found")
+	case errors.Is(err, service.ErrSubscriptionAccessDenied):
+		respondError(w, http.StatusForbidden, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "internal server error")
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"market-blockchain/internal/api/middleware"
+	"market-blockchain/internal/service"
+	"market-blockchain/internal/xray"
+)
+
+type ClientConfigHandler struct {
+	clientConfigService *service.ClientConfigService
+	walletAuthService   *service.WalletAuthService
+}
+
+func NewClientConfigHandler(
+	clientConfigService *service.ClientConfigService,
+	walletAuthService *service.WalletAuthService,
+) *ClientConfigHandler {
+	return &ClientConfigHandler{
+		clientConfigService: clientConfigService,
+		walletAuthService:   walletAuthService,
+	}
+}
+
+type ClientNodeResponse struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Host      string `json:"host"`
+	Port      int    `json:"port"`
+	Transport string `json:"transport"`
+	Security  string `json:"security"`
+	ShareLink string `json:"share_link"`
+}
+
+type ClientConfigResponse struct {
+	IdentityAddress  string                 `json:"identity_address"`
+	SubscriptionID   string                 `json:"subscription_id"`
+	CurrentPeriodEnd int64                  `json:"current_period_end"`
+	UUID             string                 `json:"uuid"`
+	Nodes            []ClientNodeResponse   `json:"nodes"`
+	SingBox          *xray.SingBoxConfig    `json:"sing_box"`
+	Xray             *xray.XrayClientConfig `json:"xray"`
+}
+
+// GetClientConfig returns the connection config of an identity's active
+// subscription. The format query parameter selects a single format:
+// "vless" for share links one per line, "sing-box" or "xray" for the bare
+// JSON fragment. Without it every format is returned together.
+func (h *ClientConfigHandler) GetClientConfig(w http.ResponseWriter, r *http.Request) {
+	identityAddress := r.PathValue("address")
+	if identityAddress == "" {
+		respondError(w, http.StatusBadRequest, "address is required")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "vless", "sing-box", "xray":
+	default:
+		respondError(w, http.StatusBadRequest, "format must be vless, sing-box or xray")
+		return
+	}
+
+	err := h.walletAuthService.AuthorizeIdentity(r.Context(), middleware.WalletAddress(r.Context()), identityAddress)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrIdentityAccessDenied):
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	default:
+		respondError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	config, err := h.clientConfigService.ClientConfig(r.Context(), identityAddress)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrNoActiveSubscription):
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, service.ErrTrafficSuspended):
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, service.ErrNoClientNodes):
+		respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	default:
+		respondError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	// The config carries the user's credentials.
+	w.Header().Set("Cache-Control", "no-store")
+	switch format {
+	case "vless":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(strings.Join(config.ShareLinks, "\n") + "\n"))
+		return
+	case "sing-box":
+		respondJSON(w, http.StatusOK, config.SingBox)
+		return
+	case "xray":
+		respondJSON(w, http.StatusOK, config.Xray)
+		return
+	}
+
+	resp := ClientConfigResponse{
+		IdentityAddress:  identityAddress,
+		SubscriptionID:   config.Subscription.ID,
+		CurrentPeriodEnd: config.Subscription.CurrentPeriodEnd,
+		UUID:             config.UUID,
+		Nodes:            make([]ClientNodeResponse, 0, len(config.Nodes)),
+		SingBox:          config.SingBox,
+		Xray:             config.Xray,
+	}
+	for i, node := range config.Nodes {
+		resp.Nodes = append(resp.Nodes, ClientNodeResponse{
+			ID:        node.ID,
+			Name:      node.Name,
+			Host:      node.Endpoint.Host,
+			Port:      node.Endpoint.Port,
+			Transport: string(node.Endpoint.Transport),
+			Security:  string(node.Endpoint.Security),
+			ShareLink: config.ShareLinks[i],
+		})
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
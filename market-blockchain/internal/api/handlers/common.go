@@ -17,6 +17,9 @@ type PlanResponse struct {
 	AmountUSDCDisplay        string `json:"amount_usdc_display"`
 	AuthorizationPeriods     int32  `json:"authorization_periods"`
 	TotalAuthorizationAmount int64  `json:"total_authorization_amount"`
+	TrafficQuotaBytes        int64  `json:"traffic_quota_bytes"`
+	OverQuotaPolicy          string `json:"over_quota_policy"`
+	GraceAccess              string `json:"grace_access"`
 	Active                   bool   `json:"active"`
 }
 
@@ -33,6 +36,13 @@ type SubscriptionResponse struct {
 	LastChargeID       string `json:"last_charge_id"`
 	LastChargeAt       int64  `json:"last_charge_at"`
 	Source             string `json:"source"`
+	PeriodTraffic      int64  `json:"period_traffic"`
+	TrafficSuspended   bool   `json:"traffic_suspended"`
+	// Set while the subscription is past due.
+	GraceEndsAt          int64  `json:"grace_ends_at,omitempty"`
+	RenewalAttempts      int    `json:"renewal_attempts,omitempty"`
+	LastRenewalFailure   string `json:"last_renewal_failure,omitempty"`
+	NextRenewalAttemptAt int64  `json:"next_renewal_attempt_at,omitempty"`
 }
 
 type AuthorizationResponse struct {
@@ -77,24 +87,33 @@ func mapPlanToResponse(plan *domain.Plan) PlanResponse {
 		AmountUSDCDisplay:        plan.AmountUSDCDisplay,
 		AuthorizationPeriods:     plan.AuthorizationPeriods,
 		TotalAuthorizationAmount: plan.TotalAuthorizationAmount,
+		TrafficQuotaBytes:        plan.TrafficQuotaBytes,
+		OverQuotaPolicy:          string(plan.OverQuotaPolicy),
+		GraceAccess:              string(plan.GraceAccess),
 		Active:                   plan.Active,
 	}
 }
 
 func mapSubscriptionToResponse(sub *domain.Subscription) SubscriptionResponse {
 	return SubscriptionResponse{
-		ID:                 sub.ID,
-		IdentityAddress:    sub.IdentityAddress,
-		PayerAddress:       sub.PayerAddress,
-		PlanID:             sub.PlanID,
-		Status:             string(sub.Status),
-		AutoRenew:          sub.AutoRenew,
-		CurrentPeriodStart: sub.CurrentPeriodStart,
-		CurrentPeriodEnd:   sub.CurrentPeriodEnd,
-		NextPlanID:         sub.NextPlanID,
-		LastChargeID:       sub.LastChargeID,
-		LastChargeAt:       sub.LastChargeAt,
-		Source:             string(sub.Source),
+		ID:                   sub.ID,
+		IdentityAddress:      sub.IdentityAddress,
+		PayerAddress:         sub.PayerAddress,
+		PlanID:               sub.PlanID,
+		Status:               string(sub.Status),
+		AutoRenew:            sub.AutoRenew,
+		CurrentPeriodStart:   sub.CurrentPeriodStart,
+		CurrentPeriodEnd:     sub.CurrentPeriodEnd,
+		NextPlanID:           sub.NextPlanID,
+		LastChargeID:         sub.LastChargeID,
+		LastChargeAt:         sub.LastChargeAt,
+		Source:               string(sub.Source),
+		PeriodTraffic:        sub.PeriodTraffic,
+		TrafficSuspended:     sub.TrafficSuspended,
+		GraceEndsAt:          sub.GraceEndsAt,
+		RenewalAttempts:      sub.RenewalAttempts,
+		LastRenewalFailure:   string(sub.LastRenewalFailure),
+		NextRenewalAttemptAt: sub.NextRenewalAttemptAt,
 	}
 }
 
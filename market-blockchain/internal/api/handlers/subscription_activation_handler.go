@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+
+	"market-blockchain/internal/blockchain"
+	"market-blockchain/internal/service"
+)
+
+type SubscriptionActivationHandler struct {
+	chainService *service.ChainService
+}
+
+// NewSubscriptionActivationHandler accepts a nil chainService so the route can
+// stay registered when no relayer is configured; it then answers 503.
+func NewSubscriptionActivationHandler(chainService *service.ChainService) *SubscriptionActivationHandler {
+	return &SubscriptionActivationHandler{
+		chainService: chainService,
+	}
+}
+
+// PermitSignatureRequest carries a payer's EIP-2612 permit signature, either
+// as the 65-byte hex signature or as separate v, r and s.
+type PermitSignatureRequest struct {
+	Signature string `json:"signature,omitempty"`
+	V         uint8  `json:"v,omitempty"`
+	R         string `json:"r,omitempty"`
+	S         string `json:"s,omitempty"`
+}
+
+type ActivateSubscriptionRequest struct {
+	PermitSignatureRequest
+}
+
+type ActivateSubscriptionResponse struct {
+	Subscription  SubscriptionResponse  `json:"subscription"`
+	Authorization AuthorizationResponse `json:"authorization"`
+	InitialCharge ChargeResponse        `json:"initial_charge"`
+	PermitTxHash  string                `json:"permit_tx_hash"`
+	ChargeTxHash  string                `json:"charge_tx_hash,omitempty"`
+}
+
+func (h *SubscriptionActivationHandler) ActivateSubscription(w http.ResponseWriter, r *http.Request) {
+	if h.chainService == nil {
+		respondError(w, http.StatusServiceUnavailable, "blockchain client not configured")
+		return
+	}
+
+	subscriptionID := r.PathValue("id")
+	if subscriptionID == "" {
+		respondError(w, http.StatusBadRequest, "subscription_id is required")
+		return
+	}
+
+	var req ActivateSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	sig, err := req.permitSignature()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.chainService.ActivateSubscription(r.Context(), subscriptionID, sig)
+	if err != nil {
+		respondActivationError(w, err)
+		return
+	}
+
+	resp := ActivateSubscriptionResponse{
+		Subscription:  mapSubscriptionToResponse(result.Subscription),
+		Authorization: mapAuthorizationToResponse(result.Authorization),
+		InitialCharge: mapChargeToResponse(result.Charge),
+		PermitTxHash:  result.PermitTxHash,
+		ChargeTxHash:  result.Charge.TxHash,
+	}
+
+	// The first charge is only broadcast after the permit confirms, so the
+	// subscription is still pending when this returns.
+	respondJSON(w, http.StatusAccepted, resp)
+}
+
+type PermitPayloadResponse struct {
+	AuthorizationID string             `json:"authorization_id"`
+	DomainSeparator string             `json:"domain_separator"`
+	TypedData       apitypes.TypedData `json:"typed_data"`
+}
+
+// GetPermitPayload returns the EIP-712 permit the payer has to sign, ready to
+// pass to eth_signTypedData_v4.
+func (h *SubscriptionActivationHandler) GetPermitPayload(w http.ResponseWriter, r *http.Request) {
+	if h.chainService == nil {
+		respondError(w, http.StatusServiceUnavailable, "blockchain client not configured")
+		return
+	}
+
+	subscriptionID := r.PathValue("id")
+	if subscriptionID == "" {
+		respondError(w, http.StatusBadRequest, "subscription_id is required")
+		return
+	}
+
+	payload, err := h.chainService.PreparePermit(r.Context(), subscriptionID)
+	if err != nil {
+		respondActivationError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, PermitPayloadResponse{
+		AuthorizationID: payload.AuthorizationID,
+		DomainSeparator: payload.DomainSeparator.Hex(),
+		TypedData:       payload.TypedData,
+	})
+}
+
+type RevocationPayloadResponse struct {
+	AuthorizationID   string             `json:"authorization_id"`
+	ExpectedAllowance string             `json:"expected_allowance"`
+	TargetAllowance   string             `json:"target_allowance"`
+	Deadline          int64              `json:"deadline"`
+	DomainSeparator   string             `json:"domain_separator"`
+	TypedData         apitypes.TypedData `json:"typed_data"`
+}
+
+// GetRevocationPayload returns the permit the payer signs to revoke the
+// vault's allowance when cancelling. Allowances are decimal strings because
+// token allowances routinely exceed int64.
+func (h *SubscriptionActivationHandler) GetRevocationPayload(w http.ResponseWriter, r *http.Request) {
+	if h.chainService == nil {
+		respondError(w, http.StatusServiceUnavailable, "blockchain client not configured")
+		return
+	}
+
+	subscriptionID := r.PathValue("id")
+	if subscriptionID == "" {
+		respondError(w, http.StatusBadRequest, "subscription_id is required")
+		return
+	}
+
+	payload, err := h.chainService.PrepareRevocation(r.Context(), subscriptionID)
+	if err != nil {
+		respondActivationError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, RevocationPayloadResponse{
+		AuthorizationID:   payload.AuthorizationID,
+		ExpectedAllowance: payload.ExpectedAllowance.String(),
+		TargetAllowance:   payload.TargetAllowance.String(),
+		Deadline:          payload.Deadline,
+		DomainSeparator:   payload.DomainSeparator.Hex(),
+		TypedData:         payload.TypedData,
+	})
+}
+
+func respondActivationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrSubscriptionNotFound),
+		errors.Is(err, service.ErrAuthorizationNotFound),
+		errors.Is(err, service.ErrChargeNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidPermitSignature),
+		errors.Is(err, service.ErrPermitSignerMismatch),
+		errors.Is(err, service.ErrPermitExpired):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrInvalidSubscriptionStatus),
+		errors.Is(err, service.ErrInvalidAuthorizationStatus),
+		errors.Is(err, service.ErrInvalidChargeStatus),
+		errors.Is(err, service.ErrPermitAlreadySubmitted),
+		errors.Is(err, service.ErrNothingToRevoke),
+		errors.Is(err, service.ErrChargeInFlight),
+		errors.Is(err, service.ErrChargeAuthorizationMismatch),
+		errors.Is(err, service.ErrChargeSubscriptionMismatch),
+		errors.Is(err, service.ErrAuthorizationSubscriptionMismatch):
+		respondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrPermitRejected):
+		respondError(w, http.StatusBadGateway, err.Error())
+	case errors.Is(err, service.ErrRevocationUnavailable):
+		respondError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func (req PermitSignatureRequest) permitSignature() (blockchain.PermitSignature, error) {
+	if req.Signature != "" {
+		raw, err := hexutil.Decode(req.Signature)
+		if err != nil {
+			return blockchain.PermitSignature{}, errors.New("signature must be 0x-prefixed hex")
+		}
+		return blockchain.SplitPermitSignature(raw)
+	}
+
+	if req.R == "" || req.S == "" {
+		return blockchain.PermitSignature{}, errors.New("signature or v, r and s are required")
+	}
+
+	var sig blockchain.PermitSignature
+	sig.V = req.V
+	if sig.V < 27 {
+		sig.V += 27
+	}
+	if err := decodeSignatureWord(req.R, sig.R[:]); err != nil {
+		return blockchain.PermitSignature{}, errors.New("r must be 32 bytes of 0x-prefixed hex")
+	}
+	if err := decodeSignatureWord(req.S, sig.S[:]); err != nil {
+		return blockchain.PermitSignature{}, errors.New("s must be 32 bytes of 0x-prefixed hex")
+	}
+	return sig, nil
+}
+
+func decodeSignatureWord(value string, dst []byte) error {
+	raw, err := hexutil.Decode(strings.TrimSpace(value))
+	if err != nil {
+		return err
+	}
+	if len(raw) != len(dst) {
+		return errors.New("invalid length")
+	}
+	copy(dst, raw)
+	return nil
+}
@@ -2,25 +2,32 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
 	"net/http"
 
 	"github.com/google/uuid"
 
+	"market-blockchain/internal/domain"
 	"market-blockchain/internal/service"
 )
 
 type SubscriptionHandler struct {
 	subscriptionService           *service.SubscriptionService
 	subscriptionManagementService *service.SubscriptionManagementService
+	walletAuthService             *service.WalletAuthService
 }
 
 func NewSubscriptionHandler(
 	subscriptionService *service.SubscriptionService,
 	subscriptionManagementService *service.SubscriptionManagementService,
+	walletAuthService *service.WalletAuthService,
 ) *SubscriptionHandler {
 	return &SubscriptionHandler{
 		subscriptionService:           subscriptionService,
 		subscriptionManagementService: subscriptionManagementService,
+		walletAuthService:             walletAuthService,
 	}
 }
 
@@ -98,19 +105,136 @@ func (h *SubscriptionHandler) CreateSubscription(w http.ResponseWriter, r *http.
 	respondJSON(w, http.StatusCreated, resp)
 }
 
+// CancelSubscriptionRequest is the optional DELETE body. Revocation is the
+// payer-signed permit from GET /api/v1/subscriptions/{id}/revocation-permit.
+type CancelSubscriptionRequest struct {
+	Revocation *RevocationRequest `json:"revocation,omitempty"`
+}
+
+type RevocationRequest struct {
+	PermitSignatureRequest
+	ExpectedAllowance string `json:"expected_allowance"`
+	TargetAllowance   string `json:"target_allowance"`
+	Deadline          int64  `json:"deadline"`
+}
+
+type CancelSubscriptionResponse struct {
+	Message          string               `json:"message"`
+	Subscription     SubscriptionResponse `json:"subscription"`
+	RevocationTxHash string               `json:"revocation_tx_hash,omitempty"`
+}
+
+// PartialCancelResponse reports a revocation that was broadcast although the
+// rest of the cancellation failed; clients must not submit it again.
+type PartialCancelResponse struct {
+	Error            string `json:"error"`
+	RevocationTxHash string `json:"revocation_tx_hash"`
+}
+
 func (h *SubscriptionHandler) CancelSubscription(w http.ResponseWriter, r *http.Request) {
 	subscriptionID := r.PathValue("id")
 	if subscriptionID == "" {
 		respondError(w, http.StatusBadRequest, "subscription_id is required")
 		return
 	}
+	if !requireSubscriptionAccess(w, r, h.walletAuthService, subscriptionID) {
+		return
+	}
 
-	if err := h.subscriptionManagementService.CancelSubscription(r.Context(), subscriptionID); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+	var req CancelSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]string{"message": "subscription cancelled"})
+	var revocation *service.RevocationInput
+	if req.Revocation != nil {
+		input, err := req.Revocation.revocationInput()
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		revocation = &input
+	}
+
+	result, err := h.subscriptionManagementService.CancelSubscription(r.Context(), subscriptionID, revocation)
+	if err != nil {
+		if result != nil && result.RevocationTxHash != "" {
+			respondJSON(w, http.StatusInternalServerError, PartialCancelResponse{
+				Error:            "authorization revocation submitted but cancellation failed, retry without revocation",
+				RevocationTxHash: result.RevocationTxHash,
+			})
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidSubscriptionTransition) {
+			respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		respondActivationError(w, err)
+		return
+	}
+
+	message := "subscription cancelled"
+	if result.RevocationTxHash != "" {
+		message = "subscription cancelled, authorization revocation submitted"
+	}
+	respondJSON(w, http.StatusOK, CancelSubscriptionResponse{
+		Message:          message,
+		Subscription:     mapSubscriptionToResponse(result.Subscription),
+		RevocationTxHash: result.RevocationTxHash,
+	})
+}
+
+type RotateCredentialResponse struct {
+	Subscription SubscriptionResponse `json:"subscription"`
+	UUID         string               `json:"uuid"`
+}
+
+// RotateCredential replaces the subscription's Xray credential. Clients must
+// fetch their config again afterwards; the old credential stops working as
+// soon as the nodes are updated.
+func (h *SubscriptionHandler) RotateCredential(w http.ResponseWriter, r *http.Request) {
+	subscriptionID := r.PathValue("id")
+	if subscriptionID == "" {
+		respondError(w, http.StatusBadRequest, "subscription_id is required")
+		return
+	}
+	if !requireSubscriptionAccess(w, r, h.walletAuthService, subscriptionID) {
+		return
+	}
+
+	subscription, err := h.subscriptionManagementService.RotateXrayCredential(r.Context(), subscriptionID)
+	if err != nil {
+		respondActivationError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, RotateCredentialResponse{
+		Subscription: mapSubscriptionToResponse(subscription),
+		UUID:         subscription.XrayUUID,
+	})
+}
+
+func (req RevocationRequest) revocationInput() (service.RevocationInput, error) {
+	expected, ok := new(big.Int).SetString(req.ExpectedAllowance, 10)
+	if !ok {
+		return service.RevocationInput{}, errors.New("expected_allowance must be a decimal integer")
+	}
+	target, ok := new(big.Int).SetString(req.TargetAllowance, 10)
+	if !ok {
+		return service.RevocationInput{}, errors.New("target_allowance must be a decimal integer")
+	}
+	sig, err := req.permitSignature()
+	if err != nil {
+		return service.RevocationInput{}, err
+	}
+	return service.RevocationInput{
+		ExpectedAllowance: expected,
+		TargetAllowance:   target,
+		Deadline:          req.Deadline,
+		PermitSignature:   sig,
+	}, nil
 }
 
 func (h *SubscriptionHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
@@ -119,6 +243,9 @@ func (h *SubscriptionHandler) GetSubscription(w http.ResponseWriter, r *http.Req
 		respondError(w, http.StatusBadRequest, "subscription_id is required")
 		return
 	}
+	if !requireSubscriptionAccess(w, r, h.walletAuthService, subscriptionID) {
+		return
+	}
 
 	subscription, err := h.subscriptionManagementService.GetSubscription(r.Context(), subscriptionID)
 	if err != nil {
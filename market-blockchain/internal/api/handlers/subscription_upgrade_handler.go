@@ -2,18 +2,21 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"market-blockchain/internal/service"
 )
 
 type SubscriptionUpgradeHandler struct {
-	upgradeService *service.SubscriptionUpgradeService
+	upgradeService    *service.SubscriptionUpgradeService
+	walletAuthService *service.WalletAuthService
 }
 
-func NewSubscriptionUpgradeHandler(upgradeService *service.SubscriptionUpgradeService) *SubscriptionUpgradeHandler {
+func NewSubscriptionUpgradeHandler(upgradeService *service.SubscriptionUpgradeService, walletAuthService *service.WalletAuthService) *SubscriptionUpgradeHandler {
 	return &SubscriptionUpgradeHandler{
-		upgradeService: upgradeService,
+		upgradeService:    upgradeService,
+		walletAuthService: walletAuthService,
 	}
 }
 
@@ -21,12 +24,23 @@ type UpgradeSubscriptionRequest struct {
 	NewPlanID string `json:"new_plan_id"`
 }
 
+type UpgradeSubscriptionResponse struct {
+	Message           string               `json:"message"`
+	Subscription      SubscriptionResponse `json:"subscription"`
+	NewPlanID         string               `json:"new_plan_id"`
+	Charge            ChargeResponse       `json:"charge"`
+	RequiredAllowance int64                `json:"required_allowance"`
+}
+
 func (h *SubscriptionUpgradeHandler) UpgradeSubscription(w http.ResponseWriter, r *http.Request) {
 	subscriptionID := r.PathValue("id")
 	if subscriptionID == "" {
 		respondError(w, http.StatusBadRequest, "subscription_id is required")
 		return
 	}
+	if !requireSubscriptionAccess(w, r, h.walletAuthService, subscriptionID) {
+		return
+	}
 
 	var req UpgradeSubscriptionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -44,13 +58,30 @@ func (h *SubscriptionUpgradeHandler) UpgradeSubscription(w http.ResponseWriter,
 		NewPlanID:      req.NewPlanID,
 	}
 
-	if err := h.upgradeService.UpgradeSubscription(r.Context(), input); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+	submission, err := h.upgradeService.UpgradeSubscription(r.Context(), input)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrPlanNotFound):
+			respondError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrPlanNotMoreExpensive):
+			respondError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrUpgradeRequiresReauthorization),
+			errors.Is(err, service.ErrChargeInFlight):
+			respondError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, service.ErrUpgradeUnavailable):
+			respondError(w, http.StatusServiceUnavailable, err.Error())
+		default:
+			respondActivationError(w, err)
+		}
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]string{
-		"message": "subscription upgraded successfully",
+	respondJSON(w, http.StatusAccepted, UpgradeSubscriptionResponse{
+		Message:           "upgrade charge submitted, plan switches once it is confirmed",
+		Subscription:      mapSubscriptionToResponse(submission.Subscription),
+		NewPlanID:         submission.NewPlan.PlanID,
+		Charge:            mapChargeToResponse(submission.Charge),
+		RequiredAllowance: submission.RequiredAllowance,
 	})
 }
 
@@ -64,6 +95,9 @@ func (h *SubscriptionUpgradeHandler) DowngradeSubscription(w http.ResponseWriter
 		respondError(w, http.StatusBadRequest, "subscription_id is required")
 		return
 	}
+	if !requireSubscriptionAccess(w, r, h.walletAuthService, subscriptionID) {
+		return
+	}
 
 	var req DowngradeSubscriptionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
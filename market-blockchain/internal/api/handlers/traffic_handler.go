@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"market-blockchain/internal/api/middleware"
+	"market-blockchain/internal/service"
+)
+
+type TrafficHandler struct {
+	trafficUsageService *service.TrafficUsageService
+	walletAuthService   *service.WalletAuthService
+}
+
+func NewTrafficHandler(
+	trafficUsageService *service.TrafficUsageService,
+	walletAuthService *service.WalletAuthService,
+) *TrafficHandler {
+	return &TrafficHandler{
+		trafficUsageService: trafficUsageService,
+		walletAuthService:   walletAuthService,
+	}
+}
+
+type TrafficBucketResponse struct {
+	BucketStart int64 `json:"bucket_start"`
+	Uplink      int64 `json:"uplink"`
+	Downlink    int64 `json:"downlink"`
+	Total       int64 `json:"total"`
+}
+
+type IdentityTrafficResponse struct {
+	IdentityAddress string                  `json:"identity_address"`
+	Granularity     string                  `json:"granularity"`
+	From            int64                   `json:"from"`
+	To              int64                   `json:"to"`
+	Uplink          int64                   `json:"uplink"`
+	Downlink        int64                   `json:"downlink"`
+	Total           int64                   `json:"total"`
+	Buckets         []TrafficBucketResponse `json:"buckets"`
+}
+
+// GetIdentityTraffic returns an identity's usage per hour or day. Only the
+// identity itself or a payer of its subscriptions may read it.
+func (h *TrafficHandler) GetIdentityTraffic(w http.ResponseWriter, r *http.Request) {
+	identityAddress := r.PathValue("address")
+	if identityAddress == "" {
+		respondError(w, http.StatusBadRequest, "address is required")
+		return
+	}
+
+	err := h.walletAuthService.AuthorizeIdentity(r.Context(), middleware.WalletAddress(r.Context()), identityAddress)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrIdentityAccessDenied):
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	default:
+		respondError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	query, ok := parseTrafficQuery(w, r)
+	if !ok {
+		return
+	}
+
+	usage, err := h.trafficUsageService.IdentityUsage(r.Context(), identityAddress, query)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	resp := IdentityTrafficResponse{
+		IdentityAddress: identityAddress,
+		Granularity:     string(query.Granularity),
+		From:            query.From,
+		To:              query.To,
+		Buckets:         make([]TrafficBucketResponse, 0, len(usage)),
+	}
+	for _, entry := range usage {
+		resp.Uplink += entry.Uplink
+		resp.Downlink += entry.Downlink
+		resp.Buckets = append(resp.Buckets, TrafficBucketResponse{
+			BucketStart: entry.BucketStart,
+			Uplink:      entry.Uplink,
+			Downlink:    entry.Downlink,
+			Total:       entry.Uplink + entry.Downlink,
+		})
+	}
+	resp.Total = resp.Uplink + resp.Downlink
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// parseTrafficQuery reads granularity, from and to (unix millis) from the
+// query string and writes a 400 response if they are invalid.
+func parseTrafficQuery(w http.ResponseWriter, r *http.Request) (service.TrafficQuery, bool) {
+	var bounds [2]int64
+	for i, name := range []string{"from", "to"} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, name+" must be a unix timestamp in milliseconds")
+			return service.TrafficQuery{}, false
+		}
+		bounds[i] = parsed
+	}
+
+	query, err := service.NewTrafficQuery(r.URL.Query().Get("granularity"), bounds[0], bounds[1], time.Now())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return service.TrafficQuery{}, false
+	}
+	return query, true
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"market-blockchain/internal/domain"
+)
+
+const (
+	// AdminAPIKeyHeader carries an admin API key.
+	AdminAPIKeyHeader = "X-Admin-API-Key"
+	// AdminAPIKeyCookie and AdminSessionCookie carry the same credentials for
+	// the browser UI, which cannot attach headers to page loads.
+	AdminAPIKeyCookie  = "admin_api_key"
+	AdminSessionCookie = "admin_session"
+)
+
+type AdminAuthenticator interface {
+	AuthenticateAdmin(ctx context.Context, apiKey, sessionToken string) (*domain.AdminPrincipal, error)
+}
+
+type adminPrincipalKey struct{}
+
+// RequireAdmin rejects requests that carry no valid admin credential with 401
+// and callers lacking role with 403.
+func RequireAdmin(auth AdminAuthenticator, role domain.AdminRole) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authenticateAdmin(auth, r)
+			if err != nil {
+				writeAdminError(w, http.StatusUnauthorized, "admin authentication required")
+				return
+			}
+			if !principal.HasRole(role) {
+				writeAdminError(w, http.StatusForbidden, "requires "+string(role)+" role")
+				return
+			}
+			next(w, r.WithContext(context.WithValue(r.Context(), adminPrincipalKey{}, principal)))
+		}
+	}
+}
+
+// RequireAdminPage guards the static admin UI, sending unauthenticated
+// browsers to loginPath instead of answering with JSON.
+func RequireAdminPage(auth AdminAuthenticator, loginPath string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authenticateAdmin(auth, r)
+		if err != nil || !principal.HasRole(domain.AdminRoleViewer) {
+			http.Redirect(w, r, loginPath, http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminPrincipal returns the principal RequireAdmin authenticated, or nil.
+func AdminPrincipal(ctx context.Context) *domain.AdminPrincipal {
+	principal, _ := ctx.Value(adminPrincipalKey{}).(*domain.AdminPrincipal)
+	return principal
+}
+
+// AdminCredentials extracts the API key and wallet session token from headers,
+// falling back to the UI cookies.
+func AdminCredentials(r *http.Request) (apiKey, sessionToken string) {
+	apiKey = r.Header.Get(AdminAPIKeyHeader)
+	if apiKey == "" {
+		if cookie, err := r.Cookie(AdminAPIKeyCookie); err == nil {
+			apiKey = cookie.Value
+		}
+	}
+	sessionToken = BearerToken(r)
+	if sessionToken == "" {
+		if cookie, err := r.Cookie(AdminSessionCookie); err == nil {
+			sessionToken = cookie.Value
+		}
+	}
+	return apiKey, sessionToken
+}
+
+func authenticateAdmin(auth AdminAuthenticator, r *http.Request) (*domain.AdminPrincipal, error) {
+	apiKey, sessionToken := AdminCredentials(r)
+	return auth.AuthenticateAdmin(r.Context(), apiKey, sessionToken)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type WalletAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (string, error)
+}
+
+type walletAddressKey struct{}
+
+// RequireWallet rejects requests without a valid "Authorization: Bearer"
+// session token and makes the session's wallet address available through
+// WalletAddress.
+func RequireWallet(auth WalletAuthenticator) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			token := BearerToken(r)
+			address, err := auth.Authenticate(r.Context(), token)
+			if err != nil || address == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="wallet"`)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "wallet sign-in required"})
+				return
+			}
+			next(w, r.WithContext(context.WithValue(r.Context(), walletAddressKey{}, address)))
+		}
+	}
+}
+
+// WalletAddress returns the address RequireWallet authenticated, or "".
+func WalletAddress(ctx context.Context) string {
+	address, _ := ctx.Value(walletAddressKey{}).(string)
+	return address
+}
+
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -13,32 +13,70 @@ func NewRouter(
 	planHandler *handlers.PlanHandler,
 	subscriptionHandler *handlers.SubscriptionHandler,
 	upgradeHandler *handlers.SubscriptionUpgradeHandler,
+	activationHandler *handlers.SubscriptionActivationHandler,
+	authHandler *handlers.AuthHandler,
+	trafficHandler *handlers.TrafficHandler,
+	clientConfigHandler *handlers.ClientConfigHandler,
+	accountHistoryHandler *handlers.AccountHistoryHandler,
+	walletAuth middleware.WalletAuthenticator,
 	adminDashboardHandler *admin.DashboardHandler,
 	adminPlanHandler *admin.AdminPlanHandler,
+	adminReconciliationHandler *admin.ReconciliationHandler,
+	adminSubscriptionHandler *admin.AdminSubscriptionHandler,
+	adminSessionHandler *admin.AdminSessionHandler,
+	adminXrayNodeHandler *admin.XrayNodeHandler,
+	adminTrafficHandler *admin.TrafficHandler,
+	adminWebhookHandler *admin.WebhookHandler,
+	adminAuth middleware.AdminAuthenticator,
 ) http.Handler {
 	mux := http.NewServeMux()
+	requireWallet := middleware.RequireWallet(walletAuth)
 
 	// Public API endpoints
 	mux.HandleFunc("GET /health", healthHandler.Health)
 	mux.HandleFunc("GET /api/v1/plans", planHandler.ListPlans)
+	mux.HandleFunc("POST /api/v1/auth/nonce", authHandler.IssueNonce)
+	mux.HandleFunc("POST /api/v1/auth/sign-in", authHandler.SignIn)
+	mux.HandleFunc("POST /api/v1/auth/sign-out", requireWallet(authHandler.SignOut))
 	mux.HandleFunc("POST /api/v1/subscriptions", subscriptionHandler.CreateSubscription)
-	mux.HandleFunc("GET /api/v1/subscriptions/{id}", subscriptionHandler.GetSubscription)
-	mux.HandleFunc("DELETE /api/v1/subscriptions/{id}", subscriptionHandler.CancelSubscription)
-	mux.HandleFunc("POST /api/v1/subscriptions/{id}/upgrade", upgradeHandler.UpgradeSubscription)
-	mux.HandleFunc("POST /api/v1/subscriptions/{id}/downgrade", upgradeHandler.DowngradeSubscription)
+	mux.HandleFunc("GET /api/v1/subscriptions/{id}", requireWallet(subscriptionHandler.GetSubscription))
+	mux.HandleFunc("DELETE /api/v1/subscriptions/{id}", requireWallet(subscriptionHandler.CancelSubscription))
+	mux.HandleFunc("POST /api/v1/subscriptions/{id}/rotate-credential", requireWallet(subscriptionHandler.RotateCredential))
+	mux.HandleFunc("GET /api/v1/subscriptions/{id}/permit", activationHandler.GetPermitPayload)
+	mux.HandleFunc("POST /api/v1/subscriptions/{id}/activate", activationHandler.ActivateSubscription)
+	mux.HandleFunc("GET /api/v1/subscriptions/{id}/revocation-permit", activationHandler.GetRevocationPayload)
+	mux.HandleFunc("POST /api/v1/subscriptions/{id}/upgrade", requireWallet(upgradeHandler.UpgradeSubscription))
+	mux.HandleFunc("POST /api/v1/subscriptions/{id}/downgrade", requireWallet(upgradeHandler.DowngradeSubscription))
+	mux.HandleFunc("GET /api/v1/identities/{address}/traffic", requireWallet(trafficHandler.GetIdentityTraffic))
+	mux.HandleFunc("GET /api/v1/identities/{address}/client-config", requireWallet(clientConfigHandler.GetClientConfig))
+	mux.HandleFunc("GET /api/v1/identities/{address}/subscriptions", requireWallet(accountHistoryHandler.GetSubscriptions))
+	mux.HandleFunc("GET /api/v1/identities/{address}/charges", requireWallet(accountHistoryHandler.GetCharges))
+	mux.HandleFunc("GET /api/v1/identities/{address}/authorizations", requireWallet(accountHistoryHandler.GetAuthorizations))
+	mux.HandleFunc("GET /api/v1/identities/{address}/events", requireWallet(accountHistoryHandler.GetEvents))
 
 	// Admin API endpoints
-	mux.HandleFunc("GET /admin/api/v1/dashboard/metrics", adminDashboardHandler.GetMetrics)
-	mux.HandleFunc("GET /admin/api/v1/dashboard/revenue-trend", adminDashboardHandler.GetRevenueTrend)
-	mux.HandleFunc("GET /admin/api/v1/dashboard/subscription-distribution", adminDashboardHandler.GetSubscriptionDistribution)
-	mux.HandleFunc("GET /admin/api/v1/dashboard/recent-events", adminDashboardHandler.GetRecentEvents)
-	mux.HandleFunc("GET /admin/api/v1/plans", adminPlanHandler.ListPlans)
-	mux.HandleFunc("POST /admin/api/v1/plans", adminPlanHandler.CreatePlan)
-	mux.HandleFunc("PUT /admin/api/v1/plans/{id}", adminPlanHandler.UpdatePlan)
+	mux.HandleFunc("POST /admin/api/v1/session", adminSessionHandler.CreateSession)
+	mux.HandleFunc("DELETE /admin/api/v1/session", adminSessionHandler.DeleteSession)
+	adminRoutes := [][]admin.Route{
+		adminSessionHandler.Routes(),
+		adminDashboardHandler.Routes(),
+		adminPlanHandler.Routes(),
+		adminSubscriptionHandler.Routes(),
+		adminReconciliationHandler.Routes(),
+		adminXrayNodeHandler.Routes(),
+		adminTrafficHandler.Routes(),
+		adminWebhookHandler.Routes(),
+	}
+	for _, routes := range adminRoutes {
+		for _, route := range routes {
+			mux.HandleFunc(route.Pattern, middleware.RequireAdmin(adminAuth, route.Role)(route.Handler))
+		}
+	}
 
 	// Admin UI
 	fs := http.FileServer(http.Dir("web/admin"))
-	mux.Handle("GET /admin/", http.StripPrefix("/admin", fs))
+	mux.Handle("GET /admin/login.html", http.StripPrefix("/admin", fs))
+	mux.Handle("GET /admin/", middleware.RequireAdminPage(adminAuth, "/admin/login.html", http.StripPrefix("/admin", fs)))
 
 	return middleware.Logger(mux)
 }
@@ -5,12 +5,16 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"math/big"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 
 	"market-blockchain/internal/api"
@@ -18,8 +22,10 @@ import (
 	"market-blockchain/internal/api/handlers/admin"
 	"market-blockchain/internal/blockchain"
 	"market-blockchain/internal/config"
+	"market-blockchain/internal/domain"
 	"market-blockchain/internal/scheduler"
 	"market-blockchain/internal/service"
+	"market-blockchain/internal/store/migrations"
 	"market-blockchain/internal/store/postgres"
 	"market-blockchain/internal/xray"
 )
@@ -29,8 +35,14 @@ type App struct {
 	db                  *sql.DB
 	server              *http.Server
 	scheduler           *scheduler.Scheduler
-	xrayClient          *xray.Client
+	xrayFleet           *xray.Fleet
 	trafficStatsService *service.TrafficStatsService
+	xraySyncService     *service.XraySyncService
+	webhookService      *service.WebhookService
+	transactionTracker  *service.TransactionTracker
+	txManager           *blockchain.TxManager
+	vaultEventIndexer   *service.VaultEventIndexer
+	reconciliation      *service.ReconciliationService
 }
 
 func New() (*App, error) {
@@ -48,6 +60,20 @@ func New() (*App, error) {
 		return nil, fmt.Errorf("ping database: %w", err)
 	}
 
+	if cfg.AutoMigrate {
+		migrator, err := migrations.New(db)
+		if err != nil {
+			return nil, fmt.Errorf("load migrations: %w", err)
+		}
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("migrate database: %w", err)
+		}
+		for _, migration := range applied {
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		}
+	}
+
 	store := postgres.New(db)
 
 	planRepo := postgres.NewPlanRepository(store)
@@ -55,33 +81,70 @@ func New() (*App, error) {
 	authorizationRepo := postgres.NewAuthorizationRepository(store)
 	chargeRepo := postgres.NewChargeRepository(store)
 	eventRepo := postgres.NewEventRepository(store)
+	chainTransactionRepo := postgres.NewChainTransactionRepository(store)
+	chainCursorRepo := postgres.NewChainCursorRepository(store)
+	discrepancyRepo := postgres.NewDiscrepancyRepository(store)
+	authNonceRepo := postgres.NewAuthNonceRepository(store)
+	walletSessionRepo := postgres.NewWalletSessionRepository(store)
+	relayerTxRepo := postgres.NewRelayerTransactionRepository(store)
+	webhookEndpointRepo := postgres.NewWebhookEndpointRepository(store)
+	webhookDeliveryRepo := postgres.NewWebhookDeliveryRepository(store)
+	analyticsRepo := postgres.NewAnalyticsRepository(store)
 
 	var contractClient *blockchain.ContractClient
 	if cfg.BlockchainRPCURL != "" && cfg.ContractAddress != "" {
+		// A signer that was asked for but cannot be loaded is a deployment
+		// error, not something to run without.
+		var relayerSigner blockchain.Signer
+		if cfg.RelayerSigner != "" {
+			relayerSigner, err = blockchain.NewSigner(context.Background(), blockchain.SignerConfig{
+				Kind:                   blockchain.SignerKind(cfg.RelayerSigner),
+				PrivateKey:             cfg.PrivateKey,
+				KeystorePath:           cfg.RelayerKeystorePath,
+				KeystorePassphraseFile: cfg.RelayerKeystorePassphraseFile,
+				ExternalURL:            cfg.RelayerExternalSignerURL,
+				Address:                cfg.RelayerAddress,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("initialize relayer signer: %w", err)
+			}
+			log.Printf("Relayer signer: %s (%s)", cfg.RelayerSigner, relayerSigner.Address().Hex())
+		}
+
 		contractClient, err = blockchain.NewContractClient(
 			cfg.BlockchainRPCURL,
 			cfg.ContractAddress,
-			cfg.PrivateKey,
+			relayerSigner,
+			relayerTxRepo,
+			txManagerConfig(cfg),
 		)
 		if err != nil {
 			log.Printf("warning: failed to initialize contract client: %v", err)
 		}
 	}
 
-	// Initialize Xray client if enabled
-	var xrayClient *xray.Client
+	xrayNodeRepo := postgres.NewXrayNodeRepository(store)
+	xrayAssignmentRepo := postgres.NewXrayNodeAssignmentRepository(store)
+	xraySyncRepo := postgres.NewXrayNodeSyncRepository(store)
+	xrayOutboxRepo := postgres.NewXraySyncOutboxRepository(store)
+	xrayTrafficCounterRepo := postgres.NewXrayTrafficCounterRepository(store)
+	trafficSampleRepo := postgres.NewTrafficSampleRepository(store)
+
+	// xrayUsers stays a nil interface when Xray is disabled, so the lifecycle
+	// service skips syncing instead of calling into a nil fleet.
+	var xrayFleet *xray.Fleet
+	var xrayUsers interface {
+		AddUser(ctx context.Context, email, uuid string) error
+		RemoveUser(ctx context.Context, email string) error
+	}
 	var trafficStatsService *service.TrafficStatsService
+	var xraySyncService *service.XraySyncService
 	if cfg.XrayEnabled {
-		xrayClient, err = xray.NewClient(xray.Config{
-			Address:    cfg.XrayAPIAddress,
-			InboundTag: cfg.XrayInboundTag,
-			Timeout:    5 * time.Second,
-		})
+		xrayFleet, err = newXrayFleet(cfg, xrayNodeRepo, xrayAssignmentRepo, xraySyncRepo)
 		if err != nil {
-			log.Printf("warning: failed to initialize Xray client: %v", err)
-		} else {
-			log.Printf("Xray client initialized (API: %s, Inbound: %s)", cfg.XrayAPIAddress, cfg.XrayInboundTag)
+			return nil, fmt.Errorf("initialize Xray fleet: %w", err)
 		}
+		xrayUsers = xrayFleet
 	}
 
 	lifecycleService := service.NewSubscriptionLifecycleService(
@@ -90,17 +153,85 @@ func New() (*App, error) {
 		chargeRepo,
 		eventRepo,
 		store,
-		xrayClient,
+		xrayUsers,
+		xrayOutboxRepo,
+		dunningPolicy(cfg),
 	)
 
-	chainService := service.NewChainService(
-		contractClient,
-		subscriptionRepo,
-		authorizationRepo,
-		chargeRepo,
-		eventRepo,
-		lifecycleService,
-	)
+	// Leave the chain service unset rather than wrapping a nil client, so
+	// renewals fail loudly instead of panicking when the chain is not configured.
+	var chainService *service.ChainService
+	if contractClient != nil {
+		chainService = service.NewChainService(
+			contractClient,
+			subscriptionRepo,
+			authorizationRepo,
+			chargeRepo,
+			eventRepo,
+			planRepo,
+			chainTransactionRepo,
+			lifecycleService,
+		)
+	}
+
+	var txManager *blockchain.TxManager
+	if contractClient != nil {
+		txManager = contractClient.TxManager()
+	}
+
+	var transactionTracker *service.TransactionTracker
+	var vaultEventIndexer *service.VaultEventIndexer
+	var reconciliationService *service.ReconciliationService
+	if chainService != nil {
+		confirmations, err := strconv.ParseUint(cfg.ChainConfirmations, 10, 64)
+		if err != nil {
+			log.Printf("warning: invalid chain confirmations %q, using default 3: %v", cfg.ChainConfirmations, err)
+			confirmations = 3
+		}
+		trackerInterval, err := time.ParseDuration(cfg.TxTrackerInterval)
+		if err != nil {
+			log.Printf("warning: invalid tx tracker interval %q, using default 15s: %v", cfg.TxTrackerInterval, err)
+			trackerInterval = 15 * time.Second
+		}
+		maxPendingAge, err := time.ParseDuration(cfg.TxMaxPendingAge)
+		if err != nil {
+			log.Printf("warning: invalid tx max pending age %q, using default 1h: %v", cfg.TxMaxPendingAge, err)
+			maxPendingAge = time.Hour
+		}
+		transactionTracker = service.NewTransactionTracker(contractClient, chainTransactionRepo, chainService, confirmations, trackerInterval, maxPendingAge)
+
+		startBlock, err := strconv.ParseUint(cfg.VaultIndexerStartBlock, 10, 64)
+		if err != nil {
+			log.Printf("warning: invalid vault indexer start block %q, using 0: %v", cfg.VaultIndexerStartBlock, err)
+			startBlock = 0
+		}
+		batchSize, err := strconv.ParseUint(cfg.VaultIndexerBatchSize, 10, 64)
+		if err != nil {
+			log.Printf("warning: invalid vault indexer batch size %q, using default 2000: %v", cfg.VaultIndexerBatchSize, err)
+			batchSize = 2000
+		}
+		indexerInterval, err := time.ParseDuration(cfg.VaultIndexerInterval)
+		if err != nil {
+			log.Printf("warning: invalid vault indexer interval %q, using default 30s: %v", cfg.VaultIndexerInterval, err)
+			indexerInterval = 30 * time.Second
+		}
+		vaultEventIndexer = service.NewVaultEventIndexer(contractClient, chainCursorRepo, store, startBlock, confirmations, batchSize, indexerInterval)
+
+		reconciliationInterval, err := time.ParseDuration(cfg.ReconciliationInterval)
+		if err != nil {
+			log.Printf("warning: invalid reconciliation interval %q, using default 1h: %v", cfg.ReconciliationInterval, err)
+			reconciliationInterval = time.Hour
+		}
+		reconciliationService = service.NewReconciliationService(
+			contractClient,
+			subscriptionRepo,
+			authorizationRepo,
+			chargeRepo,
+			discrepancyRepo,
+			reconciliationInterval,
+			cfg.ReconciliationAutoCorrect,
+		)
+	}
 
 	subscriptionService := service.NewSubscriptionService(
 		planRepo,
@@ -111,6 +242,7 @@ func New() (*App, error) {
 	subscriptionManagementService := service.NewSubscriptionManagementService(
 		subscriptionRepo,
 		lifecycleService,
+		chainService,
 	)
 
 	subscriptionUpgradeService := service.NewSubscriptionUpgradeService(
@@ -119,6 +251,7 @@ func New() (*App, error) {
 		chargeRepo,
 		planRepo,
 		eventRepo,
+		chainService,
 		lifecycleService,
 	)
 
@@ -140,29 +273,129 @@ func New() (*App, error) {
 
 	renewalScheduler := scheduler.NewScheduler(renewalService, renewalInterval)
 
-	if xrayClient != nil {
+	if xrayFleet != nil {
 		trafficStatsInterval, err := time.ParseDuration(cfg.TrafficStatsInterval)
 		if err != nil {
 			log.Printf("warning: invalid traffic stats interval %q, using default 10s: %v", cfg.TrafficStatsInterval, err)
 			trafficStatsInterval = 10 * time.Second
 		}
-		trafficStatsService = service.NewTrafficStatsService(xrayClient, subscriptionRepo, trafficStatsInterval)
+		hourlyRetention, err := time.ParseDuration(cfg.TrafficHourlyRetention)
+		if err != nil {
+			log.Printf("warning: invalid hourly traffic retention %q, using default 720h: %v", cfg.TrafficHourlyRetention, err)
+			hourlyRetention = 30 * 24 * time.Hour
+		}
+		dailyRetention, err := time.ParseDuration(cfg.TrafficDailyRetention)
+		if err != nil {
+			log.Printf("warning: invalid daily traffic retention %q, using default 9600h: %v", cfg.TrafficDailyRetention, err)
+			dailyRetention = 400 * 24 * time.Hour
+		}
+		trafficStatsService = service.NewTrafficStatsService(
+			xrayFleet,
+			subscriptionRepo,
+			xrayTrafficCounterRepo,
+			trafficSampleRepo,
+			store,
+			planRepo,
+			lifecycleService,
+			trafficStatsInterval,
+			service.TrafficRetention{Hourly: hourlyRetention, Daily: dailyRetention},
+		)
+
+		xraySyncRetryInterval, err := time.ParseDuration(cfg.XraySyncRetryInterval)
+		if err != nil {
+			log.Printf("warning: invalid Xray sync retry interval %q, using default 15s: %v", cfg.XraySyncRetryInterval, err)
+			xraySyncRetryInterval = 15 * time.Second
+		}
+		xrayReconcileInterval, err := time.ParseDuration(cfg.XrayReconcileInterval)
+		if err != nil {
+			log.Printf("warning: invalid Xray reconcile interval %q, using default 10m: %v", cfg.XrayReconcileInterval, err)
+			xrayReconcileInterval = 10 * time.Minute
+		}
+		xraySyncService = service.NewXraySyncService(xrayFleet, xrayOutboxRepo, subscriptionRepo, xraySyncRetryInterval, xrayReconcileInterval)
 	}
 
+	webhookInterval, err := time.ParseDuration(cfg.WebhookDeliveryInterval)
+	if err != nil {
+		log.Printf("warning: invalid webhook delivery interval %q, using default 10s: %v", cfg.WebhookDeliveryInterval, err)
+		webhookInterval = 10 * time.Second
+	}
+	webhookTimeout, err := time.ParseDuration(cfg.WebhookTimeout)
+	if err != nil {
+		log.Printf("warning: invalid webhook timeout %q, using default 10s: %v", cfg.WebhookTimeout, err)
+		webhookTimeout = 10 * time.Second
+	}
+	webhookService := service.NewWebhookService(webhookEndpointRepo, webhookDeliveryRepo, webhookTimeout, webhookInterval)
+
+	siweChainID, err := strconv.ParseInt(cfg.SIWEChainID, 10, 64)
+	if err != nil {
+		log.Printf("warning: invalid SIWE chain id %q, accepting any chain: %v", cfg.SIWEChainID, err)
+		siweChainID = 0
+	}
+	nonceTTL, err := time.ParseDuration(cfg.AuthNonceTTL)
+	if err != nil {
+		log.Printf("warning: invalid auth nonce ttl %q, using default 10m: %v", cfg.AuthNonceTTL, err)
+		nonceTTL = 10 * time.Minute
+	}
+	sessionTTL, err := time.ParseDuration(cfg.AuthSessionTTL)
+	if err != nil {
+		log.Printf("warning: invalid auth session ttl %q, using default 1h: %v", cfg.AuthSessionTTL, err)
+		sessionTTL = time.Hour
+	}
+	walletAuthService := service.NewWalletAuthService(
+		authNonceRepo,
+		walletSessionRepo,
+		subscriptionRepo,
+		service.WalletAuthConfig{
+			Domain:     cfg.SIWEDomain,
+			ChainID:    siweChainID,
+			NonceTTL:   nonceTTL,
+			SessionTTL: sessionTTL,
+		},
+	)
+
+	adminAPIKeys, err := service.ParseAdminAPIKeys(cfg.AdminAPIKeys)
+	if err != nil {
+		return nil, fmt.Errorf("parse ADMIN_API_KEYS: %w", err)
+	}
+	adminWallets, err := service.ParseAdminWallets(cfg.AdminWallets)
+	if err != nil {
+		return nil, fmt.Errorf("parse ADMIN_WALLETS: %w", err)
+	}
+	if len(adminAPIKeys) == 0 && len(adminWallets) == 0 {
+		log.Printf("warning: no admin API keys or wallets configured, admin API is inaccessible")
+	}
+	adminAuthService := service.NewAdminAuthService(walletAuthService, adminAPIKeys, adminWallets)
+
 	subscriptionHandler := handlers.NewSubscriptionHandler(
 		subscriptionService,
 		subscriptionManagementService,
+		walletAuthService,
 	)
 
-	upgradeHandler := handlers.NewSubscriptionUpgradeHandler(subscriptionUpgradeService)
+	upgradeHandler := handlers.NewSubscriptionUpgradeHandler(subscriptionUpgradeService, walletAuthService)
+	authHandler := handlers.NewAuthHandler(walletAuthService)
+	trafficUsageService := service.NewTrafficUsageService(trafficSampleRepo)
+	trafficHandler := handlers.NewTrafficHandler(trafficUsageService, walletAuthService)
+	clientConfigService := service.NewClientConfigService(subscriptionRepo, xrayNodeRepo, xrayAssignmentRepo)
+	clientConfigHandler := handlers.NewClientConfigHandler(clientConfigService, walletAuthService)
+	accountHistoryService := service.NewAccountHistoryService(subscriptionRepo, chargeRepo, authorizationRepo, eventRepo, cfg.ExplorerURL)
+	accountHistoryHandler := handlers.NewAccountHistoryHandler(accountHistoryService, walletAuthService)
+	activationHandler := handlers.NewSubscriptionActivationHandler(chainService)
 
 	planHandler := handlers.NewPlanHandler(planRepo)
 	healthHandler := handlers.NewHealthHandler(db)
 
-	adminDashboardHandler := admin.NewDashboardHandler(subscriptionRepo, chargeRepo, eventRepo)
+	analyticsService := service.NewAnalyticsService(analyticsRepo, subscriptionRepo, chargeRepo)
+	adminDashboardHandler := admin.NewDashboardHandler(subscriptionRepo, eventRepo, analyticsService)
 	adminPlanHandler := admin.NewAdminPlanHandler(planRepo, subscriptionRepo)
+	adminReconciliationHandler := admin.NewReconciliationHandler(reconciliationService, discrepancyRepo)
+	adminSubscriptionHandler := admin.NewAdminSubscriptionHandler(subscriptionRepo)
+	adminSessionHandler := admin.NewAdminSessionHandler(adminAuthService)
+	adminXrayNodeHandler := admin.NewXrayNodeHandler(xrayNodeRepo, xrayAssignmentRepo, xraySyncRepo, xrayFleet)
+	adminTrafficHandler := admin.NewTrafficHandler(trafficUsageService)
+	adminWebhookHandler := admin.NewWebhookHandler(webhookService, webhookEndpointRepo, webhookDeliveryRepo)
 
-	router := api.NewRouter(healthHandler, planHandler, subscriptionHandler, upgradeHandler, adminDashboardHandler, adminPlanHandler)
+	router := api.NewRouter(healthHandler, planHandler, subscriptionHandler, upgradeHandler, activationHandler, authHandler, trafficHandler, clientConfigHandler, accountHistoryHandler, walletAuthService, adminDashboardHandler, adminPlanHandler, adminReconciliationHandler, adminSubscriptionHandler, adminSessionHandler, adminXrayNodeHandler, adminTrafficHandler, adminWebhookHandler, adminAuthService)
 
 	server := &http.Server{
 		Addr:    ":" + cfg.ServerPort,
@@ -174,11 +407,128 @@ func New() (*App, error) {
 		db:                  db,
 		server:              server,
 		scheduler:           renewalScheduler,
-		xrayClient:          xrayClient,
+		xrayFleet:           xrayFleet,
 		trafficStatsService: trafficStatsService,
+		xraySyncService:     xraySyncService,
+		webhookService:      webhookService,
+		transactionTracker:  transactionTracker,
+		txManager:           txManager,
+		vaultEventIndexer:   vaultEventIndexer,
+		reconciliation:      reconciliationService,
 	}, nil
 }
 
+func dunningPolicy(cfg *config.Config) service.DunningPolicy {
+	gracePeriod, err := time.ParseDuration(cfg.RenewalGracePeriod)
+	if err != nil || gracePeriod < 0 {
+		log.Printf("warning: invalid renewal grace period %q, using default 72h", cfg.RenewalGracePeriod)
+		gracePeriod = 72 * time.Hour
+	}
+
+	var schedule []time.Duration
+	for _, value := range strings.Split(cfg.RenewalRetrySchedule, ",") {
+		delay, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || delay <= 0 {
+			log.Printf("warning: invalid renewal retry schedule %q, using default 1h,6h,24h", cfg.RenewalRetrySchedule)
+			schedule = []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour}
+			break
+		}
+		schedule = append(schedule, delay)
+	}
+
+	return service.DunningPolicy{GracePeriod: gracePeriod, RetrySchedule: schedule}
+}
+
+func txManagerConfig(cfg *config.Config) blockchain.TxManagerConfig {
+	pollInterval, err := time.ParseDuration(cfg.RelayerPollInterval)
+	if err != nil {
+		log.Printf("warning: invalid relayer poll interval %q, using default 15s: %v", cfg.RelayerPollInterval, err)
+		pollInterval = 15 * time.Second
+	}
+	stuckTimeout, err := time.ParseDuration(cfg.RelayerStuckTimeout)
+	if err != nil {
+		log.Printf("warning: invalid relayer stuck timeout %q, using default 3m: %v", cfg.RelayerStuckTimeout, err)
+		stuckTimeout = 3 * time.Minute
+	}
+	feeBumpPercent, err := strconv.ParseInt(cfg.RelayerFeeBumpPercent, 10, 64)
+	if err != nil || feeBumpPercent < 10 {
+		log.Printf("warning: invalid relayer fee bump percent %q, using default 15", cfg.RelayerFeeBumpPercent)
+		feeBumpPercent = 15
+	}
+
+	var maxFeePerGas *big.Int
+	if cfg.RelayerMaxFeeGwei != "" {
+		gwei, err := strconv.ParseInt(cfg.RelayerMaxFeeGwei, 10, 64)
+		if err != nil || gwei <= 0 {
+			log.Printf("warning: invalid relayer max fee %q gwei, fees are uncapped", cfg.RelayerMaxFeeGwei)
+		} else {
+			maxFeePerGas = new(big.Int).Mul(big.NewInt(gwei), big.NewInt(1_000_000_000))
+		}
+	}
+
+	return blockchain.TxManagerConfig{
+		PollInterval:   pollInterval,
+		StuckTimeout:   stuckTimeout,
+		FeeBumpPercent: feeBumpPercent,
+		MaxFeePerGas:   maxFeePerGas,
+	}
+}
+
+// newXrayFleet connects to the registered Xray nodes. An empty registry is
+// seeded with the node from XRAY_API_ADDRESS, so single-node setups keep
+// working without touching the admin API. Unreachable nodes do not fail
+// startup; they are retried on every health check.
+func newXrayFleet(
+	cfg *config.Config,
+	nodeRepo *postgres.XrayNodeRepository,
+	assignmentRepo *postgres.XrayNodeAssignmentRepository,
+	syncRepo *postgres.XrayNodeSyncRepository,
+) (*xray.Fleet, error) {
+	healthInterval, err := time.ParseDuration(cfg.XrayHealthInterval)
+	if err != nil {
+		log.Printf("warning: invalid Xray health interval %q, using default 30s: %v", cfg.XrayHealthInterval, err)
+		healthInterval = 30 * time.Second
+	}
+	nodeTimeout, err := time.ParseDuration(cfg.XrayNodeTimeout)
+	if err != nil {
+		log.Printf("warning: invalid Xray node timeout %q, using default 5s: %v", cfg.XrayNodeTimeout, err)
+		nodeTimeout = 5 * time.Second
+	}
+
+	ctx := context.Background()
+	nodes, err := nodeRepo.ListAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list xray nodes: %w", err)
+	}
+	if len(nodes) == 0 && cfg.XrayAPIAddress != "" {
+		now := time.Now().UnixMilli()
+		node := &domain.XrayNode{
+			ID:         uuid.New().String(),
+			Name:       "default",
+			APIAddress: cfg.XrayAPIAddress,
+			InboundTag: cfg.XrayInboundTag,
+			Enabled:    true,
+			Endpoint:   domain.DefaultXrayNodeEndpoint(),
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if err := nodeRepo.Create(node); err != nil {
+			return nil, fmt.Errorf("seed default xray node: %w", err)
+		}
+		log.Printf("Registered default Xray node (API: %s, Inbound: %s)", node.APIAddress, node.InboundTag)
+	}
+
+	fleet := xray.NewFleet(nodeRepo, assignmentRepo, syncRepo, xray.FleetConfig{
+		Timeout:        nodeTimeout,
+		HealthInterval: healthInterval,
+	})
+	if err := fleet.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	fleet.CheckHealth(ctx)
+	return fleet, nil
+}
+
 func (a *App) Run() error {
 	log.Printf("Starting market-blockchain server on port %s", a.config.ServerPort)
 
@@ -187,11 +537,37 @@ func (a *App) Run() error {
 
 	go a.scheduler.Start(ctx)
 
+	if a.txManager != nil {
+		go a.txManager.Start(ctx)
+	}
+
+	if a.transactionTracker != nil {
+		go a.transactionTracker.Start(ctx)
+	}
+
+	if a.vaultEventIndexer != nil {
+		go a.vaultEventIndexer.Start(ctx)
+	}
+
+	if a.reconciliation != nil {
+		go a.reconciliation.Start(ctx)
+	}
+
+	if a.xrayFleet != nil {
+		go a.xrayFleet.Start(ctx)
+	}
+
 	// Start traffic stats service if Xray is enabled
 	if a.trafficStatsService != nil {
 		go a.trafficStatsService.Start(ctx)
 	}
 
+	if a.xraySyncService != nil {
+		go a.xraySyncService.Start(ctx)
+	}
+
+	go a.webhookService.Start(ctx)
+
 	errChan := make(chan error, 1)
 	go func() {
 		if err := a.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -223,9 +599,9 @@ func (a *App) Shutdown() error {
 		log.Printf("Server shutdown error: %v", err)
 	}
 
-	if a.xrayClient != nil {
-		if err := a.xrayClient.Close(); err != nil {
-			log.Printf("Xray client close error: %v", err)
+	if a.xrayFleet != nil {
+		if err := a.xrayFleet.Close(); err != nil {
+			log.Printf("Xray fleet close error: %v", err)
 		}
 	}
 
@@ -0,0 +1,117 @@
+// Package chaintest deploys the phase4 contracts on a simulated chain for
+// tests of the blockchain client and the services built on it.
+//
+// The compiled contracts are committed under testdata so the tests do not
+// need Foundry; scripts/export-contract-artifacts.sh rebuilds them after the
+// contracts change. CONTRACT_ARTIFACTS_DIR points the tests at another
+// Foundry out/ directory instead.
+package chaintest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+type foundryArtifact struct {
+	ABI      json.RawMessage `json:"abi"`
+	Bytecode struct {
+		Object string `json:"object"`
+	} `json:"bytecode"`
+}
+
+// ArtifactsDir is the directory the contract artifacts are read from, laid
+// out like Foundry's out/: <source>/<contract>.json.
+func ArtifactsDir() string {
+	if dir := os.Getenv("CONTRACT_ARTIFACTS_DIR"); dir != "" {
+		return dir
+	}
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata")
+}
+
+// LoadArtifact reads the ABI and creation bytecode of contract, compiled
+// from source. The test is skipped when the artifact has not been exported.
+func LoadArtifact(t testing.TB, source, contract string) (abi.ABI, []byte) {
+	t.Helper()
+	path := filepath.Join(ArtifactsDir(), source, contract+".json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Skipf("contract artifact %s missing; run scripts/export-contract-artifacts.sh", path)
+	}
+	if err != nil {
+		t.Fatalf("read artifact: %v", err)
+	}
+
+	var artifact foundryArtifact
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		t.Fatalf("decode artifact %s: %v", path, err)
+	}
+	parsed, err := abi.JSON(bytes.NewReader(artifact.ABI))
+	if err != nil {
+		t.Fatalf("parse artifact abi %s: %v", path, err)
+	}
+	bytecode, err := hexutil.Decode(artifact.Bytecode.Object)
+	if err != nil || len(bytecode) == 0 {
+		t.Fatalf("artifact %s has no bytecode: %v", path, err)
+	}
+	return parsed, bytecode
+}
+
+// Vault is a VPNCreditVaultV4 deployed against a MockUSDC.
+type Vault struct {
+	Address      common.Address
+	Token        *bind.BoundContract
+	TokenAddress common.Address
+}
+
+// DeployVault deploys MockUSDC and a vault paying serviceWallet and charged
+// by relayer, committing a block after each deployment.
+func DeployVault(t testing.TB, backend *simulated.Backend, deployer *bind.TransactOpts, serviceWallet, relayer common.Address) *Vault {
+	t.Helper()
+	tokenABI, tokenBin := LoadArtifact(t, "MockUSDC.sol", "MockUSDC")
+	vaultABI, vaultBin := LoadArtifact(t, "VPNCreditVaultV4.sol", "VPNCreditVaultV4")
+
+	tokenAddr, _, token, err := bind.DeployContract(deployer, tokenABI, tokenBin, backend.Client())
+	if err != nil {
+		t.Fatalf("deploy token: %v", err)
+	}
+	backend.Commit()
+	vaultAddr, _, _, err := bind.DeployContract(deployer, vaultABI, vaultBin, backend.Client(), tokenAddr, serviceWallet, relayer)
+	if err != nil {
+		t.Fatalf("deploy vault: %v", err)
+	}
+	backend.Commit()
+
+	return &Vault{Address: vaultAddr, Token: token, TokenAddress: tokenAddr}
+}
+
+// Mint credits to with amount USDC base units.
+func (v *Vault) Mint(t testing.TB, backend *simulated.Backend, opts *bind.TransactOpts, to common.Address, amount int64) {
+	t.Helper()
+	if _, err := v.Token.Transact(opts, "mint", to, big.NewInt(amount)); err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	backend.Commit()
+}
+
+// TokenBalance returns the USDC balance of owner.
+func (v *Vault) TokenBalance(t testing.TB, owner common.Address) *big.Int {
+	t.Helper()
+	var out []interface{}
+	if err := v.Token.Call(&bind.CallOpts{}, &out, "balanceOf", owner); err != nil {
+		t.Fatalf("balanceOf: %v", err)
+	}
+	return *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+}
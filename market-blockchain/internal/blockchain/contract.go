@@ -2,57 +2,119 @@ package blockchain
 
 import (
 	"context"
-	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"math/big"
+	"sort"
+	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
 )
 
+// ChainBackend is what the contract client needs from a node. Both
+// *ethclient.Client and the simulated backend's client satisfy it.
+type ChainBackend interface {
+	bind.ContractBackend
+	ChainID(ctx context.Context) (*big.Int, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
 type ContractClient struct {
-	client       *ethclient.Client
+	client       ChainBackend
+	rpc          *ethclient.Client
 	contractAddr common.Address
-	privateKey   *ecdsa.PrivateKey
 	vault        *VPNCreditVault
+	txManager    *TxManager
 }
 
-func NewContractClient(rpcURL, contractAddress, privateKeyHex string) (*ContractClient, error) {
+// NewContractClient only creates a transaction manager when a signer is
+// given; without one the client is read-only.
+func NewContractClient(
+	rpcURL, contractAddress string,
+	signer Signer,
+	relayerTxs repository.RelayerTransactionRepository,
+	txConfig TxManagerConfig,
+) (*ContractClient, error) {
 	client, err := ethclient.Dial(rpcURL)
 	if err != nil {
 		return nil, fmt.Errorf("dial rpc: %w", err)
 	}
 
+	contractClient, err := NewContractClientWithBackend(client, contractAddress, signer, relayerTxs, txConfig)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	contractClient.rpc = client
+	return contractClient, nil
+}
+
+// NewContractClientWithBackend binds the vault on an existing backend, such as
+// a simulated chain in tests. Close does not close the backend.
+func NewContractClientWithBackend(
+	backend ChainBackend,
+	contractAddress string,
+	signer Signer,
+	relayerTxs repository.RelayerTransactionRepository,
+	txConfig TxManagerConfig,
+) (*ContractClient, error) {
 	contractAddr := common.HexToAddress(contractAddress)
-	vault, err := NewVPNCreditVault(contractAddr, client)
+	vault, err := NewVPNCreditVault(contractAddr, backend)
 	if err != nil {
 		return nil, fmt.Errorf("bind contract: %w", err)
 	}
 
-	var privateKey *ecdsa.PrivateKey
-	if privateKeyHex != "" {
-		privateKey, err = crypto.HexToECDSA(privateKeyHex)
-		if err != nil {
-			return nil, fmt.Errorf("parse private key: %w", err)
-		}
+	var txManager *TxManager
+	if signer != nil {
+		txManager = NewTxManager(backend, signer, relayerTxs, txConfig)
 	}
 
 	return &ContractClient{
-		client:       client,
+		client:       backend,
 		contractAddr: contractAddr,
-		privateKey:   privateKey,
 		vault:        vault,
+		txManager:    txManager,
 	}, nil
 }
 
+// TxManager is nil when no relayer key is configured.
+func (c *ContractClient) TxManager() *TxManager {
+	return c.txManager
+}
+
 type PermitSignature struct {
 	V uint8
 	R [32]byte
 	S [32]byte
 }
 
+// SplitPermitSignature splits a 65-byte r||s||v signature as produced by
+// eth_signTypedData. Wallets that return a recovery id of 0/1 are normalized
+// to the 27/28 form the token's permit expects.
+func SplitPermitSignature(sig []byte) (PermitSignature, error) {
+	if len(sig) != crypto.SignatureLength {
+		return PermitSignature{}, fmt.Errorf("signature must be %d bytes, got %d", crypto.SignatureLength, len(sig))
+	}
+	var out PermitSignature
+	copy(out.R[:], sig[:32])
+	copy(out.S[:], sig[32:64])
+	out.V = sig[64]
+	if out.V < 27 {
+		out.V += 27
+	}
+	return out, nil
+}
+
 func (c *ContractClient) AuthorizeChargeWithPermit(
 	ctx context.Context,
 	identity common.Address,
@@ -62,64 +124,84 @@ func (c *ContractClient) AuthorizeChargeWithPermit(
 	deadline *big.Int,
 	sig PermitSignature,
 ) (string, error) {
-	if c.privateKey == nil {
-		return "", fmt.Errorf("private key not configured")
-	}
-
-	chainID, err := c.client.ChainID(ctx)
-	if err != nil {
-		return "", fmt.Errorf("get chain id: %w", err)
+	if c.txManager == nil {
+		return "", fmt.Errorf("relayer signer not configured")
 	}
 
-	auth, err := bind.NewKeyedTransactorWithChainID(c.privateKey, chainID)
-	if err != nil {
-		return "", fmt.Errorf("create transactor: %w", err)
-	}
-
-	tx, err := c.vault.AuthorizeChargeWithPermit(
-		auth,
-		payer,
-		identity,
-		expectedAllowance,
-		targetAllowance,
-		deadline,
-		sig.V,
-		sig.R,
-		sig.S,
-	)
+	txHash, err := c.txManager.Send(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.vault.AuthorizeChargeWithPermit(
+			opts,
+			payer,
+			identity,
+			expectedAllowance,
+			targetAllowance,
+			deadline,
+			sig.V,
+			sig.R,
+			sig.S,
+		)
+	})
 	if err != nil {
 		return "", fmt.Errorf("authorize charge with permit: %w", err)
 	}
 
-	return tx.Hash().Hex(), nil
+	return txHash, nil
 }
 
-func (c *ContractClient) Charge(
+// CancelAuthorization submits the payer's permit lowering the vault's token
+// allowance to targetAllowance and clears the vault's authorized allowance for
+// identity.
+func (c *ContractClient) CancelAuthorization(
 	ctx context.Context,
-	chargeID [32]byte,
 	identity common.Address,
-	amount *big.Int,
+	payer common.Address,
+	expectedAllowance *big.Int,
+	targetAllowance *big.Int,
+	deadline *big.Int,
+	sig PermitSignature,
 ) (string, error) {
-	if c.privateKey == nil {
-		return "", fmt.Errorf("private key not configured")
+	if c.txManager == nil {
+		return "", fmt.Errorf("relayer signer not configured")
 	}
 
-	chainID, err := c.client.ChainID(ctx)
+	txHash, err := c.txManager.Send(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.vault.CancelAuthorization(
+			opts,
+			payer,
+			identity,
+			expectedAllowance,
+			targetAllowance,
+			deadline,
+			sig.V,
+			sig.R,
+			sig.S,
+		)
+	})
 	if err != nil {
-		return "", fmt.Errorf("get chain id: %w", err)
+		return "", fmt.Errorf("cancel authorization: %w", err)
 	}
 
-	auth, err := bind.NewKeyedTransactorWithChainID(c.privateKey, chainID)
-	if err != nil {
-		return "", fmt.Errorf("create transactor: %w", err)
+	return txHash, nil
+}
+
+func (c *ContractClient) Charge(
+	ctx context.Context,
+	chargeID [32]byte,
+	identity common.Address,
+	amount *big.Int,
+) (string, error) {
+	if c.txManager == nil {
+		return "", fmt.Errorf("relayer signer not configured")
 	}
 
-	tx, err := c.vault.Charge(auth, chargeID, identity, amount)
+	txHash, err := c.txManager.Send(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.vault.Charge(opts, chargeID, identity, amount)
+	})
 	if err != nil {
 		return "", fmt.Errorf("charge: %w", err)
 	}
 
-	return tx.Hash().Hex(), nil
+	return txHash, nil
 }
 
 func (c *ContractClient) GetAuthorizedAllowance(
@@ -145,8 +227,154 @@ func (c *ContractClient) GetIdentityPayer(
 	return payer, nil
 }
 
+func (c *ContractClient) IsChargeExecuted(ctx context.Context, chargeID [32]byte) (bool, error) {
+	executed, err := c.vault.ExecutedCharges(&bind.CallOpts{Context: ctx}, chargeID)
+	if err != nil {
+		return false, fmt.Errorf("get executed charge: %w", err)
+	}
+	return executed, nil
+}
+
+// TransactionReceipt returns nil without error while the transaction has no
+// receipt on the canonical chain, either because it is still in the mempool or
+// because its block was reorged out. Relayer transactions resolve to the
+// receipt of whichever fee-bumped replacement was mined.
+func (c *ContractClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	if c.txManager != nil {
+		return c.txManager.Receipt(ctx, txHash)
+	}
+	receipt, err := c.client.TransactionReceipt(ctx, txHash)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get transaction receipt: %w", err)
+	}
+	return receipt, nil
+}
+
+// Broadcasting reports whether the relayer is still fee-bumping txHash's
+// nonce. Without a relayer signer nothing is rebroadcast and it is false.
+func (c *ContractClient) Broadcasting(ctx context.Context, txHash common.Hash) (bool, error) {
+	if c.txManager == nil {
+		return false, nil
+	}
+	return c.txManager.Broadcasting(ctx, txHash)
+}
+
+func (c *ContractClient) BlockNumber(ctx context.Context) (uint64, error) {
+	number, err := c.client.BlockNumber(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("get block number: %w", err)
+	}
+	return number, nil
+}
+
+// FetchVaultEvents returns the IdentityBound, ChargeAuthorized and
+// IdentityCharged logs emitted in the inclusive block range [from, to],
+// ordered by block number and log index.
+func (c *ContractClient) FetchVaultEvents(ctx context.Context, from, to uint64) ([]*domain.VaultEvent, error) {
+	opts := &bind.FilterOpts{Start: from, End: &to, Context: ctx}
+	now := time.Now().UnixMilli()
+	var events []*domain.VaultEvent
+
+	bound, err := c.vault.FilterIdentityBound(opts, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("filter identity bound: %w", err)
+	}
+	for bound.Next() {
+		events = append(events, newVaultEvent(bound.Event.Raw, domain.VaultEventIdentityBound, bound.Event.Payer, bound.Event.Identity, now))
+	}
+	if err := closeIterator(bound.Error(), bound.Close()); err != nil {
+		return nil, fmt.Errorf("iterate identity bound: %w", err)
+	}
+
+	authorized, err := c.vault.FilterChargeAuthorized(opts, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("filter charge authorized: %w", err)
+	}
+	for authorized.Next() {
+		event := newVaultEvent(authorized.Event.Raw, domain.VaultEventChargeAuthorized, authorized.Event.Payer, authorized.Event.Identity, now)
+		event.ExpectedAllowance = authorized.Event.ExpectedAllowance.String()
+		event.TargetAllowance = authorized.Event.TargetAllowance.String()
+		events = append(events, event)
+	}
+	if err := closeIterator(authorized.Error(), authorized.Close()); err != nil {
+		return nil, fmt.Errorf("iterate charge authorized: %w", err)
+	}
+
+	charged, err := c.vault.FilterIdentityCharged(opts, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("filter identity charged: %w", err)
+	}
+	for charged.Next() {
+		event := newVaultEvent(charged.Event.Raw, domain.VaultEventIdentityCharged, charged.Event.Payer, charged.Event.Identity, now)
+		event.ChargeID = common.Hash(charged.Event.ChargeId).Hex()
+		event.Amount = charged.Event.Amount.String()
+		events = append(events, event)
+	}
+	if err := closeIterator(charged.Error(), charged.Close()); err != nil {
+		return nil, fmt.Errorf("iterate identity charged: %w", err)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber < events[j].BlockNumber
+		}
+		return events[i].LogIndex < events[j].LogIndex
+	})
+
+	return events, nil
+}
+
+func newVaultEvent(raw types.Log, name domain.VaultEventName, payer, identity common.Address, now int64) *domain.VaultEvent {
+	return &domain.VaultEvent{
+		TxHash:            raw.TxHash.Hex(),
+		LogIndex:          int64(raw.Index),
+		BlockNumber:       int64(raw.BlockNumber),
+		BlockHash:         raw.BlockHash.Hex(),
+		Name:              name,
+		PayerAddress:      payer.Hex(),
+		IdentityAddress:   identity.Hex(),
+		Amount:            "0",
+		ExpectedAllowance: "0",
+		TargetAllowance:   "0",
+		CreatedAt:         now,
+	}
+}
+
+func closeIterator(iterErr, closeErr error) error {
+	if iterErr != nil {
+		return iterErr
+	}
+	return closeErr
+}
+
 func (c *ContractClient) Close() {
-	if c.client != nil {
-		c.client.Close()
+	if c.rpc != nil {
+		c.rpc.Close()
+	}
+}
+
+// ChargeKey returns the bytes32 key the vault deduplicates the charge by,
+// in the encoding the charge was first submitted with.
+func ChargeKey(charge *domain.Charge) [32]byte {
+	if charge.IDEncoding() == domain.ChargeIDRaw {
+		return LegacyChargeIDBytes(charge.ChargeID)
 	}
+	return ChargeIDBytes(charge.ChargeID)
+}
+
+// ChargeIDBytes maps a service-side charge ID onto the bytes32 key the vault
+// uses for on-chain charge deduplication.
+func ChargeIDBytes(chargeID string) [32]byte {
+	return crypto.Keccak256Hash([]byte(chargeID))
+}
+
+// LegacyChargeIDBytes is the key charges were submitted under before
+// ChargeIDBytes: the ID's bytes, truncated or zero-padded to 32.
+func LegacyChargeIDBytes(chargeID string) [32]byte {
+	var key [32]byte
+	copy(key[:], []byte(chargeID))
+	return key
 }
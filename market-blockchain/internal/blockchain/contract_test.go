@@ -0,0 +1,37 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"market-blockchain/internal/domain"
+)
+
+func TestChargeKeyKeepsEachChargesEncoding(t *testing.T) {
+	// Pinned: changing either encoding would orphan charges already executed
+	// on chain under it.
+	keccak := common.HexToHash("0xcd59980f57eaa35b006f1955250e98feea92e51c01cac7e28626256b0f34319a")
+	raw := common.HexToHash("0x72656e65775f7375625f315f3230303000000000000000000000000000000000")
+
+	for name, test := range map[string]struct {
+		encoding domain.ChargeIDEncoding
+		want     common.Hash
+	}{
+		"new charges default to keccak256": {"", keccak},
+		"keccak256":                        {domain.ChargeIDKeccak256, keccak},
+		"legacy raw bytes":                 {domain.ChargeIDRaw, raw},
+	} {
+		t.Run(name, func(t *testing.T) {
+			charge := &domain.Charge{ChargeID: "renew_sub_1_2000", ChargeIDEncoding: test.encoding}
+			if got := common.Hash(ChargeKey(charge)); got != test.want {
+				t.Fatalf("expected key %s, got %s", test.want.Hex(), got.Hex())
+			}
+		})
+	}
+
+	long := "renew_0b5e8f4e-7c1d-4a8e-9d2f-3f6a1b2c3d4e_1735689600000"
+	if LegacyChargeIDBytes(long) != LegacyChargeIDBytes(long[:32]) {
+		t.Fatal("expected legacy keys to truncate to 32 bytes")
+	}
+}
@@ -0,0 +1,204 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// erc20PermitABI covers the read-only parts of the token needed to build
+// EIP-2612 permits. USDC exposes version() alongside the standard methods.
+const erc20PermitABI = `[
+	{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"version","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"allowance","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"nonces","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"DOMAIN_SEPARATOR","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]}
+]`
+
+var parsedERC20PermitABI = mustParseABI(erc20PermitABI)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(fmt.Sprintf("parse abi: %v", err))
+	}
+	return parsed
+}
+
+// PermitDomain is the EIP-712 domain of the token the vault pulls from.
+// DomainSeparator is the value reported by the token itself.
+type PermitDomain struct {
+	Name              string
+	Version           string
+	ChainID           *big.Int
+	VerifyingContract common.Address
+	DomainSeparator   common.Hash
+}
+
+type PermitMessage struct {
+	Owner    common.Address
+	Spender  common.Address
+	Value    *big.Int
+	Nonce    *big.Int
+	Deadline *big.Int
+}
+
+// PermitDomain reads the token's EIP-712 domain. The separator computed from
+// name, version and chain id is compared with DOMAIN_SEPARATOR() so a token
+// with a non-standard domain fails here instead of producing permits that
+// revert on chain.
+func (c *ContractClient) PermitDomain(ctx context.Context) (PermitDomain, error) {
+	token, err := c.permitToken(ctx)
+	if err != nil {
+		return PermitDomain{}, err
+	}
+	opts := &bind.CallOpts{Context: ctx}
+
+	var out []interface{}
+	if err := token.Call(opts, &out, "name"); err != nil {
+		return PermitDomain{}, fmt.Errorf("get token name: %w", err)
+	}
+	name := *abi.ConvertType(out[0], new(string)).(*string)
+
+	out = nil
+	if err := token.Call(opts, &out, "version"); err != nil {
+		return PermitDomain{}, fmt.Errorf("get token version: %w", err)
+	}
+	version := *abi.ConvertType(out[0], new(string)).(*string)
+
+	out = nil
+	if err := token.Call(opts, &out, "DOMAIN_SEPARATOR"); err != nil {
+		return PermitDomain{}, fmt.Errorf("get token domain separator: %w", err)
+	}
+	separator := common.Hash(*abi.ConvertType(out[0], new([32]byte)).(*[32]byte))
+
+	chainID, err := c.client.ChainID(ctx)
+	if err != nil {
+		return PermitDomain{}, fmt.Errorf("get chain id: %w", err)
+	}
+
+	domain := PermitDomain{
+		Name:              name,
+		Version:           version,
+		ChainID:           chainID,
+		VerifyingContract: token.Address(),
+		DomainSeparator:   separator,
+	}
+
+	typedData := PermitTypedData(domain, PermitMessage{Value: new(big.Int), Nonce: new(big.Int), Deadline: new(big.Int)})
+	computed, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	if err != nil {
+		return PermitDomain{}, fmt.Errorf("hash permit domain: %w", err)
+	}
+	if common.BytesToHash(computed) != separator {
+		return PermitDomain{}, fmt.Errorf("token domain separator %s does not match computed %s", separator.Hex(), common.BytesToHash(computed).Hex())
+	}
+
+	return domain, nil
+}
+
+// PermitNonce returns the owner's current permit nonce on the token.
+func (c *ContractClient) PermitNonce(ctx context.Context, owner common.Address) (*big.Int, error) {
+	token, err := c.permitToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []interface{}
+	if err := token.Call(&bind.CallOpts{Context: ctx}, &out, "nonces", owner); err != nil {
+		return nil, fmt.Errorf("get permit nonce: %w", err)
+	}
+	return *abi.ConvertType(out[0], new(*big.Int)).(**big.Int), nil
+}
+
+// TokenAllowance returns how much of owner's token the vault may currently
+// pull.
+func (c *ContractClient) TokenAllowance(ctx context.Context, owner common.Address) (*big.Int, error) {
+	token, err := c.permitToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []interface{}
+	if err := token.Call(&bind.CallOpts{Context: ctx}, &out, "allowance", owner, c.contractAddr); err != nil {
+		return nil, fmt.Errorf("get token allowance: %w", err)
+	}
+	return *abi.ConvertType(out[0], new(*big.Int)).(**big.Int), nil
+}
+
+// VaultAddress is the spender every permit has to name.
+func (c *ContractClient) VaultAddress() common.Address {
+	return c.contractAddr
+}
+
+func (c *ContractClient) permitToken(ctx context.Context) (*bind.BoundContract, error) {
+	tokenAddr, err := c.vault.Usdc(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, fmt.Errorf("get token address: %w", err)
+	}
+	return bind.NewBoundContract(tokenAddr, parsedERC20PermitABI, c.client, c.client, c.client), nil
+}
+
+// PermitTypedData builds the eth_signTypedData_v4 payload for an EIP-2612
+// permit.
+func PermitTypedData(domain PermitDomain, msg PermitMessage) apitypes.TypedData {
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"Permit": {
+				{Name: "owner", Type: "address"},
+				{Name: "spender", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "nonce", Type: "uint256"},
+				{Name: "deadline", Type: "uint256"},
+			},
+		},
+		PrimaryType: "Permit",
+		Domain: apitypes.TypedDataDomain{
+			Name:              domain.Name,
+			Version:           domain.Version,
+			ChainId:           (*math.HexOrDecimal256)(domain.ChainID),
+			VerifyingContract: domain.VerifyingContract.Hex(),
+		},
+		Message: apitypes.TypedDataMessage{
+			"owner":    msg.Owner.Hex(),
+			"spender":  msg.Spender.Hex(),
+			"value":    msg.Value.String(),
+			"nonce":    msg.Nonce.String(),
+			"deadline": msg.Deadline.String(),
+		},
+	}
+}
+
+// RecoverPermitSigner returns the address that produced sig over typedData.
+func RecoverPermitSigner(typedData apitypes.TypedData, sig PermitSignature) (common.Address, error) {
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("hash permit: %w", err)
+	}
+
+	raw := make([]byte, crypto.SignatureLength)
+	copy(raw[:32], sig.R[:])
+	copy(raw[32:64], sig.S[:])
+	raw[64] = sig.V - 27
+
+	pub, err := crypto.SigToPub(hash, raw)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("recover permit signer: %w", err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
@@ -0,0 +1,191 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Signer signs relayer transactions without the caller knowing where the key
+// is held.
+type Signer interface {
+	Address() common.Address
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+type SignerKind string
+
+const (
+	// SignerKey is a plaintext hex key, meant for development only.
+	SignerKey      SignerKind = "key"
+	SignerKeystore SignerKind = "keystore"
+	// SignerExternal delegates to a clef-compatible signer over JSON-RPC.
+	SignerExternal SignerKind = "external"
+)
+
+type SignerConfig struct {
+	Kind                   SignerKind
+	PrivateKey             string
+	KeystorePath           string
+	KeystorePassphraseFile string
+	ExternalURL            string
+	// Address selects the external signer account.
+	Address string
+}
+
+// NewSigner builds the signer selected by config.Kind.
+func NewSigner(ctx context.Context, config SignerConfig) (Signer, error) {
+	switch config.Kind {
+	case SignerKey:
+		return NewPrivateKeySigner(config.PrivateKey)
+	case SignerKeystore:
+		return NewKeystoreSigner(config.KeystorePath, config.KeystorePassphraseFile)
+	case SignerExternal:
+		if !common.IsHexAddress(config.Address) {
+			return nil, fmt.Errorf("external signer needs a relayer address, got %q", config.Address)
+		}
+		return NewExternalSigner(ctx, config.ExternalURL, common.HexToAddress(config.Address))
+	default:
+		return nil, fmt.Errorf("unknown signer kind %q", config.Kind)
+	}
+}
+
+type PrivateKeySigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+func NewPrivateKeySigner(privateKeyHex string) (*PrivateKeySigner, error) {
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	return &PrivateKeySigner{key: key, address: crypto.PubkeyToAddress(key.PublicKey)}, nil
+}
+
+func (s *PrivateKeySigner) Address() common.Address {
+	return s.address
+}
+
+func (s *PrivateKeySigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
+
+// KeystoreSigner holds a key decrypted from a go-ethereum keystore file. The
+// passphrase is read from a file so it never has to be in the environment.
+type KeystoreSigner struct {
+	*PrivateKeySigner
+}
+
+func NewKeystoreSigner(keystorePath, passphraseFile string) (*KeystoreSigner, error) {
+	keyJSON, err := os.ReadFile(keystorePath)
+	if err != nil {
+		return nil, fmt.Errorf("read keystore: %w", err)
+	}
+	passphrase, err := os.ReadFile(passphraseFile)
+	if err != nil {
+		return nil, fmt.Errorf("read keystore passphrase: %w", err)
+	}
+
+	key, err := keystore.DecryptKey(keyJSON, strings.TrimRight(string(passphrase), "\r\n"))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt keystore: %w", err)
+	}
+	return &KeystoreSigner{&PrivateKeySigner{key: key.PrivateKey, address: key.Address}}, nil
+}
+
+// ExternalSigner asks a clef-compatible signer to sign each transaction with
+// account_signTransaction. The key never enters this process.
+type ExternalSigner struct {
+	client  *rpc.Client
+	address common.Address
+}
+
+func NewExternalSigner(ctx context.Context, endpoint string, address common.Address) (*ExternalSigner, error) {
+	client, err := rpc.DialContext(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("dial external signer: %w", err)
+	}
+
+	var accounts []common.Address
+	if err := client.CallContext(ctx, &accounts, "account_list"); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("list external signer accounts: %w", err)
+	}
+	for _, account := range accounts {
+		if account == address {
+			return &ExternalSigner{client: client, address: address}, nil
+		}
+	}
+	client.Close()
+	return nil, fmt.Errorf("external signer does not manage %s", address.Hex())
+}
+
+func (s *ExternalSigner) Address() common.Address {
+	return s.address
+}
+
+type externalSignResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+func (s *ExternalSigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	data := hexutil.Bytes(tx.Data())
+	args := apitypes.SendTxArgs{
+		From:                 common.NewMixedcaseAddress(s.address),
+		Gas:                  hexutil.Uint64(tx.Gas()),
+		MaxFeePerGas:         (*hexutil.Big)(tx.GasFeeCap()),
+		MaxPriorityFeePerGas: (*hexutil.Big)(tx.GasTipCap()),
+		Value:                hexutil.Big(*tx.Value()),
+		Nonce:                hexutil.Uint64(tx.Nonce()),
+		Input:                &data,
+		ChainID:              (*hexutil.Big)(chainID),
+	}
+	if tx.To() != nil {
+		to := common.NewMixedcaseAddress(*tx.To())
+		args.To = &to
+	}
+
+	var res externalSignResult
+	if err := s.client.CallContext(ctx, &res, "account_signTransaction", args); err != nil {
+		return nil, fmt.Errorf("external signer: %w", err)
+	}
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(res.Raw); err != nil {
+		return nil, fmt.Errorf("decode externally signed transaction: %w", err)
+	}
+
+	// Do not broadcast something other than what was asked for.
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+	if err != nil {
+		return nil, fmt.Errorf("recover external signer: %w", err)
+	}
+	if sender != s.address || signed.Nonce() != tx.Nonce() || signed.Gas() != tx.Gas() ||
+		signed.GasFeeCap().Cmp(tx.GasFeeCap()) != 0 || signed.GasTipCap().Cmp(tx.GasTipCap()) != 0 ||
+		!equalTo(signed.To(), tx.To()) || string(signed.Data()) != string(tx.Data()) {
+		return nil, fmt.Errorf("external signer returned a transaction that differs from the request")
+	}
+	return signed, nil
+}
+
+func (s *ExternalSigner) Close() {
+	s.client.Close()
+}
+
+func equalTo(a, b *common.Address) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
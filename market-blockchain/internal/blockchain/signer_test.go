@@ -0,0 +1,175 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/google/uuid"
+)
+
+func testSignerTx() *types.Transaction {
+	to := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(84532),
+		Nonce:     7,
+		GasTipCap: big.NewInt(1_000_000_000),
+		GasFeeCap: big.NewInt(21_000_000_000),
+		Gas:       100_000,
+		To:        &to,
+		Data:      []byte{0x01, 0x02},
+	})
+}
+
+func TestKeystoreSignerDecryptsKeyWithPassphraseFile(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	keyJSON, err := keystore.EncryptKey(&keystore.Key{Id: uuid.New(), Address: address, PrivateKey: key}, "correct horse", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatalf("encrypt key: %v", err)
+	}
+
+	dir := t.TempDir()
+	keystorePath := filepath.Join(dir, "relayer.json")
+	passphrasePath := filepath.Join(dir, "passphrase")
+	if err := os.WriteFile(keystorePath, keyJSON, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(passphrasePath, []byte("correct horse\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewKeystoreSigner(keystorePath, passphrasePath)
+	if err != nil {
+		t.Fatalf("NewKeystoreSigner returned error: %v", err)
+	}
+	if signer.Address() != address {
+		t.Fatalf("unexpected address %s", signer.Address().Hex())
+	}
+	signed, err := signer.SignTx(context.Background(), testSignerTx(), big.NewInt(84532))
+	if err != nil {
+		t.Fatalf("SignTx returned error: %v", err)
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(big.NewInt(84532)), signed)
+	if err != nil || sender != address {
+		t.Fatalf("expected tx signed by %s, got %s (%v)", address.Hex(), sender.Hex(), err)
+	}
+
+	if err := os.WriteFile(passphrasePath, []byte("wrong"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewKeystoreSigner(keystorePath, passphrasePath); err == nil {
+		t.Fatal("expected a wrong passphrase to be rejected")
+	}
+}
+
+// testClef implements the account_ namespace of a clef-compatible signer.
+type testClef struct {
+	key    *ecdsa.PrivateKey
+	tamper bool
+}
+
+func (c *testClef) List() []common.Address {
+	return []common.Address{crypto.PubkeyToAddress(c.key.PublicKey)}
+}
+
+func (c *testClef) SignTransaction(args apitypes.SendTxArgs) (map[string]interface{}, error) {
+	nonce := uint64(args.Nonce)
+	if c.tamper {
+		nonce++
+	}
+	to := args.To.Address()
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   (*big.Int)(args.ChainID),
+		Nonce:     nonce,
+		GasTipCap: (*big.Int)(args.MaxPriorityFeePerGas),
+		GasFeeCap: (*big.Int)(args.MaxFeePerGas),
+		Gas:       uint64(args.Gas),
+		To:        &to,
+		Value:     (*big.Int)(&args.Value),
+		Data:      *args.Input,
+	})
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID((*big.Int)(args.ChainID)), c.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"raw": hexutil.Bytes(raw), "tx": signed}, nil
+}
+
+func startTestClef(t *testing.T, clef *testClef) string {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", clef); err != nil {
+		t.Fatalf("register clef: %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+	return httpServer.URL
+}
+
+func TestExternalSignerSignsThroughClef(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	url := startTestClef(t, &testClef{key: key})
+
+	signer, err := NewExternalSigner(context.Background(), url, address)
+	if err != nil {
+		t.Fatalf("NewExternalSigner returned error: %v", err)
+	}
+	defer signer.Close()
+
+	tx := testSignerTx()
+	signed, err := signer.SignTx(context.Background(), tx, big.NewInt(84532))
+	if err != nil {
+		t.Fatalf("SignTx returned error: %v", err)
+	}
+	if signed.Nonce() != tx.Nonce() || signed.GasFeeCap().Cmp(tx.GasFeeCap()) != 0 {
+		t.Fatalf("signed transaction differs from request: %+v", signed)
+	}
+
+	if _, err := NewExternalSigner(context.Background(), url, common.HexToAddress("0x0000000000000000000000000000000000000001")); err == nil {
+		t.Fatal("expected an account the signer does not manage to be rejected")
+	}
+}
+
+func TestExternalSignerRejectsAlteredTransaction(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	url := startTestClef(t, &testClef{key: key, tamper: true})
+
+	signer, err := NewExternalSigner(context.Background(), url, crypto.PubkeyToAddress(key.PublicKey))
+	if err != nil {
+		t.Fatalf("NewExternalSigner returned error: %v", err)
+	}
+	defer signer.Close()
+
+	if _, err := signer.SignTx(context.Background(), testSignerTx(), big.NewInt(84532)); err == nil {
+		t.Fatal("expected a transaction with a different nonce to be rejected")
+	}
+}
@@ -0,0 +1,386 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+
+	"market-blockchain/internal/blockchain/chaintest"
+	"market-blockchain/internal/domain"
+)
+
+func mustGenerateKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+var oneEther = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+// simulatedChain is an in-process chain with the relayer and payer funded.
+type simulatedChain struct {
+	backend    *simulated.Backend
+	chainID    *big.Int
+	relayer    *PrivateKeySigner
+	relayerTxs *testRelayerTxRepo
+	deployer   *bind.TransactOpts
+	payerKey   *ecdsa.PrivateKey
+	payer      common.Address
+}
+
+func newSimulatedChain(t *testing.T) *simulatedChain {
+	t.Helper()
+	deployerKey := mustGenerateKey(t)
+	relayerKey := mustGenerateKey(t)
+	payerKey := mustGenerateKey(t)
+
+	alloc := types.GenesisAlloc{}
+	for _, key := range []*ecdsa.PrivateKey{deployerKey, relayerKey, payerKey} {
+		alloc[crypto.PubkeyToAddress(key.PublicKey)] = types.Account{Balance: new(big.Int).Mul(big.NewInt(100), oneEther)}
+	}
+	backend := simulated.NewBackend(alloc)
+	t.Cleanup(func() { backend.Close() })
+
+	chainID, err := backend.Client().ChainID(context.Background())
+	if err != nil {
+		t.Fatalf("get chain id: %v", err)
+	}
+	deployer, err := bind.NewKeyedTransactorWithChainID(deployerKey, chainID)
+	if err != nil {
+		t.Fatalf("deployer transactor: %v", err)
+	}
+
+	return &simulatedChain{
+		backend:    backend,
+		chainID:    chainID,
+		relayer:    &PrivateKeySigner{key: relayerKey, address: crypto.PubkeyToAddress(relayerKey.PublicKey)},
+		relayerTxs: newTestRelayerTxRepo(),
+		deployer:   deployer,
+		payerKey:   payerKey,
+		payer:      crypto.PubkeyToAddress(payerKey.PublicKey),
+	}
+}
+
+func (c *simulatedChain) txManager() *TxManager {
+	return NewTxManager(c.backend.Client(), c.relayer, c.relayerTxs, TxManagerConfig{})
+}
+
+// mine commits the pending block and returns the successful receipt of
+// txHash as the contract client resolves it.
+func (c *simulatedChain) mine(t *testing.T, receipts func(context.Context, common.Hash) (*types.Receipt, error), txHash string) *types.Receipt {
+	t.Helper()
+	c.backend.Commit()
+	receipt, err := receipts(context.Background(), common.HexToHash(txHash))
+	if err != nil {
+		t.Fatalf("get receipt of %s: %v", txHash, err)
+	}
+	if receipt == nil {
+		t.Fatalf("transaction %s was not mined", txHash)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("transaction %s reverted", txHash)
+	}
+	return receipt
+}
+
+// vaultFixture is the vault and a mock EIP-2612 USDC deployed on a
+// simulated chain, with the payer holding 100 USDC.
+type vaultFixture struct {
+	*simulatedChain
+	client        *ContractClient
+	vault         *chaintest.Vault
+	serviceWallet common.Address
+	identity      common.Address
+}
+
+func newVaultFixture(t *testing.T) *vaultFixture {
+	t.Helper()
+	chain := newSimulatedChain(t)
+	serviceWallet := crypto.PubkeyToAddress(mustGenerateKey(t).PublicKey)
+	vault := chaintest.DeployVault(t, chain.backend, chain.deployer, serviceWallet, chain.relayer.Address())
+	vault.Mint(t, chain.backend, chain.deployer, chain.payer, 100_000_000)
+
+	client, err := NewContractClientWithBackend(chain.backend.Client(), vault.Address.Hex(), chain.relayer, chain.relayerTxs, TxManagerConfig{})
+	if err != nil {
+		t.Fatalf("NewContractClientWithBackend returned error: %v", err)
+	}
+
+	return &vaultFixture{
+		simulatedChain: chain,
+		client:         client,
+		vault:          vault,
+		serviceWallet:  serviceWallet,
+		identity:       crypto.PubkeyToAddress(mustGenerateKey(t).PublicKey),
+	}
+}
+
+func (f *vaultFixture) mine(t *testing.T, txHash string) *types.Receipt {
+	t.Helper()
+	return f.simulatedChain.mine(t, f.client.TransactionReceipt, txHash)
+}
+
+// signPermit signs an EIP-2612 permit for the vault the way a wallet would,
+// from the domain and nonce the client reads off the token.
+func (f *vaultFixture) signPermit(t *testing.T, key *ecdsa.PrivateKey, value, deadline *big.Int) PermitSignature {
+	t.Helper()
+	ctx := context.Background()
+	permitDomain, err := f.client.PermitDomain(ctx)
+	if err != nil {
+		t.Fatalf("PermitDomain returned error: %v", err)
+	}
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	nonce, err := f.client.PermitNonce(ctx, owner)
+	if err != nil {
+		t.Fatalf("PermitNonce returned error: %v", err)
+	}
+
+	typedData := PermitTypedData(permitDomain, PermitMessage{
+		Owner:    owner,
+		Spender:  f.client.VaultAddress(),
+		Value:    value,
+		Nonce:    nonce,
+		Deadline: deadline,
+	})
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		t.Fatalf("hash permit: %v", err)
+	}
+	raw, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatalf("sign permit: %v", err)
+	}
+	sig, err := SplitPermitSignature(raw)
+	if err != nil {
+		t.Fatalf("split permit signature: %v", err)
+	}
+	return sig
+}
+
+func (f *vaultFixture) expectAllowances(t *testing.T, authorized, token int64) {
+	t.Helper()
+	ctx := context.Background()
+	vaultAllowance, err := f.client.GetAuthorizedAllowance(ctx, f.payer, f.identity)
+	if err != nil {
+		t.Fatalf("GetAuthorizedAllowance returned error: %v", err)
+	}
+	tokenAllowance, err := f.client.TokenAllowance(ctx, f.payer)
+	if err != nil {
+		t.Fatalf("TokenAllowance returned error: %v", err)
+	}
+	if vaultAllowance.Int64() != authorized || tokenAllowance.Int64() != token {
+		t.Fatalf("expected authorized/token allowance %d/%d, got %s/%s", authorized, token, vaultAllowance, tokenAllowance)
+	}
+}
+
+func expectRevert(t *testing.T, err error, reason string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected revert %q", reason)
+	}
+	if !strings.Contains(err.Error(), reason) {
+		t.Fatalf("expected revert %q, got %v", reason, err)
+	}
+}
+
+func permitDeadline() *big.Int {
+	return big.NewInt(time.Now().Add(time.Hour).Unix())
+}
+
+func TestSimulatedSubscriptionLifecycle(t *testing.T) {
+	f := newVaultFixture(t)
+	ctx := context.Background()
+	const price = 10_000_000
+
+	// Subscribing: the payer permits three periods and the relayer binds the
+	// identity.
+	deadline := permitDeadline()
+	permit := f.signPermit(t, f.payerKey, big.NewInt(3*price), deadline)
+	permitTx, err := f.client.AuthorizeChargeWithPermit(ctx, f.identity, f.payer, big.NewInt(0), big.NewInt(3*price), deadline, permit)
+	if err != nil {
+		t.Fatalf("AuthorizeChargeWithPermit returned error: %v", err)
+	}
+	f.mine(t, permitTx)
+
+	payer, err := f.client.GetIdentityPayer(ctx, f.identity)
+	if err != nil || payer != f.payer {
+		t.Fatalf("expected identity bound to %s, got %s (%v)", f.payer.Hex(), payer.Hex(), err)
+	}
+	f.expectAllowances(t, 3*price, 3*price)
+
+	// First charge and one renewal.
+	firstChargeID := ChargeIDBytes("charge-first")
+	chargeTx, err := f.client.Charge(ctx, firstChargeID, f.identity, big.NewInt(price))
+	if err != nil {
+		t.Fatalf("Charge returned error: %v", err)
+	}
+	f.mine(t, chargeTx)
+	renewalTx, err := f.client.Charge(ctx, ChargeIDBytes("charge-renewal-1"), f.identity, big.NewInt(price))
+	if err != nil {
+		t.Fatalf("renewal Charge returned error: %v", err)
+	}
+	f.mine(t, renewalTx)
+
+	executed, err := f.client.IsChargeExecuted(ctx, firstChargeID)
+	if err != nil || !executed {
+		t.Fatalf("expected first charge to be executed, got %v (%v)", executed, err)
+	}
+	if balance := f.vault.TokenBalance(t, f.serviceWallet); balance.Int64() != 2*price {
+		t.Fatalf("expected service wallet to hold %d, got %s", 2*price, balance)
+	}
+	f.expectAllowances(t, price, price)
+
+	// Retrying a charge ID, or charging past the authorization, reverts
+	// during estimation and does not consume a nonce.
+	_, err = f.client.Charge(ctx, firstChargeID, f.identity, big.NewInt(price))
+	expectRevert(t, err, "VPN: charge already executed")
+	_, err = f.client.Charge(ctx, ChargeIDBytes("charge-renewal-2"), f.identity, big.NewInt(2*price))
+	expectRevert(t, err, "VPN: insufficient authorized allowance")
+
+	// Cancelling: the payer permits the allowance back down by the vault's
+	// share.
+	deadline = permitDeadline()
+	revocation := f.signPermit(t, f.payerKey, big.NewInt(0), deadline)
+	cancelTx, err := f.client.CancelAuthorization(ctx, f.identity, f.payer, big.NewInt(price), big.NewInt(0), deadline, revocation)
+	if err != nil {
+		t.Fatalf("CancelAuthorization returned error: %v", err)
+	}
+	cancelReceipt := f.mine(t, cancelTx)
+	f.expectAllowances(t, 0, 0)
+
+	_, err = f.client.Charge(ctx, ChargeIDBytes("charge-renewal-2"), f.identity, big.NewInt(price))
+	expectRevert(t, err, "VPN: insufficient authorized allowance")
+
+	head, err := f.client.BlockNumber(ctx)
+	if err != nil {
+		t.Fatalf("BlockNumber returned error: %v", err)
+	}
+	events, err := f.client.FetchVaultEvents(ctx, 0, head)
+	if err != nil {
+		t.Fatalf("FetchVaultEvents returned error: %v", err)
+	}
+	wantNames := []domain.VaultEventName{
+		domain.VaultEventIdentityBound,
+		domain.VaultEventChargeAuthorized,
+		domain.VaultEventIdentityCharged,
+		domain.VaultEventIdentityCharged,
+		domain.VaultEventChargeAuthorized,
+	}
+	if len(events) != len(wantNames) {
+		t.Fatalf("expected %d vault events, got %d", len(wantNames), len(events))
+	}
+	for i, event := range events {
+		if event.Name != wantNames[i] {
+			t.Fatalf("event %d: expected %s, got %s", i, wantNames[i], event.Name)
+		}
+		if event.PayerAddress != f.payer.Hex() || event.IdentityAddress != f.identity.Hex() {
+			t.Fatalf("event %d has wrong parties: %+v", i, event)
+		}
+	}
+	if events[1].ExpectedAllowance != "0" || events[1].TargetAllowance != strconv.Itoa(3*price) {
+		t.Fatalf("unexpected authorization event: %+v", events[1])
+	}
+	if events[2].ChargeID != common.Hash(firstChargeID).Hex() || events[2].Amount != strconv.Itoa(price) {
+		t.Fatalf("unexpected charge event: %+v", events[2])
+	}
+	if events[4].TxHash != cancelReceipt.TxHash.Hex() || events[4].ExpectedAllowance != strconv.Itoa(price) || events[4].TargetAllowance != "0" {
+		t.Fatalf("unexpected revocation event: %+v", events[4])
+	}
+
+	// Every relayer transaction used its own nonce, in order.
+	for i, txHash := range []string{permitTx, chargeTx, renewalTx, cancelTx} {
+		record := f.relayerTxs.txs[txHash]
+		if record == nil || record.Nonce != int64(i) {
+			t.Fatalf("relayer transaction %d: unexpected record %+v", i, record)
+		}
+	}
+}
+
+func TestSimulatedAuthorizeRejectsPermitFromOtherSigner(t *testing.T) {
+	f := newVaultFixture(t)
+	ctx := context.Background()
+
+	deadline := permitDeadline()
+	permit := f.signPermit(t, mustGenerateKey(t), big.NewInt(10_000_000), deadline)
+	if _, err := f.client.AuthorizeChargeWithPermit(ctx, f.identity, f.payer, big.NewInt(0), big.NewInt(10_000_000), deadline, permit); err == nil {
+		t.Fatal("expected a permit signed by someone other than the payer to revert")
+	}
+	_, err := f.client.Charge(ctx, ChargeIDBytes("charge-first"), f.identity, big.NewInt(10_000_000))
+	expectRevert(t, err, "VPN: identity not bound")
+
+	// A permit for the right signer but a stale allowance snapshot is
+	// rejected by the vault before it reaches the token.
+	permit = f.signPermit(t, f.payerKey, big.NewInt(10_000_000), deadline)
+	_, err = f.client.AuthorizeChargeWithPermit(ctx, f.identity, f.payer, big.NewInt(5_000_000), big.NewInt(10_000_000), deadline, permit)
+	expectRevert(t, err, "VPN: allowance changed")
+
+	if len(f.relayerTxs.txs) != 0 {
+		t.Fatalf("expected reverted calls not to be recorded, got %d", len(f.relayerTxs.txs))
+	}
+}
+
+func TestSimulatedTxManagerSettlesMinedTransactions(t *testing.T) {
+	chain := newSimulatedChain(t)
+	manager := chain.txManager()
+	ctx := context.Background()
+
+	transfer := func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return opts.Signer(opts.From, types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chain.chainID,
+			Nonce:     opts.Nonce.Uint64(),
+			GasTipCap: opts.GasTipCap,
+			GasFeeCap: opts.GasFeeCap,
+			Gas:       21_000,
+			To:        &chain.payer,
+			Value:     big.NewInt(1),
+		}))
+	}
+
+	var hashes []string
+	for i := 0; i < 3; i++ {
+		txHash, err := manager.Send(ctx, transfer)
+		if err != nil {
+			t.Fatalf("Send returned error: %v", err)
+		}
+		hashes = append(hashes, txHash)
+	}
+	chain.backend.Commit()
+
+	for i, txHash := range hashes {
+		receipt, err := manager.Receipt(ctx, common.HexToHash(txHash))
+		if err != nil || receipt == nil || receipt.Status != types.ReceiptStatusSuccessful {
+			t.Fatalf("transaction %d: expected a successful receipt, got %+v (%v)", i, receipt, err)
+		}
+	}
+	if err := manager.Poll(ctx); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	for i, txHash := range hashes {
+		record := chain.relayerTxs.txs[txHash]
+		if record.Status != domain.RelayerTxMined || record.Nonce != int64(i) {
+			t.Fatalf("transaction %d: expected mined at nonce %d, got %+v", i, i, record)
+		}
+	}
+
+	// A restarted manager continues from the chain and the store.
+	txHash, err := chain.txManager().Send(ctx, transfer)
+	if err != nil {
+		t.Fatalf("Send after restart returned error: %v", err)
+	}
+	if record := chain.relayerTxs.txs[txHash]; record.Nonce != 3 {
+		t.Fatalf("expected nonce 3 after restart, got %d", record.Nonce)
+	}
+}
@@ -0,0 +1,561 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+)
+
+var ErrFeeCeilingReached = errors.New("transaction already pays the maximum fee per gas")
+
+// txBackend is the part of the RPC client the transaction manager talks to
+// directly. Contract calls still go through the bindings.
+type txBackend interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+type TxManagerConfig struct {
+	PollInterval time.Duration
+	// StuckTimeout is how long a broadcast may stay unmined before it is
+	// replaced with higher fees.
+	StuckTimeout time.Duration
+	// FeeBumpPercent raises both fee caps on replacement. Nodes reject
+	// replacements below 10%.
+	FeeBumpPercent int64
+	// MaxFeePerGas caps the fee cap in wei; nil means no cap.
+	MaxFeePerGas *big.Int
+}
+
+// TxManager owns the relayer key's nonce sequence. Submissions are serialized
+// and every signed transaction is stored before it is broadcast, so a restart
+// resumes the same nonces and can still replace what was in flight.
+type TxManager struct {
+	backend txBackend
+	signer  Signer
+	from    common.Address
+	store   repository.RelayerTransactionRepository
+	config  TxManagerConfig
+
+	mu          sync.Mutex
+	chainID     *big.Int
+	nonce       uint64
+	nonceLoaded bool
+}
+
+func NewTxManager(backend txBackend, signer Signer, store repository.RelayerTransactionRepository, config TxManagerConfig) *TxManager {
+	if config.PollInterval == 0 {
+		config.PollInterval = 15 * time.Second
+	}
+	if config.StuckTimeout == 0 {
+		config.StuckTimeout = 3 * time.Minute
+	}
+	if config.FeeBumpPercent < 10 {
+		config.FeeBumpPercent = 15
+	}
+
+	return &TxManager{
+		backend: backend,
+		signer:  signer,
+		from:    signer.Address(),
+		store:   store,
+		config:  config,
+	}
+}
+
+func (m *TxManager) From() common.Address {
+	return m.from
+}
+
+type beforeBroadcastKey struct{}
+
+// WithBeforeBroadcast returns a context under which Send calls record with the
+// hash of the signed transaction once it is stored and before it is
+// broadcast. Callers persist the hash there, so a crash right after the
+// broadcast cannot leave a transaction they do not know about. An error from
+// record abandons the transaction without using its nonce.
+func WithBeforeBroadcast(ctx context.Context, record func(txHash string) error) context.Context {
+	return context.WithValue(ctx, beforeBroadcastKey{}, record)
+}
+
+// Send assigns the next nonce and EIP-1559 fees, lets build produce the
+// signed transaction through a binding, then persists and broadcasts it. The
+// nonce is only consumed once the node has accepted the transaction or the
+// outcome of the broadcast is unknown.
+func (m *TxManager) Send(ctx context.Context, build func(opts *bind.TransactOpts) (*types.Transaction, error)) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.ensureReady(ctx); err != nil {
+		return "", err
+	}
+
+	tip, feeCap, err := m.suggestFees(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := build(&bind.TransactOpts{
+		From:  m.from,
+		Nonce: new(big.Int).SetUint64(m.nonce),
+		Signer: func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			return m.sign(ctx, from, tx)
+		},
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Context:   ctx,
+		NoSend:    true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	record, err := m.newRecord(tx, tx.Hash().Hex())
+	if err != nil {
+		return "", err
+	}
+	// Signing is deterministic, so retrying a rejected call with unchanged
+	// fees reproduces the rejected hash.
+	existing, err := m.store.GetByHash(ctx, record.TxHash)
+	if err != nil {
+		return "", fmt.Errorf("get relayer transaction: %w", err)
+	}
+	if existing != nil {
+		err = m.store.Update(record)
+	} else {
+		err = m.store.Create(record)
+	}
+	if err != nil {
+		return "", fmt.Errorf("persist relayer transaction: %w", err)
+	}
+
+	if beforeBroadcast, ok := ctx.Value(beforeBroadcastKey{}).(func(string) error); ok {
+		if err := beforeBroadcast(record.TxHash); err != nil {
+			record.Status = domain.RelayerTxRejected
+			record.Error = "not broadcast: " + err.Error()
+			record.UpdatedAt = time.Now().UnixMilli()
+			if updateErr := m.store.Update(record); updateErr != nil {
+				log.Printf("Failed to record abandoned relayer transaction %s: %v", record.TxHash, updateErr)
+			}
+			return "", fmt.Errorf("record transaction before broadcast: %w", err)
+		}
+	}
+
+	if err := m.backend.SendTransaction(ctx, tx); err != nil && !isKnownTransaction(err) {
+		if !isAmbiguousSendError(err) {
+			record.Status = domain.RelayerTxRejected
+			record.Error = err.Error()
+			record.UpdatedAt = time.Now().UnixMilli()
+			if updateErr := m.store.Update(record); updateErr != nil {
+				log.Printf("Failed to record rejected relayer transaction %s: %v", record.TxHash, updateErr)
+			}
+			if isNonceTooLow(err) {
+				m.nonceLoaded = false
+			}
+			return "", fmt.Errorf("send transaction: %w", err)
+		}
+		log.Printf("Broadcast of relayer transaction %s (nonce %d) did not complete, it will be rebroadcast: %v", record.TxHash, record.Nonce, err)
+	}
+
+	m.nonce++
+	return record.TxHash, nil
+}
+
+// Receipt returns the receipt of whichever broadcast of txHash's nonce was
+// mined, so callers can keep tracking the hash Send returned across fee
+// bumps. It returns nil without error while none of them has a receipt.
+func (m *TxManager) Receipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	hashes := []common.Hash{txHash}
+	record, err := m.store.GetByHash(ctx, txHash.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("get relayer transaction: %w", err)
+	}
+	if record != nil {
+		attempts, err := m.store.ListByOriginalHash(ctx, record.OriginalTxHash)
+		if err != nil {
+			return nil, fmt.Errorf("list relayer transaction attempts: %w", err)
+		}
+		hashes = hashes[:0]
+		for _, attempt := range attempts {
+			hashes = append(hashes, common.HexToHash(attempt.TxHash))
+		}
+	}
+
+	for _, hash := range hashes {
+		receipt, err := m.backend.TransactionReceipt(ctx, hash)
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get transaction receipt: %w", err)
+		}
+		return receipt, nil
+	}
+	return nil, nil
+}
+
+// Broadcasting reports whether txHash's nonce still has a pending broadcast
+// that Poll keeps fee-bumping, so the transaction may yet be mined however
+// long it has waited. It is false for hashes this manager did not send.
+func (m *TxManager) Broadcasting(ctx context.Context, txHash common.Hash) (bool, error) {
+	record, err := m.store.GetByHash(ctx, txHash.Hex())
+	if err != nil {
+		return false, fmt.Errorf("get relayer transaction: %w", err)
+	}
+	if record == nil {
+		return false, nil
+	}
+	attempts, err := m.store.ListByOriginalHash(ctx, record.OriginalTxHash)
+	if err != nil {
+		return false, fmt.Errorf("list relayer transaction attempts: %w", err)
+	}
+	for _, attempt := range attempts {
+		if attempt.Status == domain.RelayerTxPending {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *TxManager) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.config.PollInterval)
+	defer ticker.Stop()
+
+	log.Printf("Relayer transaction manager started (from: %s, stuck timeout: %v)", m.from.Hex(), m.config.StuckTimeout)
+
+	if err := m.Resume(ctx); err != nil {
+		log.Printf("Relayer transaction resume error: %v", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Relayer transaction manager stopped")
+			return
+		case <-ticker.C:
+			if err := m.Poll(ctx); err != nil {
+				log.Printf("Relayer transaction poll error: %v", err)
+			}
+		}
+	}
+}
+
+// Resume rebroadcasts every pending transaction. Nodes drop their mempool on
+// restart too, so anything persisted but not yet mined is sent again as is.
+func (m *TxManager) Resume(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.ensureReady(ctx); err != nil {
+		return err
+	}
+
+	pending, err := m.store.ListPending(ctx, m.from.Hex())
+	if err != nil {
+		return fmt.Errorf("list pending relayer transactions: %w", err)
+	}
+	for _, record := range pending {
+		tx, err := decodeRawTx(record.RawTx)
+		if err != nil {
+			log.Printf("Failed to decode relayer transaction %s: %v", record.TxHash, err)
+			continue
+		}
+		if err := m.backend.SendTransaction(ctx, tx); err != nil && !isKnownTransaction(err) && !isNonceTooLow(err) {
+			log.Printf("Failed to rebroadcast relayer transaction %s (nonce %d): %v", record.TxHash, record.Nonce, err)
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("Resumed %d pending relayer transactions", len(pending))
+	}
+	return nil
+}
+
+// Poll settles transactions whose nonce has been mined and replaces the ones
+// that have waited longer than the stuck timeout.
+func (m *TxManager) Poll(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.ensureReady(ctx); err != nil {
+		return err
+	}
+
+	pending, err := m.store.ListPending(ctx, m.from.Hex())
+	if err != nil {
+		return fmt.Errorf("list pending relayer transactions: %w", err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	minedNonce, err := m.backend.NonceAt(ctx, m.from, nil)
+	if err != nil {
+		return fmt.Errorf("get mined nonce: %w", err)
+	}
+
+	stuckBefore := time.Now().Add(-m.config.StuckTimeout).UnixMilli()
+	for _, record := range pending {
+		if uint64(record.Nonce) < minedNonce {
+			if err := m.settle(ctx, record); err != nil {
+				log.Printf("Failed to settle relayer transaction %s (nonce %d): %v", record.TxHash, record.Nonce, err)
+			}
+			continue
+		}
+		if record.CreatedAt > stuckBefore {
+			continue
+		}
+		if err := m.replace(ctx, record); err != nil {
+			log.Printf("Failed to replace stuck relayer transaction %s (nonce %d): %v", record.TxHash, record.Nonce, err)
+		}
+	}
+	return nil
+}
+
+// settle records which broadcast of a mined nonce made it into a block.
+func (m *TxManager) settle(ctx context.Context, record *domain.RelayerTransaction) error {
+	attempts, err := m.store.ListByOriginalHash(ctx, record.OriginalTxHash)
+	if err != nil {
+		return fmt.Errorf("list attempts: %w", err)
+	}
+
+	now := time.Now().UnixMilli()
+	for _, attempt := range attempts {
+		receipt, err := m.backend.TransactionReceipt(ctx, common.HexToHash(attempt.TxHash))
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("get transaction receipt: %w", err)
+		}
+		if receipt == nil {
+			continue
+		}
+
+		attempt.Status = domain.RelayerTxMined
+		attempt.UpdatedAt = now
+		if attempt.TxHash == record.TxHash {
+			return m.store.Update(attempt)
+		}
+		record.Status = domain.RelayerTxReplaced
+		record.UpdatedAt = now
+		if err := m.store.Update(record); err != nil {
+			return err
+		}
+		return m.store.Update(attempt)
+	}
+
+	log.Printf("Nonce %d of relayer transaction %s was used by another transaction", record.Nonce, record.OriginalTxHash)
+	record.Status = domain.RelayerTxDropped
+	record.Error = "nonce used by a transaction this service did not send"
+	record.UpdatedAt = now
+	return m.store.Update(record)
+}
+
+// replace re-signs a stuck transaction with bumped fees. The replacement is
+// stored before it is broadcast, so whichever of the two is mined can be
+// found from the original hash.
+func (m *TxManager) replace(ctx context.Context, record *domain.RelayerTransaction) error {
+	stuck, err := decodeRawTx(record.RawTx)
+	if err != nil {
+		return err
+	}
+
+	tip, feeCap, err := m.bumpFees(ctx, stuck)
+	if err != nil {
+		return err
+	}
+
+	replacement, err := m.sign(ctx, m.from, types.NewTx(&types.DynamicFeeTx{
+		ChainID:   m.chainID,
+		Nonce:     stuck.Nonce(),
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       stuck.Gas(),
+		To:        stuck.To(),
+		Value:     stuck.Value(),
+		Data:      stuck.Data(),
+	}))
+	if err != nil {
+		return err
+	}
+
+	next, err := m.newRecord(replacement, record.OriginalTxHash)
+	if err != nil {
+		return err
+	}
+	record.Status = domain.RelayerTxReplaced
+	record.UpdatedAt = next.CreatedAt
+	if err := m.store.Replace(ctx, record, next); err != nil {
+		return fmt.Errorf("persist replacement: %w", err)
+	}
+
+	log.Printf("Replacing relayer transaction %s (nonce %d) with %s at tip %s, fee cap %s", record.TxHash, record.Nonce, next.TxHash, tip, feeCap)
+	if err := m.backend.SendTransaction(ctx, replacement); err != nil && !isKnownTransaction(err) {
+		return fmt.Errorf("send replacement: %w", err)
+	}
+	return nil
+}
+
+func (m *TxManager) ensureReady(ctx context.Context) error {
+	if m.chainID == nil {
+		chainID, err := m.backend.ChainID(ctx)
+		if err != nil {
+			return fmt.Errorf("get chain id: %w", err)
+		}
+		m.chainID = chainID
+	}
+
+	if !m.nonceLoaded {
+		pendingNonce, err := m.backend.PendingNonceAt(ctx, m.from)
+		if err != nil {
+			return fmt.Errorf("get pending nonce: %w", err)
+		}
+		stored, err := m.store.MaxNonce(ctx, m.from.Hex())
+		if err != nil {
+			return fmt.Errorf("get stored nonce: %w", err)
+		}
+		m.nonce = pendingNonce
+		if stored+1 > int64(pendingNonce) {
+			m.nonce = uint64(stored + 1)
+		}
+		m.nonceLoaded = true
+	}
+	return nil
+}
+
+// suggestFees prices a new transaction at twice the current base fee plus
+// the suggested tip, which stays valid through several full blocks.
+func (m *TxManager) suggestFees(ctx context.Context) (*big.Int, *big.Int, error) {
+	tip, err := m.backend.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("suggest gas tip cap: %w", err)
+	}
+	head, err := m.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get head block: %w", err)
+	}
+	if head.BaseFee == nil {
+		return nil, nil, fmt.Errorf("chain does not support EIP-1559 fees")
+	}
+
+	feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+	tip, feeCap = m.capFees(tip, feeCap)
+	return tip, feeCap, nil
+}
+
+func (m *TxManager) bumpFees(ctx context.Context, stuck *types.Transaction) (*big.Int, *big.Int, error) {
+	if m.config.MaxFeePerGas != nil && stuck.GasFeeCap().Cmp(m.config.MaxFeePerGas) >= 0 {
+		return nil, nil, ErrFeeCeilingReached
+	}
+
+	suggestedTip, suggestedFeeCap, err := m.suggestFees(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tip := maxBig(m.bump(stuck.GasTipCap()), suggestedTip)
+	feeCap := maxBig(m.bump(stuck.GasFeeCap()), suggestedFeeCap)
+	tip, feeCap = m.capFees(tip, feeCap)
+	return tip, feeCap, nil
+}
+
+func (m *TxManager) bump(value *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(value, big.NewInt(100+m.config.FeeBumpPercent))
+	bumped.Add(bumped, big.NewInt(99))
+	return bumped.Div(bumped, big.NewInt(100))
+}
+
+func (m *TxManager) capFees(tip, feeCap *big.Int) (*big.Int, *big.Int) {
+	if m.config.MaxFeePerGas != nil && feeCap.Cmp(m.config.MaxFeePerGas) > 0 {
+		feeCap = new(big.Int).Set(m.config.MaxFeePerGas)
+	}
+	if tip.Cmp(feeCap) > 0 {
+		tip = new(big.Int).Set(feeCap)
+	}
+	return tip, feeCap
+}
+
+func (m *TxManager) sign(ctx context.Context, from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+	if from != m.from {
+		return nil, bind.ErrNotAuthorized
+	}
+	signed, err := m.signer.SignTx(ctx, tx, m.chainID)
+	if err != nil {
+		return nil, fmt.Errorf("sign transaction: %w", err)
+	}
+	return signed, nil
+}
+
+func (m *TxManager) newRecord(tx *types.Transaction, originalTxHash string) (*domain.RelayerTransaction, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("encode transaction: %w", err)
+	}
+	now := time.Now().UnixMilli()
+	return &domain.RelayerTransaction{
+		TxHash:         tx.Hash().Hex(),
+		OriginalTxHash: originalTxHash,
+		FromAddress:    m.from.Hex(),
+		Nonce:          int64(tx.Nonce()),
+		GasTipCap:      tx.GasTipCap().String(),
+		GasFeeCap:      tx.GasFeeCap().String(),
+		RawTx:          hexutil.Encode(raw),
+		Status:         domain.RelayerTxPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}, nil
+}
+
+func decodeRawTx(raw string) (*types.Transaction, error) {
+	data, err := hexutil.Decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode raw transaction: %w", err)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("decode raw transaction: %w", err)
+	}
+	return tx, nil
+}
+
+func maxBig(a, b *big.Int) *big.Int {
+	if a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
+
+func isKnownTransaction(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+func isNonceTooLow(err error) bool {
+	return strings.Contains(err.Error(), "nonce too low")
+}
+
+// isAmbiguousSendError reports errors after which the node may or may not
+// have accepted the transaction.
+func isAmbiguousSendError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) || errors.As(err, &netErr)
+}
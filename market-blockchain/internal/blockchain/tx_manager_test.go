@@ -0,0 +1,330 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"market-blockchain/internal/domain"
+)
+
+type testTxBackend struct {
+	pendingNonce uint64
+	minedNonce   uint64
+	tip          *big.Int
+	baseFee      *big.Int
+	sent         []*types.Transaction
+	sendErr      error
+	receipts     map[common.Hash]*types.Receipt
+}
+
+func newTestTxBackend() *testTxBackend {
+	return &testTxBackend{tip: big.NewInt(1_000_000_000), baseFee: big.NewInt(10_000_000_000), receipts: make(map[common.Hash]*types.Receipt)}
+}
+
+func (b *testTxBackend) ChainID(ctx context.Context) (*big.Int, error) { return big.NewInt(84532), nil }
+func (b *testTxBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return b.pendingNonce, nil
+}
+func (b *testTxBackend) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return b.minedNonce, nil
+}
+func (b *testTxBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) { return b.tip, nil }
+func (b *testTxBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{BaseFee: b.baseFee}, nil
+}
+func (b *testTxBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if b.sendErr != nil {
+		return b.sendErr
+	}
+	b.sent = append(b.sent, tx)
+	return nil
+}
+func (b *testTxBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	if receipt, ok := b.receipts[txHash]; ok {
+		return receipt, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+type testRelayerTxRepo struct {
+	txs map[string]*domain.RelayerTransaction
+}
+
+func newTestRelayerTxRepo() *testRelayerTxRepo {
+	return &testRelayerTxRepo{txs: make(map[string]*domain.RelayerTransaction)}
+}
+
+func (r *testRelayerTxRepo) Create(tx *domain.RelayerTransaction) error {
+	copy := *tx
+	r.txs[tx.TxHash] = &copy
+	return nil
+}
+func (r *testRelayerTxRepo) Update(tx *domain.RelayerTransaction) error {
+	copy := *tx
+	r.txs[tx.TxHash] = &copy
+	return nil
+}
+func (r *testRelayerTxRepo) Replace(ctx context.Context, replaced, replacement *domain.RelayerTransaction) error {
+	_ = r.Update(replaced)
+	return r.Create(replacement)
+}
+func (r *testRelayerTxRepo) GetByHash(ctx context.Context, txHash string) (*domain.RelayerTransaction, error) {
+	if tx, ok := r.txs[txHash]; ok {
+		copy := *tx
+		return &copy, nil
+	}
+	return nil, nil
+}
+func (r *testRelayerTxRepo) ListByOriginalHash(ctx context.Context, originalTxHash string) ([]*domain.RelayerTransaction, error) {
+	return r.filter(func(tx *domain.RelayerTransaction) bool { return tx.OriginalTxHash == originalTxHash }), nil
+}
+func (r *testRelayerTxRepo) ListPending(ctx context.Context, fromAddress string) ([]*domain.RelayerTransaction, error) {
+	return r.filter(func(tx *domain.RelayerTransaction) bool {
+		return tx.FromAddress == fromAddress && tx.Status == domain.RelayerTxPending
+	}), nil
+}
+func (r *testRelayerTxRepo) MaxNonce(ctx context.Context, fromAddress string) (int64, error) {
+	max := int64(-1)
+	for _, tx := range r.txs {
+		if tx.FromAddress == fromAddress && tx.Status != domain.RelayerTxRejected && tx.Nonce > max {
+			max = tx.Nonce
+		}
+	}
+	return max, nil
+}
+func (r *testRelayerTxRepo) filter(keep func(*domain.RelayerTransaction) bool) []*domain.RelayerTransaction {
+	var out []*domain.RelayerTransaction
+	for _, tx := range r.txs {
+		if keep(tx) {
+			copy := *tx
+			out = append(out, &copy)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Nonce != out[j].Nonce {
+			return out[i].Nonce < out[j].Nonce
+		}
+		return out[i].CreatedAt > out[j].CreatedAt
+	})
+	return out
+}
+
+// buildTestTx stands in for a contract binding: it builds and signs a
+// transaction from the options the manager hands out.
+func buildTestTx(opts *bind.TransactOpts) (*types.Transaction, error) {
+	to := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	return opts.Signer(opts.From, types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(84532),
+		Nonce:     opts.Nonce.Uint64(),
+		GasTipCap: opts.GasTipCap,
+		GasFeeCap: opts.GasFeeCap,
+		Gas:       100_000,
+		To:        &to,
+		Data:      []byte{0x01},
+	}))
+}
+
+func newTestTxManager(t *testing.T, backend *testTxBackend, repo *testRelayerTxRepo, config TxManagerConfig) *TxManager {
+	t.Helper()
+	signer, err := NewPrivateKeySigner("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	if err != nil {
+		t.Fatalf("parse key: %v", err)
+	}
+	return NewTxManager(backend, signer, repo, config)
+}
+
+func TestTxManagerAssignsSequentialNoncesAndPersistsBeforeBroadcast(t *testing.T) {
+	backend := newTestTxBackend()
+	backend.pendingNonce = 5
+	repo := newTestRelayerTxRepo()
+	manager := newTestTxManager(t, backend, repo, TxManagerConfig{})
+
+	for i := 0; i < 3; i++ {
+		if _, err := manager.Send(context.Background(), buildTestTx); err != nil {
+			t.Fatalf("Send returned error: %v", err)
+		}
+	}
+
+	if len(backend.sent) != 3 {
+		t.Fatalf("expected 3 broadcasts, got %d", len(backend.sent))
+	}
+	for i, tx := range backend.sent {
+		if tx.Nonce() != uint64(5+i) {
+			t.Fatalf("broadcast %d used nonce %d", i, tx.Nonce())
+		}
+		if repo.txs[tx.Hash().Hex()] == nil {
+			t.Fatalf("broadcast %d was not persisted", i)
+		}
+	}
+	// fee cap = 2 * base fee + tip
+	if backend.sent[0].GasFeeCap().Cmp(big.NewInt(21_000_000_000)) != 0 || backend.sent[0].GasTipCap().Cmp(backend.tip) != 0 {
+		t.Fatalf("unexpected fees: tip %s cap %s", backend.sent[0].GasTipCap(), backend.sent[0].GasFeeCap())
+	}
+}
+
+func TestTxManagerDoesNotConsumeNonceOnRejection(t *testing.T) {
+	backend := newTestTxBackend()
+	repo := newTestRelayerTxRepo()
+	manager := newTestTxManager(t, backend, repo, TxManagerConfig{})
+
+	backend.sendErr = errors.New("insufficient funds for gas * price + value")
+	if _, err := manager.Send(context.Background(), buildTestTx); err == nil {
+		t.Fatal("expected rejected broadcast to return an error")
+	}
+	backend.sendErr = nil
+
+	txHash, err := manager.Send(context.Background(), buildTestTx)
+	if err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	if backend.sent[0].Nonce() != 0 {
+		t.Fatalf("expected rejected nonce to be reused, got %d", backend.sent[0].Nonce())
+	}
+	if len(repo.txs) != 1 || repo.txs[txHash].Status != domain.RelayerTxPending || repo.txs[txHash].Error != "" {
+		t.Fatalf("expected the retried broadcast to be pending, got %+v", repo.txs[txHash])
+	}
+}
+
+func TestTxManagerRecordsHashBeforeBroadcast(t *testing.T) {
+	backend := newTestTxBackend()
+	repo := newTestRelayerTxRepo()
+	manager := newTestTxManager(t, backend, repo, TxManagerConfig{})
+
+	var recorded string
+	ctx := WithBeforeBroadcast(context.Background(), func(txHash string) error {
+		if len(backend.sent) != 0 {
+			t.Fatal("expected the hash to be recorded before the broadcast")
+		}
+		recorded = txHash
+		return nil
+	})
+	txHash, err := manager.Send(ctx, buildTestTx)
+	if err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	if recorded != txHash || len(backend.sent) != 1 {
+		t.Fatalf("expected %s recorded and broadcast, got %q and %d broadcasts", txHash, recorded, len(backend.sent))
+	}
+
+	ctx = WithBeforeBroadcast(context.Background(), func(txHash string) error { return errors.New("db down") })
+	if _, err := manager.Send(ctx, buildTestTx); err == nil {
+		t.Fatal("expected a failed record to return an error")
+	}
+	if len(backend.sent) != 1 {
+		t.Fatalf("expected nothing broadcast when the hash could not be recorded, got %d broadcasts", len(backend.sent))
+	}
+	if _, err := manager.Send(context.Background(), buildTestTx); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	if backend.sent[1].Nonce() != 1 {
+		t.Fatalf("expected the unbroadcast nonce to be reused, got %d", backend.sent[1].Nonce())
+	}
+}
+
+func TestTxManagerReplacesStuckTransactionWithBumpedFees(t *testing.T) {
+	backend := newTestTxBackend()
+	repo := newTestRelayerTxRepo()
+	manager := newTestTxManager(t, backend, repo, TxManagerConfig{StuckTimeout: time.Minute, FeeBumpPercent: 20})
+
+	original, err := manager.Send(context.Background(), buildTestTx)
+	if err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	repo.txs[original].CreatedAt = time.Now().Add(-2 * time.Minute).UnixMilli()
+
+	if err := manager.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if len(backend.sent) != 2 {
+		t.Fatalf("expected a replacement broadcast, got %d broadcasts", len(backend.sent))
+	}
+	replacement := backend.sent[1]
+	if replacement.Nonce() != backend.sent[0].Nonce() {
+		t.Fatal("replacement must reuse the stuck nonce")
+	}
+	if replacement.GasTipCap().Cmp(big.NewInt(1_200_000_000)) != 0 || replacement.GasFeeCap().Cmp(big.NewInt(25_200_000_000)) != 0 {
+		t.Fatalf("unexpected bumped fees: tip %s cap %s", replacement.GasTipCap(), replacement.GasFeeCap())
+	}
+	if repo.txs[original].Status != domain.RelayerTxReplaced || repo.txs[replacement.Hash().Hex()].OriginalTxHash != original {
+		t.Fatalf("unexpected stored attempts: %+v", repo.txs)
+	}
+	if broadcasting, err := manager.Broadcasting(context.Background(), common.HexToHash(original)); err != nil || !broadcasting {
+		t.Fatalf("expected the replaced nonce to still be broadcasting, got %v %v", broadcasting, err)
+	}
+
+	backend.receipts[replacement.Hash()] = &types.Receipt{TxHash: replacement.Hash(), Status: types.ReceiptStatusSuccessful, BlockNumber: big.NewInt(10)}
+	receipt, err := manager.Receipt(context.Background(), common.HexToHash(original))
+	if err != nil {
+		t.Fatalf("Receipt returned error: %v", err)
+	}
+	if receipt == nil || receipt.TxHash != replacement.Hash() {
+		t.Fatalf("expected the original hash to resolve to the replacement receipt, got %+v", receipt)
+	}
+
+	backend.minedNonce = 1
+	if err := manager.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if repo.txs[replacement.Hash().Hex()].Status != domain.RelayerTxMined {
+		t.Fatalf("expected replacement to be settled as mined, got %s", repo.txs[replacement.Hash().Hex()].Status)
+	}
+	if broadcasting, err := manager.Broadcasting(context.Background(), common.HexToHash(original)); err != nil || broadcasting {
+		t.Fatalf("expected nothing left to broadcast once the nonce is mined, got %v %v", broadcasting, err)
+	}
+}
+
+func TestTxManagerStopsBumpingAtFeeCeiling(t *testing.T) {
+	backend := newTestTxBackend()
+	repo := newTestRelayerTxRepo()
+	manager := newTestTxManager(t, backend, repo, TxManagerConfig{StuckTimeout: time.Minute, MaxFeePerGas: big.NewInt(21_000_000_000)})
+
+	original, err := manager.Send(context.Background(), buildTestTx)
+	if err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	repo.txs[original].CreatedAt = time.Now().Add(-2 * time.Minute).UnixMilli()
+
+	if err := manager.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if len(backend.sent) != 1 || repo.txs[original].Status != domain.RelayerTxPending {
+		t.Fatal("expected no replacement once the fee cap is at the ceiling")
+	}
+}
+
+func TestTxManagerResumesNoncesAndRebroadcastsAfterRestart(t *testing.T) {
+	backend := newTestTxBackend()
+	repo := newTestRelayerTxRepo()
+	first := newTestTxManager(t, backend, repo, TxManagerConfig{})
+	for i := 0; i < 2; i++ {
+		if _, err := first.Send(context.Background(), buildTestTx); err != nil {
+			t.Fatalf("Send returned error: %v", err)
+		}
+	}
+
+	// The node lost its mempool along with the service.
+	restarted := newTestTxBackend()
+	second := newTestTxManager(t, restarted, repo, TxManagerConfig{})
+	if err := second.Resume(context.Background()); err != nil {
+		t.Fatalf("Resume returned error: %v", err)
+	}
+	if len(restarted.sent) != 2 {
+		t.Fatalf("expected both pending transactions to be rebroadcast, got %d", len(restarted.sent))
+	}
+
+	if _, err := second.Send(context.Background(), buildTestTx); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	if nonce := restarted.sent[2].Nonce(); nonce != 2 {
+		t.Fatalf("expected the next nonce after the persisted ones, got %d", nonce)
+	}
+}
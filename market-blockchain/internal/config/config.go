@@ -11,39 +11,142 @@ type Config struct {
 	ServerPort string
 
 	DatabaseURL string
+	// AutoMigrate applies pending schema migrations at startup.
+	AutoMigrate bool
 
-	BlockchainRPCURL      string
-	ContractAddress       string
-	PrivateKey            string
+	BlockchainRPCURL   string
+	ContractAddress    string
+	ChainConfirmations string
+	TxTrackerInterval  string
+	// TxMaxPendingAge is how long a broadcast transaction may stay unmined
+	// before the tracker drops it and releases its charge for a retry.
+	TxMaxPendingAge string
+	// ExplorerURL is the block explorer that transaction links in account
+	// history point to, e.g. https://basescan.org. Empty omits the links.
+	ExplorerURL string
+
+	// Relayer signer: "key" (PRIVATE_KEY, development only), "keystore" or
+	// "external". Empty disables relaying.
+	RelayerSigner                 string
+	PrivateKey                    string
+	RelayerKeystorePath           string
+	RelayerKeystorePassphraseFile string
+	RelayerExternalSignerURL      string
+	RelayerAddress                string
+
+	// Relayer transaction manager
+	RelayerPollInterval   string
+	RelayerStuckTimeout   string
+	RelayerFeeBumpPercent string
+	RelayerMaxFeeGwei     string
+
+	// Vault event indexer
+	VaultIndexerStartBlock string
+	VaultIndexerBatchSize  string
+	VaultIndexerInterval   string
+
+	// Chain reconciliation
+	ReconciliationInterval    string
+	ReconciliationAutoCorrect bool
 
 	RenewalCheckInterval string
+	// A failed renewal leaves the subscription past due for
+	// RenewalGracePeriod, retried after each comma-separated delay of
+	// RenewalRetrySchedule in turn.
+	RenewalGracePeriod   string
+	RenewalRetrySchedule string
+
+	// Wallet sign-in (EIP-4361)
+	SIWEDomain     string
+	SIWEChainID    string
+	AuthNonceTTL   string
+	AuthSessionTTL string
 
-	// Xray integration
+	// Admin access: comma-separated name:roles:sha256 and 0xaddress:roles
+	AdminAPIKeys string
+	AdminWallets string
+
+	// Xray integration. XrayAPIAddress and XrayInboundTag seed the node
+	// registry with a "default" node when it is empty.
 	XrayAPIAddress       string
 	XrayInboundTag       string
 	XrayEnabled          bool
 	TrafficStatsInterval string
+	// How long hourly and daily traffic samples are kept
+	TrafficHourlyRetention string
+	TrafficDailyRetention  string
+	XrayHealthInterval     string
+	XrayNodeTimeout        string
+	XraySyncRetryInterval  string
+	XrayReconcileInterval  string
+
+	// Webhook delivery
+	WebhookDeliveryInterval string
+	WebhookTimeout          string
 }
 
 func Load() (*Config, error) {
 	cfg := &Config{
-		AppEnv:                getEnv("APP_ENV", "development"),
-		ServerPort:            getEnv("SERVER_PORT", "8080"),
-		DatabaseURL:           getEnv("DATABASE_URL", ""),
-		BlockchainRPCURL:      getEnv("BLOCKCHAIN_RPC_URL", ""),
-		ContractAddress:       getEnv("CONTRACT_ADDRESS", ""),
-		PrivateKey:            getEnv("PRIVATE_KEY", ""),
-		RenewalCheckInterval:  getEnv("RENEWAL_CHECK_INTERVAL", "1h"),
-		XrayAPIAddress:        getEnv("XRAY_API_ADDRESS", "127.0.0.1:10085"),
-		XrayInboundTag:        getEnv("XRAY_INBOUND_TAG", "vless-in"),
-		XrayEnabled:           getEnv("XRAY_ENABLED", "false") == "true",
-		TrafficStatsInterval:  getEnv("TRAFFIC_STATS_INTERVAL", "10s"),
+		AppEnv:                        getEnv("APP_ENV", "development"),
+		ServerPort:                    getEnv("SERVER_PORT", "8080"),
+		DatabaseURL:                   getEnv("DATABASE_URL", ""),
+		AutoMigrate:                   getEnv("AUTO_MIGRATE", "true") == "true",
+		BlockchainRPCURL:              getEnv("BLOCKCHAIN_RPC_URL", ""),
+		ContractAddress:               getEnv("CONTRACT_ADDRESS", ""),
+		RelayerSigner:                 getEnv("RELAYER_SIGNER", ""),
+		PrivateKey:                    getEnv("PRIVATE_KEY", ""),
+		RelayerKeystorePath:           getEnv("RELAYER_KEYSTORE_PATH", ""),
+		RelayerKeystorePassphraseFile: getEnv("RELAYER_KEYSTORE_PASSPHRASE_FILE", ""),
+		RelayerExternalSignerURL:      getEnv("RELAYER_EXTERNAL_SIGNER_URL", ""),
+		RelayerAddress:                getEnv("RELAYER_ADDRESS", ""),
+		ChainConfirmations:            getEnv("CHAIN_CONFIRMATIONS", "3"),
+		TxTrackerInterval:             getEnv("TX_TRACKER_INTERVAL", "15s"),
+		TxMaxPendingAge:               getEnv("TX_MAX_PENDING_AGE", "1h"),
+		ExplorerURL:                   getEnv("EXPLORER_URL", ""),
+		RelayerPollInterval:           getEnv("RELAYER_POLL_INTERVAL", "15s"),
+		RelayerStuckTimeout:           getEnv("RELAYER_STUCK_TIMEOUT", "3m"),
+		RelayerFeeBumpPercent:         getEnv("RELAYER_FEE_BUMP_PERCENT", "15"),
+		RelayerMaxFeeGwei:             getEnv("RELAYER_MAX_FEE_GWEI", ""),
+		VaultIndexerStartBlock:        getEnv("VAULT_INDEXER_START_BLOCK", "0"),
+		VaultIndexerBatchSize:         getEnv("VAULT_INDEXER_BATCH_SIZE", "2000"),
+		VaultIndexerInterval:          getEnv("VAULT_INDEXER_INTERVAL", "30s"),
+		ReconciliationInterval:        getEnv("RECONCILIATION_INTERVAL", "1h"),
+		ReconciliationAutoCorrect:     getEnv("RECONCILIATION_AUTO_CORRECT", "false") == "true",
+		RenewalCheckInterval:          getEnv("RENEWAL_CHECK_INTERVAL", "1h"),
+		RenewalGracePeriod:            getEnv("RENEWAL_GRACE_PERIOD", "72h"),
+		RenewalRetrySchedule:          getEnv("RENEWAL_RETRY_SCHEDULE", "1h,6h,24h"),
+		SIWEDomain:                    getEnv("SIWE_DOMAIN", "localhost:8080"),
+		SIWEChainID:                   getEnv("SIWE_CHAIN_ID", "0"),
+		AuthNonceTTL:                  getEnv("AUTH_NONCE_TTL", "10m"),
+		AuthSessionTTL:                getEnv("AUTH_SESSION_TTL", "1h"),
+		AdminAPIKeys:                  getEnv("ADMIN_API_KEYS", ""),
+		AdminWallets:                  getEnv("ADMIN_WALLETS", ""),
+		XrayAPIAddress:                getEnv("XRAY_API_ADDRESS", "127.0.0.1:10085"),
+		XrayInboundTag:                getEnv("XRAY_INBOUND_TAG", "vless-in"),
+		XrayEnabled:                   getEnv("XRAY_ENABLED", "false") == "true",
+		TrafficStatsInterval:          getEnv("TRAFFIC_STATS_INTERVAL", "10s"),
+		TrafficHourlyRetention:        getEnv("TRAFFIC_HOURLY_RETENTION", "720h"),
+		TrafficDailyRetention:         getEnv("TRAFFIC_DAILY_RETENTION", "9600h"),
+		XrayHealthInterval:            getEnv("XRAY_HEALTH_INTERVAL", "30s"),
+		XrayNodeTimeout:               getEnv("XRAY_NODE_TIMEOUT", "5s"),
+		XraySyncRetryInterval:         getEnv("XRAY_SYNC_RETRY_INTERVAL", "15s"),
+		XrayReconcileInterval:         getEnv("XRAY_RECONCILE_INTERVAL", "10m"),
+		WebhookDeliveryInterval:       getEnv("WEBHOOK_DELIVERY_INTERVAL", "10s"),
+		WebhookTimeout:                getEnv("WEBHOOK_TIMEOUT", "10s"),
 	}
 
 	if cfg.DatabaseURL == "" {
 		return nil, fmt.Errorf("DATABASE_URL is required")
 	}
 
+	// Setting PRIVATE_KEY alone keeps working for local development.
+	if cfg.RelayerSigner == "" && cfg.PrivateKey != "" {
+		cfg.RelayerSigner = "key"
+	}
+	if cfg.RelayerSigner == "key" && cfg.AppEnv == "production" {
+		return nil, fmt.Errorf("RELAYER_SIGNER=key keeps the relayer key in the environment; use keystore or external in production")
+	}
+
 	return cfg, nil
 }
 
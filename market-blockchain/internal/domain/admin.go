@@ -0,0 +1,40 @@
+package domain
+
+type AdminRole string
+
+const (
+	// AdminRoleViewer can read dashboards, plans and subscriptions.
+	AdminRoleViewer AdminRole = "viewer"
+	// AdminRoleOperator can change plans and trigger operational jobs.
+	AdminRoleOperator AdminRole = "operator"
+	// AdminRoleFinance can read revenue and reconciliation data.
+	AdminRoleFinance AdminRole = "finance"
+	// AdminRoleAdmin satisfies every role requirement.
+	AdminRoleAdmin AdminRole = "admin"
+)
+
+type AdminAuthMethod string
+
+const (
+	AdminAuthAPIKey AdminAuthMethod = "api_key"
+	AdminAuthWallet AdminAuthMethod = "wallet"
+)
+
+// AdminPrincipal is an authenticated admin caller: an API key by name or a
+// wallet by address.
+type AdminPrincipal struct {
+	Subject string
+	Method  AdminAuthMethod
+	Roles   []AdminRole
+}
+
+// HasRole reports whether the principal may act with role. Every role
+// includes read-only viewer access, and admin includes everything.
+func (p *AdminPrincipal) HasRole(role AdminRole) bool {
+	for _, granted := range p.Roles {
+		if granted == AdminRoleAdmin || granted == role || role == AdminRoleViewer {
+			return true
+		}
+	}
+	return false
+}
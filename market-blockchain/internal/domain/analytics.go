@@ -0,0 +1,87 @@
+package domain
+
+import "time"
+
+// AnalyticsGranularity is the size of a dashboard bucket. The values double
+// as the PostgreSQL date_trunc fields the buckets are computed with.
+type AnalyticsGranularity string
+
+const (
+	AnalyticsDaily   AnalyticsGranularity = "day"
+	AnalyticsWeekly  AnalyticsGranularity = "week"
+	AnalyticsMonthly AnalyticsGranularity = "month"
+)
+
+// BucketStart truncates a millisecond timestamp to the start of its UTC
+// bucket. Weeks start on Monday, as they do for date_trunc.
+func (g AnalyticsGranularity) BucketStart(ts int64) int64 {
+	t := time.UnixMilli(ts).UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch g {
+	case AnalyticsWeekly:
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case AnalyticsMonthly:
+		day = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day.UnixMilli()
+}
+
+// NextBucket returns the start of the bucket after the one starting at start.
+func (g AnalyticsGranularity) NextBucket(start int64) int64 {
+	t := time.UnixMilli(start).UTC()
+	switch g {
+	case AnalyticsWeekly:
+		t = t.AddDate(0, 0, 7)
+	case AnalyticsMonthly:
+		t = t.AddDate(0, 1, 0)
+	default:
+		t = t.AddDate(0, 0, 1)
+	}
+	return t.UnixMilli()
+}
+
+// RevenueBucket totals the completed charges created within one bucket.
+type RevenueBucket struct {
+	BucketStart int64
+	ChargeCount int
+	Amount      int64
+}
+
+// PlanRevenue totals the completed charges of one plan.
+type PlanRevenue struct {
+	PlanID      string
+	ChargeCount int
+	Amount      int64
+}
+
+// SubscriptionMovement counts subscriptions started and ended within one
+// bucket, from their first_subscribe, cancel and expired events.
+type SubscriptionMovement struct {
+	BucketStart int64
+	New         int
+	Cancelled   int
+	Expired     int
+}
+
+// Churned is the number of subscriptions that ended, either way.
+func (m *SubscriptionMovement) Churned() int {
+	return m.Cancelled + m.Expired
+}
+
+// RenewalOutcomes counts renewal charges by status. A renewal keeps one
+// charge per period across retries, so the counts are periods.
+type RenewalOutcomes struct {
+	Completed int
+	Failed    int
+	Pending   int
+}
+
+// SuccessRate is the share of settled renewals that completed, or 0 when none
+// have settled.
+func (o RenewalOutcomes) SuccessRate() float64 {
+	settled := o.Completed + o.Failed
+	if settled == 0 {
+		return 0
+	}
+	return float64(o.Completed) / float64(settled)
+}
@@ -6,6 +6,9 @@ const (
 	AuthorizationPending   AuthorizationStatus = "pending"
 	AuthorizationCompleted AuthorizationStatus = "completed"
 	AuthorizationFailed    AuthorizationStatus = "failed"
+	// AuthorizationRevoked: the payer's cancelAuthorization permit confirmed on
+	// chain, so the vault can no longer charge this authorization.
+	AuthorizationRevoked AuthorizationStatus = "revoked"
 )
 
 type Authorization struct {
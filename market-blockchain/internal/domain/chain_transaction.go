@@ -0,0 +1,53 @@
+package domain
+
+type ChainTransactionKind string
+
+const (
+	ChainTxPermit        ChainTransactionKind = "permit"
+	ChainTxFirstCharge   ChainTransactionKind = "first_charge"
+	ChainTxRenewalCharge ChainTransactionKind = "renewal_charge"
+	ChainTxUpgradeCharge ChainTransactionKind = "upgrade_charge"
+	ChainTxRevocation    ChainTransactionKind = "revocation"
+)
+
+type ChainTransactionStatus string
+
+const (
+	// ChainTxPending is broadcast but has no receipt on the canonical chain.
+	ChainTxPending ChainTransactionStatus = "pending"
+	// ChainTxMined has a receipt but not yet enough confirmations.
+	ChainTxMined     ChainTransactionStatus = "mined"
+	ChainTxConfirmed ChainTransactionStatus = "confirmed"
+	ChainTxFailed    ChainTransactionStatus = "failed"
+	// ChainTxDropped stayed pending past the tracker's deadline and was given
+	// up on.
+	ChainTxDropped ChainTransactionStatus = "dropped"
+)
+
+// ChainTransaction tracks a relayer transaction by the hash it was first
+// broadcast under. MinedTxHash is the hash that was actually mined, which
+// differs when the relayer replaced a stuck transaction with a fee bump.
+type ChainTransaction struct {
+	TxHash          string
+	Kind            ChainTransactionKind
+	SubscriptionID  string
+	AuthorizationID string
+	ChargeRecordID  string
+	Status          ChainTransactionStatus
+	MinedTxHash     string
+	BlockNumber     int64
+	BlockHash       string
+	Error           string
+	CreatedAt       int64
+	UpdatedAt       int64
+}
+
+// SettledTxHash returns the mined hash when there is one and the broadcast
+// hash otherwise. Local records should point at it, since only the mined
+// transaction can be found on chain.
+func (t *ChainTransaction) SettledTxHash() string {
+	if t.MinedTxHash != "" {
+		return t.MinedTxHash
+	}
+	return t.TxHash
+}
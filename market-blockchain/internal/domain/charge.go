@@ -8,6 +8,20 @@ const (
 	ChargeFailed    ChargeStatus = "failed"
 )
 
+// ChargeIDEncoding is how a charge ID is turned into the bytes32 key the vault
+// deduplicates charges by. A charge keeps its encoding for life, so retries
+// and reconciliation look up the key it was first submitted under.
+type ChargeIDEncoding string
+
+const (
+	// ChargeIDKeccak256 keys a charge by the keccak256 of its ID. New charges
+	// use it.
+	ChargeIDKeccak256 ChargeIDEncoding = "keccak256"
+	// ChargeIDRaw keys a charge by the bytes of its ID, truncated or
+	// zero-padded to 32. Charges created before keccak256 keep it.
+	ChargeIDRaw ChargeIDEncoding = "raw"
+)
+
 type Charge struct {
 	ID              string
 	ChargeID        string
@@ -22,4 +36,15 @@ type Charge struct {
 	Reason          string
 	CreatedAt       int64
 	UpdatedAt       int64
+	// ChargeIDEncoding is empty until the charge is stored, which means
+	// keccak256.
+	ChargeIDEncoding ChargeIDEncoding
+}
+
+// IDEncoding returns the charge's encoding, defaulting to keccak256.
+func (c *Charge) IDEncoding() ChargeIDEncoding {
+	if c.ChargeIDEncoding == "" {
+		return ChargeIDKeccak256
+	}
+	return c.ChargeIDEncoding
 }
@@ -0,0 +1,33 @@
+package domain
+
+type DiscrepancyType string
+
+const (
+	// DiscrepancyAllowanceMismatch: the vault's authorizedAllowance differs from
+	// the authorization's RemainingAllowance.
+	DiscrepancyAllowanceMismatch DiscrepancyType = "allowance_mismatch"
+	// DiscrepancyPayerMismatch: the payer bound to the identity on chain differs
+	// from the authorization's payer.
+	DiscrepancyPayerMismatch DiscrepancyType = "payer_mismatch"
+	// DiscrepancyChargeMissingOnChain: a charge completed locally was never
+	// executed by the vault.
+	DiscrepancyChargeMissingOnChain DiscrepancyType = "charge_missing_on_chain"
+	// DiscrepancyChargeUnrecorded: the vault executed a charge that is marked
+	// failed locally.
+	DiscrepancyChargeUnrecorded DiscrepancyType = "charge_unrecorded"
+)
+
+type Discrepancy struct {
+	ID              string
+	RunID           string
+	Type            DiscrepancyType
+	SubscriptionID  string
+	AuthorizationID string
+	ChargeRecordID  string
+	IdentityAddress string
+	PayerAddress    string
+	LocalValue      string
+	ChainValue      string
+	Corrected       bool
+	CreatedAt       int64
+}
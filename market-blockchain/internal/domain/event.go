@@ -12,6 +12,29 @@ const (
 	EventUpgrade        EventType = "upgrade"
 	EventDowngrade      EventType = "downgrade"
 	EventRenew          EventType = "renew"
+	// EventAuthorizationRevoked records the confirmed cancelAuthorization tx
+	// that zeroed the vault's authorized allowance.
+	EventAuthorizationRevoked EventType = "authorization_revoked"
+	// EventQuotaExceeded records a subscription using up its plan's traffic
+	// quota for the period, and whether access was suspended.
+	EventQuotaExceeded EventType = "quota_exceeded"
+	// EventCredentialRotated records a subscription's Xray credential being
+	// replaced; the old one stops working once the nodes are synced.
+	EventCredentialRotated EventType = "credential_rotated"
+	// EventPastDue records a failed renewal attempt of a subscription in its
+	// grace period, with the reason and when the renewal is retried.
+	EventPastDue EventType = "past_due"
+	// EventUpgradeCredit records a confirmed upgrade charge that could not be
+	// applied because the subscription was no longer active in the period it
+	// was charged for; the amount is owed to the payer.
+	EventUpgradeCredit EventType = "upgrade_credit"
+	// EventRenewalCredit records a renewal charge confirmed after the
+	// subscription was cancelled or expired; the amount is owed to the payer.
+	EventRenewalCredit EventType = "renewal_credit"
+	// EventXraySyncFailed records an Xray sync that failed after a lifecycle
+	// state change and was left to the retry worker. It is internal and not
+	// delivered to webhooks.
+	EventXraySyncFailed EventType = "xray_sync_failed"
 )
 
 type Event struct {
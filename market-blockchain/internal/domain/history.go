@@ -0,0 +1,16 @@
+package domain
+
+// HistoryFilter selects one page of an identity's records, newest first.
+type HistoryFilter struct {
+	// Status matches the record's status, or the type of events; empty
+	// matches all.
+	Status string
+	// From and To bound created_at to [From, To); 0 leaves that side open.
+	From int64
+	To   int64
+	// BeforeCreatedAt and BeforeID are the last record of the previous page;
+	// the page starts right after it. An empty BeforeID starts at the newest.
+	BeforeCreatedAt int64
+	BeforeID        string
+	Limit           int
+}
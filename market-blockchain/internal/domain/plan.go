@@ -1,5 +1,25 @@
 package domain
 
+type OverQuotaPolicy string
+
+const (
+	// OverQuotaSuspend removes the user from Xray until the next period.
+	OverQuotaSuspend OverQuotaPolicy = "suspend"
+	// OverQuotaWarn keeps access and only records the quota event.
+	OverQuotaWarn OverQuotaPolicy = "warn"
+)
+
+type GraceAccessPolicy string
+
+const (
+	// GraceAccessKeep keeps Xray access while a past due subscription is in
+	// its grace period.
+	GraceAccessKeep GraceAccessPolicy = "keep"
+	// GraceAccessSuspend removes the user from Xray until the renewal
+	// succeeds.
+	GraceAccessSuspend GraceAccessPolicy = "suspend"
+)
+
 type Plan struct {
 	PlanID                   string
 	Name                     string
@@ -9,7 +29,17 @@ type Plan struct {
 	AmountUSDCDisplay        string
 	AuthorizationPeriods     int32
 	TotalAuthorizationAmount int64
-	Active                   bool
-	CreatedAt                int64
-	UpdatedAt                int64
+	// TrafficQuotaBytes caps uplink plus downlink per billing period; zero
+	// means unlimited.
+	TrafficQuotaBytes int64
+	OverQuotaPolicy   OverQuotaPolicy
+	GraceAccess       GraceAccessPolicy
+	Active            bool
+	CreatedAt         int64
+	UpdatedAt         int64
+}
+
+// QuotaExceeded reports whether periodTraffic has reached the plan's quota.
+func (p *Plan) QuotaExceeded(periodTraffic int64) bool {
+	return p.TrafficQuotaBytes > 0 && periodTraffic >= p.TrafficQuotaBytes
 }
@@ -0,0 +1,34 @@
+package domain
+
+type RelayerTxStatus string
+
+const (
+	// RelayerTxPending is the latest broadcast for its nonce.
+	RelayerTxPending RelayerTxStatus = "pending"
+	// RelayerTxReplaced was superseded by a fee-bumped broadcast of the same
+	// nonce.
+	RelayerTxReplaced RelayerTxStatus = "replaced"
+	RelayerTxMined    RelayerTxStatus = "mined"
+	// RelayerTxDropped lost its nonce to a transaction this service did not
+	// send.
+	RelayerTxDropped RelayerTxStatus = "dropped"
+	// RelayerTxRejected was refused by the node and never held its nonce.
+	RelayerTxRejected RelayerTxStatus = "rejected"
+)
+
+// RelayerTransaction is one signed broadcast from the relayer key. Fee bumps
+// add a row with the same nonce and OriginalTxHash, which stays the hash the
+// caller was given and tracks the transaction in chain_transactions.
+type RelayerTransaction struct {
+	TxHash         string
+	OriginalTxHash string
+	FromAddress    string
+	Nonce          int64
+	GasTipCap      string
+	GasFeeCap      string
+	RawTx          string
+	Status         RelayerTxStatus
+	Error          string
+	CreatedAt      int64
+	UpdatedAt      int64
+}
@@ -12,6 +12,7 @@ type SubscriptionSource string
 const (
 	SubscriptionPending   SubscriptionStatus = "pending"
 	SubscriptionActive    SubscriptionStatus = "active"
+	SubscriptionPastDue   SubscriptionStatus = "past_due"
 	SubscriptionExpired   SubscriptionStatus = "expired"
 	SubscriptionCancelled SubscriptionStatus = "cancelled"
 )
@@ -23,6 +24,23 @@ const (
 	SubscriptionSourceDowngrade      SubscriptionSource = "downgrade"
 )
 
+// RenewalFailureReason classifies why a renewal attempt failed.
+type RenewalFailureReason string
+
+const (
+	RenewalFailureInsufficientAllowance RenewalFailureReason = "insufficient_allowance"
+	RenewalFailureAuthorizationInvalid  RenewalFailureReason = "authorization_invalid"
+	RenewalFailurePlanUnavailable       RenewalFailureReason = "plan_unavailable"
+	RenewalFailureChainUnavailable      RenewalFailureReason = "chain_unavailable"
+	// RenewalFailureChargeRejected means the charge could not be submitted.
+	RenewalFailureChargeRejected RenewalFailureReason = "charge_rejected"
+	// RenewalFailureChargeReverted means the charge was mined but reverted.
+	RenewalFailureChargeReverted RenewalFailureReason = "charge_reverted"
+	// RenewalFailureChargeDropped means the charge was broadcast but never
+	// mined.
+	RenewalFailureChargeDropped RenewalFailureReason = "charge_dropped"
+)
+
 var ErrInvalidSubscriptionTransition = errors.New("invalid subscription transition")
 
 type Subscription struct {
@@ -43,8 +61,30 @@ type Subscription struct {
 	Uplink                 int64
 	Downlink               int64
 	TotalTraffic           int64
-	CreatedAt              int64
-	UpdatedAt              int64
+	// PeriodTraffic is the usage since CurrentPeriodStart, checked against
+	// the plan's quota.
+	PeriodTraffic int64
+	// QuotaExceededAt is when the quota was crossed this period, zero if not.
+	QuotaExceededAt int64
+	// TrafficSuspended subscriptions stay active but have no Xray access
+	// until the next period starts.
+	TrafficSuspended bool
+	// XrayUUID is the VLESS credential the subscription is provisioned with.
+	// It is a secret, so it is never encoded with the rest of the record.
+	XrayUUID string `json:"-"`
+	// PastDueAt is when the first renewal attempt of the period failed and
+	// GraceEndsAt when the subscription expires if none succeeds; both are
+	// zero while the subscription is in good standing.
+	PastDueAt   int64
+	GraceEndsAt int64
+	// RenewalAttempts counts the failed renewal attempts since PastDueAt,
+	// LastRenewalFailure is the reason of the latest one and
+	// NextRenewalAttemptAt is when the renewal is retried.
+	RenewalAttempts      int
+	LastRenewalFailure   RenewalFailureReason
+	NextRenewalAttemptAt int64
+	CreatedAt            int64
+	UpdatedAt            int64
 }
 
 func (s *Subscription) Activate(now int64) error {
@@ -58,7 +98,7 @@ func (s *Subscription) Activate(now int64) error {
 }
 
 func (s *Subscription) Cancel(now int64) error {
-	if s.Status != SubscriptionActive {
+	if s.Status != SubscriptionActive && s.Status != SubscriptionPastDue {
 		return invalidSubscriptionTransition(s.Status, SubscriptionCancelled)
 	}
 
@@ -69,7 +109,7 @@ func (s *Subscription) Cancel(now int64) error {
 }
 
 func (s *Subscription) Expire(now int64) error {
-	if s.Status != SubscriptionActive {
+	if s.Status != SubscriptionActive && s.Status != SubscriptionPastDue {
 		return invalidSubscriptionTransition(s.Status, SubscriptionExpired)
 	}
 
@@ -78,6 +118,72 @@ func (s *Subscription) Expire(now int64) error {
 	return nil
 }
 
+// FailRenewal records a failed renewal attempt. The first failure moves an
+// active subscription to past due with a grace period ending at graceEndsAt;
+// later ones keep the original grace period.
+func (s *Subscription) FailRenewal(reason RenewalFailureReason, graceEndsAt, now int64) error {
+	switch s.Status {
+	case SubscriptionActive:
+		s.Status = SubscriptionPastDue
+		s.PastDueAt = now
+		s.GraceEndsAt = graceEndsAt
+		s.RenewalAttempts = 0
+	case SubscriptionPastDue:
+	default:
+		return invalidSubscriptionTransition(s.Status, SubscriptionPastDue)
+	}
+
+	s.RenewalAttempts++
+	s.LastRenewalFailure = reason
+	s.UpdatedAt = now
+	return nil
+}
+
+// GraceExpired reports whether a past due subscription has run out of time
+// to renew.
+func (s *Subscription) GraceExpired(now int64) bool {
+	return s.Status == SubscriptionPastDue && now >= s.GraceEndsAt
+}
+
+// Recover returns a past due subscription to active once a renewal succeeds
+// and clears its dunning state. It is a no-op for active subscriptions.
+func (s *Subscription) Recover(now int64) error {
+	if s.Status != SubscriptionActive && s.Status != SubscriptionPastDue {
+		return invalidSubscriptionTransition(s.Status, SubscriptionActive)
+	}
+
+	s.Status = SubscriptionActive
+	s.PastDueAt = 0
+	s.GraceEndsAt = 0
+	s.RenewalAttempts = 0
+	s.LastRenewalFailure = ""
+	s.NextRenewalAttemptAt = 0
+	s.UpdatedAt = now
+	return nil
+}
+
+// ExceedQuota records that the subscription used up its plan's traffic quota
+// for the current period. Under a suspending policy it also loses Xray
+// access until the next period.
+func (s *Subscription) ExceedQuota(policy OverQuotaPolicy, now int64) error {
+	if s.Status != SubscriptionActive && s.Status != SubscriptionPastDue {
+		return fmt.Errorf("%w: quota can only be exceeded by an active or past due subscription, got %s", ErrInvalidSubscriptionTransition, s.Status)
+	}
+
+	s.QuotaExceededAt = now
+	s.TrafficSuspended = policy != OverQuotaWarn
+	s.UpdatedAt = now
+	return nil
+}
+
+// StartPeriodUsage clears the per-period usage and any quota suspension when
+// a new billing period begins.
+func (s *Subscription) StartPeriodUsage() {
+	s.PeriodTraffic = 0
+	s.QuotaExceededAt = 0
+	s.TrafficSuspended = false
+}
+
 func invalidSubscriptionTransition(current, next SubscriptionStatus) error {
 	return fmt.Errorf("%w: %s -> %s", ErrInvalidSubscriptionTransition, current, next)
 }
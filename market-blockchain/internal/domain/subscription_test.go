@@ -172,3 +172,99 @@ func TestSubscriptionExpire(t *testing.T) {
 		}
 	})
 }
+
+func TestSubscriptionExceedQuota(t *testing.T) {
+	t.Run("suspend policy suspends traffic", func(t *testing.T) {
+		subscription := &Subscription{Status: SubscriptionActive, UpdatedAt: 10}
+
+		if err := subscription.ExceedQuota(OverQuotaSuspend, 100); err != nil {
+			t.Fatalf("ExceedQuota returned error: %v", err)
+		}
+		if subscription.QuotaExceededAt != 100 || !subscription.TrafficSuspended {
+			t.Fatalf("expected suspension at 100, got exceeded at %d suspended %v", subscription.QuotaExceededAt, subscription.TrafficSuspended)
+		}
+		if subscription.Status != SubscriptionActive {
+			t.Fatalf("expected status to stay active, got %s", subscription.Status)
+		}
+		if subscription.UpdatedAt != 100 {
+			t.Fatalf("expected UpdatedAt 100, got %d", subscription.UpdatedAt)
+		}
+
+		subscription.StartPeriodUsage()
+		if subscription.QuotaExceededAt != 0 || subscription.TrafficSuspended || subscription.PeriodTraffic != 0 {
+			t.Fatalf("expected period usage to be cleared, got %+v", subscription)
+		}
+	})
+
+	t.Run("warn policy keeps traffic", func(t *testing.T) {
+		subscription := &Subscription{Status: SubscriptionActive}
+
+		if err := subscription.ExceedQuota(OverQuotaWarn, 100); err != nil {
+			t.Fatalf("ExceedQuota returned error: %v", err)
+		}
+		if subscription.QuotaExceededAt != 100 || subscription.TrafficSuspended {
+			t.Fatalf("expected quota recorded without suspension, got exceeded at %d suspended %v", subscription.QuotaExceededAt, subscription.TrafficSuspended)
+		}
+	})
+
+	t.Run("cancelled rejected", func(t *testing.T) {
+		subscription := &Subscription{Status: SubscriptionCancelled, UpdatedAt: 10}
+
+		err := subscription.ExceedQuota(OverQuotaSuspend, 100)
+		if !errors.Is(err, ErrInvalidSubscriptionTransition) {
+			t.Fatalf("expected ErrInvalidSubscriptionTransition, got %v", err)
+		}
+		if subscription.QuotaExceededAt != 0 || subscription.UpdatedAt != 10 {
+			t.Fatalf("subscription changed unexpectedly: %+v", subscription)
+		}
+	})
+}
+
+func TestSubscriptionFailRenewal(t *testing.T) {
+	t.Run("first failure starts the grace period", func(t *testing.T) {
+		subscription := &Subscription{Status: SubscriptionActive, UpdatedAt: 10}
+
+		if err := subscription.FailRenewal(RenewalFailureInsufficientAllowance, 1000, 100); err != nil {
+			t.Fatalf("FailRenewal returned error: %v", err)
+		}
+		if subscription.Status != SubscriptionPastDue || subscription.PastDueAt != 100 || subscription.GraceEndsAt != 1000 {
+			t.Fatalf("expected past due from 100 until 1000, got %+v", subscription)
+		}
+		if subscription.RenewalAttempts != 1 || subscription.LastRenewalFailure != RenewalFailureInsufficientAllowance {
+			t.Fatalf("expected one recorded attempt, got %d %s", subscription.RenewalAttempts, subscription.LastRenewalFailure)
+		}
+	})
+
+	t.Run("later failures keep the grace period", func(t *testing.T) {
+		subscription := &Subscription{Status: SubscriptionPastDue, PastDueAt: 100, GraceEndsAt: 1000, RenewalAttempts: 1}
+
+		if err := subscription.FailRenewal(RenewalFailureChargeReverted, 5000, 500); err != nil {
+			t.Fatalf("FailRenewal returned error: %v", err)
+		}
+		if subscription.GraceEndsAt != 1000 || subscription.RenewalAttempts != 2 || subscription.LastRenewalFailure != RenewalFailureChargeReverted {
+			t.Fatalf("unexpected dunning state: %+v", subscription)
+		}
+		if subscription.GraceExpired(999) || !subscription.GraceExpired(1000) {
+			t.Fatal("expected the grace period to end at GraceEndsAt")
+		}
+	})
+
+	t.Run("cancelled subscription rejected", func(t *testing.T) {
+		subscription := &Subscription{Status: SubscriptionCancelled}
+
+		if err := subscription.FailRenewal(RenewalFailureChargeRejected, 1000, 100); !errors.Is(err, ErrInvalidSubscriptionTransition) {
+			t.Fatalf("expected ErrInvalidSubscriptionTransition, got %v", err)
+		}
+	})
+
+	t.Run("recovery clears the dunning state", func(t *testing.T) {
+		subscription := &Subscription{Status: SubscriptionPastDue, PastDueAt: 100, GraceEndsAt: 1000, RenewalAttempts: 2, LastRenewalFailure: RenewalFailureChargeReverted, NextRenewalAttemptAt: 700}
+
+		if err := subscription.Recover(800); err != nil {
+			t.Fatalf("Recover returned error: %v", err)
+		}
+		if subscription.Status != SubscriptionActive || subscription.PastDueAt != 0 || subscription.GraceEndsAt != 0 || subscription.RenewalAttempts != 0 || subscription.LastRenewalFailure != "" || subscription.NextRenewalAttemptAt != 0 {
+			t.Fatalf("expected an active subscription in good standing, got %+v", subscription)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package domain
+
+import "time"
+
+type TrafficGranularity string
+
+const (
+	TrafficHourly TrafficGranularity = "hour"
+	TrafficDaily  TrafficGranularity = "day"
+)
+
+// Duration is the length of one bucket.
+func (g TrafficGranularity) Duration() time.Duration {
+	if g == TrafficDaily {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// BucketStart truncates a millisecond timestamp to the start of its UTC
+// bucket.
+func (g TrafficGranularity) BucketStart(ts int64) int64 {
+	size := g.Duration().Milliseconds()
+	return ts - ts%size
+}
+
+// TrafficSample is the usage of one subscription on one node within a bucket.
+// Every delta is added to both its hourly and its daily bucket, so daily totals
+// survive after hourly samples are pruned.
+type TrafficSample struct {
+	SubscriptionID  string
+	IdentityAddress string
+	PlanID          string
+	NodeID          string
+	Granularity     TrafficGranularity
+	BucketStart     int64
+	Uplink          int64
+	Downlink        int64
+	UpdatedAt       int64
+}
+
+// TrafficUsage is an aggregate of samples over one bucket. PlanID and NodeID
+// are only set when the aggregate is grouped by them.
+type TrafficUsage struct {
+	BucketStart int64
+	PlanID      string
+	NodeID      string
+	Uplink      int64
+	Downlink    int64
+}
@@ -0,0 +1,37 @@
+package domain
+
+type VaultEventName string
+
+const (
+	VaultEventIdentityBound    VaultEventName = "IdentityBound"
+	VaultEventChargeAuthorized VaultEventName = "ChargeAuthorized"
+	VaultEventIdentityCharged  VaultEventName = "IdentityCharged"
+)
+
+// VaultEvent is a log emitted by the VPNCreditVault contract. Fields that do
+// not apply to the event are left zero: ChargeID and Amount are only set for
+// IdentityCharged, the allowances only for ChargeAuthorized. Amounts are
+// uint256 on chain and kept as decimal strings, since a payer can approve
+// far more than fits in an int64.
+type VaultEvent struct {
+	TxHash            string
+	LogIndex          int64
+	BlockNumber       int64
+	BlockHash         string
+	Name              VaultEventName
+	PayerAddress      string
+	IdentityAddress   string
+	ChargeID          string
+	Amount            string
+	ExpectedAllowance string
+	TargetAllowance   string
+	CreatedAt         int64
+}
+
+// ChainCursor records the last block a background chain reader fully
+// processed.
+type ChainCursor struct {
+	Name        string
+	BlockNumber int64
+	UpdatedAt   int64
+}
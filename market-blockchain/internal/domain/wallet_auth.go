@@ -0,0 +1,19 @@
+package domain
+
+// AuthNonce is a single-use sign-in challenge handed to a wallet before it
+// signs an EIP-4361 message.
+type AuthNonce struct {
+	Nonce      string
+	ExpiresAt  int64
+	ConsumedAt int64
+	CreatedAt  int64
+}
+
+// WalletSession is a short-lived API session for a wallet that proved
+// control of Address. Only the SHA-256 of the bearer token is stored.
+type WalletSession struct {
+	TokenHash string
+	Address   string
+	ExpiresAt int64
+	CreatedAt int64
+}
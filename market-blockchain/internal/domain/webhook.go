@@ -0,0 +1,121 @@
+package domain
+
+import "encoding/json"
+
+// WebhookEventTypes are the event types delivered to webhook endpoints: the
+// ones written together with a subscription state change.
+var WebhookEventTypes = []EventType{
+	EventFirstSubscribe,
+	EventChargeSuccess,
+	EventChargeFailed,
+	EventRenew,
+	EventUpgrade,
+	EventUpgradeCredit,
+	EventRenewalCredit,
+	EventDowngrade,
+	EventPastDue,
+	EventQuotaExceeded,
+	EventCredentialRotated,
+	EventCancel,
+	EventExpired,
+	EventAuthorizationRevoked,
+}
+
+// IsWebhookEventType reports whether endpoints can subscribe to eventType.
+func IsWebhookEventType(eventType EventType) bool {
+	for _, t := range WebhookEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEndpoint is a receiver of signed event deliveries.
+type WebhookEndpoint struct {
+	ID  string
+	URL string
+	// Secret signs every delivery; it is only shown when the endpoint is
+	// created.
+	Secret      string
+	Description string
+	// EventTypes filters the events delivered; empty means all of them.
+	EventTypes []EventType
+	// Inactive endpoints receive no new deliveries.
+	Active    bool
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	// WebhookDeliveryFailed gave up after the maximum number of attempts, or
+	// its endpoint was deactivated; it can still be replayed.
+	WebhookDeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event sent to one endpoint, and the log of its
+// attempts. The payload is fixed when the event is written, so retries and
+// replays send the same body.
+type WebhookDelivery struct {
+	ID         string
+	EndpointID string
+	EventID    string
+	EventType  EventType
+	Payload    string
+	Status     WebhookDeliveryStatus
+	Attempts   int
+	// NextAttemptAt is when a pending delivery is tried next.
+	NextAttemptAt int64
+	// LastStatusCode is the HTTP status of the last attempt, 0 when no
+	// response was received.
+	LastStatusCode int
+	LastError      string
+	DeliveredAt    int64
+	// ReplayOf is the delivery this one was replayed from.
+	ReplayOf  string
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+// WebhookPayload is the JSON body of a delivery.
+type WebhookPayload struct {
+	// ID is the event ID; receivers use it to drop duplicate deliveries.
+	ID        string             `json:"id"`
+	Type      EventType          `json:"type"`
+	CreatedAt int64              `json:"created_at"`
+	Data      WebhookPayloadData `json:"data"`
+}
+
+type WebhookPayloadData struct {
+	IdentityAddress string `json:"identity_address"`
+	PayerAddress    string `json:"payer_address,omitempty"`
+	PlanID          string `json:"plan_id,omitempty"`
+	ChargeID        string `json:"charge_id,omitempty"`
+	Description     string `json:"description"`
+	// Metadata is the event's metadata object, passed through as is.
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+// NewWebhookPayload describes event for webhook receivers.
+func NewWebhookPayload(event *Event) *WebhookPayload {
+	payload := &WebhookPayload{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data: WebhookPayloadData{
+			IdentityAddress: event.IdentityAddress,
+			PayerAddress:    event.PayerAddress,
+			PlanID:          event.PlanID,
+			ChargeID:        event.ChargeID,
+			Description:     event.Description,
+		},
+	}
+	if json.Valid([]byte(event.Metadata)) {
+		payload.Data.Metadata = json.RawMessage(event.Metadata)
+	}
+	return payload
+}
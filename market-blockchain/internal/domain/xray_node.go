@@ -0,0 +1,127 @@
+package domain
+
+import "fmt"
+
+// XrayNode is an Xray server whose gRPC API this service provisions users on.
+type XrayNode struct {
+	ID         string
+	Name       string
+	APIAddress string
+	InboundTag string
+	// Disabled nodes stay registered but receive no user changes.
+	Enabled bool
+	// Endpoint is how clients reach the node's VLESS inbound.
+	Endpoint  XrayNodeEndpoint
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+type XrayTransport string
+
+const (
+	XrayTransportTCP  XrayTransport = "tcp"
+	XrayTransportWS   XrayTransport = "ws"
+	XrayTransportGRPC XrayTransport = "grpc"
+)
+
+type XraySecurity string
+
+const (
+	XraySecurityNone    XraySecurity = "none"
+	XraySecurityTLS     XraySecurity = "tls"
+	XraySecurityReality XraySecurity = "reality"
+)
+
+// XrayNodeEndpoint is the public side of a node's inbound that client configs
+// are built from. A node without a Host is not offered to clients.
+type XrayNodeEndpoint struct {
+	Host      string
+	Port      int
+	Transport XrayTransport
+	Security  XraySecurity
+	// Path is the WebSocket path or the gRPC service name.
+	Path string
+	// ServerName is the TLS or REALITY SNI; Host is used when empty.
+	ServerName  string
+	Fingerprint string
+	Flow        string
+	// RealityPublicKey and RealityShortID are required with REALITY.
+	RealityPublicKey string
+	RealityShortID   string
+}
+
+// DefaultXrayNodeEndpoint is the endpoint of a node registered without one,
+// matching the column defaults: TLS over TCP on port 443, with no host yet.
+func DefaultXrayNodeEndpoint() XrayNodeEndpoint {
+	return XrayNodeEndpoint{Port: 443, Transport: XrayTransportTCP, Security: XraySecurityTLS}
+}
+
+// Validate checks that the endpoint can be turned into a client config.
+func (e XrayNodeEndpoint) Validate() error {
+	if e.Host == "" {
+		return nil
+	}
+	if e.Port < 1 || e.Port > 65535 {
+		return fmt.Errorf("invalid public port %d", e.Port)
+	}
+	switch e.Transport {
+	case XrayTransportTCP, XrayTransportWS, XrayTransportGRPC:
+	default:
+		return fmt.Errorf("unsupported transport %q", e.Transport)
+	}
+	switch e.Security {
+	case XraySecurityNone, XraySecurityTLS:
+	case XraySecurityReality:
+		if e.RealityPublicKey == "" {
+			return fmt.Errorf("reality requires a public key")
+		}
+	default:
+		return fmt.Errorf("unsupported security %q", e.Security)
+	}
+	return nil
+}
+
+// SNI is the server name clients present during the handshake.
+func (e XrayNodeEndpoint) SNI() string {
+	if e.ServerName != "" {
+		return e.ServerName
+	}
+	return e.Host
+}
+
+type XrayNodeHealth string
+
+const (
+	// XrayNodeHealthUnknown is a node that has not been checked yet.
+	XrayNodeHealthUnknown  XrayNodeHealth = "unknown"
+	XrayNodeHealthy        XrayNodeHealth = "healthy"
+	XrayNodeUnhealthy      XrayNodeHealth = "unhealthy"
+	XrayNodeHealthDisabled XrayNodeHealth = "disabled"
+)
+
+type XraySyncAction string
+
+const (
+	XraySyncAddUser    XraySyncAction = "add_user"
+	XraySyncRemoveUser XraySyncAction = "remove_user"
+	// XraySyncRotateUser replaces the user's credential: Xray keeps an
+	// existing user as is on add, so it is removed and added again.
+	XraySyncRotateUser XraySyncAction = "rotate_user"
+)
+
+type XraySyncStatus string
+
+const (
+	XraySyncSucceeded XraySyncStatus = "succeeded"
+	XraySyncFailed    XraySyncStatus = "failed"
+)
+
+// XrayNodeSync is the latest user change sent to a node for an identity.
+type XrayNodeSync struct {
+	NodeID          string
+	IdentityAddress string
+	Action          XraySyncAction
+	Status          XraySyncStatus
+	Error           string
+	UpdatedAt       int64
+}
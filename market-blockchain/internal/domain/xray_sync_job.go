@@ -0,0 +1,32 @@
+package domain
+
+type XraySyncJobStatus string
+
+const (
+	XraySyncJobPending   XraySyncJobStatus = "pending"
+	XraySyncJobSucceeded XraySyncJobStatus = "succeeded"
+	// XraySyncJobFailed gave up after the maximum number of attempts; the
+	// drift reconciler still repairs the user afterwards.
+	XraySyncJobFailed XraySyncJobStatus = "failed"
+	// XraySyncJobSuperseded was replaced by a newer change for the same
+	// identity before it was delivered.
+	XraySyncJobSuperseded XraySyncJobStatus = "superseded"
+)
+
+// XraySyncJob is an outbox row for a user change that a subscription state
+// change requires on the Xray fleet.
+type XraySyncJob struct {
+	ID              string
+	SubscriptionID  string
+	IdentityAddress string
+	Action          XraySyncAction
+	// UUID is the credential to provision; empty for removals.
+	UUID            string
+	LifecycleAction string
+	Status          XraySyncJobStatus
+	Attempts        int
+	NextAttemptAt   int64
+	LastError       string
+	CreatedAt       int64
+	UpdatedAt       int64
+}
@@ -0,0 +1,12 @@
+package domain
+
+// XrayTrafficCounter is the last raw traffic counter read for a user on one
+// Xray node. Counters only grow until the node restarts, so a smaller reading
+// means the counter was reset.
+type XrayTrafficCounter struct {
+	NodeID          string
+	IdentityAddress string
+	Uplink          int64
+	Downlink        int64
+	UpdatedAt       int64
+}
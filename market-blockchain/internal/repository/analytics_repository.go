@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+// AnalyticsRepository aggregates charges, events and subscriptions for the
+// admin dashboard. All ranges are [from, to) in unix millis and buckets are
+// aligned in UTC.
+type AnalyticsRepository interface {
+	// RevenueByBucket totals completed charges per bucket. Buckets without
+	// charges are left out.
+	RevenueByBucket(ctx context.Context, granularity domain.AnalyticsGranularity, from, to int64) ([]*domain.RevenueBucket, error)
+	// RevenueByPlan totals completed charges per plan, largest first.
+	RevenueByPlan(ctx context.Context, from, to int64) ([]*domain.PlanRevenue, error)
+	// SubscriptionMovements counts started and ended subscriptions per
+	// bucket. Buckets without any are left out.
+	SubscriptionMovements(ctx context.Context, granularity domain.AnalyticsGranularity, from, to int64) ([]*domain.SubscriptionMovement, error)
+	// RenewalOutcomes counts renewal charges, including downgrades taking
+	// effect, by status.
+	RenewalOutcomes(ctx context.Context, from, to int64) (*domain.RenewalOutcomes, error)
+	// MonthlyRecurringRevenue sums the price of every active subscription's
+	// plan normalized to 30 days.
+	MonthlyRecurringRevenue(ctx context.Context) (int64, error)
+}
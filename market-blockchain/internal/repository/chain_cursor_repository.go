@@ -0,0 +1,10 @@
+package repository
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+type ChainCursorRepository interface {
+	GetByName(ctx context.Context, name string) (*domain.ChainCursor, error)
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+type ChainTransactionRepository interface {
+	Create(tx *domain.ChainTransaction) error
+	Update(tx *domain.ChainTransaction) error
+	GetByHash(ctx context.Context, txHash string) (*domain.ChainTransaction, error)
+	ListUnfinalized(ctx context.Context) ([]*domain.ChainTransaction, error)
+}
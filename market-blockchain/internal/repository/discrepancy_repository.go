@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+type DiscrepancyRepository interface {
+	Create(discrepancy *domain.Discrepancy) error
+	List(ctx context.Context, discrepancyType string, limit, offset int) ([]*domain.Discrepancy, error)
+	Count(ctx context.Context, discrepancyType string) (int, error)
+}
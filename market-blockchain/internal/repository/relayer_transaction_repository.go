@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+type RelayerTransactionRepository interface {
+	Create(tx *domain.RelayerTransaction) error
+	Update(tx *domain.RelayerTransaction) error
+	// Replace marks replaced as superseded and stores replacement in one
+	// transaction.
+	Replace(ctx context.Context, replaced, replacement *domain.RelayerTransaction) error
+	GetByHash(ctx context.Context, txHash string) (*domain.RelayerTransaction, error)
+	ListByOriginalHash(ctx context.Context, originalTxHash string) ([]*domain.RelayerTransaction, error)
+	ListPending(ctx context.Context, fromAddress string) ([]*domain.RelayerTransaction, error)
+	// MaxNonce returns the highest nonce the address has broadcast, or -1.
+	MaxNonce(ctx context.Context, fromAddress string) (int64, error)
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+// TrafficSampleRepository queries and prunes traffic samples. Samples are
+// written by the store together with the counters they were computed from.
+type TrafficSampleRepository interface {
+	// SumByIdentity totals an identity's usage per bucket in [from, to).
+	SumByIdentity(ctx context.Context, identityAddress string, granularity domain.TrafficGranularity, from, to int64) ([]*domain.TrafficUsage, error)
+	// SumByPlanAndNode totals all usage per bucket, plan and node in [from, to).
+	SumByPlanAndNode(ctx context.Context, granularity domain.TrafficGranularity, from, to int64) ([]*domain.TrafficUsage, error)
+	// DeleteBefore removes samples of the granularity whose bucket starts
+	// before the cutoff and returns how many were removed.
+	DeleteBefore(ctx context.Context, granularity domain.TrafficGranularity, before int64) (int64, error)
+}
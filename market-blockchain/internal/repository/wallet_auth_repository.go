@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+type AuthNonceRepository interface {
+	Create(nonce *domain.AuthNonce) error
+	// Consume marks an unexpired, unused nonce as used and reports whether it
+	// was.
+	Consume(ctx context.Context, nonce string, now int64) (bool, error)
+}
+
+type WalletSessionRepository interface {
+	Create(session *domain.WalletSession) error
+	GetByTokenHash(ctx context.Context, tokenHash string) (*domain.WalletSession, error)
+	Delete(ctx context.Context, tokenHash string) error
+}
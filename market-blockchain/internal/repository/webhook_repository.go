@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+type WebhookEndpointRepository interface {
+	Create(endpoint *domain.WebhookEndpoint) error
+	Update(endpoint *domain.WebhookEndpoint) error
+	// Delete removes the endpoint together with its delivery log.
+	Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*domain.WebhookEndpoint, error)
+	ListAll(ctx context.Context) ([]*domain.WebhookEndpoint, error)
+}
+
+// WebhookDeliveryRepository reads and settles delivery rows. Rows for new
+// events are inserted by the store together with the event; Create is for
+// replays.
+type WebhookDeliveryRepository interface {
+	Create(delivery *domain.WebhookDelivery) error
+	// Update stores the outcome of a delivery attempt.
+	Update(delivery *domain.WebhookDelivery) error
+	GetByID(ctx context.Context, id string) (*domain.WebhookDelivery, error)
+	ListDue(ctx context.Context, now int64, limit int) ([]*domain.WebhookDelivery, error)
+	// ListByEndpoint returns the endpoint's deliveries newest first,
+	// optionally only those with status.
+	ListByEndpoint(ctx context.Context, endpointID string, status domain.WebhookDeliveryStatus, limit int) ([]*domain.WebhookDelivery, error)
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+type XrayNodeRepository interface {
+	Create(node *domain.XrayNode) error
+	Update(node *domain.XrayNode) error
+	Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*domain.XrayNode, error)
+	ListAll(ctx context.Context) ([]*domain.XrayNode, error)
+}
+
+type XrayNodeAssignmentRepository interface {
+	ListNodeIDs(ctx context.Context, identityAddress string) ([]string, error)
+	// Replace sets the nodes identityAddress is provisioned on. An empty list
+	// returns it to every enabled node.
+	Replace(ctx context.Context, identityAddress string, nodeIDs []string, now int64) error
+	// ListAll returns the assigned node IDs keyed by identity.
+	ListAll(ctx context.Context) (map[string][]string, error)
+}
+
+type XrayNodeSyncRepository interface {
+	Upsert(sync *domain.XrayNodeSync) error
+	ListByIdentity(ctx context.Context, identityAddress string) ([]*domain.XrayNodeSync, error)
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+// XraySyncOutboxRepository reads and settles outbox rows. Rows are inserted by
+// the store together with the state change that requires them.
+type XraySyncOutboxRepository interface {
+	// Update stores the outcome of a delivery attempt. It only touches rows
+	// that are still pending, so a job superseded meanwhile stays superseded.
+	Update(job *domain.XraySyncJob) error
+	ListDue(ctx context.Context, now int64, limit int) ([]*domain.XraySyncJob, error)
+}
@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+// XrayTrafficCounterRepository reads the last observed counters. They are
+// written by the store together with the usage they account for.
+type XrayTrafficCounterRepository interface {
+	ListAll(ctx context.Context) ([]*domain.XrayTrafficCounter, error)
+}
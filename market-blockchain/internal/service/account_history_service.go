@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"market-blockchain/internal/domain"
+)
+
+var ErrInvalidHistoryQuery = errors.New("invalid history query")
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// HistoryQuery selects one page of an identity's history. Cursor is the
+// NextCursor of the previous page.
+type HistoryQuery struct {
+	Status string
+	From   int64
+	To     int64
+	Cursor string
+	Limit  int
+}
+
+type accountHistorySubscriptions interface {
+	ListHistory(ctx context.Context, identityAddress string, filter domain.HistoryFilter) ([]*domain.Subscription, error)
+}
+
+type accountHistoryCharges interface {
+	ListHistory(ctx context.Context, identityAddress string, filter domain.HistoryFilter) ([]*domain.Charge, error)
+}
+
+type accountHistoryAuthorizations interface {
+	ListHistory(ctx context.Context, identityAddress string, filter domain.HistoryFilter) ([]*domain.Authorization, error)
+}
+
+type accountHistoryEvents interface {
+	ListHistory(ctx context.Context, identityAddress string, filter domain.HistoryFilter) ([]*domain.Event, error)
+}
+
+// SubscriptionHistory is one page of subscriptions; NextCursor is empty on
+// the last page. The other history pages work the same way.
+type SubscriptionHistory struct {
+	Subscriptions []*domain.Subscription
+	NextCursor    string
+}
+
+type ChargeHistory struct {
+	Charges    []*domain.Charge
+	NextCursor string
+}
+
+type AuthorizationHistory struct {
+	Authorizations []*domain.Authorization
+	NextCursor     string
+}
+
+type EventHistory struct {
+	Events     []*domain.Event
+	NextCursor string
+}
+
+// AccountHistoryService pages through an identity's subscriptions, charges,
+// authorizations and lifecycle events, newest first.
+type AccountHistoryService struct {
+	subscriptions  accountHistorySubscriptions
+	charges        accountHistoryCharges
+	authorizations accountHistoryAuthorizations
+	events         accountHistoryEvents
+	explorerURL    string
+}
+
+// NewAccountHistoryService takes the block explorer base URL transaction
+// links are built from; empty leaves them out.
+func NewAccountHistoryService(
+	subscriptions accountHistorySubscriptions,
+	charges accountHistoryCharges,
+	authorizations accountHistoryAuthorizations,
+	events accountHistoryEvents,
+	explorerURL string,
+) *AccountHistoryService {
+	return &AccountHistoryService{
+		subscriptions:  subscriptions,
+		charges:        charges,
+		authorizations: authorizations,
+		events:         events,
+		explorerURL:    strings.TrimRight(explorerURL, "/"),
+	}
+}
+
+// TxURL links a transaction on the block explorer, or returns "" without an
+// explorer or a hash.
+func (s *AccountHistoryService) TxURL(txHash string) string {
+	if s.explorerURL == "" || txHash == "" {
+		return ""
+	}
+	return s.explorerURL + "/tx/" + txHash
+}
+
+func (s *AccountHistoryService) Subscriptions(ctx context.Context, identityAddress string, query HistoryQuery) (*SubscriptionHistory, error) {
+	filter, err := historyFilter(&query, subscriptionStatuses)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions, err := s.subscriptions.ListHistory(ctx, identityAddress, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list subscription history: %w", err)
+	}
+
+	page := &SubscriptionHistory{Subscriptions: subscriptions}
+	if len(subscriptions) > query.Limit {
+		page.Subscriptions = subscriptions[:query.Limit]
+		last := page.Subscriptions[query.Limit-1]
+		page.NextCursor = encodeHistoryCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+func (s *AccountHistoryService) Charges(ctx context.Context, identityAddress string, query HistoryQuery) (*ChargeHistory, error) {
+	filter, err := historyFilter(&query, chargeStatuses)
+	if err != nil {
+		return nil, err
+	}
+	charges, err := s.charges.ListHistory(ctx, identityAddress, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list charge history: %w", err)
+	}
+
+	page := &ChargeHistory{Charges: charges}
+	if len(charges) > query.Limit {
+		page.Charges = charges[:query.Limit]
+		last := page.Charges[query.Limit-1]
+		page.NextCursor = encodeHistoryCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+func (s *AccountHistoryService) Authorizations(ctx context.Context, identityAddress string, query HistoryQuery) (*AuthorizationHistory, error) {
+	filter, err := historyFilter(&query, authorizationStatuses)
+	if err != nil {
+		return nil, err
+	}
+	authorizations, err := s.authorizations.ListHistory(ctx, identityAddress, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list authorization history: %w", err)
+	}
+
+	page := &AuthorizationHistory{Authorizations: authorizations}
+	if len(authorizations) > query.Limit {
+		page.Authorizations = authorizations[:query.Limit]
+		last := page.Authorizations[query.Limit-1]
+		page.NextCursor = encodeHistoryCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+// Events filters on the event type instead of a status.
+func (s *AccountHistoryService) Events(ctx context.Context, identityAddress string, query HistoryQuery) (*EventHistory, error) {
+	filter, err := historyFilter(&query, nil)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.events.ListHistory(ctx, identityAddress, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list event history: %w", err)
+	}
+
+	page := &EventHistory{Events: events}
+	if len(events) > query.Limit {
+		page.Events = events[:query.Limit]
+		last := page.Events[query.Limit-1]
+		page.NextCursor = encodeHistoryCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+var (
+	subscriptionStatuses = []string{
+		string(domain.SubscriptionPending), string(domain.SubscriptionActive), string(domain.SubscriptionPastDue),
+		string(domain.SubscriptionExpired), string(domain.SubscriptionCancelled),
+	}
+	chargeStatuses = []string{
+		string(domain.ChargePending), string(domain.ChargeCompleted), string(domain.ChargeFailed),
+	}
+	authorizationStatuses = []string{
+		string(domain.AuthorizationPending), string(domain.AuthorizationCompleted),
+		string(domain.AuthorizationFailed), string(domain.AuthorizationRevoked),
+	}
+)
+
+// historyFilter validates query, defaulting its limit in place, and turns it
+// into a filter that fetches one extra row to tell whether another page
+// follows. A nil statuses list accepts any status.
+func historyFilter(query *HistoryQuery, statuses []string) (domain.HistoryFilter, error) {
+	if query.Status != "" && statuses != nil && !slices.Contains(statuses, query.Status) {
+		return domain.HistoryFilter{}, fmt.Errorf("%w: status must be one of %s", ErrInvalidHistoryQuery, strings.Join(statuses, ", "))
+	}
+	if query.From < 0 || query.To < 0 || (query.To > 0 && query.From >= query.To) {
+		return domain.HistoryFilter{}, fmt.Errorf("%w: from must be before to", ErrInvalidHistoryQuery)
+	}
+	if query.Limit < 0 || query.Limit > maxHistoryLimit {
+		return domain.HistoryFilter{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidHistoryQuery, maxHistoryLimit)
+	}
+
+	if query.Limit == 0 {
+		query.Limit = defaultHistoryLimit
+	}
+
+	filter := domain.HistoryFilter{Status: query.Status, From: query.From, To: query.To, Limit: query.Limit + 1}
+	if query.Cursor != "" {
+		createdAt, id, err := decodeHistoryCursor(query.Cursor)
+		if err != nil {
+			return domain.HistoryFilter{}, err
+		}
+		filter.BeforeCreatedAt = createdAt
+		filter.BeforeID = id
+	}
+	return filter, nil
+}
+
+// The cursor is opaque to clients: the created_at and ID of the last record
+// returned.
+func encodeHistoryCursor(createdAt int64, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(createdAt, 10) + ":" + id))
+}
+
+func decodeHistoryCursor(cursor string) (int64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		createdAt, id, ok := strings.Cut(string(raw), ":")
+		if value, parseErr := strconv.ParseInt(createdAt, 10, 64); ok && parseErr == nil && id != "" {
+			return value, id, nil
+		}
+	}
+	return 0, "", fmt.Errorf("%w: malformed cursor", ErrInvalidHistoryQuery)
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"market-blockchain/internal/domain"
+)
+
+type historyTestCharges struct {
+	charges []*domain.Charge
+	filter  domain.HistoryFilter
+}
+
+func (c *historyTestCharges) ListHistory(ctx context.Context, identityAddress string, filter domain.HistoryFilter) ([]*domain.Charge, error) {
+	c.filter = filter
+	var page []*domain.Charge
+	for _, charge := range c.charges {
+		if filter.BeforeID != "" && (charge.CreatedAt > filter.BeforeCreatedAt || (charge.CreatedAt == filter.BeforeCreatedAt && charge.ID >= filter.BeforeID)) {
+			continue
+		}
+		if len(page) == filter.Limit {
+			break
+		}
+		page = append(page, charge)
+	}
+	return page, nil
+}
+
+func TestAccountHistoryServiceChargesPages(t *testing.T) {
+	charges := &historyTestCharges{charges: []*domain.Charge{
+		{ID: "c3", CreatedAt: 300, TxHash: "0x3"},
+		{ID: "c2", CreatedAt: 200},
+		{ID: "c1", CreatedAt: 200},
+	}}
+	service := NewAccountHistoryService(nil, charges, nil, nil, "https://sepolia.basescan.org/")
+
+	first, err := service.Charges(context.Background(), "0xidentity", HistoryQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("Charges returned error: %v", err)
+	}
+	if len(first.Charges) != 2 || first.Charges[1].ID != "c2" || first.NextCursor == "" || charges.filter.Limit != 3 {
+		t.Fatalf("unexpected first page: %+v, filter %+v", first, charges.filter)
+	}
+
+	second, err := service.Charges(context.Background(), "0xidentity", HistoryQuery{Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("Charges returned error: %v", err)
+	}
+	if charges.filter.BeforeCreatedAt != 200 || charges.filter.BeforeID != "c2" {
+		t.Fatalf("cursor not decoded into the filter: %+v", charges.filter)
+	}
+	if len(second.Charges) != 1 || second.Charges[0].ID != "c1" || second.NextCursor != "" {
+		t.Fatalf("unexpected last page: %+v", second)
+	}
+
+	if got := service.TxURL("0x3"); got != "https://sepolia.basescan.org/tx/0x3" {
+		t.Fatalf("unexpected tx url %q", got)
+	}
+	if got := service.TxURL(""); got != "" {
+		t.Fatalf("expected no url without a hash, got %q", got)
+	}
+}
+
+func TestAccountHistoryServiceRejectsInvalidQueries(t *testing.T) {
+	service := NewAccountHistoryService(nil, &historyTestCharges{}, nil, nil, "")
+
+	for name, query := range map[string]HistoryQuery{
+		"unknown status":    {Status: "refunded"},
+		"inverted range":    {From: 200, To: 100},
+		"limit over max":    {Limit: maxHistoryLimit + 1},
+		"malformed cursor":  {Cursor: "not-a-cursor"},
+		"cursor without id": {Cursor: encodeHistoryCursor(100, "")},
+	} {
+		if _, err := service.Charges(context.Background(), "0xidentity", query); !errors.Is(err, ErrInvalidHistoryQuery) {
+			t.Errorf("%s: expected ErrInvalidHistoryQuery, got %v", name, err)
+		}
+	}
+}
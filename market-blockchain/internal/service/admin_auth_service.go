@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"market-blockchain/internal/domain"
+)
+
+var ErrAdminUnauthenticated = errors.New("admin credentials are missing or invalid")
+
+type walletSessionAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (string, error)
+}
+
+// AdminAPIKey is a configured API key. Only the SHA-256 of the key is kept,
+// so the configuration itself does not grant access.
+type AdminAPIKey struct {
+	Name    string
+	KeyHash string
+	Roles   []domain.AdminRole
+}
+
+// AdminWallet grants roles to a wallet that signs in through the public
+// EIP-4361 flow.
+type AdminWallet struct {
+	Address common.Address
+	Roles   []domain.AdminRole
+}
+
+type AdminAuthService struct {
+	walletSessions walletSessionAuthenticator
+	apiKeys        map[string]AdminAPIKey
+	wallets        map[common.Address]AdminWallet
+}
+
+func NewAdminAuthService(walletSessions walletSessionAuthenticator, apiKeys []AdminAPIKey, wallets []AdminWallet) *AdminAuthService {
+	s := &AdminAuthService{
+		walletSessions: walletSessions,
+		apiKeys:        make(map[string]AdminAPIKey, len(apiKeys)),
+		wallets:        make(map[common.Address]AdminWallet, len(wallets)),
+	}
+	for _, key := range apiKeys {
+		s.apiKeys[strings.ToLower(key.KeyHash)] = key
+	}
+	for _, wallet := range wallets {
+		s.wallets[wallet.Address] = wallet
+	}
+	return s
+}
+
+// AuthenticateAdmin resolves an API key or a wallet session token to an admin
+// principal. The API key wins when both are present.
+func (s *AdminAuthService) AuthenticateAdmin(ctx context.Context, apiKey, sessionToken string) (*domain.AdminPrincipal, error) {
+	if apiKey != "" {
+		sum := sha256.Sum256([]byte(apiKey))
+		key, ok := s.apiKeys[hex.EncodeToString(sum[:])]
+		if !ok {
+			return nil, ErrAdminUnauthenticated
+		}
+		return &domain.AdminPrincipal{Subject: key.Name, Method: domain.AdminAuthAPIKey, Roles: key.Roles}, nil
+	}
+
+	if sessionToken != "" && s.walletSessions != nil {
+		address, err := s.walletSessions.Authenticate(ctx, sessionToken)
+		if err != nil {
+			if errors.Is(err, ErrWalletSessionInvalid) {
+				return nil, ErrAdminUnauthenticated
+			}
+			return nil, err
+		}
+		wallet, ok := s.wallets[common.HexToAddress(address)]
+		if !ok {
+			return nil, ErrAdminUnauthenticated
+		}
+		return &domain.AdminPrincipal{Subject: wallet.Address.Hex(), Method: domain.AdminAuthWallet, Roles: wallet.Roles}, nil
+	}
+
+	return nil, ErrAdminUnauthenticated
+}
+
+// ParseAdminAPIKeys parses ADMIN_API_KEYS: comma-separated
+// "name:role+role:sha256hex" entries.
+func ParseAdminAPIKeys(spec string) ([]AdminAPIKey, error) {
+	var keys []AdminAPIKey
+	for _, entry := range splitAdminSpec(spec) {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("admin api key %q: want name:roles:sha256", entry)
+		}
+		hash, err := hex.DecodeString(parts[2])
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("admin api key %q: key hash must be 64 hex characters", parts[0])
+		}
+		roles, err := parseAdminRoles(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("admin api key %q: %w", parts[0], err)
+		}
+		keys = append(keys, AdminAPIKey{Name: parts[0], KeyHash: hex.EncodeToString(hash), Roles: roles})
+	}
+	return keys, nil
+}
+
+// ParseAdminWallets parses ADMIN_WALLETS: comma-separated
+// "0xaddress:role+role" entries.
+func ParseAdminWallets(spec string) ([]AdminWallet, error) {
+	var wallets []AdminWallet
+	for _, entry := range splitAdminSpec(spec) {
+		address, roleSpec, ok := strings.Cut(entry, ":")
+		if !ok || !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("admin wallet %q: want 0xaddress:roles", entry)
+		}
+		roles, err := parseAdminRoles(roleSpec)
+		if err != nil {
+			return nil, fmt.Errorf("admin wallet %q: %w", address, err)
+		}
+		wallets = append(wallets, AdminWallet{Address: common.HexToAddress(address), Roles: roles})
+	}
+	return wallets, nil
+}
+
+func splitAdminSpec(spec string) []string {
+	var entries []string
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func parseAdminRoles(spec string) ([]domain.AdminRole, error) {
+	var roles []domain.AdminRole
+	for _, name := range strings.Split(spec, "+") {
+		role := domain.AdminRole(strings.TrimSpace(name))
+		switch role {
+		case domain.AdminRoleViewer, domain.AdminRoleOperator, domain.AdminRoleFinance, domain.AdminRoleAdmin:
+			roles = append(roles, role)
+		default:
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+	}
+	return roles, nil
+}
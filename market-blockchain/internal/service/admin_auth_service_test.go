@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"market-blockchain/internal/domain"
+)
+
+type testWalletSessions struct {
+	sessions map[string]string
+}
+
+func (s *testWalletSessions) Authenticate(ctx context.Context, token string) (string, error) {
+	address, ok := s.sessions[token]
+	if !ok {
+		return "", ErrWalletSessionInvalid
+	}
+	return address, nil
+}
+
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAdminAuthenticateWithAPIKeyAndWallet(t *testing.T) {
+	keys, err := ParseAdminAPIKeys("ops:operator+finance:" + sha256Hex("secret-key"))
+	if err != nil {
+		t.Fatalf("ParseAdminAPIKeys returned error: %v", err)
+	}
+	wallets, err := ParseAdminWallets("0x00000000000000000000000000000000000000a1:viewer")
+	if err != nil {
+		t.Fatalf("ParseAdminWallets returned error: %v", err)
+	}
+	sessions := &testWalletSessions{sessions: map[string]string{
+		"admin-token": "0x00000000000000000000000000000000000000A1",
+		"user-token":  "0x00000000000000000000000000000000000000b2",
+	}}
+	service := NewAdminAuthService(sessions, keys, wallets)
+	ctx := context.Background()
+
+	principal, err := service.AuthenticateAdmin(ctx, "secret-key", "")
+	if err != nil {
+		t.Fatalf("expected API key to authenticate, got %v", err)
+	}
+	if principal.Subject != "ops" || principal.Method != domain.AdminAuthAPIKey {
+		t.Fatalf("unexpected principal: %+v", principal)
+	}
+	if !principal.HasRole(domain.AdminRoleOperator) || !principal.HasRole(domain.AdminRoleViewer) || principal.HasRole(domain.AdminRoleAdmin) {
+		t.Fatalf("unexpected roles: %+v", principal.Roles)
+	}
+
+	principal, err = service.AuthenticateAdmin(ctx, "", "admin-token")
+	if err != nil {
+		t.Fatalf("expected admin wallet to authenticate, got %v", err)
+	}
+	if principal.Method != domain.AdminAuthWallet || principal.HasRole(domain.AdminRoleOperator) {
+		t.Fatalf("unexpected wallet principal: %+v", principal)
+	}
+
+	for name, creds := range map[string][2]string{
+		"wrong key":        {"other-key", ""},
+		"non-admin wallet": {"", "user-token"},
+		"unknown session":  {"", "missing"},
+		"no credentials":   {"", ""},
+	} {
+		if _, err := service.AuthenticateAdmin(ctx, creds[0], creds[1]); !errors.Is(err, ErrAdminUnauthenticated) {
+			t.Fatalf("%s: expected ErrAdminUnauthenticated, got %v", name, err)
+		}
+	}
+}
+
+func TestParseAdminCredentialsRejectsInvalidEntries(t *testing.T) {
+	if _, err := ParseAdminAPIKeys("ops:superuser:" + sha256Hex("k")); err == nil {
+		t.Fatal("expected unknown role to be rejected")
+	}
+	if _, err := ParseAdminAPIKeys("ops:viewer:plaintext"); err == nil {
+		t.Fatal("expected non-hash key to be rejected")
+	}
+	if _, err := ParseAdminWallets("not-an-address:viewer"); err == nil {
+		t.Fatal("expected invalid address to be rejected")
+	}
+	if keys, err := ParseAdminAPIKeys(" "); err != nil || len(keys) != 0 {
+		t.Fatalf("expected empty spec to parse to nothing, got %v, %v", keys, err)
+	}
+}
+
+func TestAdminAdminRoleSatisfiesEveryRole(t *testing.T) {
+	principal := &domain.AdminPrincipal{Roles: []domain.AdminRole{domain.AdminRoleAdmin}}
+	for _, role := range []domain.AdminRole{domain.AdminRoleViewer, domain.AdminRoleOperator, domain.AdminRoleFinance} {
+		if !principal.HasRole(role) {
+			t.Fatalf("expected admin to have %s", role)
+		}
+	}
+	finance := &domain.AdminPrincipal{Roles: []domain.AdminRole{domain.AdminRoleFinance}}
+	if finance.HasRole(domain.AdminRoleOperator) {
+		t.Fatal("expected finance not to have operator")
+	}
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+)
+
+var ErrInvalidAnalyticsQuery = errors.New("invalid analytics query")
+
+// maxAnalyticsBuckets bounds the size of one trend query: a bit over two
+// years of daily buckets, or decades of weekly and monthly ones.
+const maxAnalyticsBuckets = 800
+
+// AnalyticsQuery selects the buckets [From, To) of one granularity.
+type AnalyticsQuery struct {
+	Granularity domain.AnalyticsGranularity
+	From        int64
+	To          int64
+}
+
+// NewAnalyticsQuery validates a trend query and fills in defaults: daily
+// buckets ending now, covering the last 30 days, 12 weeks or 12 months. From
+// is aligned down to the start of its bucket.
+func NewAnalyticsQuery(granularity string, from, to int64, now time.Time) (AnalyticsQuery, error) {
+	query := AnalyticsQuery{Granularity: domain.AnalyticsGranularity(granularity), From: from, To: to}
+	switch query.Granularity {
+	case "":
+		query.Granularity = domain.AnalyticsDaily
+	case domain.AnalyticsDaily, domain.AnalyticsWeekly, domain.AnalyticsMonthly:
+	default:
+		return AnalyticsQuery{}, fmt.Errorf("%w: granularity must be %q, %q or %q", ErrInvalidAnalyticsQuery, domain.AnalyticsDaily, domain.AnalyticsWeekly, domain.AnalyticsMonthly)
+	}
+
+	if query.To == 0 {
+		query.To = now.UnixMilli()
+	}
+	if query.From == 0 {
+		end := time.UnixMilli(query.To).UTC()
+		switch query.Granularity {
+		case domain.AnalyticsWeekly:
+			query.From = end.AddDate(0, 0, -7*12).UnixMilli()
+		case domain.AnalyticsMonthly:
+			query.From = end.AddDate(0, -12, 0).UnixMilli()
+		default:
+			query.From = end.AddDate(0, 0, -30).UnixMilli()
+		}
+	}
+	if query.From < 0 || query.From >= query.To {
+		return AnalyticsQuery{}, fmt.Errorf("%w: from must be before to", ErrInvalidAnalyticsQuery)
+	}
+	query.From = query.Granularity.BucketStart(query.From)
+
+	buckets := 0
+	for start := query.From; start < query.To; start = query.Granularity.NextBucket(start) {
+		if buckets++; buckets > maxAnalyticsBuckets {
+			return AnalyticsQuery{}, fmt.Errorf("%w: range covers more than %d %s buckets", ErrInvalidAnalyticsQuery, maxAnalyticsBuckets, query.Granularity)
+		}
+	}
+	return query, nil
+}
+
+type analyticsSubscriptionCounts interface {
+	CountByStatus(ctx context.Context, status string) (int, error)
+}
+
+type analyticsChargeTotals interface {
+	CountAndSumByStatus(ctx context.Context, status string) (int, int64, error)
+}
+
+// DashboardMetrics summarizes the range [From, To) along with the current
+// state of subscriptions and open charges.
+type DashboardMetrics struct {
+	From                 int64
+	To                   int64
+	ActiveSubscriptions  int
+	MRR                  int64
+	Revenue              int64
+	NewSubscriptions     int
+	ChurnedSubscriptions int
+	Renewals             domain.RenewalOutcomes
+	PendingChargesCount  int
+	PendingChargesAmount int64
+	FailedChargesCount   int
+	FailedChargesAmount  int64
+}
+
+// SubscriptionTrend is the movement per bucket and its totals over the range.
+type SubscriptionTrend struct {
+	Buckets   []*domain.SubscriptionMovement
+	New       int
+	Cancelled int
+	Expired   int
+}
+
+// AnalyticsService answers the admin dashboard's revenue and subscription
+// questions. The aggregation happens in SQL; the service validates ranges and
+// fills in buckets without activity so trends come back continuous.
+type AnalyticsService struct {
+	analytics     repository.AnalyticsRepository
+	subscriptions analyticsSubscriptionCounts
+	charges       analyticsChargeTotals
+}
+
+func NewAnalyticsService(
+	analytics repository.AnalyticsRepository,
+	subscriptions analyticsSubscriptionCounts,
+	charges analyticsChargeTotals,
+) *AnalyticsService {
+	return &AnalyticsService{
+		analytics:     analytics,
+		subscriptions: subscriptions,
+		charges:       charges,
+	}
+}
+
+// Metrics returns the dashboard summary for the range of query; its
+// granularity is not used.
+func (s *AnalyticsService) Metrics(ctx context.Context, query AnalyticsQuery) (*DashboardMetrics, error) {
+	metrics := &DashboardMetrics{From: query.From, To: query.To}
+
+	var err error
+	if metrics.ActiveSubscriptions, err = s.subscriptions.CountByStatus(ctx, string(domain.SubscriptionActive)); err != nil {
+		return nil, fmt.Errorf("count active subscriptions: %w", err)
+	}
+	if metrics.MRR, err = s.analytics.MonthlyRecurringRevenue(ctx); err != nil {
+		return nil, fmt.Errorf("sum monthly recurring revenue: %w", err)
+	}
+
+	plans, err := s.RevenueByPlan(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for _, plan := range plans {
+		metrics.Revenue += plan.Amount
+	}
+
+	// Monthly buckets keep the number of rows small for any range.
+	movements, err := s.analytics.SubscriptionMovements(ctx, domain.AnalyticsMonthly, query.From, query.To)
+	if err != nil {
+		return nil, fmt.Errorf("count subscription movements: %w", err)
+	}
+	for _, movement := range movements {
+		metrics.NewSubscriptions += movement.New
+		metrics.ChurnedSubscriptions += movement.Churned()
+	}
+
+	renewals, err := s.analytics.RenewalOutcomes(ctx, query.From, query.To)
+	if err != nil {
+		return nil, fmt.Errorf("count renewal outcomes: %w", err)
+	}
+	metrics.Renewals = *renewals
+
+	if metrics.PendingChargesCount, metrics.PendingChargesAmount, err = s.charges.CountAndSumByStatus(ctx, string(domain.ChargePending)); err != nil {
+		return nil, fmt.Errorf("sum pending charges: %w", err)
+	}
+	if metrics.FailedChargesCount, metrics.FailedChargesAmount, err = s.charges.CountAndSumByStatus(ctx, string(domain.ChargeFailed)); err != nil {
+		return nil, fmt.Errorf("sum failed charges: %w", err)
+	}
+	return metrics, nil
+}
+
+// RevenueTrend returns completed charge revenue for every bucket of the
+// query, including empty ones.
+func (s *AnalyticsService) RevenueTrend(ctx context.Context, query AnalyticsQuery) ([]*domain.RevenueBucket, error) {
+	rows, err := s.analytics.RevenueByBucket(ctx, query.Granularity, query.From, query.To)
+	if err != nil {
+		return nil, fmt.Errorf("sum revenue by bucket: %w", err)
+	}
+
+	byStart := make(map[int64]*domain.RevenueBucket, len(rows))
+	for _, row := range rows {
+		byStart[row.BucketStart] = row
+	}
+	var buckets []*domain.RevenueBucket
+	for start := query.From; start < query.To; start = query.Granularity.NextBucket(start) {
+		bucket, ok := byStart[start]
+		if !ok {
+			bucket = &domain.RevenueBucket{BucketStart: start}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// RevenueByPlan returns completed charge revenue per plan over the range of
+// query.
+func (s *AnalyticsService) RevenueByPlan(ctx context.Context, query AnalyticsQuery) ([]*domain.PlanRevenue, error) {
+	revenue, err := s.analytics.RevenueByPlan(ctx, query.From, query.To)
+	if err != nil {
+		return nil, fmt.Errorf("sum revenue by plan: %w", err)
+	}
+	return revenue, nil
+}
+
+// SubscriptionTrend returns new, cancelled and expired subscriptions for
+// every bucket of the query, including empty ones.
+func (s *AnalyticsService) SubscriptionTrend(ctx context.Context, query AnalyticsQuery) (*SubscriptionTrend, error) {
+	rows, err := s.analytics.SubscriptionMovements(ctx, query.Granularity, query.From, query.To)
+	if err != nil {
+		return nil, fmt.Errorf("count subscription movements: %w", err)
+	}
+
+	byStart := make(map[int64]*domain.SubscriptionMovement, len(rows))
+	for _, row := range rows {
+		byStart[row.BucketStart] = row
+	}
+	trend := &SubscriptionTrend{}
+	for start := query.From; start < query.To; start = query.Granularity.NextBucket(start) {
+		movement, ok := byStart[start]
+		if !ok {
+			movement = &domain.SubscriptionMovement{BucketStart: start}
+		}
+		trend.Buckets = append(trend.Buckets, movement)
+		trend.New += movement.New
+		trend.Cancelled += movement.Cancelled
+		trend.Expired += movement.Expired
+	}
+	return trend, nil
+}
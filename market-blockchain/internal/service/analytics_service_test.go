@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"market-blockchain/internal/domain"
+)
+
+type analyticsTestRepo struct {
+	revenue   []*domain.RevenueBucket
+	plans     []*domain.PlanRevenue
+	movements []*domain.SubscriptionMovement
+	renewals  *domain.RenewalOutcomes
+	mrr       int64
+	err       error
+}
+
+func (r *analyticsTestRepo) RevenueByBucket(ctx context.Context, granularity domain.AnalyticsGranularity, from, to int64) ([]*domain.RevenueBucket, error) {
+	return r.revenue, r.err
+}
+
+func (r *analyticsTestRepo) RevenueByPlan(ctx context.Context, from, to int64) ([]*domain.PlanRevenue, error) {
+	return r.plans, nil
+}
+
+func (r *analyticsTestRepo) SubscriptionMovements(ctx context.Context, granularity domain.AnalyticsGranularity, from, to int64) ([]*domain.SubscriptionMovement, error) {
+	return r.movements, nil
+}
+
+func (r *analyticsTestRepo) RenewalOutcomes(ctx context.Context, from, to int64) (*domain.RenewalOutcomes, error) {
+	return r.renewals, nil
+}
+
+func (r *analyticsTestRepo) MonthlyRecurringRevenue(ctx context.Context) (int64, error) {
+	return r.mrr, r.err
+}
+
+type analyticsTestCounts struct{ err error }
+
+func (c analyticsTestCounts) CountByStatus(ctx context.Context, status string) (int, error) {
+	return 7, c.err
+}
+
+func (c analyticsTestCounts) CountAndSumByStatus(ctx context.Context, status string) (int, int64, error) {
+	return 1, 100, c.err
+}
+
+func TestNewAnalyticsQuery(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC)
+
+	for name, input := range map[string]struct {
+		granularity string
+		want        time.Time
+	}{
+		"daily default covers 30 days":     {"", time.Date(2026, 2, 8, 0, 0, 0, 0, time.UTC)},
+		"weekly default starts on monday":  {"week", time.Date(2025, 12, 15, 0, 0, 0, 0, time.UTC)},
+		"monthly default covers 12 months": {"month", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			query, err := NewAnalyticsQuery(input.granularity, 0, 0, now)
+			if err != nil {
+				t.Fatalf("NewAnalyticsQuery returned error: %v", err)
+			}
+			if query.From != input.want.UnixMilli() || query.To != now.UnixMilli() {
+				t.Fatalf("expected [%d, %d), got %+v", input.want.UnixMilli(), now.UnixMilli(), query)
+			}
+		})
+	}
+
+	day := (24 * time.Hour).Milliseconds()
+	for name, input := range map[string]struct {
+		granularity string
+		from, to    int64
+	}{
+		"unknown granularity": {"hour", 0, 0},
+		"inverted range":      {"day", 10 * day, 5 * day},
+		"too many buckets":    {"day", day, (maxAnalyticsBuckets + 2) * day},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewAnalyticsQuery(input.granularity, input.from, input.to, now); !errors.Is(err, ErrInvalidAnalyticsQuery) {
+				t.Fatalf("expected ErrInvalidAnalyticsQuery, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAnalyticsServiceRevenueTrendFillsEmptyMonths(t *testing.T) {
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	mar := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	repo := &analyticsTestRepo{revenue: []*domain.RevenueBucket{
+		{BucketStart: jan, ChargeCount: 2, Amount: 20},
+		{BucketStart: mar, ChargeCount: 1, Amount: 10},
+	}}
+	service := NewAnalyticsService(repo, analyticsTestCounts{}, analyticsTestCounts{})
+
+	query, err := NewAnalyticsQuery("month", jan+1, time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC).UnixMilli(), time.Now())
+	if err != nil {
+		t.Fatalf("NewAnalyticsQuery returned error: %v", err)
+	}
+	buckets, err := service.RevenueTrend(context.Background(), query)
+	if err != nil {
+		t.Fatalf("RevenueTrend returned error: %v", err)
+	}
+	if len(buckets) != 3 || buckets[0].Amount != 20 || buckets[2].Amount != 10 {
+		t.Fatalf("unexpected buckets: %+v", buckets)
+	}
+	if feb := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC).UnixMilli(); buckets[1].BucketStart != feb || buckets[1].ChargeCount != 0 {
+		t.Fatalf("expected an empty February bucket, got %+v", buckets[1])
+	}
+}
+
+func TestAnalyticsServiceMetrics(t *testing.T) {
+	repo := &analyticsTestRepo{
+		plans:     []*domain.PlanRevenue{{PlanID: "pro", Amount: 300}, {PlanID: "basic", Amount: 50}},
+		movements: []*domain.SubscriptionMovement{{New: 4, Cancelled: 1}, {New: 2, Expired: 2}},
+		renewals:  &domain.RenewalOutcomes{Completed: 9, Failed: 1, Pending: 3},
+		mrr:       1200,
+	}
+	service := NewAnalyticsService(repo, analyticsTestCounts{}, analyticsTestCounts{})
+
+	metrics, err := service.Metrics(context.Background(), AnalyticsQuery{From: 1, To: 2})
+	if err != nil {
+		t.Fatalf("Metrics returned error: %v", err)
+	}
+	if metrics.Revenue != 350 || metrics.MRR != 1200 || metrics.ActiveSubscriptions != 7 {
+		t.Fatalf("unexpected totals: %+v", metrics)
+	}
+	if metrics.NewSubscriptions != 6 || metrics.ChurnedSubscriptions != 3 || metrics.Renewals.SuccessRate() != 0.9 {
+		t.Fatalf("unexpected movement or renewals: %+v", metrics)
+	}
+
+	failing := NewAnalyticsService(repo, analyticsTestCounts{err: errors.New("connection reset")}, analyticsTestCounts{})
+	if _, err := failing.Metrics(context.Background(), AnalyticsQuery{From: 1, To: 2}); err == nil {
+		t.Fatal("expected the repository error surfaced")
+	}
+}
@@ -2,11 +2,16 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"math/big"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/google/uuid"
 
 	"market-blockchain/internal/blockchain"
 	"market-blockchain/internal/domain"
@@ -16,19 +21,59 @@ import (
 type chainContract interface {
 	AuthorizeChargeWithPermit(ctx context.Context, identity common.Address, payer common.Address, expectedAllowance *big.Int, targetAllowance *big.Int, deadline *big.Int, sig blockchain.PermitSignature) (string, error)
 	Charge(ctx context.Context, chargeID [32]byte, identity common.Address, amount *big.Int) (string, error)
+	CancelAuthorization(ctx context.Context, identity common.Address, payer common.Address, expectedAllowance *big.Int, targetAllowance *big.Int, deadline *big.Int, sig blockchain.PermitSignature) (string, error)
+	GetAuthorizedAllowance(ctx context.Context, payer common.Address, identity common.Address) (*big.Int, error)
+	IsChargeExecuted(ctx context.Context, chargeID [32]byte) (bool, error)
+	TokenAllowance(ctx context.Context, owner common.Address) (*big.Int, error)
+	PermitDomain(ctx context.Context) (blockchain.PermitDomain, error)
+	PermitNonce(ctx context.Context, owner common.Address) (*big.Int, error)
+	VaultAddress() common.Address
 }
 
-type firstChargeLifecycle interface {
+type chainLifecycle interface {
 	CompleteFirstCharge(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, permitTxHash, chargeTxHash string) error
+	ApplyRenewalSuccess(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, plan *domain.Plan, charge *domain.Charge, chargeTxHash string) error
+	ApplyRenewalFailure(ctx context.Context, subscription *domain.Subscription, plan *domain.Plan, reason domain.RenewalFailureReason, detail string) error
+	ApplyImmediateUpgrade(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, oldPlan *domain.Plan, newPlan *domain.Plan, charge *domain.Charge, chargeTxHash string) error
+	RecordChargeFailure(ctx context.Context, charge *domain.Charge, subscriptionID, reason string) error
+	ApplyAuthorizationRevoked(ctx context.Context, authorization *domain.Authorization, tx *domain.ChainTransaction) error
 }
 
+// ErrChargeInFlight is returned when a charge for the same period has already
+// been broadcast and is still waiting for its receipt.
+var ErrChargeInFlight = errors.New("charge already submitted")
+
+// ErrChargeRejected is returned when the relayer cannot submit a charge, for
+// example because the vault would revert it.
+var ErrChargeRejected = errors.New("charge rejected")
+
+var (
+	ErrSubscriptionNotFound              = errors.New("subscription not found")
+	ErrAuthorizationNotFound             = errors.New("authorization not found")
+	ErrChargeNotFound                    = errors.New("charge not found")
+	ErrChargeAuthorizationMismatch       = errors.New("charge does not belong to authorization")
+	ErrChargeSubscriptionMismatch        = errors.New("charge does not belong to subscription")
+	ErrAuthorizationSubscriptionMismatch = errors.New("authorization does not belong to subscription")
+	ErrInvalidSubscriptionStatus         = errors.New("invalid subscription status")
+	ErrInvalidChargeStatus               = errors.New("invalid charge status")
+	ErrInvalidAuthorizationStatus        = errors.New("invalid authorization status")
+	ErrPermitAlreadySubmitted            = errors.New("authorization permit already submitted")
+	ErrInvalidPermitSignature            = errors.New("invalid permit signature")
+	ErrPermitExpired                     = errors.New("permit deadline has passed")
+	ErrPermitSignerMismatch              = errors.New("permit signer does not match payer")
+	ErrPermitRejected                    = errors.New("permit rejected by chain")
+	ErrNothingToRevoke                   = errors.New("vault holds no authorized allowance to revoke")
+)
+
 type ChainService struct {
 	contractClient chainContract
 	subscriptions  repository.SubscriptionRepository
 	authorizations repository.AuthorizationRepository
 	charges        repository.ChargeRepository
 	events         repository.EventRepository
-	lifecycle      firstChargeLifecycle
+	plans          repository.PlanRepository
+	transactions   repository.ChainTransactionRepository
+	lifecycle      chainLifecycle
 }
 
 func NewChainService(
@@ -37,7 +82,9 @@ func NewChainService(
 	authorizations repository.AuthorizationRepository,
 	charges repository.ChargeRepository,
 	events repository.EventRepository,
-	lifecycle firstChargeLifecycle,
+	plans repository.PlanRepository,
+	transactions repository.ChainTransactionRepository,
+	lifecycle chainLifecycle,
 ) *ChainService {
 	return &ChainService{
 		contractClient: contractClient,
@@ -45,6 +92,8 @@ func NewChainService(
 		authorizations: authorizations,
 		charges:        charges,
 		events:         events,
+		plans:          plans,
+		transactions:   transactions,
 		lifecycle:      lifecycle,
 	}
 }
@@ -56,50 +105,63 @@ type ExecuteFirstChargeInput struct {
 	PermitSignature blockchain.PermitSignature
 }
 
-func (s *ChainService) ExecuteFirstCharge(ctx context.Context, input ExecuteFirstChargeInput) error {
+// FirstChargeSubmission is what ExecuteFirstCharge leaves behind: the permit
+// is broadcast and the first charge follows once the tracker confirms it.
+type FirstChargeSubmission struct {
+	Subscription  *domain.Subscription
+	Authorization *domain.Authorization
+	Charge        *domain.Charge
+	PermitTxHash  string
+}
+
+func (s *ChainService) ExecuteFirstCharge(ctx context.Context, input ExecuteFirstChargeInput) (*FirstChargeSubmission, error) {
 	authorization, err := s.authorizations.GetByID(ctx, input.AuthorizationID)
 	if err != nil {
-		return fmt.Errorf("get authorization by id: %w", err)
+		return nil, fmt.Errorf("get authorization by id: %w", err)
 	}
 	if authorization == nil {
-		return fmt.Errorf("authorization not found")
+		return nil, ErrAuthorizationNotFound
 	}
 
 	charge, err := s.charges.GetByID(ctx, input.ChargeRecordID)
 	if err != nil {
-		return fmt.Errorf("get charge by id: %w", err)
+		return nil, fmt.Errorf("get charge by id: %w", err)
 	}
 	if charge == nil {
-		return fmt.Errorf("charge not found")
+		return nil, ErrChargeNotFound
 	}
 	if charge.AuthorizationID != authorization.ID {
-		return fmt.Errorf("charge does not belong to authorization")
+		return nil, ErrChargeAuthorizationMismatch
 	}
 	if charge.SubscriptionID != input.SubscriptionID {
-		return fmt.Errorf("charge does not belong to subscription")
+		return nil, ErrChargeSubscriptionMismatch
 	}
 
 	subscription, err := s.subscriptions.GetByID(ctx, input.SubscriptionID)
 	if err != nil {
-		return fmt.Errorf("get subscription: %w", err)
+		return nil, fmt.Errorf("get subscription: %w", err)
 	}
 	if subscription == nil {
-		return fmt.Errorf("subscription not found")
+		return nil, ErrSubscriptionNotFound
 	}
 	if subscription.CurrentAuthorizationID != "" && subscription.CurrentAuthorizationID != authorization.ID {
-		return fmt.Errorf("authorization does not belong to subscription")
+		return nil, ErrAuthorizationSubscriptionMismatch
 	}
 	if subscription.LastChargeID != "" && subscription.LastChargeID != charge.ChargeID {
-		return fmt.Errorf("charge does not match subscription")
+		return nil, fmt.Errorf("%w: last charge is %s", ErrChargeSubscriptionMismatch, subscription.LastChargeID)
 	}
 	if subscription.Status != domain.SubscriptionPending {
-		return fmt.Errorf("invalid subscription status for first charge: %s", subscription.Status)
+		return nil, fmt.Errorf("%w for first charge: %s", ErrInvalidSubscriptionStatus, subscription.Status)
 	}
 	if charge.Status != domain.ChargePending {
-		return fmt.Errorf("invalid charge status for first charge: %s", charge.Status)
+		return nil, fmt.Errorf("%w for first charge: %s", ErrInvalidChargeStatus, charge.Status)
 	}
 	if authorization.PermitStatus != domain.AuthorizationPending {
-		return fmt.Errorf("invalid authorization status for first charge: %s", authorization.PermitStatus)
+		return nil, fmt.Errorf("%w for first charge: %s", ErrInvalidAuthorizationStatus, authorization.PermitStatus)
+	}
+
+	if authorization.PermitTxHash != "" {
+		return nil, fmt.Errorf("%w in tx %s", ErrPermitAlreadySubmitted, authorization.PermitTxHash)
 	}
 
 	identity := common.HexToAddress(authorization.IdentityAddress)
@@ -108,49 +170,941 @@ func (s *ChainService) ExecuteFirstCharge(ctx context.Context, input ExecuteFirs
 	targetAllowance := big.NewInt(authorization.TargetAllowance)
 	deadline := big.NewInt(authorization.PermitDeadline)
 
-	permitTxHash, err := s.contractClient.AuthorizeChargeWithPermit(
-		ctx,
-		identity,
-		payer,
-		expectedAllowance,
-		targetAllowance,
-		deadline,
-		input.PermitSignature,
+	// The authorization stays pending until the tracker sees the permit
+	// confirmed; the first charge is only submitted after that.
+	permitTxHash, err := s.sendTracked(ctx, domain.ChainTxPermit, subscription.ID, authorization.ID, charge.ID,
+		func(txHash string) error {
+			authorization.PermitTxHash = txHash
+			authorization.UpdatedAt = time.Now().UnixMilli()
+			if err := s.authorizations.Update(authorization); err != nil {
+				return fmt.Errorf("persist permit tx hash: %w", err)
+			}
+			return nil
+		},
+		func(ctx context.Context) (string, error) {
+			return s.contractClient.AuthorizeChargeWithPermit(
+				ctx,
+				identity,
+				payer,
+				expectedAllowance,
+				targetAllowance,
+				deadline,
+				input.PermitSignature,
+			)
+		},
 	)
+	if err != nil && permitTxHash != "" {
+		return nil, err
+	}
 	if err != nil {
+		authorization.PermitTxHash = ""
 		authorization.PermitStatus = domain.AuthorizationFailed
 		authorization.UpdatedAt = time.Now().UnixMilli()
 		if updateErr := s.authorizations.Update(authorization); updateErr != nil {
-			return fmt.Errorf("authorize charge with permit: %w (also failed to persist authorization failure: %v)", err, updateErr)
+			return nil, fmt.Errorf("authorize charge with permit: %w: %w (also failed to persist authorization failure: %v)", ErrPermitRejected, err, updateErr)
 		}
-		return fmt.Errorf("authorize charge with permit: %w", err)
+		return nil, fmt.Errorf("authorize charge with permit: %w: %w", ErrPermitRejected, err)
 	}
 
-	var chargeID [32]byte
-	copy(chargeID[:], []byte(charge.ChargeID))
-	amount := big.NewInt(charge.Amount)
+	return &FirstChargeSubmission{
+		Subscription:  subscription,
+		Authorization: authorization,
+		Charge:        charge,
+		PermitTxHash:  permitTxHash,
+	}, nil
+}
+
+// PermitPayload is the EIP-712 permit a payer signs to activate a
+// subscription.
+type PermitPayload struct {
+	AuthorizationID string
+	DomainSeparator common.Hash
+	TypedData       apitypes.TypedData
+}
 
-	chargeTxHash, err := s.contractClient.Charge(ctx, chargeID, identity, amount)
+// PreparePermit builds the permit for the subscription's pending
+// authorization, using the payer's current nonce on the token.
+func (s *ChainService) PreparePermit(ctx context.Context, subscriptionID string) (*PermitPayload, error) {
+	_, authorization, err := s.pendingActivation(ctx, subscriptionID)
 	if err != nil {
-		now := time.Now().UnixMilli()
-		authorization.PermitStatus = domain.AuthorizationCompleted
-		authorization.PermitTxHash = permitTxHash
-		authorization.AuthorizedAllowance = authorization.TargetAllowance
-		authorization.UpdatedAt = now
-		charge.Status = domain.ChargeFailed
-		charge.UpdatedAt = now
-		if updateErr := s.authorizations.Update(authorization); updateErr != nil {
-			return fmt.Errorf("charge: %w (also failed to persist authorization success: %v)", err, updateErr)
+		return nil, err
+	}
+
+	typedData, domain, err := s.permitTypedData(ctx, authorization.PayerAddress, big.NewInt(authorization.TargetAllowance), big.NewInt(authorization.PermitDeadline))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PermitPayload{
+		AuthorizationID: authorization.ID,
+		DomainSeparator: domain.DomainSeparator,
+		TypedData:       typedData,
+	}, nil
+}
+
+// ActivateSubscription submits the signed permit for a pending subscription.
+// The authorization and first charge are resolved from the subscription, and
+// the signature is recovered against the payer up front so a bad permit never
+// costs the relayer gas.
+func (s *ChainService) ActivateSubscription(ctx context.Context, subscriptionID string, sig blockchain.PermitSignature) (*FirstChargeSubmission, error) {
+	subscription, authorization, err := s.pendingActivation(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if subscription.LastChargeID == "" {
+		return nil, ErrChargeNotFound
+	}
+	if err := validatePermitSignature(sig); err != nil {
+		return nil, err
+	}
+	// The deadline is handed to the token contract as-is, which compares it
+	// against block.timestamp in seconds.
+	if authorization.PermitDeadline <= time.Now().Unix() {
+		return nil, fmt.Errorf("%w: %d", ErrPermitExpired, authorization.PermitDeadline)
+	}
+
+	typedData, _, err := s.permitTypedData(ctx, authorization.PayerAddress, big.NewInt(authorization.TargetAllowance), big.NewInt(authorization.PermitDeadline))
+	if err != nil {
+		return nil, err
+	}
+	signer, err := blockchain.RecoverPermitSigner(typedData, sig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPermitSignature, err)
+	}
+	if signer != common.HexToAddress(authorization.PayerAddress) {
+		return nil, fmt.Errorf("%w: recovered %s", ErrPermitSignerMismatch, signer.Hex())
+	}
+
+	charge, err := s.charges.GetByChargeID(ctx, subscription.LastChargeID)
+	if err != nil {
+		return nil, fmt.Errorf("get charge by charge id: %w", err)
+	}
+	if charge == nil {
+		return nil, ErrChargeNotFound
+	}
+
+	return s.ExecuteFirstCharge(ctx, ExecuteFirstChargeInput{
+		SubscriptionID:  subscription.ID,
+		AuthorizationID: authorization.ID,
+		ChargeRecordID:  charge.ID,
+		PermitSignature: sig,
+	})
+}
+
+// pendingActivation loads a subscription and its authorization, and checks
+// the permit has not been submitted yet.
+func (s *ChainService) pendingActivation(ctx context.Context, subscriptionID string) (*domain.Subscription, *domain.Authorization, error) {
+	subscription, err := s.subscriptions.GetByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get subscription: %w", err)
+	}
+	if subscription == nil {
+		return nil, nil, ErrSubscriptionNotFound
+	}
+	if subscription.CurrentAuthorizationID == "" {
+		return nil, nil, ErrAuthorizationNotFound
+	}
+
+	authorization, err := s.authorizations.GetByID(ctx, subscription.CurrentAuthorizationID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get authorization by id: %w", err)
+	}
+	if authorization == nil {
+		return nil, nil, ErrAuthorizationNotFound
+	}
+	if authorization.PermitStatus != domain.AuthorizationPending {
+		return nil, nil, fmt.Errorf("%w for permit: %s", ErrInvalidAuthorizationStatus, authorization.PermitStatus)
+	}
+	if authorization.PermitTxHash != "" {
+		return nil, nil, fmt.Errorf("%w in tx %s", ErrPermitAlreadySubmitted, authorization.PermitTxHash)
+	}
+	return subscription, authorization, nil
+}
+
+// permitTypedData builds a permit from payer to the vault setting the
+// allowance to value, using the payer's current nonce.
+func (s *ChainService) permitTypedData(ctx context.Context, payer string, value, deadline *big.Int) (apitypes.TypedData, blockchain.PermitDomain, error) {
+	permitDomain, err := s.contractClient.PermitDomain(ctx)
+	if err != nil {
+		return apitypes.TypedData{}, blockchain.PermitDomain{}, fmt.Errorf("get permit domain: %w", err)
+	}
+
+	owner := common.HexToAddress(payer)
+	nonce, err := s.contractClient.PermitNonce(ctx, owner)
+	if err != nil {
+		return apitypes.TypedData{}, blockchain.PermitDomain{}, fmt.Errorf("get permit nonce: %w", err)
+	}
+
+	typedData := blockchain.PermitTypedData(permitDomain, blockchain.PermitMessage{
+		Owner:    owner,
+		Spender:  s.contractClient.VaultAddress(),
+		Value:    value,
+		Nonce:    nonce,
+		Deadline: deadline,
+	})
+	return typedData, permitDomain, nil
+}
+
+func validatePermitSignature(sig blockchain.PermitSignature) error {
+	if sig.V != 27 && sig.V != 28 {
+		return fmt.Errorf("%w: v must be 27 or 28, got %d", ErrInvalidPermitSignature, sig.V)
+	}
+	// OpenZeppelin's ECDSA library rejects high-s signatures (EIP-2), so
+	// apply the homestead rules.
+	r := new(big.Int).SetBytes(sig.R[:])
+	sValue := new(big.Int).SetBytes(sig.S[:])
+	if !crypto.ValidateSignatureValues(sig.V-27, r, sValue, true) {
+		return fmt.Errorf("%w: r or s out of range", ErrInvalidPermitSignature)
+	}
+	return nil
+}
+
+// revocationPermitValidity is how long a payer has to sign and return a
+// revocation permit prepared by PrepareRevocation.
+const revocationPermitValidity = time.Hour
+
+// RevocationPayload is the permit a payer signs to revoke the vault's
+// allowance. ExpectedAllowance, TargetAllowance and Deadline have to be sent
+// back unchanged with the signature.
+type RevocationPayload struct {
+	AuthorizationID   string
+	ExpectedAllowance *big.Int
+	TargetAllowance   *big.Int
+	Deadline          int64
+	DomainSeparator   common.Hash
+	TypedData         apitypes.TypedData
+}
+
+// PrepareRevocation builds the permit for cancelAuthorization. The vault
+// requires the token allowance to drop by exactly the identity's authorized
+// allowance, so both are read from chain rather than from local state.
+func (s *ChainService) PrepareRevocation(ctx context.Context, subscriptionID string) (*RevocationPayload, error) {
+	subscription, authorization, err := s.revocableAuthorization(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	payer := common.HexToAddress(authorization.PayerAddress)
+	identity := common.HexToAddress(subscription.IdentityAddress)
+	expected, err := s.contractClient.TokenAllowance(ctx, payer)
+	if err != nil {
+		return nil, fmt.Errorf("get token allowance: %w", err)
+	}
+	authorized, err := s.contractClient.GetAuthorizedAllowance(ctx, payer, identity)
+	if err != nil {
+		return nil, fmt.Errorf("get authorized allowance: %w", err)
+	}
+	if authorized.Sign() == 0 {
+		return nil, ErrNothingToRevoke
+	}
+	target := new(big.Int).Sub(expected, authorized)
+	if target.Sign() < 0 {
+		return nil, fmt.Errorf("token allowance %s is below the vault authorized allowance %s", expected, authorized)
+	}
+
+	deadline := time.Now().Add(revocationPermitValidity).Unix()
+	typedData, permitDomain, err := s.permitTypedData(ctx, authorization.PayerAddress, target, big.NewInt(deadline))
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevocationPayload{
+		AuthorizationID:   authorization.ID,
+		ExpectedAllowance: expected,
+		TargetAllowance:   target,
+		Deadline:          deadline,
+		DomainSeparator:   permitDomain.DomainSeparator,
+		TypedData:         typedData,
+	}, nil
+}
+
+type RevokeAuthorizationInput struct {
+	SubscriptionID    string
+	ExpectedAllowance *big.Int
+	TargetAllowance   *big.Int
+	Deadline          int64
+	PermitSignature   blockchain.PermitSignature
+}
+
+// RevokeAuthorization verifies the payer's revocation permit and submits
+// cancelAuthorization. The authorization only moves to revoked once the
+// tracker sees the transaction confirmed.
+func (s *ChainService) RevokeAuthorization(ctx context.Context, input RevokeAuthorizationInput) (string, error) {
+	subscription, authorization, err := s.revocableAuthorization(ctx, input.SubscriptionID)
+	if err != nil {
+		return "", err
+	}
+	if input.ExpectedAllowance == nil || input.TargetAllowance == nil || input.TargetAllowance.Cmp(input.ExpectedAllowance) >= 0 {
+		return "", fmt.Errorf("%w: target allowance must be below expected allowance", ErrInvalidPermitSignature)
+	}
+	if err := validatePermitSignature(input.PermitSignature); err != nil {
+		return "", err
+	}
+	if input.Deadline <= time.Now().Unix() {
+		return "", fmt.Errorf("%w: %d", ErrPermitExpired, input.Deadline)
+	}
+
+	typedData, _, err := s.permitTypedData(ctx, authorization.PayerAddress, input.TargetAllowance, big.NewInt(input.Deadline))
+	if err != nil {
+		return "", err
+	}
+	signer, err := blockchain.RecoverPermitSigner(typedData, input.PermitSignature)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPermitSignature, err)
+	}
+	if signer != common.HexToAddress(authorization.PayerAddress) {
+		return "", fmt.Errorf("%w: recovered %s", ErrPermitSignerMismatch, signer.Hex())
+	}
+
+	txHash, err := s.sendTracked(ctx, domain.ChainTxRevocation, subscription.ID, authorization.ID, "", nil,
+		func(ctx context.Context) (string, error) {
+			return s.contractClient.CancelAuthorization(
+				ctx,
+				common.HexToAddress(subscription.IdentityAddress),
+				common.HexToAddress(authorization.PayerAddress),
+				input.ExpectedAllowance,
+				input.TargetAllowance,
+				big.NewInt(input.Deadline),
+				input.PermitSignature,
+			)
+		},
+	)
+	if err != nil && txHash != "" {
+		return txHash, err
+	}
+	if err != nil {
+		return "", fmt.Errorf("cancel authorization: %w: %w", ErrPermitRejected, err)
+	}
+	return txHash, nil
+}
+
+// revocableAuthorization loads a subscription's authorization and checks the
+// vault could still be charging it.
+func (s *ChainService) revocableAuthorization(ctx context.Context, subscriptionID string) (*domain.Subscription, *domain.Authorization, error) {
+	subscription, err := s.subscriptions.GetByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get subscription: %w", err)
+	}
+	if subscription == nil {
+		return nil, nil, ErrSubscriptionNotFound
+	}
+	if subscription.CurrentAuthorizationID == "" {
+		return nil, nil, ErrAuthorizationNotFound
+	}
+
+	authorization, err := s.authorizations.GetByID(ctx, subscription.CurrentAuthorizationID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get authorization by id: %w", err)
+	}
+	if authorization == nil {
+		return nil, nil, ErrAuthorizationNotFound
+	}
+	if authorization.PermitStatus != domain.AuthorizationCompleted {
+		return nil, nil, fmt.Errorf("%w for revocation: %s", ErrInvalidAuthorizationStatus, authorization.PermitStatus)
+	}
+	return subscription, authorization, nil
+}
+
+// RenewalChargeID derives the charge ID for renewing the period that ends at
+// periodEnd. Retries for the same period reuse the ID, so the vault rejects a
+// second on-chain charge instead of billing the payer twice.
+func RenewalChargeID(subscriptionID string, periodEnd int64) string {
+	return fmt.Sprintf("renewal_%s_%d", subscriptionID, periodEnd)
+}
+
+type ExecuteRenewalChargeInput struct {
+	Subscription  *domain.Subscription
+	Authorization *domain.Authorization
+	Plan          *domain.Plan
+}
+
+func (s *ChainService) ExecuteRenewalCharge(ctx context.Context, input ExecuteRenewalChargeInput) error {
+	subscription := input.Subscription
+	authorization := input.Authorization
+	plan := input.Plan
+
+	if subscription.Status != domain.SubscriptionActive && subscription.Status != domain.SubscriptionPastDue {
+		return fmt.Errorf("%w for renewal charge: %s", ErrInvalidSubscriptionStatus, subscription.Status)
+	}
+	if authorization.PermitStatus != domain.AuthorizationCompleted {
+		return fmt.Errorf("%w for renewal charge: %s", ErrInvalidAuthorizationStatus, authorization.PermitStatus)
+	}
+
+	upgrade, err := s.UpgradeInFlight(ctx, subscription.ID)
+	if err != nil {
+		return err
+	}
+	if upgrade != nil {
+		return fmt.Errorf("%w: upgrade %s in tx %s", ErrChargeInFlight, upgrade.ChargeID, upgrade.TxHash)
+	}
+
+	now := time.Now().UnixMilli()
+	reason := string(domain.EventRenew)
+	if subscription.PendingPlanID != "" {
+		reason = string(domain.EventDowngrade)
+	}
+
+	charge, err := s.prepareCharge(ctx, &domain.Charge{
+		ID:              uuid.New().String(),
+		ChargeID:        RenewalChargeID(subscription.ID, subscription.CurrentPeriodEnd),
+		SubscriptionID:  subscription.ID,
+		AuthorizationID: authorization.ID,
+		IdentityAddress: subscription.IdentityAddress,
+		PayerAddress:    subscription.PayerAddress,
+		PlanID:          plan.PlanID,
+		Amount:          plan.AmountUSDCBaseUnits,
+		Status:          domain.ChargePending,
+		Reason:          reason,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.submitCharge(ctx, domain.ChainTxRenewalCharge, subscription, authorization, charge)
+}
+
+// UpgradeChargeID derives the charge ID for upgrading a subscription to
+// planID during the period that ends at periodEnd, so retrying a failed
+// upgrade cannot bill the payer twice.
+func UpgradeChargeID(subscriptionID, planID string, periodEnd int64) string {
+	return fmt.Sprintf("upgrade_%s_%s_%d", subscriptionID, planID, periodEnd)
+}
+
+type ExecuteUpgradeChargeInput struct {
+	Subscription  *domain.Subscription
+	Authorization *domain.Authorization
+	NewPlan       *domain.Plan
+	Amount        int64
+}
+
+// ExecuteUpgradeCharge submits the prorated charge for an immediate upgrade.
+// The subscription keeps its current plan until the tracker confirms the
+// charge.
+func (s *ChainService) ExecuteUpgradeCharge(ctx context.Context, input ExecuteUpgradeChargeInput) (*domain.Charge, error) {
+	subscription := input.Subscription
+	authorization := input.Authorization
+
+	if subscription.Status != domain.SubscriptionActive {
+		return nil, fmt.Errorf("%w for upgrade charge: %s", ErrInvalidSubscriptionStatus, subscription.Status)
+	}
+	if authorization.PermitStatus != domain.AuthorizationCompleted {
+		return nil, fmt.Errorf("%w for upgrade charge: %s", ErrInvalidAuthorizationStatus, authorization.PermitStatus)
+	}
+
+	now := time.Now().UnixMilli()
+	charge, err := s.prepareCharge(ctx, &domain.Charge{
+		ID:              uuid.New().String(),
+		ChargeID:        UpgradeChargeID(subscription.ID, input.NewPlan.PlanID, subscription.CurrentPeriodEnd),
+		SubscriptionID:  subscription.ID,
+		AuthorizationID: authorization.ID,
+		IdentityAddress: subscription.IdentityAddress,
+		PayerAddress:    subscription.PayerAddress,
+		PlanID:          input.NewPlan.PlanID,
+		Amount:          input.Amount,
+		Status:          domain.ChargePending,
+		Reason:          string(domain.EventUpgrade),
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.submitCharge(ctx, domain.ChainTxUpgradeCharge, subscription, authorization, charge); err != nil {
+		return nil, err
+	}
+	return charge, nil
+}
+
+// UpgradeInFlight returns the subscription's upgrade charge that has been
+// broadcast and is still waiting for its receipt, or nil. The subscription
+// is not renewed or cancelled meanwhile, so the confirmation finds it in the
+// period the upgrade was charged for.
+func (s *ChainService) UpgradeInFlight(ctx context.Context, subscriptionID string) (*domain.Charge, error) {
+	return s.chargeInFlight(ctx, subscriptionID, string(domain.EventUpgrade))
+}
+
+// ChargeInFlight returns any charge of the subscription that has been
+// broadcast and is still waiting for its receipt, or nil. The subscription
+// is not cancelled meanwhile, so the payment is applied once it confirms.
+func (s *ChainService) ChargeInFlight(ctx context.Context, subscriptionID string) (*domain.Charge, error) {
+	return s.chargeInFlight(ctx, subscriptionID, "")
+}
+
+// chargeInFlight looks for a broadcast pending charge with the given reason,
+// or with any reason when reason is empty.
+func (s *ChainService) chargeInFlight(ctx context.Context, subscriptionID, reason string) (*domain.Charge, error) {
+	charges, err := s.charges.ListBySubscription(ctx, subscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("list subscription charges: %w", err)
+	}
+	for _, charge := range charges {
+		if (reason == "" || charge.Reason == reason) && charge.Status == domain.ChargePending && charge.TxHash != "" {
+			return charge, nil
 		}
+	}
+	return nil, nil
+}
+
+// prepareCharge returns the pending record for pending.ChargeID: pending
+// itself when the charge is new, or the earlier record reset for another
+// attempt when a previous submission failed.
+func (s *ChainService) prepareCharge(ctx context.Context, pending *domain.Charge) (*domain.Charge, error) {
+	charge, err := s.charges.GetByChargeID(ctx, pending.ChargeID)
+	if err != nil {
+		return nil, fmt.Errorf("get charge %s: %w", pending.ChargeID, err)
+	}
+
+	switch {
+	case charge == nil:
+		if err := s.charges.Create(pending); err != nil {
+			return nil, fmt.Errorf("persist pending charge: %w", err)
+		}
+		return pending, nil
+	case charge.Status == domain.ChargeCompleted:
+		return nil, fmt.Errorf("charge %s already completed", charge.ChargeID)
+	case charge.Status == domain.ChargePending && charge.TxHash != "":
+		return nil, fmt.Errorf("%w: %s in tx %s", ErrChargeInFlight, charge.ChargeID, charge.TxHash)
+	default:
+		charge.Status = domain.ChargePending
+		charge.TxHash = ""
+		charge.Amount = pending.Amount
+		charge.UpdatedAt = pending.UpdatedAt
+		if err := s.charges.Update(charge); err != nil {
+			return nil, fmt.Errorf("reset charge for retry: %w", err)
+		}
+		return charge, nil
+	}
+}
+
+// submitCharge sends a pending charge to the vault and tracks the
+// transaction. A rejected submission marks the charge failed.
+func (s *ChainService) submitCharge(ctx context.Context, kind domain.ChainTransactionKind, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge) error {
+	identity := common.HexToAddress(subscription.IdentityAddress)
+	txHash, err := s.sendTracked(ctx, kind, subscription.ID, authorization.ID, charge.ID,
+		func(txHash string) error {
+			charge.TxHash = txHash
+			charge.UpdatedAt = time.Now().UnixMilli()
+			if err := s.charges.Update(charge); err != nil {
+				return fmt.Errorf("persist %s tx hash: %w", kind, err)
+			}
+			return nil
+		},
+		func(ctx context.Context) (string, error) {
+			return s.contractClient.Charge(ctx, blockchain.ChargeKey(charge), identity, big.NewInt(charge.Amount))
+		},
+	)
+	if err != nil && txHash != "" {
+		return err
+	}
+	if err != nil {
+		charge.Status = domain.ChargeFailed
+		charge.TxHash = ""
+		charge.UpdatedAt = time.Now().UnixMilli()
 		if updateErr := s.charges.Update(charge); updateErr != nil {
-			return fmt.Errorf("charge: %w (authorization success persisted, but failed to persist charge failure: %v)", err, updateErr)
+			return fmt.Errorf("%w: %w (also failed to persist charge failure: %v)", ErrChargeRejected, err, updateErr)
+		}
+		return fmt.Errorf("%w: %w", ErrChargeRejected, err)
+	}
+	return nil
+}
+
+// HandleTransactionConfirmed applies the state change a relayer transaction
+// was submitted for. It is called by the TransactionTracker once the receipt
+// has enough confirmations and may be retried, so every branch is idempotent.
+func (s *ChainService) HandleTransactionConfirmed(ctx context.Context, tx *domain.ChainTransaction) error {
+	switch tx.Kind {
+	case domain.ChainTxPermit:
+		return s.confirmPermit(ctx, tx)
+	case domain.ChainTxFirstCharge:
+		return s.confirmFirstCharge(ctx, tx)
+	case domain.ChainTxRenewalCharge:
+		return s.confirmRenewalCharge(ctx, tx)
+	case domain.ChainTxUpgradeCharge:
+		return s.confirmUpgradeCharge(ctx, tx)
+	case domain.ChainTxRevocation:
+		return s.confirmRevocation(ctx, tx)
+	default:
+		return fmt.Errorf("unknown chain transaction kind: %s", tx.Kind)
+	}
+}
+
+// ChargeExecuted reports whether the vault has already executed the charge a
+// relayer transaction was submitted for. The tracker asks before giving up on
+// a transaction it has no receipt for, since the charge may have landed under
+// a broadcast whose receipt it cannot find. Transactions that carry no charge
+// report false.
+func (s *ChainService) ChargeExecuted(ctx context.Context, tx *domain.ChainTransaction) (bool, error) {
+	switch tx.Kind {
+	case domain.ChainTxFirstCharge, domain.ChainTxRenewalCharge, domain.ChainTxUpgradeCharge:
+	default:
+		return false, nil
+	}
+
+	charge, err := s.charges.GetByID(ctx, tx.ChargeRecordID)
+	if err != nil {
+		return false, fmt.Errorf("get charge by id: %w", err)
+	}
+	if charge == nil {
+		return false, nil
+	}
+	executed, err := s.contractClient.IsChargeExecuted(ctx, blockchain.ChargeKey(charge))
+	if err != nil {
+		return false, fmt.Errorf("check charge on chain: %w", err)
+	}
+	return executed, nil
+}
+
+// HandleTransactionFailed records a relayer transaction that reverted or was
+// dropped without being mined.
+func (s *ChainService) HandleTransactionFailed(ctx context.Context, tx *domain.ChainTransaction) error {
+	if tx.Kind == domain.ChainTxRevocation {
+		// Nothing changed locally when the revocation was submitted, so a
+		// revert leaves the authorization as it was; the payer can sign again.
+		return nil
+	}
+	if tx.Kind == domain.ChainTxPermit {
+		authorization, err := s.authorizations.GetByID(ctx, tx.AuthorizationID)
+		if err != nil {
+			return fmt.Errorf("get authorization by id: %w", err)
+		}
+		if authorization != nil && authorization.PermitStatus == domain.AuthorizationPending {
+			authorization.PermitStatus = domain.AuthorizationFailed
+			authorization.UpdatedAt = time.Now().UnixMilli()
+			if err := s.authorizations.Update(authorization); err != nil {
+				return fmt.Errorf("persist authorization failure: %w", err)
+			}
+		}
+	}
+
+	charge, err := s.charges.GetByID(ctx, tx.ChargeRecordID)
+	if err != nil {
+		return fmt.Errorf("get charge by id: %w", err)
+	}
+	if charge == nil || charge.Status != domain.ChargePending {
+		return nil
+	}
+
+	reason := fmt.Sprintf("%s transaction %s: %s", tx.Kind, tx.SettledTxHash(), tx.Error)
+	// The charge stays pending until the renewal failure is recorded, so a
+	// retry of this call does not skip it.
+	if tx.Kind == domain.ChainTxRenewalCharge {
+		failure := domain.RenewalFailureChargeReverted
+		if tx.Status == domain.ChainTxDropped {
+			failure = domain.RenewalFailureChargeDropped
+		}
+		if err := s.failRenewal(ctx, charge, failure, reason); err != nil {
+			return err
+		}
+	}
+
+	return s.lifecycle.RecordChargeFailure(ctx, charge, tx.SubscriptionID, reason)
+}
+
+// failRenewal counts a failed renewal charge as a failed renewal attempt,
+// so the retry waits for the dunning schedule. Charges for a period the
+// subscription has already left are ignored.
+func (s *ChainService) failRenewal(ctx context.Context, charge *domain.Charge, failure domain.RenewalFailureReason, detail string) error {
+	subscription, err := s.subscriptions.GetByID(ctx, charge.SubscriptionID)
+	if err != nil {
+		return fmt.Errorf("get subscription: %w", err)
+	}
+	if subscription == nil || charge.ChargeID != RenewalChargeID(subscription.ID, subscription.CurrentPeriodEnd) {
+		return nil
+	}
+	if subscription.Status != domain.SubscriptionActive && subscription.Status != domain.SubscriptionPastDue {
+		return nil
+	}
+
+	plan, err := s.plans.GetByPlanID(ctx, subscription.PlanID)
+	if err != nil {
+		return fmt.Errorf("get plan: %w", err)
+	}
+
+	return s.lifecycle.ApplyRenewalFailure(ctx, subscription, plan, failure, detail)
+}
+
+func (s *ChainService) confirmPermit(ctx context.Context, tx *domain.ChainTransaction) error {
+	authorization, err := s.authorizations.GetByID(ctx, tx.AuthorizationID)
+	if err != nil {
+		return fmt.Errorf("get authorization by id: %w", err)
+	}
+	if authorization == nil {
+		return ErrAuthorizationNotFound
+	}
+
+	charge, err := s.charges.GetByID(ctx, tx.ChargeRecordID)
+	if err != nil {
+		return fmt.Errorf("get charge by id: %w", err)
+	}
+	if charge == nil {
+		return ErrChargeNotFound
+	}
+
+	if authorization.PermitStatus == domain.AuthorizationPending {
+		authorization.PermitStatus = domain.AuthorizationCompleted
+		authorization.PermitTxHash = tx.SettledTxHash()
+		authorization.AuthorizedAllowance = authorization.TargetAllowance
+		authorization.UpdatedAt = time.Now().UnixMilli()
+		if err := s.authorizations.Update(authorization); err != nil {
+			return fmt.Errorf("persist authorization success: %w", err)
 		}
-		return fmt.Errorf("charge: %w", err)
 	}
 
-	if err := s.lifecycle.CompleteFirstCharge(ctx, subscription, authorization, charge, permitTxHash, chargeTxHash); err != nil {
+	if charge.Status != domain.ChargePending || charge.TxHash != "" {
+		return nil
+	}
+
+	identity := common.HexToAddress(authorization.IdentityAddress)
+	txHash, err := s.sendTracked(ctx, domain.ChainTxFirstCharge, tx.SubscriptionID, authorization.ID, charge.ID,
+		func(txHash string) error {
+			charge.TxHash = txHash
+			charge.UpdatedAt = time.Now().UnixMilli()
+			if err := s.charges.Update(charge); err != nil {
+				return fmt.Errorf("persist first charge tx hash: %w", err)
+			}
+			return nil
+		},
+		func(ctx context.Context) (string, error) {
+			return s.contractClient.Charge(ctx, blockchain.ChargeKey(charge), identity, big.NewInt(charge.Amount))
+		},
+	)
+	if err != nil && txHash != "" {
 		return err
 	}
+	if err != nil {
+		// The permit itself is final, so the failure is recorded on the charge
+		// rather than returned; returning would only retry the permit handling.
+		charge.TxHash = ""
+		return s.lifecycle.RecordChargeFailure(ctx, charge, tx.SubscriptionID, fmt.Sprintf("charge: %v", err))
+	}
+	return nil
+}
+
+func (s *ChainService) confirmFirstCharge(ctx context.Context, tx *domain.ChainTransaction) error {
+	charge, err := s.charges.GetByID(ctx, tx.ChargeRecordID)
+	if err != nil {
+		return fmt.Errorf("get charge by id: %w", err)
+	}
+	if charge == nil {
+		return ErrChargeNotFound
+	}
+	if charge.Status == domain.ChargeCompleted {
+		return nil
+	}
+
+	authorization, err := s.authorizations.GetByID(ctx, tx.AuthorizationID)
+	if err != nil {
+		return fmt.Errorf("get authorization by id: %w", err)
+	}
+	if authorization == nil {
+		return ErrAuthorizationNotFound
+	}
+
+	subscription, err := s.subscriptions.GetByID(ctx, tx.SubscriptionID)
+	if err != nil {
+		return fmt.Errorf("get subscription: %w", err)
+	}
+	if subscription == nil {
+		return ErrSubscriptionNotFound
+	}
+
+	return s.lifecycle.CompleteFirstCharge(ctx, subscription, authorization, charge, authorization.PermitTxHash, tx.SettledTxHash())
+}
+
+func (s *ChainService) confirmRenewalCharge(ctx context.Context, tx *domain.ChainTransaction) error {
+	charge, err := s.charges.GetByID(ctx, tx.ChargeRecordID)
+	if err != nil {
+		return fmt.Errorf("get charge by id: %w", err)
+	}
+	if charge == nil {
+		return ErrChargeNotFound
+	}
+	if charge.Status == domain.ChargeCompleted {
+		return nil
+	}
+
+	subscription, err := s.subscriptions.GetByID(ctx, charge.SubscriptionID)
+	if err != nil {
+		return fmt.Errorf("get subscription: %w", err)
+	}
+	if subscription == nil {
+		return ErrSubscriptionNotFound
+	}
+
+	authorization, err := s.authorizations.GetByID(ctx, charge.AuthorizationID)
+	if err != nil {
+		return fmt.Errorf("get authorization by id: %w", err)
+	}
+	if authorization == nil {
+		return ErrAuthorizationNotFound
+	}
+
+	plan, err := s.plans.GetByPlanID(ctx, charge.PlanID)
+	if err != nil {
+		return fmt.Errorf("get plan: %w", err)
+	}
+	if plan == nil {
+		return fmt.Errorf("plan not found")
+	}
+
+	return s.lifecycle.ApplyRenewalSuccess(ctx, subscription, authorization, plan, charge, tx.SettledTxHash())
+}
+
+func (s *ChainService) confirmUpgradeCharge(ctx context.Context, tx *domain.ChainTransaction) error {
+	charge, err := s.charges.GetByID(ctx, tx.ChargeRecordID)
+	if err != nil {
+		return fmt.Errorf("get charge by id: %w", err)
+	}
+	if charge == nil {
+		return ErrChargeNotFound
+	}
+	if charge.Status == domain.ChargeCompleted {
+		return nil
+	}
+
+	subscription, err := s.subscriptions.GetByID(ctx, charge.SubscriptionID)
+	if err != nil {
+		return fmt.Errorf("get subscription: %w", err)
+	}
+	if subscription == nil {
+		return ErrSubscriptionNotFound
+	}
+
+	authorization, err := s.authorizations.GetByID(ctx, charge.AuthorizationID)
+	if err != nil {
+		return fmt.Errorf("get authorization by id: %w", err)
+	}
+	if authorization == nil {
+		return ErrAuthorizationNotFound
+	}
+
+	oldPlan, err := s.plans.GetByPlanID(ctx, subscription.PlanID)
+	if err != nil {
+		return fmt.Errorf("get current plan: %w", err)
+	}
+	newPlan, err := s.plans.GetByPlanID(ctx, charge.PlanID)
+	if err != nil {
+		return fmt.Errorf("get upgrade plan: %w", err)
+	}
+	if oldPlan == nil || newPlan == nil {
+		return ErrPlanNotFound
+	}
+
+	return s.lifecycle.ApplyImmediateUpgrade(ctx, subscription, authorization, oldPlan, newPlan, charge, tx.SettledTxHash())
+}
+
+func (s *ChainService) confirmRevocation(ctx context.Context, tx *domain.ChainTransaction) error {
+	authorization, err := s.authorizations.GetByID(ctx, tx.AuthorizationID)
+	if err != nil {
+		return fmt.Errorf("get authorization by id: %w", err)
+	}
+	if authorization == nil {
+		return ErrAuthorizationNotFound
+	}
+	if authorization.PermitStatus == domain.AuthorizationRevoked {
+		return nil
+	}
 
+	return s.lifecycle.ApplyAuthorizationRevoked(ctx, authorization, tx)
+}
+
+// sendTracked broadcasts through send with the transaction recorded first:
+// persist stores the hash on the record it was submitted for and the tracker
+// row is written before the relayer broadcasts, so a crash in between cannot
+// leave a transaction nothing is waiting for. Senders that do not call back
+// before broadcasting are recorded once send returns; if that fails, the
+// hash is returned with the error because the transaction is out. A rejected
+// broadcast returns no hash and leaves its tracker row failed; the caller
+// undoes what persist stored.
+func (s *ChainService) sendTracked(
+	ctx context.Context,
+	kind domain.ChainTransactionKind,
+	subscriptionID, authorizationID, chargeRecordID string,
+	persist func(txHash string) error,
+	send func(ctx context.Context) (string, error),
+) (string, error) {
+	record := func(txHash string) error {
+		if persist != nil {
+			if err := persist(txHash); err != nil {
+				return err
+			}
+		}
+		return s.trackTransaction(ctx, kind, txHash, subscriptionID, authorizationID, chargeRecordID)
+	}
+
+	recorded := ""
+	txHash, err := send(blockchain.WithBeforeBroadcast(ctx, func(txHash string) error {
+		if err := record(txHash); err != nil {
+			return err
+		}
+		recorded = txHash
+		return nil
+	}))
+	if err != nil {
+		if recorded != "" {
+			s.untrackTransaction(ctx, recorded, err)
+		}
+		return "", err
+	}
+	if recorded != txHash {
+		if err := record(txHash); err != nil {
+			return txHash, err
+		}
+	}
+	return txHash, nil
+}
+
+// untrackTransaction finalizes the tracker row of a transaction the relayer
+// did not broadcast after all.
+func (s *ChainService) untrackTransaction(ctx context.Context, txHash string, cause error) {
+	tx, err := s.transactions.GetByHash(ctx, txHash)
+	if err != nil || tx == nil {
+		log.Printf("Failed to load unbroadcast transaction %s: %v", txHash, err)
+		return
+	}
+	tx.Status = domain.ChainTxFailed
+	tx.Error = "not broadcast: " + cause.Error()
+	tx.UpdatedAt = time.Now().UnixMilli()
+	if err := s.transactions.Update(tx); err != nil {
+		log.Printf("Failed to finalize unbroadcast transaction %s: %v", txHash, err)
+	}
+}
+
+// trackTransaction hands a transaction to the tracker. Re-signing with
+// unchanged fees reproduces the hash of a rejected attempt, whose row is then
+// tracked again.
+func (s *ChainService) trackTransaction(ctx context.Context, kind domain.ChainTransactionKind, txHash, subscriptionID, authorizationID, chargeRecordID string) error {
+	now := time.Now().UnixMilli()
+	existing, err := s.transactions.GetByHash(ctx, txHash)
+	if err != nil {
+		return fmt.Errorf("get %s transaction %s: %w", kind, txHash, err)
+	}
+	if existing != nil {
+		existing.Status = domain.ChainTxPending
+		existing.MinedTxHash = ""
+		existing.BlockNumber = 0
+		existing.BlockHash = ""
+		existing.Error = ""
+		existing.UpdatedAt = now
+		if err := s.transactions.Update(existing); err != nil {
+			return fmt.Errorf("track %s transaction %s: %w", kind, txHash, err)
+		}
+		return nil
+	}
+	if err := s.transactions.Create(&domain.ChainTransaction{
+		TxHash:          txHash,
+		Kind:            kind,
+		SubscriptionID:  subscriptionID,
+		AuthorizationID: authorizationID,
+		ChargeRecordID:  chargeRecordID,
+		Status:          domain.ChainTxPending,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}); err != nil {
+		return fmt.Errorf("track %s transaction %s: %w", kind, txHash, err)
+	}
 	return nil
 }
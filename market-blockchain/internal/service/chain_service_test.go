@@ -7,8 +7,11 @@ import (
 	"math/big"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 
 	"market-blockchain/internal/blockchain"
 	"market-blockchain/internal/domain"
@@ -21,6 +24,14 @@ type testChainContract struct {
 	chargeErr       error
 	authorizeCalls  int
 	chargeCalls     int
+	lastChargeID    [32]byte
+	permitNonce     int64
+	cancelTxHash    string
+	cancelCalls     int
+	lastCancel      [2]*big.Int
+	tokenAllowance  int64
+	vaultAllowance  int64
+	executed        map[[32]byte]bool
 }
 
 func (c *testChainContract) AuthorizeChargeWithPermit(ctx context.Context, identity common.Address, payer common.Address, expectedAllowance *big.Int, targetAllowance *big.Int, deadline *big.Int, sig blockchain.PermitSignature) (string, error) {
@@ -33,12 +44,43 @@ func (c *testChainContract) AuthorizeChargeWithPermit(ctx context.Context, ident
 
 func (c *testChainContract) Charge(ctx context.Context, chargeID [32]byte, identity common.Address, amount *big.Int) (string, error) {
 	c.chargeCalls++
+	c.lastChargeID = chargeID
 	if c.chargeErr != nil {
 		return "", c.chargeErr
 	}
 	return c.chargeTxHash, nil
 }
 
+func (c *testChainContract) CancelAuthorization(ctx context.Context, identity common.Address, payer common.Address, expectedAllowance *big.Int, targetAllowance *big.Int, deadline *big.Int, sig blockchain.PermitSignature) (string, error) {
+	c.cancelCalls++
+	c.lastCancel = [2]*big.Int{expectedAllowance, targetAllowance}
+	return c.cancelTxHash, nil
+}
+
+func (c *testChainContract) GetAuthorizedAllowance(ctx context.Context, payer common.Address, identity common.Address) (*big.Int, error) {
+	return big.NewInt(c.vaultAllowance), nil
+}
+
+func (c *testChainContract) IsChargeExecuted(ctx context.Context, chargeID [32]byte) (bool, error) {
+	return c.executed[chargeID], nil
+}
+
+func (c *testChainContract) TokenAllowance(ctx context.Context, owner common.Address) (*big.Int, error) {
+	return big.NewInt(c.tokenAllowance), nil
+}
+
+func (c *testChainContract) PermitDomain(ctx context.Context) (blockchain.PermitDomain, error) {
+	return blockchain.PermitDomain{Name: "USD Coin", Version: "2", ChainID: big.NewInt(84532), VerifyingContract: common.HexToAddress("0x00000000000000000000000000000000000000aa")}, nil
+}
+
+func (c *testChainContract) PermitNonce(ctx context.Context, owner common.Address) (*big.Int, error) {
+	return big.NewInt(c.permitNonce), nil
+}
+
+func (c *testChainContract) VaultAddress() common.Address {
+	return common.HexToAddress("0x00000000000000000000000000000000000000bb")
+}
+
 type testActivationSubscriptionRepo struct {
 	subscription *domain.Subscription
 	err          error
@@ -75,7 +117,14 @@ func (r *testActivationSubscriptionRepo) CountByPlanAndStatus(ctx context.Contex
 	return 0, nil
 }
 func (r *testActivationSubscriptionRepo) SearchByAddress(ctx context.Context, address string) ([]*domain.Subscription, error) {
-	return nil, nil
+	if r.subscription == nil || (r.subscription.IdentityAddress != address && r.subscription.PayerAddress != address) {
+		return nil, nil
+	}
+	return []*domain.Subscription{r.subscription}, nil
+}
+
+func (r *testActivationSubscriptionRepo) ExistsByIdentityAndPayer(ctx context.Context, identityAddress, payerAddress string) (bool, error) {
+	return r.subscription != nil && strings.EqualFold(r.subscription.IdentityAddress, identityAddress) && strings.EqualFold(r.subscription.PayerAddress, payerAddress), nil
 }
 
 type testActivationAuthorizationRepo struct {
@@ -109,12 +158,18 @@ func (r *testActivationAuthorizationRepo) GetByIdentityAndPlan(ctx context.Conte
 
 type testActivationChargeRepo struct {
 	charge    *domain.Charge
+	created   *domain.Charge
 	updated   *domain.Charge
 	getErr    error
 	updateErr error
 }
 
-func (r *testActivationChargeRepo) Create(charge *domain.Charge) error { return nil }
+func (r *testActivationChargeRepo) Create(charge *domain.Charge) error {
+	copy := *charge
+	r.created = &copy
+	r.charge = charge
+	return nil
+}
 func (r *testActivationChargeRepo) Update(charge *domain.Charge) error {
 	if r.updateErr != nil {
 		return r.updateErr
@@ -132,7 +187,15 @@ func (r *testActivationChargeRepo) GetByID(ctx context.Context, id string) (*dom
 	}
 	return nil, nil
 }
-func (r *testActivationChargeRepo) GetByChargeID(ctx context.Context, chargeID string) (*domain.Charge, error) { return nil, nil }
+func (r *testActivationChargeRepo) GetByChargeID(ctx context.Context, chargeID string) (*domain.Charge, error) {
+	if r.getErr != nil {
+		return nil, r.getErr
+	}
+	if r.charge != nil && r.charge.ChargeID == chargeID {
+		return r.charge, nil
+	}
+	return nil, nil
+}
 func (r *testActivationChargeRepo) ListByIdentity(ctx context.Context, identityAddress string) ([]*domain.Charge, error) {
 	return nil, nil
 }
@@ -173,9 +236,70 @@ type captureFirstChargeCompleter struct {
 	authorization *domain.Authorization
 	charge        *domain.Charge
 	event         *domain.Event
+	renewalTxHash string
+	upgradeTxHash string
+	failure       domain.RenewalFailureReason
 	err           error
 }
 
+func (c *captureFirstChargeCompleter) ApplyRenewalFailure(ctx context.Context, subscription *domain.Subscription, plan *domain.Plan, reason domain.RenewalFailureReason, detail string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.subscription = subscription
+	c.failure = reason
+	return nil
+}
+
+func (c *captureFirstChargeCompleter) ApplyRenewalSuccess(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, plan *domain.Plan, charge *domain.Charge, chargeTxHash string) error {
+	if c.err != nil {
+		return c.err
+	}
+	charge.Status = domain.ChargeCompleted
+	charge.TxHash = chargeTxHash
+	c.subscription = subscription
+	c.authorization = authorization
+	c.charge = charge
+	c.renewalTxHash = chargeTxHash
+	return nil
+}
+
+func (c *captureFirstChargeCompleter) ApplyImmediateUpgrade(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, oldPlan *domain.Plan, newPlan *domain.Plan, charge *domain.Charge, chargeTxHash string) error {
+	if c.err != nil {
+		return c.err
+	}
+	charge.Status = domain.ChargeCompleted
+	charge.TxHash = chargeTxHash
+	subscription.PlanID = newPlan.PlanID
+	c.subscription = subscription
+	c.authorization = authorization
+	c.charge = charge
+	c.upgradeTxHash = chargeTxHash
+	return nil
+}
+
+func (c *captureFirstChargeCompleter) RecordChargeFailure(ctx context.Context, charge *domain.Charge, subscriptionID, reason string) error {
+	if c.err != nil {
+		return c.err
+	}
+	charge.Status = domain.ChargeFailed
+	c.charge = charge
+	c.event = &domain.Event{Type: domain.EventChargeFailed, ChargeID: charge.ChargeID, Description: reason}
+	return nil
+}
+
+func (c *captureFirstChargeCompleter) ApplyAuthorizationRevoked(ctx context.Context, authorization *domain.Authorization, tx *domain.ChainTransaction) error {
+	if c.err != nil {
+		return c.err
+	}
+	authorization.PermitStatus = domain.AuthorizationRevoked
+	authorization.AuthorizedAllowance = 0
+	authorization.RemainingAllowance = 0
+	c.authorization = authorization
+	c.event = &domain.Event{Type: domain.EventAuthorizationRevoked, Metadata: fmt.Sprintf(`{"revoke_tx_hash":"%s"}`, tx.SettledTxHash())}
+	return nil
+}
+
 func (c *captureFirstChargeCompleter) CompleteFirstCharge(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, permitTxHash, chargeTxHash string) error {
 	if c.err != nil {
 		return c.err
@@ -213,50 +337,6 @@ func (c *captureFirstChargeCompleter) CompleteFirstCharge(ctx context.Context, s
 	return nil
 }
 
-func TestExecuteFirstChargeActivatesSubscription(t *testing.T) {
-	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "0x0000000000000000000000000000000000000001", PayerAddress: "0x0000000000000000000000000000000000000002", PlanID: "plan_1", Status: domain.SubscriptionPending, CurrentAuthorizationID: "auth_1", LastChargeID: "chain_charge_1"}
-	authorization := &domain.Authorization{ID: "auth_1", IdentityAddress: subscription.IdentityAddress, PayerAddress: subscription.PayerAddress, PlanID: subscription.PlanID, ExpectedAllowance: 1000, TargetAllowance: 2000, RemainingAllowance: 2000, PermitStatus: domain.AuthorizationPending, PermitDeadline: 1234}
-	charge := &domain.Charge{ID: "charge_record_1", ChargeID: "chain_charge_1", SubscriptionID: "sub_1", AuthorizationID: "auth_1", IdentityAddress: subscription.IdentityAddress, PayerAddress: subscription.PayerAddress, PlanID: subscription.PlanID, Amount: 300, Status: domain.ChargePending}
-	completer := &captureFirstChargeCompleter{}
-	service := NewChainService(
-		&testChainContract{authorizeTxHash: "0xpermit", chargeTxHash: "0xcharge"},
-		&testActivationSubscriptionRepo{subscription: subscription},
-		&testActivationAuthorizationRepo{authorization: authorization},
-		&testActivationChargeRepo{charge: charge},
-		&noopEventRepo{},
-		completer,
-	)
-
-	err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
-	if err != nil {
-		t.Fatalf("ExecuteFirstCharge returned error: %v", err)
-	}
-	if completer.subscription == nil || completer.authorization == nil || completer.charge == nil || completer.event == nil {
-		t.Fatal("expected completed state to be persisted")
-	}
-	if completer.subscription.Status != domain.SubscriptionActive {
-		t.Fatalf("expected subscription active, got %s", completer.subscription.Status)
-	}
-	if completer.authorization.PermitStatus != domain.AuthorizationCompleted {
-		t.Fatalf("expected authorization completed, got %s", completer.authorization.PermitStatus)
-	}
-	if completer.authorization.RemainingAllowance != 1700 {
-		t.Fatalf("unexpected remaining allowance: %d", completer.authorization.RemainingAllowance)
-	}
-	if completer.charge.Status != domain.ChargeCompleted {
-		t.Fatalf("expected charge completed, got %s", completer.charge.Status)
-	}
-	if completer.charge.TxHash != "0xcharge" {
-		t.Fatalf("unexpected charge tx hash: %s", completer.charge.TxHash)
-	}
-	if completer.event.Type != domain.EventChargeSuccess {
-		t.Fatalf("unexpected event type: %s", completer.event.Type)
-	}
-	if !strings.Contains(completer.event.Metadata, `"subscription_id":"sub_1"`) {
-		t.Fatalf("event metadata missing subscription id: %s", completer.event.Metadata)
-	}
-}
-
 func TestExecuteFirstChargeRejectsNonPendingSubscription(t *testing.T) {
 	contract := &testChainContract{}
 	service := NewChainService(
@@ -265,10 +345,12 @@ func TestExecuteFirstChargeRejectsNonPendingSubscription(t *testing.T) {
 		&testActivationAuthorizationRepo{authorization: &domain.Authorization{ID: "auth_1", IdentityAddress: "0x0000000000000000000000000000000000000001", PayerAddress: "0x0000000000000000000000000000000000000002", PlanID: "plan_1", PermitStatus: domain.AuthorizationPending}},
 		&testActivationChargeRepo{charge: &domain.Charge{ID: "charge_record_1", ChargeID: "chain_charge_1", SubscriptionID: "sub_1", AuthorizationID: "auth_1", Status: domain.ChargePending}},
 		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
 		&captureFirstChargeCompleter{},
 	)
 
-	err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
+	_, err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
 	if err == nil || err.Error() != "invalid subscription status for first charge: active" {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -285,10 +367,12 @@ func TestExecuteFirstChargeRejectsNonPendingCharge(t *testing.T) {
 		&testActivationAuthorizationRepo{authorization: &domain.Authorization{ID: "auth_1", IdentityAddress: "0x0000000000000000000000000000000000000001", PayerAddress: "0x0000000000000000000000000000000000000002", PlanID: "plan_1", PermitStatus: domain.AuthorizationPending}},
 		&testActivationChargeRepo{charge: &domain.Charge{ID: "charge_record_1", ChargeID: "chain_charge_1", SubscriptionID: "sub_1", AuthorizationID: "auth_1", Status: domain.ChargeCompleted}},
 		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
 		&captureFirstChargeCompleter{},
 	)
 
-	err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
+	_, err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
 	if err == nil || err.Error() != "invalid charge status for first charge: completed" {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -305,10 +389,12 @@ func TestExecuteFirstChargeRejectsNonPendingAuthorization(t *testing.T) {
 		&testActivationAuthorizationRepo{authorization: &domain.Authorization{ID: "auth_1", IdentityAddress: "0x0000000000000000000000000000000000000001", PayerAddress: "0x0000000000000000000000000000000000000002", PlanID: "plan_1", PermitStatus: domain.AuthorizationCompleted}},
 		&testActivationChargeRepo{charge: &domain.Charge{ID: "charge_record_1", ChargeID: "chain_charge_1", SubscriptionID: "sub_1", AuthorizationID: "auth_1", Status: domain.ChargePending}},
 		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
 		&captureFirstChargeCompleter{},
 	)
 
-	err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
+	_, err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
 	if err == nil || err.Error() != "invalid authorization status for first charge: completed" {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -324,10 +410,12 @@ func TestExecuteFirstChargeFailsWhenAuthorizationMissing(t *testing.T) {
 		&testActivationAuthorizationRepo{},
 		&testActivationChargeRepo{},
 		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
 		&captureFirstChargeCompleter{},
 	)
 
-	err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "missing", ChargeRecordID: "charge_record_1"})
+	_, err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "missing", ChargeRecordID: "charge_record_1"})
 	if err == nil || err.Error() != "authorization not found" {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -340,49 +428,168 @@ func TestExecuteFirstChargeFailsWhenChargeMissing(t *testing.T) {
 		&testActivationAuthorizationRepo{authorization: &domain.Authorization{ID: "auth_1"}},
 		&testActivationChargeRepo{},
 		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
 		&captureFirstChargeCompleter{},
 	)
 
-	err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "missing"})
+	_, err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "missing"})
 	if err == nil || err.Error() != "charge not found" {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
 
-func TestExecuteFirstChargeReturnsPersistenceError(t *testing.T) {
+func newFirstChargeFixture() (*domain.Subscription, *domain.Authorization, *domain.Charge) {
 	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "0x0000000000000000000000000000000000000001", PayerAddress: "0x0000000000000000000000000000000000000002", PlanID: "plan_1", Status: domain.SubscriptionPending, CurrentAuthorizationID: "auth_1", LastChargeID: "chain_charge_1"}
 	authorization := &domain.Authorization{ID: "auth_1", IdentityAddress: subscription.IdentityAddress, PayerAddress: subscription.PayerAddress, PlanID: subscription.PlanID, ExpectedAllowance: 1000, TargetAllowance: 2000, RemainingAllowance: 2000, PermitStatus: domain.AuthorizationPending, PermitDeadline: 1234}
 	charge := &domain.Charge{ID: "charge_record_1", ChargeID: "chain_charge_1", SubscriptionID: "sub_1", AuthorizationID: "auth_1", IdentityAddress: subscription.IdentityAddress, PayerAddress: subscription.PayerAddress, PlanID: subscription.PlanID, Amount: 300, Status: domain.ChargePending}
+	return subscription, authorization, charge
+}
+
+func TestExecuteFirstChargeSubmitsPermitAndWaitsForConfirmation(t *testing.T) {
+	subscription, authorization, charge := newFirstChargeFixture()
+	contract := &testChainContract{authorizeTxHash: "0xpermit", chargeTxHash: "0xcharge"}
+	authorizationRepo := &testActivationAuthorizationRepo{authorization: authorization}
+	transactions := &testChainTransactionRepo{}
+	completer := &captureFirstChargeCompleter{}
+	service := NewChainService(
+		contract,
+		&testActivationSubscriptionRepo{subscription: subscription},
+		authorizationRepo,
+		&testActivationChargeRepo{charge: charge},
+		&noopEventRepo{},
+		&testPlanRepo{},
+		transactions,
+		completer,
+	)
+
+	_, err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
+	if err != nil {
+		t.Fatalf("ExecuteFirstCharge returned error: %v", err)
+	}
+	if contract.authorizeCalls != 1 || contract.chargeCalls != 0 {
+		t.Fatalf("expected only the permit to be submitted, got authorize=%d charge=%d", contract.authorizeCalls, contract.chargeCalls)
+	}
+	if completer.subscription != nil {
+		t.Fatal("expected activation to wait for confirmation")
+	}
+	if authorizationRepo.updated == nil || authorizationRepo.updated.PermitTxHash != "0xpermit" {
+		t.Fatalf("expected permit tx hash to be persisted, got %+v", authorizationRepo.updated)
+	}
+	if authorizationRepo.updated.PermitStatus != domain.AuthorizationPending {
+		t.Fatalf("expected authorization to stay pending, got %s", authorizationRepo.updated.PermitStatus)
+	}
+	if len(transactions.created) != 1 || transactions.created[0].Kind != domain.ChainTxPermit || transactions.created[0].TxHash != "0xpermit" {
+		t.Fatalf("expected permit transaction to be tracked, got %+v", transactions.created)
+	}
+
+	_, err = service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
+	if err == nil || !strings.Contains(err.Error(), "permit already submitted") {
+		t.Fatalf("expected resubmission to be rejected, got %v", err)
+	}
+	if contract.authorizeCalls != 1 {
+		t.Fatal("expected no second permit submission")
+	}
+}
+
+func TestHandleTransactionConfirmedActivatesAfterFirstChargeConfirms(t *testing.T) {
+	subscription, authorization, charge := newFirstChargeFixture()
+	authorization.PermitTxHash = "0xpermit"
+	contract := &testChainContract{chargeTxHash: "0xcharge"}
+	transactions := &testChainTransactionRepo{}
+	completer := &captureFirstChargeCompleter{}
+	service := NewChainService(
+		contract,
+		&testActivationSubscriptionRepo{subscription: subscription},
+		&testActivationAuthorizationRepo{authorization: authorization},
+		&testActivationChargeRepo{charge: charge},
+		&noopEventRepo{},
+		&testPlanRepo{},
+		transactions,
+		completer,
+	)
+
+	permitTx := &domain.ChainTransaction{TxHash: "0xpermit", Kind: domain.ChainTxPermit, SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"}
+	if err := service.HandleTransactionConfirmed(context.Background(), permitTx); err != nil {
+		t.Fatalf("HandleTransactionConfirmed(permit) returned error: %v", err)
+	}
+	if authorization.PermitStatus != domain.AuthorizationCompleted {
+		t.Fatalf("expected authorization completed after permit confirmation, got %s", authorization.PermitStatus)
+	}
+	if contract.chargeCalls != 1 || charge.TxHash != "0xcharge" {
+		t.Fatalf("expected first charge to be submitted, got calls=%d tx=%s", contract.chargeCalls, charge.TxHash)
+	}
+	if completer.subscription != nil {
+		t.Fatal("expected activation to wait for the charge confirmation")
+	}
+	if len(transactions.created) != 1 || transactions.created[0].Kind != domain.ChainTxFirstCharge {
+		t.Fatalf("expected first charge transaction to be tracked, got %+v", transactions.created)
+	}
+
+	if err := service.HandleTransactionConfirmed(context.Background(), permitTx); err != nil {
+		t.Fatalf("repeated permit confirmation returned error: %v", err)
+	}
+	if contract.chargeCalls != 1 {
+		t.Fatal("expected repeated permit confirmation not to resubmit the charge")
+	}
+
+	if err := service.HandleTransactionConfirmed(context.Background(), transactions.created[0]); err != nil {
+		t.Fatalf("HandleTransactionConfirmed(first_charge) returned error: %v", err)
+	}
+	if completer.subscription == nil || completer.subscription.Status != domain.SubscriptionActive {
+		t.Fatal("expected subscription to be activated")
+	}
+	if completer.authorization.RemainingAllowance != 1700 {
+		t.Fatalf("unexpected remaining allowance: %d", completer.authorization.RemainingAllowance)
+	}
+	if completer.charge.Status != domain.ChargeCompleted || completer.charge.TxHash != "0xcharge" {
+		t.Fatalf("unexpected charge state: %s %s", completer.charge.Status, completer.charge.TxHash)
+	}
+	if !strings.Contains(completer.event.Metadata, `"permit_tx_hash":"0xpermit"`) {
+		t.Fatalf("event metadata missing permit tx hash: %s", completer.event.Metadata)
+	}
+}
+
+func TestHandleTransactionConfirmedReturnsPersistenceError(t *testing.T) {
+	subscription, authorization, charge := newFirstChargeFixture()
+	charge.TxHash = "0xcharge"
 	service := NewChainService(
-		&testChainContract{authorizeTxHash: "0xpermit", chargeTxHash: "0xcharge"},
+		&testChainContract{},
 		&testActivationSubscriptionRepo{subscription: subscription},
 		&testActivationAuthorizationRepo{authorization: authorization},
 		&testActivationChargeRepo{charge: charge},
 		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
 		&captureFirstChargeCompleter{err: errors.New("persist failed")},
 	)
 
-	err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
+	err := service.HandleTransactionConfirmed(context.Background(), &domain.ChainTransaction{TxHash: "0xcharge", Kind: domain.ChainTxFirstCharge, SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
 	if err == nil || err.Error() != "persist failed" {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
 
-func TestExecuteFirstChargePersistsAuthorizationSuccessWhenChainChargeFails(t *testing.T) {
-	authorizationRepo := &testActivationAuthorizationRepo{authorization: &domain.Authorization{ID: "auth_1", IdentityAddress: "0x0000000000000000000000000000000000000001", PayerAddress: "0x0000000000000000000000000000000000000002", PlanID: "plan_1", ExpectedAllowance: 1000, TargetAllowance: 2000, RemainingAllowance: 2000, PermitStatus: domain.AuthorizationPending, PermitDeadline: 1234}}
-	chargeRepo := &testActivationChargeRepo{charge: &domain.Charge{ID: "charge_record_1", ChargeID: "chain_charge_1", SubscriptionID: "sub_1", AuthorizationID: "auth_1", Amount: 300, Status: domain.ChargePending}}
+func TestConfirmPermitPersistsAuthorizationSuccessWhenChainChargeFails(t *testing.T) {
+	subscription, authorization, charge := newFirstChargeFixture()
+	authorizationRepo := &testActivationAuthorizationRepo{authorization: authorization}
+	chargeRepo := &testActivationChargeRepo{charge: charge}
+	transactions := &testChainTransactionRepo{}
+	completer := &captureFirstChargeCompleter{}
 	service := NewChainService(
-		&testChainContract{authorizeTxHash: "0xpermit", chargeErr: errors.New("chain down")},
-		&testActivationSubscriptionRepo{subscription: &domain.Subscription{ID: "sub_1", IdentityAddress: "0x0000000000000000000000000000000000000001", PayerAddress: "0x0000000000000000000000000000000000000002", PlanID: "plan_1", Status: domain.SubscriptionPending, CurrentAuthorizationID: "auth_1", LastChargeID: "chain_charge_1"}},
+		&testChainContract{chargeErr: errors.New("chain down")},
+		&testActivationSubscriptionRepo{subscription: subscription},
 		authorizationRepo,
 		chargeRepo,
 		&noopEventRepo{},
-		&captureFirstChargeCompleter{},
+		&testPlanRepo{},
+		transactions,
+		completer,
 	)
 
-	err := service.ExecuteFirstCharge(context.Background(), ExecuteFirstChargeInput{SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
-	if err == nil || !strings.Contains(err.Error(), "charge: chain down") {
-		t.Fatalf("unexpected error: %v", err)
+	err := service.HandleTransactionConfirmed(context.Background(), &domain.ChainTransaction{TxHash: "0xpermit", Kind: domain.ChainTxPermit, SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
+	if err != nil {
+		t.Fatalf("HandleTransactionConfirmed returned error: %v", err)
 	}
 	if authorizationRepo.updated == nil {
 		t.Fatal("expected authorization success to be persisted")
@@ -399,10 +606,582 @@ func TestExecuteFirstChargePersistsAuthorizationSuccessWhenChainChargeFails(t *t
 	if authorizationRepo.updated.RemainingAllowance != 2000 {
 		t.Fatalf("expected remaining allowance unchanged, got %d", authorizationRepo.updated.RemainingAllowance)
 	}
-	if chargeRepo.updated == nil {
-		t.Fatal("expected failed charge to be persisted")
+	if completer.charge == nil || completer.event == nil || completer.event.Type != domain.EventChargeFailed {
+		t.Fatal("expected the charge failure recorded with its event")
+	}
+	if completer.charge.Status != domain.ChargeFailed {
+		t.Fatalf("expected charge failed, got %s", completer.charge.Status)
+	}
+	if len(transactions.created) != 0 {
+		t.Fatal("expected no transaction to be tracked for a failed submission")
+	}
+}
+
+func TestHandleTransactionFailedMarksPermitAndChargeFailed(t *testing.T) {
+	subscription, authorization, charge := newFirstChargeFixture()
+	authorization.PermitTxHash = "0xpermit"
+	authorizationRepo := &testActivationAuthorizationRepo{authorization: authorization}
+	chargeRepo := &testActivationChargeRepo{charge: charge}
+	completer := &captureFirstChargeCompleter{}
+	service := NewChainService(
+		&testChainContract{},
+		&testActivationSubscriptionRepo{subscription: subscription},
+		authorizationRepo,
+		chargeRepo,
+		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
+		completer,
+	)
+
+	err := service.HandleTransactionFailed(context.Background(), &domain.ChainTransaction{TxHash: "0xpermit", Kind: domain.ChainTxPermit, SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
+	if err != nil {
+		t.Fatalf("HandleTransactionFailed returned error: %v", err)
+	}
+	if authorizationRepo.updated == nil || authorizationRepo.updated.PermitStatus != domain.AuthorizationFailed {
+		t.Fatalf("expected authorization failed, got %+v", authorizationRepo.updated)
+	}
+	if completer.charge == nil || completer.charge.Status != domain.ChargeFailed {
+		t.Fatalf("expected charge failed, got %+v", completer.charge)
+	}
+}
+
+func newRenewalFixture() (*domain.Subscription, *domain.Authorization, *domain.Plan) {
+	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "0x0000000000000000000000000000000000000001", PayerAddress: "0x0000000000000000000000000000000000000002", PlanID: "plan_1", Status: domain.SubscriptionActive, AutoRenew: true, CurrentPeriodStart: 1000, CurrentPeriodEnd: 2000, CurrentAuthorizationID: "auth_1"}
+	authorization := &domain.Authorization{ID: "auth_1", IdentityAddress: subscription.IdentityAddress, PayerAddress: subscription.PayerAddress, PlanID: "plan_1", RemainingAllowance: 2000, PermitStatus: domain.AuthorizationCompleted}
+	plan := &domain.Plan{PlanID: "plan_1", Name: "Monthly", PeriodSeconds: 60, AmountUSDCBaseUnits: 300, Active: true}
+	return subscription, authorization, plan
+}
+
+func TestExecuteRenewalChargeChargesOnChainBeforeRenewing(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	contract := &testChainContract{chargeTxHash: "0xrenewal"}
+	chargeRepo := &testActivationChargeRepo{}
+	transactions := &testChainTransactionRepo{}
+	completer := &captureFirstChargeCompleter{}
+	service := NewChainService(
+		contract,
+		&testActivationSubscriptionRepo{subscription: subscription},
+		&testActivationAuthorizationRepo{authorization: authorization},
+		chargeRepo,
+		&noopEventRepo{},
+		&testPlanRepo{plan: plan},
+		transactions,
+		completer,
+	)
+
+	err := service.ExecuteRenewalCharge(context.Background(), ExecuteRenewalChargeInput{Subscription: subscription, Authorization: authorization, Plan: plan})
+	if err != nil {
+		t.Fatalf("ExecuteRenewalCharge returned error: %v", err)
+	}
+	if chargeRepo.created == nil {
+		t.Fatal("expected pending charge to be persisted before submission")
+	}
+	if chargeRepo.created.Status != domain.ChargePending || chargeRepo.created.TxHash != "" {
+		t.Fatalf("expected unsubmitted pending charge, got %s %q", chargeRepo.created.Status, chargeRepo.created.TxHash)
+	}
+	if chargeRepo.created.ChargeID != RenewalChargeID("sub_1", 2000) {
+		t.Fatalf("unexpected charge id: %s", chargeRepo.created.ChargeID)
+	}
+	if contract.chargeCalls != 1 {
+		t.Fatalf("expected one chain charge, got %d", contract.chargeCalls)
+	}
+	if contract.lastChargeID != blockchain.ChargeIDBytes(RenewalChargeID("sub_1", 2000)) {
+		t.Fatal("chain charge id does not match the deterministic renewal charge id")
+	}
+	if completer.charge != nil {
+		t.Fatal("expected renewal to wait for confirmation")
+	}
+	if len(transactions.created) != 1 || transactions.created[0].Kind != domain.ChainTxRenewalCharge || transactions.created[0].TxHash != "0xrenewal" {
+		t.Fatalf("expected renewal charge to be tracked, got %+v", transactions.created)
+	}
+
+	if err := service.HandleTransactionConfirmed(context.Background(), transactions.created[0]); err != nil {
+		t.Fatalf("HandleTransactionConfirmed returned error: %v", err)
+	}
+	if completer.renewalTxHash != "0xrenewal" {
+		t.Fatalf("expected renewal to be applied with chain tx hash, got %q", completer.renewalTxHash)
+	}
+	if completer.charge.Amount != 300 {
+		t.Fatalf("unexpected charge amount: %d", completer.charge.Amount)
+	}
+}
+
+func TestExecuteRenewalChargeRecordsFailureWithoutRenewing(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	chargeRepo := &testActivationChargeRepo{}
+	transactions := &testChainTransactionRepo{}
+	completer := &captureFirstChargeCompleter{}
+	service := NewChainService(&testChainContract{chargeErr: errors.New("insufficient allowance")}, &testActivationSubscriptionRepo{}, &testActivationAuthorizationRepo{}, chargeRepo, &noopEventRepo{}, &testPlanRepo{}, transactions, completer)
+
+	err := service.ExecuteRenewalCharge(context.Background(), ExecuteRenewalChargeInput{Subscription: subscription, Authorization: authorization, Plan: plan})
+	if !errors.Is(err, ErrChargeRejected) || !strings.Contains(err.Error(), "insufficient allowance") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if chargeRepo.updated == nil || chargeRepo.updated.Status != domain.ChargeFailed {
+		t.Fatalf("expected failed charge to be persisted, got %+v", chargeRepo.updated)
+	}
+	if completer.charge != nil {
+		t.Fatal("expected renewal not to be applied when chain charge fails")
+	}
+	if len(transactions.created) != 0 {
+		t.Fatal("expected no transaction to be tracked for a failed submission")
+	}
+	if subscription.CurrentPeriodEnd != 2000 {
+		t.Fatalf("expected period unchanged, got %d", subscription.CurrentPeriodEnd)
+	}
+}
+
+func TestExecuteRenewalChargeRetriesFailedChargeWithSameID(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	existing := &domain.Charge{ID: "charge_record_1", ChargeID: RenewalChargeID("sub_1", 2000), SubscriptionID: "sub_1", Amount: 300, Status: domain.ChargeFailed}
+	contract := &testChainContract{chargeTxHash: "0xretry"}
+	chargeRepo := &testActivationChargeRepo{charge: existing}
+	service := NewChainService(contract, &testActivationSubscriptionRepo{}, &testActivationAuthorizationRepo{}, chargeRepo, &noopEventRepo{}, &testPlanRepo{}, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+
+	err := service.ExecuteRenewalCharge(context.Background(), ExecuteRenewalChargeInput{Subscription: subscription, Authorization: authorization, Plan: plan})
+	if err != nil {
+		t.Fatalf("ExecuteRenewalCharge returned error: %v", err)
+	}
+	if chargeRepo.created != nil {
+		t.Fatal("expected failed charge record to be reused")
+	}
+	if contract.chargeCalls != 1 {
+		t.Fatalf("expected one chain charge, got %d", contract.chargeCalls)
+	}
+	if chargeRepo.updated == nil || chargeRepo.updated.Status != domain.ChargePending || chargeRepo.updated.TxHash != "0xretry" {
+		t.Fatalf("expected existing charge to be resubmitted, got %+v", chargeRepo.updated)
+	}
+}
+
+func TestExecuteRenewalChargeSkipsChargeAlreadySubmitted(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	existing := &domain.Charge{ID: "charge_record_1", ChargeID: RenewalChargeID("sub_1", 2000), SubscriptionID: "sub_1", Amount: 300, Status: domain.ChargePending, TxHash: "0xinflight"}
+	contract := &testChainContract{chargeTxHash: "0xsecond"}
+	service := NewChainService(contract, &testActivationSubscriptionRepo{}, &testActivationAuthorizationRepo{}, &testActivationChargeRepo{charge: existing}, &noopEventRepo{}, &testPlanRepo{}, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+
+	err := service.ExecuteRenewalCharge(context.Background(), ExecuteRenewalChargeInput{Subscription: subscription, Authorization: authorization, Plan: plan})
+	if !errors.Is(err, ErrChargeInFlight) {
+		t.Fatalf("expected ErrChargeInFlight, got %v", err)
+	}
+	if contract.chargeCalls != 0 {
+		t.Fatal("expected no second chain charge for the same period")
+	}
+}
+
+func TestExecuteRenewalChargeWaitsForUpgradeInFlight(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	upgrade := &domain.Charge{ID: "charge_record_1", ChargeID: UpgradeChargeID("sub_1", "plan_pro", 2000), SubscriptionID: "sub_1", Amount: 100, Status: domain.ChargePending, Reason: string(domain.EventUpgrade), TxHash: "0xupgrade"}
+	contract := &testChainContract{chargeTxHash: "0xrenewal"}
+	charges := &upgradeTestChargeRepo{bySubscription: []*domain.Charge{upgrade}}
+	service := NewChainService(contract, &testActivationSubscriptionRepo{}, &testActivationAuthorizationRepo{}, charges, &noopEventRepo{}, &testPlanRepo{}, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+
+	err := service.ExecuteRenewalCharge(context.Background(), ExecuteRenewalChargeInput{Subscription: subscription, Authorization: authorization, Plan: plan})
+	if !errors.Is(err, ErrChargeInFlight) {
+		t.Fatalf("expected ErrChargeInFlight, got %v", err)
+	}
+	if contract.chargeCalls != 0 || charges.created != nil {
+		t.Fatal("expected no renewal charge while the upgrade is in flight")
+	}
+}
+
+func TestHandleTransactionFailedCountsRevertedRenewalAsFailedAttempt(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	charge := &domain.Charge{ID: "charge_record_1", ChargeID: RenewalChargeID("sub_1", 2000), SubscriptionID: "sub_1", PlanID: "plan_1", Amount: 300, Status: domain.ChargePending, TxHash: "0xrenewal"}
+	chargeRepo := &testActivationChargeRepo{charge: charge}
+	completer := &captureFirstChargeCompleter{}
+	service := NewChainService(&testChainContract{}, &testActivationSubscriptionRepo{subscription: subscription}, &testActivationAuthorizationRepo{authorization: authorization}, chargeRepo, &noopEventRepo{}, &testPlanRepo{plan: plan}, &testChainTransactionRepo{}, completer)
+
+	err := service.HandleTransactionFailed(context.Background(), &domain.ChainTransaction{TxHash: "0xrenewal", Kind: domain.ChainTxRenewalCharge, SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
+	if err != nil {
+		t.Fatalf("HandleTransactionFailed returned error: %v", err)
+	}
+	if completer.failure != domain.RenewalFailureChargeReverted || completer.subscription != subscription {
+		t.Fatalf("expected a reverted renewal attempt recorded, got %q", completer.failure)
+	}
+	if completer.charge == nil || completer.charge.Status != domain.ChargeFailed {
+		t.Fatalf("expected charge failed, got %+v", completer.charge)
+	}
+}
+
+func TestHandleTransactionConfirmedRecordsMinedReplacementHash(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	charge := &domain.Charge{ID: "charge_record_1", ChargeID: RenewalChargeID("sub_1", 2000), SubscriptionID: "sub_1", AuthorizationID: "auth_1", PlanID: "plan_1", Amount: 300, Status: domain.ChargePending, TxHash: "0xoriginal"}
+	completer := &captureFirstChargeCompleter{}
+	service := NewChainService(&testChainContract{}, &testActivationSubscriptionRepo{subscription: subscription}, &testActivationAuthorizationRepo{authorization: authorization}, &testActivationChargeRepo{charge: charge}, &noopEventRepo{}, &testPlanRepo{plan: plan}, &testChainTransactionRepo{}, completer)
+
+	err := service.HandleTransactionConfirmed(context.Background(), &domain.ChainTransaction{TxHash: "0xoriginal", MinedTxHash: "0xbumped", Kind: domain.ChainTxRenewalCharge, Status: domain.ChainTxMined, SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
+	if err != nil {
+		t.Fatalf("HandleTransactionConfirmed returned error: %v", err)
+	}
+	if completer.renewalTxHash != "0xbumped" {
+		t.Fatalf("expected the renewal recorded under the mined hash, got %q", completer.renewalTxHash)
+	}
+}
+
+func TestHandleTransactionFailedCountsDroppedRenewalAsFailedAttempt(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	charge := &domain.Charge{ID: "charge_record_1", ChargeID: RenewalChargeID("sub_1", 2000), SubscriptionID: "sub_1", PlanID: "plan_1", Amount: 300, Status: domain.ChargePending, TxHash: "0xrenewal"}
+	chargeRepo := &testActivationChargeRepo{charge: charge}
+	completer := &captureFirstChargeCompleter{}
+	service := NewChainService(&testChainContract{}, &testActivationSubscriptionRepo{subscription: subscription}, &testActivationAuthorizationRepo{authorization: authorization}, chargeRepo, &noopEventRepo{}, &testPlanRepo{plan: plan}, &testChainTransactionRepo{}, completer)
+
+	err := service.HandleTransactionFailed(context.Background(), &domain.ChainTransaction{TxHash: "0xrenewal", Kind: domain.ChainTxRenewalCharge, Status: domain.ChainTxDropped, Error: "not mined within 1h0m0s", SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"})
+	if err != nil {
+		t.Fatalf("HandleTransactionFailed returned error: %v", err)
+	}
+	if completer.failure != domain.RenewalFailureChargeDropped {
+		t.Fatalf("expected a dropped renewal attempt recorded, got %q", completer.failure)
+	}
+	if completer.charge == nil || completer.charge.Status != domain.ChargeFailed {
+		t.Fatalf("expected charge failed so it can be resubmitted, got %+v", completer.charge)
+	}
+}
+
+func TestChargeExecutedLooksUpTheChargeKeyOnChain(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	charge := &domain.Charge{ID: "charge_record_1", ChargeID: RenewalChargeID("sub_1", 2000), SubscriptionID: "sub_1", PlanID: "plan_1", Amount: 300, Status: domain.ChargePending, TxHash: "0xrenewal"}
+	contract := &testChainContract{executed: map[[32]byte]bool{blockchain.ChargeKey(charge): true}}
+	service := NewChainService(contract, &testActivationSubscriptionRepo{subscription: subscription}, &testActivationAuthorizationRepo{authorization: authorization}, &testActivationChargeRepo{charge: charge}, &noopEventRepo{}, &testPlanRepo{plan: plan}, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+
+	executed, err := service.ChargeExecuted(context.Background(), &domain.ChainTransaction{TxHash: "0xrenewal", Kind: domain.ChainTxRenewalCharge, ChargeRecordID: "charge_record_1"})
+	if err != nil || !executed {
+		t.Fatalf("expected the renewal charge reported as executed, got %v %v", executed, err)
+	}
+	executed, err = service.ChargeExecuted(context.Background(), &domain.ChainTransaction{TxHash: "0xrevoke", Kind: domain.ChainTxRevocation, AuthorizationID: "auth_1"})
+	if err != nil || executed {
+		t.Fatalf("expected a revocation to carry no charge, got %v %v", executed, err)
+	}
+}
+
+// signTestPermit signs the permit the service will expect for authorization
+// and points the authorization at the signing key.
+func signTestPermit(t *testing.T, contract *testChainContract, authorization *domain.Authorization) blockchain.PermitSignature {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	authorization.PayerAddress = owner.Hex()
+
+	permitDomain, _ := contract.PermitDomain(context.Background())
+	typedData := blockchain.PermitTypedData(permitDomain, blockchain.PermitMessage{
+		Owner:    owner,
+		Spender:  contract.VaultAddress(),
+		Value:    big.NewInt(authorization.TargetAllowance),
+		Nonce:    big.NewInt(contract.permitNonce),
+		Deadline: big.NewInt(authorization.PermitDeadline),
+	})
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		t.Fatalf("hash typed data: %v", err)
+	}
+	raw, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatalf("sign permit: %v", err)
+	}
+	sig, err := blockchain.SplitPermitSignature(raw)
+	if err != nil {
+		t.Fatalf("split signature: %v", err)
+	}
+	return sig
+}
+
+func validPermitSignature() blockchain.PermitSignature {
+	sig := blockchain.PermitSignature{V: 27}
+	sig.R[31] = 1
+	sig.S[31] = 1
+	return sig
+}
+
+func TestActivateSubscriptionResolvesRecordsAndSubmitsPermit(t *testing.T) {
+	subscription, authorization, charge := newFirstChargeFixture()
+	authorization.PermitDeadline = time.Now().Add(time.Hour).Unix()
+	contract := &testChainContract{authorizeTxHash: "0xpermit", permitNonce: 3}
+	sig := signTestPermit(t, contract, authorization)
+	service := NewChainService(
+		contract,
+		&testActivationSubscriptionRepo{subscription: subscription},
+		&testActivationAuthorizationRepo{authorization: authorization},
+		&testActivationChargeRepo{charge: charge},
+		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
+		&captureFirstChargeCompleter{},
+	)
+
+	result, err := service.ActivateSubscription(context.Background(), "sub_1", sig)
+	if err != nil {
+		t.Fatalf("ActivateSubscription returned error: %v", err)
+	}
+	if contract.authorizeCalls != 1 {
+		t.Fatalf("expected permit to be submitted once, got %d", contract.authorizeCalls)
+	}
+	if result.PermitTxHash != "0xpermit" || result.Charge.ID != "charge_record_1" || result.Authorization.ID != "auth_1" {
+		t.Fatalf("unexpected activation result: %+v", result)
+	}
+}
+
+func TestActivateSubscriptionRejectsPermitFromOtherSigner(t *testing.T) {
+	subscription, authorization, charge := newFirstChargeFixture()
+	authorization.PermitDeadline = time.Now().Add(time.Hour).Unix()
+	contract := &testChainContract{permitNonce: 3}
+	sig := signTestPermit(t, contract, authorization)
+	authorization.PayerAddress = "0x0000000000000000000000000000000000000002"
+	service := NewChainService(
+		contract,
+		&testActivationSubscriptionRepo{subscription: subscription},
+		&testActivationAuthorizationRepo{authorization: authorization},
+		&testActivationChargeRepo{charge: charge},
+		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
+		&captureFirstChargeCompleter{},
+	)
+
+	_, err := service.ActivateSubscription(context.Background(), "sub_1", sig)
+	if !errors.Is(err, ErrPermitSignerMismatch) {
+		t.Fatalf("expected ErrPermitSignerMismatch, got %v", err)
+	}
+	if contract.authorizeCalls != 0 {
+		t.Fatal("expected no permit to be submitted")
+	}
+}
+
+func TestActivateSubscriptionRejectsPermitSignedForStaleNonce(t *testing.T) {
+	subscription, authorization, charge := newFirstChargeFixture()
+	authorization.PermitDeadline = time.Now().Add(time.Hour).Unix()
+	contract := &testChainContract{permitNonce: 3}
+	sig := signTestPermit(t, contract, authorization)
+	contract.permitNonce = 4
+	service := NewChainService(
+		contract,
+		&testActivationSubscriptionRepo{subscription: subscription},
+		&testActivationAuthorizationRepo{authorization: authorization},
+		&testActivationChargeRepo{charge: charge},
+		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
+		&captureFirstChargeCompleter{},
+	)
+
+	_, err := service.ActivateSubscription(context.Background(), "sub_1", sig)
+	if !errors.Is(err, ErrPermitSignerMismatch) {
+		t.Fatalf("expected ErrPermitSignerMismatch, got %v", err)
+	}
+}
+
+func TestPreparePermitBuildsTypedDataForPendingAuthorization(t *testing.T) {
+	subscription, authorization, _ := newFirstChargeFixture()
+	contract := &testChainContract{permitNonce: 7}
+	service := NewChainService(
+		contract,
+		&testActivationSubscriptionRepo{subscription: subscription},
+		&testActivationAuthorizationRepo{authorization: authorization},
+		&testActivationChargeRepo{},
+		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
+		&captureFirstChargeCompleter{},
+	)
+
+	payload, err := service.PreparePermit(context.Background(), "sub_1")
+	if err != nil {
+		t.Fatalf("PreparePermit returned error: %v", err)
+	}
+	msg := payload.TypedData.Message
+	if msg["owner"] != common.HexToAddress(authorization.PayerAddress).Hex() || msg["spender"] != contract.VaultAddress().Hex() {
+		t.Fatalf("unexpected permit parties: %+v", msg)
+	}
+	if msg["value"] != "2000" || msg["nonce"] != "7" || msg["deadline"] != "1234" {
+		t.Fatalf("unexpected permit values: %+v", msg)
+	}
+	if payload.TypedData.Domain.Name != "USD Coin" || payload.TypedData.PrimaryType != "Permit" {
+		t.Fatalf("unexpected typed data: %+v", payload.TypedData)
+	}
+}
+
+func TestPreparePermitRejectsSubmittedPermit(t *testing.T) {
+	subscription, authorization, _ := newFirstChargeFixture()
+	authorization.PermitTxHash = "0xpermit"
+	service := NewChainService(
+		&testChainContract{},
+		&testActivationSubscriptionRepo{subscription: subscription},
+		&testActivationAuthorizationRepo{authorization: authorization},
+		&testActivationChargeRepo{},
+		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
+		&captureFirstChargeCompleter{},
+	)
+
+	_, err := service.PreparePermit(context.Background(), "sub_1")
+	if !errors.Is(err, ErrPermitAlreadySubmitted) {
+		t.Fatalf("expected ErrPermitAlreadySubmitted, got %v", err)
+	}
+}
+func TestActivateSubscriptionRejectsInvalidPermit(t *testing.T) {
+	highS := validPermitSignature()
+	for i := range highS.S {
+		highS.S[i] = 0xff
+	}
+	zeroV := validPermitSignature()
+	zeroV.V = 0
+
+	cases := []struct {
+		name     string
+		sig      blockchain.PermitSignature
+		deadline int64
+		want     error
+	}{
+		{name: "bad v", sig: zeroV, deadline: time.Now().Add(time.Hour).Unix(), want: ErrInvalidPermitSignature},
+		{name: "high s", sig: highS, deadline: time.Now().Add(time.Hour).Unix(), want: ErrInvalidPermitSignature},
+		{name: "zero r and s", sig: blockchain.PermitSignature{V: 28}, deadline: time.Now().Add(time.Hour).Unix(), want: ErrInvalidPermitSignature},
+		{name: "expired", sig: validPermitSignature(), deadline: time.Now().Add(-time.Minute).Unix(), want: ErrPermitExpired},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			subscription, authorization, charge := newFirstChargeFixture()
+			authorization.PermitDeadline = tc.deadline
+			contract := &testChainContract{}
+			service := NewChainService(
+				contract,
+				&testActivationSubscriptionRepo{subscription: subscription},
+				&testActivationAuthorizationRepo{authorization: authorization},
+				&testActivationChargeRepo{charge: charge},
+				&noopEventRepo{},
+				&testPlanRepo{},
+				&testChainTransactionRepo{},
+				&captureFirstChargeCompleter{},
+			)
+
+			_, err := service.ActivateSubscription(context.Background(), "sub_1", tc.sig)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+			if contract.authorizeCalls != 0 {
+				t.Fatal("expected no permit to be submitted")
+			}
+		})
+	}
+}
+
+func TestActivateSubscriptionReturnsNotFoundForUnknownSubscription(t *testing.T) {
+	service := NewChainService(
+		&testChainContract{},
+		&testActivationSubscriptionRepo{},
+		&testActivationAuthorizationRepo{},
+		&testActivationChargeRepo{},
+		&noopEventRepo{},
+		&testPlanRepo{},
+		&testChainTransactionRepo{},
+		&captureFirstChargeCompleter{},
+	)
+
+	_, err := service.ActivateSubscription(context.Background(), "missing", validPermitSignature())
+	if !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Fatalf("expected ErrSubscriptionNotFound, got %v", err)
+	}
+}
+
+func TestPrepareRevocationTargetsAllowanceWithoutVaultShare(t *testing.T) {
+	subscription, authorization, _ := newRenewalFixture()
+	contract := &testChainContract{permitNonce: 4, tokenAllowance: 5000, vaultAllowance: 2000}
+	service := NewChainService(contract, &testActivationSubscriptionRepo{subscription: subscription}, &testActivationAuthorizationRepo{authorization: authorization}, &testActivationChargeRepo{}, &noopEventRepo{}, &testPlanRepo{}, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+
+	payload, err := service.PrepareRevocation(context.Background(), "sub_1")
+	if err != nil {
+		t.Fatalf("PrepareRevocation returned error: %v", err)
+	}
+	if payload.ExpectedAllowance.Int64() != 5000 || payload.TargetAllowance.Int64() != 3000 {
+		t.Fatalf("unexpected allowances: expected %s target %s", payload.ExpectedAllowance, payload.TargetAllowance)
+	}
+	msg := payload.TypedData.Message
+	if msg["value"] != "3000" || msg["nonce"] != "4" || msg["spender"] != contract.VaultAddress().Hex() {
+		t.Fatalf("unexpected revocation permit: %+v", msg)
+	}
+}
+
+func TestRevokeAuthorizationSubmitsAndConfirmsRevocation(t *testing.T) {
+	subscription, authorization, _ := newRenewalFixture()
+	contract := &testChainContract{cancelTxHash: "0xrevoke", permitNonce: 4}
+	deadline := time.Now().Add(time.Hour).Unix()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	authorization.PayerAddress = crypto.PubkeyToAddress(key.PublicKey).Hex()
+	permitDomain, _ := contract.PermitDomain(context.Background())
+	hash, _, err := apitypes.TypedDataAndHash(blockchain.PermitTypedData(permitDomain, blockchain.PermitMessage{
+		Owner:    crypto.PubkeyToAddress(key.PublicKey),
+		Spender:  contract.VaultAddress(),
+		Value:    big.NewInt(3000),
+		Nonce:    big.NewInt(4),
+		Deadline: big.NewInt(deadline),
+	}))
+	if err != nil {
+		t.Fatalf("hash typed data: %v", err)
+	}
+	raw, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatalf("sign permit: %v", err)
+	}
+	sig, _ := blockchain.SplitPermitSignature(raw)
+
+	authorizationRepo := &testActivationAuthorizationRepo{authorization: authorization}
+	transactions := &testChainTransactionRepo{}
+	completer := &captureFirstChargeCompleter{}
+	service := NewChainService(contract, &testActivationSubscriptionRepo{subscription: subscription}, authorizationRepo, &testActivationChargeRepo{}, &noopEventRepo{}, &testPlanRepo{}, transactions, completer)
+
+	txHash, err := service.RevokeAuthorization(context.Background(), RevokeAuthorizationInput{
+		SubscriptionID:    "sub_1",
+		ExpectedAllowance: big.NewInt(5000),
+		TargetAllowance:   big.NewInt(3000),
+		Deadline:          deadline,
+		PermitSignature:   sig,
+	})
+	if err != nil {
+		t.Fatalf("RevokeAuthorization returned error: %v", err)
+	}
+	if txHash != "0xrevoke" || contract.cancelCalls != 1 || contract.lastCancel[1].Int64() != 3000 {
+		t.Fatalf("unexpected cancel submission: %s calls=%d", txHash, contract.cancelCalls)
+	}
+	if authorizationRepo.updated != nil {
+		t.Fatal("expected authorization to stay completed until the revocation confirms")
+	}
+	if len(transactions.created) != 1 || transactions.created[0].Kind != domain.ChainTxRevocation {
+		t.Fatalf("expected revocation to be tracked, got %+v", transactions.created)
+	}
+
+	if err := service.HandleTransactionConfirmed(context.Background(), transactions.created[0]); err != nil {
+		t.Fatalf("HandleTransactionConfirmed returned error: %v", err)
+	}
+	if completer.authorization == nil || completer.authorization.PermitStatus != domain.AuthorizationRevoked || completer.authorization.RemainingAllowance != 0 {
+		t.Fatalf("expected authorization revoked, got %+v", completer.authorization)
+	}
+	if completer.event == nil || completer.event.Type != domain.EventAuthorizationRevoked || !strings.Contains(completer.event.Metadata, "0xrevoke") {
+		t.Fatalf("expected revocation event, got %+v", completer.event)
+	}
+}
+
+func TestRevokeAuthorizationRejectsPermitFromOtherSigner(t *testing.T) {
+	subscription, authorization, _ := newRenewalFixture()
+	contract := &testChainContract{cancelTxHash: "0xrevoke"}
+	service := NewChainService(contract, &testActivationSubscriptionRepo{subscription: subscription}, &testActivationAuthorizationRepo{authorization: authorization}, &testActivationChargeRepo{}, &noopEventRepo{}, &testPlanRepo{}, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+
+	_, err := service.RevokeAuthorization(context.Background(), RevokeAuthorizationInput{
+		SubscriptionID:    "sub_1",
+		ExpectedAllowance: big.NewInt(5000),
+		TargetAllowance:   big.NewInt(3000),
+		Deadline:          time.Now().Add(time.Hour).Unix(),
+		PermitSignature:   validPermitSignature(),
+	})
+	if !errors.Is(err, ErrPermitSignerMismatch) && !errors.Is(err, ErrInvalidPermitSignature) {
+		t.Fatalf("expected signer rejection, got %v", err)
 	}
-	if chargeRepo.updated.Status != domain.ChargeFailed {
-		t.Fatalf("expected charge failed, got %s", chargeRepo.updated.Status)
+	if contract.cancelCalls != 0 {
+		t.Fatal("expected no cancel submission for a foreign signature")
 	}
 }
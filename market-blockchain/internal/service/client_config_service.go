@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+	"market-blockchain/internal/xray"
+)
+
+var (
+	ErrNoActiveSubscription = errors.New("identity has no active subscription")
+	ErrTrafficSuspended     = errors.New("subscription is suspended for exceeding its traffic quota until the next period")
+	ErrNoClientNodes        = errors.New("no nodes are available for this subscription")
+)
+
+type clientConfigSubscriptions interface {
+	GetActiveByIdentity(ctx context.Context, identityAddress string) (*domain.Subscription, error)
+}
+
+// ClientConfig is everything a client needs to connect, in each supported
+// format.
+type ClientConfig struct {
+	Subscription *domain.Subscription
+	UUID         string
+	Nodes        []*domain.XrayNode
+	ShareLinks   []string
+	SingBox      *xray.SingBoxConfig
+	Xray         *xray.XrayClientConfig
+}
+
+// ClientConfigService builds client connection configs from the node
+// registry for identities with an active subscription.
+type ClientConfigService struct {
+	subscriptions clientConfigSubscriptions
+	nodes         repository.XrayNodeRepository
+	assignments   repository.XrayNodeAssignmentRepository
+}
+
+func NewClientConfigService(
+	subscriptions clientConfigSubscriptions,
+	nodes repository.XrayNodeRepository,
+	assignments repository.XrayNodeAssignmentRepository,
+) *ClientConfigService {
+	return &ClientConfigService{
+		subscriptions: subscriptions,
+		nodes:         nodes,
+		assignments:   assignments,
+	}
+}
+
+// ClientConfig lists the enabled nodes with a public endpoint that the
+// identity is provisioned on: its assigned nodes, or all of them when it has
+// no assignment, the same set the fleet adds it to.
+func (s *ClientConfigService) ClientConfig(ctx context.Context, identityAddress string) (*ClientConfig, error) {
+	subscription, err := s.subscriptions.GetActiveByIdentity(ctx, identityAddress)
+	if err != nil {
+		return nil, fmt.Errorf("get active subscription: %w", err)
+	}
+	if subscription == nil {
+		return nil, ErrNoActiveSubscription
+	}
+	if subscription.TrafficSuspended {
+		return nil, ErrTrafficSuspended
+	}
+
+	nodes, err := s.nodes.ListAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list xray nodes: %w", err)
+	}
+	assigned, err := s.assignments.ListNodeIDs(ctx, identityAddress)
+	if err != nil {
+		return nil, fmt.Errorf("list node assignments: %w", err)
+	}
+	allowed := make(map[string]bool, len(assigned))
+	for _, id := range assigned {
+		allowed[id] = true
+	}
+
+	config := &ClientConfig{
+		Subscription: subscription,
+		UUID:         subscription.XrayUUID,
+	}
+	for _, node := range nodes {
+		if !node.Enabled || node.Endpoint.Host == "" {
+			continue
+		}
+		if len(allowed) > 0 && !allowed[node.ID] {
+			continue
+		}
+		config.Nodes = append(config.Nodes, node)
+		config.ShareLinks = append(config.ShareLinks, xray.ShareLink(node, config.UUID))
+	}
+	if len(config.Nodes) == 0 {
+		return nil, ErrNoClientNodes
+	}
+
+	config.SingBox = xray.SingBoxOutbounds(config.Nodes, config.UUID)
+	config.Xray = xray.XrayOutbounds(config.Nodes, config.UUID)
+	return config, nil
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"market-blockchain/internal/domain"
+)
+
+type clientConfigTestNodes []*domain.XrayNode
+
+func (n clientConfigTestNodes) Create(node *domain.XrayNode) error {
+	return nil
+}
+
+func (n clientConfigTestNodes) Update(node *domain.XrayNode) error {
+	return nil
+}
+
+func (n clientConfigTestNodes) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+func (n clientConfigTestNodes) GetByID(ctx context.Context, id string) (*domain.XrayNode, error) {
+	return nil, nil
+}
+
+func (n clientConfigTestNodes) ListAll(ctx context.Context) ([]*domain.XrayNode, error) {
+	return n, nil
+}
+
+type clientConfigTestAssignments map[string][]string
+
+func (a clientConfigTestAssignments) ListNodeIDs(ctx context.Context, identityAddress string) ([]string, error) {
+	return a[identityAddress], nil
+}
+
+func (a clientConfigTestAssignments) ListAll(ctx context.Context) (map[string][]string, error) {
+	return a, nil
+}
+
+func (a clientConfigTestAssignments) Replace(ctx context.Context, identityAddress string, nodeIDs []string, now int64) error {
+	return nil
+}
+
+func clientConfigTestNode(id, name, host string, enabled bool) *domain.XrayNode {
+	endpoint := domain.DefaultXrayNodeEndpoint()
+	endpoint.Host = host
+	return &domain.XrayNode{ID: id, Name: name, Enabled: enabled, Endpoint: endpoint}
+}
+
+func TestClientConfigServiceListsReachableNodes(t *testing.T) {
+	nodes := clientConfigTestNodes{
+		clientConfigTestNode("node_a", "a", "a.example.com", true),
+		clientConfigTestNode("node_b", "b", "b.example.com", false),
+		clientConfigTestNode("node_c", "c", "", true),
+		clientConfigTestNode("node_d", "d", "d.example.com", true),
+	}
+	subscriptions := trafficTestSubscriptions{"0xabc": {ID: "sub_1", IdentityAddress: "0xabc", Status: domain.SubscriptionActive, XrayUUID: "11111111-2222-3333-4444-555555555555"}}
+	service := NewClientConfigService(subscriptions, nodes, clientConfigTestAssignments{})
+
+	config, err := service.ClientConfig(context.Background(), "0xabc")
+	if err != nil {
+		t.Fatalf("ClientConfig returned error: %v", err)
+	}
+	if len(config.Nodes) != 2 || config.Nodes[0].ID != "node_a" || config.Nodes[1].ID != "node_d" {
+		t.Fatalf("expected only enabled nodes with a public host, got %+v", config.Nodes)
+	}
+	if config.UUID != "11111111-2222-3333-4444-555555555555" {
+		t.Fatalf("expected the subscription's stored uuid, got %s", config.UUID)
+	}
+	if len(config.ShareLinks) != 2 || !strings.HasPrefix(config.ShareLinks[1], "vless://"+config.UUID+"@d.example.com:443?") {
+		t.Fatalf("unexpected share links: %v", config.ShareLinks)
+	}
+	if len(config.SingBox.Outbounds) != 3 || len(config.Xray.Outbounds) != 2 {
+		t.Fatalf("expected configs for both nodes, got %d sing-box and %d xray outbounds", len(config.SingBox.Outbounds), len(config.Xray.Outbounds))
+	}
+}
+
+func TestClientConfigServiceHonoursNodeAssignments(t *testing.T) {
+	nodes := clientConfigTestNodes{
+		clientConfigTestNode("node_a", "a", "a.example.com", true),
+		clientConfigTestNode("node_b", "b", "b.example.com", true),
+	}
+	subscriptions := trafficTestSubscriptions{"0xabc": {ID: "sub_1", IdentityAddress: "0xabc", Status: domain.SubscriptionActive}}
+	service := NewClientConfigService(subscriptions, nodes, clientConfigTestAssignments{"0xabc": {"node_b"}})
+
+	config, err := service.ClientConfig(context.Background(), "0xabc")
+	if err != nil {
+		t.Fatalf("ClientConfig returned error: %v", err)
+	}
+	if len(config.Nodes) != 1 || config.Nodes[0].ID != "node_b" {
+		t.Fatalf("expected only the assigned node, got %+v", config.Nodes)
+	}
+}
+
+func TestClientConfigServiceRejectsUnservableIdentities(t *testing.T) {
+	nodes := clientConfigTestNodes{clientConfigTestNode("node_a", "a", "a.example.com", true)}
+	subscriptions := trafficTestSubscriptions{
+		"0xsuspended": {ID: "sub_1", IdentityAddress: "0xsuspended", Status: domain.SubscriptionActive, TrafficSuspended: true},
+		"0xelsewhere": {ID: "sub_2", IdentityAddress: "0xelsewhere", Status: domain.SubscriptionActive},
+	}
+	assignments := clientConfigTestAssignments{"0xelsewhere": {"node_gone"}}
+	service := NewClientConfigService(subscriptions, nodes, assignments)
+
+	for identity, want := range map[string]error{
+		"0xnobody":    ErrNoActiveSubscription,
+		"0xsuspended": ErrTrafficSuspended,
+		"0xelsewhere": ErrNoClientNodes,
+	} {
+		if _, err := service.ClientConfig(context.Background(), identity); !errors.Is(err, want) {
+			t.Fatalf("%s: expected %v, got %v", identity, want, err)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+
+	"market-blockchain/internal/blockchain"
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+)
+
+const reconciliationPageSize = 100
+
+type reconciliationChain interface {
+	GetAuthorizedAllowance(ctx context.Context, payer common.Address, identity common.Address) (*big.Int, error)
+	GetIdentityPayer(ctx context.Context, identity common.Address) (common.Address, error)
+	IsChargeExecuted(ctx context.Context, chargeID [32]byte) (bool, error)
+}
+
+// ReconciliationService compares the authorizations and charges behind live
+// (active and past_due) subscriptions with VPNCreditVault state and records
+// every mismatch. Auto-correct only rewrites authorization state; charge
+// mismatches are left for manual resolution.
+type ReconciliationService struct {
+	chain          reconciliationChain
+	subscriptions  repository.SubscriptionRepository
+	authorizations repository.AuthorizationRepository
+	charges        repository.ChargeRepository
+	discrepancies  repository.DiscrepancyRepository
+	interval       time.Duration
+	autoCorrect    bool
+}
+
+func NewReconciliationService(
+	chain reconciliationChain,
+	subscriptions repository.SubscriptionRepository,
+	authorizations repository.AuthorizationRepository,
+	charges repository.ChargeRepository,
+	discrepancies repository.DiscrepancyRepository,
+	interval time.Duration,
+	autoCorrect bool,
+) *ReconciliationService {
+	if interval == 0 {
+		interval = time.Hour
+	}
+
+	return &ReconciliationService{
+		chain:          chain,
+		subscriptions:  subscriptions,
+		authorizations: authorizations,
+		charges:        charges,
+		discrepancies:  discrepancies,
+		interval:       interval,
+		autoCorrect:    autoCorrect,
+	}
+}
+
+type ReconciliationResult struct {
+	RunID                  string
+	SubscriptionsChecked   int
+	SubscriptionsErrored   int
+	DiscrepanciesFound     int
+	DiscrepanciesCorrected int
+	Discrepancies          []*domain.Discrepancy
+}
+
+func (s *ReconciliationService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	log.Printf("Reconciliation job started (interval: %v, auto-correct: %v)", s.interval, s.autoCorrect)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Reconciliation job stopped")
+			return
+		case <-ticker.C:
+			result, err := s.Run(ctx, s.autoCorrect)
+			if err != nil {
+				log.Printf("Reconciliation error: %v", err)
+				continue
+			}
+			log.Printf("Reconciliation %s: checked %d subscriptions, found %d discrepancies, corrected %d", result.RunID, result.SubscriptionsChecked, result.DiscrepanciesFound, result.DiscrepanciesCorrected)
+		}
+	}
+}
+
+// Run checks every active and past_due subscription once. A failure on one
+// subscription is logged and counted without aborting the rest of the run.
+func (s *ReconciliationService) Run(ctx context.Context, autoCorrect bool) (*ReconciliationResult, error) {
+	result := &ReconciliationResult{
+		RunID:         uuid.New().String(),
+		Discrepancies: []*domain.Discrepancy{},
+	}
+
+	for _, status := range []domain.SubscriptionStatus{domain.SubscriptionActive, domain.SubscriptionPastDue} {
+		for offset := 0; ; offset += reconciliationPageSize {
+			subscriptions, err := s.subscriptions.ListByStatus(ctx, string(status), reconciliationPageSize, offset)
+			if err != nil {
+				return nil, fmt.Errorf("list %s subscriptions: %w", status, err)
+			}
+
+			for _, subscription := range subscriptions {
+				result.SubscriptionsChecked++
+				if err := s.reconcileSubscription(ctx, result, subscription, autoCorrect); err != nil {
+					result.SubscriptionsErrored++
+					log.Printf("Failed to reconcile subscription %s: %v", subscription.ID, err)
+				}
+			}
+
+			if len(subscriptions) < reconciliationPageSize {
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (s *ReconciliationService) reconcileSubscription(ctx context.Context, result *ReconciliationResult, subscription *domain.Subscription, autoCorrect bool) error {
+	authorization, err := s.authorizations.GetByID(ctx, subscription.CurrentAuthorizationID)
+	if err != nil {
+		return fmt.Errorf("get authorization: %w", err)
+	}
+	if authorization != nil && authorization.PermitStatus == domain.AuthorizationCompleted {
+		if err := s.reconcileAuthorization(ctx, result, subscription, authorization, autoCorrect); err != nil {
+			return err
+		}
+	}
+
+	charges, err := s.charges.ListBySubscription(ctx, subscription.ID)
+	if err != nil {
+		return fmt.Errorf("list charges: %w", err)
+	}
+	for _, charge := range charges {
+		if err := s.reconcileCharge(ctx, result, subscription, charge); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ReconciliationService) reconcileAuthorization(ctx context.Context, result *ReconciliationResult, subscription *domain.Subscription, authorization *domain.Authorization, autoCorrect bool) error {
+	identity := common.HexToAddress(authorization.IdentityAddress)
+	chainPayer, err := s.chain.GetIdentityPayer(ctx, identity)
+	if err != nil {
+		return err
+	}
+
+	corrected := false
+	localPayer := common.HexToAddress(authorization.PayerAddress)
+	payer := localPayer
+	if chainPayer != localPayer {
+		// An unbound identity has nothing to correct towards.
+		fix := autoCorrect && chainPayer != (common.Address{})
+		if fix {
+			authorization.PayerAddress = chainPayer.Hex()
+			payer = chainPayer
+			corrected = true
+		}
+		if err := s.record(result, &domain.Discrepancy{
+			Type:            domain.DiscrepancyPayerMismatch,
+			SubscriptionID:  subscription.ID,
+			AuthorizationID: authorization.ID,
+			IdentityAddress: authorization.IdentityAddress,
+			PayerAddress:    authorization.PayerAddress,
+			LocalValue:      localPayer.Hex(),
+			ChainValue:      chainPayer.Hex(),
+			Corrected:       fix,
+		}); err != nil {
+			return err
+		}
+	}
+
+	chainAllowance, err := s.chain.GetAuthorizedAllowance(ctx, payer, identity)
+	if err != nil {
+		return err
+	}
+	if !chainAllowance.IsInt64() || chainAllowance.Int64() != authorization.RemainingAllowance {
+		localValue := strconv.FormatInt(authorization.RemainingAllowance, 10)
+		fix := autoCorrect && chainAllowance.IsInt64()
+		if fix {
+			authorization.RemainingAllowance = chainAllowance.Int64()
+			corrected = true
+		}
+		if err := s.record(result, &domain.Discrepancy{
+			Type:            domain.DiscrepancyAllowanceMismatch,
+			SubscriptionID:  subscription.ID,
+			AuthorizationID: authorization.ID,
+			IdentityAddress: authorization.IdentityAddress,
+			PayerAddress:    authorization.PayerAddress,
+			LocalValue:      localValue,
+			ChainValue:      chainAllowance.String(),
+			Corrected:       fix,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if corrected {
+		authorization.UpdatedAt = time.Now().UnixMilli()
+		if err := s.authorizations.Update(authorization); err != nil {
+			return fmt.Errorf("correct authorization: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// reconcileCharge only looks at settled charges; pending ones are still owned
+// by the transaction tracker. A mismatch is recorded but never auto-corrected:
+// the charge status also drives the subscription period, the remaining
+// allowance and the lifecycle events, so flipping it alone would leave those
+// inconsistent.
+func (s *ReconciliationService) reconcileCharge(ctx context.Context, result *ReconciliationResult, subscription *domain.Subscription, charge *domain.Charge) error {
+	if charge.Status != domain.ChargeCompleted && charge.Status != domain.ChargeFailed {
+		return nil
+	}
+
+	executed, err := s.chain.IsChargeExecuted(ctx, blockchain.ChargeKey(charge))
+	if err != nil {
+		return err
+	}
+
+	var discrepancyType domain.DiscrepancyType
+	switch {
+	case charge.Status == domain.ChargeCompleted && !executed:
+		discrepancyType = domain.DiscrepancyChargeMissingOnChain
+	case charge.Status == domain.ChargeFailed && executed:
+		discrepancyType = domain.DiscrepancyChargeUnrecorded
+	default:
+		return nil
+	}
+
+	return s.record(result, &domain.Discrepancy{
+		Type:            discrepancyType,
+		SubscriptionID:  subscription.ID,
+		AuthorizationID: charge.AuthorizationID,
+		ChargeRecordID:  charge.ID,
+		IdentityAddress: charge.IdentityAddress,
+		PayerAddress:    charge.PayerAddress,
+		LocalValue:      string(charge.Status),
+		ChainValue:      strconv.FormatBool(executed),
+	})
+}
+
+func (s *ReconciliationService) record(result *ReconciliationResult, discrepancy *domain.Discrepancy) error {
+	discrepancy.ID = uuid.New().String()
+	discrepancy.RunID = result.RunID
+	discrepancy.CreatedAt = time.Now().UnixMilli()
+
+	if err := s.discrepancies.Create(discrepancy); err != nil {
+		return fmt.Errorf("record %s discrepancy: %w", discrepancy.Type, err)
+	}
+
+	result.DiscrepanciesFound++
+	if discrepancy.Corrected {
+		result.DiscrepanciesCorrected++
+	}
+	result.Discrepancies = append(result.Discrepancies, discrepancy)
+	return nil
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"market-blockchain/internal/blockchain"
+	"market-blockchain/internal/domain"
+)
+
+type testReconciliationChain struct {
+	payer     common.Address
+	allowance *big.Int
+	executed  map[[32]byte]bool
+}
+
+func (c *testReconciliationChain) GetAuthorizedAllowance(ctx context.Context, payer common.Address, identity common.Address) (*big.Int, error) {
+	return c.allowance, nil
+}
+
+func (c *testReconciliationChain) GetIdentityPayer(ctx context.Context, identity common.Address) (common.Address, error) {
+	return c.payer, nil
+}
+
+func (c *testReconciliationChain) IsChargeExecuted(ctx context.Context, chargeID [32]byte) (bool, error) {
+	return c.executed[chargeID], nil
+}
+
+type reconcileTestSubscriptionRepo struct {
+	testActivationSubscriptionRepo
+	active  []*domain.Subscription
+	pastDue []*domain.Subscription
+}
+
+func (r *reconcileTestSubscriptionRepo) ListByStatus(ctx context.Context, status string, limit, offset int) ([]*domain.Subscription, error) {
+	subscriptions := r.active
+	if status == string(domain.SubscriptionPastDue) {
+		subscriptions = r.pastDue
+	}
+	if offset >= len(subscriptions) {
+		return nil, nil
+	}
+	return subscriptions[offset:], nil
+}
+
+type reconcileTestChargeRepo struct {
+	testActivationChargeRepo
+	bySubscription []*domain.Charge
+}
+
+func (r *reconcileTestChargeRepo) ListBySubscription(ctx context.Context, subscriptionID string) ([]*domain.Charge, error) {
+	return r.bySubscription, nil
+}
+
+type testDiscrepancyRepo struct {
+	created []*domain.Discrepancy
+}
+
+func (r *testDiscrepancyRepo) Create(discrepancy *domain.Discrepancy) error {
+	r.created = append(r.created, discrepancy)
+	return nil
+}
+func (r *testDiscrepancyRepo) List(ctx context.Context, discrepancyType string, limit, offset int) ([]*domain.Discrepancy, error) {
+	return r.created, nil
+}
+func (r *testDiscrepancyRepo) Count(ctx context.Context, discrepancyType string) (int, error) {
+	return len(r.created), nil
+}
+
+const (
+	reconcileIdentity = "0x0000000000000000000000000000000000000001"
+	reconcilePayer    = "0x0000000000000000000000000000000000000002"
+)
+
+func newReconciliationFixture() (*reconcileTestSubscriptionRepo, *testActivationAuthorizationRepo, *reconcileTestChargeRepo) {
+	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: reconcileIdentity, PayerAddress: reconcilePayer, PlanID: "plan_1", Status: domain.SubscriptionActive, CurrentAuthorizationID: "auth_1"}
+	authorization := &domain.Authorization{ID: "auth_1", IdentityAddress: reconcileIdentity, PayerAddress: reconcilePayer, RemainingAllowance: 2000, PermitStatus: domain.AuthorizationCompleted}
+	charges := []*domain.Charge{
+		{ID: "charge_record_1", ChargeID: "charge_1", SubscriptionID: "sub_1", Status: domain.ChargeCompleted},
+		{ID: "charge_record_2", ChargeID: "charge_2", SubscriptionID: "sub_1", Status: domain.ChargeFailed},
+		{ID: "charge_record_3", ChargeID: "charge_3", SubscriptionID: "sub_1", Status: domain.ChargePending},
+	}
+	return &reconcileTestSubscriptionRepo{active: []*domain.Subscription{subscription}},
+		&testActivationAuthorizationRepo{authorization: authorization},
+		&reconcileTestChargeRepo{bySubscription: charges}
+}
+
+func TestReconciliationServiceReportsNothingWhenStateMatches(t *testing.T) {
+	subscriptions, authorizations, charges := newReconciliationFixture()
+	chain := &testReconciliationChain{
+		payer:     common.HexToAddress(reconcilePayer),
+		allowance: big.NewInt(2000),
+		executed:  map[[32]byte]bool{blockchain.ChargeIDBytes("charge_1"): true},
+	}
+	discrepancies := &testDiscrepancyRepo{}
+	service := NewReconciliationService(chain, subscriptions, authorizations, charges, discrepancies, 0, false)
+
+	result, err := service.Run(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.SubscriptionsChecked != 1 || result.DiscrepanciesFound != 0 || len(discrepancies.created) != 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestReconciliationServiceRecordsTypedDiscrepancies(t *testing.T) {
+	subscriptions, authorizations, charges := newReconciliationFixture()
+	chain := &testReconciliationChain{
+		payer:     common.HexToAddress("0x0000000000000000000000000000000000000003"),
+		allowance: big.NewInt(1700),
+		executed:  map[[32]byte]bool{blockchain.ChargeIDBytes("charge_2"): true, blockchain.ChargeIDBytes("charge_3"): true},
+	}
+	discrepancies := &testDiscrepancyRepo{}
+	service := NewReconciliationService(chain, subscriptions, authorizations, charges, discrepancies, 0, false)
+
+	result, err := service.Run(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	want := []domain.DiscrepancyType{
+		domain.DiscrepancyPayerMismatch,
+		domain.DiscrepancyAllowanceMismatch,
+		domain.DiscrepancyChargeMissingOnChain,
+		domain.DiscrepancyChargeUnrecorded,
+	}
+	if len(discrepancies.created) != len(want) {
+		t.Fatalf("expected %d discrepancies, got %+v", len(want), discrepancies.created)
+	}
+	for i, discrepancyType := range want {
+		if discrepancies.created[i].Type != discrepancyType {
+			t.Fatalf("discrepancy %d: expected %s, got %s", i, discrepancyType, discrepancies.created[i].Type)
+		}
+		if discrepancies.created[i].RunID != result.RunID || discrepancies.created[i].Corrected {
+			t.Fatalf("unexpected discrepancy: %+v", discrepancies.created[i])
+		}
+	}
+	if discrepancies.created[1].LocalValue != "2000" || discrepancies.created[1].ChainValue != "1700" {
+		t.Fatalf("unexpected allowance values: %+v", discrepancies.created[1])
+	}
+	if authorizations.updated != nil || charges.updated != nil {
+		t.Fatal("expected no local state changes without auto-correct")
+	}
+}
+
+func TestReconciliationServiceAutoCorrectsAuthorizationsOnly(t *testing.T) {
+	subscriptions, authorizations, charges := newReconciliationFixture()
+	chain := &testReconciliationChain{
+		payer:     common.HexToAddress(reconcilePayer),
+		allowance: big.NewInt(1700),
+		executed:  map[[32]byte]bool{blockchain.ChargeIDBytes("charge_1"): true, blockchain.ChargeIDBytes("charge_2"): true},
+	}
+	discrepancies := &testDiscrepancyRepo{}
+	service := NewReconciliationService(chain, subscriptions, authorizations, charges, discrepancies, 0, false)
+
+	result, err := service.Run(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.DiscrepanciesFound != 2 || result.DiscrepanciesCorrected != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if authorizations.updated == nil || authorizations.updated.RemainingAllowance != 1700 {
+		t.Fatalf("expected remaining allowance corrected to 1700, got %+v", authorizations.updated)
+	}
+	if charges.updated != nil {
+		t.Fatalf("expected the charge mismatch left for manual resolution, got %+v", charges.updated)
+	}
+	if unrecorded := discrepancies.created[1]; unrecorded.Type != domain.DiscrepancyChargeUnrecorded || unrecorded.Corrected {
+		t.Fatalf("expected an uncorrected unrecorded charge discrepancy, got %+v", unrecorded)
+	}
+}
+
+func TestReconciliationServiceChecksPastDueSubscriptions(t *testing.T) {
+	subscriptions, authorizations, charges := newReconciliationFixture()
+	subscriptions.pastDue = subscriptions.active
+	subscriptions.pastDue[0].Status = domain.SubscriptionPastDue
+	subscriptions.active = nil
+	chain := &testReconciliationChain{
+		payer:     common.HexToAddress(reconcilePayer),
+		allowance: big.NewInt(1700),
+		executed:  map[[32]byte]bool{blockchain.ChargeIDBytes("charge_1"): true},
+	}
+	discrepancies := &testDiscrepancyRepo{}
+	service := NewReconciliationService(chain, subscriptions, authorizations, charges, discrepancies, 0, false)
+
+	result, err := service.Run(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.SubscriptionsChecked != 1 || len(discrepancies.created) != 1 || discrepancies.created[0].Type != domain.DiscrepancyAllowanceMismatch {
+		t.Fatalf("expected the past_due subscription reconciled, got %+v", discrepancies.created)
+	}
+}
+
+func TestReconciliationServiceChecksLegacyChargesUnderTheirOwnKey(t *testing.T) {
+	subscriptions, authorizations, charges := newReconciliationFixture()
+	charges.bySubscription = []*domain.Charge{
+		{ID: "charge_record_1", ChargeID: "charge_1", SubscriptionID: "sub_1", Status: domain.ChargeCompleted, ChargeIDEncoding: domain.ChargeIDRaw},
+	}
+	chain := &testReconciliationChain{
+		payer:     common.HexToAddress(reconcilePayer),
+		allowance: big.NewInt(2000),
+		executed:  map[[32]byte]bool{blockchain.LegacyChargeIDBytes("charge_1"): true},
+	}
+	discrepancies := &testDiscrepancyRepo{}
+	service := NewReconciliationService(chain, subscriptions, authorizations, charges, discrepancies, 0, false)
+
+	if _, err := service.Run(context.Background(), true); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if len(discrepancies.created) != 0 || charges.updated != nil {
+		t.Fatalf("expected the legacy charge found executed, got %+v", discrepancies.created)
+	}
+}
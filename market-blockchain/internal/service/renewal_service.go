@@ -2,11 +2,11 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
-	"github.com/google/uuid"
-
 	"market-blockchain/internal/domain"
 	"market-blockchain/internal/repository"
 )
@@ -41,6 +41,31 @@ func NewRenewalService(
 	}
 }
 
+// renewalFailure is a renewal attempt turned down by the payer's allowance,
+// the plan or the chain, as opposed to an error reading local state. It
+// counts as a failed attempt under the dunning policy.
+type renewalFailure struct {
+	reason domain.RenewalFailureReason
+	err    error
+}
+
+func (f *renewalFailure) Error() string {
+	return f.err.Error()
+}
+
+func (f *renewalFailure) Unwrap() error {
+	return f.err
+}
+
+func failRenewal(reason domain.RenewalFailureReason, err error) error {
+	return &renewalFailure{reason: reason, err: err}
+}
+
+// ProcessRenewals charges every subscription whose period has ended and
+// retries the past due ones whose next attempt is due. A failed attempt puts
+// the subscription past due, or expires it once its grace period is over.
+// Errors that are not a renewal failure, such as a database or RPC outage,
+// count as chain_unavailable attempts so they follow the retry schedule too.
 func (s *RenewalService) ProcessRenewals(ctx context.Context) error {
 	now := time.Now().UnixMilli()
 
@@ -50,20 +75,29 @@ func (s *RenewalService) ProcessRenewals(ctx context.Context) error {
 	}
 
 	for _, sub := range renewableSubscriptions {
-		if err := s.processRenewal(ctx, sub); err != nil {
-			s.events.Create(&domain.Event{
-				ID:              uuid.New().String(),
-				IdentityAddress: sub.IdentityAddress,
-				PayerAddress:    sub.PayerAddress,
-				PlanID:          sub.PlanID,
-				ChargeID:        "",
-				Type:            domain.EventChargeFailed,
-				Description:     fmt.Sprintf("Renewal failed: %v", err),
-				Metadata:        "",
-				CreatedAt:       time.Now().UnixMilli(),
-			})
+		err := s.processRenewal(ctx, sub)
+		if err == nil {
+			continue
+		}
+
+		if errors.Is(err, ErrChargeInFlight) {
+			// A charge waiting for its receipt is not a failed attempt, but it
+			// does not extend the grace period either.
+			if sub.GraceExpired(now) {
+				if expireErr := s.lifecycle.ExpireSubscription(ctx, sub, fmt.Sprintf("Subscription expired after its renewal grace period: %v", err)); expireErr != nil {
+					log.Printf("Failed to expire subscription %s: %v", sub.ID, expireErr)
+				}
+			}
 			continue
 		}
+
+		var failure *renewalFailure
+		if !errors.As(err, &failure) {
+			failure = &renewalFailure{reason: domain.RenewalFailureChainUnavailable, err: err}
+		}
+		if recordErr := s.recordFailure(ctx, sub, failure); recordErr != nil {
+			log.Printf("Failed to record renewal failure of subscription %s: %v", sub.ID, recordErr)
+		}
 	}
 
 	return nil
@@ -80,30 +114,47 @@ func (s *RenewalService) processRenewal(ctx context.Context, sub *domain.Subscri
 		return fmt.Errorf("get plan: %w", err)
 	}
 	if plan == nil || !plan.Active {
-		return fmt.Errorf("plan not found or inactive")
+		return failRenewal(domain.RenewalFailurePlanUnavailable, fmt.Errorf("plan %s not found or inactive", targetPlanID))
 	}
 
-	auth, err := s.authorizations.GetByIdentityAndPlan(ctx, sub.IdentityAddress, sub.PlanID)
+	auth, err := s.authorizations.GetByID(ctx, sub.CurrentAuthorizationID)
 	if err != nil {
 		return fmt.Errorf("get authorization: %w", err)
 	}
 	if auth == nil {
-		return fmt.Errorf("authorization not found")
+		return failRenewal(domain.RenewalFailureAuthorizationInvalid, fmt.Errorf("authorization not found"))
 	}
 
 	if auth.RemainingAllowance < plan.AmountUSDCBaseUnits {
-		if err := s.lifecycle.ExpireSubscription(ctx, sub, "Subscription expired due to insufficient allowance"); err != nil {
-			return fmt.Errorf("expire subscription: %w", err)
-		}
-		return fmt.Errorf("insufficient allowance")
+		return failRenewal(domain.RenewalFailureInsufficientAllowance, fmt.Errorf("insufficient allowance: %d remaining, %d required", auth.RemainingAllowance, plan.AmountUSDCBaseUnits))
 	}
 
-	chargeID := uuid.New().String()
-	chargeRecordID := uuid.New().String()
+	if s.chainService == nil {
+		return failRenewal(domain.RenewalFailureChainUnavailable, fmt.Errorf("blockchain client not configured"))
+	}
 
-	if err := s.lifecycle.ApplyRenewalSuccess(ctx, sub, auth, plan, chargeRecordID, chargeID); err != nil {
+	err = s.chainService.ExecuteRenewalCharge(ctx, ExecuteRenewalChargeInput{
+		Subscription:  sub,
+		Authorization: auth,
+		Plan:          plan,
+	})
+	switch {
+	case errors.Is(err, ErrInvalidAuthorizationStatus):
+		return failRenewal(domain.RenewalFailureAuthorizationInvalid, err)
+	case errors.Is(err, ErrChargeRejected):
+		return failRenewal(domain.RenewalFailureChargeRejected, err)
+	default:
 		return err
 	}
+}
 
-	return nil
+// recordFailure applies a failed attempt under the grace access policy of
+// the subscription's current plan.
+func (s *RenewalService) recordFailure(ctx context.Context, sub *domain.Subscription, failure *renewalFailure) error {
+	plan, err := s.plans.GetByPlanID(ctx, sub.PlanID)
+	if err != nil {
+		return fmt.Errorf("get plan: %w", err)
+	}
+
+	return s.lifecycle.ApplyRenewalFailure(ctx, sub, plan, failure.reason, failure.Error())
 }
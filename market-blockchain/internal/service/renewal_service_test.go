@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"market-blockchain/internal/domain"
+)
+
+type renewalTestSubscriptions struct {
+	testActivationSubscriptionRepo
+	renewable []*domain.Subscription
+}
+
+func (r *renewalTestSubscriptions) ListRenewable(ctx context.Context, now int64) ([]*domain.Subscription, error) {
+	return r.renewable, nil
+}
+
+func newRenewalTestService(contract *testChainContract, subscription *domain.Subscription, authorization *domain.Authorization, plan *domain.Plan, store *lifecycleTestStore) *RenewalService {
+	return newRenewalTestServiceWithRepos(contract, subscription, &testActivationAuthorizationRepo{authorization: authorization}, &testActivationChargeRepo{}, plan, store)
+}
+
+func newRenewalTestServiceWithRepos(contract *testChainContract, subscription *domain.Subscription, authorizations *testActivationAuthorizationRepo, charges *testActivationChargeRepo, plan *domain.Plan, store *lifecycleTestStore) *RenewalService {
+	subscriptions := &renewalTestSubscriptions{testActivationSubscriptionRepo: testActivationSubscriptionRepo{subscription: subscription}, renewable: []*domain.Subscription{subscription}}
+	plans := &testPlanRepo{plan: plan}
+	dunning := DunningPolicy{GracePeriod: 72 * time.Hour, RetrySchedule: []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour}}
+	lifecycle := NewSubscriptionLifecycleService(subscriptions, authorizations, charges, &noopEventRepo{}, store, nil, nil, dunning)
+	chainService := NewChainService(contract, subscriptions, authorizations, charges, &noopEventRepo{}, plans, &testChainTransactionRepo{}, lifecycle)
+	return NewRenewalService(subscriptions, authorizations, charges, &noopEventRepo{}, plans, chainService, lifecycle)
+}
+
+func TestRenewalServiceInsufficientAllowanceStartsGracePeriod(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	authorization.RemainingAllowance = 100
+	contract := &testChainContract{chargeTxHash: "0xrenewal"}
+	store := &lifecycleTestStore{}
+	service := newRenewalTestService(contract, subscription, authorization, plan, store)
+
+	if err := service.ProcessRenewals(context.Background()); err != nil {
+		t.Fatalf("ProcessRenewals returned error: %v", err)
+	}
+	if contract.chargeCalls != 0 {
+		t.Fatal("expected no charge without enough allowance")
+	}
+	if store.endSubscriptionCalls != 0 || store.updateDunningStateCalls != 1 {
+		t.Fatalf("expected the subscription past due rather than expired, got %d expirations", store.endSubscriptionCalls)
+	}
+	if subscription.Status != domain.SubscriptionPastDue || subscription.LastRenewalFailure != domain.RenewalFailureInsufficientAllowance {
+		t.Fatalf("unexpected dunning state: %s %s", subscription.Status, subscription.LastRenewalFailure)
+	}
+}
+
+func TestRenewalServiceRecordsRejectedCharge(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	contract := &testChainContract{chargeErr: errors.New("execution reverted")}
+	store := &lifecycleTestStore{}
+	service := newRenewalTestService(contract, subscription, authorization, plan, store)
+
+	if err := service.ProcessRenewals(context.Background()); err != nil {
+		t.Fatalf("ProcessRenewals returned error: %v", err)
+	}
+	if contract.chargeCalls != 1 || store.updateDunningStateCalls != 1 {
+		t.Fatalf("expected one rejected attempt recorded, got %d charges and %d records", contract.chargeCalls, store.updateDunningStateCalls)
+	}
+	if !strings.Contains(store.dunning.event.Metadata, `"reason_code":"charge_rejected"`) {
+		t.Fatalf("unexpected event metadata: %s", store.dunning.event.Metadata)
+	}
+}
+
+func TestRenewalServiceExpiresAfterGracePeriod(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	authorization.RemainingAllowance = 100
+	subscription.Status = domain.SubscriptionPastDue
+	subscription.PastDueAt = 2000
+	subscription.GraceEndsAt = 3000
+	subscription.RenewalAttempts = 3
+	store := &lifecycleTestStore{}
+	service := newRenewalTestService(&testChainContract{}, subscription, authorization, plan, store)
+
+	if err := service.ProcessRenewals(context.Background()); err != nil {
+		t.Fatalf("ProcessRenewals returned error: %v", err)
+	}
+	if store.endSubscriptionCalls != 1 || subscription.Status != domain.SubscriptionExpired {
+		t.Fatalf("expected the subscription expired after its grace period, got %s", subscription.Status)
+	}
+}
+
+func TestRenewalServiceCountsUnclassifiedErrorAsChainUnavailable(t *testing.T) {
+	subscription, _, plan := newRenewalFixture()
+	contract := &testChainContract{chargeTxHash: "0xrenewal"}
+	store := &lifecycleTestStore{}
+	service := newRenewalTestServiceWithRepos(contract, subscription, &testActivationAuthorizationRepo{getErr: errors.New("db down")}, &testActivationChargeRepo{}, plan, store)
+
+	if err := service.ProcessRenewals(context.Background()); err != nil {
+		t.Fatalf("ProcessRenewals returned error: %v", err)
+	}
+	if store.updateDunningStateCalls != 1 || subscription.Status != domain.SubscriptionPastDue {
+		t.Fatalf("expected the error recorded as a failed attempt, got %s after %d records", subscription.Status, store.updateDunningStateCalls)
+	}
+	if subscription.LastRenewalFailure != domain.RenewalFailureChainUnavailable || subscription.NextRenewalAttemptAt == 0 {
+		t.Fatalf("expected a chain_unavailable attempt on the retry schedule, got %s retrying at %d", subscription.LastRenewalFailure, subscription.NextRenewalAttemptAt)
+	}
+}
+
+func TestRenewalServiceExpiresWithChargeInFlightAndSettlesItAsCredit(t *testing.T) {
+	subscription, authorization, plan := newRenewalFixture()
+	subscription.Status = domain.SubscriptionPastDue
+	subscription.PastDueAt = 2000
+	subscription.GraceEndsAt = 3000
+	subscription.RenewalAttempts = 3
+	inFlight := &domain.Charge{ID: "charge_record_1", ChargeID: RenewalChargeID("sub_1", 2000), SubscriptionID: "sub_1", AuthorizationID: "auth_1", PlanID: "plan_1", Amount: 300, Status: domain.ChargePending, TxHash: "0xinflight"}
+	contract := &testChainContract{chargeTxHash: "0xsecond"}
+	store := &lifecycleTestStore{}
+	service := newRenewalTestServiceWithRepos(contract, subscription, &testActivationAuthorizationRepo{authorization: authorization}, &testActivationChargeRepo{charge: inFlight}, plan, store)
+
+	if err := service.ProcessRenewals(context.Background()); err != nil {
+		t.Fatalf("ProcessRenewals returned error: %v", err)
+	}
+	if contract.chargeCalls != 0 {
+		t.Fatal("expected no second charge while one is in flight")
+	}
+	if store.endSubscriptionCalls != 1 || subscription.Status != domain.SubscriptionExpired {
+		t.Fatalf("expected the subscription expired after its grace period, got %s", subscription.Status)
+	}
+
+	// The charge confirms after the expiry: the payer has paid, so it is
+	// settled as a credit instead of failing on every tracker poll.
+	tx := &domain.ChainTransaction{TxHash: "0xinflight", Kind: domain.ChainTxRenewalCharge, Status: domain.ChainTxMined, SubscriptionID: "sub_1", AuthorizationID: "auth_1", ChargeRecordID: "charge_record_1"}
+	if err := service.chainService.HandleTransactionConfirmed(context.Background(), tx); err != nil {
+		t.Fatalf("HandleTransactionConfirmed returned error: %v", err)
+	}
+	if store.settleChargeCalls != 1 || store.settled.charge.Status != domain.ChargeCompleted || store.settled.charge.TxHash != "0xinflight" {
+		t.Fatalf("expected the late charge completed, got %+v", store.settled.charge)
+	}
+	if store.settled.authorization.RemainingAllowance != 1700 {
+		t.Fatalf("expected the charge deducted from allowance, got %d", store.settled.authorization.RemainingAllowance)
+	}
+	if store.settled.event.Type != domain.EventRenewalCredit || !strings.Contains(store.settled.event.Metadata, `"credit_amount":300`) {
+		t.Fatalf("expected a renewal_credit event, got %+v", store.settled.event)
+	}
+	if subscription.Status != domain.SubscriptionExpired || store.completeRenewalCalls != 0 {
+		t.Fatalf("expected the subscription to stay expired, got %s", subscription.Status)
+	}
+}
@@ -0,0 +1,602 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+
+	"market-blockchain/internal/blockchain"
+	"market-blockchain/internal/blockchain/chaintest"
+	"market-blockchain/internal/domain"
+)
+
+// The in-memory repositories below stand in for PostgreSQL in the simulated
+// chain test. Like the database they hand out copies, so a service only sees
+// what it persisted.
+
+type memorySubscriptionRepo struct {
+	rows map[string]*domain.Subscription
+}
+
+func (r *memorySubscriptionRepo) Create(subscription *domain.Subscription) error {
+	row := *subscription
+	r.rows[subscription.ID] = &row
+	return nil
+}
+func (r *memorySubscriptionRepo) Update(subscription *domain.Subscription) error {
+	return r.Create(subscription)
+}
+func (r *memorySubscriptionRepo) GetByID(ctx context.Context, id string) (*domain.Subscription, error) {
+	if row, ok := r.rows[id]; ok {
+		subscription := *row
+		return &subscription, nil
+	}
+	return nil, nil
+}
+func (r *memorySubscriptionRepo) GetByIdentityAndPlan(ctx context.Context, identityAddress, planID string) (*domain.Subscription, error) {
+	for _, row := range r.rows {
+		if row.IdentityAddress == identityAddress && row.PlanID == planID {
+			return r.GetByID(ctx, row.ID)
+		}
+	}
+	return nil, nil
+}
+func (r *memorySubscriptionRepo) ListRenewable(ctx context.Context, now int64) ([]*domain.Subscription, error) {
+	var subscriptions []*domain.Subscription
+	for _, row := range r.rows {
+		if (row.Status == domain.SubscriptionActive && row.AutoRenew && row.CurrentPeriodEnd <= now) ||
+			(row.Status == domain.SubscriptionPastDue && row.NextRenewalAttemptAt <= now) {
+			subscription := *row
+			subscriptions = append(subscriptions, &subscription)
+		}
+	}
+	return subscriptions, nil
+}
+func (r *memorySubscriptionRepo) ListByStatus(ctx context.Context, status string, limit, offset int) ([]*domain.Subscription, error) {
+	return nil, nil
+}
+func (r *memorySubscriptionRepo) ListAll(ctx context.Context, limit, offset int) ([]*domain.Subscription, error) {
+	return nil, nil
+}
+func (r *memorySubscriptionRepo) CountByStatus(ctx context.Context, status string) (int, error) {
+	return 0, nil
+}
+func (r *memorySubscriptionRepo) CountAll(ctx context.Context) (int, error) { return len(r.rows), nil }
+func (r *memorySubscriptionRepo) CountByPlanAndStatus(ctx context.Context, planID, status string) (int, error) {
+	return 0, nil
+}
+func (r *memorySubscriptionRepo) SearchByAddress(ctx context.Context, address string) ([]*domain.Subscription, error) {
+	return nil, nil
+}
+
+type memoryAuthorizationRepo struct {
+	rows map[string]*domain.Authorization
+}
+
+func (r *memoryAuthorizationRepo) Create(authorization *domain.Authorization) error {
+	row := *authorization
+	r.rows[authorization.ID] = &row
+	return nil
+}
+func (r *memoryAuthorizationRepo) Update(authorization *domain.Authorization) error {
+	return r.Create(authorization)
+}
+func (r *memoryAuthorizationRepo) GetByID(ctx context.Context, id string) (*domain.Authorization, error) {
+	if row, ok := r.rows[id]; ok {
+		authorization := *row
+		return &authorization, nil
+	}
+	return nil, nil
+}
+func (r *memoryAuthorizationRepo) GetByIdentityAndPlan(ctx context.Context, identityAddress, planID string) (*domain.Authorization, error) {
+	for _, row := range r.rows {
+		if row.IdentityAddress == identityAddress && row.PlanID == planID {
+			return r.GetByID(ctx, row.ID)
+		}
+	}
+	return nil, nil
+}
+
+type memoryChargeRepo struct {
+	rows map[string]*domain.Charge
+}
+
+func (r *memoryChargeRepo) Create(charge *domain.Charge) error {
+	row := *charge
+	r.rows[charge.ID] = &row
+	return nil
+}
+func (r *memoryChargeRepo) Update(charge *domain.Charge) error { return r.Create(charge) }
+func (r *memoryChargeRepo) GetByID(ctx context.Context, id string) (*domain.Charge, error) {
+	if row, ok := r.rows[id]; ok {
+		charge := *row
+		return &charge, nil
+	}
+	return nil, nil
+}
+func (r *memoryChargeRepo) GetByChargeID(ctx context.Context, chargeID string) (*domain.Charge, error) {
+	for _, row := range r.rows {
+		if row.ChargeID == chargeID {
+			return r.GetByID(ctx, row.ID)
+		}
+	}
+	return nil, nil
+}
+func (r *memoryChargeRepo) ListByIdentity(ctx context.Context, identityAddress string) ([]*domain.Charge, error) {
+	return nil, nil
+}
+func (r *memoryChargeRepo) ListByStatusAndDateRange(ctx context.Context, status string, fromTime, toTime int64) ([]*domain.Charge, error) {
+	return nil, nil
+}
+func (r *memoryChargeRepo) ListByDateRange(ctx context.Context, fromTime, toTime int64) ([]*domain.Charge, error) {
+	return nil, nil
+}
+func (r *memoryChargeRepo) ListBySubscription(ctx context.Context, subscriptionID string) ([]*domain.Charge, error) {
+	var charges []*domain.Charge
+	for _, row := range r.rows {
+		if row.SubscriptionID == subscriptionID {
+			charge := *row
+			charges = append(charges, &charge)
+		}
+	}
+	sort.Slice(charges, func(i, j int) bool { return charges[i].CreatedAt < charges[j].CreatedAt })
+	return charges, nil
+}
+func (r *memoryChargeRepo) SumCompletedCharges(ctx context.Context, fromTime, toTime int64) (int64, error) {
+	return 0, nil
+}
+func (r *memoryChargeRepo) CountAndSumByStatus(ctx context.Context, status string) (int, int64, error) {
+	return 0, 0, nil
+}
+
+type memoryPlanRepo struct {
+	rows map[string]*domain.Plan
+}
+
+func (r *memoryPlanRepo) Create(plan *domain.Plan) error {
+	row := *plan
+	r.rows[plan.PlanID] = &row
+	return nil
+}
+func (r *memoryPlanRepo) Update(plan *domain.Plan) error { return r.Create(plan) }
+func (r *memoryPlanRepo) GetByPlanID(ctx context.Context, planID string) (*domain.Plan, error) {
+	if row, ok := r.rows[planID]; ok {
+		plan := *row
+		return &plan, nil
+	}
+	return nil, nil
+}
+func (r *memoryPlanRepo) ListActive(ctx context.Context) ([]*domain.Plan, error) { return nil, nil }
+func (r *memoryPlanRepo) ListAll(ctx context.Context) ([]*domain.Plan, error)    { return nil, nil }
+
+type memoryChainTransactionRepo struct {
+	rows map[string]*domain.ChainTransaction
+}
+
+func (r *memoryChainTransactionRepo) Create(tx *domain.ChainTransaction) error {
+	row := *tx
+	r.rows[tx.TxHash] = &row
+	return nil
+}
+func (r *memoryChainTransactionRepo) Update(tx *domain.ChainTransaction) error { return r.Create(tx) }
+func (r *memoryChainTransactionRepo) GetByHash(ctx context.Context, txHash string) (*domain.ChainTransaction, error) {
+	if row, ok := r.rows[txHash]; ok {
+		tx := *row
+		return &tx, nil
+	}
+	return nil, nil
+}
+func (r *memoryChainTransactionRepo) ListUnfinalized(ctx context.Context) ([]*domain.ChainTransaction, error) {
+	var txs []*domain.ChainTransaction
+	for _, row := range r.rows {
+		if row.Status == domain.ChainTxPending || row.Status == domain.ChainTxMined {
+			tx := *row
+			txs = append(txs, &tx)
+		}
+	}
+	sort.Slice(txs, func(i, j int) bool { return txs[i].CreatedAt < txs[j].CreatedAt })
+	return txs, nil
+}
+
+type memoryRelayerTransactionRepo struct {
+	rows map[string]*domain.RelayerTransaction
+}
+
+func (r *memoryRelayerTransactionRepo) Create(tx *domain.RelayerTransaction) error {
+	row := *tx
+	r.rows[tx.TxHash] = &row
+	return nil
+}
+func (r *memoryRelayerTransactionRepo) Update(tx *domain.RelayerTransaction) error {
+	return r.Create(tx)
+}
+func (r *memoryRelayerTransactionRepo) Replace(ctx context.Context, replaced, replacement *domain.RelayerTransaction) error {
+	if err := r.Update(replaced); err != nil {
+		return err
+	}
+	return r.Create(replacement)
+}
+func (r *memoryRelayerTransactionRepo) GetByHash(ctx context.Context, txHash string) (*domain.RelayerTransaction, error) {
+	if row, ok := r.rows[txHash]; ok {
+		tx := *row
+		return &tx, nil
+	}
+	return nil, nil
+}
+func (r *memoryRelayerTransactionRepo) ListByOriginalHash(ctx context.Context, originalTxHash string) ([]*domain.RelayerTransaction, error) {
+	return r.list(func(tx *domain.RelayerTransaction) bool { return tx.OriginalTxHash == originalTxHash }), nil
+}
+func (r *memoryRelayerTransactionRepo) ListPending(ctx context.Context, fromAddress string) ([]*domain.RelayerTransaction, error) {
+	return r.list(func(tx *domain.RelayerTransaction) bool {
+		return tx.FromAddress == fromAddress && tx.Status == domain.RelayerTxPending
+	}), nil
+}
+func (r *memoryRelayerTransactionRepo) MaxNonce(ctx context.Context, fromAddress string) (int64, error) {
+	max := int64(-1)
+	for _, row := range r.rows {
+		if row.FromAddress == fromAddress && row.Status != domain.RelayerTxRejected && row.Nonce > max {
+			max = row.Nonce
+		}
+	}
+	return max, nil
+}
+func (r *memoryRelayerTransactionRepo) list(keep func(*domain.RelayerTransaction) bool) []*domain.RelayerTransaction {
+	var txs []*domain.RelayerTransaction
+	for _, row := range r.rows {
+		if keep(row) {
+			tx := *row
+			txs = append(txs, &tx)
+		}
+	}
+	sort.Slice(txs, func(i, j int) bool { return txs[i].Nonce < txs[j].Nonce })
+	return txs
+}
+
+// memoryLifecycleStore applies the lifecycle store's transactions to the
+// in-memory repositories.
+type memoryLifecycleStore struct {
+	subscriptions  *memorySubscriptionRepo
+	authorizations *memoryAuthorizationRepo
+	charges        *memoryChargeRepo
+	events         *lifecycleTestEventRepo
+}
+
+func (s *memoryLifecycleStore) save(subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
+	if subscription != nil {
+		s.subscriptions.Update(subscription)
+	}
+	if authorization != nil {
+		s.authorizations.Update(authorization)
+	}
+	if charge != nil {
+		s.charges.Update(charge)
+	}
+	return s.events.Create(event)
+}
+
+func (s *memoryLifecycleStore) CreateInitialState(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
+	return s.save(subscription, authorization, charge, event)
+}
+func (s *memoryLifecycleStore) CompleteFirstCharge(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	return s.save(subscription, authorization, charge, event)
+}
+func (s *memoryLifecycleStore) CompleteRenewal(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	return s.save(subscription, authorization, charge, event)
+}
+func (s *memoryLifecycleStore) EndSubscription(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	return s.save(subscription, nil, nil, event)
+}
+func (s *memoryLifecycleStore) UpdateQuotaState(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	return s.save(subscription, nil, nil, event)
+}
+func (s *memoryLifecycleStore) RotateXrayCredential(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	return s.save(subscription, nil, nil, event)
+}
+func (s *memoryLifecycleStore) ApplyImmediateUpgrade(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
+	return s.save(subscription, authorization, charge, event)
+}
+func (s *memoryLifecycleStore) ScheduleDowngrade(ctx context.Context, subscription *domain.Subscription, event *domain.Event) error {
+	return s.save(subscription, nil, nil, event)
+}
+func (s *memoryLifecycleStore) UpdateDunningState(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	return s.save(subscription, nil, nil, event)
+}
+func (s *memoryLifecycleStore) FailCharge(ctx context.Context, charge *domain.Charge, event *domain.Event) error {
+	return s.save(nil, nil, charge, event)
+}
+func (s *memoryLifecycleStore) SettleCharge(ctx context.Context, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
+	return s.save(nil, authorization, charge, event)
+}
+func (s *memoryLifecycleStore) RevokeAuthorization(ctx context.Context, authorization *domain.Authorization, event *domain.Event) error {
+	return s.save(nil, authorization, nil, event)
+}
+
+// simulatedServices wires the chain, renewal and subscription services the
+// way the app does, against a vault deployed on a simulated chain.
+type simulatedServices struct {
+	backend        *simulated.Backend
+	vault          *chaintest.Vault
+	client         *blockchain.ContractClient
+	payerKey       *ecdsa.PrivateKey
+	serviceWallet  common.Address
+	subscriptions  *memorySubscriptionRepo
+	authorizations *memoryAuthorizationRepo
+	charges        *memoryChargeRepo
+	events         *lifecycleTestEventRepo
+	chain          *ChainService
+	tracker        *TransactionTracker
+	subscribe      *SubscriptionService
+	renewals       *RenewalService
+	management     *SubscriptionManagementService
+}
+
+func newSimulatedServices(t *testing.T, plan *domain.Plan) *simulatedServices {
+	t.Helper()
+	keys := make([]*ecdsa.PrivateKey, 3)
+	alloc := types.GenesisAlloc{}
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		keys[i] = key
+		alloc[crypto.PubkeyToAddress(key.PublicKey)] = types.Account{Balance: new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil)}
+	}
+	deployerKey, relayerKey, payerKey := keys[0], keys[1], keys[2]
+
+	backend := simulated.NewBackend(alloc)
+	t.Cleanup(func() { backend.Close() })
+	chainID, err := backend.Client().ChainID(context.Background())
+	if err != nil {
+		t.Fatalf("get chain id: %v", err)
+	}
+	deployer, err := bind.NewKeyedTransactorWithChainID(deployerKey, chainID)
+	if err != nil {
+		t.Fatalf("deployer transactor: %v", err)
+	}
+	relayer, err := blockchain.NewPrivateKeySigner(hex.EncodeToString(crypto.FromECDSA(relayerKey)))
+	if err != nil {
+		t.Fatalf("relayer signer: %v", err)
+	}
+
+	serviceWallet := common.HexToAddress("0x5e71ce0000000000000000000000000000000001")
+	vault := chaintest.DeployVault(t, backend, deployer, serviceWallet, relayer.Address())
+	vault.Mint(t, backend, deployer, crypto.PubkeyToAddress(payerKey.PublicKey), 100_000_000)
+
+	relayerTxs := &memoryRelayerTransactionRepo{rows: make(map[string]*domain.RelayerTransaction)}
+	client, err := blockchain.NewContractClientWithBackend(backend.Client(), vault.Address.Hex(), relayer, relayerTxs, blockchain.TxManagerConfig{})
+	if err != nil {
+		t.Fatalf("NewContractClientWithBackend returned error: %v", err)
+	}
+
+	s := &simulatedServices{
+		backend:        backend,
+		vault:          vault,
+		client:         client,
+		payerKey:       payerKey,
+		serviceWallet:  serviceWallet,
+		subscriptions:  &memorySubscriptionRepo{rows: make(map[string]*domain.Subscription)},
+		authorizations: &memoryAuthorizationRepo{rows: make(map[string]*domain.Authorization)},
+		charges:        &memoryChargeRepo{rows: make(map[string]*domain.Charge)},
+		events:         &lifecycleTestEventRepo{},
+	}
+	plans := &memoryPlanRepo{rows: map[string]*domain.Plan{plan.PlanID: plan}}
+	transactions := &memoryChainTransactionRepo{rows: make(map[string]*domain.ChainTransaction)}
+	store := &memoryLifecycleStore{subscriptions: s.subscriptions, authorizations: s.authorizations, charges: s.charges, events: s.events}
+	lifecycle := NewSubscriptionLifecycleService(s.subscriptions, s.authorizations, s.charges, s.events, store, nil, nil, DunningPolicy{
+		GracePeriod:   72 * time.Hour,
+		RetrySchedule: []time.Duration{time.Hour},
+	})
+
+	s.chain = NewChainService(client, s.subscriptions, s.authorizations, s.charges, s.events, plans, transactions, lifecycle)
+	s.tracker = NewTransactionTracker(client, transactions, s.chain, 1, time.Second, time.Hour)
+	s.subscribe = NewSubscriptionService(plans, s.subscriptions, lifecycle)
+	s.renewals = NewRenewalService(s.subscriptions, s.authorizations, s.charges, s.events, plans, s.chain, lifecycle)
+	s.management = NewSubscriptionManagementService(s.subscriptions, lifecycle, s.chain)
+	return s
+}
+
+func (s *simulatedServices) payer() common.Address {
+	return crypto.PubkeyToAddress(s.payerKey.PublicKey)
+}
+
+// mine commits the pending transactions and lets the tracker confirm them.
+func (s *simulatedServices) mine(t *testing.T) {
+	t.Helper()
+	s.backend.Commit()
+	if err := s.tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+}
+
+// sign signs typed data with the payer's key the way a wallet would.
+func (s *simulatedServices) sign(t *testing.T, typedData apitypes.TypedData) blockchain.PermitSignature {
+	t.Helper()
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		t.Fatalf("hash typed data: %v", err)
+	}
+	raw, err := crypto.Sign(hash, s.payerKey)
+	if err != nil {
+		t.Fatalf("sign typed data: %v", err)
+	}
+	sig, err := blockchain.SplitPermitSignature(raw)
+	if err != nil {
+		t.Fatalf("split signature: %v", err)
+	}
+	return sig
+}
+
+func (s *simulatedServices) subscription(t *testing.T, id string) *domain.Subscription {
+	t.Helper()
+	subscription, err := s.subscriptions.GetByID(context.Background(), id)
+	if err != nil || subscription == nil {
+		t.Fatalf("get subscription %s: %v", id, err)
+	}
+	return subscription
+}
+
+func (s *simulatedServices) expectChainAllowances(t *testing.T, identity common.Address, authorized, token int64) {
+	t.Helper()
+	ctx := context.Background()
+	vaultAllowance, err := s.client.GetAuthorizedAllowance(ctx, s.payer(), identity)
+	if err != nil {
+		t.Fatalf("GetAuthorizedAllowance returned error: %v", err)
+	}
+	tokenAllowance, err := s.client.TokenAllowance(ctx, s.payer())
+	if err != nil {
+		t.Fatalf("TokenAllowance returned error: %v", err)
+	}
+	if vaultAllowance.Int64() != authorized || tokenAllowance.Int64() != token {
+		t.Fatalf("expected authorized/token allowance %d/%d on chain, got %s/%s", authorized, token, vaultAllowance, tokenAllowance)
+	}
+}
+
+func TestSimulatedSubscriptionThroughServices(t *testing.T) {
+	const price = 10_000_000
+	plan := &domain.Plan{
+		PlanID:               "basic",
+		Name:                 "Basic",
+		PeriodSeconds:        30 * 24 * 3600,
+		AmountUSDCBaseUnits:  price,
+		AuthorizationPeriods: 3,
+		Active:               true,
+	}
+	s := newSimulatedServices(t, plan)
+	ctx := context.Background()
+	identity := common.HexToAddress("0x1de0000000000000000000000000000000000001")
+
+	// The payer already allows the vault one USDC for another identity, which
+	// the new authorization has to build on.
+	const existing = 1_000_000
+	chainID, err := s.backend.Client().ChainID(ctx)
+	if err != nil {
+		t.Fatalf("get chain id: %v", err)
+	}
+	payerOpts, err := bind.NewKeyedTransactorWithChainID(s.payerKey, chainID)
+	if err != nil {
+		t.Fatalf("payer transactor: %v", err)
+	}
+	if _, err := s.vault.Token.Transact(payerOpts, "approve", s.vault.Address, big.NewInt(existing)); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	s.backend.Commit()
+
+	// Subscribing creates the pending records; the payer signs the permit the
+	// service prepares and activation submits it.
+	created, err := s.subscribe.CreateSubscription(ctx, CreateSubscriptionInput{
+		SubscriptionID:    "sub-simulated",
+		AuthorizationID:   "auth-simulated",
+		ChargeRecordID:    "charge-simulated",
+		IdentityAddress:   identity.Hex(),
+		PayerAddress:      s.payer().Hex(),
+		PlanID:            plan.PlanID,
+		ExpectedAllowance: existing,
+		TargetAllowance:   existing + 3*price,
+		PermitDeadline:    time.Now().Add(time.Hour).Unix(),
+		InitialChargeID:   "first_sub-simulated",
+	})
+	if err != nil {
+		t.Fatalf("CreateSubscription returned error: %v", err)
+	}
+	subscriptionID := created.Subscription.ID
+
+	permit, err := s.chain.PreparePermit(ctx, subscriptionID)
+	if err != nil {
+		t.Fatalf("PreparePermit returned error: %v", err)
+	}
+	if _, err := s.chain.ActivateSubscription(ctx, subscriptionID, s.sign(t, permit.TypedData)); err != nil {
+		t.Fatalf("ActivateSubscription returned error: %v", err)
+	}
+
+	// The confirmed permit submits the first charge, and its confirmation
+	// activates the subscription.
+	s.mine(t)
+	s.mine(t)
+	subscription := s.subscription(t, subscriptionID)
+	if subscription.Status != domain.SubscriptionActive {
+		t.Fatalf("expected subscription active after the first charge, got %s", subscription.Status)
+	}
+	s.expectChainAllowances(t, identity, 2*price, existing+2*price)
+
+	// Renewing once the period is over.
+	subscription.CurrentPeriodEnd = time.Now().Add(-time.Minute).UnixMilli()
+	s.subscriptions.Update(subscription)
+	periodEnd := subscription.CurrentPeriodEnd
+	if err := s.renewals.ProcessRenewals(ctx); err != nil {
+		t.Fatalf("ProcessRenewals returned error: %v", err)
+	}
+	s.mine(t)
+	subscription = s.subscription(t, subscriptionID)
+	if subscription.Status != domain.SubscriptionActive || subscription.CurrentPeriodStart != periodEnd {
+		t.Fatalf("expected the renewal to start the next period at %d, got %+v", periodEnd, subscription)
+	}
+	renewal, _ := s.charges.GetByChargeID(ctx, RenewalChargeID(subscriptionID, periodEnd))
+	if renewal == nil || renewal.Status != domain.ChargeCompleted {
+		t.Fatalf("expected the renewal charge completed, got %+v", renewal)
+	}
+	if balance := s.vault.TokenBalance(t, s.serviceWallet); balance.Int64() != 2*price {
+		t.Fatalf("expected the service wallet to hold %d, got %s", 2*price, balance)
+	}
+	authorization, _ := s.authorizations.GetByID(ctx, subscription.CurrentAuthorizationID)
+	if authorization.RemainingAllowance != existing+price {
+		t.Fatalf("expected %d allowance left locally, got %d", existing+price, authorization.RemainingAllowance)
+	}
+	s.expectChainAllowances(t, identity, price, existing+price)
+
+	// Cancelling with a revocation hands back exactly the vault's share.
+	revocation, err := s.chain.PrepareRevocation(ctx, subscriptionID)
+	if err != nil {
+		t.Fatalf("PrepareRevocation returned error: %v", err)
+	}
+	result, err := s.management.CancelSubscription(ctx, subscriptionID, &RevocationInput{
+		ExpectedAllowance: revocation.ExpectedAllowance,
+		TargetAllowance:   revocation.TargetAllowance,
+		Deadline:          revocation.Deadline,
+		PermitSignature:   s.sign(t, revocation.TypedData),
+	})
+	if err != nil {
+		t.Fatalf("CancelSubscription returned error: %v", err)
+	}
+	if result.RevocationTxHash == "" || result.Subscription.Status != domain.SubscriptionCancelled {
+		t.Fatalf("expected a cancelled subscription and a revocation hash, got %+v", result)
+	}
+	s.mine(t)
+
+	authorization, _ = s.authorizations.GetByID(ctx, subscription.CurrentAuthorizationID)
+	if authorization.PermitStatus != domain.AuthorizationRevoked {
+		t.Fatalf("expected the authorization revoked once confirmed, got %s", authorization.PermitStatus)
+	}
+	s.expectChainAllowances(t, identity, 0, existing)
+
+	var got []domain.EventType
+	for _, event := range s.events.events {
+		got = append(got, event.Type)
+	}
+	want := []domain.EventType{
+		domain.EventFirstSubscribe,
+		domain.EventChargeSuccess,
+		domain.EventRenew,
+		domain.EventCancel,
+		domain.EventAuthorizationRevoked,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected events %v, got %v", want, got)
+		}
+	}
+}
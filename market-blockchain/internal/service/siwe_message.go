@@ -0,0 +1,125 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const siweHeaderSuffix = " wants you to sign in with your Ethereum account:"
+
+// SIWEMessage is a parsed EIP-4361 Sign-In-With-Ethereum message.
+type SIWEMessage struct {
+	Domain         string
+	Address        common.Address
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        int64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime time.Time
+	NotBefore      time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// ParseSIWEMessage parses the plain-text message a wallet signed. It accepts
+// the statement being present or absent and rejects unknown fields, so a
+// message can only mean one thing once its signature is verified.
+func ParseSIWEMessage(raw string) (*SIWEMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], siweHeaderSuffix) {
+		return nil, fmt.Errorf("missing sign-in header")
+	}
+
+	msg := &SIWEMessage{Domain: strings.TrimSuffix(lines[0], siweHeaderSuffix)}
+	if msg.Domain == "" {
+		return nil, fmt.Errorf("missing domain")
+	}
+	if !common.IsHexAddress(lines[1]) || !strings.HasPrefix(lines[1], "0x") {
+		return nil, fmt.Errorf("invalid address %q", lines[1])
+	}
+	msg.Address = common.HexToAddress(lines[1])
+
+	i := 2
+	for i < len(lines) && lines[i] == "" {
+		i++
+	}
+	if i < len(lines) && !strings.HasPrefix(lines[i], "URI: ") {
+		msg.Statement = lines[i]
+		i++
+		for i < len(lines) && lines[i] == "" {
+			i++
+		}
+	}
+
+	seen := make(map[string]bool)
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+		if line == "Resources:" {
+			for i++; i < len(lines) && strings.HasPrefix(lines[i], "- "); i++ {
+				msg.Resources = append(msg.Resources, strings.TrimPrefix(lines[i], "- "))
+			}
+			i--
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("malformed line %q", line)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate field %q", key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "URI":
+			msg.URI = value
+		case "Version":
+			msg.Version = value
+		case "Chain ID":
+			msg.ChainID, err = strconv.ParseInt(value, 10, 64)
+		case "Nonce":
+			msg.Nonce = value
+		case "Issued At":
+			msg.IssuedAt, err = time.Parse(time.RFC3339, value)
+		case "Expiration Time":
+			msg.ExpirationTime, err = time.Parse(time.RFC3339, value)
+		case "Not Before":
+			msg.NotBefore, err = time.Parse(time.RFC3339, value)
+		case "Request ID":
+			msg.RequestID = value
+		default:
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	if msg.URI == "" {
+		return nil, fmt.Errorf("missing URI")
+	}
+	if msg.Version != "1" {
+		return nil, fmt.Errorf("unsupported version %q", msg.Version)
+	}
+	if !seen["Chain ID"] {
+		return nil, fmt.Errorf("missing Chain ID")
+	}
+	if len(msg.Nonce) < 8 {
+		return nil, fmt.Errorf("nonce must be at least 8 characters")
+	}
+	if msg.IssuedAt.IsZero() {
+		return nil, fmt.Errorf("missing Issued At")
+	}
+	return msg, nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
+
 	"market-blockchain/internal/domain"
 	"market-blockchain/internal/repository"
 	"market-blockchain/internal/xray"
@@ -12,10 +14,17 @@ import (
 
 type subscriptionLifecycleStore interface {
 	CreateInitialState(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error
-	CompleteFirstCharge(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error
-	CompleteRenewal(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error
-	ApplyImmediateUpgrade(ctx context.Context, subscription *domain.Subscription, charge *domain.Charge, event *domain.Event) error
+	CompleteFirstCharge(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event, xraySync *domain.XraySyncJob) error
+	CompleteRenewal(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event, xraySync *domain.XraySyncJob) error
+	EndSubscription(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error
+	UpdateQuotaState(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error
+	RotateXrayCredential(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error
+	ApplyImmediateUpgrade(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error
 	ScheduleDowngrade(ctx context.Context, subscription *domain.Subscription, event *domain.Event) error
+	UpdateDunningState(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error
+	FailCharge(ctx context.Context, charge *domain.Charge, event *domain.Event) error
+	SettleCharge(ctx context.Context, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error
+	RevokeAuthorization(ctx context.Context, authorization *domain.Authorization, event *domain.Event) error
 }
 
 type subscriptionXraySync interface {
@@ -23,13 +32,34 @@ type subscriptionXraySync interface {
 	RemoveUser(ctx context.Context, email string) error
 }
 
+// DunningPolicy decides how long a subscription whose renewal failed stays
+// past due and when the renewal is retried. The nth retry waits
+// RetrySchedule[n-1] after the failure before it, the last delay repeating;
+// no retry is scheduled past the end of the grace period.
+type DunningPolicy struct {
+	GracePeriod   time.Duration
+	RetrySchedule []time.Duration
+}
+
+func (p DunningPolicy) nextAttemptAt(failedAttempts int, now, graceEndsAt int64) int64 {
+	if len(p.RetrySchedule) == 0 {
+		return graceEndsAt
+	}
+	delay := p.RetrySchedule[len(p.RetrySchedule)-1]
+	if failedAttempts <= len(p.RetrySchedule) {
+		delay = p.RetrySchedule[failedAttempts-1]
+	}
+	return min(now+delay.Milliseconds(), graceEndsAt)
+}
+
 type SubscriptionLifecycleService struct {
 	subscriptions  repository.SubscriptionRepository
 	authorizations repository.AuthorizationRepository
 	charges        repository.ChargeRepository
 	events         repository.EventRepository
 	store          subscriptionLifecycleStore
-	xraySync       subscriptionXraySync
+	xraySync       *xraySyncDispatcher
+	dunning        DunningPolicy
 }
 
 func NewSubscriptionLifecycleService(
@@ -39,15 +69,22 @@ func NewSubscriptionLifecycleService(
 	events repository.EventRepository,
 	store subscriptionLifecycleStore,
 	xraySync subscriptionXraySync,
+	xrayOutbox repository.XraySyncOutboxRepository,
+	dunning DunningPolicy,
 ) *SubscriptionLifecycleService {
-	return &SubscriptionLifecycleService{
+	service := &SubscriptionLifecycleService{
 		subscriptions:  subscriptions,
 		authorizations: authorizations,
 		charges:        charges,
 		events:         events,
 		store:          store,
-		xraySync:       xraySync,
+		dunning:        dunning,
+	}
+	// Without Xray no outbox rows are written, so nothing piles up undelivered.
+	if xraySync != nil {
+		service.xraySync = &xraySyncDispatcher{users: xraySync, outbox: xrayOutbox}
 	}
+	return service
 }
 
 type CreatePendingSubscriptionInput struct {
@@ -89,6 +126,7 @@ func (s *SubscriptionLifecycleService) CreatePendingSubscription(ctx context.Con
 		LastChargeID:           input.InitialChargeID,
 		LastChargeAt:           now,
 		Source:                 domain.SubscriptionSourceFirstSubscribe,
+		XrayUUID:               xray.NewUserUUID(),
 		CreatedAt:              now,
 		UpdatedAt:              now,
 	}
@@ -202,11 +240,12 @@ func (s *SubscriptionLifecycleService) CompleteFirstCharge(ctx context.Context,
 		CreatedAt: now,
 	}
 
-	if err := s.store.CompleteFirstCharge(ctx, subscription, authorization, charge, event); err != nil {
+	job := s.newXraySyncJob(subscription, domain.XraySyncAddUser, "activate_first_charge", now)
+	if err := s.store.CompleteFirstCharge(ctx, subscription, authorization, charge, event, job); err != nil {
 		return fmt.Errorf("persist first charge completion: %w", err)
 	}
 
-	if err := s.syncActiveSubscription(ctx, subscription, "activate_first_charge", domain.EventChargeSuccess, "Subscription synced to Xray as active"); err != nil {
+	if err := s.deliverXraySync(ctx, subscription, job, domain.EventChargeSuccess, "Subscription synced to Xray as active"); err != nil {
 		return err
 	}
 
@@ -219,12 +258,8 @@ func (s *SubscriptionLifecycleService) CancelSubscription(ctx context.Context, s
 		return err
 	}
 
-	if err := s.subscriptions.Update(subscription); err != nil {
-		return fmt.Errorf("update subscription: %w", err)
-	}
-
-	if err := s.events.Create(&domain.Event{
-		ID:              fmt.Sprintf("evt_%d", now),
+	event := &domain.Event{
+		ID:              uuid.New().String(),
 		IdentityAddress: subscription.IdentityAddress,
 		PayerAddress:    subscription.PayerAddress,
 		PlanID:          subscription.PlanID,
@@ -233,11 +268,14 @@ func (s *SubscriptionLifecycleService) CancelSubscription(ctx context.Context, s
 		Description:     "Subscription cancelled by user",
 		Metadata:        fmt.Sprintf(`{"subscription_id":"%s","status":"%s","lifecycle_action":"cancel","xray_action":"remove_user","xray_sync_status":"pending"}`, subscription.ID, subscription.Status),
 		CreatedAt:       now,
-	}); err != nil {
-		return fmt.Errorf("create cancel event: %w", err)
 	}
 
-	if err := s.syncInactiveSubscription(ctx, subscription, "cancel", domain.EventCancel, "Subscription removed from Xray after cancellation"); err != nil {
+	job := s.newXraySyncJob(subscription, domain.XraySyncRemoveUser, "cancel", now)
+	if err := s.store.EndSubscription(ctx, subscription, event, job); err != nil {
+		return fmt.Errorf("persist cancellation: %w", err)
+	}
+
+	if err := s.deliverXraySync(ctx, subscription, job, domain.EventCancel, "Subscription removed from Xray after cancellation"); err != nil {
 		return err
 	}
 
@@ -250,12 +288,8 @@ func (s *SubscriptionLifecycleService) ExpireSubscription(ctx context.Context, s
 		return err
 	}
 
-	if err := s.subscriptions.Update(subscription); err != nil {
-		return fmt.Errorf("update subscription: %w", err)
-	}
-
-	if err := s.events.Create(&domain.Event{
-		ID:              fmt.Sprintf("evt_%d", now),
+	event := &domain.Event{
+		ID:              uuid.New().String(),
 		IdentityAddress: subscription.IdentityAddress,
 		PayerAddress:    subscription.PayerAddress,
 		PlanID:          subscription.PlanID,
@@ -264,29 +298,148 @@ func (s *SubscriptionLifecycleService) ExpireSubscription(ctx context.Context, s
 		Description:     reason,
 		Metadata:        fmt.Sprintf(`{"subscription_id":"%s","status":"%s","lifecycle_action":"expire","xray_action":"remove_user","xray_sync_status":"pending"}`, subscription.ID, subscription.Status),
 		CreatedAt:       now,
-	}); err != nil {
-		return fmt.Errorf("create expiration event: %w", err)
 	}
 
-	if err := s.syncInactiveSubscription(ctx, subscription, "expire", domain.EventExpired, "Subscription removed from Xray after expiration"); err != nil {
+	job := s.newXraySyncJob(subscription, domain.XraySyncRemoveUser, "expire", now)
+	if err := s.store.EndSubscription(ctx, subscription, event, job); err != nil {
+		return fmt.Errorf("persist expiration: %w", err)
+	}
+
+	if err := s.deliverXraySync(ctx, subscription, job, domain.EventExpired, "Subscription removed from Xray after expiration"); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (s *SubscriptionLifecycleService) ApplyRenewalSuccess(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, plan *domain.Plan, chargeRecordID, chargeID string) error {
-	if subscription.Status != domain.SubscriptionActive {
-		return fmt.Errorf("renewal requires active subscription, got %s", subscription.Status)
+// ApplyQuotaExceeded handles a subscription crossing its plan's traffic quota
+// for the period. It does nothing when the quota was already handled this
+// period. Under the suspend policy the user is removed from Xray until
+// ApplyRenewalSuccess starts the next period.
+func (s *SubscriptionLifecycleService) ApplyQuotaExceeded(ctx context.Context, subscription *domain.Subscription, plan *domain.Plan, periodTraffic int64) error {
+	if subscription.QuotaExceededAt != 0 {
+		return nil
+	}
+
+	now := time.Now().UnixMilli()
+	if err := subscription.ExceedQuota(plan.OverQuotaPolicy, now); err != nil {
+		return err
+	}
+	subscription.PeriodTraffic = periodTraffic
+
+	xrayAction := "none"
+	xraySyncStatus := "intentional_noop"
+	description := fmt.Sprintf("Traffic quota of %d bytes reached, access kept", plan.TrafficQuotaBytes)
+	var job *domain.XraySyncJob
+	if subscription.TrafficSuspended {
+		xrayAction = "remove_user"
+		xraySyncStatus = "pending"
+		description = fmt.Sprintf("Traffic quota of %d bytes reached, access suspended until the next period", plan.TrafficQuotaBytes)
+		job = s.newXraySyncJob(subscription, domain.XraySyncRemoveUser, "quota_suspend", now)
+	}
+
+	event := &domain.Event{
+		ID:              uuid.New().String(),
+		IdentityAddress: subscription.IdentityAddress,
+		PayerAddress:    subscription.PayerAddress,
+		PlanID:          subscription.PlanID,
+		Type:            domain.EventQuotaExceeded,
+		Description:     description,
+		Metadata:        fmt.Sprintf(`{"subscription_id":"%s","plan_id":"%s","quota_bytes":%d,"period_traffic":%d,"policy":"%s","lifecycle_action":"quota_exceeded","xray_action":"%s","xray_sync_status":"%s"}`, subscription.ID, plan.PlanID, plan.TrafficQuotaBytes, periodTraffic, plan.OverQuotaPolicy, xrayAction, xraySyncStatus),
+		CreatedAt:       now,
+	}
+
+	if err := s.store.UpdateQuotaState(ctx, subscription, event, job); err != nil {
+		return fmt.Errorf("persist quota state: %w", err)
+	}
+
+	if err := s.deliverXraySync(ctx, subscription, job, domain.EventQuotaExceeded, "Subscription removed from Xray after exceeding its traffic quota"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApplyRenewalFailure records a failed renewal attempt. The first failure of
+// a period puts the subscription past due for the dunning grace period, and
+// the renewal is retried on the dunning schedule until it succeeds or the
+// grace period ends, when the subscription expires. plan is the
+// subscription's current plan; it decides whether the user keeps Xray access
+// while past due.
+func (s *SubscriptionLifecycleService) ApplyRenewalFailure(ctx context.Context, subscription *domain.Subscription, plan *domain.Plan, reason domain.RenewalFailureReason, detail string) error {
+	now := time.Now().UnixMilli()
+	enteringPastDue := subscription.Status == domain.SubscriptionActive
+	if err := subscription.FailRenewal(reason, now+s.dunning.GracePeriod.Milliseconds(), now); err != nil {
+		return err
+	}
+	if subscription.GraceExpired(now) {
+		return s.ExpireSubscription(ctx, subscription, fmt.Sprintf("Subscription expired after its renewal grace period: %s", reason))
+	}
+	subscription.NextRenewalAttemptAt = s.dunning.nextAttemptAt(subscription.RenewalAttempts, now, subscription.GraceEndsAt)
+
+	graceAccess := domain.GraceAccessKeep
+	if plan != nil && plan.GraceAccess != "" {
+		graceAccess = plan.GraceAccess
+	}
+
+	lifecycleAction := "renewal_retry_failed"
+	if enteringPastDue {
+		lifecycleAction = "past_due"
+	}
+	xrayAction := "none"
+	xraySyncStatus := "intentional_noop"
+	var job *domain.XraySyncJob
+	if enteringPastDue && graceAccess == domain.GraceAccessSuspend && !subscription.TrafficSuspended {
+		xrayAction = "remove_user"
+		xraySyncStatus = "pending"
+		job = s.newXraySyncJob(subscription, domain.XraySyncRemoveUser, "past_due_suspend", now)
+	}
+
+	event := &domain.Event{
+		ID:              uuid.New().String(),
+		IdentityAddress: subscription.IdentityAddress,
+		PayerAddress:    subscription.PayerAddress,
+		PlanID:          subscription.PlanID,
+		ChargeID:        RenewalChargeID(subscription.ID, subscription.CurrentPeriodEnd),
+		Type:            domain.EventPastDue,
+		Description:     fmt.Sprintf("Renewal attempt %d failed: %s", subscription.RenewalAttempts, detail),
+		Metadata:        fmt.Sprintf(`{"subscription_id":"%s","status":"%s","reason_code":"%s","attempt":%d,"grace_ends_at":%d,"next_renewal_attempt_at":%d,"grace_access":"%s","lifecycle_action":"%s","xray_action":"%s","xray_sync_status":"%s"}`, subscription.ID, subscription.Status, reason, subscription.RenewalAttempts, subscription.GraceEndsAt, subscription.NextRenewalAttemptAt, graceAccess, lifecycleAction, xrayAction, xraySyncStatus),
+		CreatedAt:       now,
+	}
+
+	if err := s.store.UpdateDunningState(ctx, subscription, event, job); err != nil {
+		return fmt.Errorf("persist renewal failure: %w", err)
+	}
+
+	if err := s.deliverXraySync(ctx, subscription, job, domain.EventPastDue, "Subscription removed from Xray while past due"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApplyRenewalSuccess starts the next period once the renewal charge is
+// confirmed, returning a past due subscription to active. A charge that
+// confirms after the subscription was cancelled or expired is settled as a
+// credit instead, see settleRenewalCredit.
+func (s *SubscriptionLifecycleService) ApplyRenewalSuccess(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, plan *domain.Plan, charge *domain.Charge, chargeTxHash string) error {
+	switch subscription.Status {
+	case domain.SubscriptionActive, domain.SubscriptionPastDue:
+	case domain.SubscriptionCancelled, domain.SubscriptionExpired:
+		return s.settleRenewalCredit(ctx, subscription, authorization, charge, chargeTxHash)
+	default:
+		return fmt.Errorf("renewal requires active or past due subscription, got %s", subscription.Status)
 	}
 
 	now := time.Now().UnixMilli()
+	recovered := subscription.Status == domain.SubscriptionPastDue
 	eventType := domain.EventRenew
 	eventDescription := "Renewal charge completed"
 	source := domain.SubscriptionSourceRenewal
 	previousPlanID := subscription.PlanID
 	targetPlanID := subscription.PlanID
 	lifecycleAction := "renewal_success"
+	quotaRestored := subscription.TrafficSuspended
 	if subscription.PendingPlanID != "" {
 		targetPlanID = subscription.PendingPlanID
 		eventType = domain.EventDowngrade
@@ -294,98 +447,192 @@ func (s *SubscriptionLifecycleService) ApplyRenewalSuccess(ctx context.Context,
 		source = domain.SubscriptionSourceDowngrade
 	}
 
-	charge := &domain.Charge{
-		ID:              chargeRecordID,
-		ChargeID:        chargeID,
-		SubscriptionID:  subscription.ID,
-		AuthorizationID: subscription.CurrentAuthorizationID,
-		IdentityAddress: subscription.IdentityAddress,
-		PayerAddress:    subscription.PayerAddress,
-		PlanID:          targetPlanID,
-		Amount:          plan.AmountUSDCBaseUnits,
-		Status:          domain.ChargePending,
-		TxHash:          "",
-		Reason:          string(eventType),
-		CreatedAt:       now,
-		UpdatedAt:       now,
-	}
+	charge.Status = domain.ChargeCompleted
+	charge.TxHash = chargeTxHash
+	charge.UpdatedAt = now
 
 	subscription.PlanID = targetPlanID
 	subscription.PendingPlanID = ""
 	subscription.CurrentPeriodStart = subscription.CurrentPeriodEnd
 	subscription.CurrentPeriodEnd = subscription.CurrentPeriodEnd + (plan.PeriodSeconds * 1000)
-	subscription.LastChargeID = chargeID
+	subscription.LastChargeID = charge.ChargeID
 	subscription.LastChargeAt = now
 	subscription.Source = source
 	subscription.UpdatedAt = now
+	subscription.StartPeriodUsage()
+	if err := subscription.Recover(now); err != nil {
+		return err
+	}
 
 	authorization.RemainingAllowance -= plan.AmountUSDCBaseUnits
 	authorization.UpdatedAt = now
 
 	event := &domain.Event{
-		ID:              fmt.Sprintf("evt_%d", now),
+		ID:              uuid.New().String(),
 		IdentityAddress: subscription.IdentityAddress,
 		PayerAddress:    subscription.PayerAddress,
 		PlanID:          targetPlanID,
-		ChargeID:        chargeID,
+		ChargeID:        charge.ChargeID,
 		Type:            eventType,
 		Description:     eventDescription,
-		Metadata:        fmt.Sprintf(`{"subscription_id":"%s","previous_plan_id":"%s","plan_id":"%s","charge_record_id":"%s","lifecycle_action":"%s","xray_action":"add_user","xray_sync_status":"pending"}`, subscription.ID, previousPlanID, targetPlanID, chargeRecordID, lifecycleAction),
+		Metadata:        fmt.Sprintf(`{"subscription_id":"%s","previous_plan_id":"%s","plan_id":"%s","charge_record_id":"%s","charge_tx_hash":"%s","lifecycle_action":"%s","quota_restored":%t,"recovered_from_past_due":%t,"xray_action":"add_user","xray_sync_status":"pending"}`, subscription.ID, previousPlanID, targetPlanID, charge.ID, chargeTxHash, lifecycleAction, quotaRestored, recovered),
 		CreatedAt:       now,
 	}
 
-	if err := s.store.CompleteRenewal(ctx, subscription, authorization, charge, event); err != nil {
+	job := s.newXraySyncJob(subscription, domain.XraySyncAddUser, lifecycleAction, now)
+	if err := s.store.CompleteRenewal(ctx, subscription, authorization, charge, event, job); err != nil {
 		return fmt.Errorf("persist renewal success: %w", err)
 	}
 
-	if err := s.syncActiveSubscription(ctx, subscription, lifecycleAction, eventType, "Subscription synced to Xray after renewal"); err != nil {
+	if err := s.deliverXraySync(ctx, subscription, job, eventType, "Subscription synced to Xray after renewal"); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (s *SubscriptionLifecycleService) ApplyImmediateUpgrade(ctx context.Context, subscription *domain.Subscription, oldPlan *domain.Plan, newPlan *domain.Plan, proratedCharge int64) error {
-	if subscription.Status != domain.SubscriptionActive {
-		return fmt.Errorf("can only upgrade active subscriptions")
-	}
-
+// settleRenewalCredit completes a renewal charge the payer has paid on chain
+// although the subscription ended meanwhile. The subscription stays ended; a
+// renewal_credit event records the amount owed to the payer.
+func (s *SubscriptionLifecycleService) settleRenewalCredit(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, chargeTxHash string) error {
 	now := time.Now().UnixMilli()
-	chargeID := fmt.Sprintf("chg_%d", now)
-	charge := &domain.Charge{
-		ID:              chargeID,
-		ChargeID:        chargeID,
-		SubscriptionID:  subscription.ID,
-		AuthorizationID: subscription.CurrentAuthorizationID,
-		Amount:          proratedCharge,
-		Status:          domain.ChargePending,
-		CreatedAt:       now,
-		UpdatedAt:       now,
-	}
+	charge.Status = domain.ChargeCompleted
+	charge.TxHash = chargeTxHash
+	charge.UpdatedAt = now
 
-	subscription.PlanID = newPlan.PlanID
-	subscription.Source = domain.SubscriptionSourceUpgrade
-	subscription.UpdatedAt = now
+	authorization.RemainingAllowance -= charge.Amount
+	authorization.UpdatedAt = now
 
 	event := &domain.Event{
-		ID:              fmt.Sprintf("evt_%d", now),
+		ID:              uuid.New().String(),
 		IdentityAddress: subscription.IdentityAddress,
 		PayerAddress:    subscription.PayerAddress,
-		PlanID:          newPlan.PlanID,
+		PlanID:          charge.PlanID,
 		ChargeID:        charge.ChargeID,
-		Type:            domain.EventUpgrade,
-		Description:     fmt.Sprintf("Upgraded from %s to %s", oldPlan.Name, newPlan.Name),
-		Metadata:        fmt.Sprintf(`{"subscription_id":"%s","old_plan_id":"%s","new_plan_id":"%s","prorated_charge":%d,"lifecycle_action":"upgrade","xray_action":"none","xray_sync_status":"intentional_noop"}`, subscription.ID, oldPlan.PlanID, newPlan.PlanID, proratedCharge),
+		Type:            domain.EventRenewalCredit,
+		Description:     fmt.Sprintf("Renewal was charged after the subscription became %s; %d is owed to the payer", subscription.Status, charge.Amount),
+		Metadata:        fmt.Sprintf(`{"subscription_id":"%s","subscription_status":"%s","current_period_end":%d,"credit_amount":%d,"charge_record_id":"%s","charge_tx_hash":"%s","lifecycle_action":"renewal_credit","xray_action":"none","xray_sync_status":"intentional_noop"}`, subscription.ID, subscription.Status, subscription.CurrentPeriodEnd, charge.Amount, charge.ID, chargeTxHash),
 		CreatedAt:       now,
 	}
 
-	if err := s.store.ApplyImmediateUpgrade(ctx, subscription, charge, event); err != nil {
+	if err := s.store.SettleCharge(ctx, authorization, charge, event); err != nil {
+		return fmt.Errorf("persist renewal credit: %w", err)
+	}
+
+	return nil
+}
+
+// ApplyImmediateUpgrade switches the subscription to newPlan once its
+// prorated upgrade charge is confirmed on chain. The period is unchanged; a
+// downgrade scheduled for its end is dropped. The charge is settled either
+// way: if the subscription has since been cancelled, expired, fallen past due
+// or moved to another period, the plan stays and an upgrade_credit event
+// records the amount owed to the payer instead.
+func (s *SubscriptionLifecycleService) ApplyImmediateUpgrade(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, oldPlan *domain.Plan, newPlan *domain.Plan, charge *domain.Charge, chargeTxHash string) error {
+	now := time.Now().UnixMilli()
+	charge.Status = domain.ChargeCompleted
+	charge.TxHash = chargeTxHash
+	charge.UpdatedAt = now
+
+	authorization.RemainingAllowance -= charge.Amount
+	authorization.UpdatedAt = now
+
+	var event *domain.Event
+	if subscription.Status == domain.SubscriptionActive && charge.ChargeID == UpgradeChargeID(subscription.ID, newPlan.PlanID, subscription.CurrentPeriodEnd) {
+		subscription.PlanID = newPlan.PlanID
+		subscription.PendingPlanID = ""
+		subscription.LastChargeID = charge.ChargeID
+		subscription.LastChargeAt = now
+		subscription.Source = domain.SubscriptionSourceUpgrade
+		subscription.UpdatedAt = now
+
+		event = &domain.Event{
+			ID:              uuid.New().String(),
+			IdentityAddress: subscription.IdentityAddress,
+			PayerAddress:    subscription.PayerAddress,
+			PlanID:          newPlan.PlanID,
+			ChargeID:        charge.ChargeID,
+			Type:            domain.EventUpgrade,
+			Description:     fmt.Sprintf("Upgraded from %s to %s", oldPlan.Name, newPlan.Name),
+			Metadata:        fmt.Sprintf(`{"subscription_id":"%s","old_plan_id":"%s","new_plan_id":"%s","prorated_charge":%d,"charge_record_id":"%s","charge_tx_hash":"%s","lifecycle_action":"upgrade","xray_action":"none","xray_sync_status":"intentional_noop"}`, subscription.ID, oldPlan.PlanID, newPlan.PlanID, charge.Amount, charge.ID, chargeTxHash),
+			CreatedAt:       now,
+		}
+	} else {
+		event = &domain.Event{
+			ID:              uuid.New().String(),
+			IdentityAddress: subscription.IdentityAddress,
+			PayerAddress:    subscription.PayerAddress,
+			PlanID:          subscription.PlanID,
+			ChargeID:        charge.ChargeID,
+			Type:            domain.EventUpgradeCredit,
+			Description:     fmt.Sprintf("Upgrade to %s was charged but not applied; %d is owed to the payer", newPlan.Name, charge.Amount),
+			Metadata:        fmt.Sprintf(`{"subscription_id":"%s","subscription_status":"%s","current_period_end":%d,"new_plan_id":"%s","credit_amount":%d,"charge_record_id":"%s","charge_tx_hash":"%s","lifecycle_action":"upgrade_credit","xray_action":"none","xray_sync_status":"intentional_noop"}`, subscription.ID, subscription.Status, subscription.CurrentPeriodEnd, newPlan.PlanID, charge.Amount, charge.ID, chargeTxHash),
+			CreatedAt:       now,
+		}
+	}
+
+	if err := s.store.ApplyImmediateUpgrade(ctx, subscription, authorization, charge, event); err != nil {
 		return fmt.Errorf("persist immediate upgrade: %w", err)
 	}
 
 	return nil
 }
 
+// RecordChargeFailure marks a charge that reverted, was dropped or could not
+// be submitted as failed and writes its charge_failed event.
+func (s *SubscriptionLifecycleService) RecordChargeFailure(ctx context.Context, charge *domain.Charge, subscriptionID, reason string) error {
+	now := time.Now().UnixMilli()
+	charge.Status = domain.ChargeFailed
+	charge.UpdatedAt = now
+
+	event := &domain.Event{
+		ID:              uuid.New().String(),
+		IdentityAddress: charge.IdentityAddress,
+		PayerAddress:    charge.PayerAddress,
+		PlanID:          charge.PlanID,
+		ChargeID:        charge.ChargeID,
+		Type:            domain.EventChargeFailed,
+		Description:     reason,
+		Metadata:        fmt.Sprintf(`{"subscription_id":"%s","charge_record_id":"%s","charge_status":"%s"}`, subscriptionID, charge.ID, charge.Status),
+		CreatedAt:       now,
+	}
+
+	if err := s.store.FailCharge(ctx, charge, event); err != nil {
+		return fmt.Errorf("persist charge failure: %w", err)
+	}
+
+	return nil
+}
+
+// ApplyAuthorizationRevoked zeroes an authorization once its
+// cancelAuthorization transaction tx is confirmed and writes its
+// authorization_revoked event.
+func (s *SubscriptionLifecycleService) ApplyAuthorizationRevoked(ctx context.Context, authorization *domain.Authorization, tx *domain.ChainTransaction) error {
+	now := time.Now().UnixMilli()
+	authorization.PermitStatus = domain.AuthorizationRevoked
+	authorization.AuthorizedAllowance = 0
+	authorization.RemainingAllowance = 0
+	authorization.UpdatedAt = now
+
+	event := &domain.Event{
+		ID:              uuid.New().String(),
+		IdentityAddress: authorization.IdentityAddress,
+		PayerAddress:    authorization.PayerAddress,
+		PlanID:          authorization.PlanID,
+		Type:            domain.EventAuthorizationRevoked,
+		Description:     "Vault authorization revoked on chain; the service can no longer charge this payer",
+		Metadata: fmt.Sprintf(`{"subscription_id":"%s","authorization_id":"%s","authorization_status":"%s","revoke_tx_hash":"%s","block_number":%d,"block_hash":"%s"}`,
+			tx.SubscriptionID, authorization.ID, authorization.PermitStatus, tx.SettledTxHash(), tx.BlockNumber, tx.BlockHash),
+		CreatedAt: now,
+	}
+
+	if err := s.store.RevokeAuthorization(ctx, authorization, event); err != nil {
+		return fmt.Errorf("persist authorization revocation: %w", err)
+	}
+
+	return nil
+}
+
 func (s *SubscriptionLifecycleService) ScheduleDowngrade(ctx context.Context, subscription *domain.Subscription, oldPlan *domain.Plan, newPlan *domain.Plan) error {
 	if subscription.Status != domain.SubscriptionActive {
 		return fmt.Errorf("can only downgrade active subscriptions")
@@ -397,7 +644,7 @@ func (s *SubscriptionLifecycleService) ScheduleDowngrade(ctx context.Context, su
 	subscription.UpdatedAt = now
 
 	event := &domain.Event{
-		ID:              fmt.Sprintf("evt_%d", now),
+		ID:              uuid.New().String(),
 		IdentityAddress: subscription.IdentityAddress,
 		PayerAddress:    subscription.PayerAddress,
 		PlanID:          subscription.PlanID,
@@ -414,59 +661,106 @@ func (s *SubscriptionLifecycleService) ScheduleDowngrade(ctx context.Context, su
 	return nil
 }
 
-func (s *SubscriptionLifecycleService) syncActiveSubscription(ctx context.Context, subscription *domain.Subscription, lifecycleAction string, eventType domain.EventType, description string) error {
-	if s.xraySync == nil {
-		return nil
+// RotateXrayCredential replaces an active subscription's Xray credential and
+// swaps it on every node. A subscription suspended over quota is not on the
+// nodes; it gets the new credential when the next period re-adds it.
+func (s *SubscriptionLifecycleService) RotateXrayCredential(ctx context.Context, subscription *domain.Subscription) error {
+	if subscription.Status != domain.SubscriptionActive {
+		return fmt.Errorf("%w for credential rotation: %s", ErrInvalidSubscriptionStatus, subscription.Status)
 	}
 
-	if err := s.xraySync.AddUser(ctx, subscription.IdentityAddress, xray.GetUserUUID(subscription.IdentityAddress)); err != nil {
-		return s.recordXraySyncFailure(subscription, lifecycleAction, "add_user", err)
+	now := time.Now().UnixMilli()
+	subscription.XrayUUID = xray.NewUserUUID()
+	subscription.UpdatedAt = now
+
+	xrayAction := "none"
+	xraySyncStatus := "intentional_noop"
+	var job *domain.XraySyncJob
+	if !subscription.TrafficSuspended {
+		xrayAction = string(domain.XraySyncRotateUser)
+		xraySyncStatus = "pending"
+		job = s.newXraySyncJob(subscription, domain.XraySyncRotateUser, "rotate_credential", now)
 	}
 
-	if err := s.recordXraySyncEvent(subscription, lifecycleAction, "add_user", "succeeded", "", eventType, description); err != nil {
-		return fmt.Errorf("record xray sync success: %w", err)
+	event := &domain.Event{
+		ID:              uuid.New().String(),
+		IdentityAddress: subscription.IdentityAddress,
+		PayerAddress:    subscription.PayerAddress,
+		PlanID:          subscription.PlanID,
+		Type:            domain.EventCredentialRotated,
+		Description:     "Xray credential rotated",
+		Metadata:        fmt.Sprintf(`{"subscription_id":"%s","lifecycle_action":"rotate_credential","xray_action":"%s","xray_sync_status":"%s"}`, subscription.ID, xrayAction, xraySyncStatus),
+		CreatedAt:       now,
+	}
+
+	if err := s.store.RotateXrayCredential(ctx, subscription, event, job); err != nil {
+		return fmt.Errorf("persist credential rotation: %w", err)
+	}
+
+	if err := s.deliverXraySync(ctx, subscription, job, domain.EventCredentialRotated, "Rotated credential synced to Xray"); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func (s *SubscriptionLifecycleService) syncInactiveSubscription(ctx context.Context, subscription *domain.Subscription, lifecycleAction string, eventType domain.EventType, description string) error {
+// newXraySyncJob builds the outbox row persisted with a state change, or nil
+// when Xray is not configured.
+func (s *SubscriptionLifecycleService) newXraySyncJob(subscription *domain.Subscription, action domain.XraySyncAction, lifecycleAction string, now int64) *domain.XraySyncJob {
 	if s.xraySync == nil {
 		return nil
 	}
+	return &domain.XraySyncJob{
+		ID:              uuid.New().String(),
+		SubscriptionID:  subscription.ID,
+		IdentityAddress: subscription.IdentityAddress,
+		Action:          action,
+		UUID:            subscription.XrayUUID,
+		LifecycleAction: lifecycleAction,
+		Status:          domain.XraySyncJobPending,
+		NextAttemptAt:   now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+}
+
+// deliverXraySync makes the first delivery attempt right after the state
+// change commits. A failure is not returned: the job stays in the outbox and
+// the sync worker retries it.
+func (s *SubscriptionLifecycleService) deliverXraySync(ctx context.Context, subscription *domain.Subscription, job *domain.XraySyncJob, eventType domain.EventType, description string) error {
+	if job == nil {
+		return nil
+	}
 
-	if err := s.xraySync.RemoveUser(ctx, subscription.IdentityAddress); err != nil {
-		return s.recordXraySyncFailure(subscription, lifecycleAction, "remove_user", err)
+	if syncErr := s.xraySync.deliver(ctx, job); syncErr != nil {
+		if err := s.recordXraySyncEvent(subscription, job, "retry_scheduled", syncErr.Error(), domain.EventXraySyncFailed, "Xray sync failed after lifecycle state change, retry scheduled"); err != nil {
+			return fmt.Errorf("xray sync failed after lifecycle state change: %v (also failed to write sync failure event: %w)", syncErr, err)
+		}
+		return nil
 	}
 
-	if err := s.recordXraySyncEvent(subscription, lifecycleAction, "remove_user", "succeeded", "", eventType, description); err != nil {
+	if err := s.recordXraySyncEvent(subscription, job, "succeeded", "", eventType, description); err != nil {
 		return fmt.Errorf("record xray sync success: %w", err)
 	}
 
 	return nil
 }
 
-func (s *SubscriptionLifecycleService) recordXraySyncFailure(subscription *domain.Subscription, lifecycleAction, action string, syncErr error) error {
-	if err := s.recordXraySyncEvent(subscription, lifecycleAction, action, "failed", syncErr.Error(), domain.EventChargeFailed, "Xray sync failed after lifecycle state change"); err != nil {
-		return fmt.Errorf("xray sync failed after lifecycle state change: %v (also failed to write sync failure event: %w)", syncErr, err)
-	}
-	return fmt.Errorf("xray sync failed after lifecycle state change: %w", syncErr)
-}
-
-func (s *SubscriptionLifecycleService) recordXraySyncEvent(subscription *domain.Subscription, lifecycleAction, action, syncStatus, syncError string, eventType domain.EventType, description string) error {
+func (s *SubscriptionLifecycleService) recordXraySyncEvent(subscription *domain.Subscription, job *domain.XraySyncJob, syncStatus, syncError string, eventType domain.EventType, description string) error {
 	now := time.Now().UnixMilli()
 	metadata := fmt.Sprintf(
-		`{"subscription_id":"%s","status":"%s","lifecycle_action":"%s","xray_action":"%s","xray_sync_status":"%s","xray_error":"%s"}`,
+		`{"subscription_id":"%s","status":"%s","lifecycle_action":"%s","xray_action":"%s","xray_sync_status":"%s","xray_sync_job_id":"%s","xray_error":"%s"}`,
 		subscription.ID,
 		subscription.Status,
-		lifecycleAction,
-		action,
+		job.LifecycleAction,
+		job.Action,
 		syncStatus,
+		job.ID,
 		syncError,
 	)
 
 	return s.events.Create(&domain.Event{
-		ID:              fmt.Sprintf("evt_%s_xray_%d", subscription.ID, now),
+		ID:              uuid.New().String(),
 		IdentityAddress: subscription.IdentityAddress,
 		PayerAddress:    subscription.PayerAddress,
 		PlanID:          subscription.PlanID,
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	"market-blockchain/internal/domain"
 )
@@ -145,6 +146,13 @@ type lifecycleTestStore struct {
 	completeRenewalCalls         int
 	applyUpgradeCalls            int
 	scheduleDowngradeCalls       int
+	endSubscriptionCalls         int
+	updateQuotaStateCalls        int
+	rotateCredentialCalls        int
+	updateDunningStateCalls      int
+	failChargeCalls              int
+	revokeAuthorizationCalls     int
+	settleChargeCalls            int
 	lastCtx                      context.Context
 
 	completed struct {
@@ -160,19 +168,51 @@ type lifecycleTestStore struct {
 		event         *domain.Event
 	}
 	upgrade struct {
+		subscription  *domain.Subscription
+		authorization *domain.Authorization
+		charge        *domain.Charge
+		event         *domain.Event
+	}
+	downgrade struct {
 		subscription *domain.Subscription
-		charge       *domain.Charge
 		event        *domain.Event
 	}
-	downgrade struct {
+	ended struct {
 		subscription *domain.Subscription
 		event        *domain.Event
 	}
+	quota struct {
+		subscription *domain.Subscription
+		event        *domain.Event
+	}
+	rotation struct {
+		subscription *domain.Subscription
+		event        *domain.Event
+	}
+	dunning struct {
+		subscription *domain.Subscription
+		event        *domain.Event
+	}
+	failed struct {
+		charge *domain.Charge
+		event  *domain.Event
+	}
+	revoked struct {
+		authorization *domain.Authorization
+		event         *domain.Event
+	}
+	settled struct {
+		authorization *domain.Authorization
+		charge        *domain.Charge
+		event         *domain.Event
+	}
+	xrayJobs []*domain.XraySyncJob
 
 	firstChargeErr error
 	renewalErr     error
 	upgradeErr     error
 	downgradeErr   error
+	endErr         error
 }
 
 func (s *lifecycleTestStore) CreateInitialState(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
@@ -181,7 +221,7 @@ func (s *lifecycleTestStore) CreateInitialState(ctx context.Context, subscriptio
 	return nil
 }
 
-func (s *lifecycleTestStore) CompleteFirstCharge(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
+func (s *lifecycleTestStore) CompleteFirstCharge(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event, xraySync *domain.XraySyncJob) error {
 	if s.firstChargeErr != nil {
 		return s.firstChargeErr
 	}
@@ -195,10 +235,11 @@ func (s *lifecycleTestStore) CompleteFirstCharge(ctx context.Context, subscripti
 	s.completed.authorization = &authCopy
 	s.completed.charge = &chargeCopy
 	s.completed.event = &eventCopy
+	s.recordXrayJob(xraySync)
 	return nil
 }
 
-func (s *lifecycleTestStore) CompleteRenewal(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
+func (s *lifecycleTestStore) CompleteRenewal(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event, xraySync *domain.XraySyncJob) error {
 	if s.renewalErr != nil {
 		return s.renewalErr
 	}
@@ -212,19 +253,22 @@ func (s *lifecycleTestStore) CompleteRenewal(ctx context.Context, subscription *
 	s.renewal.authorization = &authCopy
 	s.renewal.charge = &chargeCopy
 	s.renewal.event = &eventCopy
+	s.recordXrayJob(xraySync)
 	return nil
 }
 
-func (s *lifecycleTestStore) ApplyImmediateUpgrade(ctx context.Context, subscription *domain.Subscription, charge *domain.Charge, event *domain.Event) error {
+func (s *lifecycleTestStore) ApplyImmediateUpgrade(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
 	if s.upgradeErr != nil {
 		return s.upgradeErr
 	}
 	s.lastCtx = ctx
 	s.applyUpgradeCalls++
 	subCopy := *subscription
+	authCopy := *authorization
 	chargeCopy := *charge
 	eventCopy := *event
 	s.upgrade.subscription = &subCopy
+	s.upgrade.authorization = &authCopy
 	s.upgrade.charge = &chargeCopy
 	s.upgrade.event = &eventCopy
 	return nil
@@ -243,16 +287,118 @@ func (s *lifecycleTestStore) ScheduleDowngrade(ctx context.Context, subscription
 	return nil
 }
 
+func (s *lifecycleTestStore) EndSubscription(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	if s.endErr != nil {
+		return s.endErr
+	}
+	s.lastCtx = ctx
+	s.endSubscriptionCalls++
+	subCopy := *subscription
+	eventCopy := *event
+	s.ended.subscription = &subCopy
+	s.ended.event = &eventCopy
+	s.recordXrayJob(xraySync)
+	return nil
+}
+
+func (s *lifecycleTestStore) UpdateQuotaState(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	s.lastCtx = ctx
+	s.updateQuotaStateCalls++
+	subCopy := *subscription
+	eventCopy := *event
+	s.quota.subscription = &subCopy
+	s.quota.event = &eventCopy
+	s.recordXrayJob(xraySync)
+	return nil
+}
+
+func (s *lifecycleTestStore) RotateXrayCredential(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	s.lastCtx = ctx
+	s.rotateCredentialCalls++
+	subCopy := *subscription
+	eventCopy := *event
+	s.rotation.subscription = &subCopy
+	s.rotation.event = &eventCopy
+	s.recordXrayJob(xraySync)
+	return nil
+}
+
+func (s *lifecycleTestStore) UpdateDunningState(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	s.lastCtx = ctx
+	s.updateDunningStateCalls++
+	subCopy := *subscription
+	eventCopy := *event
+	s.dunning.subscription = &subCopy
+	s.dunning.event = &eventCopy
+	s.recordXrayJob(xraySync)
+	return nil
+}
+
+func (s *lifecycleTestStore) FailCharge(ctx context.Context, charge *domain.Charge, event *domain.Event) error {
+	s.lastCtx = ctx
+	s.failChargeCalls++
+	chargeCopy := *charge
+	eventCopy := *event
+	s.failed.charge = &chargeCopy
+	s.failed.event = &eventCopy
+	return nil
+}
+
+func (s *lifecycleTestStore) SettleCharge(ctx context.Context, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
+	s.lastCtx = ctx
+	s.settleChargeCalls++
+	authCopy := *authorization
+	chargeCopy := *charge
+	eventCopy := *event
+	s.settled.authorization = &authCopy
+	s.settled.charge = &chargeCopy
+	s.settled.event = &eventCopy
+	return nil
+}
+
+func (s *lifecycleTestStore) RevokeAuthorization(ctx context.Context, authorization *domain.Authorization, event *domain.Event) error {
+	s.lastCtx = ctx
+	s.revokeAuthorizationCalls++
+	authCopy := *authorization
+	eventCopy := *event
+	s.revoked.authorization = &authCopy
+	s.revoked.event = &eventCopy
+	return nil
+}
+
+func (s *lifecycleTestStore) recordXrayJob(job *domain.XraySyncJob) {
+	if job != nil {
+		jobCopy := *job
+		s.xrayJobs = append(s.xrayJobs, &jobCopy)
+	}
+}
+
+type lifecycleTestOutbox struct {
+	updated []*domain.XraySyncJob
+}
+
+func (o *lifecycleTestOutbox) Update(job *domain.XraySyncJob) error {
+	jobCopy := *job
+	o.updated = append(o.updated, &jobCopy)
+	return nil
+}
+
+func (o *lifecycleTestOutbox) ListDue(ctx context.Context, now int64, limit int) ([]*domain.XraySyncJob, error) {
+	return nil, nil
+}
+
 type lifecycleTestXray struct {
 	addCalls    int
 	removeCalls int
 	addErr      error
 	removeErr   error
 	lastCtx     context.Context
+	lastUUID    string
 }
 
 func (x *lifecycleTestXray) AddUser(ctx context.Context, email, uuid string) error {
 	x.lastCtx = ctx
+	x.lastUUID = uuid
 	x.addCalls++
 	return x.addErr
 }
@@ -272,6 +418,8 @@ func TestSubscriptionLifecycleServiceCreatePendingSubscriptionPassesCtxToStore(t
 		&lifecycleTestEventRepo{},
 		store,
 		&lifecycleTestXray{},
+		&lifecycleTestOutbox{},
+		DunningPolicy{},
 	)
 
 	ctx := context.WithValue(context.Background(), "trace_id", "trace-create-pending")
@@ -303,6 +451,9 @@ func TestSubscriptionLifecycleServiceCreatePendingSubscriptionPassesCtxToStore(t
 	if store.lastCtx != ctx {
 		t.Fatal("expected lifecycle ctx to be passed to store unchanged")
 	}
+	if result.Subscription.XrayUUID == "" {
+		t.Fatal("expected new subscription to get an Xray credential")
+	}
 }
 
 func TestSubscriptionLifecycleServiceCompleteFirstChargePassesCtxToStoreAndXray(t *testing.T) {
@@ -315,6 +466,8 @@ func TestSubscriptionLifecycleServiceCompleteFirstChargePassesCtxToStoreAndXray(
 		&lifecycleTestEventRepo{},
 		store,
 		xraySync,
+		&lifecycleTestOutbox{},
+		DunningPolicy{},
 	)
 
 	ctx := context.WithValue(context.Background(), "trace_id", "trace-first-charge")
@@ -326,6 +479,7 @@ func TestSubscriptionLifecycleServiceCompleteFirstChargePassesCtxToStoreAndXray(
 		Status:                 domain.SubscriptionPending,
 		AutoRenew:              true,
 		CurrentAuthorizationID: "auth_1",
+		XrayUUID:               "uuid_1",
 	}
 	authorization := &domain.Authorization{
 		ID:                  "auth_1",
@@ -357,8 +511,8 @@ func TestSubscriptionLifecycleServiceCompleteFirstChargePassesCtxToStoreAndXray(
 	if store.lastCtx != ctx {
 		t.Fatal("expected lifecycle ctx to be passed to store unchanged")
 	}
-	if xraySync.addCalls != 1 {
-		t.Fatalf("expected one Xray add, got %d", xraySync.addCalls)
+	if xraySync.addCalls != 1 || xraySync.lastUUID != "uuid_1" {
+		t.Fatalf("expected one Xray add with the stored credential, got %d adds with %q", xraySync.addCalls, xraySync.lastUUID)
 	}
 	if xraySync.lastCtx != ctx {
 		t.Fatal("expected lifecycle ctx to be passed to xray unchanged")
@@ -369,31 +523,44 @@ func TestSubscriptionLifecycleServiceCancelSubscription(t *testing.T) {
 	t.Run("active subscription cancels and writes event", func(t *testing.T) {
 		subscriptions := &lifecycleTestSubscriptionRepo{}
 		events := &lifecycleTestEventRepo{}
+		store := &lifecycleTestStore{}
 		xraySync := &lifecycleTestXray{}
+		outbox := &lifecycleTestOutbox{}
 		service := NewSubscriptionLifecycleService(
 			subscriptions,
 			&lifecycleTestAuthorizationRepo{},
 			&lifecycleTestChargeRepo{},
 			events,
-			&lifecycleTestStore{},
+			store,
 			xraySync,
+			outbox,
+			DunningPolicy{},
 		)
 
 		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", Status: domain.SubscriptionActive, AutoRenew: true}
 		if err := service.CancelSubscription(context.Background(), subscription); err != nil {
 			t.Fatalf("CancelSubscription returned error: %v", err)
 		}
-		if subscriptions.updateCalls != 1 {
-			t.Fatalf("expected one update, got %d", subscriptions.updateCalls)
+		if store.endSubscriptionCalls != 1 {
+			t.Fatalf("expected one end subscription transaction, got %d", store.endSubscriptionCalls)
 		}
-		if subscriptions.updated == nil || subscriptions.updated.Status != domain.SubscriptionCancelled {
-			t.Fatalf("expected cancelled subscription, got %+v", subscriptions.updated)
+		if store.ended.subscription == nil || store.ended.subscription.Status != domain.SubscriptionCancelled {
+			t.Fatalf("expected cancelled subscription, got %+v", store.ended.subscription)
 		}
-		if subscriptions.updated.AutoRenew {
+		if store.ended.subscription.AutoRenew {
 			t.Fatal("expected AutoRenew to be false")
 		}
-		if events.createCalls != 2 {
-			t.Fatalf("expected two events, got %d", events.createCalls)
+		if store.ended.event == nil || store.ended.event.Type != domain.EventCancel {
+			t.Fatalf("expected cancel event in the transaction, got %+v", store.ended.event)
+		}
+		if len(store.xrayJobs) != 1 || store.xrayJobs[0].Action != domain.XraySyncRemoveUser || store.xrayJobs[0].LifecycleAction != "cancel" {
+			t.Fatalf("expected remove_user outbox job in the transaction, got %+v", store.xrayJobs)
+		}
+		if len(outbox.updated) != 1 || outbox.updated[0].Status != domain.XraySyncJobSucceeded {
+			t.Fatalf("expected delivered outbox job, got %+v", outbox.updated)
+		}
+		if events.createCalls != 1 {
+			t.Fatalf("expected one sync event, got %d", events.createCalls)
 		}
 		if xraySync.removeCalls != 1 {
 			t.Fatalf("expected one Xray remove, got %d", xraySync.removeCalls)
@@ -414,6 +581,8 @@ func TestSubscriptionLifecycleServiceCancelSubscription(t *testing.T) {
 			events,
 			&lifecycleTestStore{},
 			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
 		)
 
 		subscription := &domain.Subscription{ID: "sub_1", Status: domain.SubscriptionPending, AutoRenew: true}
@@ -437,28 +606,34 @@ func TestSubscriptionLifecycleServiceExpireSubscription(t *testing.T) {
 	t.Run("active subscription expires and writes event", func(t *testing.T) {
 		subscriptions := &lifecycleTestSubscriptionRepo{}
 		events := &lifecycleTestEventRepo{}
+		store := &lifecycleTestStore{}
 		xraySync := &lifecycleTestXray{}
 		service := NewSubscriptionLifecycleService(
 			subscriptions,
 			&lifecycleTestAuthorizationRepo{},
 			&lifecycleTestChargeRepo{},
 			events,
-			&lifecycleTestStore{},
+			store,
 			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
 		)
 
 		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", Status: domain.SubscriptionActive}
 		if err := service.ExpireSubscription(context.Background(), subscription, "expired for test"); err != nil {
 			t.Fatalf("ExpireSubscription returned error: %v", err)
 		}
-		if subscriptions.updateCalls != 1 {
-			t.Fatalf("expected one update, got %d", subscriptions.updateCalls)
+		if store.endSubscriptionCalls != 1 {
+			t.Fatalf("expected one end subscription transaction, got %d", store.endSubscriptionCalls)
 		}
-		if subscriptions.updated == nil || subscriptions.updated.Status != domain.SubscriptionExpired {
-			t.Fatalf("expected expired subscription, got %+v", subscriptions.updated)
+		if store.ended.subscription == nil || store.ended.subscription.Status != domain.SubscriptionExpired {
+			t.Fatalf("expected expired subscription, got %+v", store.ended.subscription)
 		}
-		if events.createCalls != 2 {
-			t.Fatalf("expected two events, got %d", events.createCalls)
+		if len(store.xrayJobs) != 1 || store.xrayJobs[0].Action != domain.XraySyncRemoveUser || store.xrayJobs[0].LifecycleAction != "expire" {
+			t.Fatalf("expected remove_user outbox job in the transaction, got %+v", store.xrayJobs)
+		}
+		if events.createCalls != 1 {
+			t.Fatalf("expected one sync event, got %d", events.createCalls)
 		}
 		if xraySync.removeCalls != 1 {
 			t.Fatalf("expected one Xray remove, got %d", xraySync.removeCalls)
@@ -479,6 +654,8 @@ func TestSubscriptionLifecycleServiceExpireSubscription(t *testing.T) {
 			events,
 			&lifecycleTestStore{},
 			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
 		)
 
 		subscription := &domain.Subscription{ID: "sub_1", Status: domain.SubscriptionPending}
@@ -509,13 +686,15 @@ func TestSubscriptionLifecycleServiceApplyRenewalSuccess(t *testing.T) {
 			&lifecycleTestEventRepo{},
 			store,
 			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
 		)
 
-		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_old", Status: domain.SubscriptionActive, CurrentAuthorizationID: "auth_1", CurrentPeriodStart: 1000, CurrentPeriodEnd: 2000}
+		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_old", Status: domain.SubscriptionActive, CurrentAuthorizationID: "auth_1", CurrentPeriodStart: 1000, CurrentPeriodEnd: 2000, XrayUUID: "uuid_1"}
 		authorization := &domain.Authorization{ID: "auth_1", RemainingAllowance: 5000}
 		plan := &domain.Plan{PlanID: "plan_old", Name: "Basic", PeriodSeconds: 3600, AmountUSDCBaseUnits: 300}
 
-		if err := service.ApplyRenewalSuccess(context.Background(), subscription, authorization, plan, "charge_record_1", "charge_1"); err != nil {
+		if err := service.ApplyRenewalSuccess(context.Background(), subscription, authorization, plan, &domain.Charge{ID: "charge_record_1", ChargeID: "charge_1", Amount: 300, Status: domain.ChargePending}, "0xrenewal"); err != nil {
 			t.Fatalf("ApplyRenewalSuccess returned error: %v", err)
 		}
 		if store.completeRenewalCalls != 1 {
@@ -527,6 +706,9 @@ func TestSubscriptionLifecycleServiceApplyRenewalSuccess(t *testing.T) {
 		if store.renewal.subscription.LastChargeID != "charge_1" {
 			t.Fatalf("unexpected last charge id: %s", store.renewal.subscription.LastChargeID)
 		}
+		if store.renewal.charge.Status != domain.ChargeCompleted || store.renewal.charge.TxHash != "0xrenewal" {
+			t.Fatalf("expected completed charge with tx hash, got %s %s", store.renewal.charge.Status, store.renewal.charge.TxHash)
+		}
 		if store.renewal.authorization.RemainingAllowance != 4700 {
 			t.Fatalf("unexpected remaining allowance: %d", store.renewal.authorization.RemainingAllowance)
 		}
@@ -548,13 +730,15 @@ func TestSubscriptionLifecycleServiceApplyRenewalSuccess(t *testing.T) {
 			&lifecycleTestEventRepo{},
 			store,
 			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
 		)
 
 		subscription := &domain.Subscription{ID: "sub_1", Status: domain.SubscriptionActive, CurrentPeriodEnd: 2000}
 		authorization := &domain.Authorization{ID: "auth_1", RemainingAllowance: 5000}
 		plan := &domain.Plan{PlanID: "plan_old", Name: "Basic", PeriodSeconds: 3600, AmountUSDCBaseUnits: 300}
 
-		err := service.ApplyRenewalSuccess(context.Background(), subscription, authorization, plan, "charge_record_1", "charge_1")
+		err := service.ApplyRenewalSuccess(context.Background(), subscription, authorization, plan, &domain.Charge{ID: "charge_record_1", ChargeID: "charge_1", Amount: 300, Status: domain.ChargePending}, "0xrenewal")
 		if err == nil || !strings.Contains(err.Error(), "persist renewal success") {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -571,14 +755,16 @@ func TestSubscriptionLifecycleServiceApplyRenewalSuccess(t *testing.T) {
 			&lifecycleTestEventRepo{},
 			&lifecycleTestStore{},
 			&lifecycleTestXray{},
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
 		)
 
 		subscription := &domain.Subscription{ID: "sub_1", Status: domain.SubscriptionPending}
 		authorization := &domain.Authorization{ID: "auth_1", RemainingAllowance: 5000}
 		plan := &domain.Plan{PlanID: "plan_old", Name: "Basic", PeriodSeconds: 3600, AmountUSDCBaseUnits: 300}
 
-		err := service.ApplyRenewalSuccess(context.Background(), subscription, authorization, plan, "charge_record_1", "charge_1")
-		if err == nil || !strings.Contains(err.Error(), "renewal requires active subscription") {
+		err := service.ApplyRenewalSuccess(context.Background(), subscription, authorization, plan, &domain.Charge{ID: "charge_record_1", ChargeID: "charge_1", Amount: 300, Status: domain.ChargePending}, "0xrenewal")
+		if err == nil || !strings.Contains(err.Error(), "renewal requires active or past due subscription") {
 			t.Fatalf("unexpected error: %v", err)
 		}
 	})
@@ -595,13 +781,17 @@ func TestSubscriptionLifecycleServiceApplyImmediateUpgrade(t *testing.T) {
 			&lifecycleTestEventRepo{},
 			store,
 			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
 		)
 
-		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "old_plan", Status: domain.SubscriptionActive, CurrentAuthorizationID: "auth_1"}
+		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "old_plan", PendingPlanID: "cheap_plan", Status: domain.SubscriptionActive, CurrentPeriodEnd: 2000, CurrentAuthorizationID: "auth_1"}
+		authorization := &domain.Authorization{ID: "auth_1", RemainingAllowance: 1000, PermitStatus: domain.AuthorizationCompleted}
+		charge := &domain.Charge{ID: "charge_record_1", ChargeID: "upgrade_sub_1_new_plan_2000", Amount: 123, Status: domain.ChargePending, TxHash: "0xupgrade"}
 		oldPlan := &domain.Plan{PlanID: "old_plan", Name: "Old"}
 		newPlan := &domain.Plan{PlanID: "new_plan", Name: "New"}
 
-		if err := service.ApplyImmediateUpgrade(context.Background(), subscription, oldPlan, newPlan, 123); err != nil {
+		if err := service.ApplyImmediateUpgrade(context.Background(), subscription, authorization, oldPlan, newPlan, charge, "0xupgrade"); err != nil {
 			t.Fatalf("ApplyImmediateUpgrade returned error: %v", err)
 		}
 		if store.applyUpgradeCalls != 1 {
@@ -610,8 +800,14 @@ func TestSubscriptionLifecycleServiceApplyImmediateUpgrade(t *testing.T) {
 		if store.upgrade.subscription == nil || store.upgrade.charge == nil || store.upgrade.event == nil {
 			t.Fatal("expected upgrade transaction payloads")
 		}
-		if store.upgrade.subscription.PlanID != "new_plan" {
-			t.Fatalf("unexpected updated plan: %s", store.upgrade.subscription.PlanID)
+		if store.upgrade.subscription.PlanID != "new_plan" || store.upgrade.subscription.PendingPlanID != "" {
+			t.Fatalf("unexpected updated plan: %s (pending %q)", store.upgrade.subscription.PlanID, store.upgrade.subscription.PendingPlanID)
+		}
+		if store.upgrade.charge.Status != domain.ChargeCompleted || store.upgrade.subscription.LastChargeID != "upgrade_sub_1_new_plan_2000" {
+			t.Fatalf("expected the confirmed charge completed and recorded, got %+v", store.upgrade.charge)
+		}
+		if store.upgrade.authorization.RemainingAllowance != 877 {
+			t.Fatalf("expected prorated charge deducted from allowance, got %d", store.upgrade.authorization.RemainingAllowance)
 		}
 		if !strings.Contains(store.upgrade.event.Metadata, `"subscription_id":"sub_1"`) || !strings.Contains(store.upgrade.event.Metadata, `"old_plan_id":"old_plan"`) || !strings.Contains(store.upgrade.event.Metadata, `"new_plan_id":"new_plan"`) || !strings.Contains(store.upgrade.event.Metadata, `"lifecycle_action":"upgrade"`) {
 			t.Fatalf("unexpected upgrade metadata: %s", store.upgrade.event.Metadata)
@@ -621,6 +817,43 @@ func TestSubscriptionLifecycleServiceApplyImmediateUpgrade(t *testing.T) {
 		}
 	})
 
+	for name, subscription := range map[string]*domain.Subscription{
+		"cancelled subscription": {ID: "sub_1", PlanID: "old_plan", Status: domain.SubscriptionCancelled, CurrentPeriodEnd: 2000},
+		"renewed subscription":   {ID: "sub_1", PlanID: "old_plan", Status: domain.SubscriptionActive, CurrentPeriodEnd: 3000},
+	} {
+		t.Run(name+" settles the charge as a credit", func(t *testing.T) {
+			store := &lifecycleTestStore{}
+			service := NewSubscriptionLifecycleService(
+				&lifecycleTestSubscriptionRepo{},
+				&lifecycleTestAuthorizationRepo{},
+				&lifecycleTestChargeRepo{},
+				&lifecycleTestEventRepo{},
+				store,
+				&lifecycleTestXray{},
+				&lifecycleTestOutbox{},
+				DunningPolicy{},
+			)
+
+			authorization := &domain.Authorization{ID: "auth_1", RemainingAllowance: 1000}
+			charge := &domain.Charge{ID: "charge_record_1", ChargeID: "upgrade_sub_1_new_plan_2000", Amount: 123, Status: domain.ChargePending, TxHash: "0xupgrade"}
+			if err := service.ApplyImmediateUpgrade(context.Background(), subscription, authorization, &domain.Plan{PlanID: "old_plan"}, &domain.Plan{PlanID: "new_plan", Name: "New"}, charge, "0xupgrade"); err != nil {
+				t.Fatalf("ApplyImmediateUpgrade returned error: %v", err)
+			}
+			if store.applyUpgradeCalls != 1 || store.upgrade.charge.Status != domain.ChargeCompleted {
+				t.Fatalf("expected the confirmed charge completed, got %+v", store.upgrade.charge)
+			}
+			if store.upgrade.authorization.RemainingAllowance != 877 {
+				t.Fatalf("expected the charge deducted from allowance, got %d", store.upgrade.authorization.RemainingAllowance)
+			}
+			if store.upgrade.subscription.PlanID != "old_plan" {
+				t.Fatalf("expected the plan unchanged, got %s", store.upgrade.subscription.PlanID)
+			}
+			if store.upgrade.event.Type != domain.EventUpgradeCredit || !strings.Contains(store.upgrade.event.Metadata, `"credit_amount":123`) {
+				t.Fatalf("expected an upgrade_credit event, got %+v", store.upgrade.event)
+			}
+		})
+	}
+
 	t.Run("transaction failure does not produce xray side effect", func(t *testing.T) {
 		store := &lifecycleTestStore{upgradeErr: errors.New("tx failed")}
 		xraySync := &lifecycleTestXray{}
@@ -631,9 +864,11 @@ func TestSubscriptionLifecycleServiceApplyImmediateUpgrade(t *testing.T) {
 			&lifecycleTestEventRepo{},
 			store,
 			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
 		)
 
-		err := service.ApplyImmediateUpgrade(context.Background(), &domain.Subscription{ID: "sub_1", Status: domain.SubscriptionActive}, &domain.Plan{PlanID: "old_plan"}, &domain.Plan{PlanID: "new_plan"}, 100)
+		err := service.ApplyImmediateUpgrade(context.Background(), &domain.Subscription{ID: "sub_1", Status: domain.SubscriptionActive}, &domain.Authorization{ID: "auth_1"}, &domain.Plan{PlanID: "old_plan"}, &domain.Plan{PlanID: "new_plan"}, &domain.Charge{ID: "charge_record_1", Amount: 100}, "0xupgrade")
 		if err == nil || !strings.Contains(err.Error(), "persist immediate upgrade") {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -654,6 +889,8 @@ func TestSubscriptionLifecycleServiceScheduleDowngrade(t *testing.T) {
 			&lifecycleTestEventRepo{},
 			store,
 			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
 		)
 
 		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "old_plan", Status: domain.SubscriptionActive, CurrentPeriodEnd: 9000}
@@ -687,6 +924,8 @@ func TestSubscriptionLifecycleServiceScheduleDowngrade(t *testing.T) {
 			&lifecycleTestEventRepo{},
 			store,
 			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
 		)
 
 		err := service.ScheduleDowngrade(context.Background(), &domain.Subscription{ID: "sub_1", Status: domain.SubscriptionActive}, &domain.Plan{PlanID: "old_plan"}, &domain.Plan{PlanID: "new_plan"})
@@ -698,3 +937,459 @@ func TestSubscriptionLifecycleServiceScheduleDowngrade(t *testing.T) {
 		}
 	})
 }
+
+func TestSubscriptionLifecycleServiceEventIDsAreUniqueWithinAMillisecond(t *testing.T) {
+	store := &lifecycleTestStore{}
+	service := NewSubscriptionLifecycleService(
+		&lifecycleTestSubscriptionRepo{},
+		&lifecycleTestAuthorizationRepo{},
+		&lifecycleTestChargeRepo{},
+		&lifecycleTestEventRepo{},
+		store,
+		nil,
+		nil,
+		DunningPolicy{},
+	)
+
+	oldPlan := &domain.Plan{PlanID: "old_plan"}
+	newPlan := &domain.Plan{PlanID: "new_plan"}
+	seen := make(map[string]bool)
+	for _, id := range []string{"sub_1", "sub_2", "sub_3"} {
+		if err := service.ScheduleDowngrade(context.Background(), &domain.Subscription{ID: id, Status: domain.SubscriptionActive}, oldPlan, newPlan); err != nil {
+			t.Fatalf("ScheduleDowngrade returned error: %v", err)
+		}
+		if seen[store.downgrade.event.ID] {
+			t.Fatalf("event ID %s reused for %s", store.downgrade.event.ID, id)
+		}
+		seen[store.downgrade.event.ID] = true
+	}
+}
+
+func TestSubscriptionLifecycleServiceXraySyncFailureSchedulesRetry(t *testing.T) {
+	events := &lifecycleTestEventRepo{}
+	store := &lifecycleTestStore{}
+	outbox := &lifecycleTestOutbox{}
+	service := NewSubscriptionLifecycleService(
+		&lifecycleTestSubscriptionRepo{},
+		&lifecycleTestAuthorizationRepo{},
+		&lifecycleTestChargeRepo{},
+		events,
+		store,
+		&lifecycleTestXray{removeErr: errors.New("all nodes unreachable")},
+		outbox,
+		DunningPolicy{},
+	)
+
+	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", Status: domain.SubscriptionActive}
+	if err := service.CancelSubscription(context.Background(), subscription); err != nil {
+		t.Fatalf("expected committed cancellation to succeed despite Xray failure, got %v", err)
+	}
+	if store.endSubscriptionCalls != 1 || len(store.xrayJobs) != 1 {
+		t.Fatalf("expected state and outbox job to be committed, got %d calls and %d jobs", store.endSubscriptionCalls, len(store.xrayJobs))
+	}
+	if len(outbox.updated) != 1 {
+		t.Fatalf("expected one outbox update, got %d", len(outbox.updated))
+	}
+	job := outbox.updated[0]
+	if job.Status != domain.XraySyncJobPending || job.Attempts != 1 || job.LastError != "all nodes unreachable" {
+		t.Fatalf("expected pending job with one failed attempt, got %+v", job)
+	}
+	if job.NextAttemptAt <= job.UpdatedAt {
+		t.Fatalf("expected retry to be scheduled in the future, got next %d at %d", job.NextAttemptAt, job.UpdatedAt)
+	}
+	if events.createCalls != 1 || !strings.Contains(events.events[0].Metadata, `"xray_sync_status":"retry_scheduled"`) {
+		t.Fatalf("expected retry_scheduled event, got %d events", events.createCalls)
+	}
+	if events.events[0].Type != domain.EventXraySyncFailed || domain.IsWebhookEventType(events.events[0].Type) {
+		t.Fatalf("expected an internal xray_sync_failed event, got %s", events.events[0].Type)
+	}
+}
+
+func TestSubscriptionLifecycleServiceWithoutXrayWritesNoOutboxJob(t *testing.T) {
+	events := &lifecycleTestEventRepo{}
+	store := &lifecycleTestStore{}
+	service := NewSubscriptionLifecycleService(
+		&lifecycleTestSubscriptionRepo{},
+		&lifecycleTestAuthorizationRepo{},
+		&lifecycleTestChargeRepo{},
+		events,
+		store,
+		nil,
+		&lifecycleTestOutbox{},
+		DunningPolicy{},
+	)
+
+	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", Status: domain.SubscriptionActive}
+	if err := service.ExpireSubscription(context.Background(), subscription, "expired for test"); err != nil {
+		t.Fatalf("ExpireSubscription returned error: %v", err)
+	}
+	if store.endSubscriptionCalls != 1 {
+		t.Fatalf("expected one end subscription transaction, got %d", store.endSubscriptionCalls)
+	}
+	if len(store.xrayJobs) != 0 {
+		t.Fatalf("expected no outbox job without Xray, got %+v", store.xrayJobs)
+	}
+	if events.createCalls != 0 {
+		t.Fatalf("expected no sync events, got %d", events.createCalls)
+	}
+}
+
+func TestSubscriptionLifecycleServiceApplyQuotaExceeded(t *testing.T) {
+	t.Run("suspend policy removes user from xray", func(t *testing.T) {
+		store := &lifecycleTestStore{}
+		xraySync := &lifecycleTestXray{}
+		service := NewSubscriptionLifecycleService(
+			&lifecycleTestSubscriptionRepo{},
+			&lifecycleTestAuthorizationRepo{},
+			&lifecycleTestChargeRepo{},
+			&lifecycleTestEventRepo{},
+			store,
+			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
+		)
+
+		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PlanID: "plan_1", Status: domain.SubscriptionActive}
+		plan := &domain.Plan{PlanID: "plan_1", TrafficQuotaBytes: 1000, OverQuotaPolicy: domain.OverQuotaSuspend}
+
+		if err := service.ApplyQuotaExceeded(context.Background(), subscription, plan, 1200); err != nil {
+			t.Fatalf("ApplyQuotaExceeded returned error: %v", err)
+		}
+		if store.updateQuotaStateCalls != 1 {
+			t.Fatalf("expected one quota state transaction, got %d", store.updateQuotaStateCalls)
+		}
+		persisted := store.quota.subscription
+		if !persisted.TrafficSuspended || persisted.QuotaExceededAt == 0 || persisted.Status != domain.SubscriptionActive {
+			t.Fatalf("expected active subscription suspended for quota, got %+v", persisted)
+		}
+		if store.quota.event.Type != domain.EventQuotaExceeded || !strings.Contains(store.quota.event.Metadata, `"period_traffic":1200`) {
+			t.Fatalf("unexpected quota event: %+v", store.quota.event)
+		}
+		if len(store.xrayJobs) != 1 || store.xrayJobs[0].Action != domain.XraySyncRemoveUser || store.xrayJobs[0].LifecycleAction != "quota_suspend" {
+			t.Fatalf("expected quota_suspend remove job, got %+v", store.xrayJobs)
+		}
+		if xraySync.removeCalls != 1 {
+			t.Fatalf("expected xray remove to be called once, got %d", xraySync.removeCalls)
+		}
+
+		if err := service.ApplyQuotaExceeded(context.Background(), subscription, plan, 1500); err != nil {
+			t.Fatalf("second ApplyQuotaExceeded returned error: %v", err)
+		}
+		if store.updateQuotaStateCalls != 1 || xraySync.removeCalls != 1 {
+			t.Fatalf("expected quota to be handled once per period, got %d transactions and %d removals", store.updateQuotaStateCalls, xraySync.removeCalls)
+		}
+	})
+
+	t.Run("warn policy keeps xray access", func(t *testing.T) {
+		store := &lifecycleTestStore{}
+		xraySync := &lifecycleTestXray{}
+		service := NewSubscriptionLifecycleService(
+			&lifecycleTestSubscriptionRepo{},
+			&lifecycleTestAuthorizationRepo{},
+			&lifecycleTestChargeRepo{},
+			&lifecycleTestEventRepo{},
+			store,
+			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
+		)
+
+		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PlanID: "plan_1", Status: domain.SubscriptionActive}
+		plan := &domain.Plan{PlanID: "plan_1", TrafficQuotaBytes: 1000, OverQuotaPolicy: domain.OverQuotaWarn}
+
+		if err := service.ApplyQuotaExceeded(context.Background(), subscription, plan, 1000); err != nil {
+			t.Fatalf("ApplyQuotaExceeded returned error: %v", err)
+		}
+		if store.quota.subscription.TrafficSuspended || store.quota.subscription.QuotaExceededAt == 0 {
+			t.Fatalf("expected quota recorded without suspension, got %+v", store.quota.subscription)
+		}
+		if len(store.xrayJobs) != 0 || xraySync.removeCalls != 0 {
+			t.Fatalf("expected no xray change under warn policy, got %d jobs and %d removals", len(store.xrayJobs), xraySync.removeCalls)
+		}
+		if !strings.Contains(store.quota.event.Metadata, `"policy":"warn"`) {
+			t.Fatalf("unexpected quota event metadata: %s", store.quota.event.Metadata)
+		}
+	})
+}
+
+func TestSubscriptionLifecycleServiceApplyRenewalSuccessRestoresSuspendedTraffic(t *testing.T) {
+	store := &lifecycleTestStore{}
+	xraySync := &lifecycleTestXray{}
+	service := NewSubscriptionLifecycleService(
+		&lifecycleTestSubscriptionRepo{},
+		&lifecycleTestAuthorizationRepo{},
+		&lifecycleTestChargeRepo{},
+		&lifecycleTestEventRepo{},
+		store,
+		xraySync,
+		&lifecycleTestOutbox{},
+		DunningPolicy{},
+	)
+
+	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PlanID: "plan_1", Status: domain.SubscriptionActive, CurrentPeriodStart: 1000, CurrentPeriodEnd: 2000, PeriodTraffic: 1200, QuotaExceededAt: 1500, TrafficSuspended: true, XrayUUID: "uuid_1"}
+	plan := &domain.Plan{PlanID: "plan_1", PeriodSeconds: 3600, AmountUSDCBaseUnits: 300, TrafficQuotaBytes: 1000}
+
+	if err := service.ApplyRenewalSuccess(context.Background(), subscription, &domain.Authorization{ID: "auth_1", RemainingAllowance: 5000}, plan, &domain.Charge{ID: "charge_record_1", ChargeID: "charge_1"}, "0xrenewal"); err != nil {
+		t.Fatalf("ApplyRenewalSuccess returned error: %v", err)
+	}
+	persisted := store.renewal.subscription
+	if persisted.TrafficSuspended || persisted.QuotaExceededAt != 0 || persisted.PeriodTraffic != 0 {
+		t.Fatalf("expected period usage and suspension to be cleared, got %+v", persisted)
+	}
+	if !strings.Contains(store.renewal.event.Metadata, `"quota_restored":true`) {
+		t.Fatalf("expected renewal event to note the restored access, got %s", store.renewal.event.Metadata)
+	}
+	if xraySync.addCalls != 1 {
+		t.Fatalf("expected user to be added back to xray, got %d adds", xraySync.addCalls)
+	}
+}
+
+func TestSubscriptionLifecycleServiceRotateXrayCredential(t *testing.T) {
+	t.Run("swaps the credential on xray", func(t *testing.T) {
+		store := &lifecycleTestStore{}
+		xraySync := &lifecycleTestXray{}
+		service := NewSubscriptionLifecycleService(
+			&lifecycleTestSubscriptionRepo{},
+			&lifecycleTestAuthorizationRepo{},
+			&lifecycleTestChargeRepo{},
+			&lifecycleTestEventRepo{},
+			store,
+			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
+		)
+
+		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PlanID: "plan_1", Status: domain.SubscriptionActive, XrayUUID: "uuid_old"}
+		if err := service.RotateXrayCredential(context.Background(), subscription); err != nil {
+			t.Fatalf("RotateXrayCredential returned error: %v", err)
+		}
+		if store.rotateCredentialCalls != 1 {
+			t.Fatalf("expected one rotation transaction, got %d", store.rotateCredentialCalls)
+		}
+		newUUID := store.rotation.subscription.XrayUUID
+		if newUUID == "" || newUUID == "uuid_old" {
+			t.Fatalf("expected a fresh credential, got %q", newUUID)
+		}
+		if store.rotation.event.Type != domain.EventCredentialRotated || strings.Contains(store.rotation.event.Metadata, newUUID) {
+			t.Fatalf("unexpected rotation event: %+v", store.rotation.event)
+		}
+		if len(store.xrayJobs) != 1 || store.xrayJobs[0].Action != domain.XraySyncRotateUser || store.xrayJobs[0].UUID != newUUID {
+			t.Fatalf("expected rotate job carrying the new credential, got %+v", store.xrayJobs)
+		}
+		if xraySync.removeCalls != 1 || xraySync.addCalls != 1 || xraySync.lastUUID != newUUID {
+			t.Fatalf("expected old user removed and new credential added, got removes %d, adds %d, uuid %q", xraySync.removeCalls, xraySync.addCalls, xraySync.lastUUID)
+		}
+	})
+
+	t.Run("suspended subscription is not re-added", func(t *testing.T) {
+		store := &lifecycleTestStore{}
+		xraySync := &lifecycleTestXray{}
+		service := NewSubscriptionLifecycleService(
+			&lifecycleTestSubscriptionRepo{},
+			&lifecycleTestAuthorizationRepo{},
+			&lifecycleTestChargeRepo{},
+			&lifecycleTestEventRepo{},
+			store,
+			xraySync,
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
+		)
+
+		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PlanID: "plan_1", Status: domain.SubscriptionActive, TrafficSuspended: true, XrayUUID: "uuid_old"}
+		if err := service.RotateXrayCredential(context.Background(), subscription); err != nil {
+			t.Fatalf("RotateXrayCredential returned error: %v", err)
+		}
+		if store.rotateCredentialCalls != 1 || store.rotation.subscription.XrayUUID == "uuid_old" {
+			t.Fatalf("expected the new credential stored, got %+v", store.rotation.subscription)
+		}
+		if len(store.xrayJobs) != 0 || xraySync.addCalls != 0 || xraySync.removeCalls != 0 {
+			t.Fatalf("expected no xray sync while suspended, got %d jobs", len(store.xrayJobs))
+		}
+	})
+
+	t.Run("requires active subscription", func(t *testing.T) {
+		store := &lifecycleTestStore{}
+		service := NewSubscriptionLifecycleService(
+			&lifecycleTestSubscriptionRepo{},
+			&lifecycleTestAuthorizationRepo{},
+			&lifecycleTestChargeRepo{},
+			&lifecycleTestEventRepo{},
+			store,
+			&lifecycleTestXray{},
+			&lifecycleTestOutbox{},
+			DunningPolicy{},
+		)
+
+		subscription := &domain.Subscription{ID: "sub_1", Status: domain.SubscriptionCancelled}
+		if err := service.RotateXrayCredential(context.Background(), subscription); !errors.Is(err, ErrInvalidSubscriptionStatus) {
+			t.Fatalf("expected ErrInvalidSubscriptionStatus, got %v", err)
+		}
+		if store.rotateCredentialCalls != 0 {
+			t.Fatalf("expected nothing persisted, got %d rotations", store.rotateCredentialCalls)
+		}
+	})
+}
+
+func TestSubscriptionLifecycleServiceRecordsChargeFailureAndRevocationInStore(t *testing.T) {
+	store := &lifecycleTestStore{}
+	service := NewSubscriptionLifecycleService(&lifecycleTestSubscriptionRepo{}, &lifecycleTestAuthorizationRepo{}, &lifecycleTestChargeRepo{}, &lifecycleTestEventRepo{}, store, nil, nil, DunningPolicy{})
+
+	charge := &domain.Charge{ID: "charge_record_1", ChargeID: "renewal_sub_1_2000", Status: domain.ChargePending, TxHash: "0xcharge"}
+	if err := service.RecordChargeFailure(context.Background(), charge, "sub_1", "renewal_charge transaction 0xcharge: reverted"); err != nil {
+		t.Fatalf("RecordChargeFailure returned error: %v", err)
+	}
+	if store.failChargeCalls != 1 || store.failed.charge.Status != domain.ChargeFailed {
+		t.Fatalf("expected the failed charge persisted, got %+v", store.failed.charge)
+	}
+	if store.failed.event.Type != domain.EventChargeFailed || !strings.Contains(store.failed.event.Metadata, `"subscription_id":"sub_1"`) {
+		t.Fatalf("unexpected charge_failed event: %+v", store.failed.event)
+	}
+
+	authorization := &domain.Authorization{ID: "auth_1", PermitStatus: domain.AuthorizationCompleted, AuthorizedAllowance: 2000, RemainingAllowance: 1500}
+	tx := &domain.ChainTransaction{TxHash: "0xrevoke", Kind: domain.ChainTxRevocation, SubscriptionID: "sub_1", AuthorizationID: "auth_1"}
+	if err := service.ApplyAuthorizationRevoked(context.Background(), authorization, tx); err != nil {
+		t.Fatalf("ApplyAuthorizationRevoked returned error: %v", err)
+	}
+	if store.revokeAuthorizationCalls != 1 || store.revoked.authorization.PermitStatus != domain.AuthorizationRevoked || store.revoked.authorization.RemainingAllowance != 0 {
+		t.Fatalf("expected the revoked authorization persisted, got %+v", store.revoked.authorization)
+	}
+	if store.revoked.event.Type != domain.EventAuthorizationRevoked || !strings.Contains(store.revoked.event.Metadata, `"revoke_tx_hash":"0xrevoke"`) {
+		t.Fatalf("unexpected authorization_revoked event: %+v", store.revoked.event)
+	}
+	if !domain.IsWebhookEventType(store.failed.event.Type) || !domain.IsWebhookEventType(store.revoked.event.Type) {
+		t.Fatal("expected charge failures and revocations delivered to webhooks")
+	}
+}
+
+func TestSubscriptionLifecycleServiceApplyRenewalFailure(t *testing.T) {
+	dunning := DunningPolicy{GracePeriod: 72 * time.Hour, RetrySchedule: []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour}}
+	newService := func(store *lifecycleTestStore, xraySync *lifecycleTestXray) *SubscriptionLifecycleService {
+		return NewSubscriptionLifecycleService(
+			&lifecycleTestSubscriptionRepo{},
+			&lifecycleTestAuthorizationRepo{},
+			&lifecycleTestChargeRepo{},
+			&lifecycleTestEventRepo{},
+			store,
+			xraySync,
+			&lifecycleTestOutbox{},
+			dunning,
+		)
+	}
+
+	t.Run("first failure starts the grace period and keeps access", func(t *testing.T) {
+		store := &lifecycleTestStore{}
+		xraySync := &lifecycleTestXray{}
+		service := newService(store, xraySync)
+
+		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PlanID: "plan_1", Status: domain.SubscriptionActive, CurrentPeriodEnd: 2000, XrayUUID: "uuid_1"}
+		plan := &domain.Plan{PlanID: "plan_1", GraceAccess: domain.GraceAccessKeep}
+		if err := service.ApplyRenewalFailure(context.Background(), subscription, plan, domain.RenewalFailureInsufficientAllowance, "insufficient allowance"); err != nil {
+			t.Fatalf("ApplyRenewalFailure returned error: %v", err)
+		}
+		if store.updateDunningStateCalls != 1 || store.dunning.subscription.Status != domain.SubscriptionPastDue {
+			t.Fatalf("expected past due state persisted, got %+v", store.dunning.subscription)
+		}
+		persisted := store.dunning.subscription
+		if persisted.GraceEndsAt-persisted.PastDueAt != (72 * time.Hour).Milliseconds() || persisted.NextRenewalAttemptAt-persisted.PastDueAt != time.Hour.Milliseconds() {
+			t.Fatalf("expected a 72h grace period and a retry after 1h, got %+v", persisted)
+		}
+		if store.dunning.event.Type != domain.EventPastDue || !strings.Contains(store.dunning.event.Metadata, `"reason_code":"insufficient_allowance"`) || !strings.Contains(store.dunning.event.Metadata, `"attempt":1`) {
+			t.Fatalf("unexpected past due event: %+v", store.dunning.event)
+		}
+		if len(store.xrayJobs) != 0 || xraySync.removeCalls != 0 {
+			t.Fatal("expected access kept during the grace period")
+		}
+	})
+
+	t.Run("suspend policy removes access", func(t *testing.T) {
+		store := &lifecycleTestStore{}
+		xraySync := &lifecycleTestXray{}
+		service := newService(store, xraySync)
+
+		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PlanID: "plan_1", Status: domain.SubscriptionActive, XrayUUID: "uuid_1"}
+		plan := &domain.Plan{PlanID: "plan_1", GraceAccess: domain.GraceAccessSuspend}
+		if err := service.ApplyRenewalFailure(context.Background(), subscription, plan, domain.RenewalFailureChargeReverted, "reverted"); err != nil {
+			t.Fatalf("ApplyRenewalFailure returned error: %v", err)
+		}
+		if len(store.xrayJobs) != 1 || store.xrayJobs[0].Action != domain.XraySyncRemoveUser || xraySync.removeCalls != 1 {
+			t.Fatalf("expected the user removed from Xray, got %+v", store.xrayJobs)
+		}
+	})
+
+	t.Run("retries follow the escalating schedule", func(t *testing.T) {
+		store := &lifecycleTestStore{}
+		service := newService(store, &lifecycleTestXray{})
+
+		now := time.Now().UnixMilli()
+		subscription := &domain.Subscription{ID: "sub_1", PlanID: "plan_1", Status: domain.SubscriptionPastDue, PastDueAt: now, GraceEndsAt: now + (72 * time.Hour).Milliseconds(), RenewalAttempts: 1}
+		if err := service.ApplyRenewalFailure(context.Background(), subscription, nil, domain.RenewalFailureChargeRejected, "rejected"); err != nil {
+			t.Fatalf("ApplyRenewalFailure returned error: %v", err)
+		}
+		persisted := store.dunning.subscription
+		if persisted.RenewalAttempts != 2 || persisted.NextRenewalAttemptAt-persisted.UpdatedAt != (6*time.Hour).Milliseconds() {
+			t.Fatalf("expected the second retry 6h later, got %+v", persisted)
+		}
+		if !strings.Contains(store.dunning.event.Metadata, `"lifecycle_action":"renewal_retry_failed"`) {
+			t.Fatalf("unexpected event metadata: %s", store.dunning.event.Metadata)
+		}
+	})
+
+	t.Run("failure after the grace period expires", func(t *testing.T) {
+		store := &lifecycleTestStore{}
+		service := newService(store, &lifecycleTestXray{})
+
+		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PlanID: "plan_1", Status: domain.SubscriptionPastDue, PastDueAt: 1, GraceEndsAt: 2, RenewalAttempts: 3, XrayUUID: "uuid_1"}
+		if err := service.ApplyRenewalFailure(context.Background(), subscription, nil, domain.RenewalFailureInsufficientAllowance, "insufficient allowance"); err != nil {
+			t.Fatalf("ApplyRenewalFailure returned error: %v", err)
+		}
+		if store.endSubscriptionCalls != 1 || store.ended.subscription.Status != domain.SubscriptionExpired || store.updateDunningStateCalls != 0 {
+			t.Fatalf("expected the subscription expired, got %+v", store.ended.subscription)
+		}
+		if !strings.Contains(store.ended.event.Description, "insufficient_allowance") {
+			t.Fatalf("expected the expiry to name the last failure, got %q", store.ended.event.Description)
+		}
+	})
+
+	t.Run("successful renewal recovers a past due subscription", func(t *testing.T) {
+		store := &lifecycleTestStore{}
+		service := newService(store, &lifecycleTestXray{})
+
+		subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PlanID: "plan_1", Status: domain.SubscriptionPastDue, CurrentPeriodEnd: 2000, PastDueAt: 2000, GraceEndsAt: 5000, RenewalAttempts: 2, LastRenewalFailure: domain.RenewalFailureChargeRejected, NextRenewalAttemptAt: 3000, XrayUUID: "uuid_1"}
+		authorization := &domain.Authorization{ID: "auth_1", RemainingAllowance: 1000}
+		plan := &domain.Plan{PlanID: "plan_1", PeriodSeconds: 60, AmountUSDCBaseUnits: 300}
+		charge := &domain.Charge{ID: "charge_record_1", ChargeID: RenewalChargeID("sub_1", 2000), Amount: 300, Status: domain.ChargePending}
+		if err := service.ApplyRenewalSuccess(context.Background(), subscription, authorization, plan, charge, "0xrenewal"); err != nil {
+			t.Fatalf("ApplyRenewalSuccess returned error: %v", err)
+		}
+		persisted := store.renewal.subscription
+		if persisted.Status != domain.SubscriptionActive || persisted.PastDueAt != 0 || persisted.RenewalAttempts != 0 || persisted.LastRenewalFailure != "" {
+			t.Fatalf("expected an active subscription in good standing, got %+v", persisted)
+		}
+		if !strings.Contains(store.renewal.event.Metadata, `"recovered_from_past_due":true`) {
+			t.Fatalf("unexpected renewal metadata: %s", store.renewal.event.Metadata)
+		}
+	})
+}
+
+func TestDunningPolicyNextAttemptAt(t *testing.T) {
+	policy := DunningPolicy{RetrySchedule: []time.Duration{time.Millisecond, 10 * time.Millisecond}}
+
+	for _, tc := range []struct {
+		attempts int
+		want     int64
+	}{
+		{attempts: 1, want: 1001},
+		{attempts: 2, want: 1010},
+		{attempts: 5, want: 1010},
+	} {
+		if got := policy.nextAttemptAt(tc.attempts, 1000, 5000); got != tc.want {
+			t.Fatalf("attempt %d: expected %d, got %d", tc.attempts, tc.want, got)
+		}
+	}
+	if got := policy.nextAttemptAt(2, 1000, 1005); got != 1005 {
+		t.Fatalf("expected the retry capped at the end of the grace period, got %d", got)
+	}
+	if got := (DunningPolicy{}).nextAttemptAt(1, 1000, 5000); got != 5000 {
+		t.Fatalf("expected a single retry at the end of the grace period without a schedule, got %d", got)
+	}
+}
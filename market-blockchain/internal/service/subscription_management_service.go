@@ -2,41 +2,134 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
 
+	"market-blockchain/internal/blockchain"
 	"market-blockchain/internal/domain"
 	"market-blockchain/internal/repository"
 )
 
+var (
+	ErrRevocationUnavailable = errors.New("blockchain client not configured, cannot revoke authorization")
+	// ErrCancelAfterRevocation means the revocation was broadcast but the
+	// subscription could not be cancelled. The result still carries the
+	// revocation hash; retry the cancellation without a revocation.
+	ErrCancelAfterRevocation = errors.New("authorization revocation submitted but cancellation failed")
+)
+
 type SubscriptionManagementService struct {
 	subscriptions repository.SubscriptionRepository
 	lifecycle     *SubscriptionLifecycleService
+	chainService  *ChainService
 }
 
+// NewSubscriptionManagementService accepts a nil chainService; cancellation
+// then still works but revocations are refused.
 func NewSubscriptionManagementService(
 	subscriptions repository.SubscriptionRepository,
 	lifecycle *SubscriptionLifecycleService,
+	chainService *ChainService,
 ) *SubscriptionManagementService {
 	return &SubscriptionManagementService{
 		subscriptions: subscriptions,
 		lifecycle:     lifecycle,
+		chainService:  chainService,
 	}
 }
 
-func (s *SubscriptionManagementService) CancelSubscription(ctx context.Context, subscriptionID string) error {
+// RevocationInput is the payer's signed permit for cancelAuthorization, as
+// prepared by ChainService.PrepareRevocation.
+type RevocationInput struct {
+	ExpectedAllowance *big.Int
+	TargetAllowance   *big.Int
+	Deadline          int64
+	PermitSignature   blockchain.PermitSignature
+}
+
+type CancelSubscriptionResult struct {
+	Subscription     *domain.Subscription
+	RevocationTxHash string
+}
+
+// CancelSubscription cancels the subscription and, when revocation is given,
+// revokes the vault authorization as well. The revocation is submitted first
+// so a bad signature leaves the subscription untouched. An already cancelled
+// subscription can still be revoked. Nothing happens while a renewal or
+// upgrade charge is waiting for its receipt. Once the revocation is broadcast, any later
+// failure is returned together with the result holding its hash, so the
+// caller does not submit it twice.
+func (s *SubscriptionManagementService) CancelSubscription(ctx context.Context, subscriptionID string, revocation *RevocationInput) (*CancelSubscriptionResult, error) {
 	subscription, err := s.subscriptions.GetByID(ctx, subscriptionID)
 	if err != nil {
-		return fmt.Errorf("get subscription: %w", err)
+		return nil, fmt.Errorf("get subscription: %w", err)
 	}
 	if subscription == nil {
-		return fmt.Errorf("subscription not found")
+		return nil, ErrSubscriptionNotFound
+	}
+
+	if s.chainService != nil {
+		charge, err := s.chainService.ChargeInFlight(ctx, subscription.ID)
+		if err != nil {
+			return nil, err
+		}
+		if charge != nil {
+			return nil, fmt.Errorf("%w: %s in tx %s, cancel once it is confirmed", ErrChargeInFlight, charge.ChargeID, charge.TxHash)
+		}
+	}
+
+	result := &CancelSubscriptionResult{Subscription: subscription}
+	if revocation != nil {
+		if s.chainService == nil {
+			return nil, ErrRevocationUnavailable
+		}
+		txHash, err := s.chainService.RevokeAuthorization(ctx, RevokeAuthorizationInput{
+			SubscriptionID:    subscription.ID,
+			ExpectedAllowance: revocation.ExpectedAllowance,
+			TargetAllowance:   revocation.TargetAllowance,
+			Deadline:          revocation.Deadline,
+			PermitSignature:   revocation.PermitSignature,
+		})
+		if err != nil && txHash == "" {
+			return nil, err
+		}
+		result.RevocationTxHash = txHash
+		if err != nil {
+			return result, err
+		}
+
+		if subscription.Status == domain.SubscriptionCancelled {
+			return result, nil
+		}
 	}
 
 	if err := s.lifecycle.CancelSubscription(ctx, subscription); err != nil {
-		return err
+		if result.RevocationTxHash != "" {
+			return result, fmt.Errorf("%w: %w", ErrCancelAfterRevocation, err)
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RotateXrayCredential issues a new Xray credential for an active
+// subscription, invalidating the one clients currently use.
+func (s *SubscriptionManagementService) RotateXrayCredential(ctx context.Context, subscriptionID string) (*domain.Subscription, error) {
+	subscription, err := s.subscriptions.GetByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("get subscription: %w", err)
+	}
+	if subscription == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	if err := s.lifecycle.RotateXrayCredential(ctx, subscription); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return subscription, nil
 }
 
 func (s *SubscriptionManagementService) GetSubscription(ctx context.Context, subscriptionID string) (*domain.Subscription, error) {
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"market-blockchain/internal/domain"
+)
+
+func TestCancelSubscriptionReturnsRevocationHashWhenCancellationFails(t *testing.T) {
+	subscription, authorization, _ := newRenewalFixture()
+	authorization.TargetAllowance = 0
+	authorization.PermitDeadline = time.Now().Add(time.Hour).Unix()
+	contract := &testChainContract{cancelTxHash: "0xrevoke"}
+	sig := signTestPermit(t, contract, authorization)
+
+	subscriptions := &testActivationSubscriptionRepo{subscription: subscription}
+	chainService := NewChainService(contract, subscriptions, &testActivationAuthorizationRepo{authorization: authorization}, &testActivationChargeRepo{}, &noopEventRepo{}, &testPlanRepo{}, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+	store := &lifecycleTestStore{endErr: errors.New("db down")}
+	lifecycle := NewSubscriptionLifecycleService(subscriptions, &lifecycleTestAuthorizationRepo{}, &lifecycleTestChargeRepo{}, &lifecycleTestEventRepo{}, store, nil, nil, DunningPolicy{})
+	service := NewSubscriptionManagementService(subscriptions, lifecycle, chainService)
+
+	result, err := service.CancelSubscription(context.Background(), "sub_1", &RevocationInput{
+		ExpectedAllowance: big.NewInt(2000),
+		TargetAllowance:   big.NewInt(0),
+		Deadline:          authorization.PermitDeadline,
+		PermitSignature:   sig,
+	})
+	if !errors.Is(err, ErrCancelAfterRevocation) {
+		t.Fatalf("expected ErrCancelAfterRevocation, got %v", err)
+	}
+	if result == nil || result.RevocationTxHash != "0xrevoke" {
+		t.Fatalf("expected the broadcast revocation hash returned, got %+v", result)
+	}
+	if contract.cancelCalls != 1 {
+		t.Fatalf("expected one revocation broadcast, got %d", contract.cancelCalls)
+	}
+}
+
+func TestCancelSubscriptionRefusedWhileUpgradeInFlight(t *testing.T) {
+	subscription, authorization, _ := newRenewalFixture()
+	upgrade := &domain.Charge{ID: "charge_record_1", ChargeID: UpgradeChargeID("sub_1", "plan_pro", 2000), SubscriptionID: "sub_1", Amount: 100, Status: domain.ChargePending, Reason: string(domain.EventUpgrade), TxHash: "0xupgrade"}
+	contract := &testChainContract{cancelTxHash: "0xrevoke"}
+
+	subscriptions := &testActivationSubscriptionRepo{subscription: subscription}
+	chainService := NewChainService(contract, subscriptions, &testActivationAuthorizationRepo{authorization: authorization}, &upgradeTestChargeRepo{bySubscription: []*domain.Charge{upgrade}}, &noopEventRepo{}, &testPlanRepo{}, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+	store := &lifecycleTestStore{}
+	lifecycle := NewSubscriptionLifecycleService(subscriptions, &lifecycleTestAuthorizationRepo{}, &lifecycleTestChargeRepo{}, &lifecycleTestEventRepo{}, store, nil, nil, DunningPolicy{})
+	service := NewSubscriptionManagementService(subscriptions, lifecycle, chainService)
+
+	_, err := service.CancelSubscription(context.Background(), "sub_1", &RevocationInput{
+		ExpectedAllowance: big.NewInt(2000),
+		TargetAllowance:   big.NewInt(0),
+		Deadline:          time.Now().Add(time.Hour).Unix(),
+		PermitSignature:   signTestPermit(t, contract, authorization),
+	})
+	if !errors.Is(err, ErrChargeInFlight) {
+		t.Fatalf("expected ErrChargeInFlight, got %v", err)
+	}
+	if contract.cancelCalls != 0 || subscription.Status != domain.SubscriptionActive {
+		t.Fatal("expected neither revocation nor cancellation while the upgrade is in flight")
+	}
+}
+
+func TestCancelSubscriptionRefusedWhileRenewalInFlight(t *testing.T) {
+	subscription, authorization, _ := newRenewalFixture()
+	renewal := &domain.Charge{ID: "charge_record_1", ChargeID: RenewalChargeID("sub_1", 2000), SubscriptionID: "sub_1", Amount: 300, Status: domain.ChargePending, Reason: string(domain.EventRenew), TxHash: "0xrenewal"}
+	contract := &testChainContract{cancelTxHash: "0xrevoke"}
+
+	subscriptions := &testActivationSubscriptionRepo{subscription: subscription}
+	chainService := NewChainService(contract, subscriptions, &testActivationAuthorizationRepo{authorization: authorization}, &upgradeTestChargeRepo{bySubscription: []*domain.Charge{renewal}}, &noopEventRepo{}, &testPlanRepo{}, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+	store := &lifecycleTestStore{}
+	lifecycle := NewSubscriptionLifecycleService(subscriptions, &lifecycleTestAuthorizationRepo{}, &lifecycleTestChargeRepo{}, &lifecycleTestEventRepo{}, store, nil, nil, DunningPolicy{})
+	service := NewSubscriptionManagementService(subscriptions, lifecycle, chainService)
+
+	_, err := service.CancelSubscription(context.Background(), "sub_1", &RevocationInput{
+		ExpectedAllowance: big.NewInt(2000),
+		TargetAllowance:   big.NewInt(0),
+		Deadline:          time.Now().Add(time.Hour).Unix(),
+		PermitSignature:   signTestPermit(t, contract, authorization),
+	})
+	if !errors.Is(err, ErrChargeInFlight) {
+		t.Fatalf("expected ErrChargeInFlight, got %v", err)
+	}
+	if contract.cancelCalls != 0 || subscription.Status != domain.SubscriptionActive {
+		t.Fatal("expected neither revocation nor cancellation while the renewal is in flight")
+	}
+}
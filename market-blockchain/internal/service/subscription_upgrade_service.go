@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,21 +10,31 @@ import (
 	"market-blockchain/internal/repository"
 )
 
+var (
+	ErrUpgradeRequiresReauthorization = errors.New("authorization does not cover the upgraded plan, re-authorization required")
+	ErrPlanNotMoreExpensive           = errors.New("new plan must be more expensive than current plan")
+	ErrUpgradeUnavailable             = errors.New("blockchain client not configured, cannot charge upgrade")
+)
+
 type SubscriptionUpgradeService struct {
 	subscriptions  repository.SubscriptionRepository
 	authorizations repository.AuthorizationRepository
 	charges        repository.ChargeRepository
 	plans          repository.PlanRepository
 	events         repository.EventRepository
+	chainService   *ChainService
 	lifecycle      *SubscriptionLifecycleService
 }
 
+// NewSubscriptionUpgradeService accepts a nil chainService; downgrades then
+// still work but upgrades are refused.
 func NewSubscriptionUpgradeService(
 	subscriptions repository.SubscriptionRepository,
 	authorizations repository.AuthorizationRepository,
 	charges repository.ChargeRepository,
 	plans repository.PlanRepository,
 	events repository.EventRepository,
+	chainService *ChainService,
 	lifecycle *SubscriptionLifecycleService,
 ) *SubscriptionUpgradeService {
 	return &SubscriptionUpgradeService{
@@ -32,6 +43,7 @@ func NewSubscriptionUpgradeService(
 		charges:        charges,
 		plans:          plans,
 		events:         events,
+		chainService:   chainService,
 		lifecycle:      lifecycle,
 	}
 }
@@ -41,41 +53,99 @@ type UpgradeSubscriptionInput struct {
 	NewPlanID      string
 }
 
-func (s *SubscriptionUpgradeService) UpgradeSubscription(ctx context.Context, input UpgradeSubscriptionInput) error {
+// UpgradeSubmission is what UpgradeSubscription leaves behind: the prorated
+// charge is broadcast and the plan switches once the tracker confirms it.
+type UpgradeSubmission struct {
+	Subscription      *domain.Subscription
+	NewPlan           *domain.Plan
+	Charge            *domain.Charge
+	RequiredAllowance int64
+}
+
+// UpgradeSubscription charges the prorated difference for moving to a more
+// expensive plan right away. The current authorization has to cover that
+// charge plus a full period of the new plan, or the next renewal would fail;
+// otherwise the payer has to authorize a larger allowance first.
+func (s *SubscriptionUpgradeService) UpgradeSubscription(ctx context.Context, input UpgradeSubscriptionInput) (*UpgradeSubmission, error) {
+	if s.chainService == nil {
+		return nil, ErrUpgradeUnavailable
+	}
+
 	subscription, err := s.subscriptions.GetByID(ctx, input.SubscriptionID)
 	if err != nil {
-		return fmt.Errorf("get subscription: %w", err)
+		return nil, fmt.Errorf("get subscription: %w", err)
 	}
 	if subscription == nil {
-		return fmt.Errorf("subscription not found")
+		return nil, ErrSubscriptionNotFound
 	}
 
 	if subscription.Status != domain.SubscriptionActive {
-		return fmt.Errorf("can only upgrade active subscriptions")
+		return nil, fmt.Errorf("%w for upgrade: %s", ErrInvalidSubscriptionStatus, subscription.Status)
 	}
 
 	newPlan, err := s.plans.GetByPlanID(ctx, input.NewPlanID)
 	if err != nil {
-		return fmt.Errorf("get new plan: %w", err)
+		return nil, fmt.Errorf("get new plan: %w", err)
 	}
-	if newPlan == nil {
-		return fmt.Errorf("new plan not found")
+	if newPlan == nil || !newPlan.Active {
+		return nil, ErrPlanNotFound
 	}
 
 	oldPlan, err := s.plans.GetByPlanID(ctx, subscription.PlanID)
 	if err != nil {
-		return fmt.Errorf("get old plan: %w", err)
+		return nil, fmt.Errorf("get old plan: %w", err)
 	}
 	if oldPlan == nil {
-		return fmt.Errorf("old plan not found")
+		return nil, fmt.Errorf("current plan %s: %w", subscription.PlanID, ErrPlanNotFound)
 	}
 
 	if newPlan.AmountUSDCBaseUnits <= oldPlan.AmountUSDCBaseUnits {
-		return fmt.Errorf("new plan must be more expensive than current plan")
+		return nil, ErrPlanNotMoreExpensive
+	}
+
+	authorization, err := s.authorizations.GetByID(ctx, subscription.CurrentAuthorizationID)
+	if err != nil {
+		return nil, fmt.Errorf("get authorization: %w", err)
+	}
+	if authorization == nil {
+		return nil, ErrAuthorizationNotFound
+	}
+	if authorization.PermitStatus != domain.AuthorizationCompleted {
+		return nil, fmt.Errorf("%w for upgrade: %s", ErrInvalidAuthorizationStatus, authorization.PermitStatus)
+	}
+
+	charges, err := s.charges.ListBySubscription(ctx, subscription.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list subscription charges: %w", err)
+	}
+	for _, charge := range charges {
+		if charge.Status == domain.ChargePending && charge.TxHash != "" {
+			return nil, fmt.Errorf("%w: %s in tx %s", ErrChargeInFlight, charge.ChargeID, charge.TxHash)
+		}
 	}
 
 	proratedCharge := s.calculateProratedCharge(subscription, oldPlan, newPlan, time.Now().UnixMilli())
-	return s.lifecycle.ApplyImmediateUpgrade(ctx, subscription, oldPlan, newPlan, proratedCharge)
+	required := proratedCharge + newPlan.AmountUSDCBaseUnits
+	if authorization.RemainingAllowance < required {
+		return nil, fmt.Errorf("%w: remaining allowance %d, upgrade needs %d", ErrUpgradeRequiresReauthorization, authorization.RemainingAllowance, required)
+	}
+
+	charge, err := s.chainService.ExecuteUpgradeCharge(ctx, ExecuteUpgradeChargeInput{
+		Subscription:  subscription,
+		Authorization: authorization,
+		NewPlan:       newPlan,
+		Amount:        proratedCharge,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpgradeSubmission{
+		Subscription:      subscription,
+		NewPlan:           newPlan,
+		Charge:            charge,
+		RequiredAllowance: required,
+	}, nil
 }
 
 func (s *SubscriptionUpgradeService) calculateProratedCharge(
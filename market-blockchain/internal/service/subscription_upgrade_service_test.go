@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"market-blockchain/internal/blockchain"
+	"market-blockchain/internal/domain"
+)
+
+type upgradeTestPlans map[string]*domain.Plan
+
+func (p upgradeTestPlans) Create(plan *domain.Plan) error { return nil }
+func (p upgradeTestPlans) Update(plan *domain.Plan) error { return nil }
+func (p upgradeTestPlans) GetByPlanID(ctx context.Context, planID string) (*domain.Plan, error) {
+	return p[planID], nil
+}
+func (p upgradeTestPlans) ListActive(ctx context.Context) ([]*domain.Plan, error) { return nil, nil }
+func (p upgradeTestPlans) ListAll(ctx context.Context) ([]*domain.Plan, error)    { return nil, nil }
+
+type upgradeTestChargeRepo struct {
+	testActivationChargeRepo
+	bySubscription []*domain.Charge
+}
+
+func (r *upgradeTestChargeRepo) ListBySubscription(ctx context.Context, subscriptionID string) ([]*domain.Charge, error) {
+	return r.bySubscription, nil
+}
+
+func newUpgradeFixture() (*domain.Subscription, *domain.Authorization, upgradeTestPlans) {
+	subscription, authorization, plan := newRenewalFixture()
+	plans := upgradeTestPlans{
+		plan.PlanID: plan,
+		"plan_pro":  {PlanID: "plan_pro", Name: "Pro", PeriodSeconds: 60, AmountUSDCBaseUnits: 500, Active: true},
+	}
+	return subscription, authorization, plans
+}
+
+func newUpgradeTestService(contract *testChainContract, subscription *domain.Subscription, authorization *domain.Authorization, charges *upgradeTestChargeRepo, plans upgradeTestPlans, transactions *testChainTransactionRepo, lifecycle chainLifecycle) *SubscriptionUpgradeService {
+	subscriptions := &testActivationSubscriptionRepo{subscription: subscription}
+	authorizations := &testActivationAuthorizationRepo{authorization: authorization}
+	chainService := NewChainService(contract, subscriptions, authorizations, charges, &noopEventRepo{}, plans, transactions, lifecycle)
+	return NewSubscriptionUpgradeService(subscriptions, authorizations, charges, plans, &noopEventRepo{}, chainService, nil)
+}
+
+func TestSubscriptionUpgradeServiceSwitchesPlanOnlyAfterConfirmation(t *testing.T) {
+	subscription, authorization, plans := newUpgradeFixture()
+	contract := &testChainContract{chargeTxHash: "0xupgrade"}
+	charges := &upgradeTestChargeRepo{}
+	transactions := &testChainTransactionRepo{}
+	completer := &captureFirstChargeCompleter{}
+	service := newUpgradeTestService(contract, subscription, authorization, charges, plans, transactions, completer)
+
+	submission, err := service.UpgradeSubscription(context.Background(), UpgradeSubscriptionInput{SubscriptionID: "sub_1", NewPlanID: "plan_pro"})
+	if err != nil {
+		t.Fatalf("UpgradeSubscription returned error: %v", err)
+	}
+	wantChargeID := UpgradeChargeID("sub_1", "plan_pro", 2000)
+	if charges.created == nil || charges.created.ChargeID != wantChargeID || charges.created.PlanID != "plan_pro" || charges.created.IdentityAddress != subscription.IdentityAddress || charges.created.PayerAddress != subscription.PayerAddress {
+		t.Fatalf("expected a complete pending upgrade charge, got %+v", charges.created)
+	}
+	if contract.chargeCalls != 1 || contract.lastChargeID != blockchain.ChargeIDBytes(wantChargeID) {
+		t.Fatalf("expected the upgrade charge submitted on chain, got %d calls", contract.chargeCalls)
+	}
+	if submission.Charge.Amount != 500 || submission.RequiredAllowance != 1000 {
+		t.Fatalf("unexpected submission: charge %d, required %d", submission.Charge.Amount, submission.RequiredAllowance)
+	}
+	if subscription.PlanID != "plan_1" || completer.charge != nil {
+		t.Fatal("expected the plan to stay unchanged until the charge confirms")
+	}
+	if len(transactions.created) != 1 || transactions.created[0].Kind != domain.ChainTxUpgradeCharge {
+		t.Fatalf("expected upgrade charge to be tracked, got %+v", transactions.created)
+	}
+
+	if err := service.chainService.HandleTransactionConfirmed(context.Background(), transactions.created[0]); err != nil {
+		t.Fatalf("HandleTransactionConfirmed returned error: %v", err)
+	}
+	if completer.upgradeTxHash != "0xupgrade" || subscription.PlanID != "plan_pro" {
+		t.Fatalf("expected upgrade applied on confirmation, got tx %q plan %s", completer.upgradeTxHash, subscription.PlanID)
+	}
+}
+
+func TestSubscriptionUpgradeServiceRequiresReauthorization(t *testing.T) {
+	subscription, authorization, plans := newUpgradeFixture()
+	authorization.RemainingAllowance = 900
+	contract := &testChainContract{chargeTxHash: "0xupgrade"}
+	charges := &upgradeTestChargeRepo{}
+	service := newUpgradeTestService(contract, subscription, authorization, charges, plans, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+
+	_, err := service.UpgradeSubscription(context.Background(), UpgradeSubscriptionInput{SubscriptionID: "sub_1", NewPlanID: "plan_pro"})
+	if !errors.Is(err, ErrUpgradeRequiresReauthorization) {
+		t.Fatalf("expected ErrUpgradeRequiresReauthorization, got %v", err)
+	}
+	if contract.chargeCalls != 0 || charges.created != nil {
+		t.Fatal("expected nothing charged when the allowance does not cover the new plan")
+	}
+}
+
+func TestSubscriptionUpgradeServiceRejectsWhileChargeInFlight(t *testing.T) {
+	subscription, authorization, plans := newUpgradeFixture()
+	contract := &testChainContract{chargeTxHash: "0xupgrade"}
+	charges := &upgradeTestChargeRepo{bySubscription: []*domain.Charge{
+		{ID: "charge_record_1", ChargeID: UpgradeChargeID("sub_1", "plan_max", 2000), Status: domain.ChargePending, TxHash: "0xinflight"},
+	}}
+	service := newUpgradeTestService(contract, subscription, authorization, charges, plans, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+
+	_, err := service.UpgradeSubscription(context.Background(), UpgradeSubscriptionInput{SubscriptionID: "sub_1", NewPlanID: "plan_pro"})
+	if !errors.Is(err, ErrChargeInFlight) {
+		t.Fatalf("expected ErrChargeInFlight, got %v", err)
+	}
+	if contract.chargeCalls != 0 {
+		t.Fatal("expected no second charge while one is in flight")
+	}
+}
+
+func TestSubscriptionUpgradeServiceRejectsCheaperPlan(t *testing.T) {
+	subscription, authorization, plans := newUpgradeFixture()
+	plans["plan_lite"] = &domain.Plan{PlanID: "plan_lite", Name: "Lite", PeriodSeconds: 60, AmountUSDCBaseUnits: 100, Active: true}
+	service := newUpgradeTestService(&testChainContract{}, subscription, authorization, &upgradeTestChargeRepo{}, plans, &testChainTransactionRepo{}, &captureFirstChargeCompleter{})
+
+	_, err := service.UpgradeSubscription(context.Background(), UpgradeSubscriptionInput{SubscriptionID: "sub_1", NewPlanID: "plan_lite"})
+	if !errors.Is(err, ErrPlanNotMoreExpensive) {
+		t.Fatalf("expected ErrPlanNotMoreExpensive, got %v", err)
+	}
+}
@@ -6,41 +6,102 @@ import (
 	"log"
 	"time"
 
+	"market-blockchain/internal/domain"
 	"market-blockchain/internal/repository"
 	"market-blockchain/internal/xray"
 )
 
+// trafficSource is the Xray fleet the raw per-node counters are read from.
+type trafficSource interface {
+	QueryNodeTraffic(ctx context.Context) ([]*xray.NodeTraffic, error)
+}
+
+type trafficSubscriptionLookup interface {
+	GetActiveByIdentity(ctx context.Context, identityAddress string) (*domain.Subscription, error)
+}
+
+type trafficStore interface {
+	ApplyTrafficUsage(ctx context.Context, subscriptionID string, uplink, downlink int64, counters []*domain.XrayTrafficCounter, samples []*domain.TrafficSample) (int64, error)
+}
+
+type trafficPlanLookup interface {
+	GetByPlanID(ctx context.Context, planID string) (*domain.Plan, error)
+}
+
+// trafficQuotaEnforcer is the lifecycle service, which owns the Xray side of
+// a subscription crossing its quota.
+type trafficQuotaEnforcer interface {
+	ApplyQuotaExceeded(ctx context.Context, subscription *domain.Subscription, plan *domain.Plan, periodTraffic int64) error
+}
+
+// TrafficRetention is how long samples of each granularity are kept. Zero
+// keeps them forever.
+type TrafficRetention struct {
+	Hourly time.Duration
+	Daily  time.Duration
+}
+
+const trafficPruneInterval = time.Hour
+
+// TrafficStatsService accumulates Xray usage onto subscriptions. Xray only
+// exposes running counters per node, which start over whenever the node
+// restarts, so usage is taken as the difference to the last reading of each
+// node and user rather than copied from the counters. Each delta is also
+// recorded as hourly and daily samples per node for usage history, and a
+// subscription whose period usage reaches its plan's quota is handed to the
+// lifecycle service.
 type TrafficStatsService struct {
-	xrayClient       *xray.Client
-	subscriptionRepo repository.SubscriptionRepository
-	updateInterval   time.Duration
+	xrayClient     trafficSource
+	subscriptions  trafficSubscriptionLookup
+	counters       repository.XrayTrafficCounterRepository
+	samples        repository.TrafficSampleRepository
+	store          trafficStore
+	plans          trafficPlanLookup
+	quotas         trafficQuotaEnforcer
+	updateInterval time.Duration
+	retention      TrafficRetention
 }
 
 func NewTrafficStatsService(
-	xrayClient *xray.Client,
-	subscriptionRepo repository.SubscriptionRepository,
+	xrayClient trafficSource,
+	subscriptions trafficSubscriptionLookup,
+	counters repository.XrayTrafficCounterRepository,
+	samples repository.TrafficSampleRepository,
+	store trafficStore,
+	plans trafficPlanLookup,
+	quotas trafficQuotaEnforcer,
 	updateInterval time.Duration,
+	retention TrafficRetention,
 ) *TrafficStatsService {
 	if updateInterval == 0 {
 		updateInterval = 10 * time.Second
 	}
 
 	return &TrafficStatsService{
-		xrayClient:       xrayClient,
-		subscriptionRepo: subscriptionRepo,
-		updateInterval:   updateInterval,
+		xrayClient:     xrayClient,
+		subscriptions:  subscriptions,
+		counters:       counters,
+		samples:        samples,
+		store:          store,
+		plans:          plans,
+		quotas:         quotas,
+		updateInterval: updateInterval,
+		retention:      retention,
 	}
 }
 
 func (s *TrafficStatsService) Start(ctx context.Context) {
 	ticker := time.NewTicker(s.updateInterval)
 	defer ticker.Stop()
+	pruneTicker := time.NewTicker(trafficPruneInterval)
+	defer pruneTicker.Stop()
 
-	log.Printf("Traffic stats service started (interval: %v)", s.updateInterval)
+	log.Printf("Traffic stats service started (interval: %v, hourly retention: %v, daily retention: %v)", s.updateInterval, s.retention.Hourly, s.retention.Daily)
 
 	if err := s.UpdateAllTrafficStats(ctx); err != nil {
 		log.Printf("Failed to update traffic stats: %v", err)
 	}
+	s.pruneSamples(ctx)
 
 	for {
 		select {
@@ -51,44 +112,208 @@ func (s *TrafficStatsService) Start(ctx context.Context) {
 			if err := s.UpdateAllTrafficStats(ctx); err != nil {
 				log.Printf("Failed to update traffic stats: %v", err)
 			}
+		case <-pruneTicker.C:
+			s.pruneSamples(ctx)
 		}
 	}
 }
 
+func (s *TrafficStatsService) pruneSamples(ctx context.Context) {
+	if _, err := s.PruneSamples(ctx, time.Now()); err != nil {
+		log.Printf("Failed to prune traffic samples: %v", err)
+	}
+}
+
+// PruneSamples deletes samples older than the retention of their granularity
+// and returns how many were removed.
+func (s *TrafficStatsService) PruneSamples(ctx context.Context, now time.Time) (int64, error) {
+	var removed int64
+	for _, policy := range []struct {
+		granularity domain.TrafficGranularity
+		keep        time.Duration
+	}{
+		{domain.TrafficHourly, s.retention.Hourly},
+		{domain.TrafficDaily, s.retention.Daily},
+	} {
+		if policy.keep <= 0 {
+			continue
+		}
+		cutoff := policy.granularity.BucketStart(now.Add(-policy.keep).UnixMilli())
+		count, err := s.samples.DeleteBefore(ctx, policy.granularity, cutoff)
+		if err != nil {
+			return removed, fmt.Errorf("prune %s traffic samples: %w", policy.granularity, err)
+		}
+		removed += count
+	}
+
+	if removed > 0 {
+		log.Printf("Pruned %d expired traffic samples", removed)
+	}
+	return removed, nil
+}
+
+// identityTraffic is the usage of one identity across all nodes in a pass,
+// with the counters to store once it is recorded.
+type identityTraffic struct {
+	uplink   int64
+	downlink int64
+	counters []*domain.XrayTrafficCounter
+	nodes    []nodeTrafficDelta
+}
+
+type nodeTrafficDelta struct {
+	nodeID   string
+	uplink   int64
+	downlink int64
+}
+
 func (s *TrafficStatsService) UpdateAllTrafficStats(ctx context.Context) error {
-	trafficList, err := s.xrayClient.QueryAllUsersTraffic(ctx)
+	nodeTraffic, err := s.xrayClient.QueryNodeTraffic(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to query traffic from Xray: %w", err)
 	}
 
-	log.Printf("Updating traffic stats for %d users", len(trafficList))
+	stored, err := s.counters.ListAll(ctx)
+	if err != nil {
+		return fmt.Errorf("list traffic counters: %w", err)
+	}
+	last := make(map[string]*domain.XrayTrafficCounter, len(stored))
+	for _, counter := range stored {
+		last[counter.NodeID+"|"+counter.IdentityAddress] = counter
+	}
+
+	now := time.Now().UnixMilli()
+	usage := make(map[string]*identityTraffic)
+	for _, node := range nodeTraffic {
+		for _, traffic := range node.Users {
+			previous := last[node.NodeID+"|"+traffic.Email]
+			uplink, downlink, reset := trafficDelta(previous, traffic)
+			if previous != nil && uplink == 0 && downlink == 0 && !reset {
+				continue
+			}
+			if reset {
+				log.Printf("Xray traffic counter reset detected for %s on node %s (uplink %d -> %d, downlink %d -> %d)",
+					traffic.Email, node.NodeName, previous.Uplink, traffic.Uplink, previous.Downlink, traffic.Downlink)
+			}
 
-	for _, traffic := range trafficList {
-		subscription, err := s.subscriptionRepo.GetByIdentityAndPlan(ctx, traffic.Email, "")
-		if err != nil || subscription == nil {
+			entry := usage[traffic.Email]
+			if entry == nil {
+				entry = &identityTraffic{}
+				usage[traffic.Email] = entry
+			}
+			entry.uplink += uplink
+			entry.downlink += downlink
+			if uplink+downlink > 0 {
+				entry.nodes = append(entry.nodes, nodeTrafficDelta{nodeID: node.NodeID, uplink: uplink, downlink: downlink})
+			}
+			entry.counters = append(entry.counters, &domain.XrayTrafficCounter{
+				NodeID:          node.NodeID,
+				IdentityAddress: traffic.Email,
+				Uplink:          traffic.Uplink,
+				Downlink:        traffic.Downlink,
+				UpdatedAt:       now,
+			})
+		}
+	}
+
+	for identity, entry := range usage {
+		// A failed lookup leaves the counters where they were, so the usage is
+		// picked up again on the next pass.
+		subscription, err := s.subscriptions.GetActiveByIdentity(ctx, identity)
+		if err != nil {
+			log.Printf("Failed to look up active subscription for %s: %v", identity, err)
 			continue
 		}
 
-		subscription.Uplink = traffic.Uplink
-		subscription.Downlink = traffic.Downlink
-		subscription.TotalTraffic = traffic.Uplink + traffic.Downlink
+		subscriptionID := ""
+		var samples []*domain.TrafficSample
+		if subscription != nil {
+			subscriptionID = subscription.ID
+			samples = trafficSamples(subscription, entry.nodes, now)
+		} else if entry.uplink+entry.downlink > 0 {
+			log.Printf("Dropping %s of Xray traffic for %s: no active subscription", formatBytes(entry.uplink+entry.downlink), identity)
+		}
 
-		if err := s.subscriptionRepo.Update(subscription); err != nil {
-			log.Printf("Failed to update traffic stats for user %s: %v", traffic.Email, err)
+		periodTraffic, err := s.store.ApplyTrafficUsage(ctx, subscriptionID, entry.uplink, entry.downlink, entry.counters, samples)
+		if err != nil {
+			log.Printf("Failed to record traffic for user %s: %v", identity, err)
 			continue
 		}
 
-		log.Printf("User %s: uplink=%s, downlink=%s, total=%s",
-			traffic.Email,
-			formatBytes(traffic.Uplink),
-			formatBytes(traffic.Downlink),
-			formatBytes(subscription.TotalTraffic),
-		)
+		if subscription != nil && entry.uplink+entry.downlink > 0 {
+			log.Printf("User %s: +uplink=%s, +downlink=%s, total=%s",
+				identity,
+				formatBytes(entry.uplink),
+				formatBytes(entry.downlink),
+				formatBytes(subscription.TotalTraffic+entry.uplink+entry.downlink),
+			)
+			s.checkQuota(ctx, subscription, periodTraffic)
+		}
 	}
 
 	return nil
 }
 
+// checkQuota hands a subscription that reached its plan's quota this period
+// to the lifecycle service. A failure is only logged: the usage is already
+// recorded, so the next pass that adds traffic checks again.
+func (s *TrafficStatsService) checkQuota(ctx context.Context, subscription *domain.Subscription, periodTraffic int64) {
+	if subscription.QuotaExceededAt != 0 {
+		return
+	}
+
+	plan, err := s.plans.GetByPlanID(ctx, subscription.PlanID)
+	if err != nil {
+		log.Printf("Failed to load plan %s for quota check of %s: %v", subscription.PlanID, subscription.IdentityAddress, err)
+		return
+	}
+	if plan == nil || !plan.QuotaExceeded(periodTraffic) {
+		return
+	}
+
+	log.Printf("User %s reached the %s traffic quota of plan %s (%s used, policy %s)",
+		subscription.IdentityAddress, formatBytes(plan.TrafficQuotaBytes), plan.PlanID, formatBytes(periodTraffic), plan.OverQuotaPolicy)
+	if err := s.quotas.ApplyQuotaExceeded(ctx, subscription, plan, periodTraffic); err != nil {
+		log.Printf("Failed to apply traffic quota for %s: %v", subscription.IdentityAddress, err)
+	}
+}
+
+// trafficSamples attributes each node's delta to the hourly and daily bucket
+// of the pass it was read in.
+func trafficSamples(subscription *domain.Subscription, nodes []nodeTrafficDelta, now int64) []*domain.TrafficSample {
+	samples := make([]*domain.TrafficSample, 0, 2*len(nodes))
+	for _, node := range nodes {
+		for _, granularity := range []domain.TrafficGranularity{domain.TrafficHourly, domain.TrafficDaily} {
+			samples = append(samples, &domain.TrafficSample{
+				SubscriptionID:  subscription.ID,
+				IdentityAddress: subscription.IdentityAddress,
+				PlanID:          subscription.PlanID,
+				NodeID:          node.nodeID,
+				Granularity:     granularity,
+				BucketStart:     granularity.BucketStart(now),
+				Uplink:          node.uplink,
+				Downlink:        node.downlink,
+				UpdatedAt:       now,
+			})
+		}
+	}
+	return samples
+}
+
+// trafficDelta returns the usage since the previous reading of a counter pair.
+// A reading below the previous one means the node restarted and its counters
+// started over from zero, so the whole reading is new usage. The first reading
+// of a counter also counts in full.
+func trafficDelta(previous *domain.XrayTrafficCounter, current *xray.UserTraffic) (uplink, downlink int64, reset bool) {
+	if previous == nil {
+		return current.Uplink, current.Downlink, false
+	}
+	if current.Uplink < previous.Uplink || current.Downlink < previous.Downlink {
+		return current.Uplink, current.Downlink, true
+	}
+	return current.Uplink - previous.Uplink, current.Downlink - previous.Downlink, false
+}
+
 func formatBytes(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
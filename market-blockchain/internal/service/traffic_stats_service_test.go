@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/xray"
+)
+
+type trafficTestSource struct {
+	nodes []*xray.NodeTraffic
+}
+
+func (s *trafficTestSource) QueryNodeTraffic(ctx context.Context) ([]*xray.NodeTraffic, error) {
+	return s.nodes, nil
+}
+
+type trafficTestSubscriptions map[string]*domain.Subscription
+
+func (s trafficTestSubscriptions) GetActiveByIdentity(ctx context.Context, identityAddress string) (*domain.Subscription, error) {
+	return s[identityAddress], nil
+}
+
+type trafficTestPlans map[string]*domain.Plan
+
+func (p trafficTestPlans) GetByPlanID(ctx context.Context, planID string) (*domain.Plan, error) {
+	return p[planID], nil
+}
+
+type trafficTestQuotas struct {
+	exceeded []int64
+}
+
+func (q *trafficTestQuotas) ApplyQuotaExceeded(ctx context.Context, subscription *domain.Subscription, plan *domain.Plan, periodTraffic int64) error {
+	q.exceeded = append(q.exceeded, periodTraffic)
+	subscription.QuotaExceededAt = time.Now().UnixMilli()
+	return nil
+}
+
+// trafficTestStore keeps counters and per-subscription usage in memory, the
+// way the postgres store persists them.
+type trafficTestStore struct {
+	counters map[string]*domain.XrayTrafficCounter
+	usage    map[string][2]int64
+	samples  []*domain.TrafficSample
+	deleted  map[domain.TrafficGranularity]int64
+}
+
+func newTrafficTestStore() *trafficTestStore {
+	return &trafficTestStore{counters: make(map[string]*domain.XrayTrafficCounter), usage: make(map[string][2]int64)}
+}
+
+func (s *trafficTestStore) ListAll(ctx context.Context) ([]*domain.XrayTrafficCounter, error) {
+	var counters []*domain.XrayTrafficCounter
+	for _, counter := range s.counters {
+		counterCopy := *counter
+		counters = append(counters, &counterCopy)
+	}
+	return counters, nil
+}
+
+func (s *trafficTestStore) ApplyTrafficUsage(ctx context.Context, subscriptionID string, uplink, downlink int64, counters []*domain.XrayTrafficCounter, samples []*domain.TrafficSample) (int64, error) {
+	s.samples = append(s.samples, samples...)
+	var periodTraffic int64
+	if subscriptionID != "" {
+		total := s.usage[subscriptionID]
+		s.usage[subscriptionID] = [2]int64{total[0] + uplink, total[1] + downlink}
+		periodTraffic = total[0] + total[1] + uplink + downlink
+	}
+	for _, counter := range counters {
+		s.counters[counter.NodeID+"|"+counter.IdentityAddress] = counter
+	}
+	return periodTraffic, nil
+}
+
+func (s *trafficTestStore) SumByIdentity(ctx context.Context, identityAddress string, granularity domain.TrafficGranularity, from, to int64) ([]*domain.TrafficUsage, error) {
+	return nil, nil
+}
+
+func (s *trafficTestStore) SumByPlanAndNode(ctx context.Context, granularity domain.TrafficGranularity, from, to int64) ([]*domain.TrafficUsage, error) {
+	return nil, nil
+}
+
+func (s *trafficTestStore) DeleteBefore(ctx context.Context, granularity domain.TrafficGranularity, before int64) (int64, error) {
+	if s.deleted == nil {
+		s.deleted = make(map[domain.TrafficGranularity]int64)
+	}
+	s.deleted[granularity] = before
+	return 1, nil
+}
+
+func TestTrafficStatsServiceAccumulatesDeltasAcrossResets(t *testing.T) {
+	source := &trafficTestSource{}
+	store := newTrafficTestStore()
+	subscriptions := trafficTestSubscriptions{"0xabc": {ID: "sub_1", IdentityAddress: "0xabc", Status: domain.SubscriptionActive}}
+	service := NewTrafficStatsService(source, subscriptions, store, store, store, trafficTestPlans{}, &trafficTestQuotas{}, 0, TrafficRetention{})
+
+	readings := []struct {
+		nodeA, nodeB     xray.UserTraffic
+		uplink, downlink int64
+	}{
+		// First readings count in full.
+		{xray.UserTraffic{Email: "0xabc", Uplink: 100, Downlink: 1000}, xray.UserTraffic{Email: "0xabc", Uplink: 10, Downlink: 20}, 110, 1020},
+		// Only the growth since the last reading is added.
+		{xray.UserTraffic{Email: "0xabc", Uplink: 150, Downlink: 1500}, xray.UserTraffic{Email: "0xabc", Uplink: 10, Downlink: 20}, 160, 1520},
+		// node_a restarted: its counters start over, nothing already counted is lost.
+		{xray.UserTraffic{Email: "0xabc", Uplink: 30, Downlink: 40}, xray.UserTraffic{Email: "0xabc", Uplink: 15, Downlink: 25}, 195, 1565},
+	}
+
+	for i, reading := range readings {
+		nodeA, nodeB := reading.nodeA, reading.nodeB
+		source.nodes = []*xray.NodeTraffic{
+			{NodeID: "node_a", NodeName: "a", Users: []*xray.UserTraffic{&nodeA}},
+			{NodeID: "node_b", NodeName: "b", Users: []*xray.UserTraffic{&nodeB}},
+		}
+		if err := service.UpdateAllTrafficStats(context.Background()); err != nil {
+			t.Fatalf("pass %d: UpdateAllTrafficStats returned error: %v", i, err)
+		}
+		if got := store.usage["sub_1"]; got[0] != reading.uplink || got[1] != reading.downlink {
+			t.Fatalf("pass %d: expected uplink %d downlink %d, got %v", i, reading.uplink, reading.downlink, got)
+		}
+	}
+}
+
+func TestTrafficStatsServiceAdvancesCountersWithoutActiveSubscription(t *testing.T) {
+	source := &trafficTestSource{nodes: []*xray.NodeTraffic{
+		{NodeID: "node_a", Users: []*xray.UserTraffic{{Email: "0xgone", Uplink: 500, Downlink: 500}}},
+	}}
+	store := newTrafficTestStore()
+	subscriptions := trafficTestSubscriptions{}
+	service := NewTrafficStatsService(source, subscriptions, store, store, store, trafficTestPlans{}, &trafficTestQuotas{}, 0, TrafficRetention{})
+
+	if err := service.UpdateAllTrafficStats(context.Background()); err != nil {
+		t.Fatalf("UpdateAllTrafficStats returned error: %v", err)
+	}
+	if got := store.counters["node_a|0xgone"]; got == nil || got.Uplink != 500 {
+		t.Fatalf("expected counter to advance, got %+v", got)
+	}
+
+	// Usage from before the identity resubscribed is not billed to the new subscription.
+	subscriptions["0xgone"] = &domain.Subscription{ID: "sub_2", IdentityAddress: "0xgone", Status: domain.SubscriptionActive}
+	source.nodes[0].Users[0] = &xray.UserTraffic{Email: "0xgone", Uplink: 600, Downlink: 550}
+	if err := service.UpdateAllTrafficStats(context.Background()); err != nil {
+		t.Fatalf("UpdateAllTrafficStats returned error: %v", err)
+	}
+	if got := store.usage["sub_2"]; got[0] != 100 || got[1] != 50 {
+		t.Fatalf("expected only new usage on the new subscription, got %v", got)
+	}
+}
+
+func TestTrafficStatsServiceRecordsHourlyAndDailySamplesPerNode(t *testing.T) {
+	source := &trafficTestSource{nodes: []*xray.NodeTraffic{
+		{NodeID: "node_a", Users: []*xray.UserTraffic{{Email: "0xabc", Uplink: 100, Downlink: 200}}},
+		{NodeID: "node_b", Users: []*xray.UserTraffic{{Email: "0xabc"}}},
+	}}
+	store := newTrafficTestStore()
+	subscriptions := trafficTestSubscriptions{"0xabc": {ID: "sub_1", IdentityAddress: "0xabc", PlanID: "plan_1", Status: domain.SubscriptionActive}}
+	service := NewTrafficStatsService(source, subscriptions, store, store, store, trafficTestPlans{}, &trafficTestQuotas{}, 0, TrafficRetention{})
+
+	if err := service.UpdateAllTrafficStats(context.Background()); err != nil {
+		t.Fatalf("UpdateAllTrafficStats returned error: %v", err)
+	}
+	if len(store.samples) != 2 {
+		t.Fatalf("expected an hourly and a daily sample for the node with usage, got %d", len(store.samples))
+	}
+	for _, sample := range store.samples {
+		if sample.NodeID != "node_a" || sample.PlanID != "plan_1" || sample.Uplink != 100 || sample.Downlink != 200 {
+			t.Fatalf("unexpected sample: %+v", sample)
+		}
+		if sample.BucketStart != sample.Granularity.BucketStart(sample.UpdatedAt) {
+			t.Fatalf("sample is not aligned to its %s bucket: %+v", sample.Granularity, sample)
+		}
+	}
+	if store.samples[0].Granularity == store.samples[1].Granularity {
+		t.Fatalf("expected one sample per granularity, got %+v and %+v", store.samples[0], store.samples[1])
+	}
+}
+
+func TestTrafficStatsServicePrunesByRetention(t *testing.T) {
+	store := newTrafficTestStore()
+	service := NewTrafficStatsService(&trafficTestSource{}, trafficTestSubscriptions{}, store, store, store, trafficTestPlans{}, &trafficTestQuotas{}, 0, TrafficRetention{Hourly: 48 * time.Hour})
+
+	now := time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC)
+	if _, err := service.PruneSamples(context.Background(), now); err != nil {
+		t.Fatalf("PruneSamples returned error: %v", err)
+	}
+	if got, want := store.deleted[domain.TrafficHourly], time.Date(2026, 3, 8, 15, 0, 0, 0, time.UTC).UnixMilli(); got != want {
+		t.Fatalf("expected hourly cutoff %d, got %d", want, got)
+	}
+	if _, ok := store.deleted[domain.TrafficDaily]; ok {
+		t.Fatal("expected daily samples to be kept without a retention")
+	}
+}
+
+func TestTrafficStatsServiceEnforcesQuotaOncePerPeriod(t *testing.T) {
+	source := &trafficTestSource{}
+	store := newTrafficTestStore()
+	subscriptions := trafficTestSubscriptions{"0xabc": {ID: "sub_1", IdentityAddress: "0xabc", PlanID: "plan_1", Status: domain.SubscriptionActive}}
+	plans := trafficTestPlans{"plan_1": {PlanID: "plan_1", TrafficQuotaBytes: 1000, OverQuotaPolicy: domain.OverQuotaSuspend}}
+	quotas := &trafficTestQuotas{}
+	service := NewTrafficStatsService(source, subscriptions, store, store, store, plans, quotas, 0, TrafficRetention{})
+
+	for i, reading := range []xray.UserTraffic{
+		{Email: "0xabc", Uplink: 100, Downlink: 400},
+		{Email: "0xabc", Uplink: 300, Downlink: 800},
+		{Email: "0xabc", Uplink: 500, Downlink: 900},
+	} {
+		reading := reading
+		source.nodes = []*xray.NodeTraffic{{NodeID: "node_a", Users: []*xray.UserTraffic{&reading}}}
+		if err := service.UpdateAllTrafficStats(context.Background()); err != nil {
+			t.Fatalf("pass %d: UpdateAllTrafficStats returned error: %v", i, err)
+		}
+	}
+
+	if len(quotas.exceeded) != 1 || quotas.exceeded[0] != 1100 {
+		t.Fatalf("expected the quota to be enforced once at 1100 bytes, got %v", quotas.exceeded)
+	}
+}
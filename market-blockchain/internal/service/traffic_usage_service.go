@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+)
+
+var ErrInvalidTrafficQuery = errors.New("invalid traffic query")
+
+// maxTrafficBuckets bounds the size of one query: a month of hourly buckets
+// or a bit over two years of daily ones.
+const maxTrafficBuckets = 800
+
+// TrafficQuery selects the buckets [From, To) of one granularity.
+type TrafficQuery struct {
+	Granularity domain.TrafficGranularity
+	From        int64
+	To          int64
+}
+
+// NewTrafficQuery validates a query and fills in defaults: hourly buckets,
+// ending now, covering the last day for hourly and the last 30 days for daily
+// queries. From is aligned down to the start of its bucket.
+func NewTrafficQuery(granularity string, from, to int64, now time.Time) (TrafficQuery, error) {
+	query := TrafficQuery{Granularity: domain.TrafficGranularity(granularity), From: from, To: to}
+	switch query.Granularity {
+	case "":
+		query.Granularity = domain.TrafficHourly
+	case domain.TrafficHourly, domain.TrafficDaily:
+	default:
+		return TrafficQuery{}, fmt.Errorf("%w: granularity must be %q or %q", ErrInvalidTrafficQuery, domain.TrafficHourly, domain.TrafficDaily)
+	}
+
+	if query.To == 0 {
+		query.To = now.UnixMilli()
+	}
+	if query.From == 0 {
+		window := 24 * time.Hour
+		if query.Granularity == domain.TrafficDaily {
+			window = 30 * 24 * time.Hour
+		}
+		query.From = query.To - window.Milliseconds()
+	}
+	query.From = query.Granularity.BucketStart(query.From)
+
+	if query.From < 0 || query.From >= query.To {
+		return TrafficQuery{}, fmt.Errorf("%w: from must be before to", ErrInvalidTrafficQuery)
+	}
+	if (query.To-query.From)/query.Granularity.Duration().Milliseconds() > maxTrafficBuckets {
+		return TrafficQuery{}, fmt.Errorf("%w: range covers more than %d %s buckets", ErrInvalidTrafficQuery, maxTrafficBuckets, query.Granularity)
+	}
+	return query, nil
+}
+
+// TrafficUsageService answers usage history queries from traffic samples.
+type TrafficUsageService struct {
+	samples repository.TrafficSampleRepository
+}
+
+func NewTrafficUsageService(samples repository.TrafficSampleRepository) *TrafficUsageService {
+	return &TrafficUsageService{samples: samples}
+}
+
+// IdentityUsage returns an identity's usage per bucket across all of its
+// subscriptions and nodes.
+func (s *TrafficUsageService) IdentityUsage(ctx context.Context, identityAddress string, query TrafficQuery) ([]*domain.TrafficUsage, error) {
+	usage, err := s.samples.SumByIdentity(ctx, identityAddress, query.Granularity, query.From, query.To)
+	if err != nil {
+		return nil, fmt.Errorf("sum traffic by identity: %w", err)
+	}
+	return usage, nil
+}
+
+// PlanNodeUsage returns total usage per bucket, plan and node.
+func (s *TrafficUsageService) PlanNodeUsage(ctx context.Context, query TrafficQuery) ([]*domain.TrafficUsage, error) {
+	usage, err := s.samples.SumByPlanAndNode(ctx, query.Granularity, query.From, query.To)
+	if err != nil {
+		return nil, fmt.Errorf("sum traffic by plan and node: %w", err)
+	}
+	return usage, nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"market-blockchain/internal/domain"
+)
+
+func TestNewTrafficQuery(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC)
+	hour := time.Hour.Milliseconds()
+
+	t.Run("defaults to the last day of hourly buckets", func(t *testing.T) {
+		query, err := NewTrafficQuery("", 0, 0, now)
+		if err != nil {
+			t.Fatalf("NewTrafficQuery returned error: %v", err)
+		}
+		if query.Granularity != domain.TrafficHourly || query.To != now.UnixMilli() {
+			t.Fatalf("unexpected query: %+v", query)
+		}
+		if want := time.Date(2026, 3, 9, 15, 0, 0, 0, time.UTC).UnixMilli(); query.From != want {
+			t.Fatalf("expected from aligned to %d, got %d", want, query.From)
+		}
+	})
+
+	t.Run("daily default covers 30 days", func(t *testing.T) {
+		query, err := NewTrafficQuery("day", 0, 0, now)
+		if err != nil {
+			t.Fatalf("NewTrafficQuery returned error: %v", err)
+		}
+		if want := time.Date(2026, 2, 8, 0, 0, 0, 0, time.UTC).UnixMilli(); query.From != want {
+			t.Fatalf("expected from %d, got %d", want, query.From)
+		}
+	})
+
+	for name, input := range map[string]struct {
+		granularity string
+		from, to    int64
+	}{
+		"unknown granularity": {"minute", 0, 0},
+		"inverted range":      {"hour", 10 * hour, 5 * hour},
+		"too many buckets":    {"hour", hour, (maxTrafficBuckets + 2) * hour},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewTrafficQuery(input.granularity, input.from, input.to, now); !errors.Is(err, ErrInvalidTrafficQuery) {
+				t.Fatalf("expected ErrInvalidTrafficQuery, got %v", err)
+			}
+		})
+	}
+}
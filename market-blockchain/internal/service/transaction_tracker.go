@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+)
+
+type receiptSource interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	Broadcasting(ctx context.Context, txHash common.Hash) (bool, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+type chainTransactionHandler interface {
+	HandleTransactionConfirmed(ctx context.Context, tx *domain.ChainTransaction) error
+	HandleTransactionFailed(ctx context.Context, tx *domain.ChainTransaction) error
+	ChargeExecuted(ctx context.Context, tx *domain.ChainTransaction) (bool, error)
+}
+
+// TransactionTracker polls receipts for relayer transactions and only hands
+// them to the handler once they are buried under the configured number of
+// blocks. A transaction whose block disappears goes back to pending. One that
+// is still pending after maxPendingAge, and that the relayer has stopped
+// rebroadcasting, is marked dropped and handed to the handler as failed, so
+// whatever it was submitted for can be retried.
+type TransactionTracker struct {
+	receipts      receiptSource
+	transactions  repository.ChainTransactionRepository
+	handler       chainTransactionHandler
+	confirmations uint64
+	interval      time.Duration
+	maxPendingAge time.Duration
+}
+
+func NewTransactionTracker(
+	receipts receiptSource,
+	transactions repository.ChainTransactionRepository,
+	handler chainTransactionHandler,
+	confirmations uint64,
+	interval time.Duration,
+	maxPendingAge time.Duration,
+) *TransactionTracker {
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	if interval == 0 {
+		interval = 15 * time.Second
+	}
+	if maxPendingAge == 0 {
+		maxPendingAge = time.Hour
+	}
+
+	return &TransactionTracker{
+		receipts:      receipts,
+		transactions:  transactions,
+		handler:       handler,
+		confirmations: confirmations,
+		interval:      interval,
+		maxPendingAge: maxPendingAge,
+	}
+}
+
+func (t *TransactionTracker) Start(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	log.Printf("Transaction tracker started (interval: %v, confirmations: %d, max pending age: %v)", t.interval, t.confirmations, t.maxPendingAge)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Transaction tracker stopped")
+			return
+		case <-ticker.C:
+			if err := t.Poll(ctx); err != nil {
+				log.Printf("Transaction tracking error: %v", err)
+			}
+		}
+	}
+}
+
+func (t *TransactionTracker) Poll(ctx context.Context) error {
+	txs, err := t.transactions.ListUnfinalized(ctx)
+	if err != nil {
+		return fmt.Errorf("list unfinalized transactions: %w", err)
+	}
+	if len(txs) == 0 {
+		return nil
+	}
+
+	head, err := t.receipts.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("get head block: %w", err)
+	}
+
+	for _, tx := range txs {
+		if err := t.track(ctx, head, tx); err != nil {
+			log.Printf("Failed to track transaction %s (%s): %v", tx.TxHash, tx.Kind, err)
+		}
+	}
+
+	return nil
+}
+
+func (t *TransactionTracker) track(ctx context.Context, head uint64, tx *domain.ChainTransaction) error {
+	receipt, err := t.receipts.TransactionReceipt(ctx, common.HexToHash(tx.TxHash))
+	if err != nil {
+		return err
+	}
+
+	if receipt == nil {
+		if tx.Status != domain.ChainTxMined {
+			return t.dropIfExpired(ctx, tx)
+		}
+		log.Printf("Transaction %s dropped out of block %d, waiting to be re-mined", tx.TxHash, tx.BlockNumber)
+		tx.Status = domain.ChainTxPending
+		tx.MinedTxHash = ""
+		tx.BlockNumber = 0
+		tx.BlockHash = ""
+		tx.UpdatedAt = time.Now().UnixMilli()
+		if err := t.transactions.Update(tx); err != nil {
+			return fmt.Errorf("reset reorged transaction: %w", err)
+		}
+		return nil
+	}
+
+	// The receipt may belong to a fee-bumped replacement; handlers record
+	// its hash rather than the one first broadcast.
+	blockNumber := receipt.BlockNumber.Uint64()
+	blockHash := receipt.BlockHash.Hex()
+	minedTxHash := receipt.TxHash.Hex()
+	if tx.Status != domain.ChainTxMined || tx.BlockHash != blockHash || tx.MinedTxHash != minedTxHash {
+		tx.Status = domain.ChainTxMined
+		tx.MinedTxHash = minedTxHash
+		tx.BlockNumber = int64(blockNumber)
+		tx.BlockHash = blockHash
+		tx.UpdatedAt = time.Now().UnixMilli()
+		if err := t.transactions.Update(tx); err != nil {
+			return fmt.Errorf("record mined transaction: %w", err)
+		}
+	}
+
+	if head+1 < blockNumber+t.confirmations {
+		return nil
+	}
+
+	// The handler runs before the status flips so that a handler error leaves
+	// the transaction mined and it is retried on the next poll.
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		if err := t.handler.HandleTransactionConfirmed(ctx, tx); err != nil {
+			return fmt.Errorf("handle confirmed transaction: %w", err)
+		}
+		tx.Status = domain.ChainTxConfirmed
+	} else {
+		tx.Error = "transaction reverted"
+		if err := t.handler.HandleTransactionFailed(ctx, tx); err != nil {
+			return fmt.Errorf("handle failed transaction: %w", err)
+		}
+		tx.Status = domain.ChainTxFailed
+	}
+
+	tx.UpdatedAt = time.Now().UnixMilli()
+	if err := t.transactions.Update(tx); err != nil {
+		return fmt.Errorf("finalize transaction: %w", err)
+	}
+
+	return nil
+}
+
+// dropIfExpired gives up on a transaction that has been pending for longer
+// than maxPendingAge. While the relayer is still fee-bumping its nonce the
+// transaction can be mined at any time, so it keeps waiting; failing it then
+// would have the retried charge revert as a duplicate. A charge the vault has
+// already executed is confirmed instead. Otherwise the handler sees it as
+// failed, which releases the charge or authorization it was submitted for.
+func (t *TransactionTracker) dropIfExpired(ctx context.Context, tx *domain.ChainTransaction) error {
+	if time.Since(time.UnixMilli(tx.CreatedAt)) < t.maxPendingAge {
+		return nil
+	}
+
+	broadcasting, err := t.receipts.Broadcasting(ctx, common.HexToHash(tx.TxHash))
+	if err != nil {
+		return fmt.Errorf("check relayer broadcast: %w", err)
+	}
+	if broadcasting {
+		log.Printf("ALERT: %s transaction %s not mined after %v, the relayer is still rebroadcasting it", tx.Kind, tx.TxHash, t.maxPendingAge)
+		return nil
+	}
+
+	executed, err := t.handler.ChargeExecuted(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("check executed charge: %w", err)
+	}
+	if executed {
+		log.Printf("ALERT: %s transaction %s has no receipt but its charge was executed on chain, confirming it", tx.Kind, tx.TxHash)
+		if err := t.handler.HandleTransactionConfirmed(ctx, tx); err != nil {
+			return fmt.Errorf("handle executed transaction: %w", err)
+		}
+		tx.Status = domain.ChainTxConfirmed
+		tx.UpdatedAt = time.Now().UnixMilli()
+		if err := t.transactions.Update(tx); err != nil {
+			return fmt.Errorf("finalize executed transaction: %w", err)
+		}
+		return nil
+	}
+
+	log.Printf("ALERT: %s transaction %s not mined after %v, marking it dropped", tx.Kind, tx.TxHash, t.maxPendingAge)
+	tx.Error = fmt.Sprintf("not mined within %v", t.maxPendingAge)
+	tx.Status = domain.ChainTxDropped
+	if err := t.handler.HandleTransactionFailed(ctx, tx); err != nil {
+		tx.Status = domain.ChainTxPending
+		return fmt.Errorf("handle dropped transaction: %w", err)
+	}
+
+	tx.UpdatedAt = time.Now().UnixMilli()
+	if err := t.transactions.Update(tx); err != nil {
+		return fmt.Errorf("finalize dropped transaction: %w", err)
+	}
+	return nil
+}
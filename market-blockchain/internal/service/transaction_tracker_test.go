@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"market-blockchain/internal/domain"
+)
+
+type testReceiptSource struct {
+	head         uint64
+	receipts     map[common.Hash]*types.Receipt
+	broadcasting map[common.Hash]bool
+}
+
+func (s *testReceiptSource) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return s.receipts[txHash], nil
+}
+
+func (s *testReceiptSource) Broadcasting(ctx context.Context, txHash common.Hash) (bool, error) {
+	return s.broadcasting[txHash], nil
+}
+
+func (s *testReceiptSource) BlockNumber(ctx context.Context) (uint64, error) {
+	return s.head, nil
+}
+
+type testChainTransactionRepo struct {
+	created []*domain.ChainTransaction
+	txs     []*domain.ChainTransaction
+}
+
+func (r *testChainTransactionRepo) Create(tx *domain.ChainTransaction) error {
+	copy := *tx
+	r.created = append(r.created, &copy)
+	return nil
+}
+func (r *testChainTransactionRepo) Update(tx *domain.ChainTransaction) error { return nil }
+func (r *testChainTransactionRepo) GetByHash(ctx context.Context, txHash string) (*domain.ChainTransaction, error) {
+	for _, tx := range r.txs {
+		if tx.TxHash == txHash {
+			return tx, nil
+		}
+	}
+	return nil, nil
+}
+func (r *testChainTransactionRepo) ListUnfinalized(ctx context.Context) ([]*domain.ChainTransaction, error) {
+	var txs []*domain.ChainTransaction
+	for _, tx := range r.txs {
+		if tx.Status == domain.ChainTxPending || tx.Status == domain.ChainTxMined {
+			txs = append(txs, tx)
+		}
+	}
+	return txs, nil
+}
+
+type captureTransactionHandler struct {
+	confirmed []string
+	failed    []string
+	executed  map[string]bool
+	err       error
+}
+
+func (h *captureTransactionHandler) HandleTransactionConfirmed(ctx context.Context, tx *domain.ChainTransaction) error {
+	if h.err != nil {
+		return h.err
+	}
+	h.confirmed = append(h.confirmed, tx.TxHash)
+	return nil
+}
+
+func (h *captureTransactionHandler) HandleTransactionFailed(ctx context.Context, tx *domain.ChainTransaction) error {
+	if h.err != nil {
+		return h.err
+	}
+	h.failed = append(h.failed, tx.TxHash)
+	return nil
+}
+
+func (h *captureTransactionHandler) ChargeExecuted(ctx context.Context, tx *domain.ChainTransaction) (bool, error) {
+	return h.executed[tx.TxHash], nil
+}
+
+var trackerTestHash = common.HexToHash("0x01")
+
+func newTrackerReceipt(status uint64, block int64, blockHash string) *types.Receipt {
+	return &types.Receipt{Status: status, TxHash: trackerTestHash, BlockNumber: big.NewInt(block), BlockHash: common.HexToHash(blockHash)}
+}
+
+func TestTransactionTrackerWaitsForConfirmationDepth(t *testing.T) {
+	tx := &domain.ChainTransaction{TxHash: trackerTestHash.Hex(), Kind: domain.ChainTxFirstCharge, Status: domain.ChainTxPending}
+	source := &testReceiptSource{head: 101, receipts: map[common.Hash]*types.Receipt{trackerTestHash: newTrackerReceipt(types.ReceiptStatusSuccessful, 100, "0xaa")}}
+	handler := &captureTransactionHandler{}
+	tracker := NewTransactionTracker(source, &testChainTransactionRepo{txs: []*domain.ChainTransaction{tx}}, handler, 3, 0, 0)
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if tx.Status != domain.ChainTxMined || tx.BlockNumber != 100 {
+		t.Fatalf("expected mined at block 100, got %s at %d", tx.Status, tx.BlockNumber)
+	}
+	if len(handler.confirmed) != 0 {
+		t.Fatal("expected handler not to run before confirmation depth")
+	}
+
+	source.head = 102
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if tx.Status != domain.ChainTxConfirmed {
+		t.Fatalf("expected confirmed, got %s", tx.Status)
+	}
+	if len(handler.confirmed) != 1 {
+		t.Fatalf("expected one confirmation callback, got %d", len(handler.confirmed))
+	}
+}
+
+func TestTransactionTrackerMarksRevertedTransactionFailed(t *testing.T) {
+	tx := &domain.ChainTransaction{TxHash: trackerTestHash.Hex(), Kind: domain.ChainTxRenewalCharge, Status: domain.ChainTxPending}
+	source := &testReceiptSource{head: 100, receipts: map[common.Hash]*types.Receipt{trackerTestHash: newTrackerReceipt(types.ReceiptStatusFailed, 100, "0xaa")}}
+	handler := &captureTransactionHandler{}
+	tracker := NewTransactionTracker(source, &testChainTransactionRepo{txs: []*domain.ChainTransaction{tx}}, handler, 1, 0, 0)
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if tx.Status != domain.ChainTxFailed {
+		t.Fatalf("expected failed, got %s", tx.Status)
+	}
+	if len(handler.failed) != 1 || len(handler.confirmed) != 0 {
+		t.Fatalf("unexpected callbacks: confirmed=%v failed=%v", handler.confirmed, handler.failed)
+	}
+}
+
+func TestTransactionTrackerResetsReorgedTransaction(t *testing.T) {
+	tx := &domain.ChainTransaction{TxHash: trackerTestHash.Hex(), Kind: domain.ChainTxFirstCharge, Status: domain.ChainTxPending}
+	source := &testReceiptSource{head: 100, receipts: map[common.Hash]*types.Receipt{trackerTestHash: newTrackerReceipt(types.ReceiptStatusSuccessful, 100, "0xaa")}}
+	handler := &captureTransactionHandler{}
+	tracker := NewTransactionTracker(source, &testChainTransactionRepo{txs: []*domain.ChainTransaction{tx}}, handler, 3, 0, 0)
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if tx.Status != domain.ChainTxMined {
+		t.Fatalf("expected mined, got %s", tx.Status)
+	}
+
+	delete(source.receipts, trackerTestHash)
+	source.head = 101
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if tx.Status != domain.ChainTxPending || tx.BlockHash != "" {
+		t.Fatalf("expected reorged transaction back to pending, got %s %s", tx.Status, tx.BlockHash)
+	}
+
+	source.receipts[trackerTestHash] = newTrackerReceipt(types.ReceiptStatusSuccessful, 101, "0xbb")
+	source.head = 103
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if tx.Status != domain.ChainTxConfirmed || tx.BlockNumber != 101 {
+		t.Fatalf("expected confirmed in block 101, got %s at %d", tx.Status, tx.BlockNumber)
+	}
+	if len(handler.confirmed) != 1 {
+		t.Fatalf("expected one confirmation callback, got %d", len(handler.confirmed))
+	}
+}
+
+func TestTransactionTrackerRetriesWhenHandlerFails(t *testing.T) {
+	tx := &domain.ChainTransaction{TxHash: trackerTestHash.Hex(), Kind: domain.ChainTxFirstCharge, Status: domain.ChainTxPending}
+	source := &testReceiptSource{head: 100, receipts: map[common.Hash]*types.Receipt{trackerTestHash: newTrackerReceipt(types.ReceiptStatusSuccessful, 100, "0xaa")}}
+	handler := &captureTransactionHandler{err: errors.New("db down")}
+	tracker := NewTransactionTracker(source, &testChainTransactionRepo{txs: []*domain.ChainTransaction{tx}}, handler, 1, 0, 0)
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if tx.Status != domain.ChainTxMined {
+		t.Fatalf("expected transaction to stay mined for retry, got %s", tx.Status)
+	}
+
+	handler.err = nil
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if tx.Status != domain.ChainTxConfirmed {
+		t.Fatalf("expected confirmed after retry, got %s", tx.Status)
+	}
+}
+
+func TestTransactionTrackerDropsTransactionNeverMined(t *testing.T) {
+	fresh := &domain.ChainTransaction{TxHash: common.HexToHash("0x02").Hex(), Kind: domain.ChainTxRenewalCharge, Status: domain.ChainTxPending, CreatedAt: time.Now().UnixMilli()}
+	stale := &domain.ChainTransaction{TxHash: trackerTestHash.Hex(), Kind: domain.ChainTxRenewalCharge, Status: domain.ChainTxPending, CreatedAt: time.Now().Add(-2 * time.Hour).UnixMilli()}
+	source := &testReceiptSource{head: 100, receipts: map[common.Hash]*types.Receipt{}}
+	handler := &captureTransactionHandler{}
+	tracker := NewTransactionTracker(source, &testChainTransactionRepo{txs: []*domain.ChainTransaction{fresh, stale}}, handler, 1, 0, time.Hour)
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if stale.Status != domain.ChainTxDropped || stale.Error == "" {
+		t.Fatalf("expected stale transaction dropped, got %s %q", stale.Status, stale.Error)
+	}
+	if fresh.Status != domain.ChainTxPending {
+		t.Fatalf("expected fresh transaction to stay pending, got %s", fresh.Status)
+	}
+	if len(handler.failed) != 1 || handler.failed[0] != stale.TxHash {
+		t.Fatalf("expected one failure callback for the stale transaction, got %v", handler.failed)
+	}
+}
+
+func TestTransactionTrackerWaitsWhileRelayerRebroadcasts(t *testing.T) {
+	stale := &domain.ChainTransaction{TxHash: trackerTestHash.Hex(), Kind: domain.ChainTxRenewalCharge, Status: domain.ChainTxPending, CreatedAt: time.Now().Add(-2 * time.Hour).UnixMilli()}
+	source := &testReceiptSource{head: 100, receipts: map[common.Hash]*types.Receipt{}, broadcasting: map[common.Hash]bool{trackerTestHash: true}}
+	handler := &captureTransactionHandler{}
+	tracker := NewTransactionTracker(source, &testChainTransactionRepo{txs: []*domain.ChainTransaction{stale}}, handler, 1, 0, time.Hour)
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if stale.Status != domain.ChainTxPending || len(handler.failed) != 0 {
+		t.Fatalf("expected the transaction to stay pending while its nonce is rebroadcast, got %s, failures %v", stale.Status, handler.failed)
+	}
+}
+
+func TestTransactionTrackerConfirmsExpiredTransactionWhoseChargeExecuted(t *testing.T) {
+	stale := &domain.ChainTransaction{TxHash: trackerTestHash.Hex(), Kind: domain.ChainTxRenewalCharge, Status: domain.ChainTxPending, CreatedAt: time.Now().Add(-2 * time.Hour).UnixMilli()}
+	source := &testReceiptSource{head: 100, receipts: map[common.Hash]*types.Receipt{}}
+	handler := &captureTransactionHandler{executed: map[string]bool{trackerTestHash.Hex(): true}}
+	tracker := NewTransactionTracker(source, &testChainTransactionRepo{txs: []*domain.ChainTransaction{stale}}, handler, 1, 0, time.Hour)
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if stale.Status != domain.ChainTxConfirmed || len(handler.confirmed) != 1 || len(handler.failed) != 0 {
+		t.Fatalf("expected the executed charge to be confirmed, got %s, confirmed %v, failed %v", stale.Status, handler.confirmed, handler.failed)
+	}
+}
+
+func TestTransactionTrackerRecordsReplacementHash(t *testing.T) {
+	replacement := common.HexToHash("0x03")
+	tx := &domain.ChainTransaction{TxHash: trackerTestHash.Hex(), Kind: domain.ChainTxRenewalCharge, Status: domain.ChainTxPending}
+	receipt := newTrackerReceipt(types.ReceiptStatusSuccessful, 100, "0xaa")
+	receipt.TxHash = replacement
+	source := &testReceiptSource{head: 100, receipts: map[common.Hash]*types.Receipt{trackerTestHash: receipt}}
+	handler := &captureTransactionHandler{}
+	tracker := NewTransactionTracker(source, &testChainTransactionRepo{txs: []*domain.ChainTransaction{tx}}, handler, 1, 0, 0)
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll returned error: %v", err)
+	}
+	if tx.Status != domain.ChainTxConfirmed || tx.MinedTxHash != replacement.Hex() || tx.SettledTxHash() != replacement.Hex() {
+		t.Fatalf("expected confirmed under the replacement hash, got %s %q", tx.Status, tx.MinedTxHash)
+	}
+}
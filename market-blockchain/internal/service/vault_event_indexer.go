@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+)
+
+const vaultEventCursorName = "vault_events"
+
+type vaultEventSource interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	FetchVaultEvents(ctx context.Context, from, to uint64) ([]*domain.VaultEvent, error)
+}
+
+type vaultEventStore interface {
+	IndexVaultEvents(ctx context.Context, events []*domain.VaultEvent, cursor *domain.ChainCursor) error
+}
+
+// VaultEventIndexer copies VPNCreditVault logs into Postgres. It backfills
+// from startBlock on first run, then follows the chain while staying
+// confirmations blocks behind the head so indexed logs are not reorged away.
+type VaultEventIndexer struct {
+	source        vaultEventSource
+	cursors       repository.ChainCursorRepository
+	store         vaultEventStore
+	startBlock    uint64
+	confirmations uint64
+	batchSize     uint64
+	interval      time.Duration
+}
+
+func NewVaultEventIndexer(
+	source vaultEventSource,
+	cursors repository.ChainCursorRepository,
+	store vaultEventStore,
+	startBlock uint64,
+	confirmations uint64,
+	batchSize uint64,
+	interval time.Duration,
+) *VaultEventIndexer {
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	if batchSize == 0 {
+		batchSize = 2000
+	}
+	if interval == 0 {
+		interval = 30 * time.Second
+	}
+
+	return &VaultEventIndexer{
+		source:        source,
+		cursors:       cursors,
+		store:         store,
+		startBlock:    startBlock,
+		confirmations: confirmations,
+		batchSize:     batchSize,
+		interval:      interval,
+	}
+}
+
+func (i *VaultEventIndexer) Start(ctx context.Context) {
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+
+	log.Printf("Vault event indexer started (interval: %v, start block: %d)", i.interval, i.startBlock)
+
+	if err := i.Sync(ctx); err != nil {
+		log.Printf("Vault event indexing error: %v", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Vault event indexer stopped")
+			return
+		case <-ticker.C:
+			if err := i.Sync(ctx); err != nil {
+				log.Printf("Vault event indexing error: %v", err)
+			}
+		}
+	}
+}
+
+// Sync indexes every block between the stored cursor and the confirmed head.
+func (i *VaultEventIndexer) Sync(ctx context.Context) error {
+	head, err := i.source.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("get head block: %w", err)
+	}
+	if head+1 < i.confirmations {
+		return nil
+	}
+	safeHead := head + 1 - i.confirmations
+
+	cursor, err := i.cursors.GetByName(ctx, vaultEventCursorName)
+	if err != nil {
+		return fmt.Errorf("get cursor: %w", err)
+	}
+
+	next := i.startBlock
+	if cursor != nil && uint64(cursor.BlockNumber)+1 > next {
+		next = uint64(cursor.BlockNumber) + 1
+	}
+
+	for next <= safeHead {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		to := next + i.batchSize - 1
+		if to > safeHead {
+			to = safeHead
+		}
+
+		events, err := i.source.FetchVaultEvents(ctx, next, to)
+		if err != nil {
+			return fmt.Errorf("fetch vault events %d-%d: %w", next, to, err)
+		}
+
+		if err := i.store.IndexVaultEvents(ctx, events, &domain.ChainCursor{
+			Name:        vaultEventCursorName,
+			BlockNumber: int64(to),
+			UpdatedAt:   time.Now().UnixMilli(),
+		}); err != nil {
+			return fmt.Errorf("index vault events %d-%d: %w", next, to, err)
+		}
+
+		if len(events) > 0 {
+			log.Printf("Indexed %d vault events in blocks %d-%d", len(events), next, to)
+		}
+		next = to + 1
+	}
+
+	return nil
+}
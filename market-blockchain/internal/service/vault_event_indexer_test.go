@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"market-blockchain/internal/domain"
+)
+
+type fetchedRange struct {
+	from uint64
+	to   uint64
+}
+
+type testVaultEventSource struct {
+	head    uint64
+	events  []*domain.VaultEvent
+	fetched []fetchedRange
+}
+
+func (s *testVaultEventSource) BlockNumber(ctx context.Context) (uint64, error) {
+	return s.head, nil
+}
+
+func (s *testVaultEventSource) FetchVaultEvents(ctx context.Context, from, to uint64) ([]*domain.VaultEvent, error) {
+	s.fetched = append(s.fetched, fetchedRange{from: from, to: to})
+	var events []*domain.VaultEvent
+	for _, event := range s.events {
+		if uint64(event.BlockNumber) >= from && uint64(event.BlockNumber) <= to {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+type testVaultEventStore struct {
+	cursor  *domain.ChainCursor
+	indexed []*domain.VaultEvent
+}
+
+func (s *testVaultEventStore) GetByName(ctx context.Context, name string) (*domain.ChainCursor, error) {
+	if s.cursor != nil && s.cursor.Name == name {
+		return s.cursor, nil
+	}
+	return nil, nil
+}
+
+func (s *testVaultEventStore) IndexVaultEvents(ctx context.Context, events []*domain.VaultEvent, cursor *domain.ChainCursor) error {
+	s.indexed = append(s.indexed, events...)
+	s.cursor = cursor
+	return nil
+}
+
+func TestVaultEventIndexerBackfillsFromStartBlockInBatches(t *testing.T) {
+	source := &testVaultEventSource{
+		head: 130,
+		events: []*domain.VaultEvent{
+			{TxHash: "0x1", BlockNumber: 99, Name: domain.VaultEventIdentityBound},
+			{TxHash: "0x2", BlockNumber: 105, Name: domain.VaultEventChargeAuthorized},
+			{TxHash: "0x3", BlockNumber: 125, Name: domain.VaultEventIdentityCharged},
+			{TxHash: "0x4", BlockNumber: 129, Name: domain.VaultEventIdentityCharged},
+		},
+	}
+	store := &testVaultEventStore{}
+	indexer := NewVaultEventIndexer(source, store, store, 100, 3, 10, 0)
+
+	if err := indexer.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+
+	want := []fetchedRange{{100, 109}, {110, 119}, {120, 128}}
+	if len(source.fetched) != len(want) {
+		t.Fatalf("unexpected fetched ranges: %v", source.fetched)
+	}
+	for i := range want {
+		if source.fetched[i] != want[i] {
+			t.Fatalf("unexpected fetched ranges: %v", source.fetched)
+		}
+	}
+	if len(store.indexed) != 2 || store.indexed[0].TxHash != "0x2" || store.indexed[1].TxHash != "0x3" {
+		t.Fatalf("unexpected indexed events: %+v", store.indexed)
+	}
+	if store.cursor == nil || store.cursor.BlockNumber != 128 {
+		t.Fatalf("expected cursor at confirmed head 128, got %+v", store.cursor)
+	}
+}
+
+func TestVaultEventIndexerResumesFromCursor(t *testing.T) {
+	source := &testVaultEventSource{
+		head:   140,
+		events: []*domain.VaultEvent{{TxHash: "0x4", BlockNumber: 129, Name: domain.VaultEventIdentityCharged}},
+	}
+	store := &testVaultEventStore{cursor: &domain.ChainCursor{Name: vaultEventCursorName, BlockNumber: 128}}
+	indexer := NewVaultEventIndexer(source, store, store, 100, 1, 100, 0)
+
+	if err := indexer.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if len(source.fetched) != 1 || source.fetched[0] != (fetchedRange{129, 140}) {
+		t.Fatalf("unexpected fetched ranges: %v", source.fetched)
+	}
+	if len(store.indexed) != 1 || store.cursor.BlockNumber != 140 {
+		t.Fatalf("unexpected indexing result: events=%d cursor=%d", len(store.indexed), store.cursor.BlockNumber)
+	}
+
+	source.fetched = nil
+	if err := indexer.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if len(source.fetched) != 0 {
+		t.Fatalf("expected no fetch when caught up, got %v", source.fetched)
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+)
+
+var (
+	ErrInvalidSignInMessage     = errors.New("invalid sign-in message")
+	ErrWalletSignatureMismatch  = errors.New("signature does not match sign-in address")
+	ErrInvalidWalletNonce       = errors.New("sign-in nonce is invalid, expired or already used")
+	ErrWalletSessionInvalid     = errors.New("wallet session is invalid or expired")
+	ErrSubscriptionAccessDenied = errors.New("caller is not a party to this subscription")
+	ErrIdentityAccessDenied     = errors.New("caller is neither the identity nor a payer of its subscriptions")
+)
+
+type WalletAuthConfig struct {
+	// Domain is the host the sign-in message must be issued for.
+	Domain string
+	// ChainID, when non-zero, is the only chain a message may name.
+	ChainID    int64
+	NonceTTL   time.Duration
+	SessionTTL time.Duration
+}
+
+type walletAuthSubscriptions interface {
+	GetByID(ctx context.Context, id string) (*domain.Subscription, error)
+	ExistsByIdentityAndPayer(ctx context.Context, identityAddress, payerAddress string) (bool, error)
+}
+
+type WalletAuthService struct {
+	nonces        repository.AuthNonceRepository
+	sessions      repository.WalletSessionRepository
+	subscriptions walletAuthSubscriptions
+	config        WalletAuthConfig
+}
+
+func NewWalletAuthService(
+	nonces repository.AuthNonceRepository,
+	sessions repository.WalletSessionRepository,
+	subscriptions walletAuthSubscriptions,
+	config WalletAuthConfig,
+) *WalletAuthService {
+	return &WalletAuthService{
+		nonces:        nonces,
+		sessions:      sessions,
+		subscriptions: subscriptions,
+		config:        config,
+	}
+}
+
+// IssueNonce creates a single-use nonce for the next sign-in message.
+func (s *WalletAuthService) IssueNonce(ctx context.Context) (*domain.AuthNonce, error) {
+	value, err := randomHex(16)
+	if err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	now := time.Now()
+	nonce := &domain.AuthNonce{
+		Nonce:     value,
+		ExpiresAt: now.Add(s.config.NonceTTL).UnixMilli(),
+		CreatedAt: now.UnixMilli(),
+	}
+	if err := s.nonces.Create(nonce); err != nil {
+		return nil, fmt.Errorf("persist nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+type WalletSignInResult struct {
+	Token   string
+	Session *domain.WalletSession
+}
+
+// SignIn verifies an EIP-4361 message signed with personal_sign and opens a
+// session for the signing address. The nonce is only consumed once the
+// signature checks out, so a malformed request cannot burn someone else's
+// nonce.
+func (s *WalletAuthService) SignIn(ctx context.Context, message string, signature []byte) (*WalletSignInResult, error) {
+	msg, err := ParseSIWEMessage(message)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignInMessage, err)
+	}
+
+	now := time.Now()
+	if msg.Domain != s.config.Domain {
+		return nil, fmt.Errorf("%w: domain %q is not %q", ErrInvalidSignInMessage, msg.Domain, s.config.Domain)
+	}
+	if s.config.ChainID != 0 && msg.ChainID != s.config.ChainID {
+		return nil, fmt.Errorf("%w: chain id %d is not %d", ErrInvalidSignInMessage, msg.ChainID, s.config.ChainID)
+	}
+	if !msg.ExpirationTime.IsZero() && !now.Before(msg.ExpirationTime) {
+		return nil, fmt.Errorf("%w: message expired", ErrInvalidSignInMessage)
+	}
+	if !msg.NotBefore.IsZero() && now.Before(msg.NotBefore) {
+		return nil, fmt.Errorf("%w: message not valid yet", ErrInvalidSignInMessage)
+	}
+
+	signer, err := recoverPersonalSigner(message, signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWalletSignatureMismatch, err)
+	}
+	if signer != msg.Address {
+		return nil, ErrWalletSignatureMismatch
+	}
+
+	consumed, err := s.nonces.Consume(ctx, msg.Nonce, now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("consume nonce: %w", err)
+	}
+	if !consumed {
+		return nil, ErrInvalidWalletNonce
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return nil, fmt.Errorf("generate session token: %w", err)
+	}
+
+	expiresAt := now.Add(s.config.SessionTTL)
+	if !msg.ExpirationTime.IsZero() && msg.ExpirationTime.Before(expiresAt) {
+		expiresAt = msg.ExpirationTime
+	}
+	session := &domain.WalletSession{
+		TokenHash: hashSessionToken(token),
+		Address:   signer.Hex(),
+		ExpiresAt: expiresAt.UnixMilli(),
+		CreatedAt: now.UnixMilli(),
+	}
+	if err := s.sessions.Create(session); err != nil {
+		return nil, fmt.Errorf("persist session: %w", err)
+	}
+
+	return &WalletSignInResult{Token: token, Session: session}, nil
+}
+
+// Authenticate resolves a bearer token to the wallet address it was issued
+// for.
+func (s *WalletAuthService) Authenticate(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", ErrWalletSessionInvalid
+	}
+	session, err := s.sessions.GetByTokenHash(ctx, hashSessionToken(token))
+	if err != nil {
+		return "", fmt.Errorf("get session: %w", err)
+	}
+	if session == nil || session.ExpiresAt <= time.Now().UnixMilli() {
+		return "", ErrWalletSessionInvalid
+	}
+	return session.Address, nil
+}
+
+func (s *WalletAuthService) SignOut(ctx context.Context, token string) error {
+	if err := s.sessions.Delete(ctx, hashSessionToken(token)); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+// AuthorizeSubscription checks that address is the identity or the payer of
+// the subscription.
+func (s *WalletAuthService) AuthorizeSubscription(ctx context.Context, address, subscriptionID string) error {
+	subscription, err := s.subscriptions.GetByID(ctx, subscriptionID)
+	if err != nil {
+		return fmt.Errorf("get subscription: %w", err)
+	}
+	if subscription == nil {
+		return ErrSubscriptionNotFound
+	}
+	if address == "" {
+		return ErrSubscriptionAccessDenied
+	}
+	if !strings.EqualFold(address, subscription.IdentityAddress) && !strings.EqualFold(address, subscription.PayerAddress) {
+		return ErrSubscriptionAccessDenied
+	}
+	return nil
+}
+
+// AuthorizeIdentity checks that address is the identity itself or the payer
+// of one of its subscriptions.
+func (s *WalletAuthService) AuthorizeIdentity(ctx context.Context, address, identityAddress string) error {
+	if address == "" {
+		return ErrIdentityAccessDenied
+	}
+	if strings.EqualFold(address, identityAddress) {
+		return nil
+	}
+
+	isPayer, err := s.subscriptions.ExistsByIdentityAndPayer(ctx, identityAddress, address)
+	if err != nil {
+		return fmt.Errorf("look up payer of identity: %w", err)
+	}
+	if !isPayer {
+		return ErrIdentityAccessDenied
+	}
+	return nil
+}
+
+func recoverPersonalSigner(message string, signature []byte) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("signature must be %d bytes", crypto.SignatureLength)
+	}
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, signature)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte(message)), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"market-blockchain/internal/domain"
+)
+
+type testAuthNonceRepo struct {
+	nonces map[string]*domain.AuthNonce
+}
+
+func (r *testAuthNonceRepo) Create(nonce *domain.AuthNonce) error {
+	if r.nonces == nil {
+		r.nonces = make(map[string]*domain.AuthNonce)
+	}
+	r.nonces[nonce.Nonce] = nonce
+	return nil
+}
+
+func (r *testAuthNonceRepo) Consume(ctx context.Context, nonce string, now int64) (bool, error) {
+	stored, ok := r.nonces[nonce]
+	if !ok || stored.ConsumedAt != 0 || stored.ExpiresAt <= now {
+		return false, nil
+	}
+	stored.ConsumedAt = now
+	return true, nil
+}
+
+type testWalletSessionRepo struct {
+	sessions map[string]*domain.WalletSession
+}
+
+func (r *testWalletSessionRepo) Create(session *domain.WalletSession) error {
+	if r.sessions == nil {
+		r.sessions = make(map[string]*domain.WalletSession)
+	}
+	r.sessions[session.TokenHash] = session
+	return nil
+}
+
+func (r *testWalletSessionRepo) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.WalletSession, error) {
+	return r.sessions[tokenHash], nil
+}
+
+func (r *testWalletSessionRepo) Delete(ctx context.Context, tokenHash string) error {
+	delete(r.sessions, tokenHash)
+	return nil
+}
+
+func newWalletAuthFixture(subscription *domain.Subscription) (*WalletAuthService, *testAuthNonceRepo, *testWalletSessionRepo) {
+	nonces := &testAuthNonceRepo{}
+	sessions := &testWalletSessionRepo{}
+	service := NewWalletAuthService(nonces, sessions, &testActivationSubscriptionRepo{subscription: subscription}, WalletAuthConfig{
+		Domain:     "app.example.com",
+		ChainID:    84532,
+		NonceTTL:   10 * time.Minute,
+		SessionTTL: time.Hour,
+	})
+	return service, nonces, sessions
+}
+
+func buildSIWEMessage(domainName string, address common.Address, chainID int64, nonce string, issuedAt time.Time) string {
+	return fmt.Sprintf("%s wants you to sign in with your Ethereum account:\n%s\n\nSign in to manage your subscription.\n\nURI: https://%s\nVersion: 1\nChain ID: %d\nNonce: %s\nIssued At: %s",
+		domainName, address.Hex(), domainName, chainID, nonce, issuedAt.UTC().Format(time.RFC3339))
+}
+
+func personalSign(t *testing.T, key *ecdsa.PrivateKey, message string) []byte {
+	t.Helper()
+	sig, err := crypto.Sign(accounts.TextHash([]byte(message)), key)
+	if err != nil {
+		t.Fatalf("sign message: %v", err)
+	}
+	sig[64] += 27
+	return sig
+}
+
+func TestParseSIWEMessage(t *testing.T) {
+	address := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	raw := buildSIWEMessage("app.example.com", address, 84532, "abcdef0123456789", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) +
+		"\nExpiration Time: 2026-01-02T04:04:05Z\nResources:\n- https://app.example.com/terms"
+
+	msg, err := ParseSIWEMessage(raw)
+	if err != nil {
+		t.Fatalf("ParseSIWEMessage returned error: %v", err)
+	}
+	if msg.Domain != "app.example.com" || msg.Address != address || msg.ChainID != 84532 || msg.Nonce != "abcdef0123456789" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if msg.Statement != "Sign in to manage your subscription." || msg.ExpirationTime.IsZero() || len(msg.Resources) != 1 {
+		t.Fatalf("unexpected optional fields: %+v", msg)
+	}
+
+	if _, err := ParseSIWEMessage(raw + "\nExtra: value"); err == nil {
+		t.Fatal("expected unknown field to be rejected")
+	}
+}
+
+func TestWalletSignInIssuesSessionForSigner(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	service, nonces, _ := newWalletAuthFixture(nil)
+
+	nonce, err := service.IssueNonce(context.Background())
+	if err != nil {
+		t.Fatalf("IssueNonce returned error: %v", err)
+	}
+	message := buildSIWEMessage("app.example.com", address, 84532, nonce.Nonce, time.Now())
+
+	result, err := service.SignIn(context.Background(), message, personalSign(t, key, message))
+	if err != nil {
+		t.Fatalf("SignIn returned error: %v", err)
+	}
+	if result.Session.Address != address.Hex() || result.Token == "" || result.Session.TokenHash == result.Token {
+		t.Fatalf("unexpected session: %+v", result.Session)
+	}
+	if nonces.nonces[nonce.Nonce].ConsumedAt == 0 {
+		t.Fatal("expected nonce to be consumed")
+	}
+
+	authenticated, err := service.Authenticate(context.Background(), result.Token)
+	if err != nil || authenticated != address.Hex() {
+		t.Fatalf("expected token to authenticate %s, got %q (%v)", address.Hex(), authenticated, err)
+	}
+
+	if _, err := service.SignIn(context.Background(), message, personalSign(t, key, message)); !errors.Is(err, ErrInvalidWalletNonce) {
+		t.Fatalf("expected replayed nonce to be rejected, got %v", err)
+	}
+}
+
+func TestWalletSignInRejectsInvalidRequests(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey)
+
+	cases := []struct {
+		name    string
+		message func(nonce string) string
+		signer  *ecdsa.PrivateKey
+		want    error
+	}{
+		{name: "wrong domain", message: func(nonce string) string {
+			return buildSIWEMessage("evil.example.com", address, 84532, nonce, time.Now())
+		}, signer: key, want: ErrInvalidSignInMessage},
+		{name: "wrong chain", message: func(nonce string) string {
+			return buildSIWEMessage("app.example.com", address, 1, nonce, time.Now())
+		}, signer: key, want: ErrInvalidSignInMessage},
+		{name: "other signer", message: func(nonce string) string {
+			return buildSIWEMessage("app.example.com", address, 84532, nonce, time.Now())
+		}, signer: other, want: ErrWalletSignatureMismatch},
+		{name: "unknown nonce", message: func(nonce string) string {
+			return buildSIWEMessage("app.example.com", address, 84532, "neverissued", time.Now())
+		}, signer: key, want: ErrInvalidWalletNonce},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			service, nonces, _ := newWalletAuthFixture(nil)
+			nonce, _ := service.IssueNonce(context.Background())
+			message := tc.message(nonce.Nonce)
+
+			_, err := service.SignIn(context.Background(), message, personalSign(t, tc.signer, message))
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+			if tc.want != ErrInvalidWalletNonce && nonces.nonces[nonce.Nonce].ConsumedAt != 0 {
+				t.Fatal("expected nonce to survive a rejected sign-in")
+			}
+		})
+	}
+}
+
+func TestWalletAuthenticateRejectsExpiredSession(t *testing.T) {
+	service, _, sessions := newWalletAuthFixture(nil)
+	sessions.Create(&domain.WalletSession{TokenHash: hashSessionToken("token"), Address: "0x01", ExpiresAt: time.Now().Add(-time.Second).UnixMilli()})
+
+	if _, err := service.Authenticate(context.Background(), "token"); !errors.Is(err, ErrWalletSessionInvalid) {
+		t.Fatalf("expected ErrWalletSessionInvalid, got %v", err)
+	}
+}
+
+func TestAuthorizeSubscriptionAllowsIdentityAndPayerOnly(t *testing.T) {
+	subscription, _, _ := newFirstChargeFixture()
+	service, _, _ := newWalletAuthFixture(subscription)
+	ctx := context.Background()
+
+	if err := service.AuthorizeSubscription(ctx, "0x0000000000000000000000000000000000000001", "sub_1"); err != nil {
+		t.Fatalf("expected identity to be allowed, got %v", err)
+	}
+	if err := service.AuthorizeSubscription(ctx, "0x0000000000000000000000000000000000000002", "sub_1"); err != nil {
+		t.Fatalf("expected payer to be allowed, got %v", err)
+	}
+	if err := service.AuthorizeSubscription(ctx, "0x0000000000000000000000000000000000000003", "sub_1"); !errors.Is(err, ErrSubscriptionAccessDenied) {
+		t.Fatalf("expected ErrSubscriptionAccessDenied, got %v", err)
+	}
+	if err := service.AuthorizeSubscription(ctx, "0x0000000000000000000000000000000000000001", "missing"); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Fatalf("expected ErrSubscriptionNotFound, got %v", err)
+	}
+}
+
+func TestAuthorizeIdentityAllowsIdentityAndItsPayers(t *testing.T) {
+	subscription, _, _ := newFirstChargeFixture()
+	service, _, _ := newWalletAuthFixture(subscription)
+	ctx := context.Background()
+	identity := "0x0000000000000000000000000000000000000001"
+
+	if err := service.AuthorizeIdentity(ctx, identity, identity); err != nil {
+		t.Fatalf("expected identity to be allowed, got %v", err)
+	}
+	if err := service.AuthorizeIdentity(ctx, "0x0000000000000000000000000000000000000002", identity); err != nil {
+		t.Fatalf("expected payer to be allowed, got %v", err)
+	}
+	if err := service.AuthorizeIdentity(ctx, "0x0000000000000000000000000000000000000002", strings.ToUpper(identity)); err != nil {
+		t.Fatalf("expected payer to be allowed for a differently cased identity, got %v", err)
+	}
+	if err := service.AuthorizeIdentity(ctx, "0x0000000000000000000000000000000000000003", identity); !errors.Is(err, ErrIdentityAccessDenied) {
+		t.Fatalf("expected ErrIdentityAccessDenied, got %v", err)
+	}
+	if err := service.AuthorizeIdentity(ctx, "", identity); !errors.Is(err, ErrIdentityAccessDenied) {
+		t.Fatalf("expected ErrIdentityAccessDenied without a session, got %v", err)
+	}
+}
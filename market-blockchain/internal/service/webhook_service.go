@@ -0,0 +1,275 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+)
+
+const (
+	webhookBatchSize   = 100
+	webhookMaxAttempts = 15
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = time.Hour
+	// webhookErrorBodyLimit is how much of a rejected response is kept in the
+	// delivery log.
+	webhookErrorBodyLimit = 512
+
+	// WebhookSignatureHeader carries "t=<unix seconds>,v1=<hex HMAC-SHA256>"
+	// over "<t>.<body>" keyed with the endpoint secret.
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookIDHeader        = "X-Webhook-Id"
+	WebhookEventHeader     = "X-Webhook-Event"
+)
+
+var (
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrWebhookEndpointInactive = errors.New("webhook endpoint is inactive")
+)
+
+// webhookBackoff is the delay before the next attempt after attempts
+// failures: 30s doubling up to 1h, which spreads 15 attempts over about ten
+// hours.
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	return backoff
+}
+
+// NewWebhookSecret returns a random signing secret for a new endpoint.
+func NewWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// SignWebhookPayload returns the signature header value for body sent at
+// timestamp. Receivers recompute v1 the same way and compare it in constant
+// time; the timestamp lets them reject old deliveries.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookService sends pending webhook deliveries, retrying failures with
+// exponential backoff, and replays past deliveries on request.
+type WebhookService struct {
+	endpoints  repository.WebhookEndpointRepository
+	deliveries repository.WebhookDeliveryRepository
+	client     *http.Client
+	interval   time.Duration
+}
+
+func NewWebhookService(
+	endpoints repository.WebhookEndpointRepository,
+	deliveries repository.WebhookDeliveryRepository,
+	timeout time.Duration,
+	interval time.Duration,
+) *WebhookService {
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+
+	return &WebhookService{
+		endpoints:  endpoints,
+		deliveries: deliveries,
+		client: &http.Client{
+			Timeout: timeout,
+			// A redirect is not an acknowledgement; the endpoint URL should be
+			// fixed instead.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		interval: interval,
+	}
+}
+
+func (s *WebhookService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	log.Printf("Webhook delivery worker started (interval: %v)", s.interval)
+
+	s.processDeliveries(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Webhook delivery worker stopped")
+			return
+		case <-ticker.C:
+			s.processDeliveries(ctx)
+		}
+	}
+}
+
+func (s *WebhookService) processDeliveries(ctx context.Context) {
+	if _, err := s.ProcessDeliveries(ctx); err != nil {
+		log.Printf("Failed to process webhook deliveries: %v", err)
+	}
+}
+
+// ProcessDeliveries attempts every delivery that is due and returns how many
+// were accepted.
+func (s *WebhookService) ProcessDeliveries(ctx context.Context) (int, error) {
+	deliveries, err := s.deliveries.ListDue(ctx, time.Now().UnixMilli(), webhookBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("list due webhook deliveries: %w", err)
+	}
+
+	endpoints := make(map[string]*domain.WebhookEndpoint)
+	delivered := 0
+	for _, delivery := range deliveries {
+		endpoint, ok := endpoints[delivery.EndpointID]
+		if !ok {
+			if endpoint, err = s.endpoints.GetByID(ctx, delivery.EndpointID); err != nil {
+				log.Printf("Failed to get webhook endpoint %s: %v", delivery.EndpointID, err)
+				continue
+			}
+			endpoints[delivery.EndpointID] = endpoint
+		}
+
+		if err := s.deliver(ctx, endpoint, delivery); err != nil {
+			log.Printf("Webhook %s of %s failed (attempt %d): %v", delivery.ID, delivery.EventType, delivery.Attempts, err)
+			continue
+		}
+		delivered++
+	}
+
+	if delivered > 0 {
+		log.Printf("Delivered %d of %d pending webhooks", delivered, len(deliveries))
+	}
+	return delivered, nil
+}
+
+// deliver makes one attempt and stores its outcome. Deliveries to an endpoint
+// that was deactivated meanwhile fail without being sent.
+func (s *WebhookService) deliver(ctx context.Context, endpoint *domain.WebhookEndpoint, delivery *domain.WebhookDelivery) error {
+	now := time.Now()
+	delivery.UpdatedAt = now.UnixMilli()
+
+	if endpoint == nil || !endpoint.Active {
+		delivery.Status = domain.WebhookDeliveryFailed
+		delivery.LastError = ErrWebhookEndpointInactive.Error()
+		if err := s.deliveries.Update(delivery); err != nil {
+			log.Printf("Failed to update webhook delivery %s: %v", delivery.ID, err)
+		}
+		return ErrWebhookEndpointInactive
+	}
+
+	statusCode, sendErr := s.send(ctx, endpoint, delivery, now)
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	if sendErr == nil {
+		delivery.Status = domain.WebhookDeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = delivery.UpdatedAt
+	} else {
+		delivery.LastError = sendErr.Error()
+		if delivery.Attempts >= webhookMaxAttempts {
+			delivery.Status = domain.WebhookDeliveryFailed
+			log.Printf("warning: giving up on webhook %s to %s after %d attempts: %v", delivery.ID, endpoint.URL, delivery.Attempts, sendErr)
+		} else {
+			delivery.NextAttemptAt = delivery.UpdatedAt + webhookBackoff(delivery.Attempts).Milliseconds()
+		}
+	}
+
+	if err := s.deliveries.Update(delivery); err != nil {
+		log.Printf("Failed to update webhook delivery %s: %v", delivery.ID, err)
+	}
+	return sendErr
+}
+
+// send POSTs the signed payload. Any 2xx response acknowledges it.
+func (s *WebhookService) send(ctx context.Context, endpoint *domain.WebhookEndpoint, delivery *domain.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "market-blockchain-webhooks/1")
+	req.Header.Set(WebhookIDHeader, delivery.ID)
+	req.Header.Set(WebhookEventHeader, string(delivery.EventType))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(endpoint.Secret, now.Unix(), body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBodyLimit))
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s: %s", resp.Status, bytes.TrimSpace(excerpt))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookErrorBodyLimit))
+	return resp.StatusCode, nil
+}
+
+// Replay queues a new delivery of the same payload to the same endpoint. The
+// original stays in the log as it was; receivers see the same event ID again.
+func (s *WebhookService) Replay(ctx context.Context, deliveryID string) (*domain.WebhookDelivery, error) {
+	original, err := s.deliveries.GetByID(ctx, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("get webhook delivery: %w", err)
+	}
+	if original == nil {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+
+	endpoint, err := s.endpoints.GetByID(ctx, original.EndpointID)
+	if err != nil {
+		return nil, fmt.Errorf("get webhook endpoint: %w", err)
+	}
+	if endpoint == nil || !endpoint.Active {
+		return nil, ErrWebhookEndpointInactive
+	}
+
+	now := time.Now().UnixMilli()
+	replay := &domain.WebhookDelivery{
+		ID:            "whd_" + uuid.New().String(),
+		EndpointID:    original.EndpointID,
+		EventID:       original.EventID,
+		EventType:     original.EventType,
+		Payload:       original.Payload,
+		Status:        domain.WebhookDeliveryPending,
+		NextAttemptAt: now,
+		ReplayOf:      original.ID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := s.deliveries.Create(replay); err != nil {
+		return nil, fmt.Errorf("create webhook replay: %w", err)
+	}
+	return replay, nil
+}
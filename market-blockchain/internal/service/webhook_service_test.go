@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"market-blockchain/internal/domain"
+)
+
+type webhookTestEndpoints map[string]*domain.WebhookEndpoint
+
+func (e webhookTestEndpoints) Create(endpoint *domain.WebhookEndpoint) error { return nil }
+func (e webhookTestEndpoints) Update(endpoint *domain.WebhookEndpoint) error { return nil }
+func (e webhookTestEndpoints) Delete(ctx context.Context, id string) error   { return nil }
+func (e webhookTestEndpoints) GetByID(ctx context.Context, id string) (*domain.WebhookEndpoint, error) {
+	return e[id], nil
+}
+func (e webhookTestEndpoints) ListAll(ctx context.Context) ([]*domain.WebhookEndpoint, error) {
+	return nil, nil
+}
+
+type webhookTestDeliveries struct {
+	due     []*domain.WebhookDelivery
+	byID    map[string]*domain.WebhookDelivery
+	created []*domain.WebhookDelivery
+	updated []*domain.WebhookDelivery
+}
+
+func (d *webhookTestDeliveries) Create(delivery *domain.WebhookDelivery) error {
+	d.created = append(d.created, delivery)
+	return nil
+}
+
+func (d *webhookTestDeliveries) Update(delivery *domain.WebhookDelivery) error {
+	copied := *delivery
+	d.updated = append(d.updated, &copied)
+	return nil
+}
+
+func (d *webhookTestDeliveries) GetByID(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	return d.byID[id], nil
+}
+
+func (d *webhookTestDeliveries) ListDue(ctx context.Context, now int64, limit int) ([]*domain.WebhookDelivery, error) {
+	return d.due, nil
+}
+
+func (d *webhookTestDeliveries) ListByEndpoint(ctx context.Context, endpointID string, status domain.WebhookDeliveryStatus, limit int) ([]*domain.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func TestWebhookServiceProcessDeliveries(t *testing.T) {
+	t.Run("signs and delivers", func(t *testing.T) {
+		var got *http.Request
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		endpoints := webhookTestEndpoints{"wh_1": {ID: "wh_1", URL: server.URL, Secret: "whsec_test", Active: true}}
+		deliveries := &webhookTestDeliveries{due: []*domain.WebhookDelivery{
+			{ID: "whd_1", EndpointID: "wh_1", EventID: "evt_1", EventType: domain.EventRenew, Payload: `{"id":"evt_1"}`, Status: domain.WebhookDeliveryPending},
+		}}
+		service := NewWebhookService(endpoints, deliveries, 0, 0)
+
+		delivered, err := service.ProcessDeliveries(context.Background())
+		if err != nil || delivered != 1 {
+			t.Fatalf("expected the delivery accepted, got %d, %v", delivered, err)
+		}
+		if string(body) != `{"id":"evt_1"}` || got.Header.Get(WebhookIDHeader) != "whd_1" || got.Header.Get(WebhookEventHeader) != "renew" {
+			t.Fatalf("unexpected request: body %s, headers %v", body, got.Header)
+		}
+		signature := got.Header.Get(WebhookSignatureHeader)
+		ts, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+		timestamp, _ := strconv.ParseInt(ts, 10, 64)
+		if signature != SignWebhookPayload("whsec_test", timestamp, body) {
+			t.Fatalf("signature %q does not verify", signature)
+		}
+		update := deliveries.updated[0]
+		if update.Status != domain.WebhookDeliverySucceeded || update.Attempts != 1 || update.LastStatusCode != http.StatusNoContent || update.DeliveredAt == 0 {
+			t.Fatalf("unexpected delivery after success: %+v", update)
+		}
+	})
+
+	t.Run("schedules a retry on rejection", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		endpoints := webhookTestEndpoints{"wh_1": {ID: "wh_1", URL: server.URL, Secret: "whsec_test", Active: true}}
+		deliveries := &webhookTestDeliveries{due: []*domain.WebhookDelivery{
+			{ID: "whd_1", EndpointID: "wh_1", EventType: domain.EventExpired, Status: domain.WebhookDeliveryPending, Attempts: 2},
+		}}
+		service := NewWebhookService(endpoints, deliveries, 0, 0)
+
+		before := time.Now().UnixMilli()
+		if delivered, _ := service.ProcessDeliveries(context.Background()); delivered != 0 {
+			t.Fatalf("expected nothing delivered, got %d", delivered)
+		}
+		update := deliveries.updated[0]
+		if update.Status != domain.WebhookDeliveryPending || update.Attempts != 3 || update.LastStatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected a pending retry, got %+v", update)
+		}
+		if update.NextAttemptAt < before+webhookBackoff(3).Milliseconds() || update.LastError == "" {
+			t.Fatalf("expected the retry backed off with the error kept, got %+v", update)
+		}
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		endpoints := webhookTestEndpoints{"wh_1": {ID: "wh_1", URL: "http://127.0.0.1:1", Secret: "whsec_test", Active: true}}
+		deliveries := &webhookTestDeliveries{due: []*domain.WebhookDelivery{
+			{ID: "whd_1", EndpointID: "wh_1", Status: domain.WebhookDeliveryPending, Attempts: webhookMaxAttempts - 1},
+		}}
+		service := NewWebhookService(endpoints, deliveries, time.Second, 0)
+
+		service.ProcessDeliveries(context.Background())
+		if update := deliveries.updated[0]; update.Status != domain.WebhookDeliveryFailed || update.LastStatusCode != 0 {
+			t.Fatalf("expected the delivery failed, got %+v", update)
+		}
+	})
+
+	t.Run("fails deliveries to inactive endpoints unsent", func(t *testing.T) {
+		endpoints := webhookTestEndpoints{"wh_1": {ID: "wh_1", URL: "http://127.0.0.1:1", Active: false}}
+		deliveries := &webhookTestDeliveries{due: []*domain.WebhookDelivery{
+			{ID: "whd_1", EndpointID: "wh_1", Status: domain.WebhookDeliveryPending},
+		}}
+		service := NewWebhookService(endpoints, deliveries, 0, 0)
+
+		service.ProcessDeliveries(context.Background())
+		if update := deliveries.updated[0]; update.Status != domain.WebhookDeliveryFailed || update.Attempts != 0 {
+			t.Fatalf("expected the delivery failed without an attempt, got %+v", update)
+		}
+	})
+}
+
+func TestWebhookServiceReplay(t *testing.T) {
+	original := &domain.WebhookDelivery{ID: "whd_1", EndpointID: "wh_1", EventID: "evt_1", EventType: domain.EventCancel, Payload: `{"id":"evt_1"}`, Status: domain.WebhookDeliveryFailed, Attempts: webhookMaxAttempts}
+	deliveries := &webhookTestDeliveries{byID: map[string]*domain.WebhookDelivery{"whd_1": original}}
+	endpoints := webhookTestEndpoints{"wh_1": {ID: "wh_1", Active: true}}
+	service := NewWebhookService(endpoints, deliveries, 0, 0)
+
+	replay, err := service.Replay(context.Background(), "whd_1")
+	if err != nil {
+		t.Fatalf("Replay returned error: %v", err)
+	}
+	if replay.ID == original.ID || replay.ReplayOf != "whd_1" || replay.Payload != original.Payload || replay.Status != domain.WebhookDeliveryPending || replay.Attempts != 0 {
+		t.Fatalf("unexpected replay: %+v", replay)
+	}
+	if len(deliveries.created) != 1 || original.Status != domain.WebhookDeliveryFailed {
+		t.Fatal("expected a new delivery with the original left untouched")
+	}
+
+	if _, err := service.Replay(context.Background(), "whd_missing"); !errors.Is(err, ErrWebhookDeliveryNotFound) {
+		t.Fatalf("expected ErrWebhookDeliveryNotFound, got %v", err)
+	}
+	endpoints["wh_1"].Active = false
+	if _, err := service.Replay(context.Background(), "whd_1"); !errors.Is(err, ErrWebhookEndpointInactive) {
+		t.Fatalf("expected ErrWebhookEndpointInactive, got %v", err)
+	}
+}
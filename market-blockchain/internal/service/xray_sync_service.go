@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+	"market-blockchain/internal/xray"
+)
+
+const (
+	xraySyncBatchSize   = 100
+	xraySyncMaxAttempts = 20
+	xraySyncBaseBackoff = 30 * time.Second
+	xraySyncMaxBackoff  = 30 * time.Minute
+)
+
+// xraySyncBackoff is the delay before the next attempt after attempts
+// failures: 30s doubling up to 30m, which spreads 20 attempts over about
+// eight hours.
+func xraySyncBackoff(attempts int) time.Duration {
+	backoff := xraySyncBaseBackoff
+	for i := 1; i < attempts && backoff < xraySyncMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > xraySyncMaxBackoff {
+		backoff = xraySyncMaxBackoff
+	}
+	return backoff
+}
+
+// xraySyncDispatcher delivers outbox jobs to Xray and stores each attempt's
+// outcome. It is shared by the lifecycle service, which makes the first
+// attempt, and the sync worker, which retries.
+type xraySyncDispatcher struct {
+	users  subscriptionXraySync
+	outbox repository.XraySyncOutboxRepository
+}
+
+func (d *xraySyncDispatcher) deliver(ctx context.Context, job *domain.XraySyncJob) error {
+	var syncErr error
+	switch job.Action {
+	case domain.XraySyncAddUser:
+		syncErr = d.addUser(ctx, job)
+	case domain.XraySyncRemoveUser:
+		syncErr = d.users.RemoveUser(ctx, job.IdentityAddress)
+	case domain.XraySyncRotateUser:
+		// AddUser treats an existing user as success, so the old credential
+		// has to go first.
+		if syncErr = d.users.RemoveUser(ctx, job.IdentityAddress); syncErr == nil {
+			syncErr = d.addUser(ctx, job)
+		}
+	default:
+		syncErr = fmt.Errorf("unknown xray sync action %q", job.Action)
+	}
+
+	now := time.Now().UnixMilli()
+	job.Attempts++
+	job.UpdatedAt = now
+	if syncErr == nil {
+		job.Status = domain.XraySyncJobSucceeded
+		job.LastError = ""
+	} else {
+		job.LastError = syncErr.Error()
+		if job.Attempts >= xraySyncMaxAttempts {
+			job.Status = domain.XraySyncJobFailed
+			log.Printf("warning: giving up on Xray %s for %s after %d attempts, leaving it to drift reconciliation: %v", job.Action, job.IdentityAddress, job.Attempts, syncErr)
+		} else {
+			job.NextAttemptAt = now + xraySyncBackoff(job.Attempts).Milliseconds()
+		}
+	}
+
+	if err := d.outbox.Update(job); err != nil {
+		log.Printf("Failed to update Xray sync job %s: %v", job.ID, err)
+	}
+	return syncErr
+}
+
+func (d *xraySyncDispatcher) addUser(ctx context.Context, job *domain.XraySyncJob) error {
+	if job.UUID == "" {
+		return fmt.Errorf("xray sync job %s has no credential", job.ID)
+	}
+	return d.users.AddUser(ctx, job.IdentityAddress, job.UUID)
+}
+
+type xraySyncFleet interface {
+	subscriptionXraySync
+	Reconcile(ctx context.Context, desired map[string]string, managed map[string]bool) (*xray.ReconcileResult, error)
+}
+
+type xrayAccessSource interface {
+	ListIdentityAccess(ctx context.Context) (map[string]string, error)
+}
+
+// XraySyncService retries undelivered outbox jobs and periodically repairs
+// drift between subscription state and the users actually on the Xray nodes,
+// such as changes lost while a node was down or made by hand.
+type XraySyncService struct {
+	dispatcher        *xraySyncDispatcher
+	fleet             xraySyncFleet
+	access            xrayAccessSource
+	retryInterval     time.Duration
+	reconcileInterval time.Duration
+}
+
+func NewXraySyncService(
+	fleet xraySyncFleet,
+	outbox repository.XraySyncOutboxRepository,
+	access xrayAccessSource,
+	retryInterval time.Duration,
+	reconcileInterval time.Duration,
+) *XraySyncService {
+	if retryInterval == 0 {
+		retryInterval = 15 * time.Second
+	}
+	if reconcileInterval == 0 {
+		reconcileInterval = 10 * time.Minute
+	}
+
+	return &XraySyncService{
+		dispatcher:        &xraySyncDispatcher{users: fleet, outbox: outbox},
+		fleet:             fleet,
+		access:            access,
+		retryInterval:     retryInterval,
+		reconcileInterval: reconcileInterval,
+	}
+}
+
+func (s *XraySyncService) Start(ctx context.Context) {
+	retryTicker := time.NewTicker(s.retryInterval)
+	defer retryTicker.Stop()
+	reconcileTicker := time.NewTicker(s.reconcileInterval)
+	defer reconcileTicker.Stop()
+
+	log.Printf("Xray sync worker started (retry interval: %v, reconcile interval: %v)", s.retryInterval, s.reconcileInterval)
+
+	s.processOutbox(ctx)
+	s.reconcile(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Xray sync worker stopped")
+			return
+		case <-retryTicker.C:
+			s.processOutbox(ctx)
+		case <-reconcileTicker.C:
+			s.reconcile(ctx)
+		}
+	}
+}
+
+func (s *XraySyncService) processOutbox(ctx context.Context) {
+	if _, err := s.ProcessOutbox(ctx); err != nil {
+		log.Printf("Failed to process Xray sync outbox: %v", err)
+	}
+}
+
+func (s *XraySyncService) reconcile(ctx context.Context) {
+	if _, err := s.Reconcile(ctx); err != nil {
+		log.Printf("Xray drift reconciliation failed: %v", err)
+	}
+}
+
+// ProcessOutbox retries every job that is due and returns how many were
+// delivered.
+func (s *XraySyncService) ProcessOutbox(ctx context.Context) (int, error) {
+	jobs, err := s.outboxDue(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, job := range jobs {
+		if err := s.dispatcher.deliver(ctx, job); err != nil {
+			log.Printf("Xray %s for %s failed (attempt %d): %v", job.Action, job.IdentityAddress, job.Attempts, err)
+			continue
+		}
+		delivered++
+	}
+
+	if delivered > 0 {
+		log.Printf("Delivered %d of %d pending Xray sync jobs", delivered, len(jobs))
+	}
+	return delivered, nil
+}
+
+func (s *XraySyncService) outboxDue(ctx context.Context) ([]*domain.XraySyncJob, error) {
+	jobs, err := s.dispatcher.outbox.ListDue(ctx, time.Now().UnixMilli(), xraySyncBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("list due xray sync jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// Reconcile makes every connected node carry exactly the identities with an
+// active subscription that is not suspended over quota, each with its stored
+// credential. Identities that never subscribed are not touched.
+func (s *XraySyncService) Reconcile(ctx context.Context) (*xray.ReconcileResult, error) {
+	access, err := s.access.ListIdentityAccess(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list identity access: %w", err)
+	}
+
+	desired := make(map[string]string)
+	managed := make(map[string]bool, len(access))
+	for identity, uuid := range access {
+		managed[identity] = true
+		if uuid != "" {
+			desired[identity] = uuid
+		}
+	}
+
+	result, err := s.fleet.Reconcile(ctx, desired, managed)
+	if err != nil {
+		return nil, fmt.Errorf("reconcile xray nodes: %w", err)
+	}
+
+	if result.Added > 0 || result.Removed > 0 || result.Failed > 0 || result.NodesSkipped > 0 {
+		log.Printf("Xray drift reconciliation: %d nodes checked, %d skipped, %d users added, %d removed, %d failed",
+			result.NodesChecked, result.NodesSkipped, result.Added, result.Removed, result.Failed)
+	}
+	return result, nil
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/xray"
+)
+
+type xraySyncTestFleet struct {
+	lifecycleTestXray
+	desired map[string]string
+	managed map[string]bool
+}
+
+func (f *xraySyncTestFleet) Reconcile(ctx context.Context, desired map[string]string, managed map[string]bool) (*xray.ReconcileResult, error) {
+	f.desired = desired
+	f.managed = managed
+	return &xray.ReconcileResult{NodesChecked: 1}, nil
+}
+
+type xraySyncTestOutbox struct {
+	lifecycleTestOutbox
+	due []*domain.XraySyncJob
+}
+
+func (o *xraySyncTestOutbox) ListDue(ctx context.Context, now int64, limit int) ([]*domain.XraySyncJob, error) {
+	return o.due, nil
+}
+
+type xraySyncTestAccess map[string]string
+
+func (a xraySyncTestAccess) ListIdentityAccess(ctx context.Context) (map[string]string, error) {
+	return a, nil
+}
+
+func TestXraySyncServiceProcessOutbox(t *testing.T) {
+	t.Run("delivers due jobs", func(t *testing.T) {
+		fleet := &xraySyncTestFleet{}
+		outbox := &xraySyncTestOutbox{due: []*domain.XraySyncJob{
+			{ID: "job_1", IdentityAddress: "identity_1", Action: domain.XraySyncAddUser, UUID: "uuid_1", Status: domain.XraySyncJobPending, Attempts: 2},
+			{ID: "job_2", IdentityAddress: "identity_2", Action: domain.XraySyncRemoveUser, Status: domain.XraySyncJobPending},
+		}}
+		service := NewXraySyncService(fleet, outbox, xraySyncTestAccess{}, 0, 0)
+
+		delivered, err := service.ProcessOutbox(context.Background())
+		if err != nil {
+			t.Fatalf("ProcessOutbox returned error: %v", err)
+		}
+		if delivered != 2 || fleet.addCalls != 1 || fleet.removeCalls != 1 {
+			t.Fatalf("expected both jobs delivered, got %d (adds %d, removes %d)", delivered, fleet.addCalls, fleet.removeCalls)
+		}
+		if outbox.updated[0].Status != domain.XraySyncJobSucceeded || outbox.updated[0].Attempts != 3 || fleet.lastUUID != "uuid_1" {
+			t.Fatalf("unexpected job after delivery: %+v", outbox.updated[0])
+		}
+	})
+
+	t.Run("rotation removes then re-adds", func(t *testing.T) {
+		fleet := &xraySyncTestFleet{}
+		outbox := &xraySyncTestOutbox{due: []*domain.XraySyncJob{
+			{ID: "job_1", IdentityAddress: "identity_1", Action: domain.XraySyncRotateUser, UUID: "uuid_new", Status: domain.XraySyncJobPending},
+		}}
+		service := NewXraySyncService(fleet, outbox, xraySyncTestAccess{}, 0, 0)
+
+		delivered, err := service.ProcessOutbox(context.Background())
+		if err != nil || delivered != 1 {
+			t.Fatalf("expected the rotation delivered, got %d, %v", delivered, err)
+		}
+		if fleet.removeCalls != 1 || fleet.addCalls != 1 || fleet.lastUUID != "uuid_new" {
+			t.Fatalf("expected old user removed and new credential added, got removes %d, adds %d, uuid %q", fleet.removeCalls, fleet.addCalls, fleet.lastUUID)
+		}
+	})
+
+	t.Run("add without credential fails", func(t *testing.T) {
+		fleet := &xraySyncTestFleet{}
+		outbox := &xraySyncTestOutbox{due: []*domain.XraySyncJob{
+			{ID: "job_1", IdentityAddress: "identity_1", Action: domain.XraySyncAddUser, Status: domain.XraySyncJobPending},
+		}}
+		service := NewXraySyncService(fleet, outbox, xraySyncTestAccess{}, 0, 0)
+
+		if _, err := service.ProcessOutbox(context.Background()); err != nil {
+			t.Fatalf("ProcessOutbox returned error: %v", err)
+		}
+		if fleet.addCalls != 0 || outbox.updated[0].LastError == "" {
+			t.Fatalf("expected the job to fail without calling Xray, got %+v", outbox.updated[0])
+		}
+	})
+
+	t.Run("failed attempt backs off", func(t *testing.T) {
+		fleet := &xraySyncTestFleet{lifecycleTestXray: lifecycleTestXray{addErr: errors.New("node down")}}
+		outbox := &xraySyncTestOutbox{due: []*domain.XraySyncJob{
+			{ID: "job_1", IdentityAddress: "identity_1", Action: domain.XraySyncAddUser, UUID: "uuid_1", Status: domain.XraySyncJobPending, Attempts: 3},
+		}}
+		service := NewXraySyncService(fleet, outbox, xraySyncTestAccess{}, 0, 0)
+
+		delivered, err := service.ProcessOutbox(context.Background())
+		if err != nil || delivered != 0 {
+			t.Fatalf("expected no deliveries and no error, got %d, %v", delivered, err)
+		}
+		job := outbox.updated[0]
+		if job.Status != domain.XraySyncJobPending || job.Attempts != 4 || job.LastError != "node down" {
+			t.Fatalf("expected job to stay pending, got %+v", job)
+		}
+		if got := job.NextAttemptAt - job.UpdatedAt; got != (4 * time.Minute).Milliseconds() {
+			t.Fatalf("expected 4m backoff after four attempts, got %dms", got)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		fleet := &xraySyncTestFleet{lifecycleTestXray: lifecycleTestXray{removeErr: errors.New("node down")}}
+		outbox := &xraySyncTestOutbox{due: []*domain.XraySyncJob{
+			{ID: "job_1", IdentityAddress: "identity_1", Action: domain.XraySyncRemoveUser, Status: domain.XraySyncJobPending, Attempts: xraySyncMaxAttempts - 1},
+		}}
+		service := NewXraySyncService(fleet, outbox, xraySyncTestAccess{}, 0, 0)
+
+		if _, err := service.ProcessOutbox(context.Background()); err != nil {
+			t.Fatalf("ProcessOutbox returned error: %v", err)
+		}
+		if outbox.updated[0].Status != domain.XraySyncJobFailed {
+			t.Fatalf("expected failed job, got %+v", outbox.updated[0])
+		}
+	})
+}
+
+func TestXraySyncBackoffIsCapped(t *testing.T) {
+	if got := xraySyncBackoff(1); got != 30*time.Second {
+		t.Fatalf("expected 30s after first attempt, got %v", got)
+	}
+	if got := xraySyncBackoff(xraySyncMaxAttempts); got != xraySyncMaxBackoff {
+		t.Fatalf("expected backoff to be capped at %v, got %v", xraySyncMaxBackoff, got)
+	}
+}
+
+func TestXraySyncServiceReconcileUsesActiveIdentities(t *testing.T) {
+	fleet := &xraySyncTestFleet{}
+	service := NewXraySyncService(fleet, &xraySyncTestOutbox{}, xraySyncTestAccess{
+		"identity_active":    "uuid_active",
+		"identity_cancelled": "",
+	}, 0, 0)
+
+	if _, err := service.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if len(fleet.desired) != 1 || fleet.desired["identity_active"] != "uuid_active" {
+		t.Fatalf("expected only the active identity to be desired, got %+v", fleet.desired)
+	}
+	if !fleet.managed["identity_active"] || len(fleet.managed) != 2 {
+		t.Fatalf("expected every subscribed identity to be managed, got %+v", fleet.managed)
+	}
+}
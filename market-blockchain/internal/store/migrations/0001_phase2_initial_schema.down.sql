@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS charges;
+DROP TABLE IF EXISTS authorizations;
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS plans;
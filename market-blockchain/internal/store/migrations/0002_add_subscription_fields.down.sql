@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_charges_authorization_id;
+DROP INDEX IF EXISTS idx_charges_subscription_id;
+
+ALTER TABLE charges
+DROP COLUMN IF EXISTS authorization_id,
+DROP COLUMN IF EXISTS subscription_id;
+
+ALTER TABLE subscriptions
+DROP COLUMN IF EXISTS current_authorization_id,
+DROP COLUMN IF EXISTS pending_plan_id;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_subscriptions_total_traffic;
+
+ALTER TABLE subscriptions
+DROP COLUMN IF EXISTS total_traffic,
+DROP COLUMN IF EXISTS downlink,
+DROP COLUMN IF EXISTS uplink;
@@ -0,0 +1,21 @@
+-- Track relayer-submitted transactions until they reach confirmation depth
+
+CREATE TABLE IF NOT EXISTS chain_transactions (
+    tx_hash TEXT PRIMARY KEY,
+    kind TEXT NOT NULL,
+    subscription_id TEXT NOT NULL DEFAULT '',
+    authorization_id TEXT NOT NULL DEFAULT '',
+    charge_record_id TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    block_number BIGINT NOT NULL DEFAULT 0,
+    block_hash TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_chain_transactions_status
+    ON chain_transactions(status);
+
+CREATE INDEX IF NOT EXISTS idx_chain_transactions_charge_record_id
+    ON chain_transactions(charge_record_id);
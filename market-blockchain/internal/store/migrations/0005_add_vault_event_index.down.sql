@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS vault_events;
+DROP TABLE IF EXISTS chain_cursors;
@@ -0,0 +1,32 @@
+-- Index VPNCreditVault logs so on-chain activity outside the relayer is visible
+
+CREATE TABLE IF NOT EXISTS chain_cursors (
+    name TEXT PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS vault_events (
+    tx_hash TEXT NOT NULL,
+    log_index BIGINT NOT NULL,
+    block_number BIGINT NOT NULL,
+    block_hash TEXT NOT NULL,
+    event_name TEXT NOT NULL,
+    payer_address TEXT NOT NULL,
+    identity_address TEXT NOT NULL,
+    charge_id TEXT NOT NULL DEFAULT '',
+    amount BIGINT NOT NULL DEFAULT 0,
+    expected_allowance BIGINT NOT NULL DEFAULT 0,
+    target_allowance BIGINT NOT NULL DEFAULT 0,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (tx_hash, log_index)
+);
+
+CREATE INDEX IF NOT EXISTS idx_vault_events_identity_address
+    ON vault_events(identity_address);
+
+CREATE INDEX IF NOT EXISTS idx_vault_events_charge_id
+    ON vault_events(charge_id);
+
+CREATE INDEX IF NOT EXISTS idx_vault_events_block_number
+    ON vault_events(block_number);
@@ -0,0 +1,22 @@
+-- Mismatches found between local state and VPNCreditVault contract state
+
+CREATE TABLE IF NOT EXISTS reconciliation_discrepancies (
+    id TEXT PRIMARY KEY,
+    run_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    subscription_id TEXT NOT NULL DEFAULT '',
+    authorization_id TEXT NOT NULL DEFAULT '',
+    charge_record_id TEXT NOT NULL DEFAULT '',
+    identity_address TEXT NOT NULL DEFAULT '',
+    payer_address TEXT NOT NULL DEFAULT '',
+    local_value TEXT NOT NULL DEFAULT '',
+    chain_value TEXT NOT NULL DEFAULT '',
+    corrected BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_discrepancies_type
+    ON reconciliation_discrepancies(type);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_discrepancies_created_at
+    ON reconciliation_discrepancies(created_at);
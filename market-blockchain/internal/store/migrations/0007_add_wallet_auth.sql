@@ -0,0 +1,21 @@
+-- Sign-In-With-Ethereum nonces and wallet sessions for the public API
+
+CREATE TABLE IF NOT EXISTS auth_nonces (
+    nonce TEXT PRIMARY KEY,
+    expires_at BIGINT NOT NULL,
+    consumed_at BIGINT NOT NULL DEFAULT 0,
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_nonces_expires_at
+    ON auth_nonces(expires_at);
+
+CREATE TABLE IF NOT EXISTS wallet_sessions (
+    token_hash TEXT PRIMARY KEY,
+    address TEXT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_sessions_address
+    ON wallet_sessions(address);
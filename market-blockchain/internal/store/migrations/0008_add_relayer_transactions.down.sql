@@ -0,0 +1 @@
+DROP TABLE IF EXISTS relayer_transactions;
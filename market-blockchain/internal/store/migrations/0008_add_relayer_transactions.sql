@@ -0,0 +1,22 @@
+-- Every broadcast from the relayer key, so nonces and stuck transactions
+-- survive a restart
+
+CREATE TABLE IF NOT EXISTS relayer_transactions (
+    tx_hash TEXT PRIMARY KEY,
+    original_tx_hash TEXT NOT NULL,
+    from_address TEXT NOT NULL,
+    nonce BIGINT NOT NULL,
+    gas_tip_cap TEXT NOT NULL,
+    gas_fee_cap TEXT NOT NULL,
+    raw_tx TEXT NOT NULL,
+    status TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_relayer_transactions_from_status
+    ON relayer_transactions(from_address, status, nonce);
+
+CREATE INDEX IF NOT EXISTS idx_relayer_transactions_original_tx_hash
+    ON relayer_transactions(original_tx_hash);
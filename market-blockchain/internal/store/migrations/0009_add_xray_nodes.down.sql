@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS xray_node_syncs;
+DROP TABLE IF EXISTS xray_node_assignments;
+DROP TABLE IF EXISTS xray_nodes;
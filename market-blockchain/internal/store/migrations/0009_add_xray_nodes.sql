@@ -0,0 +1,33 @@
+-- Registry of Xray servers, which of them each identity is provisioned on,
+-- and the latest user change sent to every node
+
+CREATE TABLE IF NOT EXISTS xray_nodes (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    api_address TEXT NOT NULL,
+    inbound_tag TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+-- An identity without rows here is provisioned on every enabled node
+CREATE TABLE IF NOT EXISTS xray_node_assignments (
+    identity_address TEXT NOT NULL,
+    node_id TEXT NOT NULL REFERENCES xray_nodes(id) ON DELETE CASCADE,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (identity_address, node_id)
+);
+
+CREATE TABLE IF NOT EXISTS xray_node_syncs (
+    node_id TEXT NOT NULL REFERENCES xray_nodes(id) ON DELETE CASCADE,
+    identity_address TEXT NOT NULL,
+    action TEXT NOT NULL,
+    status TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    updated_at BIGINT NOT NULL,
+    PRIMARY KEY (node_id, identity_address)
+);
+
+CREATE INDEX IF NOT EXISTS idx_xray_node_syncs_identity_address
+    ON xray_node_syncs(identity_address);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS xray_sync_outbox;
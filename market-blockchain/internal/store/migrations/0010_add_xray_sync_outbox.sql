@@ -0,0 +1,22 @@
+-- Outbox of Xray user changes, written in the same transaction as the
+-- subscription state change that requires them and retried until delivered
+
+CREATE TABLE IF NOT EXISTS xray_sync_outbox (
+    id TEXT PRIMARY KEY,
+    subscription_id TEXT NOT NULL,
+    identity_address TEXT NOT NULL,
+    action TEXT NOT NULL,
+    lifecycle_action TEXT NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at BIGINT NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_xray_sync_outbox_due
+    ON xray_sync_outbox(status, next_attempt_at);
+
+CREATE INDEX IF NOT EXISTS idx_xray_sync_outbox_identity_address
+    ON xray_sync_outbox(identity_address, status);
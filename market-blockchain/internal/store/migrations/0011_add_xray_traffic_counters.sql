@@ -0,0 +1,12 @@
+-- Last traffic counters read from each Xray node per user. Usage is added to
+-- subscriptions as the difference to these values, so a node restart that
+-- zeroes its counters loses nothing already counted.
+
+CREATE TABLE IF NOT EXISTS xray_traffic_counters (
+    node_id TEXT NOT NULL REFERENCES xray_nodes(id) ON DELETE CASCADE,
+    identity_address TEXT NOT NULL,
+    uplink BIGINT NOT NULL DEFAULT 0,
+    downlink BIGINT NOT NULL DEFAULT 0,
+    updated_at BIGINT NOT NULL,
+    PRIMARY KEY (node_id, identity_address)
+);
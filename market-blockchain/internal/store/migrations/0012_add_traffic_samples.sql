@@ -0,0 +1,22 @@
+-- Traffic usage per subscription and node in hourly and daily UTC buckets.
+-- Each delta is added to both granularities, so hourly rows can be pruned
+-- sooner than the daily totals.
+
+CREATE TABLE IF NOT EXISTS traffic_samples (
+    subscription_id TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    granularity TEXT NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    identity_address TEXT NOT NULL,
+    plan_id TEXT NOT NULL,
+    uplink BIGINT NOT NULL DEFAULT 0,
+    downlink BIGINT NOT NULL DEFAULT 0,
+    updated_at BIGINT NOT NULL,
+    PRIMARY KEY (subscription_id, node_id, granularity, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_traffic_samples_identity
+    ON traffic_samples(identity_address, granularity, bucket_start);
+
+CREATE INDEX IF NOT EXISTS idx_traffic_samples_bucket
+    ON traffic_samples(granularity, bucket_start);
@@ -0,0 +1,8 @@
+ALTER TABLE subscriptions
+DROP COLUMN IF EXISTS traffic_suspended,
+DROP COLUMN IF EXISTS quota_exceeded_at,
+DROP COLUMN IF EXISTS period_traffic;
+
+ALTER TABLE plans
+DROP COLUMN IF EXISTS over_quota_policy,
+DROP COLUMN IF EXISTS traffic_quota_bytes;
@@ -0,0 +1,13 @@
+-- Optional per-period traffic quota on plans, and each subscription's usage
+-- in its current period together with its quota state
+
+ALTER TABLE plans
+ADD COLUMN IF NOT EXISTS traffic_quota_bytes BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS over_quota_policy TEXT NOT NULL DEFAULT 'suspend';
+
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS period_traffic BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS quota_exceeded_at BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS traffic_suspended BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN subscriptions.period_traffic IS 'Traffic (uplink + downlink) in bytes since the current period started';
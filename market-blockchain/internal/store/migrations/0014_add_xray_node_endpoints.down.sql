@@ -0,0 +1,11 @@
+ALTER TABLE xray_nodes
+DROP COLUMN IF EXISTS reality_short_id,
+DROP COLUMN IF EXISTS reality_public_key,
+DROP COLUMN IF EXISTS flow,
+DROP COLUMN IF EXISTS fingerprint,
+DROP COLUMN IF EXISTS server_name,
+DROP COLUMN IF EXISTS transport_path,
+DROP COLUMN IF EXISTS security,
+DROP COLUMN IF EXISTS transport,
+DROP COLUMN IF EXISTS public_port,
+DROP COLUMN IF EXISTS public_host;
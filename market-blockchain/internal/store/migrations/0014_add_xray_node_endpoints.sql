@@ -0,0 +1,14 @@
+-- Public endpoint of each node's VLESS inbound, used to build client configs.
+-- Nodes with an empty public_host are not offered to clients
+
+ALTER TABLE xray_nodes
+ADD COLUMN IF NOT EXISTS public_host TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS public_port INTEGER NOT NULL DEFAULT 443,
+ADD COLUMN IF NOT EXISTS transport TEXT NOT NULL DEFAULT 'tcp',
+ADD COLUMN IF NOT EXISTS security TEXT NOT NULL DEFAULT 'tls',
+ADD COLUMN IF NOT EXISTS transport_path TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS server_name TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS fingerprint TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS flow TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS reality_public_key TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS reality_short_id TEXT NOT NULL DEFAULT '';
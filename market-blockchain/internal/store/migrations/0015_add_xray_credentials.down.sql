@@ -0,0 +1,5 @@
+ALTER TABLE xray_sync_outbox
+DROP COLUMN IF EXISTS uuid;
+
+ALTER TABLE subscriptions
+DROP COLUMN IF EXISTS xray_uuid;
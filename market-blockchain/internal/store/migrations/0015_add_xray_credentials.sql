@@ -0,0 +1,21 @@
+-- Random per-subscription VLESS credentials, replacing the UUID derived from
+-- the SHA-256 of the identity address. Existing subscriptions are backfilled
+-- with the derived value so configured clients keep working until the
+-- credential is rotated.
+
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS xray_uuid TEXT NOT NULL DEFAULT '';
+
+UPDATE subscriptions SET xray_uuid = regexp_replace(
+    left(encode(sha256(convert_to(identity_address, 'UTF8')), 'hex'), 32),
+    '^(.{8})(.{4})(.{4})(.{4})(.{12})$', '\1-\2-\3-\4-\5'
+)
+WHERE xray_uuid = '';
+
+ALTER TABLE xray_sync_outbox
+ADD COLUMN IF NOT EXISTS uuid TEXT NOT NULL DEFAULT '';
+
+UPDATE xray_sync_outbox SET uuid = subscriptions.xray_uuid
+FROM subscriptions
+WHERE xray_sync_outbox.subscription_id = subscriptions.id
+AND xray_sync_outbox.action = 'add_user' AND xray_sync_outbox.uuid = '';
@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS idx_subscriptions_past_due_retry;
+
+UPDATE subscriptions SET status = 'active' WHERE status = 'past_due';
+
+ALTER TABLE subscriptions
+DROP COLUMN IF EXISTS next_renewal_attempt_at,
+DROP COLUMN IF EXISTS last_renewal_failure,
+DROP COLUMN IF EXISTS renewal_attempts,
+DROP COLUMN IF EXISTS grace_ends_at,
+DROP COLUMN IF EXISTS past_due_at;
+
+ALTER TABLE plans
+DROP COLUMN IF EXISTS grace_access;
@@ -0,0 +1,17 @@
+-- Failed renewals put a subscription past due for a grace period instead of
+-- expiring it, with the retry schedule and the latest failure reason kept on
+-- the subscription. Plans choose whether access continues during the grace
+-- period.
+
+ALTER TABLE plans
+ADD COLUMN IF NOT EXISTS grace_access TEXT NOT NULL DEFAULT 'keep';
+
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS past_due_at BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS grace_ends_at BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS renewal_attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS last_renewal_failure TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS next_renewal_attempt_at BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_past_due_retry
+ON subscriptions (next_renewal_attempt_at) WHERE status = 'past_due';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_events_identity_history;
+DROP INDEX IF EXISTS idx_authorizations_identity_history;
+DROP INDEX IF EXISTS idx_charges_identity_history;
+DROP INDEX IF EXISTS idx_subscriptions_identity_history;
@@ -0,0 +1,13 @@
+-- Keyset pagination of an identity's history walks (created_at, id) newest first.
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_identity_history
+    ON subscriptions(identity_address, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_charges_identity_history
+    ON charges(identity_address, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_authorizations_identity_history
+    ON authorizations(identity_address, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_events_identity_history
+    ON events(identity_address, created_at DESC, id DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_events_type_created_at;
+DROP INDEX IF EXISTS idx_charges_reason_created_at;
+DROP INDEX IF EXISTS idx_charges_status_created_at;
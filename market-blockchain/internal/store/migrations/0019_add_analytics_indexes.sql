@@ -0,0 +1,11 @@
+-- Dashboard analytics aggregate completed charges and lifecycle events over
+-- created_at ranges.
+
+CREATE INDEX IF NOT EXISTS idx_charges_status_created_at
+    ON charges(status, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_charges_reason_created_at
+    ON charges(reason, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_events_type_created_at
+    ON events(type, created_at);
@@ -0,0 +1 @@
+ALTER TABLE charges DROP COLUMN IF EXISTS charge_id_encoding;
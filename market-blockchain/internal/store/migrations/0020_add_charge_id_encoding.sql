@@ -0,0 +1,7 @@
+-- Charges used to be keyed on chain by the raw bytes of their ID and are now
+-- keyed by its keccak256. Existing charges keep the key they were submitted
+-- under so retries and reconciliation still find them.
+
+ALTER TABLE charges ADD COLUMN IF NOT EXISTS charge_id_encoding TEXT NOT NULL DEFAULT 'raw';
+
+ALTER TABLE charges ALTER COLUMN charge_id_encoding SET DEFAULT 'keccak256';
@@ -0,0 +1,4 @@
+ALTER TABLE vault_events
+ALTER COLUMN amount TYPE BIGINT,
+ALTER COLUMN expected_allowance TYPE BIGINT,
+ALTER COLUMN target_allowance TYPE BIGINT;
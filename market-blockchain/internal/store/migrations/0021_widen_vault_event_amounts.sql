@@ -0,0 +1,7 @@
+-- Vault event amounts are uint256 on chain; BIGINT truncated large approvals
+-- such as an unlimited allowance.
+
+ALTER TABLE vault_events
+ALTER COLUMN amount TYPE NUMERIC(78, 0),
+ALTER COLUMN expected_allowance TYPE NUMERIC(78, 0),
+ALTER COLUMN target_allowance TYPE NUMERIC(78, 0);
@@ -0,0 +1 @@
+ALTER TABLE chain_transactions DROP COLUMN IF EXISTS mined_tx_hash;
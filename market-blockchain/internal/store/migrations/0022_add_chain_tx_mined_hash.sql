@@ -0,0 +1,5 @@
+-- The relayer replaces stuck transactions with fee-bumped ones under a new
+-- hash. Record which hash was mined so charges point at a transaction that
+-- exists on chain.
+
+ALTER TABLE chain_transactions ADD COLUMN IF NOT EXISTS mined_tx_hash TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,337 @@
+// Package migrations embeds the schema migrations and applies them to
+// PostgreSQL. NNNN_name.sql is a migration's up step and NNNN_name.down.sql
+// the optional step that reverts it. Applied versions are recorded in
+// schema_migrations together with a checksum of the up step, so a migration
+// edited after it ran is detected instead of silently diverging.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql
+var embedded embed.FS
+
+// advisoryLockID keys the session-level advisory lock held while migrating, so
+// instances starting together apply each migration once.
+const advisoryLockID int64 = 0x6d6b74626c6b6368
+
+var (
+	ErrChecksumMismatch = errors.New("applied migration has been modified")
+	ErrNoDownMigration  = errors.New("migration has no down step")
+)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status describes one migration known to the binary or recorded in the
+// database.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt int64
+	// Modified is set when the embedded up step no longer matches the
+	// checksum recorded when it was applied.
+	Modified bool
+	// Unknown is set for versions applied by a newer binary.
+	Unknown bool
+}
+
+type appliedMigration struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt int64
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New returns a migrator for the migrations embedded in the binary.
+func New(db *sql.DB) (*Migrator, error) {
+	return newMigrator(db, embedded)
+}
+
+func newMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+?)(\.down)?\.sql$`)
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse migration version %s: %w", entry.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", entry.Name(), err)
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] != "" {
+			migration.Down = string(content)
+			continue
+		}
+		if migration.Up != "" {
+			return nil, fmt.Errorf("duplicate migration version %d", version)
+		}
+		migration.Up = string(content)
+		migration.Checksum = checksum(content)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d has a down step but no up step", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Up applies every migration that has not been applied yet, each in its own
+// transaction, and returns the ones it applied. It refuses to run while an
+// applied migration has been modified.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(done); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration, migration.Up, `
+				INSERT INTO schema_migrations (version, name, checksum, applied_at)
+				VALUES ($1, $2, $3, $4)
+			`, migration.Version, migration.Name, migration.Checksum, time.Now().UnixMilli()); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps applied migrations, newest first, and returns
+// the ones it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(done); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("%w: %04d_%s", ErrNoDownMigration, migration.Version, migration.Name)
+			}
+			if err := m.apply(ctx, conn, migration, migration.Down, `
+				DELETE FROM schema_migrations WHERE version = $1
+			`, migration.Version); err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every migration the binary knows, plus any version recorded
+// in the database that it does not.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if record, ok := done[migration.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = record.appliedAt
+				status.Modified = record.checksum != migration.Checksum
+				delete(done, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+		for _, record := range done {
+			statuses = append(statuses, Status{Version: record.version, Name: record.name, Applied: true, AppliedAt: record.appliedAt, Unknown: true})
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, err
+}
+
+// withLock runs fn on a single connection holding the migration advisory
+// lock, creating schema_migrations first if needed.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockID); err != nil {
+			log.Printf("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at BIGINT NOT NULL
+		)
+	`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var record appliedMigration
+		if err := rows.Scan(&record.version, &record.name, &record.checksum, &record.appliedAt); err != nil {
+			return nil, fmt.Errorf("scan applied migration: %w", err)
+		}
+		done[record.version] = record
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	return done, nil
+}
+
+func (m *Migrator) verify(done map[int64]appliedMigration) error {
+	var modified []string
+	known := make(map[int64]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		if record, ok := done[migration.Version]; ok && record.checksum != migration.Checksum {
+			modified = append(modified, fmt.Sprintf("%04d_%s", migration.Version, migration.Name))
+		}
+	}
+	if len(modified) > 0 {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, strings.Join(modified, ", "))
+	}
+
+	for version, record := range done {
+		if !known[version] {
+			log.Printf("warning: database has migration %04d_%s applied, which this binary does not know", version, record.name)
+		}
+	}
+	return nil
+}
+
+// apply runs one migration step and its schema_migrations bookkeeping in a
+// single transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, script, record string, args ...interface{}) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("run migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("record migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testMigrations = fstest.MapFS{
+	"0001_create_plans.sql":      {Data: []byte("CREATE TABLE plans (plan_id TEXT PRIMARY KEY);")},
+	"0001_create_plans.down.sql": {Data: []byte("DROP TABLE plans;")},
+	"0002_add_plan_name.sql":     {Data: []byte("ALTER TABLE plans ADD COLUMN name TEXT;")},
+	"README.md":                  {Data: []byte("not a migration")},
+}
+
+func expectLock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).WithArgs(advisoryLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).WithArgs(advisoryLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func appliedRows(versions ...int64) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"version", "name", "checksum", "applied_at"})
+	for _, version := range versions {
+		switch version {
+		case 1:
+			rows.AddRow(int64(1), "create_plans", checksum(testMigrations["0001_create_plans.sql"].Data), int64(100))
+		case 2:
+			rows.AddRow(int64(2), "add_plan_name", checksum(testMigrations["0002_add_plan_name.sql"].Data), int64(200))
+		}
+	}
+	return rows
+}
+
+func TestEmbeddedMigrationsLoadInOrderWithDownSteps(t *testing.T) {
+	migrations, err := load(embedded)
+	if err != nil {
+		t.Fatalf("load returned error: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			t.Fatalf("expected version %d at position %d, got %d", i+1, i, migration.Version)
+		}
+		if migration.Up == "" || migration.Down == "" || migration.Checksum == "" {
+			t.Fatalf("migration %04d_%s is incomplete", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestUpAppliesPendingMigrationsUnderLock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := newMigrator(db, testMigrations)
+	if err != nil {
+		t.Fatalf("newMigrator returned error: %v", err)
+	}
+
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, name, checksum, applied_at FROM schema_migrations")).WillReturnRows(appliedRows(1))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE plans ADD COLUMN name TEXT;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations")).
+		WithArgs(int64(2), "add_plan_name", checksum(testMigrations["0002_add_plan_name.sql"].Data), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("expected only migration 2 to be applied, got %+v", applied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUpRollsBackFailedMigration(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := newMigrator(db, testMigrations)
+	if err != nil {
+		t.Fatalf("newMigrator returned error: %v", err)
+	}
+
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, name, checksum, applied_at FROM schema_migrations")).WillReturnRows(appliedRows())
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE plans")).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+	expectUnlock(mock)
+
+	applied, err := migrator.Up(context.Background())
+	if err == nil {
+		t.Fatal("expected the failed migration to be reported")
+	}
+	if len(applied) != 0 {
+		t.Fatalf("expected nothing applied, got %+v", applied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUpRefusesToRunAfterAppliedMigrationChanged(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := newMigrator(db, testMigrations)
+	if err != nil {
+		t.Fatalf("newMigrator returned error: %v", err)
+	}
+
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, name, checksum, applied_at FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "checksum", "applied_at"}).AddRow(int64(1), "create_plans", "edited", int64(100)))
+	expectUnlock(mock)
+
+	if _, err := migrator.Up(context.Background()); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDownRevertsLatestMigrationsAndNeedsDownStep(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := newMigrator(db, testMigrations)
+	if err != nil {
+		t.Fatalf("newMigrator returned error: %v", err)
+	}
+
+	// Migration 2 has no down step, so nothing is reverted.
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, name, checksum, applied_at FROM schema_migrations")).WillReturnRows(appliedRows(1, 2))
+	expectUnlock(mock)
+
+	if _, err := migrator.Down(context.Background(), 1); !errors.Is(err, ErrNoDownMigration) {
+		t.Fatalf("expected ErrNoDownMigration, got %v", err)
+	}
+
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, name, checksum, applied_at FROM schema_migrations")).WillReturnRows(appliedRows(1))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE plans;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1")).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	reverted, err := migrator.Down(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Down returned error: %v", err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 1 {
+		t.Fatalf("expected migration 1 to be reverted, got %+v", reverted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStatusReportsPendingModifiedAndUnknownMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := newMigrator(db, testMigrations)
+	if err != nil {
+		t.Fatalf("newMigrator returned error: %v", err)
+	}
+
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, name, checksum, applied_at FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "checksum", "applied_at"}).
+			AddRow(int64(1), "create_plans", "edited", int64(100)).
+			AddRow(int64(9), "from_the_future", "abc", int64(300)))
+	expectUnlock(mock)
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status returned error: %v", err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("expected 3 statuses, got %+v", statuses)
+	}
+	if !statuses[0].Applied || !statuses[0].Modified || statuses[0].AppliedAt != 100 {
+		t.Fatalf("expected migration 1 applied and modified, got %+v", statuses[0])
+	}
+	if statuses[1].Applied {
+		t.Fatalf("expected migration 2 pending, got %+v", statuses[1])
+	}
+	if statuses[2].Version != 9 || !statuses[2].Unknown {
+		t.Fatalf("expected migration 9 unknown, got %+v", statuses[2])
+	}
+}
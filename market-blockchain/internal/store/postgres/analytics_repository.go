@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+type AnalyticsRepository struct {
+	store *Store
+}
+
+func NewAnalyticsRepository(store *Store) *AnalyticsRepository {
+	return &AnalyticsRepository{store: store}
+}
+
+// analyticsBucket is the start of the UTC bucket a created_at falls in, in
+// unix millis. $1 is the granularity, which is a date_trunc field.
+const analyticsBucket = `(EXTRACT(EPOCH FROM date_trunc($1, to_timestamp(created_at / 1000.0) AT TIME ZONE 'UTC')) * 1000)::BIGINT`
+
+func (r *AnalyticsRepository) RevenueByBucket(ctx context.Context, granularity domain.AnalyticsGranularity, from, to int64) ([]*domain.RevenueBucket, error) {
+	query := `
+		SELECT ` + analyticsBucket + ` AS bucket_start, COUNT(*), COALESCE(SUM(amount), 0)
+		FROM charges
+		WHERE status = 'completed' AND created_at >= $2 AND created_at < $3
+		GROUP BY bucket_start
+		ORDER BY bucket_start
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []*domain.RevenueBucket
+	for rows.Next() {
+		bucket := &domain.RevenueBucket{}
+		if err := rows.Scan(&bucket.BucketStart, &bucket.ChargeCount, &bucket.Amount); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+func (r *AnalyticsRepository) RevenueByPlan(ctx context.Context, from, to int64) ([]*domain.PlanRevenue, error) {
+	query := `
+		SELECT plan_id, COUNT(*), COALESCE(SUM(amount), 0) AS amount
+		FROM charges
+		WHERE status = 'completed' AND created_at >= $1 AND created_at < $2
+		GROUP BY plan_id
+		ORDER BY amount DESC, plan_id
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revenue []*domain.PlanRevenue
+	for rows.Next() {
+		entry := &domain.PlanRevenue{}
+		if err := rows.Scan(&entry.PlanID, &entry.ChargeCount, &entry.Amount); err != nil {
+			return nil, err
+		}
+		revenue = append(revenue, entry)
+	}
+	return revenue, rows.Err()
+}
+
+// eventSubscriptionIDPattern matches the subscription_id lifecycle events
+// carry in their metadata.
+const eventSubscriptionIDPattern = `"subscription_id":"([^"]*)"`
+
+// SubscriptionMovements counts subscriptions, not events, that started,
+// were cancelled or expired in each bucket. A cancellation or expiry is
+// followed by a second event of the same type once Xray is synced, so each
+// subscription is counted once per type at its first event in the range.
+func (r *AnalyticsRepository) SubscriptionMovements(ctx context.Context, granularity domain.AnalyticsGranularity, from, to int64) ([]*domain.SubscriptionMovement, error) {
+	query := `
+		SELECT ` + analyticsBucket + ` AS bucket_start,
+			COUNT(*) FILTER (WHERE type = 'first_subscribe'),
+			COUNT(*) FILTER (WHERE type = 'cancel'),
+			COUNT(*) FILTER (WHERE type = 'expired')
+		FROM (
+			SELECT DISTINCT ON (type, subscription_id) type, created_at
+			FROM (
+				SELECT type, created_at, COALESCE(substring(metadata from '` + eventSubscriptionIDPattern + `'), id) AS subscription_id
+				FROM events
+				WHERE type IN ('first_subscribe', 'cancel', 'expired') AND created_at >= $2 AND created_at < $3
+			) movement_events
+			ORDER BY type, subscription_id, created_at
+		) movements
+		GROUP BY bucket_start
+		ORDER BY bucket_start
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []*domain.SubscriptionMovement
+	for rows.Next() {
+		movement := &domain.SubscriptionMovement{}
+		if err := rows.Scan(&movement.BucketStart, &movement.New, &movement.Cancelled, &movement.Expired); err != nil {
+			return nil, err
+		}
+		movements = append(movements, movement)
+	}
+	return movements, rows.Err()
+}
+
+func (r *AnalyticsRepository) RenewalOutcomes(ctx context.Context, from, to int64) (*domain.RenewalOutcomes, error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE status = 'completed'),
+			COUNT(*) FILTER (WHERE status = 'failed'),
+			COUNT(*) FILTER (WHERE status = 'pending')
+		FROM charges
+		WHERE reason IN ('renew', 'downgrade') AND created_at >= $1 AND created_at < $2
+	`
+	outcomes := &domain.RenewalOutcomes{}
+	err := r.store.DB.QueryRowContext(ctx, query, from, to).Scan(&outcomes.Completed, &outcomes.Failed, &outcomes.Pending)
+	if err != nil {
+		return nil, err
+	}
+	return outcomes, nil
+}
+
+func (r *AnalyticsRepository) MonthlyRecurringRevenue(ctx context.Context) (int64, error) {
+	query := `
+		SELECT COALESCE(ROUND(SUM(p.amount_usdc_base_units::NUMERIC * 2592000 / p.period_seconds)), 0)::BIGINT
+		FROM subscriptions s
+		JOIN plans p ON p.plan_id = s.plan_id
+		WHERE s.status = 'active' AND p.period_seconds > 0
+	`
+	var mrr int64
+	err := r.store.DB.QueryRowContext(ctx, query).Scan(&mrr)
+	return mrr, err
+}
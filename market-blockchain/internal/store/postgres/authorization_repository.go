@@ -98,3 +98,43 @@ func (r *AuthorizationRepository) GetByIdentityAndPlan(ctx context.Context, iden
 	}
 	return auth, nil
 }
+
+// ListHistory pages with a (created_at, id) keyset, like
+// SubscriptionRepository.ListHistory.
+func (r *AuthorizationRepository) ListHistory(ctx context.Context, identityAddress string, filter domain.HistoryFilter) ([]*domain.Authorization, error) {
+	query := `
+		SELECT id, identity_address, payer_address, plan_id, expected_allowance,
+			target_allowance, authorized_allowance, remaining_allowance,
+			permit_status, permit_tx_hash, permit_deadline, authorization_periods,
+			created_at, updated_at
+		FROM authorizations
+		WHERE identity_address = $1
+			AND ($2::TEXT = '' OR permit_status = $2)
+			AND ($3::BIGINT = 0 OR created_at >= $3)
+			AND ($4::BIGINT = 0 OR created_at < $4)
+			AND ($6::TEXT = '' OR (created_at, id) < ($5, $6))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $7
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, identityAddress, filter.Status, filter.From, filter.To, filter.BeforeCreatedAt, filter.BeforeID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var auths []*domain.Authorization
+	for rows.Next() {
+		auth := &domain.Authorization{}
+		err := rows.Scan(
+			&auth.ID, &auth.IdentityAddress, &auth.PayerAddress, &auth.PlanID,
+			&auth.ExpectedAllowance, &auth.TargetAllowance, &auth.AuthorizedAllowance,
+			&auth.RemainingAllowance, &auth.PermitStatus, &auth.PermitTxHash,
+			&auth.PermitDeadline, &auth.AuthorizationPeriods, &auth.CreatedAt, &auth.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, auth)
+	}
+	return auths, rows.Err()
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"market-blockchain/internal/domain"
+)
+
+type ChainCursorRepository struct {
+	store *Store
+}
+
+func NewChainCursorRepository(store *Store) *ChainCursorRepository {
+	return &ChainCursorRepository{store: store}
+}
+
+func (r *ChainCursorRepository) GetByName(ctx context.Context, name string) (*domain.ChainCursor, error) {
+	query := `
+		SELECT name, block_number, updated_at
+		FROM chain_cursors WHERE name = $1
+	`
+	cursor := &domain.ChainCursor{}
+	err := r.store.DB.QueryRowContext(ctx, query, name).Scan(
+		&cursor.Name, &cursor.BlockNumber, &cursor.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
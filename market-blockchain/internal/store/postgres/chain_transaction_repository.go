@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"market-blockchain/internal/domain"
+)
+
+type ChainTransactionRepository struct {
+	store *Store
+}
+
+func NewChainTransactionRepository(store *Store) *ChainTransactionRepository {
+	return &ChainTransactionRepository{store: store}
+}
+
+func (r *ChainTransactionRepository) Create(tx *domain.ChainTransaction) error {
+	query := `
+		INSERT INTO chain_transactions (
+			tx_hash, kind, subscription_id, authorization_id, charge_record_id,
+			status, mined_tx_hash, block_number, block_hash, error, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err := r.store.DB.Exec(query,
+		tx.TxHash, tx.Kind, tx.SubscriptionID, tx.AuthorizationID, tx.ChargeRecordID,
+		tx.Status, tx.MinedTxHash, tx.BlockNumber, tx.BlockHash, tx.Error, tx.CreatedAt, tx.UpdatedAt,
+	)
+	return err
+}
+
+func (r *ChainTransactionRepository) Update(tx *domain.ChainTransaction) error {
+	query := `
+		UPDATE chain_transactions SET
+			status = $2, mined_tx_hash = $3, block_number = $4, block_hash = $5,
+			error = $6, updated_at = $7
+		WHERE tx_hash = $1
+	`
+	_, err := r.store.DB.Exec(query,
+		tx.TxHash, tx.Status, tx.MinedTxHash, tx.BlockNumber, tx.BlockHash, tx.Error, tx.UpdatedAt,
+	)
+	return err
+}
+
+func (r *ChainTransactionRepository) GetByHash(ctx context.Context, txHash string) (*domain.ChainTransaction, error) {
+	query := `
+		SELECT tx_hash, kind, subscription_id, authorization_id, charge_record_id,
+			status, mined_tx_hash, block_number, block_hash, error, created_at, updated_at
+		FROM chain_transactions WHERE tx_hash = $1
+	`
+	tx := &domain.ChainTransaction{}
+	err := r.store.DB.QueryRowContext(ctx, query, txHash).Scan(
+		&tx.TxHash, &tx.Kind, &tx.SubscriptionID, &tx.AuthorizationID, &tx.ChargeRecordID,
+		&tx.Status, &tx.MinedTxHash, &tx.BlockNumber, &tx.BlockHash, &tx.Error, &tx.CreatedAt, &tx.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (r *ChainTransactionRepository) ListUnfinalized(ctx context.Context) ([]*domain.ChainTransaction, error) {
+	query := `
+		SELECT tx_hash, kind, subscription_id, authorization_id, charge_record_id,
+			status, mined_tx_hash, block_number, block_hash, error, created_at, updated_at
+		FROM chain_transactions
+		WHERE status IN ('pending', 'mined')
+		ORDER BY created_at ASC
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []*domain.ChainTransaction
+	for rows.Next() {
+		tx := &domain.ChainTransaction{}
+		err := rows.Scan(
+			&tx.TxHash, &tx.Kind, &tx.SubscriptionID, &tx.AuthorizationID, &tx.ChargeRecordID,
+			&tx.Status, &tx.MinedTxHash, &tx.BlockNumber, &tx.BlockHash, &tx.Error, &tx.CreatedAt, &tx.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, rows.Err()
+}
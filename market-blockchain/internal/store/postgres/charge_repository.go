@@ -18,13 +18,13 @@ func (r *ChargeRepository) Create(charge *domain.Charge) error {
 	query := `
 		INSERT INTO charges (
 			id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,
-			amount, status, tx_hash, reason, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			amount, status, tx_hash, reason, created_at, updated_at, charge_id_encoding
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 	`
 	_, err := r.store.DB.Exec(query,
 		charge.ID, charge.ChargeID, charge.SubscriptionID, charge.AuthorizationID,
 		charge.IdentityAddress, charge.PayerAddress, charge.PlanID, charge.Amount,
-		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt,
+		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt, charge.IDEncoding(),
 	)
 	return err
 }
@@ -44,14 +44,14 @@ func (r *ChargeRepository) Update(charge *domain.Charge) error {
 func (r *ChargeRepository) GetByID(ctx context.Context, id string) (*domain.Charge, error) {
 	query := `
 		SELECT id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,
-			amount, status, tx_hash, reason, created_at, updated_at
+			amount, status, tx_hash, reason, created_at, updated_at, charge_id_encoding
 		FROM charges WHERE id = $1
 	`
 	charge := &domain.Charge{}
 	err := r.store.DB.QueryRowContext(ctx, query, id).Scan(
 		&charge.ID, &charge.ChargeID, &charge.SubscriptionID, &charge.AuthorizationID,
 		&charge.IdentityAddress, &charge.PayerAddress, &charge.PlanID, &charge.Amount,
-		&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt,
+		&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt, &charge.ChargeIDEncoding,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -65,14 +65,14 @@ func (r *ChargeRepository) GetByID(ctx context.Context, id string) (*domain.Char
 func (r *ChargeRepository) GetByChargeID(ctx context.Context, chargeID string) (*domain.Charge, error) {
 	query := `
 		SELECT id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,
-			amount, status, tx_hash, reason, created_at, updated_at
+			amount, status, tx_hash, reason, created_at, updated_at, charge_id_encoding
 		FROM charges WHERE charge_id = $1
 	`
 	charge := &domain.Charge{}
 	err := r.store.DB.QueryRowContext(ctx, query, chargeID).Scan(
 		&charge.ID, &charge.ChargeID, &charge.SubscriptionID, &charge.AuthorizationID,
 		&charge.IdentityAddress, &charge.PayerAddress, &charge.PlanID, &charge.Amount,
-		&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt,
+		&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt, &charge.ChargeIDEncoding,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -86,7 +86,7 @@ func (r *ChargeRepository) GetByChargeID(ctx context.Context, chargeID string) (
 func (r *ChargeRepository) ListByIdentity(ctx context.Context, identityAddress string) ([]*domain.Charge, error) {
 	query := `
 		SELECT id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,
-			amount, status, tx_hash, reason, created_at, updated_at
+			amount, status, tx_hash, reason, created_at, updated_at, charge_id_encoding
 		FROM charges WHERE identity_address = $1
 		ORDER BY created_at DESC
 	`
@@ -102,7 +102,44 @@ func (r *ChargeRepository) ListByIdentity(ctx context.Context, identityAddress s
 		err := rows.Scan(
 			&charge.ID, &charge.ChargeID, &charge.SubscriptionID, &charge.AuthorizationID,
 			&charge.IdentityAddress, &charge.PayerAddress, &charge.PlanID, &charge.Amount,
-			&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt,
+			&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt, &charge.ChargeIDEncoding,
+		)
+		if err != nil {
+			return nil, err
+		}
+		charges = append(charges, charge)
+	}
+	return charges, rows.Err()
+}
+
+// ListHistory pages with a (created_at, id) keyset, like
+// SubscriptionRepository.ListHistory.
+func (r *ChargeRepository) ListHistory(ctx context.Context, identityAddress string, filter domain.HistoryFilter) ([]*domain.Charge, error) {
+	query := `
+		SELECT id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,
+			amount, status, tx_hash, reason, created_at, updated_at, charge_id_encoding
+		FROM charges
+		WHERE identity_address = $1
+			AND ($2::TEXT = '' OR status = $2)
+			AND ($3::BIGINT = 0 OR created_at >= $3)
+			AND ($4::BIGINT = 0 OR created_at < $4)
+			AND ($6::TEXT = '' OR (created_at, id) < ($5, $6))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $7
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, identityAddress, filter.Status, filter.From, filter.To, filter.BeforeCreatedAt, filter.BeforeID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var charges []*domain.Charge
+	for rows.Next() {
+		charge := &domain.Charge{}
+		err := rows.Scan(
+			&charge.ID, &charge.ChargeID, &charge.SubscriptionID, &charge.AuthorizationID,
+			&charge.IdentityAddress, &charge.PayerAddress, &charge.PlanID, &charge.Amount,
+			&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt, &charge.ChargeIDEncoding,
 		)
 		if err != nil {
 			return nil, err
@@ -115,7 +152,7 @@ func (r *ChargeRepository) ListByIdentity(ctx context.Context, identityAddress s
 func (r *ChargeRepository) ListByStatusAndDateRange(ctx context.Context, status string, fromTime, toTime int64) ([]*domain.Charge, error) {
 	query := `
 		SELECT id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,
-			amount, status, tx_hash, reason, created_at, updated_at
+			amount, status, tx_hash, reason, created_at, updated_at, charge_id_encoding
 		FROM charges
 		WHERE status = $1 AND created_at >= $2 AND created_at <= $3
 		ORDER BY created_at DESC
@@ -132,7 +169,7 @@ func (r *ChargeRepository) ListByStatusAndDateRange(ctx context.Context, status
 		err := rows.Scan(
 			&charge.ID, &charge.ChargeID, &charge.SubscriptionID, &charge.AuthorizationID,
 			&charge.IdentityAddress, &charge.PayerAddress, &charge.PlanID, &charge.Amount,
-			&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt,
+			&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt, &charge.ChargeIDEncoding,
 		)
 		if err != nil {
 			return nil, err
@@ -145,7 +182,7 @@ func (r *ChargeRepository) ListByStatusAndDateRange(ctx context.Context, status
 func (r *ChargeRepository) ListByDateRange(ctx context.Context, fromTime, toTime int64) ([]*domain.Charge, error) {
 	query := `
 		SELECT id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,
-			amount, status, tx_hash, reason, created_at, updated_at
+			amount, status, tx_hash, reason, created_at, updated_at, charge_id_encoding
 		FROM charges
 		WHERE created_at >= $1 AND created_at <= $2
 		ORDER BY created_at DESC
@@ -162,7 +199,7 @@ func (r *ChargeRepository) ListByDateRange(ctx context.Context, fromTime, toTime
 		err := rows.Scan(
 			&charge.ID, &charge.ChargeID, &charge.SubscriptionID, &charge.AuthorizationID,
 			&charge.IdentityAddress, &charge.PayerAddress, &charge.PlanID, &charge.Amount,
-			&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt,
+			&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt, &charge.ChargeIDEncoding,
 		)
 		if err != nil {
 			return nil, err
@@ -175,7 +212,7 @@ func (r *ChargeRepository) ListByDateRange(ctx context.Context, fromTime, toTime
 func (r *ChargeRepository) ListBySubscription(ctx context.Context, subscriptionID string) ([]*domain.Charge, error) {
 	query := `
 		SELECT id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,
-			amount, status, tx_hash, reason, created_at, updated_at
+			amount, status, tx_hash, reason, created_at, updated_at, charge_id_encoding
 		FROM charges
 		WHERE subscription_id = $1
 		ORDER BY created_at DESC
@@ -192,7 +229,7 @@ func (r *ChargeRepository) ListBySubscription(ctx context.Context, subscriptionI
 		err := rows.Scan(
 			&charge.ID, &charge.ChargeID, &charge.SubscriptionID, &charge.AuthorizationID,
 			&charge.IdentityAddress, &charge.PayerAddress, &charge.PlanID, &charge.Amount,
-			&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt,
+			&charge.Status, &charge.TxHash, &charge.Reason, &charge.CreatedAt, &charge.UpdatedAt, &charge.ChargeIDEncoding,
 		)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+type DiscrepancyRepository struct {
+	store *Store
+}
+
+func NewDiscrepancyRepository(store *Store) *DiscrepancyRepository {
+	return &DiscrepancyRepository{store: store}
+}
+
+func (r *DiscrepancyRepository) Create(discrepancy *domain.Discrepancy) error {
+	query := `
+		INSERT INTO reconciliation_discrepancies (
+			id, run_id, type, subscription_id, authorization_id, charge_record_id,
+			identity_address, payer_address, local_value, chain_value, corrected, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err := r.store.DB.Exec(query,
+		discrepancy.ID, discrepancy.RunID, discrepancy.Type, discrepancy.SubscriptionID,
+		discrepancy.AuthorizationID, discrepancy.ChargeRecordID, discrepancy.IdentityAddress,
+		discrepancy.PayerAddress, discrepancy.LocalValue, discrepancy.ChainValue,
+		discrepancy.Corrected, discrepancy.CreatedAt,
+	)
+	return err
+}
+
+// List returns discrepancies newest first. An empty discrepancyType matches
+// every type.
+func (r *DiscrepancyRepository) List(ctx context.Context, discrepancyType string, limit, offset int) ([]*domain.Discrepancy, error) {
+	query := `
+		SELECT id, run_id, type, subscription_id, authorization_id, charge_record_id,
+			identity_address, payer_address, local_value, chain_value, corrected, created_at
+		FROM reconciliation_discrepancies
+		WHERE $1 = '' OR type = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, discrepancyType, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var discrepancies []*domain.Discrepancy
+	for rows.Next() {
+		discrepancy := &domain.Discrepancy{}
+		err := rows.Scan(
+			&discrepancy.ID, &discrepancy.RunID, &discrepancy.Type, &discrepancy.SubscriptionID,
+			&discrepancy.AuthorizationID, &discrepancy.ChargeRecordID, &discrepancy.IdentityAddress,
+			&discrepancy.PayerAddress, &discrepancy.LocalValue, &discrepancy.ChainValue,
+			&discrepancy.Corrected, &discrepancy.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, discrepancy)
+	}
+	return discrepancies, rows.Err()
+}
+
+func (r *DiscrepancyRepository) Count(ctx context.Context, discrepancyType string) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM reconciliation_discrepancies
+		WHERE $1 = '' OR type = $1
+	`
+	var count int
+	err := r.store.DB.QueryRowContext(ctx, query, discrepancyType).Scan(&count)
+	return count, err
+}
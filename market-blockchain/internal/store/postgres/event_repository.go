@@ -56,6 +56,42 @@ func (r *EventRepository) ListByIdentity(ctx context.Context, identityAddress st
 	return events, rows.Err()
 }
 
+// ListHistory pages with a (created_at, id) keyset, like
+// SubscriptionRepository.ListHistory.
+func (r *EventRepository) ListHistory(ctx context.Context, identityAddress string, filter domain.HistoryFilter) ([]*domain.Event, error) {
+	query := `
+		SELECT id, identity_address, payer_address, plan_id, charge_id,
+			type, description, metadata, created_at
+		FROM events
+		WHERE identity_address = $1
+			AND ($2::TEXT = '' OR type = $2)
+			AND ($3::BIGINT = 0 OR created_at >= $3)
+			AND ($4::BIGINT = 0 OR created_at < $4)
+			AND ($6::TEXT = '' OR (created_at, id) < ($5, $6))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $7
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, identityAddress, filter.Status, filter.From, filter.To, filter.BeforeCreatedAt, filter.BeforeID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.Event
+	for rows.Next() {
+		event := &domain.Event{}
+		err := rows.Scan(
+			&event.ID, &event.IdentityAddress, &event.PayerAddress, &event.PlanID,
+			&event.ChargeID, &event.Type, &event.Description, &event.Metadata, &event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
 func (r *EventRepository) ListByTypeAndDateRange(ctx context.Context, eventType string, fromTime, toTime int64) ([]*domain.Event, error) {
 	query := `
 		SELECT id, identity_address, payer_address, plan_id, charge_id,
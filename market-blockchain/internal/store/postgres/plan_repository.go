@@ -19,13 +19,14 @@ func (r *PlanRepository) Create(plan *domain.Plan) error {
 		INSERT INTO plans (
 			plan_id, name, description, period_seconds, amount_usdc_base_units,
 			amount_usdc_display, authorization_periods, total_authorization_amount,
-			active, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			traffic_quota_bytes, over_quota_policy, grace_access, active, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 	`
 	_, err := r.store.DB.Exec(query,
 		plan.PlanID, plan.Name, plan.Description, plan.PeriodSeconds,
 		plan.AmountUSDCBaseUnits, plan.AmountUSDCDisplay, plan.AuthorizationPeriods,
-		plan.TotalAuthorizationAmount, plan.Active, plan.CreatedAt, plan.UpdatedAt,
+		plan.TotalAuthorizationAmount, plan.TrafficQuotaBytes, plan.OverQuotaPolicy,
+		plan.GraceAccess, plan.Active, plan.CreatedAt, plan.UpdatedAt,
 	)
 	return err
 }
@@ -36,13 +37,15 @@ func (r *PlanRepository) Update(plan *domain.Plan) error {
 			name = $2, description = $3, period_seconds = $4,
 			amount_usdc_base_units = $5, amount_usdc_display = $6,
 			authorization_periods = $7, total_authorization_amount = $8,
-			active = $9, updated_at = $10
+			traffic_quota_bytes = $9, over_quota_policy = $10, grace_access = $11,
+			active = $12, updated_at = $13
 		WHERE plan_id = $1
 	`
 	_, err := r.store.DB.Exec(query,
 		plan.PlanID, plan.Name, plan.Description, plan.PeriodSeconds,
 		plan.AmountUSDCBaseUnits, plan.AmountUSDCDisplay, plan.AuthorizationPeriods,
-		plan.TotalAuthorizationAmount, plan.Active, plan.UpdatedAt,
+		plan.TotalAuthorizationAmount, plan.TrafficQuotaBytes, plan.OverQuotaPolicy,
+		plan.GraceAccess, plan.Active, plan.UpdatedAt,
 	)
 	return err
 }
@@ -51,14 +54,15 @@ func (r *PlanRepository) GetByPlanID(ctx context.Context, planID string) (*domai
 	query := `
 		SELECT plan_id, name, description, period_seconds, amount_usdc_base_units,
 			amount_usdc_display, authorization_periods, total_authorization_amount,
-			active, created_at, updated_at
+			traffic_quota_bytes, over_quota_policy, grace_access, active, created_at, updated_at
 		FROM plans WHERE plan_id = $1
 	`
 	plan := &domain.Plan{}
 	err := r.store.DB.QueryRowContext(ctx, query, planID).Scan(
 		&plan.PlanID, &plan.Name, &plan.Description, &plan.PeriodSeconds,
 		&plan.AmountUSDCBaseUnits, &plan.AmountUSDCDisplay, &plan.AuthorizationPeriods,
-		&plan.TotalAuthorizationAmount, &plan.Active, &plan.CreatedAt, &plan.UpdatedAt,
+		&plan.TotalAuthorizationAmount, &plan.TrafficQuotaBytes, &plan.OverQuotaPolicy,
+		&plan.GraceAccess, &plan.Active, &plan.CreatedAt, &plan.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -73,7 +77,7 @@ func (r *PlanRepository) ListActive(ctx context.Context) ([]*domain.Plan, error)
 	query := `
 		SELECT plan_id, name, description, period_seconds, amount_usdc_base_units,
 			amount_usdc_display, authorization_periods, total_authorization_amount,
-			active, created_at, updated_at
+			traffic_quota_bytes, over_quota_policy, grace_access, active, created_at, updated_at
 		FROM plans WHERE active = true
 	`
 	rows, err := r.store.DB.QueryContext(ctx, query)
@@ -88,7 +92,8 @@ func (r *PlanRepository) ListActive(ctx context.Context) ([]*domain.Plan, error)
 		err := rows.Scan(
 			&plan.PlanID, &plan.Name, &plan.Description, &plan.PeriodSeconds,
 			&plan.AmountUSDCBaseUnits, &plan.AmountUSDCDisplay, &plan.AuthorizationPeriods,
-			&plan.TotalAuthorizationAmount, &plan.Active, &plan.CreatedAt, &plan.UpdatedAt,
+			&plan.TotalAuthorizationAmount, &plan.TrafficQuotaBytes, &plan.OverQuotaPolicy,
+			&plan.GraceAccess, &plan.Active, &plan.CreatedAt, &plan.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -102,7 +107,7 @@ func (r *PlanRepository) ListAll(ctx context.Context) ([]*domain.Plan, error) {
 	query := `
 		SELECT plan_id, name, description, period_seconds, amount_usdc_base_units,
 			amount_usdc_display, authorization_periods, total_authorization_amount,
-			active, created_at, updated_at
+			traffic_quota_bytes, over_quota_policy, grace_access, active, created_at, updated_at
 		FROM plans
 		ORDER BY created_at DESC
 	`
@@ -118,7 +123,8 @@ func (r *PlanRepository) ListAll(ctx context.Context) ([]*domain.Plan, error) {
 		err := rows.Scan(
 			&plan.PlanID, &plan.Name, &plan.Description, &plan.PeriodSeconds,
 			&plan.AmountUSDCBaseUnits, &plan.AmountUSDCDisplay, &plan.AuthorizationPeriods,
-			&plan.TotalAuthorizationAmount, &plan.Active, &plan.CreatedAt, &plan.UpdatedAt,
+			&plan.TotalAuthorizationAmount, &plan.TrafficQuotaBytes, &plan.OverQuotaPolicy,
+			&plan.GraceAccess, &plan.Active, &plan.CreatedAt, &plan.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
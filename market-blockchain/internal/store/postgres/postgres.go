@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"market-blockchain/internal/domain"
 )
 
@@ -31,13 +32,14 @@ func (s *Store) CreateInitialState(ctx context.Context, subscription *domain.Sub
 			id, identity_address, payer_address, plan_id, status, auto_renew,
 			current_period_start, current_period_end, next_plan_id, pending_plan_id,
 			current_authorization_id, last_charge_id, last_charge_at, source,
-			uplink, downlink, total_traffic, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+			uplink, downlink, total_traffic, xray_uuid, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
 	`,
 		subscription.ID, subscription.IdentityAddress, subscription.PayerAddress, subscription.PlanID, subscription.Status,
 		subscription.AutoRenew, subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
 		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID, subscription.LastChargeAt,
-		subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.CreatedAt, subscription.UpdatedAt,
+		subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.XrayUUID,
+		subscription.CreatedAt, subscription.UpdatedAt,
 	); err != nil {
 		return err
 	}
@@ -61,12 +63,12 @@ func (s *Store) CreateInitialState(ctx context.Context, subscription *domain.Sub
 	if _, err = tx.ExecContext(ctx, `
 		INSERT INTO charges (
 			id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,
-			amount, status, tx_hash, reason, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			amount, status, tx_hash, reason, created_at, updated_at, charge_id_encoding
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 	`,
 		charge.ID, charge.ChargeID, charge.SubscriptionID, charge.AuthorizationID,
 		charge.IdentityAddress, charge.PayerAddress, charge.PlanID, charge.Amount,
-		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt,
+		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt, charge.IDEncoding(),
 	); err != nil {
 		return err
 	}
@@ -83,6 +85,10 @@ func (s *Store) CreateInitialState(ctx context.Context, subscription *domain.Sub
 		return err
 	}
 
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return err
 	}
@@ -90,7 +96,7 @@ func (s *Store) CreateInitialState(ctx context.Context, subscription *domain.Sub
 	return nil
 }
 
-func (s *Store) CompleteFirstCharge(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
+func (s *Store) CompleteFirstCharge(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event, xraySync *domain.XraySyncJob) error {
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -132,14 +138,13 @@ func (s *Store) CompleteFirstCharge(ctx context.Context, subscription *domain.Su
 			payer_address = $2, plan_id = $3, status = $4, auto_renew = $5,
 			current_period_start = $6, current_period_end = $7, next_plan_id = $8,
 			pending_plan_id = $9, current_authorization_id = $10, last_charge_id = $11,
-			last_charge_at = $12, source = $13, uplink = $14, downlink = $15,
-			total_traffic = $16, updated_at = $17
+			last_charge_at = $12, source = $13, updated_at = $14
 		WHERE id = $1
 	`,
 		subscription.ID, subscription.PayerAddress, subscription.PlanID, subscription.Status, subscription.AutoRenew,
 		subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
 		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID,
-		subscription.LastChargeAt, subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.UpdatedAt,
+		subscription.LastChargeAt, subscription.Source, subscription.UpdatedAt,
 	); err != nil {
 		return err
 	}
@@ -156,6 +161,14 @@ func (s *Store) CompleteFirstCharge(ctx context.Context, subscription *domain.Su
 		return err
 	}
 
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = enqueueXraySync(ctx, tx, xraySync); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return err
 	}
@@ -163,7 +176,9 @@ func (s *Store) CompleteFirstCharge(ctx context.Context, subscription *domain.Su
 	return nil
 }
 
-func (s *Store) CompleteRenewal(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
+// CompleteRenewal persists a successful renewal charge. The renewal starts a
+// new period, so the period usage and any quota suspension are cleared.
+func (s *Store) CompleteRenewal(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event, xraySync *domain.XraySyncJob) error {
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -176,14 +191,11 @@ func (s *Store) CompleteRenewal(ctx context.Context, subscription *domain.Subscr
 	}()
 
 	if _, err = tx.ExecContext(ctx, `
-		INSERT INTO charges (
-			id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,
-			amount, status, tx_hash, reason, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		UPDATE charges SET
+			status = $2, tx_hash = $3, updated_at = $4
+		WHERE id = $1
 	`,
-		charge.ID, charge.ChargeID, charge.SubscriptionID, charge.AuthorizationID,
-		charge.IdentityAddress, charge.PayerAddress, charge.PlanID, charge.Amount,
-		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt,
+		charge.ID, charge.Status, charge.TxHash, charge.UpdatedAt,
 	); err != nil {
 		return err
 	}
@@ -193,14 +205,16 @@ func (s *Store) CompleteRenewal(ctx context.Context, subscription *domain.Subscr
 			payer_address = $2, plan_id = $3, status = $4, auto_renew = $5,
 			current_period_start = $6, current_period_end = $7, next_plan_id = $8,
 			pending_plan_id = $9, current_authorization_id = $10, last_charge_id = $11,
-			last_charge_at = $12, source = $13, uplink = $14, downlink = $15,
-			total_traffic = $16, updated_at = $17
+			last_charge_at = $12, source = $13, updated_at = $14,
+			period_traffic = 0, quota_exceeded_at = 0, traffic_suspended = FALSE,
+			past_due_at = 0, grace_ends_at = 0, renewal_attempts = 0,
+			last_renewal_failure = '', next_renewal_attempt_at = 0
 		WHERE id = $1
 	`,
 		subscription.ID, subscription.PayerAddress, subscription.PlanID, subscription.Status, subscription.AutoRenew,
 		subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
 		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID,
-		subscription.LastChargeAt, subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.UpdatedAt,
+		subscription.LastChargeAt, subscription.Source, subscription.UpdatedAt,
 	); err != nil {
 		return err
 	}
@@ -232,6 +246,14 @@ func (s *Store) CompleteRenewal(ctx context.Context, subscription *domain.Subscr
 		return err
 	}
 
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = enqueueXraySync(ctx, tx, xraySync); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return err
 	}
@@ -239,7 +261,7 @@ func (s *Store) CompleteRenewal(ctx context.Context, subscription *domain.Subscr
 	return nil
 }
 
-func (s *Store) ApplyImmediateUpgrade(ctx context.Context, subscription *domain.Subscription, charge *domain.Charge, event *domain.Event) error {
+func (s *Store) ApplyImmediateUpgrade(ctx context.Context, subscription *domain.Subscription, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -252,14 +274,11 @@ func (s *Store) ApplyImmediateUpgrade(ctx context.Context, subscription *domain.
 	}()
 
 	if _, err = tx.ExecContext(ctx, `
-		INSERT INTO charges (
-			id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,
-			amount, status, tx_hash, reason, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		UPDATE charges SET
+			status = $2, tx_hash = $3, updated_at = $4
+		WHERE id = $1
 	`,
-		charge.ID, charge.ChargeID, charge.SubscriptionID, charge.AuthorizationID,
-		charge.IdentityAddress, charge.PayerAddress, charge.PlanID, charge.Amount,
-		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt,
+		charge.ID, charge.Status, charge.TxHash, charge.UpdatedAt,
 	); err != nil {
 		return err
 	}
@@ -269,14 +288,28 @@ func (s *Store) ApplyImmediateUpgrade(ctx context.Context, subscription *domain.
 			payer_address = $2, plan_id = $3, status = $4, auto_renew = $5,
 			current_period_start = $6, current_period_end = $7, next_plan_id = $8,
 			pending_plan_id = $9, current_authorization_id = $10, last_charge_id = $11,
-			last_charge_at = $12, source = $13, uplink = $14, downlink = $15,
-			total_traffic = $16, updated_at = $17
+			last_charge_at = $12, source = $13, updated_at = $14
 		WHERE id = $1
 	`,
 		subscription.ID, subscription.PayerAddress, subscription.PlanID, subscription.Status, subscription.AutoRenew,
 		subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
 		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID,
-		subscription.LastChargeAt, subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.UpdatedAt,
+		subscription.LastChargeAt, subscription.Source, subscription.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE authorizations SET
+			payer_address = $2, expected_allowance = $3, target_allowance = $4,
+			authorized_allowance = $5, remaining_allowance = $6, permit_status = $7,
+			permit_tx_hash = $8, permit_deadline = $9, authorization_periods = $10,
+			updated_at = $11
+		WHERE id = $1
+	`,
+		authorization.ID, authorization.PayerAddress, authorization.ExpectedAllowance, authorization.TargetAllowance,
+		authorization.AuthorizedAllowance, authorization.RemainingAllowance, authorization.PermitStatus,
+		authorization.PermitTxHash, authorization.PermitDeadline, authorization.AuthorizationPeriods, authorization.UpdatedAt,
 	); err != nil {
 		return err
 	}
@@ -293,6 +326,10 @@ func (s *Store) ApplyImmediateUpgrade(ctx context.Context, subscription *domain.
 		return err
 	}
 
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return err
 	}
@@ -317,14 +354,60 @@ func (s *Store) ScheduleDowngrade(ctx context.Context, subscription *domain.Subs
 			payer_address = $2, plan_id = $3, status = $4, auto_renew = $5,
 			current_period_start = $6, current_period_end = $7, next_plan_id = $8,
 			pending_plan_id = $9, current_authorization_id = $10, last_charge_id = $11,
-			last_charge_at = $12, source = $13, uplink = $14, downlink = $15,
-			total_traffic = $16, updated_at = $17
+			last_charge_at = $12, source = $13, updated_at = $14
 		WHERE id = $1
 	`,
 		subscription.ID, subscription.PayerAddress, subscription.PlanID, subscription.Status, subscription.AutoRenew,
 		subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
 		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID,
-		subscription.LastChargeAt, subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.UpdatedAt,
+		subscription.LastChargeAt, subscription.Source, subscription.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO events (
+			id, identity_address, payer_address, plan_id, charge_id,
+			type, description, metadata, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`,
+		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
+		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FailCharge persists a charge that failed on chain together with its
+// charge_failed event and webhook deliveries.
+func (s *Store) FailCharge(ctx context.Context, charge *domain.Charge, event *domain.Event) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE charges SET
+			status = $2, tx_hash = $3, updated_at = $4
+		WHERE id = $1
+	`,
+		charge.ID, charge.Status, charge.TxHash, charge.UpdatedAt,
 	); err != nil {
 		return err
 	}
@@ -341,6 +424,507 @@ func (s *Store) ScheduleDowngrade(ctx context.Context, subscription *domain.Subs
 		return err
 	}
 
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SettleCharge persists a confirmed charge and the allowance it used without
+// touching the subscription, together with its event and webhook deliveries.
+func (s *Store) SettleCharge(ctx context.Context, authorization *domain.Authorization, charge *domain.Charge, event *domain.Event) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE charges SET
+			status = $2, tx_hash = $3, updated_at = $4
+		WHERE id = $1
+	`,
+		charge.ID, charge.Status, charge.TxHash, charge.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE authorizations SET
+			payer_address = $2, expected_allowance = $3, target_allowance = $4,
+			authorized_allowance = $5, remaining_allowance = $6, permit_status = $7,
+			permit_tx_hash = $8, permit_deadline = $9, authorization_periods = $10,
+			updated_at = $11
+		WHERE id = $1
+	`,
+		authorization.ID, authorization.PayerAddress, authorization.ExpectedAllowance, authorization.TargetAllowance,
+		authorization.AuthorizedAllowance, authorization.RemainingAllowance, authorization.PermitStatus,
+		authorization.PermitTxHash, authorization.PermitDeadline, authorization.AuthorizationPeriods, authorization.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO events (
+			id, identity_address, payer_address, plan_id, charge_id,
+			type, description, metadata, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`,
+		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
+		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeAuthorization persists an authorization revoked on chain together
+// with its authorization_revoked event and webhook deliveries.
+func (s *Store) RevokeAuthorization(ctx context.Context, authorization *domain.Authorization, event *domain.Event) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE authorizations SET
+			payer_address = $2, expected_allowance = $3, target_allowance = $4,
+			authorized_allowance = $5, remaining_allowance = $6, permit_status = $7,
+			permit_tx_hash = $8, permit_deadline = $9, authorization_periods = $10,
+			updated_at = $11
+		WHERE id = $1
+	`,
+		authorization.ID, authorization.PayerAddress, authorization.ExpectedAllowance, authorization.TargetAllowance,
+		authorization.AuthorizedAllowance, authorization.RemainingAllowance, authorization.PermitStatus,
+		authorization.PermitTxHash, authorization.PermitDeadline, authorization.AuthorizationPeriods, authorization.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO events (
+			id, identity_address, payer_address, plan_id, charge_id,
+			type, description, metadata, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`,
+		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
+		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// EndSubscription persists a cancellation or expiry together with its event
+// and the Xray removal it requires.
+func (s *Store) EndSubscription(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE subscriptions SET
+			payer_address = $2, plan_id = $3, status = $4, auto_renew = $5,
+			current_period_start = $6, current_period_end = $7, next_plan_id = $8,
+			pending_plan_id = $9, current_authorization_id = $10, last_charge_id = $11,
+			last_charge_at = $12, source = $13, updated_at = $14
+		WHERE id = $1
+	`,
+		subscription.ID, subscription.PayerAddress, subscription.PlanID, subscription.Status, subscription.AutoRenew,
+		subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
+		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID,
+		subscription.LastChargeAt, subscription.Source, subscription.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO events (
+			id, identity_address, payer_address, plan_id, charge_id,
+			type, description, metadata, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`,
+		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
+		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = enqueueXraySync(ctx, tx, xraySync); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// enqueueXraySync adds job to the Xray sync outbox. Pending jobs for the same
+// identity are superseded first, so a retried add can never land after the
+// removal that followed it. A nil job is a no-op.
+func enqueueXraySync(ctx context.Context, tx *sql.Tx, job *domain.XraySyncJob) error {
+	if job == nil {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE xray_sync_outbox SET status = $2, updated_at = $3
+		WHERE identity_address = $1 AND status = $4
+	`,
+		job.IdentityAddress, domain.XraySyncJobSuperseded, job.CreatedAt, domain.XraySyncJobPending,
+	); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO xray_sync_outbox (
+			id, subscription_id, identity_address, action, uuid, lifecycle_action, status,
+			attempts, next_attempt_at, last_error, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`,
+		job.ID, job.SubscriptionID, job.IdentityAddress, job.Action, job.UUID, job.LifecycleAction, job.Status,
+		job.Attempts, job.NextAttemptAt, job.LastError, job.CreatedAt, job.UpdatedAt,
+	)
+	return err
+}
+
+// enqueueWebhookDeliveries adds a pending delivery of event for every active
+// webhook endpoint that subscribes to its type.
+func enqueueWebhookDeliveries(ctx context.Context, tx *sql.Tx, event *domain.Event) error {
+	if !domain.IsWebhookEventType(event.Type) {
+		return nil
+	}
+
+	payload, err := json.Marshal(domain.NewWebhookPayload(event))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (
+			id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at, updated_at
+		)
+		SELECT 'whd_' || $1 || '_' || id, id, $1, $2, $3, $4, 0, $5, $5, $5
+		FROM webhook_endpoints
+		WHERE active AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+	`,
+		event.ID, event.Type, string(payload), domain.WebhookDeliveryPending, event.CreatedAt,
+	)
+	return err
+}
+
+// ApplyTrafficUsage adds one identity's traffic delta to its subscription and
+// its time-series samples, and advances the node counters it was computed from
+// in the same transaction, so a crash in between can neither drop nor double
+// count usage. An empty subscriptionID only advances the counters.
+func (s *Store) ApplyTrafficUsage(ctx context.Context, subscriptionID string, uplink, downlink int64, counters []*domain.XrayTrafficCounter, samples []*domain.TrafficSample) (periodTraffic int64, err error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if subscriptionID != "" && uplink+downlink > 0 {
+		if err = tx.QueryRowContext(ctx, `
+			UPDATE subscriptions SET
+				uplink = uplink + $2, downlink = downlink + $3,
+				total_traffic = total_traffic + $2 + $3,
+				period_traffic = period_traffic + $2 + $3
+			WHERE id = $1
+			RETURNING period_traffic
+		`, subscriptionID, uplink, downlink).Scan(&periodTraffic); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, sample := range samples {
+		if _, err = tx.ExecContext(ctx, `
+			INSERT INTO traffic_samples (
+				subscription_id, node_id, granularity, bucket_start,
+				identity_address, plan_id, uplink, downlink, updated_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (subscription_id, node_id, granularity, bucket_start) DO UPDATE SET
+				uplink = traffic_samples.uplink + EXCLUDED.uplink,
+				downlink = traffic_samples.downlink + EXCLUDED.downlink,
+				updated_at = EXCLUDED.updated_at
+		`,
+			sample.SubscriptionID, sample.NodeID, sample.Granularity, sample.BucketStart,
+			sample.IdentityAddress, sample.PlanID, sample.Uplink, sample.Downlink, sample.UpdatedAt,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, counter := range counters {
+		if _, err = tx.ExecContext(ctx, `
+			INSERT INTO xray_traffic_counters (node_id, identity_address, uplink, downlink, updated_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (node_id, identity_address) DO UPDATE SET
+				uplink = EXCLUDED.uplink, downlink = EXCLUDED.downlink, updated_at = EXCLUDED.updated_at
+		`,
+			counter.NodeID, counter.IdentityAddress, counter.Uplink, counter.Downlink, counter.UpdatedAt,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return periodTraffic, nil
+}
+
+// RotateXrayCredential stores a subscription's new Xray credential together
+// with the rotation event and the outbox job that replaces it on the nodes.
+func (s *Store) RotateXrayCredential(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE subscriptions SET xray_uuid = $2, updated_at = $3
+		WHERE id = $1
+	`,
+		subscription.ID, subscription.XrayUUID, subscription.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO events (
+			id, identity_address, payer_address, plan_id, charge_id,
+			type, description, metadata, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`,
+		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
+		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = enqueueXraySync(ctx, tx, xraySync); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateQuotaState persists a subscription crossing its traffic quota together
+// with the quota event and, when access is suspended, the Xray removal.
+func (s *Store) UpdateQuotaState(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE subscriptions SET
+			quota_exceeded_at = $2, traffic_suspended = $3, updated_at = $4
+		WHERE id = $1
+	`,
+		subscription.ID, subscription.QuotaExceededAt, subscription.TrafficSuspended, subscription.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO events (
+			id, identity_address, payer_address, plan_id, charge_id,
+			type, description, metadata, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`,
+		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
+		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = enqueueXraySync(ctx, tx, xraySync); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateDunningState persists a failed renewal attempt of a past due
+// subscription together with its event and, when the plan suspends access
+// during the grace period, the Xray removal.
+func (s *Store) UpdateDunningState(ctx context.Context, subscription *domain.Subscription, event *domain.Event, xraySync *domain.XraySyncJob) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE subscriptions SET
+			status = $2, past_due_at = $3, grace_ends_at = $4, renewal_attempts = $5,
+			last_renewal_failure = $6, next_renewal_attempt_at = $7, updated_at = $8
+		WHERE id = $1
+	`,
+		subscription.ID, subscription.Status, subscription.PastDueAt, subscription.GraceEndsAt, subscription.RenewalAttempts,
+		subscription.LastRenewalFailure, subscription.NextRenewalAttemptAt, subscription.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO events (
+			id, identity_address, payer_address, plan_id, charge_id,
+			type, description, metadata, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`,
+		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
+		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if err = enqueueWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = enqueueXraySync(ctx, tx, xraySync); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IndexVaultEvents stores a batch of vault logs and advances the cursor in
+// the same transaction, so a crash never skips or half-applies a block range.
+// Logs already indexed are ignored, which makes replaying a range harmless.
+func (s *Store) IndexVaultEvents(ctx context.Context, events []*domain.VaultEvent, cursor *domain.ChainCursor) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, event := range events {
+		if _, err = tx.ExecContext(ctx, `
+			INSERT INTO vault_events (
+				tx_hash, log_index, block_number, block_hash, event_name,
+				payer_address, identity_address, charge_id, amount,
+				expected_allowance, target_allowance, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			ON CONFLICT (tx_hash, log_index) DO NOTHING
+		`,
+			event.TxHash, event.LogIndex, event.BlockNumber, event.BlockHash, event.Name,
+			event.PayerAddress, event.IdentityAddress, event.ChargeID, event.Amount,
+			event.ExpectedAllowance, event.TargetAllowance, event.CreatedAt,
+		); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO chain_cursors (name, block_number, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET
+			block_number = EXCLUDED.block_number, updated_at = EXCLUDED.updated_at
+	`,
+		cursor.Name, cursor.BlockNumber, cursor.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return err
 	}
@@ -2,6 +2,8 @@ package postgres
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/json"
 	"regexp"
 	"testing"
 
@@ -28,7 +30,8 @@ func TestStoreCreateInitialStateCommitsAllRecords(t *testing.T) {
 		subscription.ID, subscription.IdentityAddress, subscription.PayerAddress, subscription.PlanID, subscription.Status,
 		subscription.AutoRenew, subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
 		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID, subscription.LastChargeAt,
-		subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.CreatedAt, subscription.UpdatedAt,
+		subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.XrayUUID,
+		subscription.CreatedAt, subscription.UpdatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO authorizations (")).WithArgs(
 		authorization.ID, authorization.IdentityAddress, authorization.PayerAddress, authorization.PlanID,
@@ -39,12 +42,13 @@ func TestStoreCreateInitialStateCommitsAllRecords(t *testing.T) {
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO charges (")).WithArgs(
 		charge.ID, charge.ChargeID, charge.SubscriptionID, charge.AuthorizationID,
 		charge.IdentityAddress, charge.PayerAddress, charge.PlanID, charge.Amount,
-		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt,
+		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt, domain.ChargeIDKeccak256,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WithArgs(
 		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
 		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
 	mock.ExpectCommit()
 
 	if err := store.CreateInitialState(context.Background(), subscription, authorization, charge, event); err != nil {
@@ -78,7 +82,8 @@ func TestStoreCreateInitialStateCanBeReadBackViaRepositories(t *testing.T) {
 		subscription.ID, subscription.IdentityAddress, subscription.PayerAddress, subscription.PlanID, subscription.Status,
 		subscription.AutoRenew, subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
 		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID, subscription.LastChargeAt,
-		subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.CreatedAt, subscription.UpdatedAt,
+		subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.XrayUUID,
+		subscription.CreatedAt, subscription.UpdatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO authorizations (")).WithArgs(
 		authorization.ID, authorization.IdentityAddress, authorization.PayerAddress, authorization.PlanID,
@@ -89,26 +94,27 @@ func TestStoreCreateInitialStateCanBeReadBackViaRepositories(t *testing.T) {
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO charges (")).WithArgs(
 		charge.ID, charge.ChargeID, charge.SubscriptionID, charge.AuthorizationID,
 		charge.IdentityAddress, charge.PayerAddress, charge.PlanID, charge.Amount,
-		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt,
+		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt, domain.ChargeIDKeccak256,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WithArgs(
 		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
 		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
 	mock.ExpectCommit()
 
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, identity_address, payer_address, plan_id, status, auto_renew,")).
 		WithArgs(subscription.ID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "identity_address", "payer_address", "plan_id", "status", "auto_renew", "current_period_start", "current_period_end", "next_plan_id", "pending_plan_id", "current_authorization_id", "last_charge_id", "last_charge_at", "source", "uplink", "downlink", "total_traffic", "created_at", "updated_at"}).
-			AddRow(subscription.ID, subscription.IdentityAddress, subscription.PayerAddress, subscription.PlanID, subscription.Status, subscription.AutoRenew, subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID, subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID, subscription.LastChargeAt, subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.CreatedAt, subscription.UpdatedAt))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "identity_address", "payer_address", "plan_id", "status", "auto_renew", "current_period_start", "current_period_end", "next_plan_id", "pending_plan_id", "current_authorization_id", "last_charge_id", "last_charge_at", "source", "uplink", "downlink", "total_traffic", "period_traffic", "quota_exceeded_at", "traffic_suspended", "xray_uuid", "past_due_at", "grace_ends_at", "renewal_attempts", "last_renewal_failure", "next_renewal_attempt_at", "created_at", "updated_at"}).
+			AddRow(subscription.ID, subscription.IdentityAddress, subscription.PayerAddress, subscription.PlanID, subscription.Status, subscription.AutoRenew, subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID, subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID, subscription.LastChargeAt, subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.PeriodTraffic, subscription.QuotaExceededAt, subscription.TrafficSuspended, subscription.XrayUUID, subscription.PastDueAt, subscription.GraceEndsAt, subscription.RenewalAttempts, subscription.LastRenewalFailure, subscription.NextRenewalAttemptAt, subscription.CreatedAt, subscription.UpdatedAt))
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, identity_address, payer_address, plan_id, expected_allowance,")).
 		WithArgs(authorization.ID).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "identity_address", "payer_address", "plan_id", "expected_allowance", "target_allowance", "authorized_allowance", "remaining_allowance", "permit_status", "permit_tx_hash", "permit_deadline", "authorization_periods", "created_at", "updated_at"}).
 			AddRow(authorization.ID, authorization.IdentityAddress, authorization.PayerAddress, authorization.PlanID, authorization.ExpectedAllowance, authorization.TargetAllowance, authorization.AuthorizedAllowance, authorization.RemainingAllowance, authorization.PermitStatus, authorization.PermitTxHash, authorization.PermitDeadline, authorization.AuthorizationPeriods, authorization.CreatedAt, authorization.UpdatedAt))
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, charge_id, subscription_id, authorization_id, identity_address, payer_address, plan_id,")).
 		WithArgs(charge.ID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "charge_id", "subscription_id", "authorization_id", "identity_address", "payer_address", "plan_id", "amount", "status", "tx_hash", "reason", "created_at", "updated_at"}).
-			AddRow(charge.ID, charge.ChargeID, charge.SubscriptionID, charge.AuthorizationID, charge.IdentityAddress, charge.PayerAddress, charge.PlanID, charge.Amount, charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "charge_id", "subscription_id", "authorization_id", "identity_address", "payer_address", "plan_id", "amount", "status", "tx_hash", "reason", "created_at", "updated_at", "charge_id_encoding"}).
+			AddRow(charge.ID, charge.ChargeID, charge.SubscriptionID, charge.AuthorizationID, charge.IdentityAddress, charge.PayerAddress, charge.PlanID, charge.Amount, charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt, charge.IDEncoding()))
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, identity_address, payer_address, plan_id, charge_id,")).
 		WithArgs("%\"subscription_id\":\"sub_1\"%", 10).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "identity_address", "payer_address", "plan_id", "charge_id", "type", "description", "metadata", "created_at"}).
@@ -212,6 +218,7 @@ func TestStoreCompleteFirstChargeCommitsAllUpdates(t *testing.T) {
 	authorization := &domain.Authorization{ID: "auth_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", ExpectedAllowance: 10, TargetAllowance: 20, AuthorizedAllowance: 20, RemainingAllowance: 10, PermitStatus: domain.AuthorizationCompleted, PermitTxHash: "0xpermit", PermitDeadline: 6, AuthorizationPeriods: 2, CreatedAt: 4, UpdatedAt: 5}
 	charge := &domain.Charge{ID: "charge_record_1", ChargeID: "charge_1", SubscriptionID: "sub_1", AuthorizationID: "auth_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", Amount: 10, Status: domain.ChargeCompleted, TxHash: "0xcharge", Reason: "first_subscribe", CreatedAt: 4, UpdatedAt: 5}
 	event := &domain.Event{ID: "evt_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", ChargeID: "charge_1", Type: domain.EventChargeSuccess, Description: "activated", Metadata: "{}", CreatedAt: 4}
+	job := &domain.XraySyncJob{ID: "xsync_1", SubscriptionID: "sub_1", IdentityAddress: "identity_1", Action: domain.XraySyncAddUser, LifecycleAction: "activate_first_charge", Status: domain.XraySyncJobPending, NextAttemptAt: 5, CreatedAt: 5, UpdatedAt: 5}
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta("UPDATE authorizations SET")).WithArgs(
@@ -226,15 +233,17 @@ func TestStoreCompleteFirstChargeCommitsAllUpdates(t *testing.T) {
 		subscription.ID, subscription.PayerAddress, subscription.PlanID, subscription.Status, subscription.AutoRenew,
 		subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
 		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID,
-		subscription.LastChargeAt, subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.UpdatedAt,
+		subscription.LastChargeAt, subscription.Source, subscription.UpdatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WithArgs(
 		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
 		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
+	expectXraySyncEnqueued(mock, job)
 	mock.ExpectCommit()
 
-	if err := store.CompleteFirstCharge(context.Background(), subscription, authorization, charge, event); err != nil {
+	if err := store.CompleteFirstCharge(context.Background(), subscription, authorization, charge, event, job); err != nil {
 		t.Fatalf("CompleteFirstCharge returned error: %v", err)
 	}
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -260,7 +269,7 @@ func TestStoreCompleteFirstChargeRollsBackOnFailure(t *testing.T) {
 	mock.ExpectExec(regexp.QuoteMeta("UPDATE charges SET")).WillReturnError(assertiveErr{})
 	mock.ExpectRollback()
 
-	err = store.CompleteFirstCharge(context.Background(), subscription, authorization, charge, event)
+	err = store.CompleteFirstCharge(context.Background(), subscription, authorization, charge, event, nil)
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -279,20 +288,18 @@ func TestStoreCompleteRenewalCommitsAllUpdates(t *testing.T) {
 	store := New(db)
 	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", Status: domain.SubscriptionActive, AutoRenew: true, CurrentPeriodStart: 100, CurrentPeriodEnd: 200, NextPlanID: "", PendingPlanID: "", CurrentAuthorizationID: "auth_1", LastChargeID: "charge_2", LastChargeAt: 300, Source: domain.SubscriptionSourceRenewal, Uplink: 0, Downlink: 0, TotalTraffic: 0, CreatedAt: 4, UpdatedAt: 5}
 	authorization := &domain.Authorization{ID: "auth_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", ExpectedAllowance: 10, TargetAllowance: 20, AuthorizedAllowance: 20, RemainingAllowance: 10, PermitStatus: domain.AuthorizationCompleted, PermitTxHash: "0xpermit", PermitDeadline: 6, AuthorizationPeriods: 2, CreatedAt: 4, UpdatedAt: 5}
-	charge := &domain.Charge{ID: "charge_record_1", ChargeID: "charge_2", SubscriptionID: "sub_1", AuthorizationID: "auth_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", Amount: 10, Status: domain.ChargePending, TxHash: "", Reason: "renew", CreatedAt: 4, UpdatedAt: 5}
+	charge := &domain.Charge{ID: "charge_record_1", ChargeID: "charge_2", SubscriptionID: "sub_1", AuthorizationID: "auth_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", Amount: 10, Status: domain.ChargeCompleted, TxHash: "0xrenew", Reason: "renew", CreatedAt: 4, UpdatedAt: 5}
 	event := &domain.Event{ID: "evt_renew", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", ChargeID: "charge_2", Type: domain.EventRenew, Description: "renewed", Metadata: "{}", CreatedAt: 4}
 
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO charges (")).WithArgs(
-		charge.ID, charge.ChargeID, charge.SubscriptionID, charge.AuthorizationID,
-		charge.IdentityAddress, charge.PayerAddress, charge.PlanID, charge.Amount,
-		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt,
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE charges SET")).WithArgs(
+		charge.ID, charge.Status, charge.TxHash, charge.UpdatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("UPDATE subscriptions SET")).WithArgs(
 		subscription.ID, subscription.PayerAddress, subscription.PlanID, subscription.Status, subscription.AutoRenew,
 		subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
 		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID,
-		subscription.LastChargeAt, subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.UpdatedAt,
+		subscription.LastChargeAt, subscription.Source, subscription.UpdatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("UPDATE authorizations SET")).WithArgs(
 		authorization.ID, authorization.PayerAddress, authorization.ExpectedAllowance, authorization.TargetAllowance,
@@ -303,9 +310,10 @@ func TestStoreCompleteRenewalCommitsAllUpdates(t *testing.T) {
 		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
 		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
 	mock.ExpectCommit()
 
-	if err := store.CompleteRenewal(context.Background(), subscription, authorization, charge, event); err != nil {
+	if err := store.CompleteRenewal(context.Background(), subscription, authorization, charge, event, nil); err != nil {
 		t.Fatalf("CompleteRenewal returned error: %v", err)
 	}
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -327,12 +335,12 @@ func TestStoreCompleteRenewalRollsBackOnFailure(t *testing.T) {
 	event := &domain.Event{ID: "evt_renew"}
 
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO charges (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE charges SET")).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("UPDATE subscriptions SET")).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("UPDATE authorizations SET")).WillReturnError(assertiveErr{})
 	mock.ExpectRollback()
 
-	err = store.CompleteRenewal(context.Background(), subscription, authorization, charge, event)
+	err = store.CompleteRenewal(context.Background(), subscription, authorization, charge, event, nil)
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -350,28 +358,33 @@ func TestStoreApplyImmediateUpgradeCommitsAllUpdates(t *testing.T) {
 
 	store := New(db)
 	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_new", Status: domain.SubscriptionActive, AutoRenew: true, CurrentPeriodStart: 100, CurrentPeriodEnd: 200, NextPlanID: "", PendingPlanID: "", CurrentAuthorizationID: "auth_1", LastChargeID: "charge_1", LastChargeAt: 300, Source: domain.SubscriptionSourceUpgrade, Uplink: 0, Downlink: 0, TotalTraffic: 0, CreatedAt: 4, UpdatedAt: 5}
-	charge := &domain.Charge{ID: "chg_1", ChargeID: "chg_1", SubscriptionID: "sub_1", AuthorizationID: "auth_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_new", Amount: 50, Status: domain.ChargePending, TxHash: "", Reason: "upgrade", CreatedAt: 4, UpdatedAt: 5}
+	authorization := &domain.Authorization{ID: "auth_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_old", ExpectedAllowance: 10, TargetAllowance: 20, AuthorizedAllowance: 20, RemainingAllowance: 950, PermitStatus: domain.AuthorizationCompleted, PermitTxHash: "0xpermit", PermitDeadline: 6, AuthorizationPeriods: 2, CreatedAt: 4, UpdatedAt: 5}
+	charge := &domain.Charge{ID: "chg_1", ChargeID: "upgrade_sub_1_plan_new_200", SubscriptionID: "sub_1", AuthorizationID: "auth_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_new", Amount: 50, Status: domain.ChargeCompleted, TxHash: "0xupgrade", Reason: "upgrade", CreatedAt: 4, UpdatedAt: 5}
 	event := &domain.Event{ID: "evt_upgrade", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_new", ChargeID: "chg_1", Type: domain.EventUpgrade, Description: "upgraded", Metadata: "{}", CreatedAt: 4}
 
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO charges (")).WithArgs(
-		charge.ID, charge.ChargeID, charge.SubscriptionID, charge.AuthorizationID,
-		charge.IdentityAddress, charge.PayerAddress, charge.PlanID, charge.Amount,
-		charge.Status, charge.TxHash, charge.Reason, charge.CreatedAt, charge.UpdatedAt,
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE charges SET")).WithArgs(
+		charge.ID, charge.Status, charge.TxHash, charge.UpdatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("UPDATE subscriptions SET")).WithArgs(
 		subscription.ID, subscription.PayerAddress, subscription.PlanID, subscription.Status, subscription.AutoRenew,
 		subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
 		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID,
-		subscription.LastChargeAt, subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.UpdatedAt,
+		subscription.LastChargeAt, subscription.Source, subscription.UpdatedAt,
+	).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE authorizations SET")).WithArgs(
+		authorization.ID, authorization.PayerAddress, authorization.ExpectedAllowance, authorization.TargetAllowance,
+		authorization.AuthorizedAllowance, authorization.RemainingAllowance, authorization.PermitStatus,
+		authorization.PermitTxHash, authorization.PermitDeadline, authorization.AuthorizationPeriods, authorization.UpdatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WithArgs(
 		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
 		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
 	mock.ExpectCommit()
 
-	if err := store.ApplyImmediateUpgrade(context.Background(), subscription, charge, event); err != nil {
+	if err := store.ApplyImmediateUpgrade(context.Background(), subscription, authorization, charge, event); err != nil {
 		t.Fatalf("ApplyImmediateUpgrade returned error: %v", err)
 	}
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -388,15 +401,16 @@ func TestStoreApplyImmediateUpgradeRollsBackOnFailure(t *testing.T) {
 
 	store := New(db)
 	subscription := &domain.Subscription{ID: "sub_1"}
+	authorization := &domain.Authorization{ID: "auth_1"}
 	charge := &domain.Charge{ID: "chg_1"}
 	event := &domain.Event{ID: "evt_upgrade"}
 
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO charges (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE charges SET")).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("UPDATE subscriptions SET")).WillReturnError(assertiveErr{})
 	mock.ExpectRollback()
 
-	err = store.ApplyImmediateUpgrade(context.Background(), subscription, charge, event)
+	err = store.ApplyImmediateUpgrade(context.Background(), subscription, authorization, charge, event)
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -421,12 +435,13 @@ func TestStoreScheduleDowngradeCommitsAllUpdates(t *testing.T) {
 		subscription.ID, subscription.PayerAddress, subscription.PlanID, subscription.Status, subscription.AutoRenew,
 		subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, subscription.NextPlanID,
 		subscription.PendingPlanID, subscription.CurrentAuthorizationID, subscription.LastChargeID,
-		subscription.LastChargeAt, subscription.Source, subscription.Uplink, subscription.Downlink, subscription.TotalTraffic, subscription.UpdatedAt,
+		subscription.LastChargeAt, subscription.Source, subscription.UpdatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WithArgs(
 		event.ID, event.IdentityAddress, event.PayerAddress, event.PlanID,
 		event.ChargeID, event.Type, event.Description, event.Metadata, event.CreatedAt,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
 	mock.ExpectCommit()
 
 	if err := store.ScheduleDowngrade(context.Background(), subscription, event); err != nil {
@@ -462,6 +477,652 @@ func TestStoreScheduleDowngradeRollsBackOnFailure(t *testing.T) {
 	}
 }
 
+func TestStoreIndexVaultEventsCommitsEventsAndCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	events := []*domain.VaultEvent{
+		{TxHash: "0xtx1", LogIndex: 0, BlockNumber: 10, BlockHash: "0xblock10", Name: domain.VaultEventChargeAuthorized, PayerAddress: "payer_1", IdentityAddress: "identity_1", Amount: "0", ExpectedAllowance: "0", TargetAllowance: "115792089237316195423570985008687907853269984665640564039457584007913129639935", CreatedAt: 4},
+		{TxHash: "0xtx2", LogIndex: 3, BlockNumber: 12, BlockHash: "0xblock12", Name: domain.VaultEventIdentityCharged, PayerAddress: "payer_1", IdentityAddress: "identity_1", ChargeID: "0xcharge", Amount: "1000", ExpectedAllowance: "0", TargetAllowance: "0", CreatedAt: 4},
+	}
+	cursor := &domain.ChainCursor{Name: "vault_events", BlockNumber: 20, UpdatedAt: 5}
+
+	mock.ExpectBegin()
+	for _, event := range events {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO vault_events (")).WithArgs(
+			event.TxHash, event.LogIndex, event.BlockNumber, event.BlockHash, event.Name,
+			event.PayerAddress, event.IdentityAddress, event.ChargeID, event.Amount,
+			event.ExpectedAllowance, event.TargetAllowance, event.CreatedAt,
+		).WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO chain_cursors (")).WithArgs(
+		cursor.Name, cursor.BlockNumber, cursor.UpdatedAt,
+	).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := store.IndexVaultEvents(context.Background(), events, cursor); err != nil {
+		t.Fatalf("IndexVaultEvents returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStoreIndexVaultEventsRollsBackOnFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	events := []*domain.VaultEvent{{TxHash: "0xtx1"}}
+	cursor := &domain.ChainCursor{Name: "vault_events", BlockNumber: 20}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO vault_events (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO chain_cursors (")).WillReturnError(assertiveErr{})
+	mock.ExpectRollback()
+
+	err = store.IndexVaultEvents(context.Background(), events, cursor)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
 type assertiveErr struct{}
 
 func (assertiveErr) Error() string { return "insert authorization failed" }
+
+func TestXrayNodeRepositoryScansPublicEndpoint(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewXrayNodeRepository(New(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM xray_nodes WHERE id = $1")).WithArgs("node_a").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "name", "api_address", "inbound_tag", "enabled",
+			"public_host", "public_port", "transport", "security", "transport_path",
+			"server_name", "fingerprint", "flow", "reality_public_key", "reality_short_id",
+			"created_at", "updated_at",
+		}).AddRow(
+			"node_a", "hk-1", "10.0.0.2:10085", "vless-in", true,
+			"hk1.example.com", 443, "tcp", "reality", "",
+			"www.microsoft.com", "chrome", "xtls-rprx-vision", "pubkey", "ab12",
+			int64(1), int64(2),
+		))
+
+	node, err := repo.GetByID(context.Background(), "node_a")
+	if err != nil {
+		t.Fatalf("GetByID returned error: %v", err)
+	}
+	want := domain.XrayNodeEndpoint{
+		Host: "hk1.example.com", Port: 443, Transport: domain.XrayTransportTCP, Security: domain.XraySecurityReality,
+		ServerName: "www.microsoft.com", Fingerprint: "chrome", Flow: "xtls-rprx-vision", RealityPublicKey: "pubkey", RealityShortID: "ab12",
+	}
+	if node == nil || node.Endpoint != want || node.InboundTag != "vless-in" || node.UpdatedAt != 2 {
+		t.Fatalf("unexpected node: %+v", node)
+	}
+}
+
+func TestXrayNodeAssignmentReplaceSwapsNodesInOneTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewXrayNodeAssignmentRepository(New(db))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM xray_node_assignments WHERE identity_address = $1")).WithArgs("identity_1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO xray_node_assignments (")).WithArgs("identity_1", "node_a", int64(7)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO xray_node_assignments (")).WithArgs("identity_1", "node_b", int64(7)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := repo.Replace(context.Background(), "identity_1", []string{"node_a", "node_b"}, 7); err != nil {
+		t.Fatalf("Replace returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestXrayNodeAssignmentReplaceRollsBackOnFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewXrayNodeAssignmentRepository(New(db))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM xray_node_assignments WHERE identity_address = $1")).WithArgs("identity_1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO xray_node_assignments (")).WithArgs("identity_1", "missing", int64(7)).WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+
+	if err := repo.Replace(context.Background(), "identity_1", []string{"missing"}, 7); err == nil {
+		t.Fatal("expected Replace to fail")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func expectXraySyncEnqueued(mock sqlmock.Sqlmock, job *domain.XraySyncJob) {
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE xray_sync_outbox SET status = $2")).WithArgs(
+		job.IdentityAddress, domain.XraySyncJobSuperseded, job.CreatedAt, domain.XraySyncJobPending,
+	).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO xray_sync_outbox (")).WithArgs(
+		job.ID, job.SubscriptionID, job.IdentityAddress, job.Action, job.UUID, job.LifecycleAction, job.Status,
+		job.Attempts, job.NextAttemptAt, job.LastError, job.CreatedAt, job.UpdatedAt,
+	).WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func expectWebhooksEnqueued(mock sqlmock.Sqlmock, event *domain.Event) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries (")).WithArgs(
+		event.ID, event.Type, sqlmock.AnyArg(), domain.WebhookDeliveryPending, event.CreatedAt,
+	).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestStoreEndSubscriptionCommitsStateEventAndOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", Status: domain.SubscriptionCancelled, AutoRenew: false, UpdatedAt: 5}
+	event := &domain.Event{ID: "evt_1", IdentityAddress: "identity_1", PayerAddress: "payer_1", PlanID: "plan_1", Type: domain.EventCancel, Description: "cancelled", Metadata: "{}", CreatedAt: 5}
+	job := &domain.XraySyncJob{ID: "xsync_1", SubscriptionID: "sub_1", IdentityAddress: "identity_1", Action: domain.XraySyncRemoveUser, LifecycleAction: "cancel", Status: domain.XraySyncJobPending, NextAttemptAt: 5, CreatedAt: 5, UpdatedAt: 5}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE subscriptions SET")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
+	expectXraySyncEnqueued(mock, job)
+	mock.ExpectCommit()
+
+	if err := store.EndSubscription(context.Background(), subscription, event, job); err != nil {
+		t.Fatalf("EndSubscription returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStoreEndSubscriptionRollsBackWhenOutboxFails(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", Status: domain.SubscriptionExpired}
+	event := &domain.Event{ID: "evt_1", IdentityAddress: "identity_1", Type: domain.EventExpired}
+	job := &domain.XraySyncJob{ID: "xsync_1", SubscriptionID: "sub_1", IdentityAddress: "identity_1", Action: domain.XraySyncRemoveUser, Status: domain.XraySyncJobPending}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE subscriptions SET")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE xray_sync_outbox SET status = $2")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO xray_sync_outbox (")).WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+
+	if err := store.EndSubscription(context.Background(), subscription, event, job); err == nil {
+		t.Fatal("expected EndSubscription to fail")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStoreApplyTrafficUsageIncrementsSubscriptionAndCounters(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	counters := []*domain.XrayTrafficCounter{
+		{NodeID: "node_a", IdentityAddress: "identity_1", Uplink: 100, Downlink: 200, UpdatedAt: 5},
+		{NodeID: "node_b", IdentityAddress: "identity_1", Uplink: 10, Downlink: 20, UpdatedAt: 5},
+	}
+
+	samples := []*domain.TrafficSample{
+		{SubscriptionID: "sub_1", IdentityAddress: "identity_1", PlanID: "plan_1", NodeID: "node_a", Granularity: domain.TrafficHourly, BucketStart: 3600000, Uplink: 40, Downlink: 70, UpdatedAt: 5},
+		{SubscriptionID: "sub_1", IdentityAddress: "identity_1", PlanID: "plan_1", NodeID: "node_a", Granularity: domain.TrafficDaily, BucketStart: 0, Uplink: 40, Downlink: 70, UpdatedAt: 5},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("uplink = uplink + $2")).WithArgs("sub_1", int64(40), int64(70)).
+		WillReturnRows(sqlmock.NewRows([]string{"period_traffic"}).AddRow(int64(510)))
+	for _, sample := range samples {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO traffic_samples (")).
+			WithArgs(sample.SubscriptionID, sample.NodeID, sample.Granularity, sample.BucketStart, sample.IdentityAddress, sample.PlanID, sample.Uplink, sample.Downlink, sample.UpdatedAt).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	for _, counter := range counters {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO xray_traffic_counters (")).
+			WithArgs(counter.NodeID, counter.IdentityAddress, counter.Uplink, counter.Downlink, counter.UpdatedAt).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	periodTraffic, err := store.ApplyTrafficUsage(context.Background(), "sub_1", 40, 70, counters, samples)
+	if err != nil {
+		t.Fatalf("ApplyTrafficUsage returned error: %v", err)
+	}
+	if periodTraffic != 510 {
+		t.Fatalf("expected period traffic 510, got %d", periodTraffic)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStoreApplyTrafficUsageRollsBackWhenCounterFails(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	counters := []*domain.XrayTrafficCounter{{NodeID: "node_a", IdentityAddress: "identity_1", Uplink: 100, UpdatedAt: 5}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("uplink = uplink + $2")).WillReturnRows(sqlmock.NewRows([]string{"period_traffic"}).AddRow(int64(100)))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO xray_traffic_counters (")).WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+
+	if _, err := store.ApplyTrafficUsage(context.Background(), "sub_1", 100, 0, counters, nil); err == nil {
+		t.Fatal("expected ApplyTrafficUsage to fail")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStoreUpdateQuotaStateCommitsStateEventAndOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", Status: domain.SubscriptionActive, QuotaExceededAt: 5, TrafficSuspended: true, UpdatedAt: 5}
+	event := &domain.Event{ID: "evt_1", IdentityAddress: "identity_1", Type: domain.EventQuotaExceeded, Metadata: "{}", CreatedAt: 5}
+	job := &domain.XraySyncJob{ID: "xsync_1", SubscriptionID: "sub_1", IdentityAddress: "identity_1", Action: domain.XraySyncRemoveUser, LifecycleAction: "quota_suspend", Status: domain.XraySyncJobPending, NextAttemptAt: 5, CreatedAt: 5, UpdatedAt: 5}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("quota_exceeded_at = $2, traffic_suspended = $3")).
+		WithArgs("sub_1", int64(5), true, int64(5)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
+	expectXraySyncEnqueued(mock, job)
+	mock.ExpectCommit()
+
+	if err := store.UpdateQuotaState(context.Background(), subscription, event, job); err != nil {
+		t.Fatalf("UpdateQuotaState returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStoreRotateXrayCredentialCommitsCredentialEventAndOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", Status: domain.SubscriptionActive, XrayUUID: "uuid_new", UpdatedAt: 5}
+	event := &domain.Event{ID: "evt_1", IdentityAddress: "identity_1", Type: domain.EventCredentialRotated, Metadata: "{}", CreatedAt: 5}
+	job := &domain.XraySyncJob{ID: "xsync_1", SubscriptionID: "sub_1", IdentityAddress: "identity_1", Action: domain.XraySyncRotateUser, UUID: "uuid_new", LifecycleAction: "rotate_credential", Status: domain.XraySyncJobPending, NextAttemptAt: 5, CreatedAt: 5, UpdatedAt: 5}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE subscriptions SET xray_uuid = $2")).
+		WithArgs("sub_1", "uuid_new", int64(5)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
+	expectXraySyncEnqueued(mock, job)
+	mock.ExpectCommit()
+
+	if err := store.RotateXrayCredential(context.Background(), subscription, event, job); err != nil {
+		t.Fatalf("RotateXrayCredential returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestSubscriptionRepositoryListIdentityAccessReturnsCredentials(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("ARRAY_AGG(s.xray_uuid ORDER BY s.current_period_end DESC)")).
+		WillReturnRows(sqlmock.NewRows([]string{"identity_address", "xray_uuid"}).
+			AddRow("identity_active", "uuid_1").
+			AddRow("identity_cancelled", ""))
+
+	access, err := NewSubscriptionRepository(New(db)).ListIdentityAccess(context.Background())
+	if err != nil {
+		t.Fatalf("ListIdentityAccess returned error: %v", err)
+	}
+	if len(access) != 2 || access["identity_active"] != "uuid_1" || access["identity_cancelled"] != "" {
+		t.Fatalf("unexpected access map: %+v", access)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestSubscriptionRepositoryExistsByIdentityAndPayerIgnoresCase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE lower(identity_address) = lower($1) AND lower(payer_address) = lower($2)")).
+		WithArgs("0xAbC1", "0xdEf2").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	exists, err := NewSubscriptionRepository(New(db)).ExistsByIdentityAndPayer(context.Background(), "0xAbC1", "0xdEf2")
+	if err != nil {
+		t.Fatalf("ExistsByIdentityAndPayer returned error: %v", err)
+	}
+	if !exists {
+		t.Fatal("expected payer to be found")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStoreUpdateDunningStateCommitsStateEventAndOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", Status: domain.SubscriptionPastDue, PastDueAt: 5, GraceEndsAt: 100, RenewalAttempts: 1, LastRenewalFailure: domain.RenewalFailureInsufficientAllowance, NextRenewalAttemptAt: 10, UpdatedAt: 5}
+	event := &domain.Event{ID: "evt_1", IdentityAddress: "identity_1", Type: domain.EventPastDue, Metadata: "{}", CreatedAt: 5}
+	job := &domain.XraySyncJob{ID: "xsync_1", SubscriptionID: "sub_1", IdentityAddress: "identity_1", Action: domain.XraySyncRemoveUser, LifecycleAction: "past_due_suspend", Status: domain.XraySyncJobPending, NextAttemptAt: 5, CreatedAt: 5, UpdatedAt: 5}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE subscriptions SET")).
+		WithArgs("sub_1", domain.SubscriptionPastDue, int64(5), int64(100), 1, domain.RenewalFailureInsufficientAllowance, int64(10), int64(5)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
+	expectXraySyncEnqueued(mock, job)
+	mock.ExpectCommit()
+
+	if err := store.UpdateDunningState(context.Background(), subscription, event, job); err != nil {
+		t.Fatalf("UpdateDunningState returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStoreFailChargeEnqueuesWebhooksWithEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	charge := &domain.Charge{ID: "charge_record_1", ChargeID: "renewal_sub_1_2000", Status: domain.ChargeFailed, TxHash: "0xcharge", UpdatedAt: 5}
+	event := &domain.Event{ID: "evt_1", IdentityAddress: "identity_1", ChargeID: "renewal_sub_1_2000", Type: domain.EventChargeFailed, Metadata: "{}", CreatedAt: 5}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE charges SET")).
+		WithArgs("charge_record_1", domain.ChargeFailed, "0xcharge", int64(5)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
+	mock.ExpectCommit()
+
+	if err := store.FailCharge(context.Background(), charge, event); err != nil {
+		t.Fatalf("FailCharge returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStoreSettleChargeLeavesSubscriptionUntouched(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	authorization := &domain.Authorization{ID: "auth_1", RemainingAllowance: 1700, UpdatedAt: 5}
+	charge := &domain.Charge{ID: "charge_record_1", Status: domain.ChargeCompleted, TxHash: "0xcharge", UpdatedAt: 5}
+	event := &domain.Event{ID: "evt_1", IdentityAddress: "identity_1", Type: domain.EventRenewalCredit, Metadata: "{}", CreatedAt: 5}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE charges SET")).
+		WithArgs("charge_record_1", domain.ChargeCompleted, "0xcharge", int64(5)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE authorizations SET")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
+	mock.ExpectCommit()
+
+	if err := store.SettleCharge(context.Background(), authorization, charge, event); err != nil {
+		t.Fatalf("SettleCharge returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStoreRevokeAuthorizationEnqueuesWebhooksWithEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	authorization := &domain.Authorization{ID: "auth_1", PermitStatus: domain.AuthorizationRevoked, UpdatedAt: 5}
+	event := &domain.Event{ID: "evt_1", IdentityAddress: "identity_1", Type: domain.EventAuthorizationRevoked, Metadata: "{}", CreatedAt: 5}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE authorizations SET")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooksEnqueued(mock, event)
+	mock.ExpectCommit()
+
+	if err := store.RevokeAuthorization(context.Background(), authorization, event); err != nil {
+		t.Fatalf("RevokeAuthorization returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+type webhookPayloadArg struct {
+	payload *domain.WebhookPayload
+}
+
+func (a webhookPayloadArg) Match(value driver.Value) bool {
+	body, ok := value.(string)
+	return ok && json.Unmarshal([]byte(body), a.payload) == nil
+}
+
+func TestStoreEnqueuesWebhookDeliveriesWithEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := New(db)
+	subscription := &domain.Subscription{ID: "sub_1", IdentityAddress: "identity_1", Status: domain.SubscriptionExpired}
+	event := &domain.Event{ID: "evt_1", IdentityAddress: "identity_1", PlanID: "plan_1", Type: domain.EventExpired, Description: "expired", Metadata: `{"lifecycle_action":"expire"}`, CreatedAt: 5}
+	payload := &domain.WebhookPayload{}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE subscriptions SET")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("FROM webhook_endpoints")).WithArgs(
+		"evt_1", domain.EventExpired, webhookPayloadArg{payload}, domain.WebhookDeliveryPending, int64(5),
+	).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := store.EndSubscription(context.Background(), subscription, event, nil); err != nil {
+		t.Fatalf("EndSubscription returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+	if payload.ID != "evt_1" || payload.Type != domain.EventExpired || payload.Data.PlanID != "plan_1" || string(payload.Data.Metadata) != `{"lifecycle_action":"expire"}` {
+		t.Fatalf("unexpected webhook payload: %+v", payload)
+	}
+}
+
+func TestWebhookEndpointRepositoryScansEventTypes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewWebhookEndpointRepository(New(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_endpoints WHERE id = $1")).WithArgs("wh_1").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "url", "secret", "description", "event_types", "active", "created_at", "updated_at",
+		}).AddRow("wh_1", "https://billing.example.com/hooks", "whsec_1", "billing", "{renew,past_due}", true, int64(1), int64(2)))
+
+	endpoint, err := repo.GetByID(context.Background(), "wh_1")
+	if err != nil {
+		t.Fatalf("GetByID returned error: %v", err)
+	}
+	if endpoint == nil || len(endpoint.EventTypes) != 2 || endpoint.EventTypes[1] != domain.EventPastDue || endpoint.EventTypes[0] != domain.EventRenew || !endpoint.Active {
+		t.Fatalf("unexpected endpoint: %+v", endpoint)
+	}
+}
+
+func TestChargeRepositoryListHistoryPassesFilter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewChargeRepository(New(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY created_at DESC, id DESC")).
+		WithArgs("0xidentity", "completed", int64(100), int64(900), int64(500), "charge-9", 21).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "charge_id", "subscription_id", "authorization_id", "identity_address", "payer_address", "plan_id", "amount", "status", "tx_hash", "reason", "created_at", "updated_at", "charge_id_encoding"}).
+			AddRow("charge-8", "0xcharge", "sub-1", "auth-1", "0xidentity", "0xpayer", "basic", int64(10), "completed", "0xtx", "renewal", int64(400), int64(410), "keccak256"))
+
+	charges, err := repo.ListHistory(context.Background(), "0xidentity", domain.HistoryFilter{
+		Status: "completed", From: 100, To: 900, BeforeCreatedAt: 500, BeforeID: "charge-9", Limit: 21,
+	})
+	if err != nil {
+		t.Fatalf("ListHistory returned error: %v", err)
+	}
+	if len(charges) != 1 || charges[0].ID != "charge-8" || charges[0].TxHash != "0xtx" || charges[0].CreatedAt != 400 {
+		t.Fatalf("unexpected charges: %+v", charges)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAnalyticsRepositorySubscriptionMovementsCountsEachSubscriptionOnce(t *testing.T) {
+	// A cancellation and the Xray sync event recorded after it, as written by
+	// the lifecycle service.
+	cancel := `{"subscription_id":"sub_1","status":"cancelled","lifecycle_action":"cancel","xray_action":"remove_user","xray_sync_status":"pending"}`
+	xrayFollowUp := `{"subscription_id":"sub_1","status":"cancelled","lifecycle_action":"cancel","xray_action":"remove_user","xray_sync_status":"succeeded","xray_sync_job_id":"xsync_1","xray_error":""}`
+	pattern := regexp.MustCompile(eventSubscriptionIDPattern)
+	for _, metadata := range []string{cancel, xrayFollowUp} {
+		if match := pattern.FindStringSubmatch(metadata); match == nil || match[1] != "sub_1" {
+			t.Fatalf("expected sub_1 extracted from %s, got %v", metadata, match)
+		}
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT ON (type, subscription_id) type, created_at`)).
+		WithArgs(domain.AnalyticsDaily, int64(100), int64(900)).
+		WillReturnRows(sqlmock.NewRows([]string{"bucket_start", "new", "cancelled", "expired"}).
+			AddRow(int64(0), 2, 1, 0))
+
+	movements, err := NewAnalyticsRepository(New(db)).SubscriptionMovements(context.Background(), domain.AnalyticsDaily, 100, 900)
+	if err != nil {
+		t.Fatalf("SubscriptionMovements returned error: %v", err)
+	}
+	if len(movements) != 1 || movements[0].New != 2 || movements[0].Cancelled != 1 || movements[0].Churned() != 1 {
+		t.Fatalf("unexpected movements: %+v", movements[0])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAnalyticsRepositoryRevenueByBucketGroupsInSQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewAnalyticsRepository(New(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta("date_trunc($1, to_timestamp(created_at / 1000.0) AT TIME ZONE 'UTC')")).
+		WithArgs(domain.AnalyticsWeekly, int64(100), int64(900)).
+		WillReturnRows(sqlmock.NewRows([]string{"bucket_start", "count", "sum"}).
+			AddRow(int64(0), 3, int64(30000000)))
+
+	buckets, err := repo.RevenueByBucket(context.Background(), domain.AnalyticsWeekly, 100, 900)
+	if err != nil {
+		t.Fatalf("RevenueByBucket returned error: %v", err)
+	}
+	if len(buckets) != 1 || buckets[0].ChargeCount != 3 || buckets[0].Amount != 30000000 {
+		t.Fatalf("unexpected buckets: %+v", buckets)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"market-blockchain/internal/domain"
+)
+
+type RelayerTransactionRepository struct {
+	store *Store
+}
+
+func NewRelayerTransactionRepository(store *Store) *RelayerTransactionRepository {
+	return &RelayerTransactionRepository{store: store}
+}
+
+const relayerTransactionColumns = `
+	tx_hash, original_tx_hash, from_address, nonce, gas_tip_cap, gas_fee_cap,
+	raw_tx, status, error, created_at, updated_at
+`
+
+const insertRelayerTransaction = `
+	INSERT INTO relayer_transactions (` + relayerTransactionColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+`
+
+func (r *RelayerTransactionRepository) Create(tx *domain.RelayerTransaction) error {
+	_, err := r.store.DB.Exec(insertRelayerTransaction,
+		tx.TxHash, tx.OriginalTxHash, tx.FromAddress, tx.Nonce, tx.GasTipCap, tx.GasFeeCap,
+		tx.RawTx, tx.Status, tx.Error, tx.CreatedAt, tx.UpdatedAt,
+	)
+	return err
+}
+
+func (r *RelayerTransactionRepository) Update(tx *domain.RelayerTransaction) error {
+	query := `
+		UPDATE relayer_transactions SET status = $2, error = $3, updated_at = $4
+		WHERE tx_hash = $1
+	`
+	_, err := r.store.DB.Exec(query, tx.TxHash, tx.Status, tx.Error, tx.UpdatedAt)
+	return err
+}
+
+func (r *RelayerTransactionRepository) Replace(ctx context.Context, replaced, replacement *domain.RelayerTransaction) error {
+	tx, err := r.store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE relayer_transactions SET status = $2, error = $3, updated_at = $4
+		WHERE tx_hash = $1
+	`, replaced.TxHash, replaced.Status, replaced.Error, replaced.UpdatedAt); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, insertRelayerTransaction,
+		replacement.TxHash, replacement.OriginalTxHash, replacement.FromAddress, replacement.Nonce,
+		replacement.GasTipCap, replacement.GasFeeCap, replacement.RawTx, replacement.Status,
+		replacement.Error, replacement.CreatedAt, replacement.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+func (r *RelayerTransactionRepository) GetByHash(ctx context.Context, txHash string) (*domain.RelayerTransaction, error) {
+	query := `SELECT ` + relayerTransactionColumns + ` FROM relayer_transactions WHERE tx_hash = $1`
+	tx := &domain.RelayerTransaction{}
+	err := r.store.DB.QueryRowContext(ctx, query, txHash).Scan(
+		&tx.TxHash, &tx.OriginalTxHash, &tx.FromAddress, &tx.Nonce, &tx.GasTipCap, &tx.GasFeeCap,
+		&tx.RawTx, &tx.Status, &tx.Error, &tx.CreatedAt, &tx.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (r *RelayerTransactionRepository) ListByOriginalHash(ctx context.Context, originalTxHash string) ([]*domain.RelayerTransaction, error) {
+	query := `
+		SELECT ` + relayerTransactionColumns + `
+		FROM relayer_transactions
+		WHERE original_tx_hash = $1
+		ORDER BY created_at DESC
+	`
+	return r.list(ctx, query, originalTxHash)
+}
+
+func (r *RelayerTransactionRepository) ListPending(ctx context.Context, fromAddress string) ([]*domain.RelayerTransaction, error) {
+	query := `
+		SELECT ` + relayerTransactionColumns + `
+		FROM relayer_transactions
+		WHERE from_address = $1 AND status = 'pending'
+		ORDER BY nonce ASC, created_at DESC
+	`
+	return r.list(ctx, query, fromAddress)
+}
+
+func (r *RelayerTransactionRepository) MaxNonce(ctx context.Context, fromAddress string) (int64, error) {
+	query := `
+		SELECT COALESCE(MAX(nonce), -1)
+		FROM relayer_transactions
+		WHERE from_address = $1 AND status <> 'rejected'
+	`
+	var nonce int64
+	if err := r.store.DB.QueryRowContext(ctx, query, fromAddress).Scan(&nonce); err != nil {
+		return 0, err
+	}
+	return nonce, nil
+}
+
+func (r *RelayerTransactionRepository) list(ctx context.Context, query string, args ...interface{}) ([]*domain.RelayerTransaction, error) {
+	rows, err := r.store.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []*domain.RelayerTransaction
+	for rows.Next() {
+		tx := &domain.RelayerTransaction{}
+		err := rows.Scan(
+			&tx.TxHash, &tx.OriginalTxHash, &tx.FromAddress, &tx.Nonce, &tx.GasTipCap, &tx.GasFeeCap,
+			&tx.RawTx, &tx.Status, &tx.Error, &tx.CreatedAt, &tx.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, rows.Err()
+}
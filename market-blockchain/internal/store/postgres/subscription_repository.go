@@ -20,33 +20,36 @@ func (r *SubscriptionRepository) Create(sub *domain.Subscription) error {
 			id, identity_address, payer_address, plan_id, status, auto_renew,
 			current_period_start, current_period_end, next_plan_id, pending_plan_id,
 			current_authorization_id, last_charge_id, last_charge_at, source,
-			uplink, downlink, total_traffic, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+			uplink, downlink, total_traffic, xray_uuid, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
 	`
 	_, err := r.store.DB.Exec(query,
 		sub.ID, sub.IdentityAddress, sub.PayerAddress, sub.PlanID, sub.Status,
 		sub.AutoRenew, sub.CurrentPeriodStart, sub.CurrentPeriodEnd, sub.NextPlanID,
 		sub.PendingPlanID, sub.CurrentAuthorizationID, sub.LastChargeID, sub.LastChargeAt,
-		sub.Source, sub.Uplink, sub.Downlink, sub.TotalTraffic, sub.CreatedAt, sub.UpdatedAt,
+		sub.Source, sub.Uplink, sub.Downlink, sub.TotalTraffic, sub.XrayUUID, sub.CreatedAt, sub.UpdatedAt,
 	)
 	return err
 }
 
+// Update writes the subscription state. Traffic totals are left alone: they
+// are only ever incremented by Store.ApplyTrafficUsage, so a stale copy cannot
+// overwrite usage recorded since it was read. The Xray credential is likewise
+// only changed by Store.RotateXrayCredential.
 func (r *SubscriptionRepository) Update(sub *domain.Subscription) error {
 	query := `
 		UPDATE subscriptions SET
 			payer_address = $2, plan_id = $3, status = $4, auto_renew = $5,
 			current_period_start = $6, current_period_end = $7, next_plan_id = $8,
 			pending_plan_id = $9, current_authorization_id = $10, last_charge_id = $11,
-			last_charge_at = $12, source = $13, uplink = $14, downlink = $15,
-			total_traffic = $16, updated_at = $17
+			last_charge_at = $12, source = $13, updated_at = $14
 		WHERE id = $1
 	`
 	_, err := r.store.DB.Exec(query,
 		sub.ID, sub.PayerAddress, sub.PlanID, sub.Status, sub.AutoRenew,
 		sub.CurrentPeriodStart, sub.CurrentPeriodEnd, sub.NextPlanID,
 		sub.PendingPlanID, sub.CurrentAuthorizationID, sub.LastChargeID,
-		sub.LastChargeAt, sub.Source, sub.Uplink, sub.Downlink, sub.TotalTraffic, sub.UpdatedAt,
+		sub.LastChargeAt, sub.Source, sub.UpdatedAt,
 	)
 	return err
 }
@@ -56,7 +59,9 @@ func (r *SubscriptionRepository) GetByID(ctx context.Context, id string) (*domai
 		SELECT id, identity_address, payer_address, plan_id, status, auto_renew,
 			current_period_start, current_period_end, next_plan_id, pending_plan_id,
 			current_authorization_id, last_charge_id, last_charge_at, source,
-			uplink, downlink, total_traffic, created_at, updated_at
+			uplink, downlink, total_traffic, period_traffic, quota_exceeded_at, traffic_suspended,
+			xray_uuid, past_due_at, grace_ends_at, renewal_attempts, last_renewal_failure,
+			next_renewal_attempt_at, created_at, updated_at
 		FROM subscriptions WHERE id = $1
 	`
 	sub := &domain.Subscription{}
@@ -64,7 +69,9 @@ func (r *SubscriptionRepository) GetByID(ctx context.Context, id string) (*domai
 		&sub.ID, &sub.IdentityAddress, &sub.PayerAddress, &sub.PlanID, &sub.Status,
 		&sub.AutoRenew, &sub.CurrentPeriodStart, &sub.CurrentPeriodEnd, &sub.NextPlanID,
 		&sub.PendingPlanID, &sub.CurrentAuthorizationID, &sub.LastChargeID, &sub.LastChargeAt,
-		&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.CreatedAt, &sub.UpdatedAt,
+		&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.PeriodTraffic, &sub.QuotaExceededAt,
+		&sub.TrafficSuspended, &sub.XrayUUID, &sub.PastDueAt, &sub.GraceEndsAt, &sub.RenewalAttempts,
+		&sub.LastRenewalFailure, &sub.NextRenewalAttemptAt, &sub.CreatedAt, &sub.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -80,17 +87,21 @@ func (r *SubscriptionRepository) GetByIdentityAndPlan(ctx context.Context, ident
 		SELECT id, identity_address, payer_address, plan_id, status, auto_renew,
 			current_period_start, current_period_end, next_plan_id, pending_plan_id,
 			current_authorization_id, last_charge_id, last_charge_at, source,
-			uplink, downlink, total_traffic, created_at, updated_at
+			uplink, downlink, total_traffic, period_traffic, quota_exceeded_at, traffic_suspended,
+			xray_uuid, past_due_at, grace_ends_at, renewal_attempts, last_renewal_failure,
+			next_renewal_attempt_at, created_at, updated_at
 		FROM subscriptions
 		WHERE identity_address = $1 AND plan_id = $2
-		AND status IN ('pending', 'active')
+		AND status IN ('pending', 'active', 'past_due')
 	`
 	sub := &domain.Subscription{}
 	err := r.store.DB.QueryRowContext(ctx, query, identityAddress, planID).Scan(
 		&sub.ID, &sub.IdentityAddress, &sub.PayerAddress, &sub.PlanID, &sub.Status,
 		&sub.AutoRenew, &sub.CurrentPeriodStart, &sub.CurrentPeriodEnd, &sub.NextPlanID,
 		&sub.PendingPlanID, &sub.CurrentAuthorizationID, &sub.LastChargeID, &sub.LastChargeAt,
-		&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.CreatedAt, &sub.UpdatedAt,
+		&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.PeriodTraffic, &sub.QuotaExceededAt,
+		&sub.TrafficSuspended, &sub.XrayUUID, &sub.PastDueAt, &sub.GraceEndsAt, &sub.RenewalAttempts,
+		&sub.LastRenewalFailure, &sub.NextRenewalAttemptAt, &sub.CreatedAt, &sub.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -101,14 +112,54 @@ func (r *SubscriptionRepository) GetByIdentityAndPlan(ctx context.Context, ident
 	return sub, nil
 }
 
+// GetActiveByIdentity returns the identity's subscription that grants access:
+// an active one, or a past due one whose plan keeps access during the grace
+// period. It prefers the one with the latest period end if there are several.
+func (r *SubscriptionRepository) GetActiveByIdentity(ctx context.Context, identityAddress string) (*domain.Subscription, error) {
+	query := `
+		SELECT id, identity_address, payer_address, plan_id, status, auto_renew,
+			current_period_start, current_period_end, next_plan_id, pending_plan_id,
+			current_authorization_id, last_charge_id, last_charge_at, source,
+			uplink, downlink, total_traffic, period_traffic, quota_exceeded_at, traffic_suspended,
+			xray_uuid, past_due_at, grace_ends_at, renewal_attempts, last_renewal_failure,
+			next_renewal_attempt_at, created_at, updated_at
+		FROM subscriptions
+		WHERE identity_address = $1 AND (status = 'active' OR (status = 'past_due'
+			AND plan_id IN (SELECT plan_id FROM plans WHERE grace_access = 'keep')))
+		ORDER BY current_period_end DESC
+		LIMIT 1
+	`
+	sub := &domain.Subscription{}
+	err := r.store.DB.QueryRowContext(ctx, query, identityAddress).Scan(
+		&sub.ID, &sub.IdentityAddress, &sub.PayerAddress, &sub.PlanID, &sub.Status,
+		&sub.AutoRenew, &sub.CurrentPeriodStart, &sub.CurrentPeriodEnd, &sub.NextPlanID,
+		&sub.PendingPlanID, &sub.CurrentAuthorizationID, &sub.LastChargeID, &sub.LastChargeAt,
+		&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.PeriodTraffic, &sub.QuotaExceededAt,
+		&sub.TrafficSuspended, &sub.XrayUUID, &sub.PastDueAt, &sub.GraceEndsAt, &sub.RenewalAttempts,
+		&sub.LastRenewalFailure, &sub.NextRenewalAttemptAt, &sub.CreatedAt, &sub.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ListRenewable returns the active auto-renewing subscriptions whose period
+// has ended and the past due ones whose next renewal attempt is due.
 func (r *SubscriptionRepository) ListRenewable(ctx context.Context, now int64) ([]*domain.Subscription, error) {
 	query := `
 		SELECT id, identity_address, payer_address, plan_id, status, auto_renew,
 			current_period_start, current_period_end, next_plan_id, pending_plan_id,
 			current_authorization_id, last_charge_id, last_charge_at, source,
-			uplink, downlink, total_traffic, created_at, updated_at
+			uplink, downlink, total_traffic, period_traffic, quota_exceeded_at, traffic_suspended,
+			xray_uuid, past_due_at, grace_ends_at, renewal_attempts, last_renewal_failure,
+			next_renewal_attempt_at, created_at, updated_at
 		FROM subscriptions
-		WHERE status = 'active' AND auto_renew = true AND current_period_end <= $1
+		WHERE (status = 'active' AND auto_renew = true AND current_period_end <= $1)
+		OR (status = 'past_due' AND next_renewal_attempt_at <= $1)
 	`
 	rows, err := r.store.DB.QueryContext(ctx, query, now)
 	if err != nil {
@@ -123,7 +174,53 @@ func (r *SubscriptionRepository) ListRenewable(ctx context.Context, now int64) (
 			&sub.ID, &sub.IdentityAddress, &sub.PayerAddress, &sub.PlanID, &sub.Status,
 			&sub.AutoRenew, &sub.CurrentPeriodStart, &sub.CurrentPeriodEnd, &sub.NextPlanID,
 			&sub.PendingPlanID, &sub.CurrentAuthorizationID, &sub.LastChargeID, &sub.LastChargeAt,
-			&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.CreatedAt, &sub.UpdatedAt,
+			&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.PeriodTraffic, &sub.QuotaExceededAt,
+			&sub.TrafficSuspended, &sub.XrayUUID, &sub.PastDueAt, &sub.GraceEndsAt, &sub.RenewalAttempts,
+			&sub.LastRenewalFailure, &sub.NextRenewalAttemptAt, &sub.CreatedAt, &sub.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// ListHistory pages with a (created_at, id) keyset, so rows inserted while a
+// client pages through do not shift later pages.
+func (r *SubscriptionRepository) ListHistory(ctx context.Context, identityAddress string, filter domain.HistoryFilter) ([]*domain.Subscription, error) {
+	query := `
+		SELECT id, identity_address, payer_address, plan_id, status, auto_renew,
+			current_period_start, current_period_end, next_plan_id, pending_plan_id,
+			current_authorization_id, last_charge_id, last_charge_at, source,
+			uplink, downlink, total_traffic, period_traffic, quota_exceeded_at, traffic_suspended,
+			xray_uuid, past_due_at, grace_ends_at, renewal_attempts, last_renewal_failure,
+			next_renewal_attempt_at, created_at, updated_at
+		FROM subscriptions
+		WHERE identity_address = $1
+			AND ($2::TEXT = '' OR status = $2)
+			AND ($3::BIGINT = 0 OR created_at >= $3)
+			AND ($4::BIGINT = 0 OR created_at < $4)
+			AND ($6::TEXT = '' OR (created_at, id) < ($5, $6))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $7
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, identityAddress, filter.Status, filter.From, filter.To, filter.BeforeCreatedAt, filter.BeforeID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*domain.Subscription
+	for rows.Next() {
+		sub := &domain.Subscription{}
+		err := rows.Scan(
+			&sub.ID, &sub.IdentityAddress, &sub.PayerAddress, &sub.PlanID, &sub.Status,
+			&sub.AutoRenew, &sub.CurrentPeriodStart, &sub.CurrentPeriodEnd, &sub.NextPlanID,
+			&sub.PendingPlanID, &sub.CurrentAuthorizationID, &sub.LastChargeID, &sub.LastChargeAt,
+			&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.PeriodTraffic, &sub.QuotaExceededAt,
+			&sub.TrafficSuspended, &sub.XrayUUID, &sub.PastDueAt, &sub.GraceEndsAt, &sub.RenewalAttempts,
+			&sub.LastRenewalFailure, &sub.NextRenewalAttemptAt, &sub.CreatedAt, &sub.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -138,7 +235,9 @@ func (r *SubscriptionRepository) ListByStatus(ctx context.Context, status string
 		SELECT id, identity_address, payer_address, plan_id, status, auto_renew,
 			current_period_start, current_period_end, next_plan_id, pending_plan_id,
 			current_authorization_id, last_charge_id, last_charge_at, source,
-			uplink, downlink, total_traffic, created_at, updated_at
+			uplink, downlink, total_traffic, period_traffic, quota_exceeded_at, traffic_suspended,
+			xray_uuid, past_due_at, grace_ends_at, renewal_attempts, last_renewal_failure,
+			next_renewal_attempt_at, created_at, updated_at
 		FROM subscriptions
 		WHERE status = $1
 		ORDER BY created_at DESC
@@ -157,7 +256,9 @@ func (r *SubscriptionRepository) ListByStatus(ctx context.Context, status string
 			&sub.ID, &sub.IdentityAddress, &sub.PayerAddress, &sub.PlanID, &sub.Status,
 			&sub.AutoRenew, &sub.CurrentPeriodStart, &sub.CurrentPeriodEnd, &sub.NextPlanID,
 			&sub.PendingPlanID, &sub.CurrentAuthorizationID, &sub.LastChargeID, &sub.LastChargeAt,
-			&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.CreatedAt, &sub.UpdatedAt,
+			&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.PeriodTraffic, &sub.QuotaExceededAt,
+			&sub.TrafficSuspended, &sub.XrayUUID, &sub.PastDueAt, &sub.GraceEndsAt, &sub.RenewalAttempts,
+			&sub.LastRenewalFailure, &sub.NextRenewalAttemptAt, &sub.CreatedAt, &sub.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -172,7 +273,9 @@ func (r *SubscriptionRepository) ListAll(ctx context.Context, limit, offset int)
 		SELECT id, identity_address, payer_address, plan_id, status, auto_renew,
 			current_period_start, current_period_end, next_plan_id, pending_plan_id,
 			current_authorization_id, last_charge_id, last_charge_at, source,
-			uplink, downlink, total_traffic, created_at, updated_at
+			uplink, downlink, total_traffic, period_traffic, quota_exceeded_at, traffic_suspended,
+			xray_uuid, past_due_at, grace_ends_at, renewal_attempts, last_renewal_failure,
+			next_renewal_attempt_at, created_at, updated_at
 		FROM subscriptions
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -190,7 +293,9 @@ func (r *SubscriptionRepository) ListAll(ctx context.Context, limit, offset int)
 			&sub.ID, &sub.IdentityAddress, &sub.PayerAddress, &sub.PlanID, &sub.Status,
 			&sub.AutoRenew, &sub.CurrentPeriodStart, &sub.CurrentPeriodEnd, &sub.NextPlanID,
 			&sub.PendingPlanID, &sub.CurrentAuthorizationID, &sub.LastChargeID, &sub.LastChargeAt,
-			&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.CreatedAt, &sub.UpdatedAt,
+			&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.PeriodTraffic, &sub.QuotaExceededAt,
+			&sub.TrafficSuspended, &sub.XrayUUID, &sub.PastDueAt, &sub.GraceEndsAt, &sub.RenewalAttempts,
+			&sub.LastRenewalFailure, &sub.NextRenewalAttemptAt, &sub.CreatedAt, &sub.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -221,12 +326,29 @@ func (r *SubscriptionRepository) CountByPlanAndStatus(ctx context.Context, planI
 	return count, err
 }
 
+// ExistsByIdentityAndPayer reports whether payerAddress pays for any
+// subscription of identityAddress. Addresses compare case-insensitively, as
+// checksummed and lower-case forms of one address are both stored.
+func (r *SubscriptionRepository) ExistsByIdentityAndPayer(ctx context.Context, identityAddress, payerAddress string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM subscriptions
+			WHERE lower(identity_address) = lower($1) AND lower(payer_address) = lower($2)
+		)
+	`
+	var exists bool
+	err := r.store.DB.QueryRowContext(ctx, query, identityAddress, payerAddress).Scan(&exists)
+	return exists, err
+}
+
 func (r *SubscriptionRepository) SearchByAddress(ctx context.Context, address string) ([]*domain.Subscription, error) {
 	query := `
 		SELECT id, identity_address, payer_address, plan_id, status, auto_renew,
 			current_period_start, current_period_end, next_plan_id, pending_plan_id,
 			current_authorization_id, last_charge_id, last_charge_at, source,
-			uplink, downlink, total_traffic, created_at, updated_at
+			uplink, downlink, total_traffic, period_traffic, quota_exceeded_at, traffic_suspended,
+			xray_uuid, past_due_at, grace_ends_at, renewal_attempts, last_renewal_failure,
+			next_renewal_attempt_at, created_at, updated_at
 		FROM subscriptions
 		WHERE identity_address LIKE $1 OR payer_address LIKE $1
 		ORDER BY created_at DESC
@@ -246,7 +368,9 @@ func (r *SubscriptionRepository) SearchByAddress(ctx context.Context, address st
 			&sub.ID, &sub.IdentityAddress, &sub.PayerAddress, &sub.PlanID, &sub.Status,
 			&sub.AutoRenew, &sub.CurrentPeriodStart, &sub.CurrentPeriodEnd, &sub.NextPlanID,
 			&sub.PendingPlanID, &sub.CurrentAuthorizationID, &sub.LastChargeID, &sub.LastChargeAt,
-			&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.CreatedAt, &sub.UpdatedAt,
+			&sub.Source, &sub.Uplink, &sub.Downlink, &sub.TotalTraffic, &sub.PeriodTraffic, &sub.QuotaExceededAt,
+			&sub.TrafficSuspended, &sub.XrayUUID, &sub.PastDueAt, &sub.GraceEndsAt, &sub.RenewalAttempts,
+			&sub.LastRenewalFailure, &sub.NextRenewalAttemptAt, &sub.CreatedAt, &sub.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -255,3 +379,34 @@ func (r *SubscriptionRepository) SearchByAddress(ctx context.Context, address st
 	}
 	return subs, rows.Err()
 }
+
+// ListIdentityAccess returns the Xray credential of every identity that has
+// ever subscribed: that of its not quota-suspended subscription with the
+// latest period end that is active, or past due on a plan that keeps access
+// during the grace period. It is an empty string when the identity should
+// have no access.
+func (r *SubscriptionRepository) ListIdentityAccess(ctx context.Context) (map[string]string, error) {
+	query := `
+		SELECT s.identity_address, COALESCE(
+			(ARRAY_AGG(s.xray_uuid ORDER BY s.current_period_end DESC)
+				FILTER (WHERE NOT s.traffic_suspended AND (s.status = 'active'
+					OR (s.status = 'past_due' AND p.grace_access = 'keep'))))[1], '')
+		FROM subscriptions s LEFT JOIN plans p ON p.plan_id = s.plan_id
+		GROUP BY s.identity_address
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	access := make(map[string]string)
+	for rows.Next() {
+		var identityAddress, uuid string
+		if err := rows.Scan(&identityAddress, &uuid); err != nil {
+			return nil, err
+		}
+		access[identityAddress] = uuid
+	}
+	return access, rows.Err()
+}
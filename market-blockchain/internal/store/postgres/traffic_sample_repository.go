@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"market-blockchain/internal/domain"
+)
+
+type TrafficSampleRepository struct {
+	store *Store
+}
+
+func NewTrafficSampleRepository(store *Store) *TrafficSampleRepository {
+	return &TrafficSampleRepository{store: store}
+}
+
+func (r *TrafficSampleRepository) SumByIdentity(ctx context.Context, identityAddress string, granularity domain.TrafficGranularity, from, to int64) ([]*domain.TrafficUsage, error) {
+	query := `
+		SELECT bucket_start, SUM(uplink), SUM(downlink)
+		FROM traffic_samples
+		WHERE identity_address = $1 AND granularity = $2 AND bucket_start >= $3 AND bucket_start < $4
+		GROUP BY bucket_start
+		ORDER BY bucket_start
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, identityAddress, granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrafficUsage(rows, false)
+}
+
+func (r *TrafficSampleRepository) SumByPlanAndNode(ctx context.Context, granularity domain.TrafficGranularity, from, to int64) ([]*domain.TrafficUsage, error) {
+	query := `
+		SELECT bucket_start, plan_id, node_id, SUM(uplink), SUM(downlink)
+		FROM traffic_samples
+		WHERE granularity = $1 AND bucket_start >= $2 AND bucket_start < $3
+		GROUP BY bucket_start, plan_id, node_id
+		ORDER BY bucket_start, plan_id, node_id
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrafficUsage(rows, true)
+}
+
+func (r *TrafficSampleRepository) DeleteBefore(ctx context.Context, granularity domain.TrafficGranularity, before int64) (int64, error) {
+	result, err := r.store.DB.ExecContext(ctx, `DELETE FROM traffic_samples WHERE granularity = $1 AND bucket_start < $2`, granularity, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanTrafficUsage(rows *sql.Rows, grouped bool) ([]*domain.TrafficUsage, error) {
+	defer rows.Close()
+
+	var usage []*domain.TrafficUsage
+	for rows.Next() {
+		entry := &domain.TrafficUsage{}
+		var err error
+		if grouped {
+			err = rows.Scan(&entry.BucketStart, &entry.PlanID, &entry.NodeID, &entry.Uplink, &entry.Downlink)
+		} else {
+			err = rows.Scan(&entry.BucketStart, &entry.Uplink, &entry.Downlink)
+		}
+		if err != nil {
+			return nil, err
+		}
+		usage = append(usage, entry)
+	}
+	return usage, rows.Err()
+}
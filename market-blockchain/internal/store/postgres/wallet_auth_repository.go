@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"market-blockchain/internal/domain"
+)
+
+type AuthNonceRepository struct {
+	store *Store
+}
+
+func NewAuthNonceRepository(store *Store) *AuthNonceRepository {
+	return &AuthNonceRepository{store: store}
+}
+
+func (r *AuthNonceRepository) Create(nonce *domain.AuthNonce) error {
+	query := `
+		INSERT INTO auth_nonces (nonce, expires_at, consumed_at, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := r.store.DB.Exec(query, nonce.Nonce, nonce.ExpiresAt, nonce.ConsumedAt, nonce.CreatedAt)
+	return err
+}
+
+// Consume is a single conditional UPDATE so two concurrent sign-ins with the
+// same nonce cannot both succeed.
+func (r *AuthNonceRepository) Consume(ctx context.Context, nonce string, now int64) (bool, error) {
+	query := `
+		UPDATE auth_nonces SET consumed_at = $2
+		WHERE nonce = $1 AND consumed_at = 0 AND expires_at > $2
+	`
+	result, err := r.store.DB.ExecContext(ctx, query, nonce, now)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+type WalletSessionRepository struct {
+	store *Store
+}
+
+func NewWalletSessionRepository(store *Store) *WalletSessionRepository {
+	return &WalletSessionRepository{store: store}
+}
+
+func (r *WalletSessionRepository) Create(session *domain.WalletSession) error {
+	query := `
+		INSERT INTO wallet_sessions (token_hash, address, expires_at, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := r.store.DB.Exec(query, session.TokenHash, session.Address, session.ExpiresAt, session.CreatedAt)
+	return err
+}
+
+func (r *WalletSessionRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.WalletSession, error) {
+	query := `
+		SELECT token_hash, address, expires_at, created_at
+		FROM wallet_sessions WHERE token_hash = $1
+	`
+	session := &domain.WalletSession{}
+	err := r.store.DB.QueryRowContext(ctx, query, tokenHash).Scan(
+		&session.TokenHash, &session.Address, &session.ExpiresAt, &session.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *WalletSessionRepository) Delete(ctx context.Context, tokenHash string) error {
+	query := `DELETE FROM wallet_sessions WHERE token_hash = $1`
+	_, err := r.store.DB.ExecContext(ctx, query, tokenHash)
+	return err
+}
@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"market-blockchain/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+type WebhookEndpointRepository struct {
+	store *Store
+}
+
+func NewWebhookEndpointRepository(store *Store) *WebhookEndpointRepository {
+	return &WebhookEndpointRepository{store: store}
+}
+
+func (r *WebhookEndpointRepository) Create(endpoint *domain.WebhookEndpoint) error {
+	query := `
+		INSERT INTO webhook_endpoints (
+			id, url, secret, description, event_types, active, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.store.DB.Exec(query,
+		endpoint.ID, endpoint.URL, endpoint.Secret, endpoint.Description,
+		eventTypeArray(endpoint.EventTypes), endpoint.Active, endpoint.CreatedAt, endpoint.UpdatedAt,
+	)
+	return err
+}
+
+func (r *WebhookEndpointRepository) Update(endpoint *domain.WebhookEndpoint) error {
+	query := `
+		UPDATE webhook_endpoints SET
+			url = $2, description = $3, event_types = $4, active = $5, updated_at = $6
+		WHERE id = $1
+	`
+	_, err := r.store.DB.Exec(query,
+		endpoint.ID, endpoint.URL, endpoint.Description,
+		eventTypeArray(endpoint.EventTypes), endpoint.Active, endpoint.UpdatedAt,
+	)
+	return err
+}
+
+func (r *WebhookEndpointRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.store.DB.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id = $1`, id)
+	return err
+}
+
+func (r *WebhookEndpointRepository) GetByID(ctx context.Context, id string) (*domain.WebhookEndpoint, error) {
+	query := `
+		SELECT id, url, secret, description, event_types, active, created_at, updated_at
+		FROM webhook_endpoints WHERE id = $1
+	`
+	endpoint, err := scanWebhookEndpoint(r.store.DB.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+func (r *WebhookEndpointRepository) ListAll(ctx context.Context) ([]*domain.WebhookEndpoint, error) {
+	query := `
+		SELECT id, url, secret, description, event_types, active, created_at, updated_at
+		FROM webhook_endpoints ORDER BY created_at
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []*domain.WebhookEndpoint
+	for rows.Next() {
+		endpoint, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, rows.Err()
+}
+
+func scanWebhookEndpoint(row interface{ Scan(dest ...any) error }) (*domain.WebhookEndpoint, error) {
+	endpoint := &domain.WebhookEndpoint{}
+	var eventTypes pq.StringArray
+	if err := row.Scan(
+		&endpoint.ID, &endpoint.URL, &endpoint.Secret, &endpoint.Description,
+		&eventTypes, &endpoint.Active, &endpoint.CreatedAt, &endpoint.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	for _, eventType := range eventTypes {
+		endpoint.EventTypes = append(endpoint.EventTypes, domain.EventType(eventType))
+	}
+	return endpoint, nil
+}
+
+func eventTypeArray(eventTypes []domain.EventType) pq.StringArray {
+	array := make(pq.StringArray, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		array = append(array, string(eventType))
+	}
+	return array
+}
+
+type WebhookDeliveryRepository struct {
+	store *Store
+}
+
+func NewWebhookDeliveryRepository(store *Store) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{store: store}
+}
+
+func (r *WebhookDeliveryRepository) Create(delivery *domain.WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (
+			id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+			last_status_code, last_error, delivered_at, replay_of, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`
+	_, err := r.store.DB.Exec(query,
+		delivery.ID, delivery.EndpointID, delivery.EventID, delivery.EventType, delivery.Payload, delivery.Status,
+		delivery.Attempts, delivery.NextAttemptAt, delivery.LastStatusCode, delivery.LastError,
+		delivery.DeliveredAt, delivery.ReplayOf, delivery.CreatedAt, delivery.UpdatedAt,
+	)
+	return err
+}
+
+func (r *WebhookDeliveryRepository) Update(delivery *domain.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries SET
+			status = $2, attempts = $3, next_attempt_at = $4, last_status_code = $5,
+			last_error = $6, delivered_at = $7, updated_at = $8
+		WHERE id = $1
+	`
+	_, err := r.store.DB.Exec(query,
+		delivery.ID, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.LastStatusCode,
+		delivery.LastError, delivery.DeliveredAt, delivery.UpdatedAt,
+	)
+	return err
+}
+
+func (r *WebhookDeliveryRepository) GetByID(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	query := `
+		SELECT id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+			last_status_code, last_error, delivered_at, replay_of, created_at, updated_at
+		FROM webhook_deliveries WHERE id = $1
+	`
+	delivery, err := scanWebhookDelivery(r.store.DB.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (r *WebhookDeliveryRepository) ListDue(ctx context.Context, now int64, limit int) ([]*domain.WebhookDelivery, error) {
+	query := `
+		SELECT id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+			last_status_code, last_error, delivered_at, replay_of, created_at, updated_at
+		FROM webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= $1
+		ORDER BY next_attempt_at
+		LIMIT $2
+	`
+	return r.list(ctx, query, now, limit)
+}
+
+func (r *WebhookDeliveryRepository) ListByEndpoint(ctx context.Context, endpointID string, status domain.WebhookDeliveryStatus, limit int) ([]*domain.WebhookDelivery, error) {
+	query := `
+		SELECT id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+			last_status_code, last_error, delivered_at, replay_of, created_at, updated_at
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`
+	return r.list(ctx, query, endpointID, status, limit)
+}
+
+func (r *WebhookDeliveryRepository) list(ctx context.Context, query string, args ...any) ([]*domain.WebhookDelivery, error) {
+	rows, err := r.store.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*domain.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhookDelivery(row interface{ Scan(dest ...any) error }) (*domain.WebhookDelivery, error) {
+	delivery := &domain.WebhookDelivery{}
+	if err := row.Scan(
+		&delivery.ID, &delivery.EndpointID, &delivery.EventID, &delivery.EventType, &delivery.Payload, &delivery.Status,
+		&delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastStatusCode, &delivery.LastError,
+		&delivery.DeliveredAt, &delivery.ReplayOf, &delivery.CreatedAt, &delivery.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
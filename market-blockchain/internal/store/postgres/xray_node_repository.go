@@ -0,0 +1,233 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"market-blockchain/internal/domain"
+)
+
+type XrayNodeRepository struct {
+	store *Store
+}
+
+func NewXrayNodeRepository(store *Store) *XrayNodeRepository {
+	return &XrayNodeRepository{store: store}
+}
+
+func (r *XrayNodeRepository) Create(node *domain.XrayNode) error {
+	query := `
+		INSERT INTO xray_nodes (
+			id, name, api_address, inbound_tag, enabled,
+			public_host, public_port, transport, security, transport_path,
+			server_name, fingerprint, flow, reality_public_key, reality_short_id,
+			created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+	`
+	e := node.Endpoint
+	_, err := r.store.DB.Exec(query,
+		node.ID, node.Name, node.APIAddress, node.InboundTag, node.Enabled,
+		e.Host, e.Port, e.Transport, e.Security, e.Path,
+		e.ServerName, e.Fingerprint, e.Flow, e.RealityPublicKey, e.RealityShortID,
+		node.CreatedAt, node.UpdatedAt,
+	)
+	return err
+}
+
+func (r *XrayNodeRepository) Update(node *domain.XrayNode) error {
+	query := `
+		UPDATE xray_nodes SET
+			name = $2, api_address = $3, inbound_tag = $4, enabled = $5,
+			public_host = $6, public_port = $7, transport = $8, security = $9, transport_path = $10,
+			server_name = $11, fingerprint = $12, flow = $13, reality_public_key = $14, reality_short_id = $15,
+			updated_at = $16
+		WHERE id = $1
+	`
+	e := node.Endpoint
+	_, err := r.store.DB.Exec(query,
+		node.ID, node.Name, node.APIAddress, node.InboundTag, node.Enabled,
+		e.Host, e.Port, e.Transport, e.Security, e.Path,
+		e.ServerName, e.Fingerprint, e.Flow, e.RealityPublicKey, e.RealityShortID,
+		node.UpdatedAt,
+	)
+	return err
+}
+
+func (r *XrayNodeRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.store.DB.ExecContext(ctx, `DELETE FROM xray_nodes WHERE id = $1`, id)
+	return err
+}
+
+func (r *XrayNodeRepository) GetByID(ctx context.Context, id string) (*domain.XrayNode, error) {
+	query := `
+		SELECT id, name, api_address, inbound_tag, enabled,
+			public_host, public_port, transport, security, transport_path,
+			server_name, fingerprint, flow, reality_public_key, reality_short_id,
+			created_at, updated_at
+		FROM xray_nodes WHERE id = $1
+	`
+	node, err := scanXrayNode(r.store.DB.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (r *XrayNodeRepository) ListAll(ctx context.Context) ([]*domain.XrayNode, error) {
+	query := `
+		SELECT id, name, api_address, inbound_tag, enabled,
+			public_host, public_port, transport, security, transport_path,
+			server_name, fingerprint, flow, reality_public_key, reality_short_id,
+			created_at, updated_at
+		FROM xray_nodes ORDER BY name
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []*domain.XrayNode
+	for rows.Next() {
+		node, err := scanXrayNode(rows)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, rows.Err()
+}
+
+func scanXrayNode(row interface{ Scan(dest ...any) error }) (*domain.XrayNode, error) {
+	node := &domain.XrayNode{}
+	e := &node.Endpoint
+	if err := row.Scan(
+		&node.ID, &node.Name, &node.APIAddress, &node.InboundTag, &node.Enabled,
+		&e.Host, &e.Port, &e.Transport, &e.Security, &e.Path,
+		&e.ServerName, &e.Fingerprint, &e.Flow, &e.RealityPublicKey, &e.RealityShortID,
+		&node.CreatedAt, &node.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+type XrayNodeAssignmentRepository struct {
+	store *Store
+}
+
+func NewXrayNodeAssignmentRepository(store *Store) *XrayNodeAssignmentRepository {
+	return &XrayNodeAssignmentRepository{store: store}
+}
+
+func (r *XrayNodeAssignmentRepository) ListNodeIDs(ctx context.Context, identityAddress string) ([]string, error) {
+	query := `SELECT node_id FROM xray_node_assignments WHERE identity_address = $1 ORDER BY node_id`
+	rows, err := r.store.DB.QueryContext(ctx, query, identityAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodeIDs []string
+	for rows.Next() {
+		var nodeID string
+		if err := rows.Scan(&nodeID); err != nil {
+			return nil, err
+		}
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	return nodeIDs, rows.Err()
+}
+
+func (r *XrayNodeAssignmentRepository) ListAll(ctx context.Context) (map[string][]string, error) {
+	query := `SELECT identity_address, node_id FROM xray_node_assignments ORDER BY identity_address, node_id`
+	rows, err := r.store.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := make(map[string][]string)
+	for rows.Next() {
+		var identityAddress, nodeID string
+		if err := rows.Scan(&identityAddress, &nodeID); err != nil {
+			return nil, err
+		}
+		assignments[identityAddress] = append(assignments[identityAddress], nodeID)
+	}
+	return assignments, rows.Err()
+}
+
+func (r *XrayNodeAssignmentRepository) Replace(ctx context.Context, identityAddress string, nodeIDs []string, now int64) error {
+	tx, err := r.store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM xray_node_assignments WHERE identity_address = $1`, identityAddress); err != nil {
+		return err
+	}
+	for _, nodeID := range nodeIDs {
+		if _, err = tx.ExecContext(ctx, `
+			INSERT INTO xray_node_assignments (identity_address, node_id, created_at)
+			VALUES ($1, $2, $3)
+		`, identityAddress, nodeID, now); err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+type XrayNodeSyncRepository struct {
+	store *Store
+}
+
+func NewXrayNodeSyncRepository(store *Store) *XrayNodeSyncRepository {
+	return &XrayNodeSyncRepository{store: store}
+}
+
+func (r *XrayNodeSyncRepository) Upsert(sync *domain.XrayNodeSync) error {
+	query := `
+		INSERT INTO xray_node_syncs (node_id, identity_address, action, status, error, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (node_id, identity_address) DO UPDATE SET
+			action = EXCLUDED.action, status = EXCLUDED.status,
+			error = EXCLUDED.error, updated_at = EXCLUDED.updated_at
+	`
+	_, err := r.store.DB.Exec(query, sync.NodeID, sync.IdentityAddress, sync.Action, sync.Status, sync.Error, sync.UpdatedAt)
+	return err
+}
+
+func (r *XrayNodeSyncRepository) ListByIdentity(ctx context.Context, identityAddress string) ([]*domain.XrayNodeSync, error) {
+	query := `
+		SELECT node_id, identity_address, action, status, error, updated_at
+		FROM xray_node_syncs WHERE identity_address = $1 ORDER BY node_id
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, identityAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var syncs []*domain.XrayNodeSync
+	for rows.Next() {
+		sync := &domain.XrayNodeSync{}
+		if err := rows.Scan(
+			&sync.NodeID, &sync.IdentityAddress, &sync.Action, &sync.Status, &sync.Error, &sync.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		syncs = append(syncs, sync)
+	}
+	return syncs, rows.Err()
+}
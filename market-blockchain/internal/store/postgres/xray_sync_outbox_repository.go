@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+type XraySyncOutboxRepository struct {
+	store *Store
+}
+
+func NewXraySyncOutboxRepository(store *Store) *XraySyncOutboxRepository {
+	return &XraySyncOutboxRepository{store: store}
+}
+
+func (r *XraySyncOutboxRepository) Update(job *domain.XraySyncJob) error {
+	query := `
+		UPDATE xray_sync_outbox SET
+			status = $2, attempts = $3, next_attempt_at = $4, last_error = $5, updated_at = $6
+		WHERE id = $1 AND status = 'pending'
+	`
+	_, err := r.store.DB.Exec(query, job.ID, job.Status, job.Attempts, job.NextAttemptAt, job.LastError, job.UpdatedAt)
+	return err
+}
+
+func (r *XraySyncOutboxRepository) ListDue(ctx context.Context, now int64, limit int) ([]*domain.XraySyncJob, error) {
+	query := `
+		SELECT id, subscription_id, identity_address, action, uuid, lifecycle_action, status,
+			attempts, next_attempt_at, last_error, created_at, updated_at
+		FROM xray_sync_outbox
+		WHERE status = 'pending' AND next_attempt_at <= $1
+		ORDER BY next_attempt_at
+		LIMIT $2
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*domain.XraySyncJob
+	for rows.Next() {
+		job := &domain.XraySyncJob{}
+		if err := rows.Scan(
+			&job.ID, &job.SubscriptionID, &job.IdentityAddress, &job.Action, &job.UUID, &job.LifecycleAction, &job.Status,
+			&job.Attempts, &job.NextAttemptAt, &job.LastError, &job.CreatedAt, &job.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"context"
+	"market-blockchain/internal/domain"
+)
+
+type XrayTrafficCounterRepository struct {
+	store *Store
+}
+
+func NewXrayTrafficCounterRepository(store *Store) *XrayTrafficCounterRepository {
+	return &XrayTrafficCounterRepository{store: store}
+}
+
+func (r *XrayTrafficCounterRepository) ListAll(ctx context.Context) ([]*domain.XrayTrafficCounter, error) {
+	query := `
+		SELECT node_id, identity_address, uplink, downlink, updated_at
+		FROM xray_traffic_counters
+	`
+	rows, err := r.store.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counters []*domain.XrayTrafficCounter
+	for rows.Next() {
+		counter := &domain.XrayTrafficCounter{}
+		if err := rows.Scan(&counter.NodeID, &counter.IdentityAddress, &counter.Uplink, &counter.Downlink, &counter.UpdatedAt); err != nil {
+			return nil, err
+		}
+		counters = append(counters, counter)
+	}
+	return counters, rows.Err()
+}
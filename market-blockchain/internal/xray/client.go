@@ -2,12 +2,11 @@ package xray
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	proxymancommand "github.com/xtls/xray-core/app/proxyman/command"
 	statscommand "github.com/xtls/xray-core/app/stats/command"
 	"github.com/xtls/xray-core/common/protocol"
@@ -65,6 +64,15 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// Ping checks that the Xray API answers
+func (c *Client) Ping(ctx context.Context) error {
+	statsClient := statscommand.NewStatsServiceClient(c.conn)
+	if _, err := statsClient.GetSysStats(ctx, &statscommand.SysStatsRequest{}); err != nil {
+		return fmt.Errorf("ping Xray API at %s: %w", c.address, err)
+	}
+	return nil
+}
+
 // UserTraffic represents user traffic statistics
 type UserTraffic struct {
 	Email    string
@@ -114,6 +122,37 @@ func (c *Client) RemoveUser(ctx context.Context, email string) error {
 	return nil
 }
 
+// InboundUser is a user currently present on the inbound
+type InboundUser struct {
+	Email string
+	UUID  string
+}
+
+// ListUsers lists the users on the inbound
+func (c *Client) ListUsers(ctx context.Context) ([]InboundUser, error) {
+	handlerClient := proxymancommand.NewHandlerServiceClient(c.conn)
+	response, err := handlerClient.GetInboundUsers(ctx, &proxymancommand.GetInboundUserRequest{
+		Tag: c.inboundTag,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list users of inbound %s: %w", c.inboundTag, err)
+	}
+
+	users := make([]InboundUser, 0, len(response.GetUsers()))
+	for _, user := range response.GetUsers() {
+		entry := InboundUser{Email: user.GetEmail()}
+		if user.GetAccount() != nil {
+			if instance, err := user.GetAccount().GetInstance(); err == nil {
+				if account, ok := instance.(*vless.Account); ok {
+					entry.UUID = account.GetId()
+				}
+			}
+		}
+		users = append(users, entry)
+	}
+	return users, nil
+}
+
 // QueryUserTraffic queries traffic statistics for a specific user
 func (c *Client) QueryUserTraffic(ctx context.Context, email string) (*UserTraffic, error) {
 	statsClient := statscommand.NewStatsServiceClient(c.conn)
@@ -209,18 +248,9 @@ func isNotFoundError(err error) bool {
 	return strings.Contains(message, "not found") || strings.Contains(message, "user not found")
 }
 
-func generateUUIDFromAddress(address string) string {
-	hash := sha256.Sum256([]byte(address))
-	hashHex := hex.EncodeToString(hash[:])
-	return fmt.Sprintf("%s-%s-%s-%s-%s",
-		hashHex[0:8],
-		hashHex[8:12],
-		hashHex[12:16],
-		hashHex[16:20],
-		hashHex[20:32],
-	)
-}
-
-func GetUserUUID(identityAddress string) string {
-	return generateUUIDFromAddress(identityAddress)
+// NewUserUUID returns a random credential for a new Xray user. Credentials
+// are stored per subscription; they are no longer derived from the identity
+// address, so one leaking does not expose every other user's.
+func NewUserUUID() string {
+	return uuid.New().String()
 }
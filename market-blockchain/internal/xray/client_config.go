@@ -0,0 +1,259 @@
+package xray
+
+import (
+	"net/url"
+	"strconv"
+
+	"market-blockchain/internal/domain"
+)
+
+// defaultRealityFingerprint is the uTLS fingerprint used for REALITY nodes
+// that do not set one; REALITY does not work without uTLS.
+const defaultRealityFingerprint = "chrome"
+
+// SingBoxSelectorTag is the tag of the selector outbound that groups every
+// node in a sing-box config.
+const SingBoxSelectorTag = "proxy"
+
+func fingerprint(endpoint domain.XrayNodeEndpoint) string {
+	if endpoint.Fingerprint == "" && endpoint.Security == domain.XraySecurityReality {
+		return defaultRealityFingerprint
+	}
+	return endpoint.Fingerprint
+}
+
+// ShareLink returns the vless:// link for a node, in the format v2rayN,
+// v2rayNG, Shadowrocket and Nekoray import.
+func ShareLink(node *domain.XrayNode, uuid string) string {
+	endpoint := node.Endpoint
+	query := url.Values{}
+	query.Set("encryption", "none")
+	query.Set("type", string(endpoint.Transport))
+	query.Set("security", string(endpoint.Security))
+	if endpoint.Security != domain.XraySecurityNone {
+		query.Set("sni", endpoint.SNI())
+		if fp := fingerprint(endpoint); fp != "" {
+			query.Set("fp", fp)
+		}
+	}
+	if endpoint.Security == domain.XraySecurityReality {
+		query.Set("pbk", endpoint.RealityPublicKey)
+		if endpoint.RealityShortID != "" {
+			query.Set("sid", endpoint.RealityShortID)
+		}
+	}
+	if endpoint.Flow != "" {
+		query.Set("flow", endpoint.Flow)
+	}
+	switch endpoint.Transport {
+	case domain.XrayTransportWS:
+		query.Set("path", endpoint.Path)
+		query.Set("host", endpoint.SNI())
+	case domain.XrayTransportGRPC:
+		query.Set("serviceName", endpoint.Path)
+	}
+
+	link := url.URL{
+		Scheme:   "vless",
+		User:     url.User(uuid),
+		Host:     endpoint.Host + ":" + strconv.Itoa(endpoint.Port),
+		RawQuery: query.Encode(),
+		Fragment: node.Name,
+	}
+	return link.String()
+}
+
+type SingBoxConfig struct {
+	Outbounds []interface{} `json:"outbounds"`
+}
+
+type SingBoxSelector struct {
+	Type      string   `json:"type"`
+	Tag       string   `json:"tag"`
+	Outbounds []string `json:"outbounds"`
+	Default   string   `json:"default,omitempty"`
+}
+
+type SingBoxOutbound struct {
+	Type       string            `json:"type"`
+	Tag        string            `json:"tag"`
+	Server     string            `json:"server"`
+	ServerPort int               `json:"server_port"`
+	UUID       string            `json:"uuid"`
+	Flow       string            `json:"flow,omitempty"`
+	TLS        *SingBoxTLS       `json:"tls,omitempty"`
+	Transport  *SingBoxTransport `json:"transport,omitempty"`
+}
+
+type SingBoxTLS struct {
+	Enabled    bool            `json:"enabled"`
+	ServerName string          `json:"server_name,omitempty"`
+	UTLS       *SingBoxUTLS    `json:"utls,omitempty"`
+	Reality    *SingBoxReality `json:"reality,omitempty"`
+}
+
+type SingBoxUTLS struct {
+	Enabled     bool   `json:"enabled"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+type SingBoxReality struct {
+	Enabled   bool   `json:"enabled"`
+	PublicKey string `json:"public_key"`
+	ShortID   string `json:"short_id,omitempty"`
+}
+
+type SingBoxTransport struct {
+	Type        string            `json:"type"`
+	Path        string            `json:"path,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ServiceName string            `json:"service_name,omitempty"`
+}
+
+// SingBoxOutbounds returns a sing-box outbounds fragment: one VLESS outbound
+// per node and a selector over all of them, defaulting to the first node.
+func SingBoxOutbounds(nodes []*domain.XrayNode, uuid string) *SingBoxConfig {
+	selector := &SingBoxSelector{Type: "selector", Tag: SingBoxSelectorTag, Outbounds: make([]string, 0, len(nodes))}
+	config := &SingBoxConfig{Outbounds: []interface{}{selector}}
+	for _, node := range nodes {
+		selector.Outbounds = append(selector.Outbounds, node.Name)
+		config.Outbounds = append(config.Outbounds, singBoxOutbound(node, uuid))
+	}
+	if len(nodes) > 0 {
+		selector.Default = nodes[0].Name
+	}
+	return config
+}
+
+func singBoxOutbound(node *domain.XrayNode, uuid string) *SingBoxOutbound {
+	endpoint := node.Endpoint
+	outbound := &SingBoxOutbound{
+		Type:       "vless",
+		Tag:        node.Name,
+		Server:     endpoint.Host,
+		ServerPort: endpoint.Port,
+		UUID:       uuid,
+		Flow:       endpoint.Flow,
+	}
+
+	if endpoint.Security != domain.XraySecurityNone {
+		outbound.TLS = &SingBoxTLS{Enabled: true, ServerName: endpoint.SNI()}
+		if fp := fingerprint(endpoint); fp != "" {
+			outbound.TLS.UTLS = &SingBoxUTLS{Enabled: true, Fingerprint: fp}
+		}
+		if endpoint.Security == domain.XraySecurityReality {
+			outbound.TLS.Reality = &SingBoxReality{Enabled: true, PublicKey: endpoint.RealityPublicKey, ShortID: endpoint.RealityShortID}
+		}
+	}
+
+	switch endpoint.Transport {
+	case domain.XrayTransportWS:
+		outbound.Transport = &SingBoxTransport{Type: "ws", Path: endpoint.Path, Headers: map[string]string{"Host": endpoint.SNI()}}
+	case domain.XrayTransportGRPC:
+		outbound.Transport = &SingBoxTransport{Type: "grpc", ServiceName: endpoint.Path}
+	}
+	return outbound
+}
+
+type XrayClientConfig struct {
+	Outbounds []*XrayOutbound `json:"outbounds"`
+}
+
+type XrayOutbound struct {
+	Protocol       string              `json:"protocol"`
+	Tag            string              `json:"tag"`
+	Settings       XrayOutboundVnext   `json:"settings"`
+	StreamSettings *XrayStreamSettings `json:"streamSettings"`
+}
+
+type XrayOutboundVnext struct {
+	Vnext []XrayVnextServer `json:"vnext"`
+}
+
+type XrayVnextServer struct {
+	Address string          `json:"address"`
+	Port    int             `json:"port"`
+	Users   []XrayVnextUser `json:"users"`
+}
+
+type XrayVnextUser struct {
+	ID         string `json:"id"`
+	Encryption string `json:"encryption"`
+	Flow       string `json:"flow,omitempty"`
+}
+
+type XrayStreamSettings struct {
+	Network         string               `json:"network"`
+	Security        string               `json:"security"`
+	TLSSettings     *XrayTLSSettings     `json:"tlsSettings,omitempty"`
+	RealitySettings *XrayRealitySettings `json:"realitySettings,omitempty"`
+	WSSettings      *XrayWSSettings      `json:"wsSettings,omitempty"`
+	GRPCSettings    *XrayGRPCSettings    `json:"grpcSettings,omitempty"`
+}
+
+type XrayTLSSettings struct {
+	ServerName  string `json:"serverName"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+type XrayRealitySettings struct {
+	ServerName  string `json:"serverName"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"publicKey"`
+	ShortID     string `json:"shortId,omitempty"`
+}
+
+type XrayWSSettings struct {
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type XrayGRPCSettings struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// XrayOutbounds returns an Xray client outbound per node, tagged with the
+// node name so they can be routed or balanced by tag.
+func XrayOutbounds(nodes []*domain.XrayNode, uuid string) *XrayClientConfig {
+	config := &XrayClientConfig{Outbounds: make([]*XrayOutbound, 0, len(nodes))}
+	for _, node := range nodes {
+		config.Outbounds = append(config.Outbounds, xrayOutbound(node, uuid))
+	}
+	return config
+}
+
+func xrayOutbound(node *domain.XrayNode, uuid string) *XrayOutbound {
+	endpoint := node.Endpoint
+	stream := &XrayStreamSettings{
+		Network:  string(endpoint.Transport),
+		Security: string(endpoint.Security),
+	}
+	switch endpoint.Security {
+	case domain.XraySecurityTLS:
+		stream.TLSSettings = &XrayTLSSettings{ServerName: endpoint.SNI(), Fingerprint: fingerprint(endpoint)}
+	case domain.XraySecurityReality:
+		stream.RealitySettings = &XrayRealitySettings{
+			ServerName:  endpoint.SNI(),
+			Fingerprint: fingerprint(endpoint),
+			PublicKey:   endpoint.RealityPublicKey,
+			ShortID:     endpoint.RealityShortID,
+		}
+	}
+	switch endpoint.Transport {
+	case domain.XrayTransportWS:
+		stream.WSSettings = &XrayWSSettings{Path: endpoint.Path, Headers: map[string]string{"Host": endpoint.SNI()}}
+	case domain.XrayTransportGRPC:
+		stream.GRPCSettings = &XrayGRPCSettings{ServiceName: endpoint.Path}
+	}
+
+	return &XrayOutbound{
+		Protocol: "vless",
+		Tag:      node.Name,
+		Settings: XrayOutboundVnext{Vnext: []XrayVnextServer{{
+			Address: endpoint.Host,
+			Port:    endpoint.Port,
+			Users:   []XrayVnextUser{{ID: uuid, Encryption: "none", Flow: endpoint.Flow}},
+		}}},
+		StreamSettings: stream,
+	}
+}
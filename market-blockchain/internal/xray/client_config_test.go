@@ -0,0 +1,141 @@
+package xray
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"market-blockchain/internal/domain"
+)
+
+func testRealityNode() *domain.XrayNode {
+	return &domain.XrayNode{Name: "hk 1", Endpoint: domain.XrayNodeEndpoint{
+		Host:             "hk1.example.com",
+		Port:             443,
+		Transport:        domain.XrayTransportTCP,
+		Security:         domain.XraySecurityReality,
+		ServerName:       "www.microsoft.com",
+		Flow:             "xtls-rprx-vision",
+		RealityPublicKey: "pubkey",
+		RealityShortID:   "ab12",
+	}}
+}
+
+func testWSNode() *domain.XrayNode {
+	return &domain.XrayNode{Name: "jp-1", Endpoint: domain.XrayNodeEndpoint{
+		Host:      "jp1.example.com",
+		Port:      8443,
+		Transport: domain.XrayTransportWS,
+		Security:  domain.XraySecurityTLS,
+		Path:      "/vless",
+	}}
+}
+
+func TestShareLinkReality(t *testing.T) {
+	link := ShareLink(testRealityNode(), "11111111-2222-3333-4444-555555555555")
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("share link does not parse: %v", err)
+	}
+	if parsed.Scheme != "vless" || parsed.User.Username() != "11111111-2222-3333-4444-555555555555" || parsed.Host != "hk1.example.com:443" {
+		t.Fatalf("unexpected link target: %s", link)
+	}
+	if parsed.Fragment != "hk 1" || !strings.HasSuffix(link, "#hk%201") {
+		t.Fatalf("expected escaped node name as fragment, got %s", link)
+	}
+
+	query := parsed.Query()
+	for key, want := range map[string]string{
+		"encryption": "none",
+		"type":       "tcp",
+		"security":   "reality",
+		"sni":        "www.microsoft.com",
+		"fp":         "chrome",
+		"pbk":        "pubkey",
+		"sid":        "ab12",
+		"flow":       "xtls-rprx-vision",
+	} {
+		if got := query.Get(key); got != want {
+			t.Fatalf("expected %s=%s, got %q in %s", key, want, got, link)
+		}
+	}
+}
+
+func TestShareLinkWebSocketTLS(t *testing.T) {
+	query, err := url.Parse(ShareLink(testWSNode(), "uuid"))
+	if err != nil {
+		t.Fatalf("share link does not parse: %v", err)
+	}
+	values := query.Query()
+	if values.Get("type") != "ws" || values.Get("path") != "/vless" || values.Get("host") != "jp1.example.com" || values.Get("sni") != "jp1.example.com" {
+		t.Fatalf("unexpected ws query: %v", values)
+	}
+	if values.Has("pbk") || values.Has("fp") {
+		t.Fatalf("expected no reality parameters, got %v", values)
+	}
+}
+
+func TestSingBoxOutboundsListsEveryNodeBehindSelector(t *testing.T) {
+	config := SingBoxOutbounds([]*domain.XrayNode{testRealityNode(), testWSNode()}, "uuid")
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("marshal sing-box config: %v", err)
+	}
+	var decoded struct {
+		Outbounds []map[string]interface{} `json:"outbounds"`
+	}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshal sing-box config: %v", err)
+	}
+	if len(decoded.Outbounds) != 3 {
+		t.Fatalf("expected selector and two nodes, got %s", encoded)
+	}
+
+	selector := decoded.Outbounds[0]
+	if selector["type"] != "selector" || selector["tag"] != SingBoxSelectorTag || selector["default"] != "hk 1" {
+		t.Fatalf("unexpected selector: %v", selector)
+	}
+	if tags := selector["outbounds"].([]interface{}); len(tags) != 2 || tags[1] != "jp-1" {
+		t.Fatalf("unexpected selector members: %v", tags)
+	}
+
+	reality := decoded.Outbounds[1]
+	tls := reality["tls"].(map[string]interface{})
+	if reality["server_port"].(float64) != 443 || reality["flow"] != "xtls-rprx-vision" || tls["server_name"] != "www.microsoft.com" {
+		t.Fatalf("unexpected reality outbound: %v", reality)
+	}
+	if tls["reality"].(map[string]interface{})["public_key"] != "pubkey" || tls["utls"].(map[string]interface{})["fingerprint"] != "chrome" {
+		t.Fatalf("unexpected reality tls: %v", tls)
+	}
+
+	ws := decoded.Outbounds[2]
+	transport := ws["transport"].(map[string]interface{})
+	if transport["type"] != "ws" || transport["path"] != "/vless" {
+		t.Fatalf("unexpected ws transport: %v", transport)
+	}
+}
+
+func TestXrayOutboundsBuildVlessStreamSettings(t *testing.T) {
+	config := XrayOutbounds([]*domain.XrayNode{testRealityNode(), testWSNode()}, "uuid")
+	if len(config.Outbounds) != 2 {
+		t.Fatalf("expected one outbound per node, got %d", len(config.Outbounds))
+	}
+
+	reality := config.Outbounds[0]
+	server := reality.Settings.Vnext[0]
+	if reality.Protocol != "vless" || reality.Tag != "hk 1" || server.Address != "hk1.example.com" || server.Users[0].ID != "uuid" || server.Users[0].Encryption != "none" {
+		t.Fatalf("unexpected reality outbound: %+v", reality)
+	}
+	stream := reality.StreamSettings
+	if stream.Network != "tcp" || stream.Security != "reality" || stream.RealitySettings == nil || stream.RealitySettings.PublicKey != "pubkey" || stream.TLSSettings != nil {
+		t.Fatalf("unexpected reality stream settings: %+v", stream)
+	}
+
+	ws := config.Outbounds[1].StreamSettings
+	if ws.Network != "ws" || ws.TLSSettings == nil || ws.TLSSettings.ServerName != "jp1.example.com" || ws.WSSettings == nil || ws.WSSettings.Path != "/vless" {
+		t.Fatalf("unexpected ws stream settings: %+v", ws)
+	}
+}
@@ -0,0 +1,585 @@
+package xray
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"market-blockchain/internal/domain"
+	"market-blockchain/internal/repository"
+)
+
+// ErrNoNodes is returned when no enabled node is available for a user change.
+var ErrNoNodes = errors.New("no enabled Xray nodes")
+
+// nodeAPI is the part of Client the fleet drives on each node.
+type nodeAPI interface {
+	AddUser(ctx context.Context, email, uuid string) error
+	RemoveUser(ctx context.Context, email string) error
+	QueryAllUsersTraffic(ctx context.Context) ([]*UserTraffic, error)
+	ListUsers(ctx context.Context) ([]InboundUser, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+type dialFunc func(node domain.XrayNode, timeout time.Duration) (nodeAPI, error)
+
+func dialNode(node domain.XrayNode, timeout time.Duration) (nodeAPI, error) {
+	client, err := NewClient(Config{Address: node.APIAddress, InboundTag: node.InboundTag, Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// FleetConfig holds the fleet timing settings
+type FleetConfig struct {
+	// Timeout bounds each call to a single node, so a slow node cannot hold
+	// up the others.
+	Timeout        time.Duration
+	HealthInterval time.Duration
+}
+
+// NodeStatus is the connection health of one node
+type NodeStatus struct {
+	Health    domain.XrayNodeHealth
+	LastError string
+	CheckedAt int64
+}
+
+type member struct {
+	node domain.XrayNode
+	api  nodeAPI
+	// generation changes whenever the connection is replaced, so results of
+	// calls that raced with a reconnect are discarded.
+	generation int
+	status     NodeStatus
+}
+
+// Fleet fans user changes out to the registered Xray nodes and tracks the
+// health of each. Nodes that are down are skipped and recorded as failed
+// instead of blocking the rest.
+type Fleet struct {
+	nodes       repository.XrayNodeRepository
+	assignments repository.XrayNodeAssignmentRepository
+	syncs       repository.XrayNodeSyncRepository
+	config      FleetConfig
+	dial        dialFunc
+
+	mu      sync.Mutex
+	members map[string]*member
+}
+
+func NewFleet(
+	nodes repository.XrayNodeRepository,
+	assignments repository.XrayNodeAssignmentRepository,
+	syncs repository.XrayNodeSyncRepository,
+	config FleetConfig,
+) *Fleet {
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.HealthInterval == 0 {
+		config.HealthInterval = 30 * time.Second
+	}
+
+	return &Fleet{
+		nodes:       nodes,
+		assignments: assignments,
+		syncs:       syncs,
+		config:      config,
+		dial:        dialNode,
+		members:     make(map[string]*member),
+	}
+}
+
+// Start refreshes the node registry and checks node health until ctx is done
+func (f *Fleet) Start(ctx context.Context) {
+	ticker := time.NewTicker(f.config.HealthInterval)
+	defer ticker.Stop()
+
+	log.Printf("Xray fleet health checks started (interval: %v)", f.config.HealthInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Xray fleet health checks stopped")
+			return
+		case <-ticker.C:
+			if err := f.Refresh(ctx); err != nil {
+				log.Printf("Failed to refresh Xray nodes: %v", err)
+			}
+			f.CheckHealth(ctx)
+		}
+	}
+}
+
+// Refresh reloads the enabled nodes from the registry. Nodes whose address or
+// inbound changed are reconnected on the next health check.
+func (f *Fleet) Refresh(ctx context.Context) error {
+	nodes, err := f.nodes.ListAll(ctx)
+	if err != nil {
+		return fmt.Errorf("list xray nodes: %w", err)
+	}
+
+	var stale []nodeAPI
+	f.mu.Lock()
+	enabled := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if !node.Enabled {
+			continue
+		}
+		enabled[node.ID] = true
+
+		m := f.members[node.ID]
+		if m == nil {
+			f.members[node.ID] = &member{node: *node, status: NodeStatus{Health: domain.XrayNodeHealthUnknown}}
+			continue
+		}
+		if m.node.APIAddress != node.APIAddress || m.node.InboundTag != node.InboundTag {
+			if m.api != nil {
+				stale = append(stale, m.api)
+			}
+			m.api = nil
+			m.generation++
+			m.status = NodeStatus{Health: domain.XrayNodeHealthUnknown}
+		}
+		m.node = *node
+	}
+	for id, m := range f.members {
+		if enabled[id] {
+			continue
+		}
+		if m.api != nil {
+			stale = append(stale, m.api)
+		}
+		delete(f.members, id)
+	}
+	f.mu.Unlock()
+
+	closeAll(stale)
+	return nil
+}
+
+type healthResult struct {
+	id         string
+	generation int
+	api        nodeAPI
+	dialed     bool
+	err        error
+}
+
+// CheckHealth connects to nodes that are not connected yet and pings the
+// rest, all in parallel.
+func (f *Fleet) CheckHealth(ctx context.Context) {
+	f.mu.Lock()
+	pending := make([]healthResult, 0, len(f.members))
+	nodes := make(map[string]domain.XrayNode, len(f.members))
+	for id, m := range f.members {
+		pending = append(pending, healthResult{id: id, generation: m.generation, api: m.api})
+		nodes[id] = m.node
+	}
+	f.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := range pending {
+		wg.Add(1)
+		go func(result *healthResult) {
+			defer wg.Done()
+			if result.api == nil {
+				result.api, result.err = f.dial(nodes[result.id], f.config.Timeout)
+				result.dialed = result.err == nil
+				return
+			}
+			callCtx, cancel := context.WithTimeout(ctx, f.config.Timeout)
+			defer cancel()
+			result.err = result.api.Ping(callCtx)
+		}(&pending[i])
+	}
+	wg.Wait()
+
+	var stale []nodeAPI
+	now := time.Now().UnixMilli()
+	f.mu.Lock()
+	for _, result := range pending {
+		m := f.members[result.id]
+		if m == nil || m.generation != result.generation {
+			if result.dialed {
+				stale = append(stale, result.api)
+			}
+			continue
+		}
+		if result.dialed {
+			m.api = result.api
+		}
+		m.status = NodeStatus{Health: domain.XrayNodeHealthy, CheckedAt: now}
+		if result.err != nil {
+			m.status = NodeStatus{Health: domain.XrayNodeUnhealthy, LastError: result.err.Error(), CheckedAt: now}
+			log.Printf("warning: Xray node %s (%s) is unhealthy: %v", m.node.Name, m.node.APIAddress, result.err)
+		}
+	}
+	f.mu.Unlock()
+
+	closeAll(stale)
+}
+
+// Status returns the health of a node. Nodes that are not enabled report
+// disabled.
+func (f *Fleet) Status(nodeID string) NodeStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := f.members[nodeID]
+	if m == nil {
+		return NodeStatus{Health: domain.XrayNodeHealthDisabled}
+	}
+	return m.status
+}
+
+// AddUser adds the user to the nodes it is assigned to, or to every enabled
+// node when it has no assignment. It fails only when no node accepted the
+// change; each node's outcome is recorded in the sync table.
+func (f *Fleet) AddUser(ctx context.Context, email, uuid string) error {
+	nodeIDs, err := f.assignments.ListNodeIDs(ctx, email)
+	if err != nil {
+		return fmt.Errorf("list node assignments: %w", err)
+	}
+	return f.apply(ctx, f.targets(nodeIDs), email, domain.XraySyncAddUser, func(ctx context.Context, api nodeAPI) error {
+		return api.AddUser(ctx, email, uuid)
+	})
+}
+
+// RemoveUser removes the user from every enabled node, so users moved between
+// nodes do not linger on the ones they left.
+func (f *Fleet) RemoveUser(ctx context.Context, email string) error {
+	return f.apply(ctx, f.targets(nil), email, domain.XraySyncRemoveUser, func(ctx context.Context, api nodeAPI) error {
+		return api.RemoveUser(ctx, email)
+	})
+}
+
+type target struct {
+	node       domain.XrayNode
+	api        nodeAPI
+	generation int
+	health     domain.XrayNodeHealth
+}
+
+// targets snapshots the enabled members among nodeIDs, or all of them when
+// nodeIDs is empty.
+func (f *Fleet) targets(nodeIDs []string) []target {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var targets []target
+	add := func(m *member) {
+		targets = append(targets, target{node: m.node, api: m.api, generation: m.generation, health: m.status.Health})
+	}
+	if len(nodeIDs) == 0 {
+		for _, m := range f.members {
+			add(m)
+		}
+	} else {
+		for _, id := range nodeIDs {
+			if m := f.members[id]; m != nil {
+				add(m)
+			}
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].node.Name < targets[j].node.Name })
+	return targets
+}
+
+func (f *Fleet) apply(ctx context.Context, targets []target, email string, action domain.XraySyncAction, call func(context.Context, nodeAPI) error) error {
+	if len(targets) == 0 {
+		return fmt.Errorf("%s %s: %w", action, email, ErrNoNodes)
+	}
+
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		if t.api == nil || t.health == domain.XrayNodeUnhealthy {
+			errs[i] = fmt.Errorf("node %s is not connected", t.node.Name)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			callCtx, cancel := context.WithTimeout(ctx, f.config.Timeout)
+			defer cancel()
+			if err := call(callCtx, t.api); err != nil {
+				errs[i] = fmt.Errorf("node %s: %w", t.node.Name, err)
+				if isConnectionError(err) {
+					f.markUnhealthy(t, err)
+				}
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for i, t := range targets {
+		if errs[i] == nil {
+			succeeded++
+		}
+		f.recordSync(t.node, email, action, errs[i])
+	}
+
+	failed := errors.Join(errs...)
+	if succeeded == 0 {
+		return fmt.Errorf("%s %s failed on all %d node(s): %w", action, email, len(targets), failed)
+	}
+	if failed != nil {
+		log.Printf("warning: %s %s succeeded on %d of %d Xray nodes: %v", action, email, succeeded, len(targets), failed)
+	}
+	return nil
+}
+
+func (f *Fleet) recordSync(node domain.XrayNode, email string, action domain.XraySyncAction, syncErr error) {
+	record := &domain.XrayNodeSync{
+		NodeID:          node.ID,
+		IdentityAddress: email,
+		Action:          action,
+		Status:          domain.XraySyncSucceeded,
+		UpdatedAt:       time.Now().UnixMilli(),
+	}
+	if syncErr != nil {
+		record.Status = domain.XraySyncFailed
+		record.Error = syncErr.Error()
+	}
+	if err := f.syncs.Upsert(record); err != nil {
+		log.Printf("Failed to record Xray sync of %s on node %s: %v", email, node.Name, err)
+	}
+}
+
+func (f *Fleet) markUnhealthy(t target, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := f.members[t.node.ID]
+	if m == nil || m.generation != t.generation {
+		return
+	}
+	m.status = NodeStatus{Health: domain.XrayNodeUnhealthy, LastError: err.Error(), CheckedAt: time.Now().UnixMilli()}
+}
+
+// NodeTraffic is the raw per-user traffic counters of one node
+type NodeTraffic struct {
+	NodeID   string
+	NodeName string
+	Users    []*UserTraffic
+}
+
+// QueryNodeTraffic reads the traffic counters of every connected node. The
+// counters are kept per node because each node resets its own on restart.
+// Nodes that fail to answer are left out.
+func (f *Fleet) QueryNodeTraffic(ctx context.Context) ([]*NodeTraffic, error) {
+	targets := f.targets(nil)
+
+	results := make([]*NodeTraffic, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		if t.api == nil || t.health == domain.XrayNodeUnhealthy {
+			errs[i] = fmt.Errorf("node %s is not connected", t.node.Name)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			callCtx, cancel := context.WithTimeout(ctx, f.config.Timeout)
+			defer cancel()
+			users, err := t.api.QueryAllUsersTraffic(callCtx)
+			if err != nil {
+				errs[i] = fmt.Errorf("node %s: %w", t.node.Name, err)
+				return
+			}
+			results[i] = &NodeTraffic{NodeID: t.node.ID, NodeName: t.node.Name, Users: users}
+		}(i, t)
+	}
+	wg.Wait()
+
+	var answered []*NodeTraffic
+	for i, traffic := range results {
+		if errs[i] == nil {
+			answered = append(answered, traffic)
+		}
+	}
+
+	failed := errors.Join(errs...)
+	if len(answered) == 0 {
+		if failed == nil {
+			return nil, ErrNoNodes
+		}
+		return nil, fmt.Errorf("query traffic from all %d node(s): %w", len(targets), failed)
+	}
+	if failed != nil {
+		log.Printf("warning: traffic stats are missing %d of %d Xray nodes: %v", len(targets)-len(answered), len(targets), failed)
+	}
+	return answered, nil
+}
+
+// ReconcileResult summarises one drift repair pass over the fleet
+type ReconcileResult struct {
+	NodesChecked int
+	NodesSkipped int
+	Added        int
+	Removed      int
+	Failed       int
+}
+
+// Reconcile makes the users on every connected node match desired, which maps
+// each identity that should have access to its UUID. Users that are not
+// desired are only removed when managed lists them, so accounts added to an
+// inbound by hand are left alone. A user whose UUID differs is re-added.
+func (f *Fleet) Reconcile(ctx context.Context, desired map[string]string, managed map[string]bool) (*ReconcileResult, error) {
+	assignments, err := f.assignments.ListAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list node assignments: %w", err)
+	}
+	targets := f.targets(nil)
+	if len(targets) == 0 {
+		return nil, ErrNoNodes
+	}
+
+	results := make([]ReconcileResult, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		if t.api == nil || t.health == domain.XrayNodeUnhealthy {
+			results[i].NodesSkipped = 1
+			continue
+		}
+		wg.Add(1)
+		go func(result *ReconcileResult, t target) {
+			defer wg.Done()
+			f.reconcileNode(ctx, t, desired, managed, assignments, result)
+		}(&results[i], t)
+	}
+	wg.Wait()
+
+	total := &ReconcileResult{}
+	for _, result := range results {
+		total.NodesChecked += result.NodesChecked
+		total.NodesSkipped += result.NodesSkipped
+		total.Added += result.Added
+		total.Removed += result.Removed
+		total.Failed += result.Failed
+	}
+	return total, nil
+}
+
+func (f *Fleet) reconcileNode(ctx context.Context, t target, desired map[string]string, managed map[string]bool, assignments map[string][]string, result *ReconcileResult) {
+	listCtx, cancel := context.WithTimeout(ctx, f.config.Timeout)
+	users, err := t.api.ListUsers(listCtx)
+	cancel()
+	if err != nil {
+		log.Printf("warning: skipping reconciliation of Xray node %s: %v", t.node.Name, err)
+		if isConnectionError(err) {
+			f.markUnhealthy(t, err)
+		}
+		result.NodesSkipped = 1
+		return
+	}
+	result.NodesChecked = 1
+
+	present := make(map[string]string, len(users))
+	for _, user := range users {
+		present[user.Email] = user.UUID
+	}
+	wanted := func(email string) bool {
+		if _, ok := desired[email]; !ok {
+			return false
+		}
+		nodeIDs := assignments[email]
+		if len(nodeIDs) == 0 {
+			return true
+		}
+		for _, id := range nodeIDs {
+			if id == t.node.ID {
+				return true
+			}
+		}
+		return false
+	}
+	call := func(action domain.XraySyncAction, email string, fn func(context.Context) error) bool {
+		callCtx, cancel := context.WithTimeout(ctx, f.config.Timeout)
+		defer cancel()
+		err := fn(callCtx)
+		f.recordSync(t.node, email, action, err)
+		if err != nil {
+			log.Printf("Failed to %s %s on Xray node %s during reconciliation: %v", action, email, t.node.Name, err)
+			result.Failed++
+			return false
+		}
+		return true
+	}
+
+	for email, uuid := range desired {
+		current, ok := present[email]
+		if !wanted(email) || (ok && current == uuid) {
+			continue
+		}
+		if ok && !call(domain.XraySyncRemoveUser, email, func(ctx context.Context) error { return t.api.RemoveUser(ctx, email) }) {
+			continue
+		}
+		if call(domain.XraySyncAddUser, email, func(ctx context.Context) error { return t.api.AddUser(ctx, email, uuid) }) {
+			result.Added++
+		}
+	}
+	for email := range present {
+		if !managed[email] || wanted(email) {
+			continue
+		}
+		if call(domain.XraySyncRemoveUser, email, func(ctx context.Context) error { return t.api.RemoveUser(ctx, email) }) {
+			result.Removed++
+		}
+	}
+}
+
+// Close closes every node connection
+func (f *Fleet) Close() error {
+	f.mu.Lock()
+	var apis []nodeAPI
+	for id, m := range f.members {
+		if m.api != nil {
+			apis = append(apis, m.api)
+		}
+		delete(f.members, id)
+	}
+	f.mu.Unlock()
+
+	var errs []error
+	for _, api := range apis {
+		if err := api.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func closeAll(apis []nodeAPI) {
+	for _, api := range apis {
+		if err := api.Close(); err != nil {
+			log.Printf("Xray node connection close error: %v", err)
+		}
+	}
+}
+
+// isConnectionError reports whether err means the node could not be reached,
+// as opposed to the node rejecting the request.
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,393 @@
+package xray
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"market-blockchain/internal/domain"
+)
+
+type fakeNodeAPI struct {
+	mu      sync.Mutex
+	users   map[string]string
+	err     error
+	pingErr error
+	traffic []*UserTraffic
+	closed  bool
+}
+
+func newFakeNodeAPI() *fakeNodeAPI {
+	return &fakeNodeAPI{users: make(map[string]string)}
+}
+
+func (f *fakeNodeAPI) AddUser(ctx context.Context, email, uuid string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.users[email] = uuid
+	return nil
+}
+
+func (f *fakeNodeAPI) RemoveUser(ctx context.Context, email string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	delete(f.users, email)
+	return nil
+}
+
+func (f *fakeNodeAPI) QueryAllUsersTraffic(ctx context.Context) ([]*UserTraffic, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.traffic, nil
+}
+
+func (f *fakeNodeAPI) ListUsers(ctx context.Context) ([]InboundUser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	users := make([]InboundUser, 0, len(f.users))
+	for email, uuid := range f.users {
+		users = append(users, InboundUser{Email: email, UUID: uuid})
+	}
+	return users, nil
+}
+
+func (f *fakeNodeAPI) Ping(ctx context.Context) error { return f.pingErr }
+
+func (f *fakeNodeAPI) Close() error {
+	f.closed = true
+	return nil
+}
+
+func (f *fakeNodeAPI) hasUser(email string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.users[email]
+	return ok
+}
+
+type fakeXrayNodeRepository struct {
+	nodes []*domain.XrayNode
+}
+
+func (r *fakeXrayNodeRepository) Create(node *domain.XrayNode) error {
+	r.nodes = append(r.nodes, node)
+	return nil
+}
+
+func (r *fakeXrayNodeRepository) Update(node *domain.XrayNode) error {
+	for i, existing := range r.nodes {
+		if existing.ID == node.ID {
+			r.nodes[i] = node
+		}
+	}
+	return nil
+}
+
+func (r *fakeXrayNodeRepository) Delete(ctx context.Context, id string) error {
+	for i, existing := range r.nodes {
+		if existing.ID == id {
+			r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *fakeXrayNodeRepository) GetByID(ctx context.Context, id string) (*domain.XrayNode, error) {
+	for _, node := range r.nodes {
+		if node.ID == id {
+			return node, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeXrayNodeRepository) ListAll(ctx context.Context) ([]*domain.XrayNode, error) {
+	return r.nodes, nil
+}
+
+type fakeXrayNodeAssignmentRepository struct {
+	nodeIDs map[string][]string
+}
+
+func (r *fakeXrayNodeAssignmentRepository) ListNodeIDs(ctx context.Context, identityAddress string) ([]string, error) {
+	return r.nodeIDs[identityAddress], nil
+}
+
+func (r *fakeXrayNodeAssignmentRepository) ListAll(ctx context.Context) (map[string][]string, error) {
+	return r.nodeIDs, nil
+}
+
+func (r *fakeXrayNodeAssignmentRepository) Replace(ctx context.Context, identityAddress string, nodeIDs []string, now int64) error {
+	r.nodeIDs[identityAddress] = nodeIDs
+	return nil
+}
+
+type fakeXrayNodeSyncRepository struct {
+	mu    sync.Mutex
+	syncs map[string]*domain.XrayNodeSync
+}
+
+func (r *fakeXrayNodeSyncRepository) Upsert(sync *domain.XrayNodeSync) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.syncs[sync.NodeID+"/"+sync.IdentityAddress] = sync
+	return nil
+}
+
+func (r *fakeXrayNodeSyncRepository) ListByIdentity(ctx context.Context, identityAddress string) ([]*domain.XrayNodeSync, error) {
+	return nil, nil
+}
+
+type fleetFixture struct {
+	fleet       *Fleet
+	nodes       *fakeXrayNodeRepository
+	assignments *fakeXrayNodeAssignmentRepository
+	syncs       *fakeXrayNodeSyncRepository
+	apis        map[string]*fakeNodeAPI
+	dialErrs    map[string]error
+}
+
+func newFleetFixture(t *testing.T, nodeIDs ...string) *fleetFixture {
+	t.Helper()
+
+	fx := &fleetFixture{
+		nodes:       &fakeXrayNodeRepository{},
+		assignments: &fakeXrayNodeAssignmentRepository{nodeIDs: make(map[string][]string)},
+		syncs:       &fakeXrayNodeSyncRepository{syncs: make(map[string]*domain.XrayNodeSync)},
+		apis:        make(map[string]*fakeNodeAPI),
+		dialErrs:    make(map[string]error),
+	}
+	for _, id := range nodeIDs {
+		fx.nodes.nodes = append(fx.nodes.nodes, &domain.XrayNode{ID: id, Name: id, APIAddress: id + ":10085", InboundTag: "vless-in", Enabled: true})
+		fx.apis[id] = newFakeNodeAPI()
+	}
+
+	fx.fleet = NewFleet(fx.nodes, fx.assignments, fx.syncs, FleetConfig{Timeout: time.Second})
+	fx.fleet.dial = func(node domain.XrayNode, timeout time.Duration) (nodeAPI, error) {
+		if err := fx.dialErrs[node.ID]; err != nil {
+			return nil, err
+		}
+		return fx.apis[node.ID], nil
+	}
+	return fx
+}
+
+func (fx *fleetFixture) sync(t *testing.T) {
+	t.Helper()
+	if err := fx.fleet.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh returned error: %v", err)
+	}
+	fx.fleet.CheckHealth(context.Background())
+}
+
+func (fx *fleetFixture) syncStatus(nodeID, identity string) domain.XraySyncStatus {
+	record := fx.syncs.syncs[nodeID+"/"+identity]
+	if record == nil {
+		return ""
+	}
+	return record.Status
+}
+
+func TestFleetAddUserGoesToEveryNodeWithoutAssignment(t *testing.T) {
+	fx := newFleetFixture(t, "node_a", "node_b")
+	fx.sync(t)
+
+	if err := fx.fleet.AddUser(context.Background(), "0xabc", "uuid-1"); err != nil {
+		t.Fatalf("AddUser returned error: %v", err)
+	}
+	for _, id := range []string{"node_a", "node_b"} {
+		if !fx.apis[id].hasUser("0xabc") {
+			t.Fatalf("expected user on %s", id)
+		}
+		if got := fx.syncStatus(id, "0xabc"); got != domain.XraySyncSucceeded {
+			t.Fatalf("expected succeeded sync on %s, got %q", id, got)
+		}
+	}
+}
+
+func TestFleetAddUserHonoursAssignmentAndRemoveUserGoesEverywhere(t *testing.T) {
+	fx := newFleetFixture(t, "node_a", "node_b")
+	fx.assignments.nodeIDs["0xabc"] = []string{"node_b"}
+	fx.apis["node_a"].users["0xabc"] = "stale"
+	fx.sync(t)
+
+	if err := fx.fleet.AddUser(context.Background(), "0xabc", "uuid-1"); err != nil {
+		t.Fatalf("AddUser returned error: %v", err)
+	}
+	if !fx.apis["node_b"].hasUser("0xabc") {
+		t.Fatal("expected user on the assigned node")
+	}
+	if fx.syncStatus("node_a", "0xabc") != "" {
+		t.Fatal("expected no sync recorded for the unassigned node")
+	}
+
+	if err := fx.fleet.RemoveUser(context.Background(), "0xabc"); err != nil {
+		t.Fatalf("RemoveUser returned error: %v", err)
+	}
+	if fx.apis["node_a"].hasUser("0xabc") || fx.apis["node_b"].hasUser("0xabc") {
+		t.Fatal("expected user removed from every node")
+	}
+}
+
+func TestFleetSkipsUnreachableNodeAndRecordsFailure(t *testing.T) {
+	fx := newFleetFixture(t, "node_a", "node_b")
+	fx.dialErrs["node_b"] = errors.New("connection refused")
+	fx.sync(t)
+
+	if got := fx.fleet.Status("node_b").Health; got != domain.XrayNodeUnhealthy {
+		t.Fatalf("expected node_b unhealthy, got %q", got)
+	}
+
+	if err := fx.fleet.AddUser(context.Background(), "0xabc", "uuid-1"); err != nil {
+		t.Fatalf("expected partial success to return nil, got %v", err)
+	}
+	if !fx.apis["node_a"].hasUser("0xabc") {
+		t.Fatal("expected user on the healthy node")
+	}
+	if got := fx.syncStatus("node_b", "0xabc"); got != domain.XraySyncFailed {
+		t.Fatalf("expected failed sync on node_b, got %q", got)
+	}
+}
+
+func TestFleetMarksNodeUnhealthyWhenCallIsUnavailable(t *testing.T) {
+	fx := newFleetFixture(t, "node_a", "node_b")
+	fx.sync(t)
+	fx.apis["node_b"].err = status.Error(codes.Unavailable, "connection reset")
+
+	if err := fx.fleet.AddUser(context.Background(), "0xabc", "uuid-1"); err != nil {
+		t.Fatalf("AddUser returned error: %v", err)
+	}
+	if got := fx.fleet.Status("node_b").Health; got != domain.XrayNodeUnhealthy {
+		t.Fatalf("expected node_b unhealthy after unavailable call, got %q", got)
+	}
+
+	fx.apis["node_b"].err = nil
+	fx.sync(t)
+	if got := fx.fleet.Status("node_b").Health; got != domain.XrayNodeHealthy {
+		t.Fatalf("expected node_b healthy after a successful ping, got %q", got)
+	}
+}
+
+func TestFleetFailsWhenNoNodeAccepts(t *testing.T) {
+	fx := newFleetFixture(t, "node_a")
+	fx.sync(t)
+	fx.apis["node_a"].err = errors.New("inbound not found")
+
+	if err := fx.fleet.AddUser(context.Background(), "0xabc", "uuid-1"); err == nil {
+		t.Fatal("expected AddUser to fail when every node rejects it")
+	}
+	if got := fx.fleet.Status("node_a").Health; got != domain.XrayNodeHealthy {
+		t.Fatalf("expected a rejected request to leave node_a healthy, got %q", got)
+	}
+
+	empty := newFleetFixture(t)
+	empty.sync(t)
+	if err := empty.fleet.RemoveUser(context.Background(), "0xabc"); !errors.Is(err, ErrNoNodes) {
+		t.Fatalf("expected ErrNoNodes, got %v", err)
+	}
+}
+
+func TestFleetRefreshReconnectsChangedAndDropsDisabledNodes(t *testing.T) {
+	fx := newFleetFixture(t, "node_a", "node_b")
+	fx.sync(t)
+	oldA := fx.apis["node_a"]
+
+	fx.nodes.nodes[0].APIAddress = "10.0.0.9:10085"
+	fx.apis["node_a"] = newFakeNodeAPI()
+	fx.nodes.nodes[1].Enabled = false
+	fx.sync(t)
+
+	if !oldA.closed {
+		t.Fatal("expected the old connection to node_a to be closed")
+	}
+	if !fx.apis["node_b"].closed {
+		t.Fatal("expected the disabled node's connection to be closed")
+	}
+	if got := fx.fleet.Status("node_b").Health; got != domain.XrayNodeHealthDisabled {
+		t.Fatalf("expected node_b disabled, got %q", got)
+	}
+
+	if err := fx.fleet.AddUser(context.Background(), "0xabc", "uuid-1"); err != nil {
+		t.Fatalf("AddUser returned error: %v", err)
+	}
+	if !fx.apis["node_a"].hasUser("0xabc") || oldA.hasUser("0xabc") {
+		t.Fatal("expected the user to reach node_a over the new connection")
+	}
+}
+
+func TestFleetQueriesTrafficPerNode(t *testing.T) {
+	fx := newFleetFixture(t, "node_a", "node_b", "node_c")
+	fx.apis["node_a"].traffic = []*UserTraffic{{Email: "0xabc", Uplink: 10, Downlink: 20}}
+	fx.apis["node_b"].traffic = []*UserTraffic{{Email: "0xabc", Uplink: 1, Downlink: 2}, {Email: "0xdef", Uplink: 5}}
+	fx.apis["node_c"].err = errors.New("stats disabled")
+	fx.sync(t)
+
+	traffic, err := fx.fleet.QueryNodeTraffic(context.Background())
+	if err != nil {
+		t.Fatalf("QueryNodeTraffic returned error: %v", err)
+	}
+	byNode := make(map[string]*NodeTraffic)
+	for _, entry := range traffic {
+		byNode[entry.NodeID] = entry
+	}
+	if len(byNode) != 2 || byNode["node_c"] != nil {
+		t.Fatalf("expected the two answering nodes, got %+v", byNode)
+	}
+	if got := byNode["node_a"]; got == nil || len(got.Users) != 1 || got.Users[0].Uplink != 10 || got.Users[0].Downlink != 20 {
+		t.Fatalf("unexpected node_a traffic: %+v", got)
+	}
+	if got := byNode["node_b"]; got == nil || len(got.Users) != 2 {
+		t.Fatalf("unexpected node_b traffic: %+v", got)
+	}
+}
+
+func TestFleetReconcileRepairsDriftOnEachNode(t *testing.T) {
+	fx := newFleetFixture(t, "node_a", "node_b")
+	fx.assignments.nodeIDs["0xpinned"] = []string{"node_b"}
+	fx.apis["node_a"].users["0xstale"] = "uuid-stale"
+	fx.apis["node_a"].users["0xrotated"] = "uuid-old"
+	fx.apis["node_a"].users["0xpinned"] = "uuid-pinned"
+	fx.apis["node_a"].users["manual@ops"] = "uuid-manual"
+	fx.sync(t)
+
+	desired := map[string]string{"0xactive": "uuid-active", "0xrotated": "uuid-new", "0xpinned": "uuid-pinned"}
+	managed := map[string]bool{"0xactive": true, "0xrotated": true, "0xpinned": true, "0xstale": true}
+
+	result, err := fx.fleet.Reconcile(context.Background(), desired, managed)
+	if err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if result.NodesChecked != 2 || result.Failed != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	nodeA := fx.apis["node_a"]
+	if !nodeA.hasUser("0xactive") || nodeA.users["0xrotated"] != "uuid-new" {
+		t.Fatalf("expected missing and rotated users fixed on node_a, got %v", nodeA.users)
+	}
+	if nodeA.hasUser("0xstale") || nodeA.hasUser("0xpinned") {
+		t.Fatalf("expected inactive and unassigned users removed from node_a, got %v", nodeA.users)
+	}
+	if !nodeA.hasUser("manual@ops") {
+		t.Fatal("expected unmanaged user to be left alone")
+	}
+	if !fx.apis["node_b"].hasUser("0xpinned") {
+		t.Fatal("expected pinned user added to its assigned node")
+	}
+	if got := fx.syncStatus("node_a", "0xstale"); got != domain.XraySyncSucceeded {
+		t.Fatalf("expected removal recorded, got %q", got)
+	}
+}
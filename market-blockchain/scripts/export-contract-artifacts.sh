@@ -0,0 +1,22 @@
+#!/bin/bash
+# 编译 phase4 合约，并把测试用到的 ABI 和 bytecode 导出到
+# internal/blockchain/chaintest/testdata，供模拟链测试直接部署。
+# 合约有改动时运行本脚本，并提交 testdata 下的变更。
+
+set -e
+
+ROOT="$(cd "$(dirname "$0")/.." && pwd)"
+CONTRACTS="$ROOT/../docs/V2_design/validation/phase4/contracts"
+TESTDATA="$ROOT/internal/blockchain/chaintest/testdata"
+
+cd "$CONTRACTS"
+if [ ! -d lib/openzeppelin-contracts ]; then
+    forge install --no-git OpenZeppelin/openzeppelin-contracts
+fi
+forge build
+
+for artifact in MockUSDC.sol/MockUSDC VPNCreditVaultV4.sol/VPNCreditVaultV4; do
+    mkdir -p "$TESTDATA/$(dirname "$artifact")"
+    jq '{abi: .abi, bytecode: {object: .bytecode.object}}' "out/$artifact.json" > "$TESTDATA/$artifact.json"
+    echo "✓ $artifact"
+done